@@ -0,0 +1,130 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of the AdaptiveLimit settings.
+const (
+	DefaultAdaptiveInitialLimit = 20
+	DefaultAdaptiveMaxLimit     = 1000
+	DefaultAdaptiveTolerance    = 2.0
+	DefaultAdaptiveBackoff      = 0.9
+)
+
+// baselineWeight is the weight of a latency sample in the baseline latency average.
+const baselineWeight = 0.05
+
+// AdaptiveLimit configures an AdaptiveConcurrencyLimiter. The zero values select the defaults.
+type AdaptiveLimit struct {
+	// InitialLimit is the concurrency limit before any latency is observed.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the concurrency limit, 1 and DefaultAdaptiveMaxLimit by default.
+	MinLimit int
+	MaxLimit int
+	// Tolerance is the ratio of the latency to the baseline latency above which the upstream is
+	// considered congested.
+	Tolerance float64
+	// Backoff is the factor the limit is multiplied with when the upstream is congested.
+	Backoff float64
+	// RetryAfter is the delay of the Retry-After header of the rejected requests, DefaultRetryAfter if zero.
+	RetryAfter time.Duration
+}
+
+// AdaptiveConcurrencyLimiter returns middleware capping the in-flight requests by a limit adapting to
+// the upstream latency with the AIMD algorithm: the limit is increased by one per limit requests
+// served within the tolerated latency while the demand is close to the limit, and multiplied by the
+// backoff factor when a request takes longer than the tolerated multiple of the baseline latency, a
+// slowly moving average. The requests exceeding the limit are rejected with HTTP 503 service
+// unavailable and a Retry-After header. Register it with Use or UseGroup.
+func AdaptiveConcurrencyLimiter(limit AdaptiveLimit) Middleware {
+	l := newAdaptiveLimiter(limit)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.acquire() {
+				TraceFromContext(r.Context()).Add("limit", "adaptive limit of "+strconv.Itoa(l.Limit())+" exceeded")
+				reject(w, l.cfg.RetryAfter)
+				return
+			}
+			start := time.Now()
+			defer func() {
+				l.release(time.Since(start))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// adaptiveLimiter is the state of an AdaptiveConcurrencyLimiter.
+type adaptiveLimiter struct {
+	cfg AdaptiveLimit
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// baseline is the moving average of the latency, zero until a request completed.
+	baseline float64
+}
+
+// newAdaptiveLimiter creates the limiter, applying the defaults.
+func newAdaptiveLimiter(cfg AdaptiveLimit) *adaptiveLimiter {
+	cfg.MinLimit = max(cfg.MinLimit, 1)
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = DefaultAdaptiveMaxLimit
+	}
+	cfg.MaxLimit = max(cfg.MaxLimit, cfg.MinLimit)
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = DefaultAdaptiveInitialLimit
+	}
+	if cfg.Tolerance <= 1 {
+		cfg.Tolerance = DefaultAdaptiveTolerance
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = DefaultAdaptiveBackoff
+	}
+	return &adaptiveLimiter{
+		cfg:   cfg,
+		limit: float64(min(max(cfg.InitialLimit, cfg.MinLimit), cfg.MaxLimit)),
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (l *adaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// acquire registers an in-flight request, or returns false if the limit is reached.
+func (l *adaptiveLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// release unregisters an in-flight request and adapts the limit to its latency.
+func (l *adaptiveLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	busy := l.inflight*2 >= int(l.limit)
+	l.inflight--
+	sample := float64(latency)
+	switch {
+	case l.baseline > 0 && sample > l.baseline*l.cfg.Tolerance:
+		l.limit = max(l.limit*l.cfg.Backoff, float64(l.cfg.MinLimit))
+	case busy:
+		l.limit = min(l.limit+1/l.limit, float64(l.cfg.MaxLimit))
+	}
+	if l.baseline == 0 {
+		l.baseline = sample
+	} else {
+		l.baseline += (sample - l.baseline) * baselineWeight
+	}
+}
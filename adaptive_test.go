@@ -0,0 +1,68 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLimiterDefaults(t *testing.T) {
+	l := newAdaptiveLimiter(AdaptiveLimit{})
+	assert.Equal(t, DefaultAdaptiveInitialLimit, l.Limit())
+	assert.Equal(t, 1, l.cfg.MinLimit)
+	assert.Equal(t, DefaultAdaptiveMaxLimit, l.cfg.MaxLimit)
+
+	l = newAdaptiveLimiter(AdaptiveLimit{InitialLimit: 50, MaxLimit: 10})
+	assert.Equal(t, 10, l.Limit())
+}
+
+func TestAdaptiveLimiterBackoff(t *testing.T) {
+	l := newAdaptiveLimiter(AdaptiveLimit{InitialLimit: 10, MinLimit: 2, Backoff: 0.5})
+	assert.True(t, l.acquire())
+	l.release(10 * time.Millisecond)
+	assert.Equal(t, 10, l.Limit())
+
+	// a latency above twice the baseline halves the limit down to the minimum
+	for _, want := range []int{5, 2, 2} {
+		assert.True(t, l.acquire())
+		l.release(time.Second)
+		assert.Equal(t, want, l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterIncrease(t *testing.T) {
+	l := newAdaptiveLimiter(AdaptiveLimit{InitialLimit: 4, MaxLimit: 5})
+
+	// idle upstreams don't raise the limit
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.acquire())
+		l.release(10 * time.Millisecond)
+	}
+	assert.Equal(t, 4, l.Limit())
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.acquire())
+		assert.True(t, l.acquire())
+		l.release(10 * time.Millisecond)
+		l.release(10 * time.Millisecond)
+	}
+	assert.Equal(t, 5, l.Limit())
+}
+
+func TestAdaptiveConcurrencyLimiter(t *testing.T) {
+	origin := newBlockingHandler()
+	h := AdaptiveConcurrencyLimiter(AdaptiveLimit{InitialLimit: 1})(origin)
+
+	first := serveFrom(h, "/slow", "10.0.0.1:1234")
+	<-origin.entered
+	w := <-serveFrom(h, "/fast", "10.0.0.2:1234")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(origin.release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	w = <-serveFrom(h, "/fast", "10.0.0.2:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,359 @@
+// Package admin provides a management HTTP API for a ReverseProxyMux. The API is meant to be served on
+// a separate listener, which is not reachable by the proxy clients.
+//
+// The following endpoints are provided:
+//
+//	GET    /routes             lists the registered routes
+//	GET    /upstreams          shows the health status and load of the proxy origin
+//	POST   /upstreams/drain    stops forwarding new requests to the proxy origin
+//	POST   /upstreams/undrain  resumes forwarding requests to the proxy origin
+//	GET    /backends           lists the backends of the pool
+//	POST   /backends/drain     drains the backend of the url query parameter, waiting for its in-flight
+//	                           requests up to the timeout query parameter, 30s by default
+//	POST   /backends/undrain   resumes forwarding requests to the backend of the url query parameter
+//	DELETE /backends           removes and drains the backend of the url query parameter
+//	GET    /maintenance        shows whether the maintenance mode is enabled
+//	PUT    /maintenance        toggles the maintenance mode with a {"enabled": bool} body
+//	GET    /config             dumps the current configuration
+//	GET    /stats              shows the rolling request statistics, see ReverseProxyMux.EnableStats
+//	GET    /faults             lists the injected faults by route pattern, see SetFaultInjector
+//	PUT    /faults             sets the fault of the route query parameter with a faults.Fault body
+//	DELETE /faults             removes the fault of the route query parameter, or all faults without it
+//
+// The pprof, expvar and route table dump endpoints are registered by EnableDebug.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/faults"
+)
+
+// RouteInfo is the JSON representation of a registered route.
+type RouteInfo struct {
+	Methods       []string    `json:"methods"`
+	Path          string      `json:"path"`
+	RewritePath   string      `json:"rewritePath,omitempty"`
+	RequestHeader http.Header `json:"requestHeader,omitempty"`
+}
+
+// UpstreamInfo is the JSON representation of the proxy origin state.
+type UpstreamInfo struct {
+	URL       string `json:"url"`
+	Available bool   `json:"available"`
+	Draining  bool   `json:"draining"`
+	Load      int32  `json:"load"`
+}
+
+// BackendInfo is the JSON representation of a backend of the pool.
+type BackendInfo struct {
+	URL       string            `json:"url"`
+	Weight    int               `json:"weight"`
+	Zone      string            `json:"zone,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Available bool              `json:"available"`
+	InFlight  int64             `json:"inFlight"`
+	Draining  bool              `json:"draining"`
+}
+
+// DefaultDrainTimeout is the time drained and removed backends get to complete their in-flight requests.
+const DefaultDrainTimeout = 30 * time.Second
+
+var (
+	errNoInjector   = errors.New("fault injection is not enabled")
+	errMissingRoute = errors.New("missing route query parameter")
+)
+
+// MaintenanceInfo is the JSON representation of the maintenance mode state.
+type MaintenanceInfo struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Config is the JSON representation of the current proxy configuration.
+type Config struct {
+	Upstreams     []UpstreamInfo `json:"upstreams"`
+	RequestHeader http.Header    `json:"requestHeader,omitempty"`
+	Maintenance   bool           `json:"maintenance"`
+	Routes        []RouteInfo    `json:"routes"`
+}
+
+// Server is the admin API of a ReverseProxyMux.
+type Server struct {
+	mux    *reverseproxy.ReverseProxyMux
+	router *httprouter.Router
+	faults *faults.Injector
+}
+
+// New creates a new admin Server managing the passed proxy.
+func New(pm *reverseproxy.ReverseProxyMux) *Server {
+	s := &Server{
+		mux:    pm,
+		router: httprouter.New(),
+	}
+	s.router.GET("/routes", s.handleRoutes)
+	s.router.GET("/upstreams", s.handleUpstreams)
+	s.router.POST("/upstreams/drain", s.handleDrain)
+	s.router.POST("/upstreams/undrain", s.handleUndrain)
+	s.router.GET("/backends", s.handleBackends)
+	s.router.POST("/backends/drain", s.handleDrainBackend)
+	s.router.POST("/backends/undrain", s.handleUndrainBackend)
+	s.router.DELETE("/backends", s.handleRemoveBackend)
+	s.router.GET("/maintenance", s.handleMaintenance)
+	s.router.PUT("/maintenance", s.handleSetMaintenance)
+	s.router.GET("/config", s.handleConfig)
+	s.router.GET("/stats", s.handleStats)
+	s.router.GET("/faults", s.handleFaults)
+	s.router.PUT("/faults", s.handleSetFault)
+	s.router.DELETE("/faults", s.handleRemoveFault)
+	return s
+}
+
+// SetFaultInjector enables the /faults endpoints controlling the injector, which answer 404 not found
+// otherwise. It must be called before serving the API.
+func (s *Server) SetFaultInjector(in *faults.Injector) *Server {
+	s.faults = in
+	return s
+}
+
+// ServeHTTP handles the HTTP request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on the TCP network address addr and serves the admin API.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) handleRoutes(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.routes())
+}
+
+func (s *Server) handleUpstreams(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.upstreams())
+}
+
+func (s *Server) handleDrain(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.mux.Drain()
+	writeJSON(w, http.StatusOK, s.upstreams())
+}
+
+func (s *Server) handleUndrain(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.mux.Undrain()
+	writeJSON(w, http.StatusOK, s.upstreams())
+}
+
+func (s *Server) handleBackends(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.backends())
+}
+
+func (s *Server) handleDrainBackend(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b := s.backend(w, r)
+	if b == nil {
+		return
+	}
+	ctx, cancel, ok := drainContext(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+	if err := b.Drain(ctx); err != nil {
+		writeError(w, http.StatusGatewayTimeout, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.backends())
+}
+
+func (s *Server) handleUndrainBackend(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b := s.backend(w, r)
+	if b == nil {
+		return
+	}
+	b.Undrain()
+	writeJSON(w, http.StatusOK, s.backends())
+}
+
+func (s *Server) handleRemoveBackend(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b := s.backend(w, r)
+	if b == nil {
+		return
+	}
+	ctx, cancel, ok := drainContext(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+	switch err := s.mux.RemoveBackend(ctx, b); {
+	case errors.Is(err, reverseproxy.ErrLastBackend):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, s.backends())
+	}
+}
+
+func (s *Server) handleMaintenance(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, MaintenanceInfo{Enabled: s.mux.InMaintenance()})
+}
+
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var info MaintenanceInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mux.SetMaintenance(info.Enabled)
+	writeJSON(w, http.StatusOK, MaintenanceInfo{Enabled: s.mux.InMaintenance()})
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, Config{
+		Upstreams:     s.upstreams(),
+		RequestHeader: s.mux.RequestHeader,
+		Maintenance:   s.mux.InMaintenance(),
+		Routes:        s.routes(),
+	})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.mux.Stats())
+}
+
+func (s *Server) handleFaults(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	if s.injector(w) == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.faults.Faults())
+}
+
+func (s *Server) handleSetFault(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	in := s.injector(w)
+	if in == nil {
+		return
+	}
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeError(w, http.StatusBadRequest, errMissingRoute)
+		return
+	}
+	var f faults.Fault
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := in.Set(route, f); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, in.Faults())
+}
+
+func (s *Server) handleRemoveFault(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	in := s.injector(w)
+	if in == nil {
+		return
+	}
+	if route := r.URL.Query().Get("route"); route != "" {
+		in.Remove(route)
+	} else {
+		in.Clear()
+	}
+	writeJSON(w, http.StatusOK, in.Faults())
+}
+
+// injector returns the fault injector, or writes an error response and returns nil.
+func (s *Server) injector(w http.ResponseWriter) *faults.Injector {
+	if s.faults == nil {
+		writeError(w, http.StatusNotFound, errNoInjector)
+	}
+	return s.faults
+}
+
+// routes returns the JSON representation of the registered routes.
+func (s *Server) routes() []RouteInfo {
+	routes := s.mux.Routes()
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, route := range routes {
+		infos = append(infos, RouteInfo{
+			Methods:       route.Method,
+			Path:          route.Path,
+			RewritePath:   route.RewritePath,
+			RequestHeader: route.RequestHeader,
+		})
+	}
+	return infos
+}
+
+// upstreams returns the JSON representation of the proxy origin state.
+func (s *Server) upstreams() []UpstreamInfo {
+	return []UpstreamInfo{{
+		URL:       s.mux.Remote().String(),
+		Available: s.mux.IsAvailable(),
+		Draining:  s.mux.IsDraining(),
+		Load:      s.mux.GetLoad(),
+	}}
+}
+
+// backends returns the JSON representation of the backends of the pool.
+func (s *Server) backends() []BackendInfo {
+	backends := s.mux.Backends()
+	infos := make([]BackendInfo, 0, len(backends))
+	for _, b := range backends {
+		infos = append(infos, BackendInfo{
+			URL:       b.URL().String(),
+			Weight:    b.Weight(),
+			Zone:      b.Zone(),
+			Labels:    b.Labels(),
+			Available: b.IsAvailable(),
+			InFlight:  b.InFlight(),
+			Draining:  b.IsDraining(),
+		})
+	}
+	return infos
+}
+
+// drainContext returns the context bounding the drain time by the timeout query parameter, or writes
+// an error response and returns false.
+func drainContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, bool) {
+	timeout := DefaultDrainTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return nil, nil, false
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, true
+}
+
+// backend returns the backend of the url query parameter, or writes an error response and returns nil.
+func (s *Server) backend(w http.ResponseWriter, r *http.Request) *reverseproxy.Backend {
+	b := s.mux.Backend(r.URL.Query().Get("url"))
+	if b == nil {
+		writeError(w, http.StatusNotFound, reverseproxy.ErrBackendNotFound)
+	}
+	return b
+}
+
+// writeJSON writes v as the JSON response body with the passed status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as the JSON response body with the passed status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/faults"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*reverseproxy.ReverseProxyMux, *Server, *httptest.Server) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(origin.Close)
+
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPath("GET|POST", "/api/posts")
+	pm.RewritePath("GET", "/posts", "/api/posts")
+	return pm, New(pm), origin
+}
+
+func do(s http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestRoutes(t *testing.T) {
+	_, s, _ := newTestServer(t)
+
+	w := do(s, "GET", "/routes", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var routes []RouteInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+	assert.Equal(t, []RouteInfo{
+		{Methods: []string{"GET", "POST"}, Path: "/api/posts"},
+		{Methods: []string{"GET"}, Path: "/posts", RewritePath: "/api/posts"},
+	}, routes)
+}
+
+func TestDrain(t *testing.T) {
+	pm, s, origin := newTestServer(t)
+
+	w := do(s, "POST", "/upstreams/drain", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var upstreams []UpstreamInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upstreams))
+	assert.Equal(t, []UpstreamInfo{{URL: origin.URL, Available: true, Draining: true}}, upstreams)
+	assert.Equal(t, http.StatusServiceUnavailable, do(pm, "GET", "/api/posts", "").Code)
+
+	do(s, "POST", "/upstreams/undrain", "")
+	assert.False(t, pm.IsDraining())
+	assert.Equal(t, http.StatusOK, do(pm, "GET", "/api/posts", "").Code)
+}
+
+func TestMaintenance(t *testing.T) {
+	pm, s, _ := newTestServer(t)
+
+	w := do(s, "PUT", "/maintenance", `{"enabled": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": true}`, w.Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, do(pm, "GET", "/api/posts", "").Code)
+
+	w = do(s, "PUT", "/maintenance", `{"enabled":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	do(s, "PUT", "/maintenance", `{"enabled": false}`)
+	assert.JSONEq(t, `{"enabled": false}`, do(s, "GET", "/maintenance", "").Body.String())
+	assert.Equal(t, http.StatusOK, do(pm, "GET", "/api/posts", "").Code)
+}
+
+func TestConfig(t *testing.T) {
+	pm, s, _ := newTestServer(t)
+	pm.RequestHeader = http.Header{"X-Api-Key": []string{"abc"}}
+
+	w := do(s, "GET", "/config", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var config Config
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Len(t, config.Upstreams, 1)
+	assert.Len(t, config.Routes, 2)
+	assert.Equal(t, pm.RequestHeader, config.RequestHeader)
+	assert.False(t, config.Maintenance)
+}
+
+func TestBackends(t *testing.T) {
+	pm, s, origin := newTestServer(t)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	_, err := pm.AddBackend(other.URL, reverseproxy.BackendWeight(2), reverseproxy.BackendZone("eu-west-1a"))
+	assert.NoError(t, err)
+	first := BackendInfo{URL: origin.URL, Weight: 1, Available: true}
+	second := BackendInfo{URL: other.URL, Weight: 2, Zone: "eu-west-1a", Available: true}
+	drained := second
+	drained.Draining = true
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		want       []BackendInfo
+	}{
+		{"Test listing", "GET", "/backends", http.StatusOK, []BackendInfo{first, second}},
+		{"Test draining", "POST", "/backends/drain?url=" + other.URL, http.StatusOK, []BackendInfo{first, drained}},
+		{"Test undraining", "POST", "/backends/undrain?url=" + other.URL, http.StatusOK, []BackendInfo{first, second}},
+		{"Test unknown backend", "POST", "/backends/drain?url=http://unknown", http.StatusNotFound, nil},
+		{"Test invalid timeout", "DELETE", "/backends?timeout=x&url=" + other.URL, http.StatusBadRequest, nil},
+		{"Test removal", "DELETE", "/backends?url=" + other.URL, http.StatusOK, []BackendInfo{first}},
+		{"Test last backend removal", "DELETE", "/backends?url=" + origin.URL, http.StatusConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(s, tt.method, tt.target, "")
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.want != nil {
+				var backends []BackendInfo
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &backends))
+				assert.Equal(t, tt.want, backends)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	pm, s, _ := newTestServer(t)
+	assert.Equal(t, http.StatusNotFound, do(s, "GET", "/faults", "").Code)
+
+	in := faults.NewInjector()
+	pm.Use(in.Middleware)
+	s.SetFaultInjector(in)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		want       map[string]faults.Fault
+	}{
+		{"Test listing", "GET", "/faults", "", http.StatusOK, map[string]faults.Fault{}},
+		{"Test setting", "PUT", "/faults?route=/api/posts", `{"percentage":100,"status":503}`, http.StatusOK,
+			map[string]faults.Fault{"/api/posts": {Percentage: 100, Status: 503}}},
+		{"Test setting all routes", "PUT", "/faults?route=*", `{"percentage":10,"delay":"1s"}`, http.StatusOK,
+			map[string]faults.Fault{"/api/posts": {Percentage: 100, Status: 503}, "*": {Percentage: 10, Delay: time.Second}}},
+		{"Test missing route", "PUT", "/faults", `{"percentage":100}`, http.StatusBadRequest, nil},
+		{"Test invalid fault", "PUT", "/faults?route=/posts", `{"percentage":200}`, http.StatusBadRequest, nil},
+		{"Test invalid body", "PUT", "/faults?route=/posts", `{`, http.StatusBadRequest, nil},
+		{"Test removal", "DELETE", "/faults?route=*", "", http.StatusOK,
+			map[string]faults.Fault{"/api/posts": {Percentage: 100, Status: 503}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(s, tt.method, tt.target, tt.body)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.want != nil {
+				var got map[string]faults.Fault
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, do(pm, "GET", "/api/posts", "").Code)
+
+	do(s, "DELETE", "/faults", "")
+	assert.Empty(t, in.Faults())
+	assert.Equal(t, http.StatusOK, do(pm, "GET", "/api/posts", "").Code)
+}
+
+func TestStats(t *testing.T) {
+	pm, s, origin := newTestServer(t)
+	pm.EnableStats(time.Minute)
+	do(pm, "GET", "/api/posts", "")
+
+	w := do(s, "GET", "/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats reverseproxy.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, time.Minute, stats.Window)
+	assert.Equal(t, int64(1), stats.Routes["/api/posts"].Requests)
+	assert.Equal(t, int64(1), stats.Upstreams[origin.URL].Requests)
+}
@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/julienschmidt/httprouter"
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// RouteDetail is the JSON representation of a registered route in the route table dump, holding its
+// full configuration. The callbacks are reported by whether they're set.
+type RouteDetail struct {
+	RouteInfo
+	Group              string                     `json:"group,omitempty"`
+	RewriteRegex       string                     `json:"rewriteRegex,omitempty"`
+	RewriteReplacement string                     `json:"rewriteReplacement,omitempty"`
+	Rewrites           []reverseproxy.RewriteRule `json:"rewrites,omitempty"`
+	Prefix             string                     `json:"prefix,omitempty"`
+	UpstreamPrefix     string                     `json:"upstreamPrefix,omitempty"`
+	HostMode           string                     `json:"hostMode"`
+	Host               string                     `json:"host,omitempty"`
+	Buffering          string                     `json:"buffering"`
+	Decompression      bool                       `json:"decompression,omitempty"`
+	HedgeDelay         string                     `json:"hedgeDelay,omitempty"`
+	Priority           int                        `json:"priority,omitempty"`
+	Queue              *reverseproxy.Queue        `json:"queue,omitempty"`
+	Coalesce           bool                       `json:"coalesce,omitempty"`
+	Cache              bool                       `json:"cache,omitempty"`
+	ETag               string                     `json:"etag,omitempty"`
+	Stub               bool                       `json:"stub,omitempty"`
+	ModifyRequest      bool                       `json:"modifyRequest,omitempty"`
+	ModifyResponse     bool                       `json:"modifyResponse,omitempty"`
+}
+
+// RouteTable is the JSON representation of the live route table.
+type RouteTable struct {
+	RouterOptions reverseproxy.RouterOptions `json:"routerOptions"`
+	Frozen        bool                       `json:"frozen"`
+	Routes        []RouteDetail              `json:"routes"`
+}
+
+// EnableDebug registers the debug endpoints, which expose the internals of the process and should
+// only be reachable by operators. It must be called before serving the API.
+//
+//	GET    /debug/pprof/       the pprof profiles, see net/http/pprof
+//	GET    /debug/vars         the expvar variables
+//	GET    /debug/routes       dumps the live route table with the full route configuration
+func (s *Server) EnableDebug() *Server {
+	s.router.GET("/debug/pprof/*name", handlePprof)
+	s.router.POST("/debug/pprof/*name", handlePprof)
+	s.router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	s.router.GET("/debug/routes", s.handleRouteTable)
+	return s
+}
+
+// handlePprof serves the pprof endpoints.
+func handlePprof(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	switch ps.ByName("name") {
+	case "/cmdline":
+		pprof.Cmdline(w, r)
+	case "/profile":
+		pprof.Profile(w, r)
+	case "/symbol":
+		pprof.Symbol(w, r)
+	case "/trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
+
+func (s *Server) handleRouteTable(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	routes := s.mux.Routes()
+	table := RouteTable{
+		RouterOptions: s.mux.RouterOptions(),
+		Frozen:        s.mux.IsFrozen(),
+		Routes:        make([]RouteDetail, 0, len(routes)),
+	}
+	for _, route := range routes {
+		d := RouteDetail{
+			RouteInfo: RouteInfo{
+				Methods:       route.Method,
+				Path:          route.Path,
+				RewritePath:   route.RewritePath,
+				RequestHeader: route.RequestHeader,
+			},
+			Group:              route.Group,
+			RewriteRegex:       route.RewriteRegex,
+			RewriteReplacement: route.RewriteReplacement,
+			Rewrites:           route.Rewrites,
+			Prefix:             route.Prefix,
+			UpstreamPrefix:     route.UpstreamPrefix,
+			HostMode:           hostModes[route.HostMode],
+			Host:               route.Host,
+			Buffering:          bufferingModes[route.Buffering],
+			Decompression:      route.Decompression != nil,
+			Priority:           route.Priority,
+			Queue:              route.Queue,
+			Coalesce:           route.Coalesce,
+			Cache:              route.Cache != nil,
+			ETag:               etagModes[route.ETag],
+			Stub:               route.Stub != nil,
+			ModifyRequest:      route.ModifyRequest != nil,
+			ModifyResponse:     route.ModifyResponse != nil,
+		}
+		if route.HedgeDelay > 0 {
+			d.HedgeDelay = route.HedgeDelay.String()
+		}
+		table.Routes = append(table.Routes, d)
+	}
+	writeJSON(w, http.StatusOK, table)
+}
+
+var (
+	hostModes = map[reverseproxy.HostMode]string{
+		reverseproxy.HostUpstream: "upstream",
+		reverseproxy.HostPreserve: "preserve",
+		reverseproxy.HostCustom:   "custom",
+	}
+	bufferingModes = map[reverseproxy.BufferingMode]string{
+		reverseproxy.BufferingDefault:  "default",
+		reverseproxy.BufferingEnabled:  "enabled",
+		reverseproxy.BufferingDisabled: "disabled",
+	}
+	etagModes = map[reverseproxy.ETagMode]string{
+		reverseproxy.ETagStrong: "strong",
+		reverseproxy.ETagWeak:   "weak",
+	}
+)
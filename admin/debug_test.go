@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableDebug(t *testing.T) {
+	pm, s, _ := newTestServer(t)
+	assert.Equal(t, http.StatusNotFound, do(s, "GET", "/debug/routes", "").Code)
+	pm.HandlePath(reverseproxy.NewRoute("GET", "/users/:id").SetGroup("api").SetBuffering(true).SetETag(reverseproxy.ETagWeak))
+	s.EnableDebug()
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test pprof index", "/debug/pprof/", http.StatusOK, "goroutine"},
+		{"Test pprof profile", "/debug/pprof/goroutine?debug=1", http.StatusOK, "goroutine profile"},
+		{"Test pprof cmdline", "/debug/pprof/cmdline", http.StatusOK, "admin.test"},
+		{"Test expvar", "/debug/vars", http.StatusOK, `"memstats"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(s, "GET", tt.target, "")
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+
+	w := do(s, "GET", "/debug/routes", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var table RouteTable
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &table))
+	assert.True(t, table.RouterOptions.RedirectTrailingSlash)
+	assert.Len(t, table.Routes, 3)
+	assert.Equal(t, RouteDetail{
+		RouteInfo: RouteInfo{Methods: []string{"GET"}, Path: "/users/:id"},
+		Group:     "api",
+		HostMode:  "upstream",
+		Buffering: "enabled",
+		ETag:      "weak",
+	}, table.Routes[2])
+}
@@ -0,0 +1,202 @@
+// Package anomaly provides a lightweight detector of sudden error rate and latency spikes per route.
+// The detector compares each completed observation window against a moving baseline of the previous
+// windows and fires the registered callbacks when a spike is detected, e.g. to trigger an automated
+// rollback of a deployment.
+package anomaly
+
+import (
+	"sync"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// Kind is the kind of a detected anomaly.
+type Kind string
+
+const (
+	// ErrorRate is a spike of the rate of failed requests.
+	ErrorRate Kind = "error_rate"
+	// Latency is a spike of the mean request latency.
+	Latency Kind = "latency"
+)
+
+// Event describes a detected anomaly.
+type Event struct {
+	// Key identifies the observed route.
+	Key  string
+	Kind Kind
+	// Value is the error rate (0-1) or the mean latency in seconds of the window.
+	Value float64
+	// Baseline is the moving average of Value over the previous windows.
+	Baseline float64
+	// Requests is the number of requests observed in the window.
+	Requests int
+	Time     time.Time
+}
+
+// Config holds the detector settings. Zero values are replaced by the defaults.
+type Config struct {
+	// Window is the length of an observation window.
+	Window time.Duration
+	// MinRequests is the minimum number of requests in a window required for an evaluation.
+	MinRequests int
+	// ErrorRateThreshold is the minimum error rate of a window reported as an anomaly.
+	ErrorRateThreshold float64
+	// ErrorRateIncrease is the minimum increase of the error rate over the baseline reported as an anomaly.
+	ErrorRateIncrease float64
+	// LatencyFactor is the factor by which the mean latency must exceed the baseline to be reported.
+	LatencyFactor float64
+	// Smoothing is the weight (0-1) of the latest window in the moving baseline.
+	Smoothing float64
+}
+
+var defaultConfig = Config{
+	Window:             10 * time.Second,
+	MinRequests:        20,
+	ErrorRateThreshold: 0.1,
+	ErrorRateIncrease:  0.05,
+	LatencyFactor:      3,
+	Smoothing:          0.2,
+}
+
+// Detector detects error rate and latency spikes of the observed routes.
+type Detector struct {
+	config Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	routes    map[string]*routeStats
+	callbacks []func(Event)
+}
+
+// routeStats holds the current window and the baseline of a route.
+type routeStats struct {
+	start       time.Time
+	requests    int
+	errors      int
+	latency     time.Duration
+	baselineSet bool
+	baselineErr float64
+	baselineLat float64
+}
+
+// NewDetector creates a new Detector with the passed config.
+func NewDetector(config Config) *Detector {
+	if config.Window <= 0 {
+		config.Window = defaultConfig.Window
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = defaultConfig.MinRequests
+	}
+	if config.ErrorRateThreshold <= 0 {
+		config.ErrorRateThreshold = defaultConfig.ErrorRateThreshold
+	}
+	if config.ErrorRateIncrease <= 0 {
+		config.ErrorRateIncrease = defaultConfig.ErrorRateIncrease
+	}
+	if config.LatencyFactor <= 0 {
+		config.LatencyFactor = defaultConfig.LatencyFactor
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = defaultConfig.Smoothing
+	}
+	return &Detector{
+		config: config,
+		now:    time.Now,
+		routes: make(map[string]*routeStats),
+	}
+}
+
+// OnAnomaly registers a callback fired for each detected anomaly.
+func (d *Detector) OnAnomaly(callback func(Event)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.callbacks = append(d.callbacks, callback)
+}
+
+// Observe records a request of the route identified by key.
+func (d *Detector) Observe(key string, failed bool, latency time.Duration) {
+	now := d.now()
+
+	d.mu.Lock()
+	stats, ok := d.routes[key]
+	if !ok {
+		stats = &routeStats{start: now}
+		d.routes[key] = stats
+	}
+	var events []Event
+	if now.Sub(stats.start) >= d.config.Window {
+		events = d.evaluate(key, stats, now)
+	}
+	stats.requests++
+	stats.latency += latency
+	if failed {
+		stats.errors++
+	}
+	callbacks := d.callbacks
+	d.mu.Unlock()
+
+	for _, event := range events {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	}
+}
+
+// MetricsHook returns a hook for ReverseProxyMux.AddMetricsHook observing the requests of all routes.
+// Responses with a 5xx status code and partial responses are counted as failed.
+func (d *Detector) MetricsHook() reverseproxy.MetricsHook {
+	return func(m reverseproxy.RequestMetrics) {
+		d.Observe(m.Method+" "+m.Route, m.Status >= 500 || m.Err != nil, m.Duration)
+	}
+}
+
+// evaluate closes the current window of the route, updates its baseline and returns the detected anomalies.
+func (d *Detector) evaluate(key string, stats *routeStats, now time.Time) []Event {
+	defer func() {
+		stats.start = now
+		stats.requests = 0
+		stats.errors = 0
+		stats.latency = 0
+	}()
+	if stats.requests < d.config.MinRequests {
+		return nil
+	}
+
+	errRate := float64(stats.errors) / float64(stats.requests)
+	meanLat := stats.latency.Seconds() / float64(stats.requests)
+	if !stats.baselineSet {
+		stats.baselineErr = errRate
+		stats.baselineLat = meanLat
+		stats.baselineSet = true
+		return nil
+	}
+
+	var events []Event
+	if errRate >= d.config.ErrorRateThreshold && errRate-stats.baselineErr >= d.config.ErrorRateIncrease {
+		events = append(events, Event{
+			Key:      key,
+			Kind:     ErrorRate,
+			Value:    errRate,
+			Baseline: stats.baselineErr,
+			Requests: stats.requests,
+			Time:     now,
+		})
+	}
+	if stats.baselineLat > 0 && meanLat >= stats.baselineLat*d.config.LatencyFactor {
+		events = append(events, Event{
+			Key:      key,
+			Kind:     Latency,
+			Value:    meanLat,
+			Baseline: stats.baselineLat,
+			Requests: stats.requests,
+			Time:     now,
+		})
+	}
+
+	alpha := d.config.Smoothing
+	stats.baselineErr = alpha*errRate + (1-alpha)*stats.baselineErr
+	stats.baselineLat = alpha*meanLat + (1-alpha)*stats.baselineLat
+	return events
+}
@@ -0,0 +1,96 @@
+package anomaly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestDetector() (*Detector, *clock, *[]Event) {
+	c := &clock{t: time.Unix(0, 0)}
+	d := NewDetector(Config{Window: time.Second, MinRequests: 10})
+	d.now = c.now
+	events := &[]Event{}
+	d.OnAnomaly(func(e Event) {
+		*events = append(*events, e)
+	})
+	return d, c, events
+}
+
+// observeWindow observes n requests of the key, of which failed requests failed, and moves to the next window.
+func observeWindow(d *Detector, c *clock, key string, n, failed int, latency time.Duration) {
+	for i := 0; i < n; i++ {
+		d.Observe(key, i < failed, latency)
+	}
+	c.t = c.t.Add(time.Second)
+}
+
+func TestErrorRateSpike(t *testing.T) {
+	d, c, events := newTestDetector()
+
+	observeWindow(d, c, "GET /api", 20, 0, 10*time.Millisecond)
+	observeWindow(d, c, "GET /api", 20, 1, 10*time.Millisecond)
+	assert.Empty(t, *events)
+
+	observeWindow(d, c, "GET /api", 20, 10, 10*time.Millisecond)
+	d.Observe("GET /api", false, 10*time.Millisecond)
+	assert.Len(t, *events, 1)
+	assert.Equal(t, "GET /api", (*events)[0].Key)
+	assert.Equal(t, ErrorRate, (*events)[0].Kind)
+	assert.Equal(t, 0.5, (*events)[0].Value)
+	assert.Equal(t, 20, (*events)[0].Requests)
+}
+
+func TestLatencySpike(t *testing.T) {
+	d, c, events := newTestDetector()
+
+	observeWindow(d, c, "GET /api", 20, 0, 10*time.Millisecond)
+	observeWindow(d, c, "GET /api", 20, 0, 12*time.Millisecond)
+	assert.Empty(t, *events)
+
+	observeWindow(d, c, "GET /api", 20, 0, 100*time.Millisecond)
+	d.Observe("GET /api", false, 10*time.Millisecond)
+	assert.Len(t, *events, 1)
+	assert.Equal(t, Latency, (*events)[0].Kind)
+	assert.InDelta(t, 0.1, (*events)[0].Value, 1e-9)
+}
+
+func TestMinRequests(t *testing.T) {
+	d, c, events := newTestDetector()
+
+	observeWindow(d, c, "GET /api", 20, 0, 10*time.Millisecond)
+	observeWindow(d, c, "GET /api", 5, 5, time.Second)
+	d.Observe("GET /api", false, 10*time.Millisecond)
+	assert.Empty(t, *events, "windows with too few requests shouldn't be evaluated")
+}
+
+func TestMetricsHook(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer origin.Close()
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPath("GET", "/api")
+
+	d := NewDetector(Config{})
+	pm.AddMetricsHook(d.MetricsHook())
+	pm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api", nil))
+
+	stats := d.routes["GET /api"]
+	assert.NotNil(t, stats)
+	assert.Equal(t, 1, stats.requests)
+	assert.Equal(t, 1, stats.errors)
+}
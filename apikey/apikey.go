@@ -0,0 +1,275 @@
+// Package apikey issues, revokes and authenticates the API keys of the clients of a gateway. The keys
+// are kept by a Store, in a JSON file or in Redis, which holds only the hashes of their secrets:
+//
+//	ks := apikey.New(apikey.NewFileStore("keys.json"))
+//	token, key, err := ks.Issue(ctx, apikey.Key{Name: "ci", Tenant: "acme"})
+//	pm.UseGroup("api", ks.Middleware)
+//	pm.HandlePath(reverseproxy.NewRoute("GET", "/api/*path").
+//		SetQuota(reverseproxy.Quota{Limit: 10000, Key: apikey.LimitByTenant()}))
+//
+// The middleware attributes the requests to their key with a proxyctx.AuthInfo, whose Subject is the
+// key ID, so the key and its tenant can be logged and used as the key of limiters and quotas.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// DefaultHeader is the request header holding the API key, if not set.
+const DefaultHeader = "X-API-Key"
+
+// Scheme is the scheme of the proxyctx.AuthInfo of the authenticated requests.
+const Scheme = "APIKey"
+
+var (
+	// ErrNotFound is returned when revoking an unknown key.
+	ErrNotFound = errors.New("apikey: not found")
+	// ErrExists is returned when issuing a key with the ID of a stored key.
+	ErrExists = errors.New("apikey: already exists")
+	// ErrInvalid is returned for malformed tokens and tokens not matching a key.
+	ErrInvalid = errors.New("apikey: invalid key")
+	// ErrRevoked is returned for tokens of revoked keys.
+	ErrRevoked = errors.New("apikey: revoked")
+	// ErrExpired is returned for tokens of expired keys.
+	ErrExpired = errors.New("apikey: expired")
+)
+
+// Key is an issued API key. The token of the key is its ID and a random secret separated by a dot;
+// only the hash of the secret is stored.
+type Key struct {
+	// ID identifies the key, generated when issued if empty.
+	ID string `json:"id"`
+	// Name describes the key, e.g. the client or application using it.
+	Name string `json:"name,omitempty"`
+	// Tenant is the tenant the requests of the key are attributed to.
+	Tenant string `json:"tenant,omitempty"`
+	// Labels hold further attributes of the key.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Hash is the hex encoded SHA-256 hash of the secret.
+	Hash string `json:"hash"`
+	// Created is the time the key was issued.
+	Created time.Time `json:"created"`
+	// Expires is the time the key expires, zero if it doesn't expire.
+	Expires time.Time `json:"expires"`
+	// Revoked is the time the key was revoked, zero if it's valid.
+	Revoked time.Time `json:"revoked"`
+}
+
+// Store keeps the issued keys.
+type Store interface {
+	// Get returns the key of the ID, or nil if there is none.
+	Get(ctx context.Context, id string) (*Key, error)
+	// Put stores the key, replacing the key of its ID.
+	Put(ctx context.Context, key *Key) error
+	// List returns all keys.
+	List(ctx context.Context) ([]*Key, error)
+}
+
+// Keystore issues, revokes and authenticates the keys of a store.
+type Keystore struct {
+	// Store keeps the keys.
+	Store Store
+	// Header is the request header holding the token, DefaultHeader if empty. An Authorization header
+	// with the Bearer scheme is accepted too.
+	Header string
+	// KeepHeader forwards the token to the upstream, the header is removed by default.
+	KeepHeader bool
+}
+
+// New creates a keystore of the store.
+func New(store Store) *Keystore {
+	return &Keystore{Store: store}
+}
+
+// Issue stores a new key with the attributes of the passed key and returns its token, which can't be
+// recovered later, and the stored key. ErrExists is returned if a key of the ID is stored, revoked or
+// not, so issuing never replaces the secret of a key.
+func (ks *Keystore) Issue(ctx context.Context, key Key) (string, *Key, error) {
+	if key.ID == "" {
+		id, err := random(8, hex.EncodeToString)
+		if err != nil {
+			return "", nil, err
+		}
+		key.ID = id
+	}
+	if strings.Contains(key.ID, ".") {
+		return "", nil, errors.New("apikey: the key ID contains a dot")
+	}
+	existing, err := ks.Store.Get(ctx, key.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if existing != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrExists, key.ID)
+	}
+	secret, err := random(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	key.Hash, key.Created, key.Revoked = hash(secret), time.Now().UTC(), time.Time{}
+	if err := ks.Store.Put(ctx, &key); err != nil {
+		return "", nil, err
+	}
+	return key.ID + "." + secret, &key, nil
+}
+
+// Revoke revokes the key of the ID, or returns ErrNotFound.
+func (ks *Keystore) Revoke(ctx context.Context, id string) error {
+	key, err := ks.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return ErrNotFound
+	}
+	if key.Revoked.IsZero() {
+		key.Revoked = time.Now().UTC()
+	}
+	return ks.Store.Put(ctx, key)
+}
+
+// Authenticate returns the key of the token, or ErrInvalid, ErrRevoked or ErrExpired.
+func (ks *Keystore) Authenticate(ctx context.Context, token string) (*Key, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalid
+	}
+	key, err := ks.Store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(secret))) != 1 {
+		return nil, ErrInvalid
+	}
+	if !key.Revoked.IsZero() {
+		return nil, ErrRevoked
+	}
+	if !key.Expires.IsZero() && !time.Now().Before(key.Expires) {
+		return nil, ErrExpired
+	}
+	return key, nil
+}
+
+// Middleware returns a handler passing the requests with a valid key to next, with the key stored in
+// the request context, see FromContext and proxyctx.Auth. The requests without a valid key are
+// answered with HTTP 401 unauthorized, the requests failing to reach the store with HTTP 503 service
+// unavailable.
+func (ks *Keystore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace := reverseproxy.TraceFromContext(r.Context())
+		token, bearer := ks.token(r)
+		if token == "" {
+			trace.Add("apikey", "missing")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		key, err := ks.Authenticate(r.Context(), token)
+		switch {
+		case errors.Is(err, ErrInvalid) || errors.Is(err, ErrRevoked) || errors.Is(err, ErrExpired):
+			trace.Add("apikey", err.Error())
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		case err != nil:
+			trace.Add("apikey", "store failed: "+err.Error())
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		trace.Add("apikey", key.ID)
+		if !ks.KeepHeader {
+			if bearer {
+				r.Header.Del("Authorization")
+			} else {
+				r.Header.Del(ks.header())
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithKey(r.Context(), key)))
+	})
+}
+
+// token returns the token of the request and whether it's a bearer token.
+func (ks *Keystore) token(r *http.Request) (string, bool) {
+	if token := r.Header.Get(ks.header()); token != "" {
+		return token, false
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), true
+	}
+	return "", false
+}
+
+// header returns the name of the key header.
+func (ks *Keystore) header() string {
+	if ks.Header != "" {
+		return ks.Header
+	}
+	return DefaultHeader
+}
+
+type keyKey struct{}
+
+// WithKey returns a copy of ctx holding the key, also attributing the request to the key with a
+// proxyctx.AuthInfo.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	ctx = context.WithValue(ctx, keyKey{}, key)
+	return proxyctx.WithAuth(ctx, &proxyctx.AuthInfo{
+		Subject: key.ID,
+		Scheme:  Scheme,
+		Claims:  map[string]any{"name": key.Name, "tenant": key.Tenant},
+	})
+}
+
+// FromContext returns the key of ctx stored by the Middleware, or nil.
+func FromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(keyKey{}).(*Key)
+	return key
+}
+
+// LimitByKey returns a limit key function limiting the requests of each API key.
+func LimitByKey() reverseproxy.LimitKeyFunc {
+	return func(r *http.Request) string {
+		if key := FromContext(r.Context()); key != nil {
+			return key.ID
+		}
+		return ""
+	}
+}
+
+// LimitByTenant returns a limit key function limiting the requests of each tenant, sharing the limit
+// among the keys of a tenant.
+func LimitByTenant() reverseproxy.LimitKeyFunc {
+	return func(r *http.Request) string {
+		if key := FromContext(r.Context()); key != nil {
+			return key.Tenant
+		}
+		return ""
+	}
+}
+
+// random returns n random bytes in the encoding.
+func random(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+// hash returns the hex encoded SHA-256 hash of the secret.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
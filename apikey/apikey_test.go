@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a Store failing all operations.
+type failingStore struct{}
+
+func (failingStore) Get(context.Context, string) (*Key, error) { return nil, errors.New("store down") }
+func (failingStore) Put(context.Context, *Key) error           { return errors.New("store down") }
+func (failingStore) List(context.Context) ([]*Key, error)      { return nil, errors.New("store down") }
+
+func TestKeystore_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	ks := New(NewFileStore(filepath.Join(t.TempDir(), "keys.json")))
+	token, key, err := ks.Issue(ctx, Key{Name: "ci", Tenant: "acme"})
+	assert.NoError(t, err)
+	assert.Len(t, key.ID, 16)
+	assert.NotContains(t, key.Hash, token)
+	revoked, _, _ := ks.Issue(ctx, Key{ID: "revoked"})
+	assert.NoError(t, ks.Revoke(ctx, "revoked"))
+	expired, _, _ := ks.Issue(ctx, Key{ID: "expired", Expires: time.Now().Add(-time.Second)})
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"Test valid key", token, nil},
+		{"Test wrong secret", key.ID + ".wrong", ErrInvalid},
+		{"Test unknown key", "unknown." + token[len(key.ID)+1:], ErrInvalid},
+		{"Test malformed token", key.ID, ErrInvalid},
+		{"Test revoked key", revoked, ErrRevoked},
+		{"Test expired key", expired, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ks.Authenticate(ctx, tt.token)
+			assert.ErrorIs(t, err, tt.want)
+			if tt.want == nil {
+				assert.Equal(t, "acme", got.Tenant)
+			}
+		})
+	}
+
+	assert.ErrorIs(t, ks.Revoke(ctx, "unknown"), ErrNotFound)
+	_, _, err = ks.Issue(ctx, Key{ID: "a.b"})
+	assert.Error(t, err)
+
+	_, _, err = ks.Issue(ctx, Key{ID: "revoked"})
+	assert.ErrorIs(t, err, ErrExists)
+	_, err = ks.Authenticate(ctx, revoked)
+	assert.ErrorIs(t, err, ErrRevoked, "a revoked key shouldn't be reissued")
+}
+
+func TestKeystore_Middleware(t *testing.T) {
+	var forwarded http.Header
+	var auth *proxyctx.AuthInfo
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header
+	}))
+	defer origin.Close()
+
+	ctx := context.Background()
+	ks := New(NewFileStore(filepath.Join(t.TempDir(), "keys.json")))
+	token, key, err := ks.Issue(ctx, Key{Name: "ci", Tenant: "acme"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		ks         *Keystore
+		header     http.Header
+		wantStatus int
+		wantHeader string
+	}{
+		{"Test key header", ks, http.Header{"X-Api-Key": {token}}, http.StatusOK, ""},
+		{"Test bearer token", ks, http.Header{"Authorization": {"Bearer " + token}}, http.StatusOK, ""},
+		{"Test kept header", &Keystore{Store: ks.Store, KeepHeader: true}, http.Header{"X-Api-Key": {token}}, http.StatusOK, token},
+		{"Test missing key", ks, nil, http.StatusUnauthorized, ""},
+		{"Test invalid key", ks, http.Header{"X-Api-Key": {"invalid"}}, http.StatusUnauthorized, ""},
+		{"Test failing store", New(failingStore{}), http.Header{"X-Api-Key": {token}}, http.StatusServiceUnavailable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded, auth = nil, nil
+			pm, err := reverseproxy.New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(reverseproxy.NewRoute("GET", "/api").SetGroup("api"))
+			pm.UseGroup("api", tt.ks.Middleware, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					auth = proxyctx.Auth(r.Context())
+					next.ServeHTTP(w, r)
+				})
+			})
+			req := httptest.NewRequest(http.MethodGet, "/api", nil)
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			rec := httptest.NewRecorder()
+			pm.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantHeader, forwarded.Get("X-Api-Key"))
+				assert.Empty(t, forwarded.Get("Authorization"))
+				assert.Equal(t, &proxyctx.AuthInfo{Subject: key.ID, Scheme: Scheme, Claims: map[string]any{"name": "ci", "tenant": "acme"}}, auth)
+			}
+		})
+	}
+}
+
+func TestLimitByTenant(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+
+	ctx := context.Background()
+	ks := New(NewFileStore(filepath.Join(t.TempDir(), "keys.json")))
+	first, _, _ := ks.Issue(ctx, Key{Tenant: "acme"})
+	second, _, _ := ks.Issue(ctx, Key{Tenant: "acme"})
+	other, _, _ := ks.Issue(ctx, Key{Tenant: "other"})
+
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(reverseproxy.NewRoute("GET", "/api").SetGroup("api").
+		SetQuota(reverseproxy.Quota{Limit: 2, Key: LimitByTenant()}))
+	pm.UseGroup("api", ks.Middleware)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"Test first key", first, http.StatusOK},
+		{"Test second key of the tenant", second, http.StatusOK},
+		{"Test exceeded tenant quota", first, http.StatusTooManyRequests},
+		{"Test other tenant", other, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api", nil)
+			req.Header.Set("X-API-Key", tt.token)
+			rec := httptest.NewRecorder()
+			pm.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store keeping the keys in a JSON file, e.g. of a single gateway instance. The file is
+// read again when it's modified, so keys issued or revoked by another process, e.g. an admin tool, take
+// effect without a restart.
+type FileStore struct {
+	name string
+
+	mu      sync.Mutex
+	keys    map[string]*Key
+	modTime time.Time
+	size    int64
+}
+
+// NewFileStore creates a store of the named file, which is created when the first key is stored.
+func NewFileStore(name string) *FileStore {
+	return &FileStore{name: name}
+}
+
+// Get returns the key of the ID, or nil if there is none.
+func (s *FileStore) Get(_ context.Context, id string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if key, ok := s.keys[id]; ok {
+		k := *key
+		return &k, nil
+	}
+	return nil, nil
+}
+
+// Put stores the key, replacing the key of its ID, and writes the file.
+func (s *FileStore) Put(_ context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	k := *key
+	s.keys[key.ID] = &k
+	return s.save()
+}
+
+// List returns all keys ordered by ID.
+func (s *FileStore) List(_ context.Context) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		k := *key
+		keys = append(keys, &k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// load reads the file if it was modified since it was read. The caller must hold s.mu.
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if s.keys == nil {
+			s.keys = make(map[string]*Key)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.keys != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	data, err := os.ReadFile(s.name)
+	if err != nil {
+		return err
+	}
+	var list []*Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	s.keys = make(map[string]*Key, len(list))
+	for _, key := range list {
+		s.keys[key.ID] = key
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// save replaces the file with the keys atomically, readable by the owner only. The caller must hold s.mu.
+func (s *FileStore) save() error {
+	list := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.name), filepath.Base(s.name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if info, err := os.Stat(s.name); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package apikey
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "keys.json")
+	s := NewFileStore(name)
+
+	key, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+	assert.NoError(t, s.Put(ctx, &Key{ID: "b", Tenant: "acme"}))
+	assert.NoError(t, s.Put(ctx, &Key{ID: "a"}))
+
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// another process sees the keys and its changes are read again
+	other := NewFileStore(name)
+	keys, err := other.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "a", keys[0].ID)
+	assert.NoError(t, other.Put(ctx, &Key{ID: "c"}))
+	key, err = s.Get(ctx, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, "c", key.ID)
+
+	// the returned keys are copies
+	key.Tenant = "changed"
+	key, _ = s.Get(ctx, "c")
+	assert.Empty(t, key.Tenant)
+
+	assert.NoError(t, os.WriteFile(name, []byte("invalid"), 0o600))
+	_, err = NewFileStore(name).List(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DefaultRedisKey is the Redis hash holding the keys, if not set.
+const DefaultRedisKey = "reverseproxy:apikeys"
+
+// RedisClient runs Redis commands, returning the replies like cachestore.Redis.Do, which implements it.
+type RedisClient interface {
+	Do(ctx context.Context, args ...string) (any, error)
+}
+
+// RedisStore is a Store keeping the keys in a Redis hash, shared by the gateway instances using the
+// server:
+//
+//	store := apikey.NewRedisStore(cachestore.NewRedis("localhost:6379"))
+type RedisStore struct {
+	// Client runs the commands.
+	Client RedisClient
+	// Key is the hash holding the keys as JSON by ID, DefaultRedisKey if empty.
+	Key string
+}
+
+// NewRedisStore creates a store of the client.
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+// Get returns the key of the ID, or nil if there is none.
+func (s *RedisStore) Get(ctx context.Context, id string) (*Key, error) {
+	reply, err := s.Client.Do(ctx, "HGET", s.key(), id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("apikey: unexpected reply %v", reply)
+	}
+	key := &Key{}
+	if err := json.Unmarshal(data, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Put stores the key, replacing the key of its ID.
+func (s *RedisStore) Put(ctx context.Context, key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.Do(ctx, "HSET", s.key(), key.ID, string(data))
+	return err
+}
+
+// List returns all keys ordered by ID.
+func (s *RedisStore) List(ctx context.Context) ([]*Key, error) {
+	reply, err := s.Client.Do(ctx, "HVALS", s.key())
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]any)
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("apikey: unexpected reply %v", reply)
+	}
+	keys := make([]*Key, 0, len(values))
+	for _, v := range values {
+		data, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("apikey: unexpected reply %v", v)
+		}
+		key := &Key{}
+		if err := json.Unmarshal(data, key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// key returns the name of the hash.
+func (s *RedisStore) key() string {
+	if s.Key != "" {
+		return s.Key
+	}
+	return DefaultRedisKey
+}
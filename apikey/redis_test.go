@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a RedisClient of the hash commands, replying like cachestore.Redis.
+type fakeRedis map[string]map[string]string
+
+func (f fakeRedis) Do(_ context.Context, args ...string) (any, error) {
+	switch args[0] {
+	case "HSET":
+		if f[args[1]] == nil {
+			f[args[1]] = make(map[string]string)
+		}
+		f[args[1]][args[2]] = args[3]
+		return int64(1), nil
+	case "HGET":
+		if v, ok := f[args[1]][args[2]]; ok {
+			return []byte(v), nil
+		}
+		return nil, nil
+	case "HVALS":
+		values := []any{}
+		for _, v := range f[args[1]] {
+			values = append(values, []byte(v))
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	client := fakeRedis{}
+	ks := New(NewRedisStore(client))
+
+	token, key, err := ks.Issue(ctx, Key{ID: "b", Tenant: "acme"})
+	assert.NoError(t, err)
+	assert.Contains(t, client[DefaultRedisKey], "b")
+	_, _, err = ks.Issue(ctx, Key{ID: "a"})
+	assert.NoError(t, err)
+
+	got, err := ks.Authenticate(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Hash, got.Hash)
+	assert.NoError(t, ks.Revoke(ctx, "b"))
+	_, err = ks.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrRevoked)
+
+	keys, err := ks.Store.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "a", keys[0].ID)
+
+	missing, err := NewRedisStore(client).Get(ctx, "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	other := &RedisStore{Client: client, Key: "other"}
+	keys, err = other.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
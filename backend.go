@@ -0,0 +1,349 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/health"
+)
+
+var (
+	// ErrLastBackend is returned when removing the last backend of the pool.
+	ErrLastBackend = errors.New("cannot remove the last backend")
+	// ErrBackendNotFound is returned when a backend isn't in the pool.
+	ErrBackendNotFound = errors.New("backend not found")
+)
+
+// Backend is an origin server of the backend pool. Its metadata is set when it's added to the pool
+// and immutable afterwards.
+type Backend struct {
+	url       *url.URL
+	weight    int
+	zone      string
+	labels    map[string]string
+	transport http.RoundTripper
+	health    *health.HealthCheck
+
+	director  func(*http.Request)
+	closeIdle func()
+	inflight  atomic.Int64
+	draining  atomic.Bool
+
+	mu     sync.Mutex
+	ewma   float64
+	ewmaAt time.Time
+}
+
+// BackendOption configures a backend added to the pool.
+type BackendOption func(*Backend)
+
+// BackendWeight sets the relative share of the requests the balancers send to the backend. The
+// default weight is 1.
+func BackendWeight(weight int) BackendOption {
+	return func(b *Backend) {
+		if weight > 0 {
+			b.weight = weight
+		}
+	}
+}
+
+// BackendZone sets the zone the backend is located in, e.g. an availability zone.
+func BackendZone(zone string) BackendOption {
+	return func(b *Backend) {
+		b.zone = zone
+	}
+}
+
+// BackendLabels sets arbitrary labels of the backend, e.g. for custom balancers or metrics.
+func BackendLabels(labels map[string]string) BackendOption {
+	return func(b *Backend) {
+		b.labels = maps.Clone(labels)
+	}
+}
+
+// BackendTransport sets the transport of the requests to the backend, overriding the Transport of the mux.
+func BackendTransport(transport http.RoundTripper) BackendOption {
+	return func(b *Backend) {
+		b.transport = transport
+	}
+}
+
+// newBackend creates a backend of the origin URL.
+func newBackend(u *url.URL, opts ...BackendOption) *Backend {
+	b := &Backend{
+		url:    u,
+		weight: 1,
+	}
+	if u != nil {
+		b.director = httputil.NewSingleHostReverseProxy(u).Director
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// URL returns the URL of the backend.
+func (b *Backend) URL() *url.URL {
+	u := *b.url
+	return &u
+}
+
+// Weight returns the relative share of the requests sent to the backend.
+func (b *Backend) Weight() int {
+	return b.weight
+}
+
+// Zone returns the zone the backend is located in.
+func (b *Backend) Zone() string {
+	return b.zone
+}
+
+// Labels returns the labels of the backend.
+func (b *Backend) Labels() map[string]string {
+	return maps.Clone(b.labels)
+}
+
+// Label returns the value of the labels of the backend for the key.
+func (b *Backend) Label(key string) string {
+	return b.labels[key]
+}
+
+// Transport returns the transport of the backend, or nil if it uses the Transport of the mux.
+func (b *Backend) Transport() http.RoundTripper {
+	return b.transport
+}
+
+// IsAvailable returns whether the backend was successfully connected at the last health check time.
+func (b *Backend) IsAvailable() bool {
+	return b.health == nil || b.health.IsAvailable()
+}
+
+// HealthCheck returns the health check of the backend.
+func (b *Backend) HealthCheck() *health.HealthCheck {
+	return b.health
+}
+
+// InFlight returns the number of requests being proxied to the backend.
+func (b *Backend) InFlight() int64 {
+	return b.inflight.Load()
+}
+
+// Drain stops selecting the backend for new requests and waits until its in-flight requests completed
+// or the context is done, then closes the idle connections of its transport. The context error is
+// returned if the in-flight requests didn't complete in time.
+func (b *Backend) Drain(ctx context.Context) error {
+	b.draining.Store(true)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	var err error
+	for err == nil && b.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if b.closeIdle != nil {
+		b.closeIdle()
+	}
+	return err
+}
+
+// Undrain resumes selecting the backend for new requests.
+func (b *Backend) Undrain() {
+	b.draining.Store(false)
+}
+
+// IsDraining returns whether the backend is drained.
+func (b *Backend) IsDraining() bool {
+	return b.draining.Load()
+}
+
+// Latency returns the peak-sensitive moving average of the response latency of the backend, or zero
+// if no response has been observed yet.
+func (b *Backend) Latency() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration(b.ewma)
+}
+
+// observe updates the latency average with a response latency. A latency above the average replaces
+// it, otherwise the average decays towards it with the passed decay time.
+func (b *Backend) observe(latency, decay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch {
+	case b.ewmaAt.IsZero() || float64(latency) > b.ewma:
+		b.ewma = float64(latency)
+	default:
+		w := math.Exp(-float64(now.Sub(b.ewmaAt)) / float64(decay))
+		b.ewma = b.ewma*w + float64(latency)*(1-w)
+	}
+	b.ewmaAt = now
+}
+
+// Backends returns the backends of the pool, in the order they were added. The first backend is the
+// origin passed to New, unless it was removed with RemoveBackend.
+func (pm *ReverseProxyMux) Backends() []*Backend {
+	return *pm.backends.Load()
+}
+
+// AddBackend adds an origin server to the backend pool. The requests are distributed among the
+// available backends by the Balancer.
+func (pm *ReverseProxyMux) AddBackend(remote string, opts ...BackendOption) (*Backend, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, err
+	}
+	b := pm.newBackend(u, opts...)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	current := pm.Backends()
+	backends := make([]*Backend, 0, len(current)+1)
+	backends = append(append(backends, current...), b)
+	pm.backends.Store(&backends)
+	return b, nil
+}
+
+// newBackend creates a backend of the pool, starting its health check.
+func (pm *ReverseProxyMux) newBackend(u *url.URL, opts ...BackendOption) *Backend {
+	b := newBackend(u, opts...)
+	pm.healthMu.Lock()
+	b.health = health.NewHealthCheck(u, pm.healthOpts...)
+	if pm.healthCheck != nil {
+		b.health.SetCheckFunc(pm.healthCheck, pm.healthPeriod)
+	}
+	pm.healthMu.Unlock()
+	b.closeIdle = func() {
+		transport := b.transport
+		if transport == nil {
+			transport = pm.transport()
+		}
+		if t, ok := transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+	}
+	return b
+}
+
+// RemoveBackend removes the backend from the pool and drains it, see Backend.Drain, then stops its
+// health check. The origin passed to New can be removed too, the next backend becoming the Remote. It
+// returns ErrLastBackend if the backend is the last one of the pool, ErrBackendNotFound
+// if it isn't in the pool, or the context error if its in-flight requests didn't complete in time.
+func (pm *ReverseProxyMux) RemoveBackend(ctx context.Context, b *Backend) error {
+	pm.mu.Lock()
+	current := pm.Backends()
+	i := slices.Index(current, b)
+	switch {
+	case i < 0:
+		pm.mu.Unlock()
+		return ErrBackendNotFound
+	case len(current) == 1:
+		pm.mu.Unlock()
+		return ErrLastBackend
+	}
+	backends := slices.Delete(slices.Clone(current), i, i+1)
+	pm.backends.Store(&backends)
+	pm.mu.Unlock()
+	if b.health != nil {
+		defer b.health.Stop()
+	}
+	return b.Drain(ctx)
+}
+
+// Backend returns the backend of the pool with the passed URL, or nil.
+func (pm *ReverseProxyMux) Backend(remote string) *Backend {
+	for _, b := range pm.Backends() {
+		if b.url.String() == remote {
+			return b
+		}
+	}
+	return nil
+}
+
+// transport returns the Transport of the mux or the default transport.
+func (pm *ReverseProxyMux) transport() http.RoundTripper {
+	if t := pm.current().Transport; t != nil {
+		return t
+	}
+	return http.DefaultTransport
+}
+
+// transportOf returns the transport of the requests to the backend.
+func (pm *ReverseProxyMux) transportOf(b *Backend) http.RoundTripper {
+	if b.transport != nil {
+		return b.transport
+	}
+	return pm.transport()
+}
+
+// roundTrip sends the outbound request with the transport of the selected backend, deduplicating it,
+// serving it from the cache, coalescing and hedging it if enabled on the route.
+func (pm *ReverseProxyMux) roundTrip(r *http.Request) (*http.Response, error) {
+	x := exchangeFrom(r.Context())
+	if x == nil {
+		return pm.transport().RoundTrip(r)
+	}
+	if d := x.handler.dedup; d != nil && r.Header.Get(IdempotencyKeyHeader) != "" {
+		return d.roundTrip(r, x, pm.current().MaxBufferedResponse, pm.coalesce)
+	}
+	if c := x.handler.cache; c != nil && cacheable(r) {
+		return c.roundTrip(r, x, pm.current().MaxBufferedResponse, pm.coalesce)
+	}
+	return pm.coalesce(r, x)
+}
+
+// coalesce sends the outbound request of the exchange, coalescing it if enabled on the route.
+func (pm *ReverseProxyMux) coalesce(r *http.Request, x *exchange) (*http.Response, error) {
+	if x.handler.flights != nil && coalescable(r) {
+		return x.handler.flights.do(r, x, pm.current().MaxBufferedResponse, func(r *http.Request) (*http.Response, error) {
+			return pm.send(r, x)
+		})
+	}
+	return pm.send(r, x)
+}
+
+// send sends the outbound request of the exchange, hedging it if enabled on the route.
+func (pm *ReverseProxyMux) send(r *http.Request, x *exchange) (*http.Response, error) {
+	if delay := x.handler.route.HedgeDelay; delay > 0 && hedgeable(r) && !x.selected {
+		return pm.hedge(r, x, delay)
+	}
+	r, ct := withConnTrace(r)
+	res, err := pm.sendTo(x.backend, r, x)
+	x.setConnStats(r, ct)
+	return res, err
+}
+
+// sendTo sends the outbound request to the backend with the transport of the route or the backend,
+// signing it with the signer of the route.
+func (pm *ReverseProxyMux) sendTo(b *Backend, r *http.Request, x *exchange) (*http.Response, error) {
+	if s := x.handler.route.Signer; s != nil {
+		if err := s.SignRequest(r); err != nil {
+			return nil, &ProxyError{Kind: ErrRewriteFailed, Backend: b.URL(), Err: fmt.Errorf("sign request: %w", err)}
+		}
+	}
+	if t := x.handler.transport; t != nil {
+		return t.RoundTrip(r)
+	}
+	return pm.transportOf(b).RoundTrip(r)
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r).
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,135 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendOptions(t *testing.T) {
+	labels := map[string]string{"version": "v2"}
+	tests := []struct {
+		name       string
+		opts       []BackendOption
+		wantWeight int
+		wantZone   string
+		wantLabels map[string]string
+	}{
+		{"Test defaults", nil, 1, "", nil},
+		{"Test weight", []BackendOption{BackendWeight(3)}, 3, "", nil},
+		{"Test invalid weight", []BackendOption{BackendWeight(0)}, 1, "", nil},
+		{"Test zone", []BackendOption{BackendZone("eu-west-1a")}, 1, "eu-west-1a", nil},
+		{"Test labels", []BackendOption{BackendLabels(labels)}, 1, "", labels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackend(&url.URL{Scheme: "http", Host: "backend"}, tt.opts...)
+			assert.Equal(t, tt.wantWeight, b.Weight())
+			assert.Equal(t, tt.wantZone, b.Zone())
+			assert.Equal(t, tt.wantLabels, b.Labels())
+		})
+	}
+
+	b := newBackend(&url.URL{Scheme: "http", Host: "backend"}, BackendLabels(labels))
+	labels["version"] = "v3"
+	assert.Equal(t, "v2", b.Label("version"))
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	a := newBackend(nil, BackendWeight(5))
+	b := newBackend(nil)
+	c := newBackend(nil)
+	backends := []*Backend{a, b, c}
+	balancer := RoundRobin()
+
+	var got []*Backend
+	for i := 0; i < 7; i++ {
+		got = append(got, balancer.Select(nil, backends))
+	}
+	assert.Equal(t, []*Backend{a, a, b, a, c, a, a}, got)
+}
+
+func TestWeightedLeastConnections(t *testing.T) {
+	a := newBackend(nil, BackendWeight(3))
+	b := newBackend(nil)
+	a.inflight.Add(1)
+	assert.Same(t, a, LeastConnections().Select(nil, []*Backend{a, b}))
+	a.inflight.Add(2)
+	assert.Same(t, b, LeastConnections().Select(nil, []*Backend{a, b}))
+}
+
+func TestBackendTransport(t *testing.T) {
+	pm := newPoolTestMux(t, "a")
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("transport " + r.Host)),
+			Request:    r,
+		}, nil
+	})
+	_, err := pm.AddBackend("http://backend.test", BackendTransport(transport))
+	assert.NoError(t, err)
+	pm.SetHealthCheckFunc(func(*url.URL) bool {
+		return true
+	}, time.Hour)
+
+	assert.Equal(t, "a", serve(pm, "GET", "/").Body.String())
+	assert.Equal(t, "transport backend.test", serve(pm, "GET", "/").Body.String())
+}
+
+func TestRoute_SetTransport(t *testing.T) {
+	pm := newPoolTestMux(t, "a")
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("route transport " + r.URL.Path)),
+			Request:    r,
+		}, nil
+	})
+	pm.HandlePath(NewRoute("GET", "/grpc/*path").SetTransport(transport))
+
+	assert.Equal(t, "a", serve(pm, "GET", "/").Body.String())
+	assert.Equal(t, "route transport /grpc/call", serve(pm, "GET", "/grpc/call").Body.String())
+}
+
+func TestSelectBackendHealth(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	down := pm.Backends()[0].url.Host
+	pm.SetHealthCheckFunc(func(addr *url.URL) bool {
+		return addr.Host != down
+	}, time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", serve(pm, "GET", "/").Body.String())
+	}
+
+	// all backends down, the requests are still forwarded
+	pm.SetHealthCheckFunc(func(addr *url.URL) bool {
+		return false
+	}, time.Hour)
+	assert.False(t, pm.IsAvailable())
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/").Code)
+}
+
+func TestSetHealthCheckOptions(t *testing.T) {
+	pm := newPoolTestMux(t, "a")
+	pm.SetHealthCheckOptions(health.FailureThreshold(2))
+	b, err := pm.AddBackend("http://127.0.0.1:1")
+	assert.NoError(t, err)
+
+	down := func(*url.URL) bool {
+		return false
+	}
+	pm.SetHealthCheckFunc(down, time.Hour)
+	assert.True(t, pm.Backends()[0].IsAvailable())
+	assert.False(t, b.IsAvailable())
+	pm.SetHealthCheckFunc(down, time.Hour)
+	assert.False(t, pm.Backends()[0].IsAvailable())
+}
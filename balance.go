@@ -0,0 +1,201 @@
+package reverseproxy
+
+import (
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer selects the backend serving a request from the pool. Implementations must be safe for
+// concurrent use.
+type Balancer interface {
+	Select(r *http.Request, backends []*Backend) *Backend
+}
+
+// BalancerFunc adapts a function to the Balancer interface.
+type BalancerFunc func(r *http.Request, backends []*Backend) *Backend
+
+// Select calls f(r, backends).
+func (f BalancerFunc) Select(r *http.Request, backends []*Backend) *Backend {
+	return f(r, backends)
+}
+
+// RoundRobin returns a balancer selecting the backends in turn. It's the default balancer. Backends
+// with different weights are interleaved smoothly, selecting each backend in proportion to its weight.
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+// roundRobin is the round-robin balancer.
+type roundRobin struct {
+	next atomic.Uint64
+
+	mu      sync.Mutex
+	current map[*Backend]int
+}
+
+// Select selects the next backend.
+func (rr *roundRobin) Select(_ *http.Request, backends []*Backend) *Backend {
+	if !weighted(backends) {
+		return backends[(rr.next.Add(1)-1)%uint64(len(backends))]
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if len(rr.current) > len(backends) {
+		// forget removed backends
+		rr.current = nil
+	}
+	if rr.current == nil {
+		rr.current = make(map[*Backend]int, len(backends))
+	}
+	var best *Backend
+	total := 0
+	for _, b := range backends {
+		rr.current[b] += b.weight
+		total += b.weight
+		if best == nil || rr.current[b] > rr.current[best] {
+			best = b
+		}
+	}
+	rr.current[best] -= total
+	return best
+}
+
+// weighted reports whether the backends have different weights.
+func weighted(backends []*Backend) bool {
+	for _, b := range backends[1:] {
+		if b.weight != backends[0].weight {
+			return true
+		}
+	}
+	return false
+}
+
+// LeastConnections returns a balancer selecting the backend with the fewest in-flight requests
+// relative to its weight. Ties are broken randomly.
+func LeastConnections() Balancer {
+	return BalancerFunc(func(_ *http.Request, backends []*Backend) *Backend {
+		return selectMin(backends, func(b *Backend) float64 {
+			return float64(b.InFlight()+1) / float64(b.weight)
+		})
+	})
+}
+
+// DefaultEWMADecay is the decay time of the latency average of the PeakEWMA balancer.
+const DefaultEWMADecay = 10 * time.Second
+
+// PeakEWMA returns a latency-aware balancer selecting the backend with the lowest product of its
+// peak-sensitive latency average and in-flight requests, relative to its weight. Latency spikes are picked up immediately and
+// decay with the decay time, DefaultEWMADecay if zero. Backends without observed responses are
+// preferred, so new backends get probed.
+func PeakEWMA(decay time.Duration) Balancer {
+	if decay <= 0 {
+		decay = DefaultEWMADecay
+	}
+	return &peakEWMA{decay: decay}
+}
+
+// peakEWMA is the peak-EWMA balancer.
+type peakEWMA struct {
+	decay time.Duration
+}
+
+// Select selects the backend with the lowest latency cost.
+func (p *peakEWMA) Select(_ *http.Request, backends []*Backend) *Backend {
+	return selectMin(backends, func(b *Backend) float64 {
+		return float64(b.Latency()) * float64(b.InFlight()+1) / float64(b.weight)
+	})
+}
+
+// latencyObserver is implemented by balancers observing the response latency of the backends.
+type latencyObserver interface {
+	observe(b *Backend, latency time.Duration)
+}
+
+// observe updates the latency average of the backend.
+func (p *peakEWMA) observe(b *Backend, latency time.Duration) {
+	b.observe(latency, p.decay)
+}
+
+// selectMin returns the backend with the lowest cost, starting at a random backend to break ties.
+func selectMin(backends []*Backend, cost func(*Backend) float64) *Backend {
+	offset := rand.Intn(len(backends))
+	best, bestCost := backends[offset], cost(backends[offset])
+	for i := 1; i < len(backends); i++ {
+		b := backends[(offset+i)%len(backends)]
+		if c := cost(b); c < bestCost {
+			best, bestCost = b, c
+		}
+	}
+	return best
+}
+
+// selectBackend selects the backend for the request with the Balancer among the backends which aren't
+// drained. Backends failing their health check are skipped unless no backend is available. It returns
+// nil if all backends are drained.
+func (pm *ReverseProxyMux) selectBackend(r *http.Request) *Backend {
+	return pm.selectBackendExcept(r, nil)
+}
+
+// selectBackendExcept is like selectBackend, but never selects the passed backend.
+func (pm *ReverseProxyMux) selectBackendExcept(r *http.Request, except *Backend) *Backend {
+	backends := pm.Backends()
+	excluded := func(b *Backend) bool {
+		return b == except || b.IsDraining()
+	}
+	if slices.ContainsFunc(backends, excluded) {
+		backends = slices.DeleteFunc(slices.Clone(backends), excluded)
+	}
+	if slices.ContainsFunc(backends, isUnavailable) && slices.ContainsFunc(backends, (*Backend).IsAvailable) {
+		backends = slices.DeleteFunc(slices.Clone(backends), isUnavailable)
+	}
+	switch len(backends) {
+	case 0:
+		return nil
+	case 1:
+		return backends[0]
+	}
+	balancer := pm.current().Balancer
+	if balancer == nil {
+		balancer = pm.roundRobin
+	}
+	if b := balancer.Select(r, backends); b != nil {
+		return b
+	}
+	return backends[0]
+}
+
+// isUnavailable reports whether the backend failed its health check.
+func isUnavailable(b *Backend) bool {
+	return !b.IsAvailable()
+}
+
+// direct directs the outbound request to the selected backend.
+func (pm *ReverseProxyMux) direct(r *http.Request) {
+	if x := exchangeFrom(r.Context()); x != nil {
+		x.target = *r.URL
+		x.backend.director(r)
+		if x.trailer != nil {
+			// the clone of the outbound request copied the trailer before the inbound body was read
+			r.Trailer = x.trailer
+		}
+		if d := x.handler.route.Director; d != nil {
+			d(r)
+		}
+		return
+	}
+	pm.Backends()[0].director(r)
+}
+
+// observeLatency passes the latency of the upstream response to the Balancer, if it observes latencies.
+func (pm *ReverseProxyMux) observeLatency(x *exchange) {
+	if x == nil || x.start.IsZero() {
+		return
+	}
+	if o, ok := pm.current().Balancer.(latencyObserver); ok {
+		o.observe(x.backend, time.Since(x.start))
+	}
+}
@@ -0,0 +1,171 @@
+package reverseproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPoolTestMux(t *testing.T, names ...string) *ReverseProxyMux {
+	var pm *ReverseProxyMux
+	for _, name := range names {
+		name := name
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+		t.Cleanup(origin.Close)
+		if pm == nil {
+			var err error
+			pm, err = New(origin.URL)
+			assert.NoError(t, err)
+			continue
+		}
+		_, err := pm.AddBackend(origin.URL)
+		assert.NoError(t, err)
+	}
+	pm.PassPath("GET", "/")
+	return pm
+}
+
+func TestRoundRobin(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b", "c")
+	assert.Len(t, pm.Backends(), 3)
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, serve(pm, "GET", "/").Body.String())
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, got)
+}
+
+func TestLeastConnections(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	pm.Balancer = LeastConnections()
+
+	backends := pm.Backends()
+	backends[0].inflight.Add(2)
+	backends[1].inflight.Add(1)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", serve(pm, "GET", "/").Body.String())
+	}
+	assert.Equal(t, int64(1), backends[1].InFlight())
+}
+
+func TestLeastConnections_Pending(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	pm.Balancer = LeastConnections()
+	entered, release := make(chan struct{}), make(chan struct{})
+	var first atomic.Bool
+	pm.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if first.CompareAndSwap(false, true) {
+				close(entered)
+				<-release
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	done := make(chan string)
+	go func() {
+		done <- serve(pm, "GET", "/").Body.String()
+	}()
+	<-entered
+
+	// the pending request counts for its backend from its selection on
+	second := serve(pm, "GET", "/").Body.String()
+	close(release)
+	assert.NotEqual(t, second, <-done)
+	for _, b := range pm.Backends() {
+		assert.Zero(t, b.InFlight())
+	}
+}
+
+func TestPeakEWMA(t *testing.T) {
+	balancer := PeakEWMA(time.Second).(*peakEWMA)
+	slow, fast := newBackend(nil), newBackend(nil)
+	backends := []*Backend{slow, fast}
+
+	balancer.observe(slow, 100*time.Millisecond)
+	balancer.observe(fast, 10*time.Millisecond)
+	assert.Equal(t, fast, balancer.Select(nil, backends))
+
+	fast.inflight.Add(20)
+	assert.Equal(t, slow, balancer.Select(nil, backends), "the in-flight requests should weigh the latency")
+	fast.inflight.Add(-20)
+
+	balancer.observe(fast, 500*time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, fast.Latency(), "latency peaks should be picked up immediately")
+	assert.Equal(t, slow, balancer.Select(nil, backends))
+
+	fresh := newBackend(nil)
+	assert.Equal(t, fresh, balancer.Select(nil, append(backends, fresh)), "unobserved backends should be probed")
+}
+
+func TestPeakEWMAObservesResponses(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	pm.Balancer = PeakEWMA(0)
+	for i := 0; i < 4; i++ {
+		serve(pm, "GET", "/")
+	}
+	for _, b := range pm.Backends() {
+		assert.NotZero(t, b.Latency())
+	}
+}
+
+func TestBackendDrain(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	a, b := pm.Backends()[0], pm.Backends()[1]
+
+	assert.NoError(t, a.Drain(context.Background()))
+	assert.True(t, a.IsDraining())
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", serve(pm, "GET", "/").Body.String())
+	}
+
+	b.inflight.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Drain(ctx), context.DeadlineExceeded)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(pm, "GET", "/").Code, "all backends are drained")
+	b.inflight.Add(-1)
+
+	a.Undrain()
+	assert.Equal(t, "a", serve(pm, "GET", "/").Body.String())
+}
+
+func TestRemoveBackend(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b")
+	a, b := pm.Backends()[0], pm.Backends()[1]
+
+	b.inflight.Add(1)
+	done := make(chan error)
+	go func() {
+		done <- pm.RemoveBackend(context.Background(), b)
+	}()
+	assert.Eventually(t, func() bool { return len(pm.Backends()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, "a", serve(pm, "GET", "/").Body.String())
+	select {
+	case <-done:
+		t.Fatal("the removal should wait for the in-flight requests")
+	case <-time.After(30 * time.Millisecond):
+	}
+	b.inflight.Add(-1)
+	assert.NoError(t, <-done)
+
+	assert.ErrorIs(t, pm.RemoveBackend(context.Background(), b), ErrBackendNotFound)
+	assert.ErrorIs(t, pm.RemoveBackend(context.Background(), a), ErrLastBackend)
+	assert.Equal(t, a, pm.Backend(a.URL().String()))
+
+	// the origin passed to New can be removed, the next backend becoming the remote
+	c, err := pm.AddBackend(b.URL().String())
+	assert.NoError(t, err)
+	assert.NoError(t, pm.RemoveBackend(context.Background(), a))
+	assert.Equal(t, c.URL(), pm.Remote())
+}
@@ -0,0 +1,101 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// BufferingMode controls how the upstream responses of a route are passed to the client.
+type BufferingMode int
+
+const (
+	// BufferingDefault streams the responses, flushing them periodically like httputil.ReverseProxy.
+	BufferingDefault BufferingMode = iota
+	// BufferingEnabled reads the full upstream response before the response modifiers run, so they
+	// can inspect and replace the body and the response has a known Content-Length.
+	BufferingEnabled
+	// BufferingDisabled streams the responses, flushing every write to the client immediately.
+	BufferingDisabled
+)
+
+// ErrResponseTooLarge is returned when a buffered upstream response exceeds the MaxBufferedResponse size.
+var ErrResponseTooLarge error = &kindError{"upstream response too large to buffer", ErrBodyTooLarge}
+
+// bufferResponse reads the body of the response into memory.
+func (pm *ReverseProxyMux) bufferResponse(res *http.Response) error {
+	if res.Body == nil {
+		return nil
+	}
+	var body io.Reader = res.Body
+	limit := pm.current().MaxBufferedResponse
+	if limit > 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+	b, err := io.ReadAll(body)
+	_ = res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && int64(len(b)) > limit {
+		return ErrResponseTooLarge
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	if len(res.Trailer) > 0 {
+		// the response stays chunked, so the trailers are forwarded
+		res.ContentLength = -1
+		res.Header.Del("Content-Length")
+		return nil
+	}
+	res.ContentLength = int64(len(b))
+	res.TransferEncoding = nil
+	res.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// readBody reads the body of the response into memory within the limit, zero meaning unlimited. If the
+// body exceeds the limit or reading it fails, it returns false and the body still reads from the start.
+func readBody(res *http.Response, limit int64) ([]byte, bool) {
+	var body io.Reader = res.Body
+	if limit > 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil || limit > 0 && int64(len(b)) > limit {
+		res.Body = &struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), res.Body), res.Body}
+		return nil, false
+	}
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	return b, true
+}
+
+// flushWriter is a http.ResponseWriter flushing every write to the client.
+type flushWriter struct {
+	http.ResponseWriter
+}
+
+// Write writes the data to the wrapped writer and flushes it.
+func (w *flushWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// Flush flushes the buffered data of the wrapped writer, if supported.
+func (w *flushWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *flushWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,51 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffering(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "chunk 1, ")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "chunk 2")
+	}))
+	defer origin.Close()
+
+	var lengths []int64
+	record := func(res *http.Response) error {
+		lengths = append(lengths, res.ContentLength)
+		return nil
+	}
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.MaxBufferedResponse = 10
+	pm.HandlePath(NewRoute("GET", "/buffered").SetBuffering(true).SetModifyResponse(record))
+	pm.HandlePath(NewRoute("GET", "/streamed").SetBuffering(false).SetModifyResponse(record))
+
+	w := serve(pm, "GET", "/streamed")
+	assert.Equal(t, "chunk 1, chunk 2", w.Body.String())
+	assert.True(t, w.Flushed)
+	assert.Equal(t, []int64{-1}, lengths)
+
+	pm.MaxBufferedResponse = 0
+	w = serve(pm, "GET", "/buffered")
+	assert.Equal(t, "chunk 1, chunk 2", w.Body.String())
+	assert.Equal(t, "16", w.Header().Get("Content-Length"))
+	assert.Equal(t, []int64{-1, 16}, lengths)
+
+	pm.MaxBufferedResponse = 10
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		assert.ErrorIs(t, err, ErrResponseTooLarge)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+	w = serve(pm, "GET", "/buffered")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), ErrResponseTooLarge.Error()))
+}
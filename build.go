@@ -0,0 +1,160 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ErrFrozen is returned when changing the configuration of a frozen mux.
+var ErrFrozen = errors.New("reverse proxy mux is frozen")
+
+// settings is a snapshot of the exported configuration fields of the mux.
+type settings struct {
+	Transport               http.RoundTripper
+	RequestHeader           http.Header
+	ModifyRequest           RequestModifier
+	ModifyResponse          ResponseModifier
+	ErrorHandler            HttpErrorHandler
+	PanicHandler            PanicHandler
+	ErrorLog                *log.Logger
+	NotFoundHandler         http.Handler
+	MethodNotAllowedHandler http.Handler
+	MaintenanceHandler      http.Handler
+	MaxBufferedResponse     int64
+	MaxBufferedRequest      int64
+	UpstreamTimeout         time.Duration
+	PartialResponse         PartialResponsePolicy
+	Balancer                Balancer
+	LoadShedding            *LoadShedding
+	SlowClient              *SlowClient
+	ResponseHeaderPolicy    *HeaderPolicy
+	Via                     string
+	StatusRewrites          []StatusRewrite
+	Connect                 *ConnectTunnel
+	BaseContext             context.Context
+	RequestContext          func(ctx context.Context, r *http.Request) context.Context
+}
+
+// Build snapshots the exported configuration fields of the mux, e.g. the ErrorHandler and the
+// ModifyResponse modifier, which serve the requests from then on. Changing the fields afterwards has
+// no effect until Build is called again, so they can be changed safely while requests are served.
+// Until Build is called, the fields are read by each request, so they must not be changed while the
+// proxy is serving. ErrFrozen is returned if the mux is frozen.
+func (pm *ReverseProxyMux) Build() error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		return ErrFrozen
+	}
+	pm.settings.Store(pm.snapshot())
+	return nil
+}
+
+// Freeze builds the mux, see Build, and rejects further configuration changes: registering routes,
+// middleware and static mounts fails with ErrFrozen, or panics for the methods without an error
+// result. The backend pool, maintenance mode and draining are runtime state and can still change.
+func (pm *ReverseProxyMux) Freeze() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if !pm.frozen {
+		pm.settings.Store(pm.snapshot())
+		pm.frozen = true
+	}
+}
+
+// IsFrozen returns whether the mux is frozen.
+func (pm *ReverseProxyMux) IsFrozen() bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.frozen
+}
+
+// snapshot copies the exported configuration fields.
+func (pm *ReverseProxyMux) snapshot() *settings {
+	s := pm.fields()
+	s.RequestHeader = pm.RequestHeader.Clone()
+	if pm.LoadShedding != nil {
+		ls := *pm.LoadShedding
+		s.LoadShedding = &ls
+	}
+	if pm.SlowClient != nil {
+		sc := *pm.SlowClient
+		s.SlowClient = &sc
+	}
+	s.StatusRewrites = slices.Clone(pm.StatusRewrites)
+	if pm.Connect != nil {
+		ct := *pm.Connect
+		ct.Allow = slices.Clone(ct.Allow)
+		s.Connect = &ct
+	}
+	return s
+}
+
+// fields returns the exported configuration fields, sharing their references.
+func (pm *ReverseProxyMux) fields() *settings {
+	return &settings{
+		Transport:               pm.Transport,
+		RequestHeader:           pm.RequestHeader,
+		ModifyRequest:           pm.ModifyRequest,
+		ModifyResponse:          pm.ModifyResponse,
+		ErrorHandler:            pm.ErrorHandler,
+		PanicHandler:            pm.PanicHandler,
+		ErrorLog:                pm.ErrorLog,
+		NotFoundHandler:         pm.NotFoundHandler,
+		MethodNotAllowedHandler: pm.MethodNotAllowedHandler,
+		MaintenanceHandler:      pm.MaintenanceHandler,
+		MaxBufferedResponse:     pm.MaxBufferedResponse,
+		MaxBufferedRequest:      pm.MaxBufferedRequest,
+		UpstreamTimeout:         pm.UpstreamTimeout,
+		PartialResponse:         pm.PartialResponse,
+		Balancer:                pm.Balancer,
+		LoadShedding:            pm.LoadShedding,
+		SlowClient:              pm.SlowClient,
+		ResponseHeaderPolicy:    pm.ResponseHeaderPolicy,
+		Via:                     pm.Via,
+		StatusRewrites:          pm.StatusRewrites,
+		Connect:                 pm.Connect,
+		BaseContext:             pm.BaseContext,
+		RequestContext:          pm.RequestContext,
+	}
+}
+
+// setFields sets the exported configuration fields, the inverse of fields.
+func (pm *ReverseProxyMux) setFields(s *settings) {
+	pm.Transport = s.Transport
+	pm.RequestHeader = s.RequestHeader
+	pm.ModifyRequest = s.ModifyRequest
+	pm.ModifyResponse = s.ModifyResponse
+	pm.ErrorHandler = s.ErrorHandler
+	pm.PanicHandler = s.PanicHandler
+	pm.ErrorLog = s.ErrorLog
+	pm.NotFoundHandler = s.NotFoundHandler
+	pm.MethodNotAllowedHandler = s.MethodNotAllowedHandler
+	pm.MaintenanceHandler = s.MaintenanceHandler
+	pm.MaxBufferedResponse = s.MaxBufferedResponse
+	pm.MaxBufferedRequest = s.MaxBufferedRequest
+	pm.UpstreamTimeout = s.UpstreamTimeout
+	pm.PartialResponse = s.PartialResponse
+	pm.Balancer = s.Balancer
+	pm.LoadShedding = s.LoadShedding
+	pm.SlowClient = s.SlowClient
+	pm.ResponseHeaderPolicy = s.ResponseHeaderPolicy
+	pm.Via = s.Via
+	pm.StatusRewrites = s.StatusRewrites
+	pm.Connect = s.Connect
+	pm.BaseContext = s.BaseContext
+	pm.RequestContext = s.RequestContext
+}
+
+// current returns the configuration serving the requests: the snapshot taken by Build, or the
+// exported fields if the mux wasn't built.
+func (pm *ReverseProxyMux) current() *settings {
+	if s := pm.settings.Load(); s != nil {
+		return s
+	}
+	return pm.fields()
+}
@@ -0,0 +1,76 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentServe(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+			assert.Equal(t, http.StatusTeapot, serve(pm, "GET", "/missing").Code)
+			assert.Equal(t, http.StatusMethodNotAllowed, serve(pm, "POST", "/users").Code)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBuild(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	modifier := func(value string) ResponseModifier {
+		return func(res *http.Response) error {
+			res.Header.Set("X-Modifier", value)
+			return nil
+		}
+	}
+
+	pm.ModifyResponse = modifier("live")
+	assert.Equal(t, "live", serve(pm, "GET", "/users").Header().Get("X-Modifier"), "the fields should be used before Build")
+
+	assert.NoError(t, pm.Build())
+	pm.ModifyResponse = modifier("changed")
+	assert.Equal(t, "live", serve(pm, "GET", "/users").Header().Get("X-Modifier"), "the snapshot should be used after Build")
+
+	assert.NoError(t, pm.Build())
+	assert.Equal(t, "changed", serve(pm, "GET", "/users").Header().Get("X-Modifier"), "Build should apply the changes")
+}
+
+func TestFreeze(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.Freeze()
+	assert.True(t, pm.IsFrozen())
+
+	assert.ErrorIs(t, pm.AddRoute(NewRoute("GET", "/posts")), ErrFrozen)
+	assert.ErrorIs(t, pm.RemoveRoute("/users"), ErrFrozen)
+	assert.ErrorIs(t, pm.Build(), ErrFrozen)
+	assert.PanicsWithValue(t, ErrFrozen, func() {
+		pm.Use(tag("a"))
+	})
+	assert.PanicsWithValue(t, ErrFrozen, func() {
+		pm.ServeStatic("/", t.TempDir())
+	})
+
+	w := serve(pm, "GET", "/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, " /users ", w.Body.String(), "the frozen mux should be unchanged")
+	_, err := pm.AddBackend(pm.Remote().String())
+	assert.NoError(t, err, "the backend pool should not be frozen")
+}
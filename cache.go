@@ -0,0 +1,417 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	httputilx "github.com/open-webtech/go-reverse-proxy/httputil"
+)
+
+// DefaultCacheEntries is the number of entries of the memory store of a Cache without a Store.
+const DefaultCacheEntries = 1000
+
+// Cache configures the response cache of a route, see Route.SetCache. The Cache-Control directives of
+// the upstream responses take precedence over the defaults of the Cache.
+type Cache struct {
+	// Store holds the cached responses, a memory store of DefaultCacheEntries entries if nil.
+	Store CacheStore
+	// TTL is the freshness lifetime of the responses without a max-age directive, zero means they aren't cached.
+	TTL time.Duration
+	// StaleWhileRevalidate is the time a stale response is served while it's revalidated in the
+	// background, unless the response has a stale-while-revalidate directive.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is the time a stale response is served if the upstream fails or responds with a
+	// server error, unless the response has a stale-if-error directive.
+	StaleIfError time.Duration
+}
+
+// CacheEntry is a cached upstream response.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// RequestHeader holds the request headers named by the Vary header of the response.
+	RequestHeader http.Header
+	// Stored is the time the response was received.
+	Stored time.Time
+	// Expires is the time the response becomes stale.
+	Expires              time.Time
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// retention returns how long the entry is kept from now on.
+func (e *CacheEntry) retention(now time.Time) time.Duration {
+	return e.Expires.Add(max(e.StaleWhileRevalidate, e.StaleIfError)).Sub(now)
+}
+
+// CacheStore stores the responses of a Cache.
+type CacheStore interface {
+	// Get returns the entry of the key, or nil if there is none.
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	// Set stores the entry of the key for the passed time.
+	Set(ctx context.Context, key string, entry *CacheEntry, ttl time.Duration) error
+	// Delete removes the entry of the key.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryCache is an in-memory CacheStore, evicting the least recently used entries beyond its capacity.
+type MemoryCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryEntry is an entry of the memory store.
+type memoryEntry struct {
+	key     string
+	entry   *CacheEntry
+	expires time.Time
+}
+
+// NewMemoryCache creates a memory store holding up to max entries, zero means unlimited.
+func NewMemoryCache(max int) *MemoryCache {
+	return &MemoryCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the entry of the key, or nil if there is none or it expired.
+func (c *MemoryCache) Get(_ context.Context, key string) (*CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	me := e.Value.(*memoryEntry)
+	if time.Now().After(me.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, nil
+	}
+	c.order.MoveToFront(e)
+	return me.entry, nil
+}
+
+// Set stores the entry of the key for the passed time.
+func (c *MemoryCache) Set(_ context.Context, key string, entry *CacheEntry, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	me := &memoryEntry{key: key, entry: entry, expires: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = me
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(me)
+	for c.max > 0 && c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Delete removes the entry of the key.
+func (c *MemoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones not evicted yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// routeCache is the response cache of a route.
+type routeCache struct {
+	pm    *ReverseProxyMux
+	cfg   Cache
+	store CacheStore
+
+	mu sync.Mutex
+	// revalidating holds the keys of the entries revalidated in the background.
+	revalidating map[string]bool
+}
+
+// newRouteCache creates the cache of a route.
+func (pm *ReverseProxyMux) newRouteCache(cfg Cache) *routeCache {
+	c := &routeCache{pm: pm, cfg: cfg, store: cfg.Store, revalidating: make(map[string]bool)}
+	if c.store == nil {
+		c.store = NewMemoryCache(DefaultCacheEntries)
+	}
+	return c
+}
+
+// cacheable reports whether the response of the outbound request can be served from the cache: it's
+// a GET or HEAD request without a body, credentials or no-store directive. The Range headers are
+// answered by the proxy from the full responses.
+func cacheable(r *http.Request) bool {
+	if !coalescable(r) || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	_, noStore := cacheControl(r.Header)["no-store"]
+	return !noStore
+}
+
+// cacheKey returns the cache key of the request: the method and the inbound host and URI.
+func cacheKey(r *http.Request, x *exchange) string {
+	return r.Method + " " + r.Header.Get("X-Forwarded-Host") + x.target.RequestURI()
+}
+
+// roundTrip serves the outbound request from the cache, or sends it with send and caches the response.
+// Stale entries are served while they're revalidated in the background, or if the upstream fails.
+func (c *routeCache) roundTrip(r *http.Request, x *exchange, limit int64, send func(*http.Request, *exchange) (*http.Response, error)) (*http.Response, error) {
+	ctx := r.Context()
+	trace := TraceFromContext(ctx)
+	key := cacheKey(r, x)
+	entry, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.pm.logf("%s: cache: %v", describeRequest(r), err)
+	}
+	if entry != nil && !varyMatches(entry, r) {
+		entry = nil
+	}
+	_, noCache := cacheControl(r.Header)["no-cache"]
+	now := time.Now()
+	if entry != nil && !noCache {
+		switch {
+		case now.Before(entry.Expires):
+			trace.Add("cache", "hit")
+			return entry.response(r, now), nil
+		case now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)):
+			trace.Add("cache", "stale, revalidating")
+			c.revalidate(r, x, key, entry, limit, send)
+			return entry.response(r, now), nil
+		}
+	}
+	trace.Add("cache", "miss")
+	res, err := send(r, x)
+	if entry != nil && now.Before(entry.Expires.Add(entry.StaleIfError)) && (err != nil || res.StatusCode >= 500) {
+		if err == nil {
+			_ = res.Body.Close()
+		}
+		trace.Add("cache", "stale on error")
+		return entry.response(r, now), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.storeResponse(r, key, res, limit), nil
+}
+
+// storeResponse stores the response if it's storable, returning it with its body replaced if it was read.
+func (c *routeCache) storeResponse(r *http.Request, key string, res *http.Response, limit int64) *http.Response {
+	entry := c.newEntry(r, res)
+	if entry == nil {
+		return res
+	}
+	b, ok := readBody(res, limit)
+	if !ok {
+		return res
+	}
+	entry.Body = b
+	if err := c.store.Set(r.Context(), key, entry, entry.retention(entry.Stored)); err != nil {
+		c.pm.logf("%s: cache: %v", describeRequest(r), err)
+	}
+	return res
+}
+
+// revalidate refreshes the stale entry in the background, unless it's revalidated already. The
+// request is made conditional if the entry has an ETag or Last-Modified header.
+func (c *routeCache) revalidate(r *http.Request, x *exchange, key string, entry *CacheEntry, limit int64, send func(*http.Request, *exchange) (*http.Response, error)) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	ctx := context.WithoutCancel(r.Context())
+	cancel := context.CancelFunc(func() {})
+	if timeout := c.pm.current().UpstreamTimeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	// the revalidation has its own exchange, as the one of the request is observed when it ends
+	rx := *x
+	req := r.Clone(context.WithValue(ctx, exchangeKey{}, &rx))
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lm := entry.Header.Get("Last-Modified"); lm != "" {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+	go func() {
+		defer func() {
+			cancel()
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+		res, err := send(req, &rx)
+		if err != nil {
+			return
+		}
+		if res.StatusCode == http.StatusNotModified {
+			_ = res.Body.Close()
+			header := entry.Header.Clone()
+			httputilx.CopyHeader(header, res.Header)
+			if fresh := c.newEntry(req, &http.Response{StatusCode: entry.StatusCode, Header: header}); fresh != nil {
+				fresh.Body = entry.Body
+				_ = c.store.Set(ctx, key, fresh, fresh.retention(fresh.Stored))
+			}
+			return
+		}
+		if res.StatusCode >= 500 {
+			_ = res.Body.Close()
+			return
+		}
+		if c.newEntry(req, res) == nil {
+			_ = c.store.Delete(ctx, key)
+		}
+		res = c.storeResponse(req, key, res, limit)
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+}
+
+// storableStatus holds the status codes of the responses cached by default, per RFC 9110.
+var storableStatus = []int{200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501}
+
+// newEntry returns the entry of the upstream response without its body, or nil if it isn't storable,
+// e.g. it has trailers, which aren't stored.
+func (c *routeCache) newEntry(r *http.Request, res *http.Response) *CacheEntry {
+	if !slices.Contains(storableStatus, res.StatusCode) || res.Header.Get("Set-Cookie") != "" || len(res.Trailer) > 0 {
+		return nil
+	}
+	cc := cacheControl(res.Header)
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[directive]; ok {
+			return nil
+		}
+	}
+	ttl, ok := cacheDuration(cc, "s-maxage")
+	if !ok {
+		ttl, ok = cacheDuration(cc, "max-age")
+	}
+	if !ok {
+		ttl = c.cfg.TTL
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	now := time.Now()
+	entry := &CacheEntry{
+		StatusCode:           res.StatusCode,
+		Header:               make(http.Header, len(res.Header)),
+		Stored:               now,
+		Expires:              now.Add(ttl),
+		StaleWhileRevalidate: c.cfg.StaleWhileRevalidate,
+		StaleIfError:         c.cfg.StaleIfError,
+	}
+	httputilx.CopyHeader(entry.Header, res.Header)
+	if d, ok := cacheDuration(cc, "stale-while-revalidate"); ok {
+		entry.StaleWhileRevalidate = d
+	}
+	if d, ok := cacheDuration(cc, "stale-if-error"); ok {
+		entry.StaleIfError = d
+	}
+	for _, name := range varyNames(res.Header) {
+		if name == "*" {
+			return nil
+		}
+		if entry.RequestHeader == nil {
+			entry.RequestHeader = make(http.Header)
+		}
+		if values := r.Header.Values(name); len(values) > 0 {
+			entry.RequestHeader[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return entry
+}
+
+// response returns the response of the entry to the request.
+func (e *CacheEntry) response(r *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.Stored).Seconds())))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
+
+// varyMatches reports whether the request matches the request headers named by the Vary header of the entry.
+func varyMatches(e *CacheEntry, r *http.Request) bool {
+	for _, name := range varyNames(e.Header) {
+		if !slices.Equal(r.Header.Values(name), e.RequestHeader.Values(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// varyNames returns the header names of the Vary header.
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// cacheControl parses the Cache-Control directives of the header.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// cacheDuration returns the duration of a delta-seconds directive.
+func cacheDuration(directives map[string]string, name string) (time.Duration, bool) {
+	v, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,145 @@
+package reverseproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/private":
+			w.Header().Set("Cache-Control", "private")
+		case "/vary":
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		_, _ = io.WriteString(w, "fresh "+r.URL.Path+" "+r.Header.Get("Accept-Language"))
+	}))
+	defer origin.Close()
+
+	store := NewMemoryCache(10)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET|POST", "/*path").SetCache(Cache{Store: store, TTL: time.Minute}))
+
+	// stale seeds a stale entry of the path
+	stale := func(path string, swr, sie time.Duration, header http.Header) {
+		if header == nil {
+			header = make(http.Header)
+		}
+		_ = store.Set(context.Background(), "GET example.com"+path, &CacheEntry{
+			StatusCode:           http.StatusOK,
+			Header:               header,
+			Body:                 []byte("stale"),
+			Stored:               time.Now().Add(-2 * time.Minute),
+			Expires:              time.Now().Add(-time.Minute),
+			StaleWhileRevalidate: swr,
+			StaleIfError:         sie,
+		}, time.Hour)
+	}
+	stale("/swr", time.Hour, 0, nil)
+	stale("/expired", time.Second, 0, nil)
+	stale("/error", 0, time.Hour, nil)
+	stale("/etag", time.Hour, 0, http.Header{"Etag": {`"v1"`}})
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		language string
+		wantCode int
+		wantBody string
+		wantHits int32
+	}{
+		{"Test miss", "GET", "/page", "", http.StatusOK, "fresh /page ", 1},
+		{"Test hit", "GET", "/page", "", http.StatusOK, "fresh /page ", 0},
+		{"Test POST", "POST", "/page", "", http.StatusOK, "fresh /page ", 1},
+		{"Test private response", "GET", "/private", "", http.StatusOK, "fresh /private ", 1},
+		{"Test private response again", "GET", "/private", "", http.StatusOK, "fresh /private ", 1},
+		{"Test vary", "GET", "/vary", "en", http.StatusOK, "fresh /vary en", 1},
+		{"Test vary hit", "GET", "/vary", "en", http.StatusOK, "fresh /vary en", 0},
+		{"Test vary mismatch", "GET", "/vary", "de", http.StatusOK, "fresh /vary de", 1},
+		{"Test stale while revalidate", "GET", "/swr", "", http.StatusOK, "stale", 1},
+		{"Test revalidated", "GET", "/swr", "", http.StatusOK, "fresh /swr ", 0},
+		{"Test stale beyond revalidate window", "GET", "/expired", "", http.StatusOK, "fresh /expired ", 1},
+		{"Test stale if error", "GET", "/error", "", http.StatusOK, "stale", 1},
+		{"Test not modified", "GET", "/etag", "", http.StatusOK, "stale", 1},
+		{"Test refreshed", "GET", "/etag", "", http.StatusOK, "stale", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("Accept-Language", tt.language)
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			// wait for the background revalidation
+			assert.Eventually(t, func() bool {
+				return hits.Load() == tt.wantHits
+			}, time.Second, 5*time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+		})
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+	_ = c.Set(ctx, "a", &CacheEntry{StatusCode: 200}, time.Minute)
+	_ = c.Set(ctx, "b", &CacheEntry{StatusCode: 201}, time.Minute)
+	_, _ = c.Get(ctx, "a")
+	_ = c.Set(ctx, "c", &CacheEntry{StatusCode: 202}, time.Minute)
+	_ = c.Set(ctx, "d", &CacheEntry{StatusCode: 203}, -time.Second)
+
+	e, _ := c.Get(ctx, "a")
+	assert.Nil(t, e)
+	e, _ = c.Get(ctx, "c")
+	assert.Equal(t, 202, e.StatusCode)
+	e, _ = c.Get(ctx, "d")
+	assert.Nil(t, e)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCache_RouteChange(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.WriteString(w, "fresh")
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/page").SetCache(Cache{TTL: time.Minute}))
+	get := func() {
+		w := httptest.NewRecorder()
+		pm.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+		assert.Equal(t, "fresh", w.Body.String())
+	}
+	get()
+
+	// the cached responses survive the rebuild of the route handlers
+	pm.PassPath("GET", "/other")
+	get()
+	assert.Equal(t, int32(1), hits.Load())
+}
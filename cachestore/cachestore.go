@@ -0,0 +1,155 @@
+// Package cachestore provides distributed stores of the response cache of a mux, so multiple proxy
+// instances share the cached responses: Redis and memcached. The clients speak the protocols over
+// pooled TCP connections, without further dependencies.
+//
+//	store := cachestore.NewRedis("localhost:6379")
+//	pm.HandlePath(reverseproxy.NewRoute("GET", "/assets/*path").SetCache(reverseproxy.Cache{Store: store}))
+package cachestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// DefaultTimeout is the timeout of the operations whose context has no deadline.
+const DefaultTimeout = time.Second
+
+// DefaultMaxIdle is the number of idle connections kept by a store.
+const DefaultMaxIdle = 8
+
+// encodingVersion is the version of the entry encoding, changed on incompatible changes.
+const encodingVersion = 1
+
+var (
+	// ErrFormat is returned when decoding an entry of an unknown format.
+	ErrFormat = errors.New("cachestore: unknown entry format")
+	// ErrProtocol is returned when the server answers with a malformed reply.
+	ErrProtocol = errors.New("cachestore: protocol error")
+)
+
+// Marshal encodes the entry with its status, headers and body.
+func Marshal(e *reverseproxy.CacheEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(encodingVersion)
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes an entry encoded by Marshal.
+func Unmarshal(data []byte) (*reverseproxy.CacheEntry, error) {
+	if len(data) == 0 || data[0] != encodingVersion {
+		return nil, ErrFormat
+	}
+	e := &reverseproxy.CacheEntry{}
+	if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	return e, nil
+}
+
+// ServerError is an error reply of the server, which leaves the connection usable.
+type ServerError struct {
+	Message string
+}
+
+// Error returns the message of the server.
+func (e *ServerError) Error() string {
+	return "cachestore: server error: " + e.Message
+}
+
+// conn is a pooled connection with buffered reads and writes.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// pool holds the idle connections of a store.
+type pool struct {
+	// dial opens and prepares a connection.
+	dial    func(ctx context.Context) (*conn, error)
+	maxIdle int
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// do runs fn on an idle or new connection within the deadline of the context, DefaultTimeout if it
+// has none. The connection is closed if fn fails with another error than a ServerError.
+func (p *pool) do(ctx context.Context, fn func(c *conn) error) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	_ = c.SetDeadline(deadline)
+	err = fn(c)
+	var serverErr *ServerError
+	if err != nil && !errors.As(err, &serverErr) {
+		_ = c.Close()
+		return err
+	}
+	p.put(c)
+	return err
+}
+
+// get returns an idle connection or dials a new one.
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+	return p.dial(ctx)
+}
+
+// put returns the connection to the pool, closing it if the pool is full.
+func (p *pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) >= p.maxIdle {
+		_ = c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+// close closes the idle connections.
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.idle {
+		_ = c.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+// dialTCP dials a TCP connection to the address.
+func dialTCP(ctx context.Context, addr string) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
@@ -0,0 +1,78 @@
+package cachestore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	e := &reverseproxy.CacheEntry{
+		StatusCode:           http.StatusOK,
+		Header:               http.Header{"Content-Type": {"text/plain"}, "Vary": {"Accept"}},
+		Body:                 []byte("body"),
+		RequestHeader:        http.Header{"Accept": {"text/*"}},
+		Stored:               now,
+		Expires:              now.Add(time.Minute),
+		StaleWhileRevalidate: time.Hour,
+	}
+	data, err := Marshal(e)
+	assert.NoError(t, err)
+	got, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.True(t, got.Stored.Equal(e.Stored))
+	got.Stored, got.Expires = e.Stored, e.Expires
+	assert.Equal(t, e, got)
+
+	_, err = Unmarshal([]byte("garbage"))
+	assert.ErrorIs(t, err, ErrFormat)
+	_, err = Unmarshal(append([]byte{encodingVersion}, "garbage"...))
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+// testStore tests the operations of the store and its use as the cache of a mux.
+func testStore(t *testing.T, store reverseproxy.CacheStore) {
+	ctx := context.Background()
+	e, err := store.Get(ctx, "GET example.com/missing")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	entry := &reverseproxy.CacheEntry{StatusCode: http.StatusOK, Header: http.Header{"X-Test": {"1"}}, Body: []byte("cached\r\nEND\r\n")}
+	assert.NoError(t, store.Set(ctx, "GET example.com/a b", entry, time.Minute))
+	e, err = store.Get(ctx, "GET example.com/a b")
+	assert.NoError(t, err)
+	assert.Equal(t, entry.Body, e.Body)
+	assert.Equal(t, entry.Header, e.Header)
+
+	assert.NoError(t, store.Delete(ctx, "GET example.com/a b"))
+	assert.NoError(t, store.Delete(ctx, "GET example.com/a b"))
+	e, err = store.Get(ctx, "GET example.com/a b")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "origin")
+	}))
+	t.Cleanup(origin.Close)
+	// two proxy instances share the store
+	for i := 0; i < 2; i++ {
+		pm, err := reverseproxy.New(origin.URL)
+		assert.NoError(t, err)
+		pm.HandlePath(reverseproxy.NewRoute("GET", "/page").SetCache(reverseproxy.Cache{Store: store}))
+		w := httptest.NewRecorder()
+		pm.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+		assert.Equal(t, "origin", w.Body.String())
+	}
+	assert.Equal(t, int32(1), hits.Load())
+}
@@ -0,0 +1,153 @@
+package cachestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// maxRelativeExpiry is the longest expiration time memcached takes relative to now, longer ones are
+// taken as Unix times.
+const maxRelativeExpiry = 30 * 24 * time.Hour
+
+// Memcached is a CacheStore keeping the entries in memcached, using its text protocol. The keys are
+// hashed, as memcached limits their length and characters.
+type Memcached struct {
+	pool
+	// Addr is the host:port address of the server.
+	Addr string
+	// Prefix is prepended to the hashed keys.
+	Prefix string
+}
+
+// NewMemcached creates a store of the memcached server at addr. The fields can be set before first use.
+func NewMemcached(addr string) *Memcached {
+	s := &Memcached{Addr: addr, Prefix: "reverseproxy:"}
+	s.pool = pool{dial: s.dial, maxIdle: DefaultMaxIdle}
+	return s
+}
+
+// dial opens a connection.
+func (s *Memcached) dial(ctx context.Context) (*conn, error) {
+	return dialTCP(ctx, s.Addr)
+}
+
+// key returns the memcached key of the cache key.
+func (s *Memcached) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return s.Prefix + hex.EncodeToString(sum[:])
+}
+
+// Get returns the entry of the key, or nil if there is none.
+func (s *Memcached) Get(ctx context.Context, key string) (*reverseproxy.CacheEntry, error) {
+	var data []byte
+	err := s.do(ctx, func(c *conn) error {
+		fmt.Fprintf(c.w, "get %s\r\n", s.key(key))
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(c)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			if err := replyError(line); err != nil {
+				return err
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("%w: unexpected reply %q", ErrProtocol, line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: invalid value length %q", ErrProtocol, line)
+			}
+			data = make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, data); err != nil {
+				return err
+			}
+			data = data[:n]
+		}
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
+
+// Set stores the entry of the key for the passed time, rounded up to seconds.
+func (s *Memcached) Set(ctx context.Context, key string, entry *reverseproxy.CacheEntry, ttl time.Duration) error {
+	data, err := Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ttl = max((ttl + time.Second - 1).Truncate(time.Second), time.Second)
+	exptime := int64(ttl / time.Second)
+	if ttl > maxRelativeExpiry {
+		exptime = time.Now().Add(ttl).Unix()
+	}
+	return s.do(ctx, func(c *conn) error {
+		fmt.Fprintf(c.w, "set %s 0 %d %d\r\n", s.key(key), exptime, len(data))
+		_, _ = c.w.Write(data)
+		_, _ = c.w.WriteString("\r\n")
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		return expectReply(c, "STORED")
+	})
+}
+
+// Delete removes the entry of the key.
+func (s *Memcached) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, func(c *conn) error {
+		fmt.Fprintf(c.w, "delete %s\r\n", s.key(key))
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		return expectReply(c, "DELETED", "NOT_FOUND")
+	})
+}
+
+// Close closes the idle connections.
+func (s *Memcached) Close() error {
+	return s.close()
+}
+
+// expectReply reads a reply line, which must be one of the passed replies.
+func expectReply(c *conn, replies ...string) error {
+	line, err := readLine(c)
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if line == reply {
+			return nil
+		}
+	}
+	if err := replyError(line); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: unexpected reply %q", ErrProtocol, line)
+}
+
+// replyError returns the error of an error reply line, or nil.
+func replyError(line string) error {
+	switch {
+	case line == "ERROR":
+		return &ServerError{Message: line}
+	case strings.HasPrefix(line, "CLIENT_ERROR "), strings.HasPrefix(line, "SERVER_ERROR "):
+		return &ServerError{Message: line}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cachestore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startMemcachedServer starts a minimal memcached server and returns its address.
+func startMemcachedServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	var mu sync.Mutex
+	data := make(map[string][]byte)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					mu.Lock()
+					switch {
+					case len(fields[1]) > 250:
+						_, _ = io.WriteString(conn, "CLIENT_ERROR line format\r\n")
+					case fields[0] == "get":
+						if v, ok := data[fields[1]]; ok {
+							fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+						}
+						_, _ = io.WriteString(conn, "END\r\n")
+					case fields[0] == "set" && len(fields) == 5:
+						n, _ := strconv.Atoi(fields[4])
+						b := make([]byte, n+2)
+						_, _ = io.ReadFull(r, b)
+						data[fields[1]] = b[:n]
+						_, _ = io.WriteString(conn, "STORED\r\n")
+					case fields[0] == "delete":
+						if _, ok := data[fields[1]]; ok {
+							delete(data, fields[1])
+							_, _ = io.WriteString(conn, "DELETED\r\n")
+						} else {
+							_, _ = io.WriteString(conn, "NOT_FOUND\r\n")
+						}
+					default:
+						_, _ = io.WriteString(conn, "ERROR\r\n")
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestMemcached(t *testing.T) {
+	store := NewMemcached(startMemcachedServer(t))
+	t.Cleanup(func() { _ = store.Close() })
+	testStore(t, store)
+
+	assert.Len(t, store.key(strings.Repeat("x", 1000)), len("reverseproxy:")+64)
+}
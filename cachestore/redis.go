@@ -0,0 +1,223 @@
+package cachestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// Redis is a CacheStore keeping the entries in Redis, expiring them with the server.
+type Redis struct {
+	pool
+	// Addr is the host:port address of the server.
+	Addr string
+	// Username and Password authenticate the connections if the Password isn't empty.
+	Username string
+	Password string
+	// DB is the database selected on the connections.
+	DB int
+	// Prefix is prepended to the keys, separating the entries from other data of the database.
+	Prefix string
+}
+
+// NewRedis creates a store of the Redis server at addr. The fields can be set before first use.
+func NewRedis(addr string) *Redis {
+	s := &Redis{Addr: addr, Prefix: "reverseproxy:"}
+	s.pool = pool{dial: s.dial, maxIdle: DefaultMaxIdle}
+	return s
+}
+
+// dial opens a connection, authenticating and selecting the database.
+func (s *Redis) dial(ctx context.Context) (*conn, error) {
+	c, err := dialTCP(ctx, s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+	err = func() error {
+		if s.Password != "" {
+			args := []string{"AUTH", s.Password}
+			if s.Username != "" {
+				args = []string{"AUTH", s.Username, s.Password}
+			}
+			if _, err := s.command(c, args...); err != nil {
+				return err
+			}
+		}
+		if s.DB != 0 {
+			if _, err := s.command(c, "SELECT", strconv.Itoa(s.DB)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the entry of the key, or nil if there is none.
+func (s *Redis) Get(ctx context.Context, key string) (*reverseproxy.CacheEntry, error) {
+	var reply any
+	err := s.do(ctx, func(c *conn) (err error) {
+		reply, err = s.command(c, "GET", s.Prefix+key)
+		return err
+	})
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected reply %v", ErrProtocol, reply)
+	}
+	return Unmarshal(data)
+}
+
+// Set stores the entry of the key for the passed time, rounded up to milliseconds.
+func (s *Redis) Set(ctx context.Context, key string, entry *reverseproxy.CacheEntry, ttl time.Duration) error {
+	data, err := Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ms := max((ttl+time.Millisecond-1)/time.Millisecond, 1)
+	return s.do(ctx, func(c *conn) error {
+		_, err := s.command(c, "SET", s.Prefix+key, string(data), "PX", strconv.FormatInt(int64(ms), 10))
+		return err
+	})
+}
+
+// Delete removes the entry of the key.
+func (s *Redis) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, func(c *conn) error {
+		_, err := s.command(c, "DEL", s.Prefix+key)
+		return err
+	})
+}
+
+// incrementScript increments the count of KEYS[1], setting its expiry to ARGV[1] milliseconds if it's
+// new. It runs atomically on the server, so a count never exists without its expiry.
+const incrementScript = `local n = redis.call("INCR", KEYS[1])
+if n == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return n`
+
+// Increment adds a request to the count of the key, which expires after the ttl, rounded up to
+// milliseconds, if it's new, and returns the new count. It implements reverseproxy.QuotaCounter, so the
+// quotas are shared by the proxy instances using the server.
+func (s *Redis) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	ms := max((ttl+time.Millisecond-1)/time.Millisecond, 1)
+	var n int64
+	err := s.do(ctx, func(c *conn) error {
+		reply, err := s.command(c, "EVAL", incrementScript, "1", s.Prefix+key, strconv.FormatInt(int64(ms), 10))
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if n, ok = reply.(int64); !ok {
+			return fmt.Errorf("%w: unexpected reply %v", ErrProtocol, reply)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Do runs a raw command, e.g. for other data kept in the database, and returns its reply like
+// command does. The Prefix isn't applied to the arguments.
+func (s *Redis) Do(ctx context.Context, args ...string) (any, error) {
+	var reply any
+	err := s.do(ctx, func(c *conn) (err error) {
+		reply, err = s.command(c, args...)
+		return err
+	})
+	return reply, err
+}
+
+// Close closes the idle connections.
+func (s *Redis) Close() error {
+	return s.close()
+}
+
+// command sends a command and reads its reply: a string for simple strings, []byte for bulk strings,
+// int64 for integers, []any for arrays, nil for null replies, or a *ServerError.
+func (s *Redis) command(c *conn, args ...string) (any, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c)
+}
+
+// readReply reads a RESP reply.
+func readReply(c *conn) (any, error) {
+	line, err := readLine(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: empty reply", ErrProtocol)
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &ServerError{Message: line[1:]}
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid integer %q", ErrProtocol, line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("%w: invalid bulk length %q", ErrProtocol, line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("%w: invalid array length %q", ErrProtocol, line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(c); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown reply %q", ErrProtocol, line)
+	}
+}
+
+// readLine reads a CRLF terminated line without the CRLF.
+func readLine(c *conn) (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("%w: malformed line %q", ErrProtocol, line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,199 @@
+package cachestore
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// startRedisServer starts a minimal Redis server and returns its address.
+func startRedisServer(t *testing.T, password string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	var mu sync.Mutex
+	data := make(map[string]string)
+	expires := make(map[string]time.Time)
+	fields := make(map[string]string)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				authed := password == ""
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch {
+					case args[0] == "AUTH":
+						authed = args[len(args)-1] == password
+						if authed {
+							_, _ = io.WriteString(conn, "+OK\r\n")
+						} else {
+							_, _ = io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+						}
+					case !authed:
+						_, _ = io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+					case args[0] == "SELECT":
+						_, _ = io.WriteString(conn, "+OK\r\n")
+					case args[0] == "GET":
+						v, ok := data[args[1]]
+						if !ok || time.Now().After(expires[args[1]]) {
+							_, _ = io.WriteString(conn, "$-1\r\n")
+						} else {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+						}
+					case args[0] == "SET" && len(args) >= 5 && args[3] == "PX":
+						ms, _ := strconv.Atoi(args[4])
+						data[args[1]] = args[2]
+						expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+						_, _ = io.WriteString(conn, "+OK\r\n")
+					case args[0] == "EVAL" && args[1] == incrementScript:
+						key := args[3]
+						if time.Now().After(expires[key]) {
+							delete(data, key)
+						}
+						n, _ := strconv.Atoi(data[key])
+						data[key] = strconv.Itoa(n + 1)
+						if n == 0 {
+							ms, _ := strconv.Atoi(args[4])
+							expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+						}
+						fmt.Fprintf(conn, ":%d\r\n", n+1)
+					case args[0] == "HSET":
+						fields[args[1]+"\x00"+args[2]] = args[3]
+						_, _ = io.WriteString(conn, ":1\r\n")
+					case args[0] == "HGET":
+						if v, ok := fields[args[1]+"\x00"+args[2]]; ok {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+						} else {
+							_, _ = io.WriteString(conn, "$-1\r\n")
+						}
+					case args[0] == "DEL":
+						_, ok := data[args[1]]
+						delete(data, args[1])
+						if ok {
+							_, _ = io.WriteString(conn, ":1\r\n")
+						} else {
+							_, _ = io.WriteString(conn, ":0\r\n")
+						}
+					default:
+						_, _ = io.WriteString(conn, "-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func TestRedis(t *testing.T) {
+	addr := startRedisServer(t, "secret")
+	store := NewRedis(addr)
+	store.Password, store.DB = "secret", 2
+	t.Cleanup(func() { _ = store.Close() })
+	testStore(t, store)
+
+	wrong := NewRedis(addr)
+	wrong.Password = "wrong"
+	_, err := wrong.Get(context.Background(), "key")
+	var serverErr *ServerError
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, "WRONGPASS invalid password", serverErr.Message)
+}
+
+func TestRedisExpiry(t *testing.T) {
+	store := NewRedis(startRedisServer(t, ""))
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	assert.NoError(t, store.Set(ctx, "key", &reverseproxy.CacheEntry{StatusCode: 200}, time.Nanosecond))
+	time.Sleep(5 * time.Millisecond)
+	e, err := store.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+}
+
+func TestRedisIncrement(t *testing.T) {
+	store := NewRedis(startRedisServer(t, ""))
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	var counter reverseproxy.QuotaCounter = store
+	for want := int64(1); want <= 3; want++ {
+		n, err := counter.Increment(ctx, "quota", time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+	n, err := store.Increment(ctx, "expiring", time.Nanosecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(5 * time.Millisecond)
+	n, err = store.Increment(ctx, "expiring", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestRedisDo(t *testing.T) {
+	store := NewRedis(startRedisServer(t, ""))
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		args  []string
+		reply any
+	}{
+		{"Test integer reply", []string{"HSET", "hash", "field", "value"}, int64(1)},
+		{"Test bulk reply", []string{"HGET", "hash", "field"}, []byte("value")},
+		{"Test null reply", []string{"HGET", "hash", "other"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := store.Do(ctx, tt.args...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.reply, reply)
+		})
+	}
+
+	_, err := store.Do(ctx, "UNKNOWN")
+	var serverErr *ServerError
+	assert.ErrorAs(t, err, &serverErr)
+}
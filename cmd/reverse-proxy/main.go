@@ -0,0 +1,314 @@
+// Command reverse-proxy runs a reverse proxy of a YAML or JSON configuration file, so the package can
+// be used without writing Go. The file holds the listener settings next to the mux configuration, see
+// reverseproxy.Config:
+//
+//	listen: ":8080"
+//	unix: /run/reverse-proxy.sock
+//	tls:
+//	  listen: ":8443"
+//	  certFile: cert.pem
+//	  keyFile: key.pem
+//	admin: "127.0.0.1:9090"
+//	shutdownTimeout: 30s
+//	upstreams:
+//	  - url: http://127.0.0.1:3000
+//	routes:
+//	  - methods: [GET]
+//	    path: /users/:id
+//	    rewritePath: /v1/users/:id
+//
+// The sockets passed by systemd socket activation are served too: the ones named "admin" by their
+// FileDescriptorName serve the admin API, the ones named "https" serve the proxy with the TLS
+// certificate, and the others serve the proxy.
+//
+// The secret references of the file, e.g. env://API_KEY or vault://secret/proxy#api_key, are resolved
+// when it's loaded, see the secrets package.
+//
+// SIGHUP reloads the mux configuration, resolving its secrets again, and keeps the current one if the
+// file is invalid. The listener settings are only read at startup. SIGUSR2 upgrades the process in place: the binary is started
+// again, e.g. after it was replaced by a new version, taking the listening sockets over, and the
+// current process drains its in-flight requests and exits once the new one is serving. SIGINT and SIGTERM shut the servers down gracefully, waiting for
+// the in-flight requests up to the shutdown timeout.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/admin"
+	"github.com/open-webtech/go-reverse-proxy/secrets"
+	"github.com/open-webtech/go-reverse-proxy/server"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultShutdownTimeout is the time the in-flight requests are waited for on shutdown by default.
+const defaultShutdownTimeout = 30 * time.Second
+
+// fileConfig is the configuration file.
+type fileConfig struct {
+	// Listen is the address of the HTTP listener, disabled if empty.
+	Listen string `yaml:"listen"`
+	// Unix is the path of the unix socket of the HTTP listener, disabled if empty.
+	Unix string `yaml:"unix"`
+	// TLS is the HTTPS listener, disabled if nil.
+	TLS *tlsConfig `yaml:"tls"`
+	// Admin is the address of the admin API listener, disabled if empty.
+	Admin string `yaml:"admin"`
+	// ShutdownTimeout limits the graceful shutdown, defaultShutdownTimeout if empty.
+	ShutdownTimeout string `yaml:"shutdownTimeout"`
+
+	reverseproxy.Config `yaml:",inline"`
+}
+
+// tlsConfig is the HTTPS listener.
+type tlsConfig struct {
+	Listen   string `yaml:"listen"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// loadFile reads and parses the configuration file and resolves its secret references. Unknown
+// fields are rejected.
+func loadFile(name string) (fileConfig, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	var c fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return fileConfig{}, fmt.Errorf("invalid config %s: %w", name, err)
+	}
+	if err := secrets.NewResolver().ResolveAll(context.Background(), &c); err != nil {
+		return fileConfig{}, fmt.Errorf("invalid config %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// app serves the mux of the configuration file, replacing it on reload.
+type app struct {
+	file  string
+	mux   atomic.Pointer[reverseproxy.ReverseProxyMux]
+	admin atomic.Pointer[admin.Server]
+}
+
+// newApp loads the configuration file and builds its mux.
+func newApp(file string) (*app, fileConfig, error) {
+	a := &app{file: file}
+	c, err := loadFile(file)
+	if err != nil {
+		return nil, fileConfig{}, err
+	}
+	if err := a.swap(c.Config); err != nil {
+		return nil, fileConfig{}, err
+	}
+	return a, c, nil
+}
+
+// reload loads the configuration file and replaces the mux. The current mux is kept on errors.
+func (a *app) reload() error {
+	c, err := loadFile(a.file)
+	if err != nil {
+		return err
+	}
+	return a.swap(c.Config)
+}
+
+// swap builds the mux of the configuration and replaces the current one, whose health checks are
+// stopped. Its in-flight requests are completed.
+func (a *app) swap(c reverseproxy.Config) error {
+	pm, err := reverseproxy.NewFromConfig(c)
+	if err != nil {
+		return err
+	}
+	a.admin.Store(admin.New(pm))
+	if old := a.mux.Swap(pm); old != nil {
+		for _, b := range old.Backends() {
+			b.HealthCheck().Stop()
+		}
+	}
+	return nil
+}
+
+// proxyHandler serves the requests with the current mux.
+func (a *app) proxyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mux.Load().ServeHTTP(w, r)
+	})
+}
+
+// adminHandler serves the admin API of the current mux.
+func (a *app) adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.admin.Load().ServeHTTP(w, r)
+	})
+}
+
+func main() {
+	file := flag.String("config", "reverse-proxy.yaml", "the YAML or JSON configuration file")
+	flag.Parse()
+	if err := run(*file); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the configuration file until the process is signaled to stop.
+func run(file string) error {
+	a, c, err := newApp(file)
+	if err != nil {
+		return err
+	}
+	timeout := defaultShutdownTimeout
+	if c.ShutdownTimeout != "" {
+		if timeout, err = time.ParseDuration(c.ShutdownTimeout); err != nil {
+			return fmt.Errorf("invalid shutdown timeout: %w", err)
+		}
+	}
+	proxy, adminAPI, err := listen(a, c)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 2)
+	for _, s := range []*server.Server{proxy, adminAPI} {
+		go func(s *server.Server) {
+			if err := s.Serve(); !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, server.ErrNoListeners) {
+				errs <- err
+			}
+		}(s)
+	}
+	if err := server.Ready(); err != nil {
+		log.Printf("reverse-proxy: notifying the previous process failed: %v", err)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append(upgradeSignals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)...)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case err := <-errs:
+			_ = shutdown(timeout, proxy, adminAPI)
+			return err
+		case sig := <-signals:
+			if slices.Contains(upgradeSignals, sig) {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				proc, err := server.Upgrade(ctx, nil, proxy, adminAPI)
+				cancel()
+				if err != nil {
+					log.Printf("reverse-proxy: upgrade failed, keeping the current process: %v", err)
+					continue
+				}
+				log.Printf("reverse-proxy: upgraded to process %d, draining", proc.Pid)
+				return shutdown(timeout, proxy, adminAPI)
+			}
+			if sig == syscall.SIGHUP {
+				if err := a.reload(); err != nil {
+					log.Printf("reverse-proxy: reload failed, keeping the current config: %v", err)
+				} else {
+					log.Printf("reverse-proxy: reloaded %s", file)
+				}
+				continue
+			}
+			log.Printf("reverse-proxy: shutting down")
+			return shutdown(timeout, proxy, adminAPI)
+		}
+	}
+}
+
+// listener is a configured listener of a server.
+type listener struct {
+	s       *server.Server
+	network string
+	addr    string
+	tls     *tls.Config
+}
+
+// listen creates the proxy and admin API servers with the listeners of the configuration and the
+// sockets passed by systemd socket activation. The systemd sockets named "admin" serve the admin API,
+// the ones named "https" serve the proxy with the TLS certificate, and the others serve the proxy.
+func listen(a *app, c fileConfig) (proxy, adminAPI *server.Server, err error) {
+	proxy, adminAPI = server.New(a.proxyHandler()), server.New(a.adminHandler())
+	defer func() {
+		if err != nil {
+			_ = proxy.Close()
+			_ = adminAPI.Close()
+		}
+	}()
+	var tlsConfig *tls.Config
+	if c.TLS != nil {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	listeners := []listener{
+		{proxy, "tcp", c.Listen, nil},
+		{proxy, "unix", c.Unix, nil},
+		{adminAPI, "tcp", c.Admin, nil},
+	}
+	if c.TLS != nil {
+		listeners = append(listeners, listener{proxy, "tcp", c.TLS.Listen, tlsConfig})
+	}
+	n := 0
+	for _, l := range listeners {
+		if l.addr == "" {
+			continue
+		}
+		if _, err := l.s.Listen(l.network, l.addr, l.tls); err != nil {
+			return nil, nil, err
+		}
+		log.Printf("reverse-proxy: listening on %s %s", l.network, l.addr)
+		n++
+	}
+	activated, err := server.SystemdListeners()
+	if err != nil && !errors.Is(err, server.ErrNotActivated) {
+		return nil, nil, err
+	}
+	for name, lns := range activated {
+		for _, ln := range lns {
+			switch name {
+			case "admin":
+				adminAPI.AddSystemdListener(name, ln, nil)
+			case "https":
+				if tlsConfig == nil {
+					return nil, nil, errors.New("systemd socket https: no TLS certificate configured")
+				}
+				proxy.AddSystemdListener(name, ln, tlsConfig)
+			default:
+				proxy.AddSystemdListener(name, ln, nil)
+			}
+			log.Printf("reverse-proxy: listening on systemd socket %s (%s)", name, ln.Addr())
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, nil, errors.New("no listeners configured")
+	}
+	return proxy, adminAPI, nil
+}
+
+// shutdown gracefully shuts the servers down, waiting for the in-flight requests up to the timeout.
+func shutdown(timeout time.Duration, servers ...*server.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var errs []error
+	for _, s := range servers {
+		errs = append(errs, s.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, file, origin, rewrite string) {
+	config := "listen: \":0\"\nadmin: 127.0.0.1:0\nupstreams:\n  - url: " + origin + "\nroutes:\n  - methods: [GET]\n    path: /users\n    rewritePath: " + rewrite + "\n"
+	assert.NoError(t, os.WriteFile(file, []byte(config), 0o644))
+}
+
+func get(h http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestApp_Reload(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer origin.Close()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, origin.URL, "/v1/users")
+
+	a, c, err := newApp(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ":0", c.Listen)
+	assert.Equal(t, "127.0.0.1:0", c.Admin)
+	_, body := get(a.proxyHandler(), "/users")
+	assert.Equal(t, "/v1/users", body)
+	code, body := get(a.adminHandler(), "/routes")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "/v1/users")
+
+	writeConfig(t, file, origin.URL, "/v2/users")
+	assert.NoError(t, a.reload())
+	_, body = get(a.proxyHandler(), "/users")
+	assert.Equal(t, "/v2/users", body)
+
+	assert.NoError(t, os.WriteFile(file, []byte("routez: []"), 0o644))
+	assert.Error(t, a.reload())
+	_, body = get(a.proxyHandler(), "/users")
+	assert.Equal(t, "/v2/users", body)
+}
+
+func TestApp_ReloadSecrets(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Api-Key"))
+	}))
+	defer origin.Close()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	config := "listen: env://PROXY_LISTEN\nupstreams:\n  - url: " + origin.URL + "\nroutes: [{methods: [GET], path: /}]\nrequestHeader:\n  X-Api-Key: [env://PROXY_API_KEY]\n"
+	assert.NoError(t, os.WriteFile(file, []byte(config), 0o644))
+	t.Setenv("PROXY_LISTEN", ":0")
+	t.Setenv("PROXY_API_KEY", "first")
+
+	a, c, err := newApp(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ":0", c.Listen)
+	_, body := get(a.proxyHandler(), "/")
+	assert.Equal(t, "first", body)
+
+	// the secrets are resolved again on reload
+	t.Setenv("PROXY_API_KEY", "rotated")
+	assert.NoError(t, a.reload())
+	_, body = get(a.proxyHandler(), "/")
+	assert.Equal(t, "rotated", body)
+
+	assert.NoError(t, os.Unsetenv("PROXY_API_KEY"))
+	assert.Error(t, a.reload())
+	_, body = get(a.proxyHandler(), "/")
+	assert.Equal(t, "rotated", body)
+}
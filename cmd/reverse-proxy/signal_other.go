@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// upgradeSignals are the signals upgrading the process, none as the sockets can't be passed.
+var upgradeSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are the signals upgrading the process.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,130 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// coalescable reports whether the outbound request can share the response of an identical request:
+// it's a GET or HEAD request without a body and it's no protocol upgrade.
+func coalescable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return (r.Body == nil || r.Body == http.NoBody) && r.Header.Get("Upgrade") == ""
+}
+
+// flightGroup collapses the concurrent identical requests of a route into one upstream request.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is an upstream request shared by the identical requests received while it's pending.
+type flight struct {
+	done chan struct{}
+	// header is the header of the outbound request, matched against the Vary header of the response.
+	header  http.Header
+	backend *Backend
+	res     *http.Response
+	body    []byte
+	err     error
+	// shared reports whether the result can be passed to the waiting requests.
+	shared bool
+}
+
+// newFlightGroup creates an empty flight group.
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// flightKey returns the key of the identical requests: the method, the inbound host and URI, and the
+// credentials and range of the request. The headers named by the Vary header of the response are
+// compared once it's received.
+func flightKey(r *http.Request, x *exchange) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Header.Get("X-Forwarded-Host"))
+	b.WriteString(x.target.RequestURI())
+	for _, name := range []string{"Authorization", "Cookie", "Range"} {
+		for _, v := range r.Header.Values(name) {
+			b.WriteString("\n" + name + ": " + v)
+		}
+	}
+	return b.String()
+}
+
+// do sends the outbound request with send, unless an identical request is pending, whose response is
+// shared instead. The response of the leading request is read into memory within the limit, zero
+// meaning unlimited; larger responses are streamed to the leading request only.
+func (g *flightGroup) do(r *http.Request, x *exchange, limit int64, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	trace := TraceFromContext(r.Context())
+	key := flightKey(r, x)
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		if res, ok := f.result(r); ok {
+			trace.Add("coalesce", "shared")
+			x.backend = f.backend
+			return res, f.err
+		}
+		trace.Add("coalesce", "not shared")
+		return send(r)
+	}
+	f := &flight{done: make(chan struct{}), header: r.Header.Clone()}
+	g.flights[key] = f
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+
+	res, err := send(r)
+	f.backend = x.backend
+	if err != nil {
+		// a request canceled by its client says nothing about the upstream
+		f.err, f.shared = err, r.Context().Err() == nil
+		return nil, err
+	}
+	b, ok := readBody(res, limit)
+	if !ok {
+		return res, nil
+	}
+	shared := *res
+	shared.Header, shared.Trailer = res.Header.Clone(), res.Trailer.Clone()
+	f.res, f.body, f.shared = &shared, b, true
+	return res, nil
+}
+
+// result returns a copy of the response of the flight for the waiting request, if it's shared and the
+// request matches the headers named by the Vary header of the response. A shared error returns no response.
+func (f *flight) result(r *http.Request) (*http.Response, bool) {
+	if !f.shared || f.err != nil {
+		return nil, f.shared
+	}
+	for _, v := range f.res.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" || !slices.Equal(r.Header.Values(name), f.header.Values(name)) {
+				return nil, false
+			}
+		}
+	}
+	res := *f.res
+	res.Header, res.Trailer = f.res.Header.Clone(), f.res.Trailer.Clone()
+	res.Body = io.NopCloser(bytes.NewReader(f.body))
+	res.Request = r
+	return &res, true
+}
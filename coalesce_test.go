@@ -0,0 +1,78 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescing(t *testing.T) {
+	var hits atomic.Int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = io.WriteString(w, r.URL.RequestURI()+" "+r.Header.Get("Accept-Language")+" "+string('0'+rune(n)))
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/coalesced").SetCoalescing(true))
+	pm.PassPath("GET", "/plain")
+
+	tests := []struct {
+		name      string
+		target    string
+		languages []string
+		wantHits  int32
+	}{
+		{"Test identical requests", "/coalesced?q=1", []string{"en", "en", "en", "en"}, 1},
+		{"Test varying requests", "/coalesced?q=1", []string{"en", "en", "de"}, 2},
+		{"Test route without coalescing", "/plain", []string{"en", "en", "en"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			release = make(chan struct{})
+			bodies := make([]string, len(tt.languages))
+			var wg sync.WaitGroup
+			for i, lang := range tt.languages {
+				wg.Add(1)
+				go func(i int, lang string) {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					r := httptest.NewRequest("GET", tt.target, nil)
+					r.Header.Set("Accept-Language", lang)
+					pm.ServeHTTP(w, r)
+					assert.Equal(t, http.StatusOK, w.Code)
+					bodies[i] = w.Body.String()
+				}(i, lang)
+				if i == 0 {
+					// the first request leads the flight
+					<-arrived
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			for len(arrived) > 0 {
+				<-arrived
+			}
+			assert.Equal(t, tt.wantHits, hits.Load())
+			assert.Equal(t, tt.target+" en 1", bodies[0])
+			for i, lang := range tt.languages {
+				assert.Contains(t, bodies[i], tt.target+" "+lang+" ")
+			}
+		})
+	}
+}
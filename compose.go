@@ -0,0 +1,134 @@
+package reverseproxy
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// mount is a handler registered under a path prefix, e.g. a static file system or a nested mux.
+type mount interface {
+	register(router *httprouter.Router)
+}
+
+// mountMethods are the methods a nested mux is registered for.
+var mountMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	http.MethodOptions, http.MethodTrace,
+}
+
+// muxMount is a mux nested under a path prefix.
+type muxMount struct {
+	prefix  string
+	handler http.Handler
+}
+
+// register registers the nested mux for the prefix and the paths under it.
+func (m *muxMount) register(router *httprouter.Router) {
+	for _, method := range mountMethods {
+		router.Handler(method, m.prefix, m.handler)
+		router.Handler(method, m.prefix+"/*path", m.handler)
+	}
+}
+
+// Mount nests the sub mux under the path prefix, so gateways can be assembled from the muxes of
+// several teams. The sub mux serves the requests under the prefix with its own routes, middleware and
+// backends, receiving them with the prefix stripped as with MountedAt. Mounting at "/" makes the sub
+// mux the fallback for all requests not matched by another route. It panics if the prefix conflicts
+// with a registered route, or if the mux is frozen.
+func (pm *ReverseProxyMux) Mount(prefix string, sub *ReverseProxyMux) *ReverseProxyMux {
+	prefix = "/" + strings.Trim(prefix, "/")
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	if prefix == "/" {
+		pm.fallback = sub
+		if err := pm.swapRoutes(pm.routes); err != nil {
+			panic(err)
+		}
+		return pm
+	}
+	mounts := append(slices.Clone(pm.mounts), mount(&muxMount{prefix: prefix, handler: sub.MountedAt(prefix)}))
+	table, err := pm.buildTable(pm.routes, mounts)
+	if err != nil {
+		panic(err)
+	}
+	pm.mounts = mounts
+	pm.table.Store(table)
+	return pm
+}
+
+// Clone returns an unfrozen copy of the mux, e.g. to derive the mux of another listener with a few
+// differences. It copies the configuration fields, router options and hooks, routes, middleware,
+// response modifiers, director wrappers, upstream selector, mounts and health check settings. The backend pool is copied with fresh health checks and
+// latency averages. The metrics hooks, including the stats, and the nested muxes are shared, while the
+// maintenance mode and draining state aren't copied.
+func (pm *ReverseProxyMux) Clone() *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	c := newMux()
+	c.setFields(pm.fields())
+	c.RequestHeader = pm.RequestHeader.Clone()
+	c.routerOpts = pm.routerOpts
+	c.middleware = slices.Clone(pm.middleware)
+	if pm.groupMws != nil {
+		c.groupMws = make(map[string][]Middleware, len(pm.groupMws))
+		for group, mws := range pm.groupMws {
+			c.groupMws[group] = slices.Clone(mws)
+		}
+	}
+	c.modifiers = slices.Clone(pm.modifiers)
+	c.routerHooks = slices.Clone(pm.routerHooks)
+	if len(pm.directorWraps) > 0 {
+		c.directorWraps = slices.Clone(pm.directorWraps)
+		c.buildDirector()
+	}
+	c.selector.Store(pm.selector.Load())
+	c.metricsHooks.Store(pm.metricsHooks.Load())
+	c.stats = pm.stats
+	c.traceNets.Store(pm.traceNets.Load())
+
+	pm.healthMu.Lock()
+	c.healthCheck, c.healthPeriod = pm.healthCheck, pm.healthPeriod
+	c.healthOpts = slices.Clone(pm.healthOpts)
+	pm.healthMu.Unlock()
+	var backends []*Backend
+	for _, b := range pm.Backends() {
+		nb := c.newBackend(b.url)
+		nb.weight, nb.zone, nb.labels, nb.transport = b.weight, b.zone, maps.Clone(b.labels), b.transport
+		backends = append(backends, nb)
+	}
+	c.backends.Store(&backends)
+
+	c.fallback = pm.fallback
+	if h, ok := pm.fallback.(*staticHandler); ok {
+		c.fallback = c.rebindStatic(h)
+	}
+	for _, m := range pm.mounts {
+		if h, ok := m.(*staticHandler); ok {
+			m = c.rebindStatic(h)
+		}
+		c.mounts = append(c.mounts, m)
+	}
+	table, err := c.buildTable(pm.routes, c.mounts)
+	if err != nil {
+		// the routes were valid in pm, so they're valid in the copy
+		panic(err)
+	}
+	c.routes = slices.Clone(pm.routes)
+	c.table.Store(table)
+	return c
+}
+
+// rebindStatic returns a copy of the static handler answering missing files with the NotFound
+// handlers of the mux.
+func (pm *ReverseProxyMux) rebindStatic(h *staticHandler) *staticHandler {
+	c := *h
+	c.notFound = pm.notFound
+	return &c
+}
@@ -0,0 +1,96 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newNamedOrigin starts an origin answering its name, the request path and the forwarded prefix.
+func newNamedOrigin(t *testing.T, name string) *httptest.Server {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name+" "+r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Forwarded-Prefix"))
+	}))
+	t.Cleanup(origin.Close)
+	return origin
+}
+
+func TestMount(t *testing.T) {
+	gateway, err := New(newNamedOrigin(t, "gateway").URL)
+	assert.NoError(t, err)
+	orders, err := New(newNamedOrigin(t, "orders").URL)
+	assert.NoError(t, err)
+	web, err := New(newNamedOrigin(t, "web").URL)
+	assert.NoError(t, err)
+	orders.PassPath("GET|POST", "/").PassPath("GET", "/:id")
+	web.PassAnyPath("GET")
+	gateway.PassPath("GET", "/health")
+	gateway.Mount("/orders/", orders).Mount("/", web)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test gateway route", "GET", "/health", http.StatusOK, "gateway GET /health "},
+		{"Test mounted prefix", "POST", "/orders", http.StatusOK, "orders POST / /orders"},
+		{"Test mounted route", "GET", "/orders/42", http.StatusOK, "orders GET /42 /orders"},
+		{"Test mounted not found", "GET", "/orders/42/items", http.StatusNotFound, ""},
+		{"Test mounted method not allowed", "DELETE", "/orders/42", http.StatusMethodNotAllowed, ""},
+		{"Test fallback", "GET", "/index.html", http.StatusOK, "web GET /index.html "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(gateway, tt.method, tt.target)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	assert.Panics(t, func() {
+		gateway.Mount("/health", orders)
+	}, "conflicting prefixes should be rejected")
+}
+
+func TestClone(t *testing.T) {
+	pm, dir := newStaticTestMux(t)
+	other := newNamedOrigin(t, "other")
+	_, err := pm.AddBackend(other.URL, BackendWeight(3))
+	assert.NoError(t, err)
+	pm.Via = "gateway"
+	pm.Use(tag("a"))
+	pm.UseGroup("admin", tag("auth"))
+	pm.AppendModifier(chainModifier("mux-1"))
+	pm.HandlePath(NewRoute("GET", "/admin").SetGroup("admin"))
+	pm.ServeStatic("/assets", dir)
+	pm.Freeze()
+
+	c := pm.Clone()
+	assert.False(t, c.IsFrozen())
+	assert.Equal(t, "gateway", c.Via)
+	assert.Equal(t, pm.Routes(), c.Routes())
+	assert.Len(t, c.Backends(), 2)
+	assert.NotSame(t, pm.Backends()[1], c.Backends()[1])
+	assert.Equal(t, 3, c.Backends()[1].Weight())
+	assert.Equal(t, "app", serve(c, "GET", "/assets/app.js").Body.String())
+
+	c.UseGroup("admin", tag("audit"))
+	c.NotFoundHandler = text("clone")
+	c.PassPath("GET", "/users")
+	c.Via = "clone"
+	w := serve(c, "GET", "/admin")
+	assert.Contains(t, []string{"origin /admin", "other GET /admin "}, w.Body.String())
+	assert.Equal(t, "mux-1", w.Header().Get("X-Modifiers"))
+	assert.Equal(t, "clone", serve(c, "GET", "/assets/missing.js").Body.String(), "static mounts should use the NotFoundHandler of the clone")
+
+	assert.Equal(t, http.StatusNotFound, serve(pm, "GET", "/users").Code, "the original should be unchanged")
+	assert.Equal(t, "gateway", pm.Via)
+	assert.NotEqual(t, "clone", serve(pm, "GET", "/assets/missing.js").Body.String())
+}
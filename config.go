@@ -0,0 +1,563 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/health"
+	"github.com/open-webtech/go-reverse-proxy/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative configuration of a mux: its routes, rewrites, headers, upstreams and
+// health check settings, see ConfigSnapshot. The callbacks, e.g. the ModifyResponse of a route, can't
+// be serialized, so they're reported by name in the Hooks of their route. The durations are formatted
+// like time.Duration.String.
+type Config struct {
+	Router               RouterConfig          `json:"router" yaml:"router"`
+	RequestHeader        http.Header           `json:"requestHeader,omitempty" yaml:"requestHeader,omitempty"`
+	ResponseHeaderPolicy *HeaderPolicyConfig   `json:"responseHeaderPolicy,omitempty" yaml:"responseHeaderPolicy,omitempty"`
+	Via                  string                `json:"via,omitempty" yaml:"via,omitempty"`
+	UpstreamTimeout      string                `json:"upstreamTimeout,omitempty" yaml:"upstreamTimeout,omitempty"`
+	MaxBufferedResponse  int64                 `json:"maxBufferedResponse,omitempty" yaml:"maxBufferedResponse,omitempty"`
+	MaxBufferedRequest   int64                 `json:"maxBufferedRequest,omitempty" yaml:"maxBufferedRequest,omitempty"`
+	StatusRewrites       []StatusRewriteConfig `json:"statusRewrites,omitempty" yaml:"statusRewrites,omitempty"`
+	ConnectAllow         []string              `json:"connectAllow,omitempty" yaml:"connectAllow,omitempty"`
+	Health               HealthConfig          `json:"health" yaml:"health"`
+	Upstreams            []UpstreamConfig      `json:"upstreams" yaml:"upstreams"`
+	Routes               []RouteConfig         `json:"routes" yaml:"routes"`
+}
+
+// RouterConfig is the configuration of the router, see RouterOptions.
+type RouterConfig struct {
+	RedirectTrailingSlash bool `json:"redirectTrailingSlash" yaml:"redirectTrailingSlash"`
+	RedirectFixedPath     bool `json:"redirectFixedPath" yaml:"redirectFixedPath"`
+	CaseInsensitive       bool `json:"caseInsensitive" yaml:"caseInsensitive"`
+	ForwardOPTIONS        bool `json:"forwardOPTIONS" yaml:"forwardOPTIONS"`
+}
+
+// HeaderPolicyConfig is the configuration of a HeaderPolicy.
+type HeaderPolicyConfig struct {
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// StatusRewriteConfig is the configuration of a StatusRewrite.
+type StatusRewriteConfig struct {
+	From        int  `json:"from" yaml:"from"`
+	To          int  `json:"to" yaml:"to"`
+	DiscardBody bool `json:"discardBody,omitempty" yaml:"discardBody,omitempty"`
+}
+
+// HealthConfig is the configuration of the health checks of the upstreams. CustomCheck reports
+// whether a check func is set, see SetHealthCheckFunc.
+type HealthConfig struct {
+	CustomCheck      bool    `json:"customCheck,omitempty" yaml:"customCheck,omitempty"`
+	Period           string  `json:"period,omitempty" yaml:"period,omitempty"`
+	FailureThreshold int     `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+	SuccessThreshold int     `json:"successThreshold,omitempty" yaml:"successThreshold,omitempty"`
+	Jitter           float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	InitialDelay     string  `json:"initialDelay,omitempty" yaml:"initialDelay,omitempty"`
+}
+
+// UpstreamConfig is the configuration of a backend of the pool. The runtime state of the backend,
+// e.g. its availability, isn't part of the configuration.
+type UpstreamConfig struct {
+	URL    string            `json:"url" yaml:"url"`
+	Weight int               `json:"weight" yaml:"weight"`
+	Zone   string            `json:"zone,omitempty" yaml:"zone,omitempty"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// RouteConfig is the configuration of a route. The modes are reported by name, omitted if they're
+// the default.
+type RouteConfig struct {
+	Methods            []string              `json:"methods" yaml:"methods"`
+	Path               string                `json:"path" yaml:"path"`
+	Group              string                `json:"group,omitempty" yaml:"group,omitempty"`
+	RewritePath        string                `json:"rewritePath,omitempty" yaml:"rewritePath,omitempty"`
+	RewriteRegex       string                `json:"rewriteRegex,omitempty" yaml:"rewriteRegex,omitempty"`
+	RewriteReplacement string                `json:"rewriteReplacement,omitempty" yaml:"rewriteReplacement,omitempty"`
+	Rewrites           []RewriteConfig       `json:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	Prefix             string                `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	UpstreamPrefix     string                `json:"upstreamPrefix,omitempty" yaml:"upstreamPrefix,omitempty"`
+	HostMode           string                `json:"hostMode,omitempty" yaml:"hostMode,omitempty"`
+	Host               string                `json:"host,omitempty" yaml:"host,omitempty"`
+	RequestHeader      http.Header           `json:"requestHeader,omitempty" yaml:"requestHeader,omitempty"`
+	ResponseHeaders    *HeaderPolicyConfig   `json:"responseHeaders,omitempty" yaml:"responseHeaders,omitempty"`
+	StatusRewrites     []StatusRewriteConfig `json:"statusRewrites,omitempty" yaml:"statusRewrites,omitempty"`
+	Buffering          string                `json:"buffering,omitempty" yaml:"buffering,omitempty"`
+	Expect             string                `json:"expect,omitempty" yaml:"expect,omitempty"`
+	ETag               string                `json:"etag,omitempty" yaml:"etag,omitempty"`
+	HedgeDelay         string                `json:"hedgeDelay,omitempty" yaml:"hedgeDelay,omitempty"`
+	Priority           int                   `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Queue              *QueueConfig          `json:"queue,omitempty" yaml:"queue,omitempty"`
+	Cache              *CacheConfig          `json:"cache,omitempty" yaml:"cache,omitempty"`
+	Coalesce           bool                  `json:"coalesce,omitempty" yaml:"coalesce,omitempty"`
+	Decompression      bool                  `json:"decompression,omitempty" yaml:"decompression,omitempty"`
+	Hooks              []string              `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+}
+
+// RewriteConfig is the configuration of a RewriteRule.
+type RewriteConfig struct {
+	Target      string `json:"target" yaml:"target"`
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+	Continue    bool   `json:"continue,omitempty" yaml:"continue,omitempty"`
+}
+
+// QueueConfig is the configuration of a Queue.
+type QueueConfig struct {
+	MaxInFlight int    `json:"maxInFlight" yaml:"maxInFlight"`
+	Depth       int    `json:"depth,omitempty" yaml:"depth,omitempty"`
+	MaxWait     string `json:"maxWait,omitempty" yaml:"maxWait,omitempty"`
+	RetryAfter  string `json:"retryAfter,omitempty" yaml:"retryAfter,omitempty"`
+}
+
+// CacheConfig is the configuration of a Cache, the store isn't part of it.
+type CacheConfig struct {
+	TTL                  string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	StaleWhileRevalidate string `json:"staleWhileRevalidate,omitempty" yaml:"staleWhileRevalidate,omitempty"`
+	StaleIfError         string `json:"staleIfError,omitempty" yaml:"staleIfError,omitempty"`
+}
+
+// JSON returns the indented JSON document of the configuration.
+func (c Config) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// YAML returns the YAML document of the configuration.
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// ConfigSnapshot returns the current configuration of the mux, which can be serialized to a JSON or
+// YAML document, e.g. to compare it with the desired configuration and detect drift. The exported
+// fields are read like the requests read them, so they're the fields of the last Build, if any.
+func (pm *ReverseProxyMux) ConfigSnapshot() Config {
+	s := pm.current()
+	c := Config{
+		RequestHeader:        s.RequestHeader.Clone(),
+		ResponseHeaderPolicy: headerPolicyConfig(s.ResponseHeaderPolicy),
+		Via:                  s.Via,
+		UpstreamTimeout:      formatDuration(s.UpstreamTimeout),
+		MaxBufferedResponse:  s.MaxBufferedResponse,
+		MaxBufferedRequest:   s.MaxBufferedRequest,
+		StatusRewrites:       statusRewriteConfigs(s.StatusRewrites),
+		Upstreams:            []UpstreamConfig{},
+		Routes:               []RouteConfig{},
+	}
+	if s.Connect != nil {
+		c.ConnectAllow = append([]string(nil), s.Connect.Allow...)
+	}
+	opts := pm.RouterOptions()
+	c.Router = RouterConfig(opts)
+
+	backends := pm.Backends()
+	pm.healthMu.Lock()
+	c.Health.CustomCheck = pm.healthCheck != nil
+	pm.healthMu.Unlock()
+	if len(backends) > 0 {
+		hs := backends[0].health.Settings()
+		c.Health.Period = formatDuration(hs.Period)
+		c.Health.FailureThreshold = hs.FailureThreshold
+		c.Health.SuccessThreshold = hs.SuccessThreshold
+		c.Health.Jitter = hs.Jitter
+		c.Health.InitialDelay = formatDuration(hs.InitialDelay)
+	}
+	for _, b := range backends {
+		c.Upstreams = append(c.Upstreams, UpstreamConfig{
+			URL:    b.url.String(),
+			Weight: b.weight,
+			Zone:   b.zone,
+			Labels: b.Labels(),
+		})
+	}
+	for _, route := range pm.Routes() {
+		c.Routes = append(c.Routes, routeConfig(route))
+	}
+	return c
+}
+
+// routeConfig returns the configuration of the route.
+func routeConfig(route Route) RouteConfig {
+	c := RouteConfig{
+		Methods:            route.Method,
+		Path:               route.Path,
+		Group:              route.Group,
+		RewritePath:        route.RewritePath,
+		RewriteRegex:       route.RewriteRegex,
+		RewriteReplacement: route.RewriteReplacement,
+		Prefix:             route.Prefix,
+		UpstreamPrefix:     route.UpstreamPrefix,
+		HostMode:           hostModeNames[route.HostMode],
+		Host:               route.Host,
+		RequestHeader:      route.RequestHeader.Clone(),
+		ResponseHeaders:    headerPolicyConfig(route.ResponseHeaders),
+		StatusRewrites:     statusRewriteConfigs(route.StatusRewrites),
+		Buffering:          bufferingModeNames[route.Buffering],
+		Expect:             expectModeNames[route.Expect],
+		ETag:               etagModeNames[route.ETag],
+		HedgeDelay:         formatDuration(route.HedgeDelay),
+		Priority:           route.Priority,
+		Coalesce:           route.Coalesce,
+		Decompression:      route.Decompression != nil,
+	}
+	for _, rule := range route.Rewrites {
+		c.Rewrites = append(c.Rewrites, RewriteConfig{
+			Target:      rule.Target.String(),
+			Pattern:     rule.Pattern,
+			Replacement: rule.Replacement,
+			Continue:    rule.Continue,
+		})
+	}
+	if q := route.Queue; q != nil {
+		c.Queue = &QueueConfig{
+			MaxInFlight: q.MaxInFlight,
+			Depth:       q.Depth,
+			MaxWait:     formatDuration(q.MaxWait),
+			RetryAfter:  formatDuration(q.RetryAfter),
+		}
+	}
+	if cache := route.Cache; cache != nil {
+		c.Cache = &CacheConfig{
+			TTL:                  formatDuration(cache.TTL),
+			StaleWhileRevalidate: formatDuration(cache.StaleWhileRevalidate),
+			StaleIfError:         formatDuration(cache.StaleIfError),
+		}
+	}
+	hooks := []struct {
+		name string
+		set  bool
+	}{
+		{"modifyRequest", route.ModifyRequest != nil},
+		{"modifyResponse", route.ModifyResponse != nil},
+		{"modifiers", len(route.Modifiers) > 0},
+		{"modifyTrailer", route.ModifyTrailer != nil},
+		{"director", route.Director != nil},
+		{"signer", route.Signer != nil},
+		{"transport", route.Transport != nil},
+		{"tls", route.TLS != nil},
+		{"stub", route.Stub != nil},
+		{"idempotency", route.Idempotency != nil},
+		{"upload", route.Upload != nil},
+		{"quota", route.Quota != nil},
+		{"notFound", route.NotFound != nil},
+		{"methodNotAllowed", route.MethodNotAllowed != nil},
+	}
+	for _, hook := range hooks {
+		if hook.set {
+			c.Hooks = append(c.Hooks, hook.name)
+		}
+	}
+	return c
+}
+
+var (
+	hostModeNames = map[HostMode]string{
+		HostPreserve: "preserve",
+		HostCustom:   "custom",
+	}
+	bufferingModeNames = map[BufferingMode]string{
+		BufferingEnabled:  "enabled",
+		BufferingDisabled: "disabled",
+	}
+	expectModeNames = map[ExpectMode]string{
+		ExpectStrip:  "strip",
+		ExpectBuffer: "buffer",
+	}
+	etagModeNames = map[ETagMode]string{
+		ETagStrong: "strong",
+		ETagWeak:   "weak",
+	}
+)
+
+// headerPolicyConfig returns the configuration of the header policy, or nil.
+func headerPolicyConfig(p *HeaderPolicy) *HeaderPolicyConfig {
+	if p == nil {
+		return nil
+	}
+	return &HeaderPolicyConfig{Allow: p.Allow, Deny: p.Deny}
+}
+
+// statusRewriteConfigs returns the configurations of the status rewrites.
+func statusRewriteConfigs(rules []StatusRewrite) []StatusRewriteConfig {
+	var configs []StatusRewriteConfig
+	for _, rule := range rules {
+		configs = append(configs, StatusRewriteConfig(rule))
+	}
+	return configs
+}
+
+// formatDuration formats the duration, or returns an empty string if it's zero.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// ParseConfig parses a JSON or YAML configuration document, see Config. Unknown fields are rejected,
+// so misspelled settings aren't silently ignored.
+func ParseConfig(data []byte) (Config, error) {
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// LoadConfigFile reads and parses the JSON or YAML configuration file, see ParseConfig.
+func LoadConfigFile(name string) (Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(data)
+}
+
+// NewFromConfig creates a mux of the configuration, applying the options in order afterwards. The
+// first upstream is the proxy origin passed to New. The secret references of the configuration, e.g.
+// env://API_KEY, are resolved, see the secrets package. The Hooks of the routes and the CustomCheck of
+// the health settings are ignored, the callbacks can be set by the options. An error is returned if the
+// configuration is invalid.
+func NewFromConfig(c Config, opts ...Option) (*ReverseProxyMux, error) {
+	if len(c.Upstreams) == 0 {
+		return nil, errors.New("invalid config: no upstreams")
+	}
+	c, err := resolveSecrets(c)
+	if err != nil {
+		return nil, err
+	}
+	pm, err := New(c.Upstreams[0].URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := pm.applyConfig(c); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(pm); err != nil {
+			return nil, err
+		}
+	}
+	if pm.freezeOnNew {
+		pm.Freeze()
+	}
+	return pm, nil
+}
+
+// resolveSecrets returns a copy of the configuration with its secret references resolved. The copy
+// doesn't share the slices and maps of c, which stays unchanged, so its references are resolved again
+// on every call and the secrets rotate with the mux built of it.
+func resolveSecrets(c Config) (Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return Config{}, err
+	}
+	var resolved Config
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return Config{}, err
+	}
+	if err := secrets.NewResolver().ResolveAll(context.Background(), &resolved); err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return resolved, nil
+}
+
+// applyConfig applies the configuration to the new mux of its first upstream.
+func (pm *ReverseProxyMux) applyConfig(c Config) error {
+	var err error
+	if pm.UpstreamTimeout, err = parseDuration(c.UpstreamTimeout); err != nil {
+		return err
+	}
+	pm.RequestHeader = c.RequestHeader
+	pm.ResponseHeaderPolicy = c.ResponseHeaderPolicy.policy()
+	pm.Via = c.Via
+	pm.MaxBufferedResponse = c.MaxBufferedResponse
+	pm.MaxBufferedRequest = c.MaxBufferedRequest
+	pm.StatusRewrites = statusRewrites(c.StatusRewrites)
+	if len(c.ConnectAllow) > 0 {
+		pm.Connect = &ConnectTunnel{Allow: c.ConnectAllow}
+	}
+	if err := pm.SetRouterOptions(RouterOptions(c.Router)); err != nil {
+		return err
+	}
+
+	hopts, err := c.Health.options()
+	if err != nil {
+		return err
+	}
+	pm.SetHealthCheckOptions(hopts...)
+	first := pm.Backends()[0]
+	first.weight, first.zone, first.labels = max(c.Upstreams[0].Weight, 1), c.Upstreams[0].Zone, c.Upstreams[0].Labels
+	for _, u := range c.Upstreams[1:] {
+		if _, err := pm.AddBackend(u.URL, BackendWeight(u.Weight), BackendZone(u.Zone), BackendLabels(u.Labels)); err != nil {
+			return err
+		}
+	}
+
+	for _, rc := range c.Routes {
+		route, err := rc.route()
+		if err != nil {
+			return fmt.Errorf("invalid route %s: %w", rc.Path, err)
+		}
+		if err := pm.AddRoute(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// options returns the health check options of the settings.
+func (c HealthConfig) options() ([]health.Option, error) {
+	period, err := parseDuration(c.Period)
+	if err != nil {
+		return nil, err
+	}
+	delay, err := parseDuration(c.InitialDelay)
+	if err != nil {
+		return nil, err
+	}
+	opts := []health.Option{health.Period(period), health.Jitter(c.Jitter), health.InitialDelay(delay)}
+	if c.FailureThreshold > 0 {
+		opts = append(opts, health.FailureThreshold(c.FailureThreshold))
+	}
+	if c.SuccessThreshold > 0 {
+		opts = append(opts, health.SuccessThreshold(c.SuccessThreshold))
+	}
+	return opts, nil
+}
+
+// route returns the route of the configuration.
+func (c RouteConfig) route() (Route, error) {
+	route := Route{
+		Method:             c.Methods,
+		Path:               c.Path,
+		Group:              c.Group,
+		RewritePath:        c.RewritePath,
+		RewriteRegex:       c.RewriteRegex,
+		RewriteReplacement: c.RewriteReplacement,
+		Prefix:             c.Prefix,
+		UpstreamPrefix:     c.UpstreamPrefix,
+		Host:               c.Host,
+		RequestHeader:      c.RequestHeader,
+		ResponseHeaders:    c.ResponseHeaders.policy(),
+		StatusRewrites:     statusRewrites(c.StatusRewrites),
+		Priority:           c.Priority,
+		Coalesce:           c.Coalesce,
+	}
+	if len(route.Method) == 0 {
+		route.Method = methodStringToSlice("*")
+	}
+	var err error
+	if route.HostMode, err = parseMode(hostModeNames, "upstream", c.HostMode); err != nil {
+		return Route{}, err
+	}
+	if route.Buffering, err = parseMode(bufferingModeNames, "default", c.Buffering); err != nil {
+		return Route{}, err
+	}
+	if route.Expect, err = parseMode(expectModeNames, "forward", c.Expect); err != nil {
+		return Route{}, err
+	}
+	if route.ETag, err = parseMode(etagModeNames, "none", c.ETag); err != nil {
+		return Route{}, err
+	}
+	if route.HedgeDelay, err = parseDuration(c.HedgeDelay); err != nil {
+		return Route{}, err
+	}
+	if c.Decompression {
+		route.Decompression = &Decompression{}
+	}
+	for _, rc := range c.Rewrites {
+		target, err := parseMode(rewriteTargetNames, "path", rc.Target)
+		if err != nil {
+			return Route{}, err
+		}
+		route.Rewrites = append(route.Rewrites, RewriteRule{
+			Target:      target,
+			Pattern:     rc.Pattern,
+			Replacement: rc.Replacement,
+			Continue:    rc.Continue,
+		})
+	}
+	if q := c.Queue; q != nil {
+		queue := Queue{MaxInFlight: q.MaxInFlight, Depth: q.Depth}
+		if queue.MaxWait, err = parseDuration(q.MaxWait); err != nil {
+			return Route{}, err
+		}
+		if queue.RetryAfter, err = parseDuration(q.RetryAfter); err != nil {
+			return Route{}, err
+		}
+		route = route.SetQueue(queue)
+	}
+	if cc := c.Cache; cc != nil {
+		var cache Cache
+		if cache.TTL, err = parseDuration(cc.TTL); err != nil {
+			return Route{}, err
+		}
+		if cache.StaleWhileRevalidate, err = parseDuration(cc.StaleWhileRevalidate); err != nil {
+			return Route{}, err
+		}
+		if cache.StaleIfError, err = parseDuration(cc.StaleIfError); err != nil {
+			return Route{}, err
+		}
+		route = route.SetCache(cache)
+	}
+	return route, nil
+}
+
+// rewriteTargetNames are the names of the rewrite targets, the path being the default.
+var rewriteTargetNames = map[RewriteTarget]string{
+	RewriteTargetQuery: "query",
+	RewriteTargetHost:  "host",
+}
+
+// parseMode returns the mode of the name, or the default zero mode if the name is empty or the
+// default name. An error is returned if the name is unknown.
+func parseMode[M comparable](names map[M]string, defaultName, name string) (M, error) {
+	var zero M
+	if name == "" || name == defaultName {
+		return zero, nil
+	}
+	for mode, n := range names {
+		if n == name {
+			return mode, nil
+		}
+	}
+	return zero, fmt.Errorf("unknown mode %q", name)
+}
+
+// policy returns the header policy of the configuration, or nil.
+func (c *HeaderPolicyConfig) policy() *HeaderPolicy {
+	if c == nil {
+		return nil
+	}
+	return &HeaderPolicy{Allow: c.Allow, Deny: c.Deny}
+}
+
+// statusRewrites returns the status rewrites of the configurations.
+func statusRewrites(configs []StatusRewriteConfig) []StatusRewrite {
+	var rules []StatusRewrite
+	for _, c := range configs {
+		rules = append(rules, StatusRewrite(c))
+	}
+	return rules
+}
+
+// parseDuration parses the duration, zero if the string is empty.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,172 @@
+package reverseproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/health"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigSnapshot(t *testing.T) {
+	pm := newTableTestMux(t)
+	origin := pm.Backends()[0].URL().String()
+	_, err := pm.AddBackend("http://127.0.0.1:1", BackendWeight(2), BackendZone("eu"), BackendLabels(map[string]string{"tier": "canary"}))
+	assert.NoError(t, err)
+	pm.SetHealthCheckFunc(func(*url.URL) bool { return true }, time.Minute)
+	pm.SetHealthCheckOptions(health.FailureThreshold(3))
+	pm.RequestHeader = http.Header{"X-Proxy": {"a"}}
+	pm.Via = "edge"
+	pm.UpstreamTimeout = 5 * time.Second
+	pm.StatusRewrites = []StatusRewrite{{From: 500, To: 502, DiscardBody: true}}
+	assert.NoError(t, pm.AddRoute(NewRoute("GET|POST", "/users/:id").
+		SetRewritePath("/v1/users/:id").
+		SetRequestHeader(http.Header{"X-Route": {"users"}}).
+		SetBuffering(true).
+		SetHedging(50*time.Millisecond).
+		SetCache(Cache{TTL: time.Minute}).
+		SetModifyResponse(func(*http.Response) error { return nil })))
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/search").
+		AddRewrite(RewriteRule{Target: RewriteTargetQuery, Pattern: "^q=", Replacement: "query="}).
+		SetPreserveHost(true)))
+
+	assert.Equal(t, Config{
+		Router:          RouterConfig{RedirectTrailingSlash: true, RedirectFixedPath: true},
+		RequestHeader:   http.Header{"X-Proxy": {"a"}},
+		Via:             "edge",
+		UpstreamTimeout: "5s",
+		StatusRewrites:  []StatusRewriteConfig{{From: 500, To: 502, DiscardBody: true}},
+		Health: HealthConfig{
+			CustomCheck:      true,
+			Period:           "1m0s",
+			FailureThreshold: 3,
+			SuccessThreshold: 1,
+		},
+		Upstreams: []UpstreamConfig{
+			{URL: origin, Weight: 1},
+			{URL: "http://127.0.0.1:1", Weight: 2, Zone: "eu", Labels: map[string]string{"tier": "canary"}},
+		},
+		Routes: []RouteConfig{
+			{
+				Methods:       []string{"GET", "POST"},
+				Path:          "/users/:id",
+				RewritePath:   "/v1/users/:id",
+				RequestHeader: http.Header{"X-Route": {"users"}},
+				Buffering:     "enabled",
+				HedgeDelay:    "50ms",
+				Cache:         &CacheConfig{TTL: "1m0s"},
+				Hooks:         []string{"modifyResponse"},
+			},
+			{
+				Methods:  []string{"GET"},
+				Path:     "/search",
+				Rewrites: []RewriteConfig{{Target: "query", Pattern: "^q=", Replacement: "query="}},
+				HostMode: "preserve",
+			},
+		},
+	}, pm.ConfigSnapshot())
+}
+
+func TestConfig_Marshal(t *testing.T) {
+	pm := newTableTestMux(t)
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/users").SetRewritePath("/v1/users")))
+	c := pm.ConfigSnapshot()
+
+	tests := []struct {
+		name      string
+		marshal   func() ([]byte, error)
+		unmarshal func([]byte, any) error
+	}{
+		{"Test JSON", c.JSON, json.Unmarshal},
+		{"Test YAML", c.YAML, yaml.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.marshal()
+			assert.NoError(t, err)
+			assert.Contains(t, string(data), "rewritePath")
+			var decoded Config
+			assert.NoError(t, tt.unmarshal(data, &decoded))
+			assert.Equal(t, c, decoded)
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	origin := newTableTestMux(t).Remote().String()
+	c, err := ParseConfig([]byte(`
+upstreams:
+  - url: ` + origin + `
+  - url: http://127.0.0.1:1
+    weight: 2
+    zone: eu
+health:
+  period: 1m
+  failureThreshold: 3
+via: edge
+routes:
+  - methods: [GET]
+    path: /users/:id
+    rewritePath: /v1/users/:id
+    buffering: enabled
+  - methods: [GET]
+    path: /search
+    hostMode: preserve
+    rewrites:
+      - target: query
+        pattern: ^q=
+        replacement: query=
+`))
+	assert.NoError(t, err)
+	pm, err := NewFromConfig(c)
+	assert.NoError(t, err)
+
+	snapshot := pm.ConfigSnapshot()
+	assert.Equal(t, "edge", snapshot.Via)
+	assert.Equal(t, HealthConfig{Period: "1m0s", FailureThreshold: 3, SuccessThreshold: 1}, snapshot.Health)
+	assert.Equal(t, []UpstreamConfig{{URL: origin, Weight: 1}, {URL: "http://127.0.0.1:1", Weight: 2, Zone: "eu"}}, snapshot.Upstreams)
+	assert.Equal(t, c.Routes, snapshot.Routes)
+
+	m, err := pm.Match("GET", "/users/42", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/users/42", m.URL.Path)
+}
+
+func TestNewFromConfig_Secrets(t *testing.T) {
+	t.Setenv("PROXY_VIA", "edge")
+	c, err := ParseConfig([]byte("upstreams: [{url: http://a}]\nvia: env://PROXY_VIA\nrequestHeader: {X-Env: [env://PROXY_VIA]}"))
+	assert.NoError(t, err)
+	pm, err := NewFromConfig(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "edge", pm.ConfigSnapshot().Via)
+	assert.Equal(t, "env://PROXY_VIA", c.RequestHeader.Get("X-Env"), "the config should be left unchanged")
+
+	_, err = NewFromConfig(Config{Upstreams: []UpstreamConfig{{URL: "http://a"}}, Via: "env://PROXY_MISSING"})
+	assert.Error(t, err)
+}
+
+func TestNewFromConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"Test unknown field", "upstreams: [{url: http://a}]\nroutez: []"},
+		{"Test no upstreams", "routes: []"},
+		{"Test unknown mode", "upstreams: [{url: http://a}]\nroutes: [{path: /a, buffering: always}]"},
+		{"Test invalid duration", "upstreams: [{url: http://a}]\nupstreamTimeout: soon"},
+		{"Test conflicting routes", "upstreams: [{url: http://a}]\nroutes: [{path: /a/:x}, {path: /a/:y}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig([]byte(tt.config))
+			if err == nil {
+				_, err = NewFromConfig(c)
+			}
+			assert.Error(t, err)
+		})
+	}
+}
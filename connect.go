@@ -0,0 +1,208 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectGroup is the route group of the tunneled CONNECT requests, so middleware registered with
+// UseGroup, e.g. proxy authentication, applies only to the tunnels.
+const ConnectGroup = "connect"
+
+// DefaultConnectIdleTimeout is the time a CONNECT tunnel is kept open without data, if not set.
+const DefaultConnectIdleTimeout = 5 * time.Minute
+
+// ConnectTunnel configures the tunneling of CONNECT requests, relaying arbitrary TCP between the client
+// and the destinations of an ACL. HTTP/1.1 connections are hijacked for the tunnel, HTTP/2 tunnels are
+// carried by the stream of the request. The tunneled requests pass the middleware registered with Use
+// and with UseGroup for the ConnectGroup. Without a ConnectTunnel, CONNECT requests are routed like the
+// requests of other methods.
+type ConnectTunnel struct {
+	// Allow lists the permitted destinations as host:port patterns. The host is a name, a wildcard
+	// such as *.example.com matching the subdomains, an IP address, a CIDR prefix such as 10.0.0.0/8
+	// matching the IP address destinations, or * for any host; the port may be * for any port. Names
+	// are matched as requested, before they're resolved. Other destinations are answered with HTTP 403
+	// forbidden.
+	Allow []string
+	// Dial connects to the destinations, a net.Dialer with a 30 second timeout if nil. Destinations
+	// which can't be connected are answered with HTTP 502 bad gateway.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// IdleTimeout closes the tunnels without data in either direction for the duration, and the
+	// tunnels whose peer doesn't read the relayed data for the duration, DefaultConnectIdleTimeout if
+	// zero.
+	IdleTimeout time.Duration
+}
+
+// Allowed returns whether the ACL permits tunneling to the host:port address.
+func (ct *ConnectTunnel) Allowed(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range ct.Allow {
+		ph, pp, err := net.SplitHostPort(pattern)
+		if err != nil || (pp != "*" && pp != port) {
+			continue
+		}
+		if matchConnectHost(ph, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchConnectHost returns whether the host matches the host pattern of an ACL entry.
+func matchConnectHost(pattern, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if prefix, err := netip.ParsePrefix(pattern); err == nil {
+		ip, err := netip.ParseAddr(host)
+		return err == nil && prefix.Contains(ip.Unmap())
+	}
+	if ip, err := netip.ParseAddr(pattern); err == nil {
+		hostIP, err := netip.ParseAddr(host)
+		return err == nil && ip.Unmap() == hostIP.Unmap()
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+// serveConnect tunnels the CONNECT request to its destination, or routes it if the tunneling was
+// disabled meanwhile.
+func (pm *ReverseProxyMux) serveConnect(w http.ResponseWriter, r *http.Request) {
+	ct := pm.current().Connect
+	if ct == nil {
+		pm.table.Load().router.ServeHTTP(w, r)
+		return
+	}
+	trace := TraceFromContext(r.Context())
+	addr := r.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		trace.Add("connect", "invalid destination "+addr)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !ct.Allowed(addr) {
+		trace.Add("connect", "denied "+addr)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	dial := ct.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+	}
+	upstream, err := dial(r.Context(), "tcp", addr)
+	if err != nil {
+		trace.Add("connect", "error: "+err.Error())
+		pm.logf("%s: %v", describeRequest(r), err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+	trace.Add("connect", addr)
+	t := &tunnel{idle: ct.IdleTimeout}
+	if t.idle <= 0 {
+		t.idle = DefaultConnectIdleTimeout
+	}
+
+	rc := http.NewResponseController(w)
+	conn, brw, err := rc.Hijack()
+	if err == nil {
+		defer conn.Close()
+		if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+			return
+		}
+		// data sent by the client after the request may already be buffered
+		if n := brw.Reader.Buffered(); n > 0 {
+			b, _ := brw.Reader.Peek(n)
+			if _, err := upstream.Write(b); err != nil {
+				return
+			}
+		}
+		t.pipe(conn, upstream)
+		return
+	}
+	if r.ProtoMajor < 2 {
+		pm.logf("%s: %v", describeRequest(r), err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// The HTTP/2 stream carries the tunnel. The client resetting it closes the upstream connection,
+	// the upstream closing it ends the stream, as the response can't be half-closed before the handler
+	// returns. The deadlines of the stream are set by the response controller.
+	stop := context.AfterFunc(r.Context(), func() { upstream.Close() })
+	defer stop()
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+	go func() {
+		_ = t.copy(upstream, r.Body, rc.SetReadDeadline, upstream.SetWriteDeadline)
+		closeWrite(upstream)
+	}()
+	_ = t.copy(&flushWriter{w}, upstream, upstream.SetReadDeadline, rc.SetWriteDeadline)
+}
+
+// tunnel relays the data of a CONNECT tunnel until no data passed in either direction for its idle
+// timeout.
+type tunnel struct {
+	idle time.Duration
+	// last is the time of the last data relayed in either direction, in Unix nanoseconds.
+	last atomic.Int64
+}
+
+// pipe copies the data between the connections in both directions until both are done.
+func (t *tunnel) pipe(a, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		_ = t.copy(b, a, a.SetReadDeadline, b.SetWriteDeadline)
+		closeWrite(b)
+		close(done)
+	}()
+	_ = t.copy(a, b, b.SetReadDeadline, a.SetWriteDeadline)
+	closeWrite(a)
+	<-done
+}
+
+// copy copies the data of src to dst, setting the read deadline of src and the write deadline of dst
+// to the idle timeout before each read and write. A read timing out ends the copy unless the other
+// direction relayed data within the idle timeout.
+func (t *tunnel) copy(dst io.Writer, src io.Reader, setReadDeadline, setWriteDeadline func(time.Time) error) error {
+	buf := make([]byte, 32<<10)
+	for {
+		_ = setReadDeadline(time.Now().Add(t.idle))
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.last.Store(time.Now().UnixNano())
+			_ = setWriteDeadline(time.Now().Add(t.idle))
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && time.Since(time.Unix(0, t.last.Load())) < t.idle {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// closeWrite shuts down the writing side of the connection, or closes it.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
@@ -0,0 +1,225 @@
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoServer starts a TCP server echoing the data of its connections.
+func newEchoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestConnectTunnel_Allowed(t *testing.T) {
+	ct := &ConnectTunnel{Allow: []string{"db.internal:5432", "*.example.com:443", "10.0.0.0/8:*", "[::1]:22", "*:8443"}}
+	tests := []struct {
+		name string
+		addr string
+		want bool
+	}{
+		{"Test exact", "db.internal:5432", true},
+		{"Test exact case-insensitive", "DB.internal:5432", true},
+		{"Test other port", "db.internal:5433", false},
+		{"Test wildcard", "api.example.com:443", true},
+		{"Test wildcard parent", "example.com:443", false},
+		{"Test CIDR", "10.1.2.3:6379", true},
+		{"Test CIDR mapped IPv4", "[::ffff:10.1.2.3]:6379", true},
+		{"Test outside CIDR", "11.1.2.3:6379", false},
+		{"Test IPv6", "[::1]:22", true},
+		{"Test any host", "anything:8443", true},
+		{"Test missing port", "db.internal", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ct.Allowed(tt.addr))
+		})
+	}
+}
+
+func TestReverseProxyMux_Connect(t *testing.T) {
+	echo := newEchoServer(t)
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.ErrorLog = log.New(io.Discard, "", 0)
+	pm.Connect = &ConnectTunnel{
+		Allow: []string{echo, "127.0.0.1:1", "unreachable.test:80"},
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == "unreachable.test:80" {
+				return nil, errors.New("connection refused")
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	srv := httptest.NewServer(pm)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name       string
+		addr       string
+		wantStatus int
+	}{
+		{"Test allowed", echo, http.StatusOK},
+		{"Test denied", "127.0.0.1:2", http.StatusForbidden},
+		{"Test missing port", "127.0.0.1", http.StatusBadRequest},
+		{"Test unreachable", "unreachable.test:80", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			assert.NoError(t, err)
+			defer conn.Close()
+			// the data following the request is buffered by the server with the request
+			_, err = io.WriteString(conn, "CONNECT "+tt.addr+" HTTP/1.1\r\nHost: "+tt.addr+"\r\n\r\nping")
+			assert.NoError(t, err)
+			br := bufio.NewReader(conn)
+			res, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			_, err = io.WriteString(conn, " pong")
+			assert.NoError(t, err)
+			assert.NoError(t, conn.(*net.TCPConn).CloseWrite())
+			b, err := io.ReadAll(br)
+			assert.NoError(t, err)
+			assert.Equal(t, "ping pong", string(b))
+		})
+	}
+}
+
+func TestReverseProxyMux_Connect_HTTP2(t *testing.T) {
+	echo := newEchoServer(t)
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.Connect = &ConnectTunnel{Allow: []string{echo}}
+	srv := httptest.NewUnstartedServer(pm)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodConnect, srv.URL, pr)
+	assert.NoError(t, err)
+	req.Host = echo
+	res, err := srv.Client().Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = io.WriteString(pw, "ping")
+	assert.NoError(t, err)
+	b := make([]byte, 4)
+	_, err = io.ReadFull(res.Body, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(b))
+	assert.NoError(t, pw.Close())
+	rest, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+}
+
+func TestReverseProxyMux_Connect_Middleware(t *testing.T) {
+	echo := newEchoServer(t)
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.Connect = &ConnectTunnel{Allow: []string{echo}}
+	var chain []string
+	pm.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain = append(chain, "mux")
+			next.ServeHTTP(w, r)
+		})
+	})
+	pm.UseGroup(ConnectGroup, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain = append(chain, "connect")
+			if r.Header.Get("Proxy-Authorization") == "" {
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r := httptest.NewRequest(http.MethodConnect, "/", nil)
+	r.Host = echo
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusProxyAuthRequired, w.Code)
+	assert.Equal(t, []string{"mux", "connect"}, chain)
+}
+
+func TestReverseProxyMux_Connect_IdleTimeout(t *testing.T) {
+	echo := newEchoServer(t)
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.Connect = &ConnectTunnel{Allow: []string{echo}, IdleTimeout: 50 * time.Millisecond}
+	srv := httptest.NewServer(pm)
+	t.Cleanup(srv.Close)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "CONNECT "+echo+" HTTP/1.1\r\nHost: "+echo+"\r\n\r\n")
+	assert.NoError(t, err)
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the tunnel is kept open while data passes
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		_, err = io.WriteString(conn, "ping")
+		assert.NoError(t, err)
+		b := make([]byte, 4)
+		_, err = io.ReadFull(br, b)
+		assert.NoError(t, err)
+	}
+
+	// and closed when idle
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	start := time.Now()
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestReverseProxyMux_Connect_Disabled(t *testing.T) {
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.PassAnyPath("GET")
+
+	r := httptest.NewRequest(http.MethodConnect, "/", nil)
+	r.Host = "db.internal:5432"
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,149 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnStats are the transport statistics of an upstream request, recorded by httptrace hooks. The
+// durations of the phases which didn't happen, e.g. the dial of a reused connection, are zero.
+type ConnStats struct {
+	// Reused reports whether the connection was reused from the idle pool.
+	Reused bool
+	// IdleTime is the time the reused connection was idle.
+	IdleTime time.Duration
+	// GetConn is the time taken to obtain the connection, from the idle pool or by dialing it.
+	GetConn time.Duration
+	// DNSLookup is the time of the DNS lookup of the backend host.
+	DNSLookup time.Duration
+	// Connect is the time to establish the TCP connection.
+	Connect time.Duration
+	// TLSHandshake is the time of the TLS handshake.
+	TLSHandshake time.Duration
+	// FirstByte is the time from sending the request until the first response byte.
+	FirstByte time.Duration
+}
+
+// String formats the stats for the decision trace and logs, e.g. "new dns=1ms connect=2ms tls=10ms".
+func (s ConnStats) String() string {
+	var b strings.Builder
+	if s.Reused {
+		b.WriteString("reused idle=" + s.IdleTime.String())
+	} else {
+		b.WriteString("new")
+		for _, phase := range []struct {
+			name string
+			d    time.Duration
+		}{{"dns", s.DNSLookup}, {"connect", s.Connect}, {"tls", s.TLSHandshake}} {
+			if phase.d > 0 {
+				b.WriteString(" " + phase.name + "=" + phase.d.String())
+			}
+		}
+	}
+	b.WriteString(" ttfb=" + s.FirstByte.String())
+	return b.String()
+}
+
+// ConnStatsFromContext returns the transport statistics of the upstream request of a route request,
+// or nil if no upstream connection was used, e.g. for cached responses. It's meant to be called by
+// middleware after the route handler returned, e.g. to add the stats to access logs.
+func ConnStatsFromContext(ctx context.Context) *ConnStats {
+	if x := exchangeFrom(ctx); x != nil {
+		return x.conn
+	}
+	return nil
+}
+
+// connTrace records the ConnStats of an upstream request. The hooks may be called concurrently by the
+// transport, e.g. while dialing.
+type connTrace struct {
+	mu                                sync.Mutex
+	stats                             ConnStats
+	getConn, dns, connect, tls, wrote time.Time
+}
+
+// withConnTrace returns the request with a client trace recording its connection stats.
+func withConnTrace(r *http.Request) (*http.Request, *connTrace) {
+	ct := &connTrace{}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) { ct.mark(&ct.getConn) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.stats.Reused, ct.stats.IdleTime = info.Reused, info.IdleTime
+			ct.stats.GetConn = since(ct.getConn)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { ct.mark(&ct.dns) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { ct.done(&ct.stats.DNSLookup, &ct.dns) },
+		ConnectStart: func(string, string) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			// the first of the parallel dials of the addresses of the host starts the phase
+			if ct.connect.IsZero() {
+				ct.connect = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				ct.done(&ct.stats.Connect, &ct.connect)
+			}
+		},
+		TLSHandshakeStart: func() { ct.mark(&ct.tls) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { ct.done(&ct.stats.TLSHandshake, &ct.tls) },
+		WroteRequest:      func(httptrace.WroteRequestInfo) { ct.mark(&ct.wrote) },
+		GotFirstResponseByte: func() {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.stats.FirstByte = since(ct.wrote)
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace)), ct
+}
+
+// mark sets the start time of a phase.
+func (ct *connTrace) mark(t *time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	*t = time.Now()
+}
+
+// done records the duration of a phase started at the time.
+func (ct *connTrace) done(d *time.Duration, start *time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	*d = since(*start)
+}
+
+// result returns the recorded stats.
+func (ct *connTrace) result() *ConnStats {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	stats := ct.stats
+	return &stats
+}
+
+// setConnStats records the connection stats of the upstream request in the exchange and the decision
+// trace, if a connection was obtained.
+func (x *exchange) setConnStats(r *http.Request, ct *connTrace) {
+	ct.mu.Lock()
+	got := !ct.getConn.IsZero()
+	ct.mu.Unlock()
+	if !got {
+		return
+	}
+	x.conn = ct.result()
+	TraceFromContext(r.Context()).Add("conn", x.conn.String())
+}
+
+// since returns the time elapsed since t, or zero if t is unset.
+func since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
@@ -0,0 +1,75 @@
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnStats(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	pm.PassPath("GET", "/plain")
+	pm.HandlePath(NewRoute("GET", "/cached").SetCache(Cache{}))
+	pm.HandlePath(NewRoute("GET", "/hedged").SetHedging(time.Second))
+	var metrics []*ConnStats
+	pm.AddMetricsHook(func(m RequestMetrics) { metrics = append(metrics, m.Conn) })
+	var logged []*ConnStats
+	pm.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			logged = append(logged, ConnStatsFromContext(r.Context()))
+		})
+	})
+
+	for _, target := range []string{"/plain", "/plain", "/cached", "/cached", "/hedged"} {
+		w := httptest.NewRecorder()
+		pm.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, metrics, logged)
+	assert.Len(t, metrics, 5)
+
+	first := metrics[0]
+	assert.False(t, first.Reused)
+	assert.Positive(t, first.Connect)
+	assert.Positive(t, first.TLSHandshake)
+	assert.Positive(t, first.GetConn)
+	assert.Positive(t, first.FirstByte)
+	assert.True(t, strings.HasPrefix(first.String(), "new connect="), first.String())
+
+	for _, reused := range []*ConnStats{metrics[1], metrics[2], metrics[4]} {
+		assert.True(t, reused.Reused)
+		assert.Zero(t, reused.Connect)
+		assert.Zero(t, reused.TLSHandshake)
+		assert.True(t, strings.HasPrefix(reused.String(), "reused idle="), reused.String())
+	}
+	assert.Nil(t, metrics[3], "cache hit")
+}
+
+func TestConnStats_String(t *testing.T) {
+	tests := []struct {
+		stats ConnStats
+		want  string
+	}{
+		{ConnStats{DNSLookup: time.Millisecond, Connect: 2 * time.Millisecond, TLSHandshake: 10 * time.Millisecond, FirstByte: 5 * time.Millisecond},
+			"new dns=1ms connect=2ms tls=10ms ttfb=5ms"},
+		{ConnStats{Connect: time.Millisecond}, "new connect=1ms ttfb=0s"},
+		{ConnStats{Reused: true, IdleTime: time.Second, FirstByte: time.Millisecond}, "reused idle=1s ttfb=1ms"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.stats.String())
+	}
+}
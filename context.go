@@ -0,0 +1,125 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// RequestIDHeader is the request header holding the ID of the request. Requests without the header
+// get a generated ID.
+const RequestIDHeader = "X-Request-Id"
+
+// withRequestState returns the request with the request ID and client IP stored in its context.
+func withRequestState(r *http.Request) *http.Request {
+	ctx := r.Context()
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	ctx = proxyctx.WithRequestID(ctx, id)
+	if ip, ok := remoteIP(r); ok {
+		ctx = proxyctx.WithClientIP(ctx, ip)
+	}
+	return r.WithContext(ctx)
+}
+
+// baseContext is a request context falling back to the values of the BaseContext of the mux.
+type baseContext struct {
+	context.Context
+	base context.Context
+}
+
+// Value returns the value of the request context for the key, or else the value of the base context.
+func (c *baseContext) Value(key any) any {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.base.Value(key)
+}
+
+// withContextHooks returns the request with the BaseContext and RequestContext of the mux applied to
+// its context, and the function releasing the context once the request is served.
+func (pm *ReverseProxyMux) withContextHooks(r *http.Request) (*http.Request, context.CancelFunc) {
+	cfg := pm.current()
+	if cfg.BaseContext == nil && cfg.RequestContext == nil {
+		return r, func() {}
+	}
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	if base := cfg.BaseContext; base != nil {
+		var cancelCtx context.CancelFunc
+		ctx, cancelCtx = context.WithCancel(&baseContext{Context: ctx, base: base})
+		stop := context.AfterFunc(base, cancelCtx)
+		cancel = func() {
+			stop()
+			cancelCtx()
+		}
+	}
+	if hook := cfg.RequestContext; hook != nil {
+		ctx = hook(ctx, r)
+	}
+	return r.WithContext(ctx), cancel
+}
+
+// withRouteState returns the request with the matched route, its parameters and the selected upstream stored in its context.
+func (pm *ReverseProxyMux) withRouteState(r *http.Request, route Route) *http.Request {
+	ctx := proxyctx.WithRoute(r.Context(), proxyctx.RouteInfo{
+		Method: r.Method,
+		Path:   route.Path,
+		Group:  route.Group,
+	})
+	if params := httprouter.ParamsFromContext(ctx); len(params) > 0 {
+		ps := make(proxyctx.Params, len(params))
+		for i, p := range params {
+			ps[i] = proxyctx.Param{Key: p.Key, Value: p.Value}
+		}
+		ctx = proxyctx.WithRouteParams(ctx, ps)
+	}
+	upstream := pm.Backends()[0].url
+	if x := exchangeFrom(ctx); x != nil && x.backend != nil {
+		upstream = x.backend.url
+	}
+	ctx = proxyctx.WithUpstream(ctx, upstream)
+	return r.WithContext(ctx)
+}
+
+// RouteParams returns the parameters captured from the request path by the matched route, e.g. the
+// :id and *path segments. It can be called by middleware and, passing http.Response.Request, by
+// response modifiers. The parameters hold the path before it's rewritten.
+func RouteParams(r *http.Request) proxyctx.Params {
+	return proxyctx.RouteParams(r.Context())
+}
+
+// SetOperation names the operation of a request matched by a route, e.g. its GraphQL operation, which
+// is reported in the RequestMetrics and the error logs. It can be called by middleware.
+func SetOperation(r *http.Request, operation string) {
+	if x := exchangeFrom(r.Context()); x != nil {
+		x.operation = operation
+	}
+}
+
+// remoteIP returns the IP address of the client connection.
+func remoteIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,203 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestState(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+
+	var inMiddleware, inModifier *http.Request
+	pm.PassPath("GET", "/users/:id")
+	pm.HandlePath(NewRoute("GET", "/posts").SetModifyResponse(func(res *http.Response) error {
+		inModifier = res.Request
+		return nil
+	}))
+	pm.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inMiddleware = r
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r := httptest.NewRequest("GET", "/users/42", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set(RequestIDHeader, "req-1")
+	serveRequest(pm, r)
+
+	ctx := inMiddleware.Context()
+	assert.Equal(t, "req-1", proxyctx.RequestID(ctx))
+	ip, _ := proxyctx.ClientIP(ctx)
+	assert.Equal(t, "192.0.2.1", ip.String())
+	route, _ := proxyctx.Route(ctx)
+	assert.Equal(t, proxyctx.RouteInfo{Method: "GET", Path: "/users/:id"}, route)
+	assert.Equal(t, "42", proxyctx.RouteParams(ctx).ByName("id"))
+	assert.Equal(t, origin.URL, proxyctx.Upstream(ctx).String())
+
+	serveRequest(pm, httptest.NewRequest("GET", "/posts", nil))
+	route, _ = proxyctx.Route(inModifier.Context())
+	assert.Equal(t, "/posts", route.Path, "the state should be available to response modifiers")
+}
+
+func TestGeneratedRequestID(t *testing.T) {
+	r := withRequestState(httptest.NewRequest("GET", "/", nil))
+	assert.Len(t, proxyctx.RequestID(r.Context()), 32)
+}
+
+func serveRequest(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouteParams(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+
+	pm.HandlePath(NewRoute("GET", "/users/:id/files/*path").
+		SetRewritePath("/v2/files/:id/*path").
+		SetModifyResponse(func(res *http.Response) error {
+			params := RouteParams(res.Request)
+			res.Header.Set("X-User", params.ByName("id"))
+			res.Header.Set("X-Path", params.ByName("path"))
+			return nil
+		}))
+
+	tests := []struct {
+		name     string
+		target   string
+		wantUser string
+		wantPath string
+	}{
+		{"Test file", "/users/42/files/a.txt", "42", "/a.txt"},
+		{"Test nested file", "/users/7/files/docs/b.txt", "7", "/docs/b.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantUser, w.Header().Get("X-User"))
+			assert.Equal(t, tt.wantPath, w.Header().Get("X-Path"))
+		})
+	}
+	assert.Nil(t, RouteParams(httptest.NewRequest("GET", "/", nil)))
+}
+
+type testContextKey string
+
+func TestContextHooks(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.BaseContext = context.WithValue(context.Background(), testContextKey("logger"), "base")
+	pm.RequestContext = func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, testContextKey("claims"), "user:"+proxyctx.RequestID(ctx))
+	}
+
+	seen := make(map[string][]any)
+	see := func(stage string, ctx context.Context) {
+		seen[stage] = []any{ctx.Value(testContextKey("logger")), ctx.Value(testContextKey("claims"))}
+	}
+	pm.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		see("transport", r.Context())
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	pm.HandlePath(NewRoute("GET", "/ok").
+		SetModifyRequest(func(r *http.Request) error {
+			see("request modifier", r.Context())
+			return nil
+		}).
+		SetModifyResponse(func(res *http.Response) error {
+			see("response modifier", res.Request.Context())
+			return errors.New("failed")
+		}))
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		see("error handler", r.Context())
+	}
+
+	r := httptest.NewRequest("GET", "/ok", nil)
+	r.Header.Set(RequestIDHeader, "42")
+	pm.ServeHTTP(httptest.NewRecorder(), r)
+	want := []any{"base", "user:42"}
+	for _, stage := range []string{"transport", "request modifier", "response modifier", "error handler"} {
+		assert.Equal(t, want, seen[stage], stage)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	canceled := make(chan string, 2)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- r.URL.Path
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		cancel func(client context.CancelFunc, base context.CancelFunc)
+	}{
+		{"Test client disconnect", "/plain", func(client, _ context.CancelFunc) { client() }},
+		{"Test hedged client disconnect", "/hedged", func(client, _ context.CancelFunc) { client() }},
+		{"Test base context canceled", "/plain", func(_, base context.CancelFunc) { base() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			_, err = pm.AddBackend(origin.URL)
+			assert.NoError(t, err)
+			pm.PassPath("GET", "/plain")
+			pm.HandlePath(NewRoute("GET", "/hedged").SetHedging(10 * time.Millisecond))
+			base, cancelBase := context.WithCancel(context.Background())
+			defer cancelBase()
+			pm.BaseContext = base
+			srv := httptest.NewServer(pm)
+			defer srv.Close()
+
+			ctx, cancelClient := context.WithCancel(context.Background())
+			defer cancelClient()
+			r, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+tt.path, nil)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				tt.cancel(cancelClient, cancelBase)
+			}()
+			res, err := http.DefaultClient.Do(r)
+			if err == nil {
+				res.Body.Close()
+			}
+			want := 1
+			if tt.path == "/hedged" {
+				want = 2
+			}
+			for i := 0; i < want; i++ {
+				select {
+				case path := <-canceled:
+					assert.Equal(t, tt.path, path)
+				case <-time.After(2 * time.Second):
+					t.Fatal("upstream request not canceled")
+				}
+			}
+		})
+	}
+}
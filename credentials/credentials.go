@@ -0,0 +1,37 @@
+// Package credentials injects the credentials authenticating the proxy to its origins into the
+// proxied requests: static bearer tokens, basic auth, or access tokens fetched with the OAuth2 client
+// credentials grant and refreshed before they expire. The credentials are set on the routes with
+// Route.SetSigner, so they're applied right before the requests are sent:
+//
+//	cc := &credentials.ClientCredentials{TokenURL: tokenURL, ClientID: id, ClientSecret: secret}
+//	pm.HandlePath(reverseproxy.NewRoute("*", "/api/*path").SetSigner(cc))
+package credentials
+
+import (
+	"net/http"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// staticCredentials sets a fixed Authorization header.
+type staticCredentials struct {
+	authorization string
+}
+
+// Bearer returns credentials sending the static bearer token.
+func Bearer(token string) reverseproxy.RequestSigner {
+	return staticCredentials{authorization: "Bearer " + token}
+}
+
+// Basic returns credentials sending the username and password with HTTP basic auth.
+func Basic(username, password string) reverseproxy.RequestSigner {
+	r := &http.Request{Header: make(http.Header)}
+	r.SetBasicAuth(username, password)
+	return staticCredentials{authorization: r.Header.Get("Authorization")}
+}
+
+// SignRequest sets the Authorization header of the request, replacing the one of the client.
+func (c staticCredentials) SignRequest(r *http.Request) error {
+	r.Header.Set("Authorization", c.authorization)
+	return nil
+}
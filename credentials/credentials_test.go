@@ -0,0 +1,39 @@
+package credentials
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticCredentials(t *testing.T) {
+	var authorization string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name        string
+		credentials reverseproxy.RequestSigner
+		want        string
+	}{
+		{"Test bearer token", Bearer("abc123"), "Bearer abc123"},
+		{"Test basic auth", Basic("proxy", "s3cret"), "Basic cHJveHk6czNjcmV0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := reverseproxy.New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(reverseproxy.NewRoute("GET", "/api").SetSigner(tt.credentials))
+
+			r := httptest.NewRequest("GET", "/api", nil)
+			r.Header.Set("Authorization", "Bearer client-token")
+			pm.ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, tt.want, authorization)
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshBefore is the default time before their expiry the access tokens are refreshed.
+const DefaultRefreshBefore = time.Minute
+
+// DefaultTokenTimeout is the default timeout of the token requests.
+const DefaultTokenTimeout = 10 * time.Second
+
+// minBackoff and maxBackoff bound the time the token requests aren't retried after a failure, which
+// doubles with each consecutive failure.
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// ClientCredentials sends access tokens fetched from the token endpoint of an OAuth2 authorization
+// server with the client credentials grant (RFC 6749 section 4.4). The token is cached and refreshed
+// in the background once it expires within the RefreshBefore time, or half its lifetime if that's
+// shorter, so requests aren't delayed by the refresh; only requests without a valid token wait for a
+// new one. After a failed token request, the requests without a valid token fail with its error until
+// a backoff of one second, doubling with each failure up to a minute, elapsed.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params holds additional parameters of the token request, e.g. an audience.
+	Params url.Values
+	// Client sends the token requests, http.DefaultClient if nil.
+	Client *http.Client
+	// RefreshBefore is the time before the expiry the token is refreshed, DefaultRefreshBefore if zero.
+	RefreshBefore time.Duration
+	// Timeout limits the token requests, DefaultTokenTimeout if zero.
+	Timeout time.Duration
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+	refreshAt  time.Time
+	refreshing bool
+	// fetched is closed once the pending synchronous fetch completed.
+	fetched chan struct{}
+	err     error
+	// failures is the number of consecutive failed token requests, retried from retryAt on.
+	failures int
+	retryAt  time.Time
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// SignRequest sets the Authorization header of the request to the bearer access token.
+func (c *ClientCredentials) SignRequest(r *http.Request) error {
+	token, err := c.Token(r.Context())
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached access token, fetching a new one if it's missing or expired. A token
+// expiring within the RefreshBefore time is returned while it's refreshed in the background.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	now := c.now()
+	switch {
+	case c.token != "" && now.Before(c.refreshAt):
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	case c.token != "" && now.Before(c.expiry):
+		token := c.token
+		if !c.refreshing && !now.Before(c.retryAt) {
+			c.refreshing = true
+			go c.refresh()
+		}
+		c.mu.Unlock()
+		return token, nil
+	case c.fetched == nil && c.err != nil && now.Before(c.retryAt):
+		err := c.err
+		c.mu.Unlock()
+		return "", err
+	}
+	fetched := c.fetched
+	if fetched == nil {
+		fetched = make(chan struct{})
+		c.fetched = fetched
+		go c.fetch(fetched)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-fetched:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.token, nil
+}
+
+// Invalidate drops the cached token, e.g. after the upstream rejected it, so the next request fetches
+// a new one.
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.expiry, c.refreshAt = "", time.Time{}, time.Time{}
+}
+
+// fetch fetches a token for the requests waiting on the channel, which is closed once it's stored.
+func (c *ClientCredentials) fetch(fetched chan struct{}) {
+	token, expiry, err := c.request()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(token, expiry, err)
+	c.fetched = nil
+	close(fetched)
+}
+
+// refresh replaces the token expiring soon. The current token is kept if the refresh fails.
+func (c *ClientCredentials) refresh() {
+	token, expiry, err := c.request()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	c.store(token, expiry, err)
+}
+
+// store stores the result of a token request. A new token is refreshed once it expires within the
+// RefreshBefore time or half its lifetime, a failure delays the next request by the backoff. The
+// caller must hold c.mu.
+func (c *ClientCredentials) store(token string, expiry time.Time, err error) {
+	now := c.now()
+	c.err = err
+	if err != nil {
+		c.failures++
+		c.retryAt = now.Add(min(minBackoff<<min(c.failures-1, 16), maxBackoff))
+		return
+	}
+	c.failures, c.retryAt = 0, time.Time{}
+	c.token, c.expiry = token, expiry
+	c.refreshAt = expiry.Add(-min(c.refreshBefore(), expiry.Sub(now)/2))
+}
+
+// request requests an access token from the token endpoint within the Timeout, returning it with its
+// expiry time. Tokens without an expires_in are cached for an hour. The request isn't bound to the
+// context of a proxied request, so a canceled request doesn't fail the others.
+func (c *ClientCredentials) request() (string, time.Time, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTokenTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for name, values := range c.Params {
+		form[name] = values
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := c.now()
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("credentials: token request: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("credentials: token request: %w", err)
+	}
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil && res.StatusCode == http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("credentials: token response: %w", err)
+	}
+	switch {
+	case tr.Error != "":
+		return "", time.Time{}, fmt.Errorf("credentials: token request: %s: %s", tr.Error, tr.ErrorDescription)
+	case res.StatusCode != http.StatusOK:
+		return "", time.Time{}, fmt.Errorf("credentials: token request: %s", res.Status)
+	case tr.AccessToken == "":
+		return "", time.Time{}, errors.New("credentials: token response without access_token")
+	}
+	expiresIn := time.Hour
+	if tr.ExpiresIn > 0 {
+		expiresIn = time.Duration(tr.ExpiresIn) * time.Second
+	}
+	return tr.AccessToken, start.Add(expiresIn), nil
+}
+
+// now returns the current time.
+func (c *ClientCredentials) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// refreshBefore returns the time before the expiry the token is refreshed.
+func (c *ClientCredentials) refreshBefore() time.Duration {
+	if c.RefreshBefore > 0 {
+		return c.RefreshBefore
+	}
+	return DefaultRefreshBefore
+}
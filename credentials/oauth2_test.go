@@ -0,0 +1,229 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClock is a clock advanced by the tests.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTokenServer(t *testing.T, fail *atomic.Bool) (*httptest.Server, *atomic.Int32) {
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "client", id)
+		assert.Equal(t, "secret", secret)
+		assert.Equal(t, "client_credentials", r.PostFormValue("grant_type"))
+		assert.Equal(t, "read write", r.PostFormValue("scope"))
+		assert.Equal(t, "https://api.example.com", r.PostFormValue("audience"))
+		w.Header().Set("Content-Type", "application/json")
+		if fail != nil && fail.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"unknown client"}`))
+			return
+		}
+		n := fetches.Add(1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":600}`, n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func newClientCredentials(tokenURL string, clock *testClock) *ClientCredentials {
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+		Params:       map[string][]string{"audience": {"https://api.example.com"}},
+		Now:          clock.Now,
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	tokens, fetches := newTokenServer(t, nil)
+	clock := &testClock{now: time.Now()}
+	cc := newClientCredentials(tokens.URL, clock)
+	ctx := context.Background()
+
+	token, err := cc.Token(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	token, _ = cc.Token(ctx)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// within the refresh window, the current token is returned while it's refreshed
+	clock.Add(9*time.Minute + 30*time.Second)
+	token, _ = cc.Token(ctx)
+	assert.Equal(t, "token-1", token)
+	assert.Eventually(t, func() bool {
+		token, _ := cc.Token(ctx)
+		return token == "token-2"
+	}, time.Second, 5*time.Millisecond)
+
+	// expired tokens are replaced before returning
+	clock.Add(11 * time.Minute)
+	token, _ = cc.Token(ctx)
+	assert.Equal(t, "token-3", token)
+
+	cc.Invalidate()
+	token, _ = cc.Token(ctx)
+	assert.Equal(t, "token-4", token)
+}
+
+func TestClientCredentials_Concurrent(t *testing.T) {
+	tokens, fetches := newTokenServer(t, nil)
+	cc := newClientCredentials(tokens.URL, &testClock{now: time.Now()})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cc.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestClientCredentials_Proxy(t *testing.T) {
+	var fail atomic.Bool
+	tokens, _ := newTokenServer(t, &fail)
+	var authorization string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer origin.Close()
+	clock := &testClock{now: time.Now()}
+	cc := newClientCredentials(tokens.URL, clock)
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(reverseproxy.NewRoute("GET", "/api").SetSigner(cc))
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		reverseproxy.DefaultErrorHandler(w, r, err)
+	}
+
+	fail.Store(true)
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.ErrorContains(t, handled, "invalid_client: unknown client")
+	assert.Empty(t, authorization)
+
+	fail.Store(false)
+	clock.Add(minBackoff)
+	w = httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Bearer token-1", authorization)
+}
+
+func TestClientCredentials_Backoff(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var requests atomic.Int32
+	tokens, fetches := newTokenServer(t, &fail)
+	counted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		tokens.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counted.Close()
+	clock := &testClock{now: time.Now()}
+	cc := newClientCredentials(counted.URL, clock)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		advance      time.Duration
+		fail         bool
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"Test failed request", 0, true, 1, true},
+		{"Test within backoff", 500 * time.Millisecond, true, 1, true},
+		{"Test retry after backoff", 500 * time.Millisecond, true, 2, true},
+		{"Test doubled backoff", time.Second, true, 2, true},
+		{"Test retry after doubled backoff", time.Second, false, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Add(tt.advance)
+			fail.Store(tt.fail)
+			_, err := cc.Token(ctx)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantRequests, requests.Load())
+		})
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestClientCredentials_ShortLifetime(t *testing.T) {
+	var fetches atomic.Int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":30}`, fetches.Add(1))
+	}))
+	defer tokens.Close()
+	clock := &testClock{now: time.Now()}
+	cc := newClientCredentials(tokens.URL, clock)
+	ctx := context.Background()
+
+	// a token living shorter than RefreshBefore is refreshed after half its lifetime
+	for i := 0; i < 3; i++ {
+		token, err := cc.Token(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+		clock.Add(5 * time.Second)
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(1), fetches.Load())
+	clock.Add(time.Second)
+	_, _ = cc.Token(ctx)
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestClientCredentials_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer tokens.Close()
+	defer close(release)
+	cc := newClientCredentials(tokens.URL, &testClock{now: time.Now()})
+	cc.Timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	_, err := cc.Token(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,120 @@
+package reverseproxy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultMaxDecompressedSize is the decompressed body size limit used if Decompression.MaxSize is zero.
+	DefaultMaxDecompressedSize = 10 << 20
+	// DefaultMaxCompressionRatio is the expansion ratio limit used if Decompression.MaxRatio is zero.
+	DefaultMaxCompressionRatio = 100
+)
+
+// minRatioCheckSize is the decompressed size from which on the expansion ratio is enforced, so small
+// highly compressible bodies aren't rejected.
+const minRatioCheckSize = 64 << 10
+
+// ErrDecompressionLimit is returned when a decompressed response body exceeds the limits of the route.
+var ErrDecompressionLimit error = &kindError{"decompressed response exceeds limit", ErrBodyTooLarge}
+
+// Decompression configures the transparent decompression of the upstream responses of a route, so the
+// response modifiers see plain bodies. Gzip and deflate encoded bodies are decompressed; the limits
+// protect the proxy from decompression bombs.
+type Decompression struct {
+	// MaxSize limits the decompressed body size, DefaultMaxDecompressedSize if zero.
+	MaxSize int64
+	// MaxRatio limits the ratio of the decompressed to the compressed size, DefaultMaxCompressionRatio
+	// if zero.
+	MaxRatio float64
+}
+
+// decompressResponse replaces the encoded body of the response with the decompressed body. Exceeding
+// the limits fails reading the body with ErrDecompressionLimit.
+func decompressResponse(res *http.Response, d *Decompression) error {
+	if res.Body == nil || res.Body == http.NoBody {
+		return nil
+	}
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" {
+		return nil
+	}
+
+	compressed := &countingReader{Reader: res.Body}
+	var body io.ReadCloser
+	if encoding == "gzip" {
+		zr, err := gzip.NewReader(compressed)
+		if err != nil {
+			return fmt.Errorf("decompress response: %w", err)
+		}
+		body = zr
+	} else {
+		body = flate.NewReader(compressed)
+	}
+	maxSize, maxRatio := d.MaxSize, d.MaxRatio
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	if maxRatio <= 0 {
+		maxRatio = DefaultMaxCompressionRatio
+	}
+	res.Body = &limitedBody{
+		decompressed: body,
+		source:       res.Body,
+		compressed:   compressed,
+		maxSize:      maxSize,
+		maxRatio:     maxRatio,
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return nil
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+// Read reads from the wrapped reader, counting the bytes read.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// limitedBody is a decompressed body enforcing the size and expansion ratio limits.
+type limitedBody struct {
+	decompressed io.ReadCloser
+	source       io.Closer
+	compressed   *countingReader
+	maxSize      int64
+	maxRatio     float64
+	n            int64
+}
+
+// Read reads decompressed data, failing with ErrDecompressionLimit once a limit is exceeded.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.decompressed.Read(p)
+	b.n += int64(n)
+	if b.n > b.maxSize {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrDecompressionLimit, b.maxSize)
+	}
+	if b.n > minRatioCheckSize && float64(b.n) > b.maxRatio*float64(b.compressed.n) {
+		return 0, fmt.Errorf("%w: expansion ratio above %g", ErrDecompressionLimit, b.maxRatio)
+	}
+	return n, err
+}
+
+// Close closes the decompressor and the upstream body.
+func (b *limitedBody) Close() error {
+	_ = b.decompressed.Close()
+	return b.source.Close()
+}
@@ -0,0 +1,81 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w, _ = flate.NewWriter(&buf, flate.BestCompression)
+	}
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompression(t *testing.T) {
+	plain := []byte(`{"message":"hello"}`)
+	bomb := make([]byte, 2<<20)
+	bodies := map[string][]byte{
+		"/gzip":    compress(t, "gzip", plain),
+		"/deflate": compress(t, "deflate", plain),
+		"/bomb":    compress(t, "gzip", bomb),
+		"/large":   compress(t, "gzip", bytes.Repeat(plain, 100)),
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", r.URL.Query().Get("encoding"))
+		_, _ = w.Write(bodies[r.URL.Path])
+	}))
+	defer origin.Close()
+
+	var seen []byte
+	inspect := func(res *http.Response) error {
+		seen, _ = io.ReadAll(res.Body)
+		res.Body = io.NopCloser(bytes.NewReader(seen))
+		return nil
+	}
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/gzip").SetDecompression(Decompression{}).SetModifyResponse(inspect))
+	pm.HandlePath(NewRoute("GET", "/deflate").SetDecompression(Decompression{}).SetModifyResponse(inspect))
+	pm.HandlePath(NewRoute("GET", "/bomb").SetDecompression(Decompression{MaxSize: 10 << 20}).SetBuffering(true))
+	pm.HandlePath(NewRoute("GET", "/large").SetDecompression(Decompression{MaxSize: 1000}).SetBuffering(true))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   []byte
+	}{
+		{"Test gzip body", "/gzip?encoding=gzip", http.StatusOK, plain},
+		{"Test deflate body", "/deflate?encoding=deflate", http.StatusOK, plain},
+		{"Test expansion ratio limit", "/bomb?encoding=gzip", http.StatusBadGateway, nil},
+		{"Test size limit", "/large?encoding=gzip", http.StatusBadGateway, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			r.Header.Set("Accept-Encoding", "gzip, deflate")
+			w := serveRequest(pm, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != nil {
+				assert.Equal(t, tt.wantBody, w.Body.Bytes())
+				assert.Equal(t, tt.wantBody, seen)
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package reverseproxy
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// DialOptions tunes the connections to the upstreams. It's set per backend with BackendDial, or for
+// all of them by assigning its Transport to ReverseProxyMux.Transport.
+type DialOptions struct {
+	// Timeout limits the time to connect, 30 seconds if zero.
+	Timeout time.Duration
+	// KeepAlive is the period of the TCP keep-alive probes, 30 seconds if zero, disabled if negative.
+	KeepAlive time.Duration
+	// FallbackDelay is the time to wait for a connection to the IPv6 addresses of a dual-stack host
+	// before racing a connection to its IPv4 addresses (Happy Eyeballs, RFC 6555), 300 milliseconds if
+	// zero, disabled if negative.
+	FallbackDelay time.Duration
+	// LocalAddr binds the connections to the local IP address, e.g. to select the egress interface of
+	// multi-homed hosts. An ephemeral port is used.
+	LocalAddr netip.Addr
+}
+
+// Dialer returns a dialer of the options, e.g. to be forwarded to by the dialers of the subpackages.
+func (o DialOptions) Dialer() *net.Dialer {
+	d := &net.Dialer{
+		Timeout:       o.Timeout,
+		KeepAlive:     o.KeepAlive,
+		FallbackDelay: o.FallbackDelay,
+	}
+	if d.Timeout == 0 {
+		d.Timeout = 30 * time.Second
+	}
+	if d.KeepAlive == 0 {
+		d.KeepAlive = 30 * time.Second
+	}
+	if o.LocalAddr.IsValid() {
+		d.LocalAddr = &net.TCPAddr{IP: o.LocalAddr.AsSlice()}
+	}
+	return d
+}
+
+// Transport returns an HTTP transport with the settings of http.DefaultTransport, which dials the
+// connections with the options.
+func (o DialOptions) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = o.Dialer().DialContext
+	return t
+}
+
+// BackendDial sets the dial options of the connections to the backend. It's combined with a previous
+// BackendTLS or BackendTransport option setting an *http.Transport, other transports are replaced.
+func BackendDial(opts DialOptions) BackendOption {
+	return func(b *Backend) {
+		t := backendTransport(b)
+		t.DialContext = opts.Dialer().DialContext
+		b.transport = t
+	}
+}
+
+// backendTransport returns a clone of the *http.Transport of the backend, or of http.DefaultTransport.
+func backendTransport(b *Backend) *http.Transport {
+	if t, ok := b.transport.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
@@ -0,0 +1,68 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialOptions_Dialer(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DialOptions
+		want net.Dialer
+	}{
+		{"Test defaults", DialOptions{}, net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}},
+		{"Test disabled fallback and keep-alive", DialOptions{Timeout: time.Second, KeepAlive: -1, FallbackDelay: -1}, net.Dialer{Timeout: time.Second, KeepAlive: -1, FallbackDelay: -1}},
+		{"Test local address", DialOptions{LocalAddr: netip.MustParseAddr("10.0.0.1")}, net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, LocalAddr: &net.TCPAddr{IP: net.IP{10, 0, 0, 1}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.opts.Dialer()
+			assert.Equal(t, tt.want.Timeout, d.Timeout)
+			assert.Equal(t, tt.want.KeepAlive, d.KeepAlive)
+			assert.Equal(t, tt.want.FallbackDelay, d.FallbackDelay)
+			assert.Equal(t, tt.want.LocalAddr, d.LocalAddr)
+		})
+	}
+}
+
+func TestBackendDial(t *testing.T) {
+	pki := newTestPKI(t)
+	origin := newMTLSOrigin(t, pki)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+	upstreamTLS := BackendTLS(&UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool})
+
+	tests := []struct {
+		name       string
+		opts       []BackendOption
+		wantStatus int
+	}{
+		{"Test dial options after TLS", []BackendOption{upstreamTLS, BackendDial(DialOptions{LocalAddr: netip.MustParseAddr("127.0.0.1")})}, http.StatusOK},
+		{"Test TLS after dial options", []BackendOption{BackendDial(DialOptions{LocalAddr: netip.MustParseAddr("127.0.0.1")}), upstreamTLS}, http.StatusOK},
+		{"Test unassigned local address", []BackendOption{upstreamTLS, BackendDial(DialOptions{LocalAddr: netip.MustParseAddr("192.0.2.1")})}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := New("http://127.0.0.1:1")
+			assert.NoError(t, err)
+			pm.ErrorLog = log.New(io.Discard, "", 0)
+			_, err = pm.AddBackend(origin.URL, tt.opts...)
+			assert.NoError(t, err)
+			assert.NoError(t, pm.RemoveBackend(context.Background(), pm.Backends()[0]))
+			pm.PassPath("GET", "/secure")
+
+			w := serve(pm, "GET", "/secure")
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package reverseproxy
+
+import (
+	"encoding/json"
+	"html"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// NegotiatedError returns a handler answering requests with an error of the status code, as JSON for
+// the clients preferring application/json by their Accept header and as HTML otherwise. It answers the
+// unmatched requests of the mux if the NotFoundHandler or MethodNotAllowedHandler is nil.
+func NegotiatedError(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		text := http.StatusText(status)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if prefersJSON(r.Header.Values("Accept")) {
+			b, _ := json.Marshal(struct {
+				Status int    `json:"status"`
+				Error  string `json:"error"`
+			}{status, text})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write(append(b, '\n'))
+			return
+		}
+		title := html.EscapeString(strconv.Itoa(status) + " " + text)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("<!DOCTYPE html>\n<html><head><title>" + title + "</title></head><body><h1>" + title + "</h1></body></html>\n"))
+	})
+}
+
+// prefersJSON returns whether the Accept header ranks JSON above HTML. Wildcards rank both, HTML wins
+// ties.
+func prefersJSON(accept []string) bool {
+	var jsonQ, htmlQ float64
+	for _, value := range accept {
+		for _, entry := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(entry)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			typ, subtype, _ := strings.Cut(mediaType, "/")
+			if mediaType == "*/*" || (typ == "application" && (subtype == "*" || subtype == "json")) || strings.HasSuffix(subtype, "+json") {
+				jsonQ = max(jsonQ, q)
+			}
+			if mediaType == "*/*" || (typ == "text" && (subtype == "*" || subtype == "html")) {
+				htmlQ = max(htmlQ, q)
+			}
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// errorPages holds the NotFound and MethodNotAllowed handlers of the routes.
+type errorPages struct {
+	// notFound holds the NotFound handlers by static path prefix, the longest prefix first.
+	notFound []prefixPage
+	// notAllowed matches the paths of the routes with a MethodNotAllowed handler.
+	notAllowed *httprouter.Router
+}
+
+// prefixPage is the NotFound handler of the requests under a path prefix.
+type prefixPage struct {
+	prefix  string
+	handler http.Handler
+}
+
+// notAllowedMethod is the method the MethodNotAllowed handlers are registered for.
+const notAllowedMethod = "405"
+
+// newErrorPages collects the error handlers of the routes. Routes whose paths conflict with the path of
+// a previous route with a MethodNotAllowed handler, e.g. /users/:id and /users/:name of other methods,
+// are skipped.
+func newErrorPages(routes []Route) *errorPages {
+	p := &errorPages{}
+	for _, route := range routes {
+		if route.NotFound != nil {
+			p.notFound = append(p.notFound, prefixPage{prefix: staticPrefix(route.Path), handler: route.NotFound})
+		}
+		if route.MethodNotAllowed != nil {
+			if p.notAllowed == nil {
+				p.notAllowed = httprouter.New()
+			}
+			p.addNotAllowed(route)
+		}
+	}
+	sort.SliceStable(p.notFound, func(i, j int) bool {
+		return len(p.notFound[i].prefix) > len(p.notFound[j].prefix)
+	})
+	return p
+}
+
+// addNotAllowed registers the MethodNotAllowed handler of the route, unless its path conflicts.
+func (p *errorPages) addNotAllowed(route Route) {
+	defer func() {
+		_ = recover()
+	}()
+	if h, _, _ := p.notAllowed.Lookup(notAllowedMethod, route.Path); h == nil {
+		p.notAllowed.Handler(notAllowedMethod, route.Path, route.MethodNotAllowed)
+	}
+}
+
+// staticPrefix returns the path of the route up to its first parameter.
+func staticPrefix(path string) string {
+	if i := strings.IndexAny(path, ":*"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// notFoundHandler returns the NotFound handler of the route with the longest prefix of the path.
+func (p *errorPages) notFoundHandler(path string) http.Handler {
+	if p == nil {
+		return nil
+	}
+	for _, page := range p.notFound {
+		rest, ok := strings.CutPrefix(path, page.prefix)
+		if ok && (rest == "" || strings.HasSuffix(page.prefix, "/") || rest[0] == '/') {
+			return page.handler
+		}
+	}
+	return nil
+}
+
+// methodNotAllowedHandler returns the MethodNotAllowed handler of the route matching the path.
+func (p *errorPages) methodNotAllowedHandler(path string) http.Handler {
+	if p == nil || p.notAllowed == nil {
+		return nil
+	}
+	handle, _, _ := p.notAllowed.Lookup(notAllowedMethod, path)
+	if handle == nil {
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, nil)
+	})
+}
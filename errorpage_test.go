@@ -0,0 +1,84 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiatedError(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		wantType string
+		wantBody string
+	}{
+		{"Test JSON", "application/json", "application/json", `{"status":404,"error":"Not Found"}` + "\n"},
+		{"Test JSON suffix", "application/problem+json", "application/json", `{"status":404,"error":"Not Found"}` + "\n"},
+		{"Test JSON preferred", "text/html;q=0.5, application/json", "application/json", `{"status":404,"error":"Not Found"}` + "\n"},
+		{"Test HTML preferred", "text/html, application/json;q=0.9", "text/html; charset=utf-8", "<!DOCTYPE html>\n<html><head><title>404 Not Found</title></head><body><h1>404 Not Found</h1></body></html>\n"},
+		{"Test wildcard", "*/*", "text/html; charset=utf-8", "<!DOCTYPE html>\n<html><head><title>404 Not Found</title></head><body><h1>404 Not Found</h1></body></html>\n"},
+		{"Test missing", "", "text/html; charset=utf-8", "<!DOCTYPE html>\n<html><head><title>404 Not Found</title></head><body><h1>404 Not Found</h1></body></html>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			NegotiatedError(http.StatusNotFound).ServeHTTP(w, r)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func text(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+func TestRoute_SetNotFoundHandler(t *testing.T) {
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/api/users/:id").SetNotFoundHandler(text("users")).SetMethodNotAllowedHandler(text("users method")))
+	pm.HandlePath(NewRoute("POST", "/api/users/:name").SetMethodNotAllowedHandler(text("other")))
+	pm.HandlePath(NewRoute("GET", "/api").SetNotFoundHandler(text("api")))
+	pm.HandlePath(NewRoute("GET", "/docs"))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test longest prefix", "GET", "/api/users/1/posts", http.StatusTeapot, "users"},
+		{"Test shorter prefix", "GET", "/api/orders", http.StatusTeapot, "api"},
+		{"Test prefix boundary", "GET", "/apis", http.StatusNotFound, ""},
+		{"Test mux default", "GET", "/other", http.StatusNotFound, ""},
+		{"Test method not allowed", "DELETE", "/api/users/1", http.StatusTeapot, "users method"},
+		{"Test mux method not allowed", "POST", "/docs", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, tt.method, tt.target)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+	assert.Equal(t, "GET, OPTIONS, POST", serve(pm, "DELETE", "/api/users/1").Header().Get("Allow"))
+
+	pm.NotFoundHandler = text("mux")
+	assert.Equal(t, "mux", serve(pm, "GET", "/other").Body.String())
+	assert.Equal(t, "api", serve(pm, "GET", "/api/orders").Body.String())
+}
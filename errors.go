@@ -0,0 +1,98 @@
+package reverseproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+var (
+	// ErrUpstreamRefused is the kind of the errors of upstream requests whose connection was refused.
+	ErrUpstreamRefused = errors.New("upstream refused connection")
+	// ErrUpstreamFailed is the kind of the other errors of upstream requests, e.g. reset connections.
+	ErrUpstreamFailed = errors.New("upstream request failed")
+	// ErrBodyTooLarge is the kind of the errors of request or response bodies exceeding a limit. It's
+	// wrapped by ErrResponseTooLarge, ErrDecompressionLimit and the errors of request bodies limited by
+	// http.MaxBytesReader.
+	ErrBodyTooLarge = errors.New("body too large")
+	// ErrRewriteFailed is the kind of the errors of request and response modifiers, which failed to
+	// rewrite the request or response.
+	ErrRewriteFailed = errors.New("rewrite failed")
+	// ErrSelectFailed is the kind of the errors of the UpstreamSelector, see SetUpstreamSelector.
+	ErrSelectFailed = errors.New("upstream selection failed")
+)
+
+// ProxyError is the error of a proxied request passed to the ErrorHandler and the metrics hooks. Its
+// Kind is one of the sentinel errors, e.g. ErrUpstreamTimeout or ErrRewriteFailed, so the handlers can
+// branch on the failure cause with errors.Is, or inspect the error with errors.As:
+//
+//	var perr *reverseproxy.ProxyError
+//	if errors.As(err, &perr) && perr.Kind == reverseproxy.ErrUpstreamRefused {
+//		log.Printf("backend %s is down", perr.Backend)
+//	}
+type ProxyError struct {
+	// Kind is the sentinel error of the failure cause.
+	Kind error
+	// Backend is the URL of the backend of the failed request, nil if none was selected.
+	Backend *url.URL
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the error, prefixed by the kind unless the underlying error wraps it.
+func (e *ProxyError) Error() string {
+	if errors.Is(e.Err, e.Kind) {
+		return e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the kind and the underlying error, so errors.Is and errors.As match both.
+func (e *ProxyError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// newProxyError wraps the error of the exchange in a ProxyError of the kind, unless it's one already.
+func newProxyError(kind error, x *exchange, err error) error {
+	var perr *ProxyError
+	if errors.As(err, &perr) {
+		return err
+	}
+	perr = &ProxyError{Kind: kind, Err: err}
+	if x != nil && x.backend != nil {
+		perr.Backend = x.backend.URL()
+	}
+	return perr
+}
+
+// upstreamErrorKind returns the kind of the error of an upstream request.
+func upstreamErrorKind(err error) error {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case isTimeout(err):
+		return ErrUpstreamTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrUpstreamRefused
+	case errors.Is(err, ErrBodyTooLarge), errors.As(err, &maxBytes):
+		return ErrBodyTooLarge
+	case errors.Is(err, ErrRewriteFailed):
+		return ErrRewriteFailed
+	}
+	return ErrUpstreamFailed
+}
+
+// kindError is a sentinel error of a kind, e.g. ErrResponseTooLarge of ErrBodyTooLarge.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the kind of the error.
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,102 @@
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyError(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/reset":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		case "/upload":
+			_, _ = io.Copy(io.Discard, r.Body)
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer origin.Close()
+	// a listener closed right away, so its connections are refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	refused := "http://" + l.Addr().String()
+	l.Close()
+
+	failing := errors.New("failing modifier")
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.UpstreamTimeout = 50 * time.Millisecond
+	pm.MaxBufferedResponse = 10
+	pm.PassPaths("GET", "/slow", "/reset")
+	pm.PassPath("POST", "/upload")
+	pm.HandlePath(NewRoute("GET", "/large").SetBuffering(true))
+	pm.HandlePath(NewRoute("GET", "/request").SetModifyRequest(func(*http.Request) error { return failing }))
+	pm.HandlePath(NewRoute("GET", "/response").SetModifyResponse(func(*http.Response) error { return failing }))
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		DefaultErrorHandler(w, r, err)
+	}
+
+	refusedPm, err := New(refused)
+	assert.NoError(t, err)
+	refusedPm.PassPath("GET", "/")
+	refusedPm.ErrorHandler = pm.ErrorHandler
+
+	tests := []struct {
+		name     string
+		mux      *ReverseProxyMux
+		r        *http.Request
+		wantKind error
+		wantCode int
+	}{
+		{"Test timeout", pm, httptest.NewRequest("GET", "/slow", nil), ErrUpstreamTimeout, http.StatusGatewayTimeout},
+		{"Test refused", refusedPm, httptest.NewRequest("GET", "/", nil), ErrUpstreamRefused, http.StatusBadGateway},
+		{"Test failed", pm, httptest.NewRequest("GET", "/reset", nil), ErrUpstreamFailed, http.StatusBadGateway},
+		{"Test response too large", pm, httptest.NewRequest("GET", "/large", nil), ErrBodyTooLarge, http.StatusBadGateway},
+		{"Test request too large", pm, limitedRequest("/upload", 10), ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+		{"Test request modifier", pm, httptest.NewRequest("GET", "/request", nil), ErrRewriteFailed, http.StatusBadGateway},
+		{"Test response modifier", pm, httptest.NewRequest("GET", "/response", nil), ErrRewriteFailed, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+			w := httptest.NewRecorder()
+			tt.mux.ServeHTTP(w, tt.r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			var perr *ProxyError
+			assert.True(t, errors.As(handled, &perr), "%v", handled)
+			assert.ErrorIs(t, handled, tt.wantKind)
+			assert.Equal(t, tt.wantKind, perr.Kind)
+			assert.Equal(t, tt.mux.Remote().String(), perr.Backend.String())
+		})
+	}
+	assert.ErrorIs(t, handled, failing)
+	assert.Equal(t, "rewrite failed: failing modifier", handled.Error())
+}
+
+// limitedRequest returns a POST request whose body exceeds the limit of its http.MaxBytesReader.
+func limitedRequest(target string, limit int64) *http.Request {
+	r := httptest.NewRequest("POST", target, strings.NewReader(strings.Repeat("x", 100)))
+	r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, limit)
+	return r
+}
+
+func TestProxyError_Error(t *testing.T) {
+	assert.Equal(t, "upstream timeout: context deadline exceeded",
+		(&ProxyError{Kind: ErrUpstreamTimeout, Err: errors.New("context deadline exceeded")}).Error())
+	assert.Equal(t, ErrResponseTooLarge.Error(), (&ProxyError{Kind: ErrBodyTooLarge, Err: ErrResponseTooLarge}).Error())
+	assert.ErrorIs(t, ErrDecompressionLimit, ErrBodyTooLarge)
+}
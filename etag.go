@@ -0,0 +1,88 @@
+package reverseproxy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagMode defines whether the responses of a route get an ETag computed by the proxy.
+type ETagMode int
+
+const (
+	// ETagNone keeps the ETag of the upstream, the default.
+	ETagNone ETagMode = iota
+	// ETagStrong sets a strong ETag, a hash of the body, on the responses without one.
+	ETagStrong
+	// ETagWeak sets a weak ETag, a hash of the body, on the responses without one, e.g. for bodies
+	// which are transformed, so they're only semantically equivalent.
+	ETagWeak
+)
+
+// conditionalHeaders holds the headers kept in a 304 not modified response, per RFC 9110.
+var conditionalHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// applyETag sets the ETag of the response if it has none, reading its body within the
+// MaxBufferedResponse size, and answers the conditional GET and HEAD requests matching the ETag or
+// Last-Modified header with 304 not modified.
+func (pm *ReverseProxyMux) applyETag(res *http.Response, mode ETagMode) {
+	r := res.Request
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+	if res.Header.Get("ETag") == "" && res.Body != nil {
+		b, ok := readBody(res, pm.current().MaxBufferedResponse)
+		if !ok {
+			return
+		}
+		sum := sha256.Sum256(b)
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		if mode == ETagWeak {
+			etag = "W/" + etag
+		}
+		res.Header.Set("ETag", etag)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || !notModified(r, res.Header) {
+		return
+	}
+	if res.Body != nil {
+		_ = res.Body.Close()
+	}
+	header := make(http.Header)
+	for _, name := range conditionalHeaders {
+		if values := res.Header.Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	res.StatusCode, res.Status = http.StatusNotModified, "304 Not Modified"
+	res.Header, res.Body, res.ContentLength = header, http.NoBody, 0
+	res.TransferEncoding = nil
+	TraceFromContext(r.Context()).Add("etag", "not modified")
+}
+
+// notModified reports whether the conditional request matches the ETag or Last-Modified header. The
+// If-Modified-Since header is only evaluated without an If-None-Match header.
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		for _, tag := range strings.Split(inm, ",") {
+			if tag = strings.TrimSpace(tag); tag == "*" || weakMatch(tag, etag) {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	return err == nil && !lm.After(ims.Truncate(time.Second))
+}
+
+// weakMatch reports whether the entity tags match by the weak comparison.
+func weakMatch(a, b string) bool {
+	return b != "" && strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
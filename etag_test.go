@@ -0,0 +1,75 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "tagged":
+			w.Header().Set("ETag", `"upstream"`)
+		case "modified":
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "body")
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET|POST", "/strong/*path").SetETag(ETagStrong))
+	pm.HandlePath(NewRoute("GET", "/weak/*path").SetETag(ETagWeak))
+	pm.PassPath("GET", "/plain/*path")
+	const etag = `"Iw2DWNyOiJC0xY3utikS7g"`
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		header   http.Header
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		{"Test strong ETag", "GET", "/strong/page", nil, http.StatusOK, etag, "body"},
+		{"Test weak ETag", "GET", "/weak/page", nil, http.StatusOK, "W/" + etag, "body"},
+		{"Test upstream ETag", "GET", "/strong/tagged", nil, http.StatusOK, `"upstream"`, "body"},
+		{"Test route without ETag", "GET", "/plain/page", nil, http.StatusOK, "", "body"},
+		{"Test error response", "GET", "/strong/missing", nil, http.StatusNotFound, "", "body"},
+		{"Test If-None-Match", "GET", "/strong/page", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified, etag, ""},
+		{"Test weak If-None-Match", "GET", "/strong/page", http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified, etag, ""},
+		{"Test If-None-Match wildcard", "GET", "/strong/tagged", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified, `"upstream"`, ""},
+		{"Test If-None-Match mismatch", "GET", "/strong/page", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK, etag, "body"},
+		{"Test If-None-Match on POST", "POST", "/strong/page", http.Header{"If-None-Match": {etag}}, http.StatusOK, etag, "body"},
+		{"Test If-Modified-Since", "GET", "/strong/modified", http.Header{"If-Modified-Since": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, http.StatusNotModified, etag, ""},
+		{"Test modified since", "GET", "/strong/modified", http.Header{"If-Modified-Since": {"Tue, 20 Oct 2015 07:28:00 GMT"}}, http.StatusOK, etag, "body"},
+		{"Test If-None-Match precedence", "GET", "/strong/modified", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, http.StatusOK, etag, "body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			if tt.wantCode == http.StatusNotModified {
+				assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+				assert.Empty(t, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ExpectMode controls how the Expect: 100-continue header of the requests of a route is handled, see
+// Route.SetExpect.
+type ExpectMode int
+
+const (
+	// ExpectForward forwards the expectation to the upstream, the default. The client gets the 100
+	// Continue once the upstream accepted the request headers, or the ExpectContinueTimeout of the
+	// transport elapsed, so rejected uploads aren't sent.
+	ExpectForward ExpectMode = iota
+	// ExpectStrip answers the expectation by the proxy and removes it from the forwarded request, whose
+	// body is streamed, e.g. for upstreams failing on the header.
+	ExpectStrip
+	// ExpectBuffer answers the expectation by the proxy and reads the full body, limited by the
+	// MaxBufferedRequest of the mux, before the request is forwarded with its Content-Length, e.g. for
+	// upstreams not supporting chunked uploads.
+	ExpectBuffer
+	// ExpectReject answers the requests with the expectation with HTTP 417 expectation failed.
+	ExpectReject
+)
+
+// expectsContinue returns whether the request has the Expect: 100-continue header.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Expect")), "100-continue")
+}
+
+// handleExpect applies the ExpectMode of the route to the request, answering it and returning false if
+// it mustn't be forwarded.
+func (h *routeHandler) handleExpect(w http.ResponseWriter, r *http.Request, x *exchange) bool {
+	mode := h.route.Expect
+	if mode == ExpectForward || !expectsContinue(r) {
+		return true
+	}
+	trace := TraceFromContext(r.Context())
+	switch mode {
+	case ExpectReject:
+		trace.Add("expect", "rejected")
+		http.Error(w, http.StatusText(http.StatusExpectationFailed), http.StatusExpectationFailed)
+		return false
+	case ExpectStrip:
+		trace.Add("expect", "stripped")
+		r.Header.Del("Expect")
+		return true
+	}
+	trace.Add("expect", "buffered")
+	r.Header.Del("Expect")
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	var body io.Reader = r.Body
+	if limit := h.pm.current().MaxBufferedRequest; limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	b, err := io.ReadAll(body)
+	_ = r.Body.Close()
+	if err != nil {
+		err = newProxyError(ErrBodyTooLarge, x, err)
+		x.err = err
+		h.pm.handleError(w, r, err)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	r.ContentLength = int64(len(b))
+	r.TransferEncoding = nil
+	r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return true
+}
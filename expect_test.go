@@ -0,0 +1,85 @@
+package reverseproxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_SetExpect(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "expect=%s length=%d body=%s", r.Header.Get("Expect"), r.ContentLength, b)
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name         string
+		mode         ExpectMode
+		path         string
+		body         string
+		wantContinue bool
+		wantStatus   int
+		wantBody     string
+	}{
+		{"Test forwarded expectation", ExpectForward, "/upload", "data", true, http.StatusOK, "expect=100-continue length=4 body=data"},
+		{"Test upload rejected by upstream", ExpectForward, "/reject", "data", false, http.StatusUnauthorized, ""},
+		{"Test stripped expectation", ExpectStrip, "/upload", "data", true, http.StatusOK, "expect= length=4 body=data"},
+		{"Test buffered body", ExpectBuffer, "/upload", "data", true, http.StatusOK, "expect= length=4 body=data"},
+		{"Test buffered body too large", ExpectBuffer, "/upload", "too large", true, http.StatusRequestEntityTooLarge, ""},
+		{"Test rejected expectation", ExpectReject, "/upload", "data", false, http.StatusExpectationFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.ErrorLog = log.New(io.Discard, "", 0)
+			pm.MaxBufferedRequest = 8
+			pm.HandlePath(NewRoute("POST", "/*path").SetExpect(tt.mode))
+			front := httptest.NewServer(pm)
+			defer front.Close()
+
+			conn, err := net.Dial("tcp", front.Listener.Addr().String())
+			assert.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			_, _ = fmt.Fprintf(conn, "POST %s HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", tt.path, len(tt.body))
+
+			// the body is sent once the 100 Continue is received, like clients without a timeout
+			br := bufio.NewReader(conn)
+			line, err := br.ReadString('\n')
+			assert.NoError(t, err)
+			gotContinue := strings.HasPrefix(line, "HTTP/1.1 100")
+			assert.Equal(t, tt.wantContinue, gotContinue)
+			if gotContinue {
+				_, _ = br.ReadString('\n')
+				_, _ = io.WriteString(conn, tt.body)
+				line, err = br.ReadString('\n')
+				assert.NoError(t, err)
+			}
+			res, err := http.ReadResponse(bufio.NewReader(io.MultiReader(strings.NewReader(line), br)), nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				b, _ := io.ReadAll(res.Body)
+				assert.Equal(t, tt.wantBody, string(b))
+			}
+		})
+	}
+}
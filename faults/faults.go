@@ -0,0 +1,179 @@
+// Package faults injects artificial latency, aborted connections and error responses into a
+// percentage of the requests of the routes, to test the resilience of the clients. The Injector is
+// registered as middleware and its faults are changed at runtime, e.g. through the admin API:
+//
+//	in := faults.NewInjector()
+//	pm.Use(in.Middleware)
+//	in.Set("/users/:id", faults.Fault{Percentage: 10, Delay: 2 * time.Second, Status: 503})
+//	admin.New(pm).SetFaultInjector(in)
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// AllRoutes is the route pattern of the faults injected into all routes without faults of their own.
+const AllRoutes = "*"
+
+// Fault is a fault injected into a percentage of the requests. The delay is applied first, then the
+// request is aborted or answered with the status, if set, instead of being forwarded.
+type Fault struct {
+	// Percentage is the percentage of the affected requests, between 0 and 100.
+	Percentage float64
+	// Delay delays the affected requests.
+	Delay time.Duration
+	// Abort closes the connection of the affected requests without a response.
+	Abort bool
+	// Status answers the affected requests with the status code.
+	Status int
+}
+
+// faultJSON is the JSON representation of a Fault, with the delay as a duration string, e.g. "250ms".
+type faultJSON struct {
+	Percentage float64 `json:"percentage"`
+	Delay      string  `json:"delay,omitempty"`
+	Abort      bool    `json:"abort,omitempty"`
+	Status     int     `json:"status,omitempty"`
+}
+
+// MarshalJSON encodes the fault with the delay as a duration string.
+func (f Fault) MarshalJSON() ([]byte, error) {
+	j := faultJSON{Percentage: f.Percentage, Abort: f.Abort, Status: f.Status}
+	if f.Delay > 0 {
+		j.Delay = f.Delay.String()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes the fault encoded by MarshalJSON.
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	var j faultJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*f = Fault{Percentage: j.Percentage, Abort: j.Abort, Status: j.Status}
+	if j.Delay != "" {
+		d, err := time.ParseDuration(j.Delay)
+		if err != nil {
+			return err
+		}
+		f.Delay = d
+	}
+	return nil
+}
+
+// Validate reports an invalid fault.
+func (f Fault) Validate() error {
+	switch {
+	case f.Percentage < 0 || f.Percentage > 100:
+		return errors.New("faults: percentage must be between 0 and 100")
+	case f.Delay < 0:
+		return errors.New("faults: negative delay")
+	case f.Status != 0 && (f.Status < 100 || f.Status > 999):
+		return errors.New("faults: invalid status code")
+	case f.Abort && f.Status != 0:
+		return errors.New("faults: abort and status are exclusive")
+	}
+	return nil
+}
+
+// Injector injects the faults of the routes, keyed by their path patterns. It's safe for concurrent
+// use.
+type Injector struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+}
+
+// NewInjector creates an injector without faults.
+func NewInjector() *Injector {
+	return &Injector{faults: make(map[string]Fault)}
+}
+
+// Set sets the fault of the route pattern, e.g. /users/:id, or of AllRoutes.
+func (in *Injector) Set(route string, f Fault) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.faults[route] = f
+	return nil
+}
+
+// Remove removes the fault of the route pattern.
+func (in *Injector) Remove(route string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delete(in.faults, route)
+}
+
+// Clear removes all faults.
+func (in *Injector) Clear() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	clear(in.faults)
+}
+
+// Faults returns a copy of the faults by route pattern.
+func (in *Injector) Faults() map[string]Fault {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	faults := make(map[string]Fault, len(in.faults))
+	for route, f := range in.faults {
+		faults[route] = f
+	}
+	return faults
+}
+
+// lookup returns the fault of the route, falling back to the fault of AllRoutes.
+func (in *Injector) lookup(route string) (Fault, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if f, ok := in.faults[route]; ok {
+		return f, true
+	}
+	f, ok := in.faults[AllRoutes]
+	return f, ok
+}
+
+// Middleware returns a handler injecting the faults into the requests passed to next.
+func (in *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := proxyctx.Route(r.Context())
+		f, ok := in.lookup(route.Path)
+		if !ok || f.Percentage <= 0 || rand.Float64()*100 >= f.Percentage {
+			next.ServeHTTP(w, r)
+			return
+		}
+		trace := reverseproxy.TraceFromContext(r.Context())
+		if f.Delay > 0 {
+			trace.Add("fault", "delay "+f.Delay.String())
+			t := time.NewTimer(f.Delay)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+		switch {
+		case f.Abort:
+			trace.Add("fault", "abort")
+			panic(http.ErrAbortHandler)
+		case f.Status != 0:
+			trace.Add("fault", "status "+strconv.Itoa(f.Status))
+			http.Error(w, http.StatusText(f.Status), f.Status)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
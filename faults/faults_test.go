@@ -0,0 +1,109 @@
+package faults
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMux(t *testing.T, in *Injector) *reverseproxy.ReverseProxyMux {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPaths("GET", "/users/:id", "/other")
+	pm.Use(in.Middleware)
+	return pm
+}
+
+func get(pm http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func TestInjector(t *testing.T) {
+	in := NewInjector()
+	pm := newTestMux(t, in)
+
+	assert.Equal(t, http.StatusOK, get(pm, "/users/1").Code)
+
+	assert.NoError(t, in.Set("/users/:id", Fault{Percentage: 100, Status: http.StatusServiceUnavailable}))
+	w := get(pm, "/users/1")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, http.StatusOK, get(pm, "/other").Code)
+
+	assert.NoError(t, in.Set(AllRoutes, Fault{Percentage: 100, Delay: 30 * time.Millisecond}))
+	start := time.Now()
+	w = get(pm, "/other")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, get(pm, "/users/1").Code)
+
+	in.Remove("/users/:id")
+	in.Remove(AllRoutes)
+	assert.Equal(t, http.StatusOK, get(pm, "/users/1").Code)
+	assert.Empty(t, in.Faults())
+}
+
+func TestInjector_Percentage(t *testing.T) {
+	in := NewInjector()
+	pm := newTestMux(t, in)
+	assert.NoError(t, in.Set(AllRoutes, Fault{Percentage: 25, Status: http.StatusInternalServerError}))
+	var failed int
+	for i := 0; i < 400; i++ {
+		if get(pm, "/other").Code == http.StatusInternalServerError {
+			failed++
+		}
+	}
+	assert.InDelta(t, 100, failed, 50)
+}
+
+func TestInjector_Abort(t *testing.T) {
+	in := NewInjector()
+	srv := httptest.NewServer(newTestMux(t, in))
+	defer srv.Close()
+	assert.NoError(t, in.Set(AllRoutes, Fault{Percentage: 100, Abort: true}))
+
+	_, err := http.Get(srv.URL + "/other")
+	assert.Error(t, err)
+}
+
+func TestFault_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   Fault
+		wantErr bool
+	}{
+		{"Test valid", Fault{Percentage: 50, Delay: time.Second, Status: 503}, false},
+		{"Test percentage", Fault{Percentage: 101}, true},
+		{"Test negative delay", Fault{Delay: -1}, true},
+		{"Test status", Fault{Status: 42}, true},
+		{"Test abort and status", Fault{Abort: true, Status: 503}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.fault.Validate() != nil)
+			assert.Equal(t, tt.wantErr, NewInjector().Set("/", tt.fault) != nil)
+		})
+	}
+}
+
+func TestFault_JSON(t *testing.T) {
+	f := Fault{Percentage: 5, Delay: 250 * time.Millisecond, Status: 502}
+	data, err := json.Marshal(f)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"percentage":5,"delay":"250ms","status":502}`, string(data))
+	var got Fault
+	assert.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, f, got)
+	assert.Error(t, json.Unmarshal([]byte(`{"delay":"soon"}`), &got))
+}
@@ -6,10 +6,12 @@ require (
 	github.com/haoxins/rewrite v0.1.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/stretchr/testify v1.9.0
+	github.com/tetratelabs/wazero v1.7.3
+	github.com/yuin/gopher-lua v1.1.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,281 @@
+// Package graphql provides GraphQL-aware proxying: it parses the operation of GraphQL requests, names
+// the request after it in the metrics and logs of the mux, limits the rate of operations by name, and
+// serves automatic persisted queries at the edge, so clients can send query hashes to upstreams which
+// don't support them.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Operation types.
+const (
+	Query        = "query"
+	Mutation     = "mutation"
+	Subscription = "subscription"
+)
+
+// maxBodySize limits the request bodies read for parsing.
+const maxBodySize = 1 << 20
+
+var (
+	// ErrNotGraphQL is returned when parsing a request without a GraphQL operation.
+	ErrNotGraphQL = errors.New("not a graphql request")
+	// ErrBatch is returned when parsing a batch of operations, which isn't supported.
+	ErrBatch = errors.New("batched graphql operations are not supported")
+	// ErrInvalidDocument is returned when the query document or the operation can't be determined.
+	ErrInvalidDocument = errors.New("invalid graphql document")
+)
+
+// Operation is the GraphQL operation of a request.
+type Operation struct {
+	// Type is the operation type: query, mutation or subscription. It's empty until the query of a
+	// persisted query hash is known.
+	Type string
+	// Name is the operation name, or empty for anonymous operations.
+	Name      string
+	Query     string
+	Variables map[string]any
+	// Hash is the SHA-256 hash of the query of the automatic persisted queries extension.
+	Hash string
+
+	// fields are the fields of a JSON request body.
+	fields map[string]json.RawMessage
+}
+
+// Parse parses the GraphQL operation of a GET request with query parameters, or a POST request with a
+// JSON or application/graphql body. The request body is replaced, so it can still be forwarded.
+// ErrNotGraphQL is returned for other requests.
+func Parse(r *http.Request) (*Operation, error) {
+	op := &Operation{}
+	var name, variables, extensions string
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		op.Query, name = q.Get("query"), q.Get("operationName")
+		variables, extensions = q.Get("variables"), q.Get("extensions")
+	case http.MethodPost:
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/graphql":
+			op.Query = string(body)
+		case "application/json":
+			if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+				return nil, ErrBatch
+			}
+			if err := json.Unmarshal(body, &op.fields); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+			}
+			_ = json.Unmarshal(op.fields["query"], &op.Query)
+			_ = json.Unmarshal(op.fields["operationName"], &name)
+			variables, extensions = string(op.fields["variables"]), string(op.fields["extensions"])
+		default:
+			return nil, ErrNotGraphQL
+		}
+	default:
+		return nil, ErrNotGraphQL
+	}
+	if variables != "" && variables != "null" {
+		if err := json.Unmarshal([]byte(variables), &op.Variables); err != nil {
+			return nil, fmt.Errorf("%w: invalid variables: %v", ErrInvalidDocument, err)
+		}
+	}
+	if extensions != "" {
+		var ext struct {
+			PersistedQuery struct {
+				Hash string `json:"sha256Hash"`
+			} `json:"persistedQuery"`
+		}
+		if err := json.Unmarshal([]byte(extensions), &ext); err != nil {
+			return nil, fmt.Errorf("%w: invalid extensions: %v", ErrInvalidDocument, err)
+		}
+		op.Hash = ext.PersistedQuery.Hash
+	}
+	if op.Query == "" && op.Hash == "" {
+		return nil, ErrNotGraphQL
+	}
+	op.Name = name
+	if op.Query != "" {
+		if err := op.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// readBody reads the request body and replaces it, so it can still be forwarded.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > maxBodySize {
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrInvalidDocument, maxBodySize)
+	}
+	return body, nil
+}
+
+// resolve determines the type and name of the operation from its query document.
+func (op *Operation) resolve() error {
+	ops, err := operations(op.Query)
+	if err != nil {
+		return err
+	}
+	switch {
+	case op.Name != "":
+		for _, def := range ops {
+			if def.name == op.Name {
+				op.Type = def.typ
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidDocument, op.Name)
+	case len(ops) == 1:
+		op.Type, op.Name = ops[0].typ, ops[0].name
+		return nil
+	case len(ops) == 0:
+		return fmt.Errorf("%w: no operation", ErrInvalidDocument)
+	default:
+		return fmt.Errorf("%w: operation name required", ErrInvalidDocument)
+	}
+}
+
+// definition is an operation definition of a query document.
+type definition struct {
+	typ  string
+	name string
+}
+
+// operations returns the operation definitions of the query document. It only scans the top-level
+// tokens of the document, the selection sets aren't validated.
+func operations(doc string) ([]definition, error) {
+	var defs []definition
+	depth := 0
+	// keyword is the operation or fragment keyword whose name is expected next
+	keyword := ""
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			end, err := skipString(doc, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '{' || c == '(' || c == '[':
+			if depth == 0 && c == '{' {
+				if keyword == "" {
+					defs = append(defs, definition{typ: Query})
+				}
+				keyword = ""
+			}
+			depth++
+			i++
+		case c == '}' || c == ')' || c == ']':
+			if depth == 0 {
+				return nil, fmt.Errorf("%w: unbalanced %q", ErrInvalidDocument, c)
+			}
+			depth--
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(doc) && isNameChar(doc[i]) {
+				i++
+			}
+			if depth > 0 {
+				continue
+			}
+			word := doc[start:i]
+			switch {
+			case keyword == "" && (word == Query || word == Mutation || word == Subscription):
+				keyword = word
+				defs = append(defs, definition{typ: word})
+			case keyword == "" && word == "fragment":
+				keyword = word
+			case keyword != "" && keyword != "fragment" && defs[len(defs)-1].name == "":
+				defs[len(defs)-1].name = word
+			}
+		default:
+			i++
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced brackets", ErrInvalidDocument)
+	}
+	return defs, nil
+}
+
+// skipString returns the index after the string or block string starting at i.
+func skipString(doc string, i int) (int, error) {
+	if strings.HasPrefix(doc[i:], `"""`) {
+		end := strings.Index(doc[i+3:], `"""`)
+		for end >= 0 && doc[i+3+end-1] == '\\' {
+			next := strings.Index(doc[i+3+end+3:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += 3 + next
+		}
+		if end < 0 {
+			return 0, fmt.Errorf("%w: unterminated block string", ErrInvalidDocument)
+		}
+		return i + 3 + end + 3, nil
+	}
+	for j := i + 1; j < len(doc); j++ {
+		switch doc[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		case '\n':
+			return 0, fmt.Errorf("%w: unterminated string", ErrInvalidDocument)
+		}
+	}
+	return 0, fmt.Errorf("%w: unterminated string", ErrInvalidDocument)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// operationKey is the context key of the operation.
+type operationKey struct{}
+
+// WithOperation returns a copy of ctx holding the operation.
+func WithOperation(ctx context.Context, op *Operation) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// FromContext returns the operation of ctx stored by the Middleware, or nil.
+func FromContext(ctx context.Context) *Operation {
+	op, _ := ctx.Value(operationKey{}).(*Operation)
+	return op
+}
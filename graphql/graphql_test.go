@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		ctype    string
+		body     string
+		query    string
+		wantType string
+		wantName string
+		wantErr  error
+	}{
+		{"Test shorthand query", "POST", "application/json", `{"query":"{ user { id } }"}`, "", Query, "", nil},
+		{"Test named mutation", "POST", "application/json", `{"query":"mutation AddUser($name: String) { addUser(name: $name) { id } }","variables":{"name":"a"}}`, "", Mutation, "AddUser", nil},
+		{"Test selected operation", "POST", "application/json", `{"query":"query A { a } subscription B { b }","operationName":"B"}`, "", Subscription, "B", nil},
+		{"Test fragments and strings", "POST", "application/json", `{"query":"fragment F on User { id } # mutation X\nquery Q { user(name: \"mutation }\") { ...F } }"}`, "", Query, "Q", nil},
+		{"Test graphql body", "POST", "application/graphql", `query Me { me { id } }`, "", Query, "Me", nil},
+		{"Test GET", "GET", "", "", "query=" + url.QueryEscape("query Me { me }"), Query, "Me", nil},
+		{"Test missing operation name", "POST", "application/json", `{"query":"query A { a } query B { b }"}`, "", "", "", ErrInvalidDocument},
+		{"Test unknown operation name", "POST", "application/json", `{"query":"query A { a }","operationName":"B"}`, "", "", "", ErrInvalidDocument},
+		{"Test unbalanced", "POST", "application/json", `{"query":"query A { a "}`, "", "", "", ErrInvalidDocument},
+		{"Test batch", "POST", "application/json", `[{"query":"{ a }"}]`, "", "", "", ErrBatch},
+		{"Test other media type", "POST", "text/plain", `{ a }`, "", "", "", ErrNotGraphQL},
+		{"Test no query", "GET", "", "", "", "", "", ErrNotGraphQL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/graphql?"+tt.query, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.ctype)
+			op, err := Parse(r)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, op.Type)
+			assert.Equal(t, tt.wantName, op.Name)
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+// newGraphQLTestMux creates a mux proxying /graphql with the middleware to an origin echoing the query
+// of the requests, and returns the reported operations.
+func newGraphQLTestMux(t *testing.T, opts Options) (*reverseproxy.ReverseProxyMux, *[]string) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, err := Parse(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, op.Query)
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, pm.AddRoute(reverseproxy.Route{Method: []string{"GET", "POST"}, Path: "/graphql"}))
+	pm.Use(Middleware(opts))
+	var operations []string
+	pm.AddMetricsHook(func(m reverseproxy.RequestMetrics) {
+		operations = append(operations, m.Operation)
+	})
+	return pm, &operations
+}
+
+func post(pm http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	pm.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware_Operation(t *testing.T) {
+	pm, operations := newGraphQLTestMux(t, Options{})
+
+	w := post(pm, `{"query":"query Me { me }"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "query Me { me }", w.Body.String())
+	post(pm, `{"query":"mutation { a }"}`)
+	assert.Equal(t, []string{"Me", Mutation}, *operations)
+}
+
+func TestMiddleware_RejectInvalid(t *testing.T) {
+	pm, _ := newGraphQLTestMux(t, Options{RejectInvalid: true})
+
+	w := post(pm, `{"query":"query A { a } query B { b }"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"errors":[{"message":"invalid graphql document: operation name required"}]`)
+}
+
+func TestMiddleware_RateLimit(t *testing.T) {
+	pm, _ := newGraphQLTestMux(t, Options{RateLimits: map[string]RateLimit{"Search": {Rate: 0.1, Burst: 2}}})
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, post(pm, `{"query":"query Search { a }"}`).Code)
+	}
+	w := post(pm, `{"query":"query Search { a }"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"RATE_LIMITED"`)
+	assert.Equal(t, http.StatusOK, post(pm, `{"query":"query Other { a }"}`).Code)
+}
+
+func TestMiddleware_PersistedQueries(t *testing.T) {
+	store := NewQueryStore(10)
+	pm, operations := newGraphQLTestMux(t, Options{PersistedQueries: store})
+	query := "query Me { me }"
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	persisted := `{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+	ext := `"extensions":` + persisted
+
+	w := post(pm, `{`+ext+`}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "PERSISTED_QUERY_NOT_FOUND")
+
+	w = post(pm, `{"query":"query Other { a }",`+ext+`}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 0, store.Len())
+
+	w = post(pm, `{"query":"`+query+`",`+ext+`}`)
+	assert.Equal(t, query, w.Body.String())
+	assert.Equal(t, 1, store.Len())
+
+	w = post(pm, `{`+ext+`}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, query, w.Body.String())
+
+	w = httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?extensions="+url.QueryEscape(persisted), nil))
+	assert.Equal(t, query, w.Body.String())
+	assert.Equal(t, []string{"", "", "Me", "Me", "Me"}, *operations)
+}
+
+func TestQueryStore(t *testing.T) {
+	s := NewQueryStore(2)
+	s.Put("a", "{ a }")
+	s.Put("b", "{ b }")
+	_, _ = s.Get("a")
+	s.Put("c", "{ c }")
+
+	_, ok := s.Get("b")
+	assert.False(t, ok)
+	q, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "{ a }", q)
+	assert.Equal(t, 2, s.Len())
+}
@@ -0,0 +1,240 @@
+package graphql
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// RateLimit is a token bucket limit of the requests of an operation.
+type RateLimit struct {
+	// Rate is the number of requests per second.
+	Rate float64
+	// Burst is the number of requests allowed at once, 1 if zero.
+	Burst int
+}
+
+// Options configure the GraphQL Middleware.
+type Options struct {
+	// RateLimits limits the rate of the operations by name. The requests exceeding the limit are
+	// rejected with HTTP 429 too many requests and a Retry-After header. The operations which aren't
+	// listed are unlimited.
+	RateLimits map[string]RateLimit
+	// PersistedQueries stores the queries of the automatic persisted queries extension, if not nil.
+	// Requests sending only the hash of a stored query are forwarded with the query, others are answered
+	// with a PersistedQueryNotFound error, so the client retries with the query.
+	PersistedQueries *QueryStore
+	// RejectInvalid answers the requests with an invalid GraphQL document with HTTP 400 bad request,
+	// instead of forwarding them.
+	RejectInvalid bool
+}
+
+// Middleware returns middleware parsing the GraphQL operations of the requests, see Parse, and storing
+// them in the request context, see FromContext. The operation name is set as the operation of the
+// request in the metrics and logs of the mux. Requests without a GraphQL operation are passed on
+// unchanged. Register it with Use or UseGroup on the GraphQL routes.
+func Middleware(opts Options) reverseproxy.Middleware {
+	limiters := make(map[string]*bucket, len(opts.RateLimits))
+	for name, limit := range opts.RateLimits {
+		limiters[name] = newBucket(limit)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, err := Parse(r)
+			switch {
+			case errors.Is(err, ErrNotGraphQL):
+				next.ServeHTTP(w, r)
+				return
+			case err != nil:
+				if opts.RejectInvalid {
+					writeError(w, http.StatusBadRequest, err.Error(), "")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if op.Hash != "" && opts.PersistedQueries != nil {
+				if ok := persist(w, r, op, opts.PersistedQueries); !ok {
+					return
+				}
+			}
+			name := op.Name
+			if name == "" {
+				name = op.Type
+			}
+			reverseproxy.SetOperation(r, name)
+			reverseproxy.TraceFromContext(r.Context()).Add("graphql", op.Type+" "+op.Name)
+			if b := limiters[op.Name]; b != nil {
+				if wait := b.take(); wait > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					writeError(w, http.StatusTooManyRequests, "rate limit of operation "+op.Name+" exceeded", "RATE_LIMITED")
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(WithOperation(r.Context(), op)))
+		})
+	}
+}
+
+// persist handles the persisted query hash of the operation: it stores the query sent with the hash,
+// or restores the query of a hash sent alone into the request. It returns false if the request was
+// answered with an error.
+func persist(w http.ResponseWriter, r *http.Request, op *Operation, store *QueryStore) bool {
+	if op.Query != "" {
+		sum := sha256.Sum256([]byte(op.Query))
+		if hex.EncodeToString(sum[:]) != op.Hash {
+			writeError(w, http.StatusBadRequest, "provided sha does not match query", "")
+			return false
+		}
+		store.Put(op.Hash, op.Query)
+		return true
+	}
+	query, ok := store.Get(op.Hash)
+	if !ok {
+		writeError(w, http.StatusOK, "PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+		return false
+	}
+	op.Query = query
+	if err := op.resolve(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+		return false
+	}
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		q.Set("query", query)
+		r.URL.RawQuery = q.Encode()
+		return true
+	}
+	if op.fields == nil {
+		op.fields = make(map[string]json.RawMessage)
+	}
+	op.fields["query"], _ = json.Marshal(query)
+	body, _ := json.Marshal(op.fields)
+	r.Body = readCloser{bytes.NewReader(body)}
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	r.Header.Set("Content-Type", "application/json")
+	return true
+}
+
+// readCloser is a request body without resources to close.
+type readCloser struct {
+	*bytes.Reader
+}
+
+// Close implements io.Closer.
+func (readCloser) Close() error {
+	return nil
+}
+
+// writeError writes a GraphQL error response.
+func writeError(w http.ResponseWriter, status int, msg, code string) {
+	type gqlError struct {
+		Message    string            `json:"message"`
+		Extensions map[string]string `json:"extensions,omitempty"`
+	}
+	e := gqlError{Message: msg}
+	if code != "" {
+		e.Extensions = map[string]string{"code": code}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string][]gqlError{"errors": {e}})
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket creates a full token bucket of the limit.
+func newBucket(limit RateLimit) *bucket {
+	burst := float64(max(limit.Burst, 1))
+	return &bucket{rate: limit.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take takes a token, returning zero, or the time until a token is available if the bucket is empty.
+func (b *bucket) take() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// QueryStore is an in-memory store of persisted queries keyed by their hash, evicting the least recently
+// used queries beyond its capacity.
+type QueryStore struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// queryEntry is an entry of the query store.
+type queryEntry struct {
+	hash  string
+	query string
+}
+
+// NewQueryStore creates a query store holding up to max queries.
+func NewQueryStore(max int) *QueryStore {
+	return &QueryStore{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the query of the hash.
+func (s *QueryStore) Get(hash string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[hash]
+	if !ok {
+		return "", false
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*queryEntry).query, true
+}
+
+// Put stores the query of the hash.
+func (s *QueryStore) Put(hash, query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[hash]; ok {
+		s.order.MoveToFront(e)
+		return
+	}
+	s.entries[hash] = s.order.PushFront(&queryEntry{hash: hash, query: query})
+	for s.max > 0 && s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*queryEntry).hash)
+	}
+}
+
+// Len returns the number of stored queries.
+func (s *QueryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
@@ -0,0 +1,134 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrGroupPaused is returned by PauseGroup when the route group is already paused.
+var ErrGroupPaused = errors.New("route group is already paused")
+
+// groupGate holds back the requests of a route group while the group is paused.
+type groupGate struct {
+	mu       sync.Mutex
+	inflight int
+	idle     chan struct{}
+	resume   chan struct{}
+	maxWait  time.Duration
+}
+
+// enter waits until the group isn't paused and registers an in-flight request. It returns false
+// when the group wasn't resumed within the wait time of the pause or the context is done.
+func (g *groupGate) enter(ctx context.Context) bool {
+	var timeout <-chan time.Time
+	for {
+		g.mu.Lock()
+		resume := g.resume
+		if resume == nil {
+			g.inflight++
+			g.mu.Unlock()
+			return true
+		}
+		if timeout == nil {
+			t := time.NewTimer(g.maxWait)
+			defer t.Stop()
+			timeout = t.C
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-resume:
+		case <-timeout:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// leave unregisters an in-flight request.
+func (g *groupGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inflight--
+	if g.inflight == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// pause holds back new requests and waits for the in-flight requests to complete.
+func (g *groupGate) pause(ctx context.Context, maxWait time.Duration) (func(), error) {
+	g.mu.Lock()
+	if g.resume != nil {
+		g.mu.Unlock()
+		return nil, ErrGroupPaused
+	}
+	g.resume = make(chan struct{})
+	g.maxWait = maxWait
+	var idle chan struct{}
+	if g.inflight > 0 {
+		g.idle = make(chan struct{})
+		idle = g.idle
+	}
+	g.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			close(g.resume)
+			g.resume = nil
+			g.idle = nil
+		})
+	}
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// isPaused returns whether the group is paused.
+func (g *groupGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// groupGate returns the gate of the named route group, creating it if needed.
+func (pm *ReverseProxyMux) groupGate(group string) *groupGate {
+	pm.groupsMu.Lock()
+	defer pm.groupsMu.Unlock()
+	if pm.groups == nil {
+		pm.groups = make(map[string]*groupGate)
+	}
+	gate, ok := pm.groups[group]
+	if !ok {
+		gate = &groupGate{}
+		pm.groups[group] = gate
+	}
+	return gate
+}
+
+// PauseGroup atomically pauses the routes of the named group, e.g. while a backend migration runs.
+// New requests of the group are held back for up to maxWait and are answered with HTTP 503 service
+// unavailable afterwards. PauseGroup blocks until the in-flight requests of the group are completed,
+// so the caller gets exclusive access to the backend until the returned release func is called.
+// If ctx is done before the in-flight requests complete, the group is resumed and the context error
+// is returned.
+func (pm *ReverseProxyMux) PauseGroup(ctx context.Context, group string, maxWait time.Duration) (release func(), err error) {
+	return pm.groupGate(group).pause(ctx, maxWait)
+}
+
+// IsGroupPaused returns whether the named route group is paused.
+func (pm *ReverseProxyMux) IsGroupPaused(group string) bool {
+	return pm.groupGate(group).isPaused()
+}
@@ -0,0 +1,85 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGroupTestMux(t *testing.T, handler http.HandlerFunc) *ReverseProxyMux {
+	origin := httptest.NewServer(handler)
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/billing").SetGroup("billing"))
+	pm.PassPath("GET", "/users")
+	return pm
+}
+
+func TestPauseGroupTimeout(t *testing.T) {
+	pm := newGroupTestMux(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	release, err := pm.PauseGroup(context.Background(), "billing", 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer release()
+	assert.True(t, pm.IsGroupPaused("billing"))
+
+	_, err = pm.PauseGroup(context.Background(), "billing", time.Second)
+	assert.ErrorIs(t, err, ErrGroupPaused)
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(pm, "GET", "/billing").Code)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code, "other routes shouldn't be paused")
+}
+
+func TestPauseGroupRelease(t *testing.T) {
+	pm := newGroupTestMux(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	release, err := pm.PauseGroup(context.Background(), "billing", time.Minute)
+	assert.NoError(t, err)
+
+	done := make(chan int)
+	go func() {
+		done <- serve(pm, "GET", "/billing").Code
+	}()
+	select {
+	case <-done:
+		t.Fatal("request should be held back while the group is paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.False(t, pm.IsGroupPaused("billing"))
+}
+
+func TestPauseGroupWaitsForInflight(t *testing.T) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	pm := newGroupTestMux(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	})
+
+	go serve(pm, "GET", "/billing")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := pm.PauseGroup(ctx, "billing", time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, pm.IsGroupPaused("billing"), "the group should be resumed after a failed pause")
+
+	paused := make(chan func())
+	go func() {
+		release, err := pm.PauseGroup(context.Background(), "billing", time.Minute)
+		assert.NoError(t, err)
+		paused <- release
+	}()
+	close(finish)
+	release := <-paused
+	release()
+}
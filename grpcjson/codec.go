@@ -0,0 +1,444 @@
+package grpcjson
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// marshal encodes the JSON object into a protobuf message of the type in field number order, following
+// the protojson mapping: fields are named by their JSON or proto names, 64-bit integers may be strings,
+// enums are names or numbers and bytes are base64.
+func marshal(m *message, obj map[string]any) ([]byte, error) {
+	for k := range obj {
+		if _, ok := m.byName[k]; !ok {
+			return nil, fmt.Errorf("grpcjson: unknown field %q of %s", k, m.name)
+		}
+	}
+	var b []byte
+	for _, f := range m.fields {
+		v, ok := obj[f.jsonName]
+		if !ok {
+			v = obj[f.name]
+		}
+		if v == nil {
+			continue
+		}
+		var err error
+		switch {
+		case f.message != nil && f.message.mapEntry:
+			b, err = appendMap(b, f, v)
+		case f.repeated:
+			b, err = appendRepeated(b, f, v)
+		default:
+			b, err = appendValue(b, f, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMap appends the entries of a map field, sorted by key.
+func appendMap(b []byte, f *field, v any) ([]byte, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fieldError(f, v)
+	}
+	key, val := f.message.byNumber[1], f.message.byNumber[2]
+	if key == nil || val == nil {
+		return nil, fmt.Errorf("grpcjson: invalid map entry %s", f.message.name)
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var kv any = k
+		if key.typ == typeBool {
+			kv = k == "true"
+		}
+		entry, err := appendValue(nil, key, kv)
+		if err != nil {
+			return nil, err
+		}
+		if obj[k] != nil {
+			if entry, err = appendValue(entry, val, obj[k]); err != nil {
+				return nil, err
+			}
+		}
+		b = appendBytes(b, f.number, entry)
+	}
+	return b, nil
+}
+
+// appendRepeated appends the elements of a repeated field, packed if the field is.
+func appendRepeated(b []byte, f *field, v any) ([]byte, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fieldError(f, v)
+	}
+	if !f.packed {
+		for _, e := range list {
+			var err error
+			if b, err = appendValue(b, f, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	var packed []byte
+	for _, e := range list {
+		var err error
+		if packed, _, err = appendScalar(packed, f, e); err != nil {
+			return nil, err
+		}
+	}
+	return appendBytes(b, f.number, packed), nil
+}
+
+// appendValue appends a single value of the field with its key.
+func appendValue(b []byte, f *field, v any) ([]byte, error) {
+	switch f.typ {
+	case typeMessage:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fieldError(f, v)
+		}
+		data, err := marshal(f.message, obj)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(b, f.number, data), nil
+	case typeString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fieldError(f, v)
+		}
+		return appendBytes(b, f.number, []byte(s)), nil
+	case typeBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fieldError(f, v)
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if data, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, fieldError(f, v)
+			}
+		}
+		return appendBytes(b, f.number, data), nil
+	}
+	data, wt, err := appendScalar(nil, f, v)
+	if err != nil {
+		return nil, err
+	}
+	return append(appendKey(b, f.number, wt), data...), nil
+}
+
+// appendScalar appends a numeric, bool or enum value without key, returning its wire type.
+func appendScalar(b []byte, f *field, v any) ([]byte, int, error) {
+	switch f.typ {
+	case typeBool:
+		t, ok := v.(bool)
+		if !ok {
+			return nil, 0, fieldError(f, v)
+		}
+		var u uint64
+		if t {
+			u = 1
+		}
+		return binary.AppendUvarint(b, u), wireVarint, nil
+	case typeEnum:
+		if s, ok := v.(string); ok {
+			n, ok := f.enum.numbers[s]
+			if !ok {
+				return nil, 0, fieldError(f, v)
+			}
+			return binary.AppendUvarint(b, uint64(int64(n))), wireVarint, nil
+		}
+		n, err := parseInt(v, 32)
+		if err != nil {
+			return nil, 0, fieldError(f, v)
+		}
+		return binary.AppendUvarint(b, uint64(n)), wireVarint, nil
+	case typeDouble, typeFloat:
+		x, err := parseFloat(v)
+		if err != nil {
+			return nil, 0, fieldError(f, v)
+		}
+		if f.typ == typeFloat {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(x))), wireFixed32, nil
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(x)), wireFixed64, nil
+	case typeUint32, typeUint64, typeFixed32, typeFixed64:
+		bits := 64
+		if f.typ == typeUint32 || f.typ == typeFixed32 {
+			bits = 32
+		}
+		u, err := parseUint(v, bits)
+		if err != nil {
+			return nil, 0, fieldError(f, v)
+		}
+		switch f.typ {
+		case typeFixed32:
+			return binary.LittleEndian.AppendUint32(b, uint32(u)), wireFixed32, nil
+		case typeFixed64:
+			return binary.LittleEndian.AppendUint64(b, u), wireFixed64, nil
+		}
+		return binary.AppendUvarint(b, u), wireVarint, nil
+	case typeInt32, typeInt64, typeSint32, typeSint64, typeSfixed32, typeSfixed64:
+		bits := 64
+		if f.typ == typeInt32 || f.typ == typeSint32 || f.typ == typeSfixed32 {
+			bits = 32
+		}
+		n, err := parseInt(v, bits)
+		if err != nil {
+			return nil, 0, fieldError(f, v)
+		}
+		switch f.typ {
+		case typeSint32, typeSint64:
+			return binary.AppendUvarint(b, uint64(n<<1)^uint64(n>>63)), wireVarint, nil
+		case typeSfixed32:
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), wireFixed32, nil
+		case typeSfixed64:
+			return binary.LittleEndian.AppendUint64(b, uint64(n)), wireFixed64, nil
+		}
+		return binary.AppendUvarint(b, uint64(n)), wireVarint, nil
+	}
+	return nil, 0, fieldError(f, v)
+}
+
+// parseInt parses a JSON number or string as a signed integer of the bit size.
+func parseInt(v any, bits int) (int64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return strconv.ParseInt(v.String(), 10, bits)
+	case string:
+		return strconv.ParseInt(v, 10, bits)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+// parseUint parses a JSON number or string as an unsigned integer of the bit size.
+func parseUint(v any, bits int) (uint64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return strconv.ParseUint(v.String(), 10, bits)
+	case string:
+		return strconv.ParseUint(v, 10, bits)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+// parseFloat parses a JSON number or string as a float, accepting NaN and Infinity strings.
+func parseFloat(v any) (float64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		switch v {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+// fieldError returns the error of an invalid value of the field.
+func fieldError(f *field, v any) error {
+	return fmt.Errorf("grpcjson: invalid value %v of field %q", v, f.jsonName)
+}
+
+// unmarshal decodes a protobuf message of the type into a JSON object, named by the JSON names of the
+// fields. Unknown fields are dropped, and fields with default values are absent, as on the wire.
+func unmarshal(m *message, b []byte) (map[string]any, error) {
+	obj := make(map[string]any)
+	err := readFields(b, func(w wireField) error {
+		f, ok := m.byNumber[w.num]
+		if !ok {
+			return nil
+		}
+		switch {
+		case f.message != nil && f.message.mapEntry:
+			entry, err := unmarshal(f.message, w.data)
+			if err != nil {
+				return err
+			}
+			key, val := f.message.byNumber[1], f.message.byNumber[2]
+			if key == nil || val == nil {
+				return fmt.Errorf("grpcjson: invalid map entry %s", f.message.name)
+			}
+			k, v := entry[key.jsonName], entry[val.jsonName]
+			if k == nil {
+				k = zero(key)
+			}
+			if v == nil {
+				v = zero(val)
+			}
+			mv, _ := obj[f.jsonName].(map[string]any)
+			if mv == nil {
+				mv = make(map[string]any)
+				obj[f.jsonName] = mv
+			}
+			mv[mapKey(k)] = v
+		case f.repeated && w.typ == wireBytes && isPackable(f.typ):
+			list, _ := obj[f.jsonName].([]any)
+			err := readPacked(f, w.data, func(v any) {
+				list = append(list, v)
+			})
+			if err != nil {
+				return err
+			}
+			obj[f.jsonName] = list
+		default:
+			v, err := decodeValue(f, w)
+			if err != nil {
+				return err
+			}
+			if f.repeated {
+				list, _ := obj[f.jsonName].([]any)
+				obj[f.jsonName] = append(list, v)
+			} else {
+				obj[f.jsonName] = v
+			}
+		}
+		return nil
+	})
+	return obj, err
+}
+
+// readPacked calls fn for each element of a packed repeated field.
+func readPacked(f *field, b []byte, fn func(any)) error {
+	for len(b) > 0 {
+		w := wireField{num: f.number}
+		switch f.typ {
+		case typeDouble, typeFixed64, typeSfixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			w.typ, w.val, b = wireFixed64, binary.LittleEndian.Uint64(b), b[8:]
+		case typeFloat, typeFixed32, typeSfixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			w.typ, w.val, b = wireFixed32, uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			u, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			w.typ, w.val, b = wireVarint, u, b[n:]
+		}
+		v, err := decodeValue(f, w)
+		if err != nil {
+			return err
+		}
+		fn(v)
+	}
+	return nil
+}
+
+// decodeValue decodes a single value of the field. 64-bit integers are strings, as in protojson.
+func decodeValue(f *field, w wireField) (any, error) {
+	switch f.typ {
+	case typeMessage:
+		if w.typ != wireBytes {
+			return nil, wireError(f)
+		}
+		return unmarshal(f.message, w.data)
+	case typeString:
+		if w.typ != wireBytes {
+			return nil, wireError(f)
+		}
+		return string(w.data), nil
+	case typeBytes:
+		if w.typ != wireBytes {
+			return nil, wireError(f)
+		}
+		return base64.StdEncoding.EncodeToString(w.data), nil
+	}
+	if w.typ == wireBytes {
+		return nil, wireError(f)
+	}
+	switch f.typ {
+	case typeBool:
+		return w.val != 0, nil
+	case typeEnum:
+		if name, ok := f.enum.names[int32(w.val)]; ok {
+			return name, nil
+		}
+		return int64(int32(w.val)), nil
+	case typeDouble:
+		return jsonFloat(math.Float64frombits(w.val)), nil
+	case typeFloat:
+		return jsonFloat(float64(math.Float32frombits(uint32(w.val)))), nil
+	case typeInt32, typeSfixed32:
+		return int64(int32(w.val)), nil
+	case typeSint32:
+		return int64(int32(uint32(w.val)>>1) ^ -int32(w.val&1)), nil
+	case typeUint32, typeFixed32:
+		return uint64(uint32(w.val)), nil
+	case typeInt64, typeSfixed64:
+		return strconv.FormatInt(int64(w.val), 10), nil
+	case typeSint64:
+		return strconv.FormatInt(int64(w.val>>1)^-int64(w.val&1), 10), nil
+	case typeUint64, typeFixed64:
+		return strconv.FormatUint(w.val, 10), nil
+	}
+	return nil, wireError(f)
+}
+
+// jsonFloat returns the float, or its protojson string if it isn't finite.
+func jsonFloat(x float64) any {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case math.IsInf(x, 1):
+		return "Infinity"
+	case math.IsInf(x, -1):
+		return "-Infinity"
+	}
+	return x
+}
+
+// zero returns the JSON value of the default of the field.
+func zero(f *field) any {
+	switch f.typ {
+	case typeMessage:
+		return map[string]any{}
+	case typeString, typeBytes:
+		return ""
+	case typeBool:
+		return false
+	case typeEnum:
+		if name, ok := f.enum.names[0]; ok {
+			return name
+		}
+		return 0
+	case typeInt64, typeUint64, typeSint64, typeFixed64, typeSfixed64:
+		return "0"
+	}
+	return 0
+}
+
+// mapKey formats a decoded map key as a JSON object key.
+func mapKey(k any) string {
+	return fmt.Sprint(k)
+}
+
+// wireError returns the error of a field encoded with an unexpected wire type.
+func wireError(f *field) error {
+	return fmt.Errorf("grpcjson: invalid wire type of field %q", f.jsonName)
+}
@@ -0,0 +1,95 @@
+package grpcjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeJSON(t *testing.T, s string) map[string]any {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var obj map[string]any
+	assert.NoError(t, dec.Decode(&obj))
+	return obj
+}
+
+func TestMarshal(t *testing.T) {
+	d, err := parseDescriptorSet(testDescriptorSet())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		message string
+		json    string
+		want    []byte
+	}{
+		{"Test scalars", "shop.v1.GetOrderRequest", `{"id":"42","verbose":true}`, []byte{0x08, 0x2a, 0x10, 0x01}},
+		{"Test proto name", "shop.v1.Order", `{"customer_id":"c1"}`, []byte{0x12, 0x02, 'c', '1'}},
+		{"Test packed", "shop.v1.Order", `{"quantities":[1,2,300]}`, []byte{0x1a, 0x04, 0x01, 0x02, 0xac, 0x02}},
+		{"Test unpacked strings", "shop.v1.GetOrderRequest", `{"tags":["a","b"]}`, []byte{0x22, 0x01, 'a', 0x22, 0x01, 'b'}},
+		{"Test enum name", "shop.v1.Order", `{"status":"SHIPPED"}`, []byte{0x20, 0x01}},
+		{"Test map", "shop.v1.Order", `{"labels":{"k":"v"}}`, []byte{0x2a, 0x06, 0x0a, 0x01, 'k', 0x12, 0x01, 'v'}},
+		{"Test nested", "shop.v1.GetOrderRequest", `{"filter":{"sku":"x"}}`, []byte{0x1a, 0x03, 0x0a, 0x01, 'x'}},
+		{"Test bytes", "shop.v1.Order", `{"token":"AQI="}`, []byte{0x3a, 0x02, 0x01, 0x02}},
+		{"Test sint32", "shop.v1.Order", `{"delta":-2}`, []byte{0x40, 0x03}},
+		{"Test null", "shop.v1.Order", `{"item":null}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshal(d.messages[tt.message], decodeJSON(t, tt.json))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+		})
+	}
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	d, err := parseDescriptorSet(testDescriptorSet())
+	assert.NoError(t, err)
+	order := d.messages["shop.v1.Order"]
+
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"Test unknown field", `{"other":1}`, `unknown field "other"`},
+		{"Test string for number", `{"quantities":["x"]}`, `field "quantities"`},
+		{"Test overflow", `{"quantities":[4294967296]}`, `field "quantities"`},
+		{"Test unknown enum", `{"status":"LOST"}`, `field "status"`},
+		{"Test scalar for message", `{"item":"x"}`, `field "item"`},
+		{"Test invalid base64", `{"token":"!"}`, `field "token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := marshal(order, decodeJSON(t, tt.json))
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	d, err := parseDescriptorSet(testDescriptorSet())
+	assert.NoError(t, err)
+	order := d.messages["shop.v1.Order"]
+
+	in := `{"id":"9007199254740993","customerId":"c1","quantities":[1,2,300],"status":"SHIPPED",` +
+		`"labels":{"k":"v","e":""},"item":{"sku":"x","price":1.5},"token":"AQI=","delta":-2}`
+	b, err := marshal(order, decodeJSON(t, in))
+	assert.NoError(t, err)
+	// unknown fields are dropped, unpacked repeated scalars are accepted
+	b = append(b, 0x48, 0x01, 0x18, 0x07)
+	obj, err := unmarshal(order, b)
+	assert.NoError(t, err)
+	out, _ := json.Marshal(obj)
+	assert.JSONEq(t, `{"id":"9007199254740993","customerId":"c1","quantities":[1,2,300,7],"status":"SHIPPED",`+
+		`"labels":{"k":"v","e":""},"item":{"sku":"x","price":1.5},"token":"AQI=","delta":-2}`, string(out))
+
+	_, err = unmarshal(order, []byte{0x12, 0x05, 'a'})
+	assert.ErrorIs(t, err, errTruncated)
+	_, err = unmarshal(order, []byte{0x10, 0x01})
+	assert.ErrorContains(t, err, "invalid wire type")
+}
@@ -0,0 +1,345 @@
+package grpcjson
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Field types of FieldDescriptorProto.
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+)
+
+// labelRepeated is the label of repeated fields.
+const labelRepeated = 3
+
+// message is a message type of the descriptors.
+type message struct {
+	name     string
+	fields   []*field
+	byNumber map[int32]*field
+	byName   map[string]*field
+	mapEntry bool
+}
+
+// field is a field of a message type.
+type field struct {
+	name     string
+	jsonName string
+	number   int32
+	typ      int
+	repeated bool
+	packed   bool
+	typeName string
+	message  *message
+	enum     *enum
+}
+
+// enum is an enum type of the descriptors.
+type enum struct {
+	names   map[int32]string
+	numbers map[string]int32
+}
+
+// rpc is an RPC method of the descriptors.
+type rpc struct {
+	// name is the full name of the method, e.g. shop.v1.Orders/GetOrder.
+	name            string
+	clientStreaming bool
+	serverStreaming bool
+	input           *message
+	output          *message
+}
+
+// descriptors holds the types and methods of a FileDescriptorSet.
+type descriptors struct {
+	messages map[string]*message
+	enums    map[string]*enum
+	methods  map[string]*rpc
+}
+
+// parseDescriptorSet parses an encoded FileDescriptorSet, as written by protoc --descriptor_set_out
+// with --include_imports, and resolves the field types.
+func parseDescriptorSet(b []byte) (*descriptors, error) {
+	d := &descriptors{messages: make(map[string]*message), enums: make(map[string]*enum), methods: make(map[string]*rpc)}
+	type pendingMethod struct {
+		m             *rpc
+		input, output string
+	}
+	var methods []pendingMethod
+	err := readFields(b, func(f wireField) error {
+		if f.num != 1 || f.typ != wireBytes {
+			return nil
+		}
+		// FileDescriptorProto
+		var pkg, syntax string
+		var messages, enums, services [][]byte
+		err := readFields(f.data, func(f wireField) error {
+			switch f.num {
+			case 2:
+				pkg = string(f.data)
+			case 4:
+				messages = append(messages, f.data)
+			case 5:
+				enums = append(enums, f.data)
+			case 6:
+				services = append(services, f.data)
+			case 12:
+				syntax = string(f.data)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		scope := ""
+		if pkg != "" {
+			scope = pkg + "."
+		}
+		for _, m := range messages {
+			if err := d.parseMessage(m, scope, syntax == "proto3"); err != nil {
+				return err
+			}
+		}
+		for _, e := range enums {
+			if err := d.parseEnum(e, scope); err != nil {
+				return err
+			}
+		}
+		for _, s := range services {
+			var service string
+			var ms [][]byte
+			err := readFields(s, func(f wireField) error {
+				switch f.num {
+				case 1:
+					service = string(f.data)
+				case 2:
+					ms = append(ms, f.data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, mb := range ms {
+				pm := pendingMethod{m: &rpc{}}
+				var name string
+				err := readFields(mb, func(f wireField) error {
+					switch f.num {
+					case 1:
+						name = string(f.data)
+					case 2:
+						pm.input = strings.TrimPrefix(string(f.data), ".")
+					case 3:
+						pm.output = strings.TrimPrefix(string(f.data), ".")
+					case 5:
+						pm.m.clientStreaming = f.val != 0
+					case 6:
+						pm.m.serverStreaming = f.val != 0
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				pm.m.name = scope + service + "/" + name
+				methods = append(methods, pm)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range d.messages {
+		for _, f := range m.fields {
+			switch f.typ {
+			case typeMessage:
+				if f.message = d.messages[f.typeName]; f.message == nil {
+					return nil, fmt.Errorf("grpcjson: unknown message type %s of field %s.%s", f.typeName, m.name, f.name)
+				}
+			case typeEnum:
+				if f.enum = d.enums[f.typeName]; f.enum == nil {
+					return nil, fmt.Errorf("grpcjson: unknown enum type %s of field %s.%s", f.typeName, m.name, f.name)
+				}
+			case typeGroup:
+				return nil, fmt.Errorf("grpcjson: unsupported group field %s.%s", m.name, f.name)
+			}
+		}
+	}
+	for _, pm := range methods {
+		if pm.m.input = d.messages[pm.input]; pm.m.input == nil {
+			return nil, fmt.Errorf("grpcjson: unknown input type %s of method %s", pm.input, pm.m.name)
+		}
+		if pm.m.output = d.messages[pm.output]; pm.m.output == nil {
+			return nil, fmt.Errorf("grpcjson: unknown output type %s of method %s", pm.output, pm.m.name)
+		}
+		d.methods[pm.m.name] = pm.m
+	}
+	return d, nil
+}
+
+// parseMessage parses a DescriptorProto and its nested types in the scope.
+func (d *descriptors) parseMessage(b []byte, scope string, proto3 bool) error {
+	m := &message{byNumber: make(map[int32]*field), byName: make(map[string]*field)}
+	var nested, enums [][]byte
+	err := readFields(b, func(f wireField) error {
+		switch f.num {
+		case 1:
+			m.name = scope + string(f.data)
+		case 2:
+			fd, err := parseField(f.data, proto3)
+			if err != nil {
+				return err
+			}
+			m.fields = append(m.fields, fd)
+		case 3:
+			nested = append(nested, f.data)
+		case 4:
+			enums = append(enums, f.data)
+		case 7:
+			// MessageOptions
+			return readFields(f.data, func(o wireField) error {
+				if o.num == 7 {
+					m.mapEntry = o.val != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(m.fields, func(i, j int) bool {
+		return m.fields[i].number < m.fields[j].number
+	})
+	for _, f := range m.fields {
+		m.byNumber[f.number] = f
+		m.byName[f.name] = f
+		m.byName[f.jsonName] = f
+	}
+	d.messages[m.name] = m
+	for _, n := range nested {
+		if err := d.parseMessage(n, m.name+".", proto3); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := d.parseEnum(e, m.name+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseField parses a FieldDescriptorProto.
+func parseField(b []byte, proto3 bool) (*field, error) {
+	f := &field{}
+	packed := proto3
+	err := readFields(b, func(w wireField) error {
+		switch w.num {
+		case 1:
+			f.name = string(w.data)
+		case 3:
+			f.number = int32(w.val)
+		case 4:
+			f.repeated = w.val == labelRepeated
+		case 5:
+			f.typ = int(w.val)
+		case 6:
+			f.typeName = strings.TrimPrefix(string(w.data), ".")
+		case 8:
+			// FieldOptions
+			return readFields(w.data, func(o wireField) error {
+				if o.num == 2 {
+					packed = o.val != 0
+				}
+				return nil
+			})
+		case 10:
+			f.jsonName = string(w.data)
+		}
+		return nil
+	})
+	if f.jsonName == "" {
+		f.jsonName = jsonName(f.name)
+	}
+	f.packed = f.repeated && packed && isPackable(f.typ)
+	return f, err
+}
+
+// parseEnum parses an EnumDescriptorProto in the scope.
+func (d *descriptors) parseEnum(b []byte, scope string) error {
+	e := &enum{names: make(map[int32]string), numbers: make(map[string]int32)}
+	var name string
+	err := readFields(b, func(f wireField) error {
+		switch f.num {
+		case 1:
+			name = string(f.data)
+		case 2:
+			var vname string
+			var number int32
+			err := readFields(f.data, func(v wireField) error {
+				switch v.num {
+				case 1:
+					vname = string(v.data)
+				case 2:
+					number = int32(v.val)
+				}
+				return nil
+			})
+			if _, ok := e.names[number]; !ok {
+				e.names[number] = vname
+			}
+			e.numbers[vname] = number
+			return err
+		}
+		return nil
+	})
+	d.enums[scope+name] = e
+	return err
+}
+
+// jsonName returns the lowerCamelCase JSON name of a field name.
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		switch {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			b.WriteRune(c - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(c)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// isPackable returns whether repeated fields of the type can be packed.
+func isPackable(typ int) bool {
+	return typ != typeString && typ != typeBytes && typ != typeMessage && typ != typeGroup
+}
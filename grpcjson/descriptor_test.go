@@ -0,0 +1,143 @@
+package grpcjson
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Builders of the descriptors of the tests.
+
+func str(num int32, s string) []byte {
+	return appendBytes(nil, num, []byte(s))
+}
+
+func varint(num int32, v uint64) []byte {
+	return binary.AppendUvarint(appendKey(nil, num, wireVarint), v)
+}
+
+func sub(num int32, parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return appendBytes(nil, num, b)
+}
+
+func fieldDesc(name string, number int32, typ int, typeName string, repeated bool) []byte {
+	label := uint64(1)
+	if repeated {
+		label = labelRepeated
+	}
+	parts := [][]byte{str(1, name), varint(3, uint64(number)), varint(4, label), varint(5, uint64(typ))}
+	if typeName != "" {
+		parts = append(parts, str(6, typeName))
+	}
+	return sub(2, parts...)
+}
+
+// testDescriptorSet describes:
+//
+//	syntax = "proto3";
+//	package shop.v1;
+//	message Order {
+//	  enum Status { PENDING = 0; SHIPPED = 1; }
+//	  int64 id = 1; string customer_id = 2; repeated int32 quantities = 3; Status status = 4;
+//	  map<string, string> labels = 5; Item item = 6; bytes token = 7; sint32 delta = 8;
+//	}
+//	message Item { string sku = 1; double price = 2; }
+//	message GetOrderRequest { int64 id = 1; bool verbose = 2; Item filter = 3; repeated string tags = 4; }
+//	service Orders {
+//	  rpc GetOrder(GetOrderRequest) returns (Order);
+//	  rpc ListOrders(GetOrderRequest) returns (stream Order);
+//	  rpc AddOrders(stream Order) returns (GetOrderRequest);
+//	}
+func testDescriptorSet() []byte {
+	order := sub(4,
+		str(1, "Order"),
+		fieldDesc("id", 1, typeInt64, "", false),
+		fieldDesc("customer_id", 2, typeString, "", false),
+		fieldDesc("quantities", 3, typeInt32, "", true),
+		fieldDesc("status", 4, typeEnum, ".shop.v1.Order.Status", false),
+		fieldDesc("labels", 5, typeMessage, ".shop.v1.Order.LabelsEntry", true),
+		fieldDesc("item", 6, typeMessage, ".shop.v1.Item", false),
+		fieldDesc("token", 7, typeBytes, "", false),
+		fieldDesc("delta", 8, typeSint32, "", false),
+		sub(3,
+			str(1, "LabelsEntry"),
+			fieldDesc("key", 1, typeString, "", false),
+			fieldDesc("value", 2, typeString, "", false),
+			sub(7, varint(7, 1)),
+		),
+		sub(4,
+			str(1, "Status"),
+			sub(2, str(1, "PENDING"), varint(2, 0)),
+			sub(2, str(1, "SHIPPED"), varint(2, 1)),
+		),
+	)
+	item := sub(4,
+		str(1, "Item"),
+		fieldDesc("sku", 1, typeString, "", false),
+		fieldDesc("price", 2, typeDouble, "", false),
+	)
+	request := sub(4,
+		str(1, "GetOrderRequest"),
+		fieldDesc("id", 1, typeInt64, "", false),
+		fieldDesc("verbose", 2, typeBool, "", false),
+		fieldDesc("filter", 3, typeMessage, ".shop.v1.Item", false),
+		fieldDesc("tags", 4, typeString, "", true),
+	)
+	service := sub(6,
+		str(1, "Orders"),
+		sub(2, str(1, "GetOrder"), str(2, ".shop.v1.GetOrderRequest"), str(3, ".shop.v1.Order")),
+		sub(2, str(1, "ListOrders"), str(2, ".shop.v1.GetOrderRequest"), str(3, ".shop.v1.Order"), varint(6, 1)),
+		sub(2, str(1, "AddOrders"), str(2, ".shop.v1.Order"), str(3, ".shop.v1.GetOrderRequest"), varint(5, 1)),
+	)
+	return sub(1, str(1, "shop.proto"), str(2, "shop.v1"), order, item, request, service, str(12, "proto3"))
+}
+
+func TestParseDescriptorSet(t *testing.T) {
+	d, err := parseDescriptorSet(testDescriptorSet())
+	assert.NoError(t, err)
+
+	order := d.messages["shop.v1.Order"]
+	assert.NotNil(t, order)
+	assert.Equal(t, "customerId", order.byNumber[2].jsonName)
+	assert.Same(t, order.byNumber[2], order.byName["customer_id"])
+	assert.True(t, order.byNumber[3].packed)
+	assert.False(t, order.byNumber[5].packed)
+	assert.True(t, order.byNumber[5].message.mapEntry)
+	assert.Same(t, d.messages["shop.v1.Item"], order.byNumber[6].message)
+	assert.Equal(t, int32(1), order.byNumber[4].enum.numbers["SHIPPED"])
+
+	list := d.methods["shop.v1.Orders/ListOrders"]
+	assert.True(t, list.serverStreaming)
+	assert.False(t, list.clientStreaming)
+	assert.Same(t, order, list.output)
+	assert.True(t, d.methods["shop.v1.Orders/AddOrders"].clientStreaming)
+}
+
+func TestParseDescriptorSet_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		set  []byte
+		want string
+	}{
+		{"Test truncated", testDescriptorSet()[:20], "truncated"},
+		{"Test unknown field type", sub(1, sub(4, str(1, "A"), fieldDesc("b", 1, typeMessage, ".B", false))), "unknown message type B"},
+		{"Test unknown input type", sub(1, sub(6, str(1, "S"), sub(2, str(1, "M"), str(2, ".A"), str(3, ".A")))), "unknown input type A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDescriptorSet(tt.set)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestJSONName(t *testing.T) {
+	assert.Equal(t, "customerId", jsonName("customer_id"))
+	assert.Equal(t, "aBC", jsonName("a_b_c"))
+	assert.Equal(t, "id", jsonName("id"))
+}
@@ -0,0 +1,402 @@
+// Package grpcjson transcodes RESTful JSON requests into gRPC calls, in the style of grpc-gateway, so
+// HTTP clients can reach gRPC upstreams through the proxy. The messages of the methods are described by
+// a FileDescriptorSet, as written by protoc --include_imports --descriptor_set_out, and mapped to JSON
+// following the protojson conventions.
+//
+// The request message of a method is merged from the JSON request body, the query parameters and the
+// route parameters, in increasing precedence; dotted parameter names set the fields of nested messages.
+// The gRPC response is answered as a JSON object, or an array of objects for server streaming methods,
+// and gRPC errors as a JSON object of their code and message with the matching HTTP status:
+//
+//	gw, err := grpcjson.LoadFile("shop.pb")
+//	m, err := gw.Method("shop.v1.Orders/GetOrder")
+//	pm.HandlePath(reverseproxy.NewRoute("GET", "/orders/:id").SetGroup("GetOrder").
+//		SetTransport(h2).SetModifyResponse(m.TranscodeResponse))
+//	pm.UseGroup("GetOrder", m.Middleware)
+//
+// The upstream must be reached over HTTP/2, e.g. by a transport with ForceAttemptHTTP2 for TLS upstreams.
+package grpcjson
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// gRPC status codes answered by the gateway.
+const (
+	codeInvalidArgument = 3
+	codeUnknown         = 2
+	codeInternal        = 13
+)
+
+// ErrUnknownMethod is returned by Gateway.Method for methods missing in the descriptors.
+var ErrUnknownMethod = errors.New("grpcjson: unknown method")
+
+// Gateway holds the methods of a descriptor set.
+type Gateway struct {
+	// MaxBody limits the size of the JSON request bodies and the gRPC responses, zero means unlimited.
+	// Larger request bodies are answered with HTTP 413 content too large, larger responses fail.
+	MaxBody int64
+	desc    *descriptors
+}
+
+// New returns the gateway of the methods of an encoded FileDescriptorSet.
+func New(descriptorSet []byte) (*Gateway, error) {
+	desc, err := parseDescriptorSet(descriptorSet)
+	if err != nil {
+		return nil, err
+	}
+	return &Gateway{desc: desc}, nil
+}
+
+// LoadFile returns the gateway of the FileDescriptorSet of the named file, see New.
+func LoadFile(name string) (*Gateway, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return New(b)
+}
+
+// Methods returns the sorted full names of the methods of the gateway.
+func (g *Gateway) Methods() []string {
+	names := make([]string, 0, len(g.desc.methods))
+	for name := range g.desc.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Method returns the method of the full name, e.g. shop.v1.Orders/GetOrder. A leading slash is
+// accepted, as in the paths of gRPC requests.
+func (g *Gateway) Method(name string) (*Method, error) {
+	rpc, ok := g.desc.methods[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownMethod, name)
+	}
+	return &Method{gateway: g, rpc: rpc}, nil
+}
+
+// Method transcodes the JSON requests of a route into calls of a gRPC method.
+type Method struct {
+	gateway *Gateway
+	rpc     *rpc
+}
+
+// Name returns the full name of the method.
+func (m *Method) Name() string {
+	return m.rpc.name
+}
+
+// TranscodeRequest converts the request into a gRPC call of the method. The body of client streaming
+// methods may be an array of messages.
+func (m *Method) TranscodeRequest(r *http.Request) error {
+	msgs, err := m.requestMessages(r)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	for _, obj := range msgs {
+		b, err := marshal(m.rpc.input, obj)
+		if err != nil {
+			return err
+		}
+		body = binary.BigEndian.AppendUint32(append(body, 0), uint32(len(b)))
+		body = append(body, b...)
+	}
+	r.Method = http.MethodPost
+	r.URL.Path = "/" + m.rpc.name
+	r.URL.RawPath = ""
+	r.URL.RawQuery = ""
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Length")
+	r.Header.Del("Accept-Encoding")
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Te", "trailers")
+	if deadline, ok := r.Context().Deadline(); ok {
+		ms := time.Until(deadline).Milliseconds()
+		r.Header.Set("Grpc-Timeout", strconv.FormatInt(max(ms, 1), 10)+"m")
+	}
+	return nil
+}
+
+// requestMessages merges the messages of the request from its body, query and route parameters.
+func (m *Method) requestMessages(r *http.Request) ([]map[string]any, error) {
+	var msgs []map[string]any
+	if r.Body != nil && r.Body != http.NoBody {
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil && err != io.EOF {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case nil:
+		case map[string]any:
+			msgs = append(msgs, v)
+		case []any:
+			if !m.rpc.clientStreaming {
+				return nil, fmt.Errorf("grpcjson: %s expects a single message", m.rpc.name)
+			}
+			for _, e := range v {
+				obj, ok := e.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("grpcjson: invalid message %v", e)
+				}
+				msgs = append(msgs, obj)
+			}
+		default:
+			return nil, fmt.Errorf("grpcjson: invalid message %v", v)
+		}
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, make(map[string]any))
+	}
+	params := proxyctx.RouteParams(r.Context())
+	for _, obj := range msgs {
+		for name, values := range r.URL.Query() {
+			if err := setPath(m.rpc.input, obj, name, values); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range params {
+			if err := setPath(m.rpc.input, obj, p.Key, []string{p.Value}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// setPath sets the field of the dotted path in the object to the parameter values.
+func setPath(m *message, obj map[string]any, path string, values []string) error {
+	name, rest, nested := strings.Cut(path, ".")
+	f, ok := m.byName[name]
+	if !ok {
+		return fmt.Errorf("grpcjson: unknown field %q of %s", name, m.name)
+	}
+	if nested {
+		if f.message == nil || f.repeated {
+			return fmt.Errorf("grpcjson: field %q of %s isn't a message", name, m.name)
+		}
+		sub, ok := obj[f.jsonName].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+		}
+		if err := setPath(f.message, sub, rest, values); err != nil {
+			return err
+		}
+		delete(obj, f.name)
+		obj[f.jsonName] = sub
+		return nil
+	}
+	if f.message != nil {
+		return fmt.Errorf("grpcjson: field %q of %s is a message", name, m.name)
+	}
+	list := make([]any, len(values))
+	for i, s := range values {
+		list[i] = s
+		if f.typ == typeBool {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fieldError(f, s)
+			}
+			list[i] = b
+		}
+	}
+	delete(obj, f.name)
+	if f.repeated {
+		obj[f.jsonName] = list
+	} else if len(list) > 0 {
+		obj[f.jsonName] = list[len(list)-1]
+	}
+	return nil
+}
+
+// TranscodeResponse converts the gRPC response into JSON. Responses which aren't gRPC, e.g. errors of
+// the proxy, are left untouched. It has the signature of a ResponseModifier, so it can be passed to
+// Route.SetModifyResponse.
+func (m *Method) TranscodeResponse(res *http.Response) error {
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "application/grpc") {
+		return nil
+	}
+	var body io.Reader = res.Body
+	if m.gateway.MaxBody > 0 {
+		body = io.LimitReader(body, m.gateway.MaxBody+1)
+	}
+	data, err := io.ReadAll(body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if m.gateway.MaxBody > 0 && int64(len(data)) > m.gateway.MaxBody {
+		return fmt.Errorf("grpcjson: response of %s exceeds %d bytes", m.rpc.name, m.gateway.MaxBody)
+	}
+
+	code, msg := status(res)
+	var out any
+	if code == 0 {
+		out, err = m.responseMessages(data, res.Header.Get("Grpc-Encoding"))
+		if err != nil {
+			code, msg = codeInternal, err.Error()
+		}
+	}
+	if code != 0 {
+		out = map[string]any{"code": code, "message": msg}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	for name := range res.Header {
+		if strings.HasPrefix(name, "Grpc-") {
+			delete(res.Header, name)
+		}
+	}
+	res.Header.Del("Trailer")
+	res.Trailer = nil
+	res.StatusCode = HTTPStatus(code)
+	res.Status = ""
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.TransferEncoding = nil
+	res.Header.Set("Content-Type", "application/json")
+	res.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// status returns the gRPC status of the response from its trailer, or its header for trailers-only
+// responses.
+func status(res *http.Response) (int, string) {
+	h := res.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = res.Header
+	}
+	s := h.Get("Grpc-Status")
+	if s == "" {
+		return codeUnknown, "missing grpc-status"
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return codeUnknown, "invalid grpc-status " + s
+	}
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+	return code, msg
+}
+
+// responseMessages decodes the length-prefixed messages of the response body, a single message for
+// unary methods and an array for server streaming methods.
+func (m *Method) responseMessages(data []byte, encoding string) (any, error) {
+	var msgs []any
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errTruncated
+		}
+		compressed, size := data[0] == 1, binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(size) {
+			return nil, errTruncated
+		}
+		b := data[5 : 5+size]
+		data = data[5+size:]
+		if compressed {
+			if encoding != "gzip" {
+				return nil, fmt.Errorf("grpcjson: unsupported grpc-encoding %q", encoding)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			if b, err = io.ReadAll(zr); err != nil {
+				return nil, err
+			}
+		}
+		obj, err := unmarshal(m.rpc.output, b)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, obj)
+	}
+	if m.rpc.serverStreaming {
+		if msgs == nil {
+			msgs = []any{}
+		}
+		return msgs, nil
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("grpcjson: %s answered %d messages", m.rpc.name, len(msgs))
+	}
+	return msgs[0], nil
+}
+
+// Middleware returns a handler converting the requests into gRPC calls before passing them to next. It
+// can be registered per route group with ReverseProxyMux.UseGroup. Requests which can't be converted
+// are answered with HTTP 400 bad request and a JSON error.
+func (m *Method) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.gateway.MaxBody > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, m.gateway.MaxBody)
+		}
+		if err := m.TranscodeRequest(r); err != nil {
+			status := http.StatusBadRequest
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			b, _ := json.Marshal(map[string]any{"code": codeInvalidArgument, "message": err.Error()})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write(b)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HTTPStatus returns the HTTP status code of a gRPC status code, as mapped by grpc-gateway.
+func HTTPStatus(code int) int {
+	switch code {
+	case 0:
+		return http.StatusOK
+	case 1:
+		return 499
+	case 3, 9, 11:
+		return http.StatusBadRequest
+	case 4:
+		return http.StatusGatewayTimeout
+	case 5:
+		return http.StatusNotFound
+	case 6, 10:
+		return http.StatusConflict
+	case 7:
+		return http.StatusForbidden
+	case 8:
+		return http.StatusTooManyRequests
+	case 12:
+		return http.StatusNotImplemented
+	case 14:
+		return http.StatusServiceUnavailable
+	case 16:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,169 @@
+package grpcjson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// frame returns the length-prefixed gRPC message.
+func frame(msg []byte) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg))), msg...)
+}
+
+// newOrdersServer starts an HTTP/2 gRPC server answering the Orders methods by the request message.
+func newOrdersServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		assert.Equal(t, "trailers", r.Header.Get("Te"))
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		switch {
+		case r.URL.Path == "/shop.v1.Orders/GetOrder" && bytes.Equal(body, frame([]byte{0x08, 0x2a, 0x10, 0x01})):
+			_, _ = w.Write(frame([]byte{0x08, 0x2a, 0x12, 0x02, 'c', '1'}))
+			w.Header().Set("Grpc-Status", "0")
+		case r.URL.Path == "/shop.v1.Orders/GetOrder" && bytes.Equal(body, frame([]byte{0x08, 0x07, 0x1a, 0x03, 0x0a, 0x01, 'x'})):
+			// trailers-only response
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "order 7 not found")
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/shop.v1.Orders/ListOrders":
+			_, _ = w.Write(frame([]byte{0x08, 0x01}))
+			_, _ = w.Write(frame([]byte{0x08, 0x02}))
+			w.Header().Set("Grpc-Status", "0")
+		case r.URL.Path == "/shop.v1.Orders/AddOrders" && bytes.Equal(body, append(frame([]byte{0x08, 0x01}), frame([]byte{0x08, 0x02})...)):
+			_, _ = w.Write(frame([]byte{0x08, 0x02}))
+			w.Header().Set("Grpc-Status", "0")
+		default:
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "unexpected request")
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGateway_Mux(t *testing.T) {
+	srv := newOrdersServer(t)
+	gw, err := New(testDescriptorSet())
+	assert.NoError(t, err)
+	gw.MaxBody = 64
+
+	pm, err := reverseproxy.New(srv.URL)
+	assert.NoError(t, err)
+	for _, r := range []struct{ method, path, rpc string }{
+		{"GET", "/orders/:id", "shop.v1.Orders/GetOrder"},
+		{"GET", "/orders", "shop.v1.Orders/ListOrders"},
+		{"POST", "/orders", "/shop.v1.Orders/AddOrders"},
+	} {
+		m, err := gw.Method(r.rpc)
+		assert.NoError(t, err)
+		pm.HandlePath(reverseproxy.NewRoute(r.method, r.path).
+			SetGroup(m.Name()).
+			SetTransport(srv.Client().Transport).
+			SetModifyResponse(m.TranscodeResponse))
+		pm.UseGroup(m.Name(), m.Middleware)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test unary", "GET", "/orders/42?verbose=true", "", http.StatusOK, `{"id":"42","customerId":"c1"}`},
+		{"Test path parameter precedence", "GET", "/orders/42", `{"id":"1","verbose":true}`, http.StatusOK, `{"id":"42","customerId":"c1"}`},
+		{"Test trailers-only error", "GET", "/orders/7?filter.sku=x", "", http.StatusNotFound, `{"code":5,"message":"order 7 not found"}`},
+		{"Test error", "GET", "/orders/8", "", http.StatusBadRequest, `{"code":3,"message":"unexpected request"}`},
+		{"Test server streaming", "GET", "/orders", "", http.StatusOK, `[{"id":"1"},{"id":"2"}]`},
+		{"Test client streaming", "POST", "/orders", `[{"id":1},{"id":2}]`, http.StatusOK, `{"id":"2"}`},
+		{"Test invalid parameter", "GET", "/orders/abc", "", http.StatusBadRequest, `{"code":3,"message":"grpcjson: invalid value abc of field \"id\""}`},
+		{"Test unknown parameter", "GET", "/orders/42?other=1", "", http.StatusBadRequest, `{"code":3,"message":"grpcjson: unknown field \"other\" of shop.v1.GetOrderRequest"}`},
+		{"Test array for unary", "GET", "/orders/42", `[{}]`, http.StatusBadRequest, `{"code":3,"message":"grpcjson: shop.v1.Orders/GetOrder expects a single message"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Empty(t, w.Header().Get("Grpc-Status"))
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(`[{"customerId":"`+strings.Repeat("x", 64)+`"}]`))
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestGateway_Method(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "shop.pb")
+	assert.NoError(t, os.WriteFile(file, testDescriptorSet(), 0o600))
+	gw, err := LoadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shop.v1.Orders/AddOrders", "shop.v1.Orders/GetOrder", "shop.v1.Orders/ListOrders"}, gw.Methods())
+
+	_, err = gw.Method("shop.v1.Orders/DeleteOrder")
+	assert.ErrorIs(t, err, ErrUnknownMethod)
+}
+
+func TestMethod_TranscodeResponse(t *testing.T) {
+	gw, err := New(testDescriptorSet())
+	assert.NoError(t, err)
+	m, err := gw.Method("shop.v1.Orders/GetOrder")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		trailer    http.Header
+		body       []byte
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test not gRPC", http.Header{"Content-Type": {"text/plain"}}, nil, []byte("bad gateway"), http.StatusBadGateway, "bad gateway"},
+		{"Test missing status", http.Header{"Content-Type": {"application/grpc"}}, nil, frame([]byte{0x08, 0x01}), http.StatusInternalServerError, `{"code":2,"message":"missing grpc-status"}`},
+		{"Test percent-encoded message", http.Header{"Content-Type": {"application/grpc+proto"}}, http.Header{"Grpc-Status": {"14"}, "Grpc-Message": {"down%20for%20maintenance"}}, nil, http.StatusServiceUnavailable, `{"code":14,"message":"down for maintenance"}`},
+		{"Test truncated message", http.Header{"Content-Type": {"application/grpc"}}, http.Header{"Grpc-Status": {"0"}}, frame([]byte{0x08, 0x01})[:4], http.StatusInternalServerError, `{"code":13,"message":"grpcjson: truncated message"}`},
+		{"Test no message", http.Header{"Content-Type": {"application/grpc"}}, http.Header{"Grpc-Status": {"0"}}, nil, http.StatusInternalServerError, `{"code":13,"message":"grpcjson: shop.v1.Orders/GetOrder answered 0 messages"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: http.StatusBadGateway, Header: tt.header, Trailer: tt.trailer, Body: io.NopCloser(bytes.NewReader(tt.body))}
+			if strings.HasPrefix(tt.header.Get("Content-Type"), "application/grpc") {
+				res.StatusCode = http.StatusOK
+			}
+			assert.NoError(t, m.TranscodeResponse(res))
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatus(0))
+	assert.Equal(t, 499, HTTPStatus(1))
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(5))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatus(16))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(42))
+}
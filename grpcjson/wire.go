@@ -0,0 +1,80 @@
+package grpcjson
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Wire types of the protobuf encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// errTruncated is returned for truncated protobuf messages.
+var errTruncated = errors.New("grpcjson: truncated message")
+
+// wireField is a field of an encoded message: the varint or fixed value, or the data of length-delimited fields.
+type wireField struct {
+	num  int32
+	typ  int
+	val  uint64
+	data []byte
+}
+
+// readFields calls fn for each field of the encoded message.
+func readFields(b []byte, fn func(f wireField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := wireField{num: int32(key >> 3), typ: int(key & 7)}
+		switch f.typ {
+		case wireVarint:
+			f.val, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.val, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.val, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return errTruncated
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("grpcjson: unsupported wire type %d", f.typ)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendKey appends the key of a field.
+func appendKey(b []byte, num int32, typ int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendBytes appends a length-delimited field.
+func appendBytes(b []byte, num int32, data []byte) []byte {
+	b = appendKey(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,384 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/haoxins/rewrite"
+	httputilx "github.com/open-webtech/go-reverse-proxy/httputil"
+)
+
+// routeHandler is the handler of a registered route. Its state is resolved once at registration and
+// immutable afterwards, so serving a request needs no lookups in shared maps.
+type routeHandler struct {
+	pm       *ReverseProxyMux
+	route    Route
+	gate     *groupGate
+	queue    *routeQueue
+	quota    *quotaLimiter
+	rewriter *rewrite.Rule
+	mount    *prefixMount
+	rewrites []*regexRewriter
+	flights  *flightGroup
+	cache    *routeCache
+	dedup    *idempotencyGroup
+	stub     *template.Template
+	// modifiers is the response modifier chain of the mux at registration.
+	modifiers []ResponseModifier
+	// transport sends the requests of the route, the transport of the backend if nil.
+	transport http.RoundTripper
+	// next is the proxy handler wrapped in the middleware of the route.
+	next http.Handler
+}
+
+// newRouteHandler resolves the handler of the route. The caller must hold pm.mu.
+func (pm *ReverseProxyMux) newRouteHandler(route Route) (*routeHandler, error) {
+	h := &routeHandler{pm: pm, route: route, modifiers: pm.modifiers}
+	if route.Group != "" {
+		h.gate = pm.groupGate(route.Group)
+	}
+	if route.Quota != nil {
+		h.quota = newQuotaLimiter(*route.Quota)
+	}
+	if route.Queue != nil {
+		h.queue = route.queue
+		if h.queue == nil || h.queue.cfg != *route.Queue {
+			h.queue = newRouteQueue(*route.Queue)
+		}
+	}
+	if route.Coalesce {
+		h.flights = newFlightGroup()
+	}
+	if route.Cache != nil {
+		h.cache = pm.newRouteCache(*route.Cache)
+	}
+	if route.Idempotency != nil {
+		h.dedup = pm.newIdempotencyGroup(*route.Idempotency)
+	}
+	h.transport = route.Transport
+	if route.TLS != nil {
+		t, err := newRouteTLS(route)
+		if err != nil {
+			return nil, err
+		}
+		h.transport = t.transport
+	}
+	if route.RewritePath != "" {
+		rewriter, err := rewrite.NewRule(route.Path, route.RewritePath)
+		if err != nil {
+			return nil, err
+		}
+		h.rewriter = rewriter
+	}
+	mount, err := newPrefixMount(route)
+	if err != nil {
+		return nil, err
+	}
+	h.mount = mount
+	if h.rewrites, err = newRewriteChain(route); err != nil {
+		return nil, err
+	}
+	handle := h.proxy
+	if route.Stub != nil {
+		if h.stub, err = parseStub(route); err != nil {
+			return nil, err
+		}
+		handle = h.serveStub
+	}
+	h.next = pm.applyMiddleware(route, http.HandlerFunc(handle))
+	return h, nil
+}
+
+// exchange is the state of a request served by a route handler, stored in the request context.
+type exchange struct {
+	handler *routeHandler
+	backend *Backend
+	// selected is set if the backend is of an upstream selected by the UpstreamSelector.
+	selected bool
+	// target is the URL of the outbound request before it was directed to the backend.
+	target url.URL
+	// start is the start time of the upstream request.
+	start time.Time
+	// err is the error of the upstream request.
+	err error
+	// operation is the name of the operation set by SetOperation.
+	operation string
+	// rangeHeader and ifRange are the Range and If-Range headers answered by the proxy.
+	rangeHeader string
+	ifRange     string
+	// slow is set if the client stalled reading the response, see SlowClient.
+	slow bool
+	// conn holds the transport stats of the upstream request, nil if no connection was used.
+	conn *ConnStats
+	// trailer is the trailer of the inbound request, filled once its body is read.
+	trailer http.Header
+}
+
+// exchangeKey is the context key of the exchange.
+type exchangeKey struct{}
+
+// exchangeFrom returns the exchange of the request context, or nil.
+func exchangeFrom(ctx context.Context) *exchange {
+	x, _ := ctx.Value(exchangeKey{}).(*exchange)
+	return x
+}
+
+// ServeHTTP serves a request matched by the route, recording its metrics.
+func (h *routeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if mw, ok := w.(*matchWriter); ok {
+		h.dryRun(mw, r)
+		return
+	}
+	pm := h.pm
+	start := time.Now()
+	rec := &responseRecorder{ResponseWriter: w}
+	x := &exchange{handler: h}
+	r = r.WithContext(context.WithValue(r.Context(), exchangeKey{}, x))
+	defer func() {
+		pm.observe(h.route, r, rec.Status(), start, x)
+	}()
+	defer func() {
+		if val := recover(); val != nil {
+			if val == http.ErrAbortHandler {
+				panic(val)
+			}
+			p := newPanic(ErrPanic, "", val)
+			p.Started = rec.status != 0
+			pm.recoverPanic(rec, r, p)
+		}
+	}()
+	trace := TraceFromContext(r.Context())
+	trace.Add("route", r.Method+" "+h.route.Path)
+	if ls := pm.current().LoadShedding; ls != nil && ls.shed(r, h.route, pm.GetLoad()) {
+		trace.Add("shed", "load "+strconv.Itoa(int(pm.GetLoad())))
+		reject(rec, ls.RetryAfter)
+		return
+	}
+	if h.stub == nil {
+		var err error
+		if x.backend, x.selected, err = pm.selectUpstream(r); err != nil {
+			x.err = err
+			trace.Add("upstream", "error: "+err.Error())
+			pm.handleError(rec, r, err)
+			return
+		}
+		if x.backend != nil {
+			// the request counts for the balancer from its selection on, so the concurrent requests
+			// see it while it waits for the gate, quota and queue of the route
+			x.backend.inflight.Add(1)
+			defer x.backend.inflight.Add(-1)
+		}
+	}
+	switch {
+	case x.backend == nil && h.stub == nil:
+		trace.Add("upstream", "all backends draining")
+		pm.serveUnavailable(rec, r, nil)
+		return
+	case x.selected && !x.backend.IsAvailable():
+		trace.Add("upstream", "selected upstream unavailable")
+		pm.serveUnavailable(rec, r, nil)
+		return
+	}
+
+	w = rec
+	if sc := pm.current().SlowClient; sc != nil {
+		sw := newSlowClientWriter(rec, r, sc, x)
+		defer sw.reset()
+		w = sw
+	}
+	if h.route.Buffering == BufferingDisabled {
+		w = &flushWriter{rec}
+	}
+	h.next.ServeHTTP(w, pm.withRouteState(r, h.route))
+}
+
+// proxy forwards the request to the selected backend.
+func (h *routeHandler) proxy(w http.ResponseWriter, r *http.Request) {
+	pm, route := h.pm, h.route
+	cfg := pm.current()
+	trace := TraceFromContext(r.Context())
+	if pm.IsDraining() {
+		trace.Add("upstream", "draining")
+		pm.serveUnavailable(w, r, nil)
+		return
+	}
+	if h.gate != nil {
+		if !h.gate.enter(r.Context()) {
+			trace.Add("group", route.Group+" paused")
+			pm.serveUnavailable(w, r, nil)
+			return
+		}
+		defer h.gate.leave()
+		trace.Add("group", route.Group)
+	}
+	if h.quota != nil && !h.quota.allow(w, r) {
+		return
+	}
+	if h.queue != nil {
+		if !h.queue.enter(r.Context()) {
+			trace.Add("queue", "full")
+			reject(w, route.Queue.RetryAfter)
+			return
+		}
+		defer h.queue.leave()
+	}
+	if cfg.Via != "" {
+		if viaLoop(r.Header, cfg.Via) {
+			trace.Add("via", "loop detected")
+			http.Error(w, http.StatusText(http.StatusLoopDetected), http.StatusLoopDetected)
+			return
+		}
+		addVia(r.Header, r.ProtoMajor, r.ProtoMinor, cfg.Via)
+	}
+	x := exchangeFrom(r.Context())
+	if !h.handleExpect(w, r, x) {
+		return
+	}
+	if route.Upload != nil && r.Body != nil && r.Body != http.NoBody {
+		r.Body = newProgressBody(r, route.Upload)
+	}
+	x.trailer = r.Trailer
+	r.Header.Set("X-Forwarded-Proto", scheme(r))
+	host := r.Host
+	r.Header.Set("X-Forwarded-Host", host)
+	switch route.HostMode {
+	case HostPreserve:
+		// the inbound Host is forwarded
+	case HostCustom:
+		r.Host = route.Host
+	default:
+		r.Host = x.backend.url.Host
+	}
+	if h.rewriter != nil {
+		path := r.URL.Path
+		h.rewriter.Rewrite(r)
+		trace.Add("rewrite", path+" -> "+r.URL.Path)
+	}
+	if h.mount != nil {
+		path := r.URL.Path
+		h.mount.rewrite(r)
+		trace.Add("rewrite", path+" -> "+r.URL.Path)
+	}
+	applyRewrites(h.rewrites, r, host, trace)
+	httputilx.MergeRequestHeaders(r, cfg.RequestHeader, route.RequestHeader)
+	if err := pm.modifyRequest(r, cfg.ModifyRequest, route); err != nil {
+		err = newProxyError(ErrRewriteFailed, x, err)
+		x.err = err
+		trace.Add("modify", "error: "+err.Error())
+		pm.handleError(w, r, err)
+		return
+	}
+	if h.localRanges() {
+		takeRange(r, x)
+	}
+	trace.Add("upstream", x.backend.url.String())
+	if cfg.UpstreamTimeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.UpstreamTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	x.start = time.Now()
+
+	pm.proxy.ServeHTTP(w, r)
+}
+
+// modifyRequest runs the mux and route request modifiers.
+func (pm *ReverseProxyMux) modifyRequest(r *http.Request, modifier RequestModifier, route Route) error {
+	if modifier != nil {
+		if err := callRequestModifier(modifier, r); err != nil {
+			return err
+		}
+	}
+	if route.ModifyRequest != nil {
+		return callRequestModifier(route.ModifyRequest, r)
+	}
+	return nil
+}
+
+// modifyResponse prepares the body of the upstream response for the buffering and decompression
+// settings of the route, then runs the mux and route response modifiers, sets the ETag and answers
+// the Range header.
+func (pm *ReverseProxyMux) modifyResponse(res *http.Response) error {
+	modifier := pm.current().ModifyResponse
+	x := exchangeFrom(res.Request.Context())
+	if x == nil {
+		if modifier != nil {
+			return callModifier(modifier, res)
+		}
+		return nil
+	}
+	route := x.handler.route
+	pm.observeLatency(x)
+	if via := pm.current().Via; via != "" {
+		addVia(res.Header, res.ProtoMajor, res.ProtoMinor, via)
+	}
+	if route.Decompression != nil {
+		if err := decompressResponse(res, route.Decompression); err != nil {
+			return err
+		}
+	}
+	if route.ModifyTrailer != nil && res.Body != nil && res.Body != http.NoBody {
+		res.Body = &trailerBody{ReadCloser: res.Body, res: res, modifier: route.ModifyTrailer, x: x}
+	}
+	if route.Buffering == BufferingEnabled {
+		if err := pm.bufferResponse(res); err != nil {
+			return err
+		}
+	} else {
+		pm.guardPartialResponse(res, x)
+	}
+	if x.handler.mount != nil {
+		x.handler.mount.modifyResponse(res)
+	}
+	if cfg := pm.current(); len(route.StatusRewrites) > 0 || len(cfg.StatusRewrites) > 0 {
+		rewriteStatus(res, route.StatusRewrites, cfg.StatusRewrites, TraceFromContext(res.Request.Context()))
+	}
+	if modifier != nil {
+		if err := callModifier(modifier, res); err != nil {
+			return newProxyError(ErrRewriteFailed, x, err)
+		}
+	}
+	if err := callModifiers(x.handler.modifiers, res); err != nil {
+		return newProxyError(ErrRewriteFailed, x, err)
+	}
+	if route.ModifyResponse != nil {
+		if err := callModifier(route.ModifyResponse, res); err != nil {
+			return newProxyError(ErrRewriteFailed, x, err)
+		}
+	}
+	if err := callModifiers(route.Modifiers, res); err != nil {
+		return newProxyError(ErrRewriteFailed, x, err)
+	}
+	if p := pm.current().ResponseHeaderPolicy; p != nil {
+		p.Apply(res.Header)
+	}
+	if route.ResponseHeaders != nil {
+		route.ResponseHeaders.Apply(res.Header)
+	}
+	if route.ETag != ETagNone {
+		pm.applyETag(res, route.ETag)
+	}
+	if x.handler.localRanges() && res.StatusCode == http.StatusOK {
+		res.Header.Set("Accept-Ranges", "bytes")
+		if x.rangeHeader != "" {
+			pm.applyRange(res, x)
+		}
+	}
+	return nil
+}
+
+// scheme returns the scheme of the inbound request, which is only set in the URL of client requests.
+func scheme(r *http.Request) string {
+	switch {
+	case r.URL.Scheme != "":
+		return r.URL.Scheme
+	case r.TLS != nil:
+		return "https"
+	default:
+		return "http"
+	}
+}
@@ -0,0 +1,143 @@
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteHandler_ModifyResponse(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/users/:id").SetModifyResponse(func(res *http.Response) error {
+		res.Header.Set("X-Modified", "user")
+		return nil
+	}))
+	pm.HandlePath(NewRoute("GET", "/files/*path").SetModifyResponse(func(res *http.Response) error {
+		res.Header.Set("X-Modified", "file")
+		return nil
+	}))
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"Test named parameter", "/users/42", "user"},
+		{"Test catch-all parameter", "/files/a/b.txt", "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("X-Modified"))
+		})
+	}
+}
+
+func TestRouteHandler_InvalidRewrite(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	err := pm.AddRoute(NewRoute("GET", "/old/:id").SetRewritePath("/new/:id"))
+	assert.NoError(t, err)
+	err = pm.AddRoute(NewRoute("GET", "/broken/(").SetRewritePath("/new"))
+	assert.Error(t, err)
+	assert.Len(t, pm.Routes(), 1)
+}
+
+func TestRouteHandler_ModifyRequest(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.ModifyRequest = func(r *http.Request) error {
+		r.Header.Set("X-Chain", "mux")
+		return nil
+	}
+	pm.HandlePath(NewRoute("GET", "/users/:id").SetModifyRequest(func(r *http.Request) error {
+		r.Header.Set("X-Chain", r.Header.Get("X-Chain")+" route")
+		r.URL.Path = "/v2/users/" + RouteParams(r).ByName("id")
+		return nil
+	}))
+	pm.HandlePath(NewRoute("GET", "/fail").SetModifyRequest(func(r *http.Request) error {
+		return errors.New("invalid request")
+	}))
+	pm.HandlePath(NewRoute("GET", "/panic").SetModifyRequest(func(r *http.Request) error {
+		panic("buggy modifier")
+	}))
+	pm.PassPath("GET", "/posts")
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"Test mux and route modifiers", "/users/42", http.StatusOK, " /v2/users/42 mux route"},
+		{"Test mux modifier", "/posts", http.StatusOK, " /posts mux"},
+		{"Test modifier error", "/fail", http.StatusBadGateway, "Bad Gateway\n"},
+		{"Test modifier panic", "/panic", http.StatusInternalServerError, "Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestRoute_SetDirector(t *testing.T) {
+	other := newNamedOrigin(t, "other")
+	pm := newMiddlewareTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/users/:id").
+		SetRewritePath("/v2/users/:id").
+		SetRequestHeader(http.Header{"X-Chain": {"header"}}).
+		SetModifyRequest(func(r *http.Request) error {
+			r.Header.Set("X-Chain", r.Header.Get("X-Chain")+" modifier")
+			return nil
+		}).
+		SetDirector(func(r *http.Request) {
+			r.Header.Set("X-Chain", r.Header.Get("X-Chain")+" director "+r.URL.Path)
+		}))
+	pm.HandlePath(NewRoute("GET", "/other").SetDirector(func(r *http.Request) {
+		u, _ := url.Parse(other.URL)
+		r.URL.Scheme, r.URL.Host, r.Host = u.Scheme, u.Host, u.Host
+		r.URL.Path = "/elsewhere"
+	}))
+
+	assert.Equal(t, " /v2/users/42 header modifier director /v2/users/42", serve(pm, "GET", "/users/42").Body.String())
+	assert.Equal(t, "other GET /elsewhere ", serve(pm, "GET", "/other").Body.String())
+}
+
+func TestRouteHandler_HostMode(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPath("GET", "/upstream")
+	pm.HandlePath(NewRoute("GET", "/preserve").SetPreserveHost(true))
+	pm.HandlePath(NewRoute("GET", "/custom").SetHost("api.internal"))
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"Test upstream host", "/upstream", strings.TrimPrefix(origin.URL, "http://")},
+		{"Test preserved host", "/preserve", "www.example.com"},
+		{"Test custom host", "/custom", "api.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			r.Host = "www.example.com"
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package reverseproxy
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultVirtualNodes is the number of ring positions per backend used by ConsistentHash if zero is passed.
+const DefaultVirtualNodes = 160
+
+// HashKeyFunc returns the key partitioning the requests among the backends.
+type HashKeyFunc func(r *http.Request) string
+
+// HashByPath returns a hash key function keying the requests by their path.
+func HashByPath() HashKeyFunc {
+	return func(r *http.Request) string {
+		return r.URL.Path
+	}
+}
+
+// HashByHeader returns a hash key function keying the requests by the value of the named header.
+func HashByHeader(name string) HashKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// HashByCookie returns a hash key function keying the requests by the value of the named cookie.
+func HashByCookie(name string) HashKeyFunc {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// ConsistentHash returns a balancer mapping the requests to the backends on a hash ring by the key
+// returned by the key function, so requests with the same key are served by the same backend while
+// the pool is unchanged. Adding or removing a backend only moves the keys of its ring segments.
+// Each backend is placed on the ring vnodes times its weight, vnodes being DefaultVirtualNodes if
+// zero. Requests with an empty key are distributed randomly.
+func ConsistentHash(key HashKeyFunc, vnodes int) Balancer {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	return &consistentHash{key: key, vnodes: vnodes}
+}
+
+// consistentHash is the consistent hashing balancer.
+type consistentHash struct {
+	key    HashKeyFunc
+	vnodes int
+
+	mu   sync.Mutex
+	ring *hashRing
+}
+
+// hashRing is the hash ring of a backend pool.
+type hashRing struct {
+	backends []*Backend
+	hashes   []uint64
+	nodes    []*Backend
+}
+
+// Select selects the backend owning the ring segment of the request key.
+func (c *consistentHash) Select(r *http.Request, backends []*Backend) *Backend {
+	key := c.key(r)
+	if key == "" {
+		return backends[rand.Intn(len(backends))]
+	}
+	ring := c.ringOf(backends)
+	h := hashKey(key)
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= h
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.nodes[i]
+}
+
+// ringOf returns the hash ring of the backends, building it if the pool changed.
+func (c *consistentHash) ringOf(backends []*Backend) *hashRing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ring != nil && sameBackends(c.ring.backends, backends) {
+		return c.ring
+	}
+	type node struct {
+		hash    uint64
+		backend *Backend
+	}
+	nodes := make([]node, 0, len(backends)*c.vnodes)
+	for _, b := range backends {
+		id := b.url.String()
+		for i := 0; i < c.vnodes*b.weight; i++ {
+			nodes = append(nodes, node{hashKey(id + "#" + strconv.Itoa(i)), b})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].hash < nodes[j].hash
+	})
+	ring := &hashRing{
+		backends: backends,
+		hashes:   make([]uint64, len(nodes)),
+		nodes:    make([]*Backend, len(nodes)),
+	}
+	for i, n := range nodes {
+		ring.hashes[i] = n.hash
+		ring.nodes[i] = n.backend
+	}
+	c.ring = ring
+	return ring
+}
+
+// sameBackends reports whether the slices hold the same backends in the same order.
+func sameBackends(a, b []*Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey returns the ring position of the key.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return mix64(h.Sum64())
+}
+
+// mix64 spreads the bits of FNV hashes of similar keys over the ring.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,70 @@
+package reverseproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHashBackends(n int) []*Backend {
+	backends := make([]*Backend, n)
+	for i := range backends {
+		backends[i] = newBackend(&url.URL{Scheme: "http", Host: fmt.Sprintf("10.0.0.%d:80", i+1)})
+	}
+	return backends
+}
+
+func TestConsistentHash(t *testing.T) {
+	balancer := ConsistentHash(HashByPath(), 0)
+	backends := newHashBackends(4)
+
+	owners := make(map[string]*Backend)
+	counts := make(map[*Backend]int)
+	for i := 0; i < 1000; i++ {
+		path := fmt.Sprintf("/items/%d", i)
+		b := balancer.Select(httptest.NewRequest("GET", path, nil), backends)
+		assert.Equal(t, b, balancer.Select(httptest.NewRequest("GET", path, nil), backends), "keys should map stably")
+		owners[path] = b
+		counts[b]++
+	}
+	for _, b := range backends {
+		assert.Greater(t, counts[b], 150, "the keys should be spread over the backends")
+	}
+
+	moved := 0
+	grown := append(backends[:4:4], newHashBackends(5)[4])
+	for path, owner := range owners {
+		if b := balancer.Select(httptest.NewRequest("GET", path, nil), grown); b != owner {
+			assert.Equal(t, grown[4], b, "keys should only move to the added backend")
+			moved++
+		}
+	}
+	assert.Less(t, moved, 350)
+}
+
+func TestHashKeyFuncs(t *testing.T) {
+	r := httptest.NewRequest("GET", "/cart", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+
+	assert.Equal(t, "/cart", HashByPath()(r))
+	assert.Equal(t, "acme", HashByHeader("X-Tenant")(r))
+	assert.Equal(t, "s1", HashByCookie("session")(r))
+	assert.Empty(t, HashByCookie("missing")(r))
+}
+
+func TestConsistentHashThroughProxy(t *testing.T) {
+	pm := newPoolTestMux(t, "a", "b", "c")
+	pm.Balancer = ConsistentHash(HashByHeader("X-Tenant"), 0)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant", "acme")
+	first := serveRequest(pm, r).Body.String()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, serveRequest(pm, r).Body.String())
+	}
+}
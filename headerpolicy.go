@@ -0,0 +1,55 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SensitiveResponseHeaders are upstream response headers disclosing the server software or the
+// internal tracing, which are commonly denied toward the clients.
+var SensitiveResponseHeaders = []string{
+	"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version", "X-Runtime", "X-Generator",
+	"X-B3-*", "Uber-Trace-Id", "X-Amzn-Trace-Id", "X-Cloud-Trace-Context", "X-Envoy-*",
+}
+
+// framingHeaders are the response headers kept by the allowlists, as the body can't be read without them.
+var framingHeaders = []string{"Content-Length", "Content-Encoding", "Transfer-Encoding", "Trailer"}
+
+// HeaderPolicy filters the headers of the upstream responses before they're written to the client. The
+// names are matched case-insensitively, a name ending with * matches the names with its prefix, e.g.
+// "X-Internal-*". It's set for all routes with ReverseProxyMux.ResponseHeaderPolicy, and per route with
+// Route.SetResponseHeaderPolicy.
+type HeaderPolicy struct {
+	// Allow lists the headers passed to the client, if not empty. The framing headers, e.g.
+	// Content-Length, are always passed.
+	Allow []string
+	// Deny lists the headers removed, e.g. SensitiveResponseHeaders.
+	Deny []string
+}
+
+// Apply removes the headers not allowed or denied by the policy.
+func (p *HeaderPolicy) Apply(h http.Header) {
+	for name := range h {
+		if len(p.Allow) > 0 && !matchHeader(p.Allow, name) && !matchHeader(framingHeaders, name) {
+			delete(h, name)
+			continue
+		}
+		if matchHeader(p.Deny, name) {
+			delete(h, name)
+		}
+	}
+}
+
+// matchHeader returns whether the header name matches a pattern.
+func matchHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderPolicy_Apply(t *testing.T) {
+	header := func() http.Header {
+		return http.Header{
+			"Server":          {"nginx/1.25"},
+			"X-Powered-By":    {"PHP/8.2"},
+			"X-B3-Traceid":    {"abc"},
+			"X-Internal-Node": {"node-1"},
+			"Content-Type":    {"text/plain"},
+			"Content-Length":  {"2"},
+			"Cache-Control":   {"no-cache"},
+		}
+	}
+	tests := []struct {
+		name   string
+		policy HeaderPolicy
+		want   []string
+	}{
+		{"Test empty policy", HeaderPolicy{}, []string{"Cache-Control", "Content-Length", "Content-Type", "Server", "X-B3-Traceid", "X-Internal-Node", "X-Powered-By"}},
+		{"Test sensitive headers", HeaderPolicy{Deny: SensitiveResponseHeaders}, []string{"Cache-Control", "Content-Length", "Content-Type", "X-Internal-Node"}},
+		{"Test denied prefix", HeaderPolicy{Deny: []string{"x-internal-*", "server"}}, []string{"Cache-Control", "Content-Length", "Content-Type", "X-B3-Traceid", "X-Powered-By"}},
+		{"Test allowlist", HeaderPolicy{Allow: []string{"Content-Type", "Cache-*"}}, []string{"Cache-Control", "Content-Length", "Content-Type"}},
+		{"Test allowlist and denylist", HeaderPolicy{Allow: []string{"Content-*", "Cache-Control"}, Deny: []string{"Cache-Control"}}, []string{"Content-Length", "Content-Type"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := header()
+			tt.policy.Apply(h)
+			var names []string
+			for name := range h {
+				names = append(names, name)
+			}
+			assert.ElementsMatch(t, tt.want, names)
+		})
+	}
+}
+
+func TestResponseHeaderPolicy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("X-Debug", "1")
+		w.Header().Set("X-Request-Cost", "3")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.ResponseHeaderPolicy = &HeaderPolicy{Deny: SensitiveResponseHeaders}
+	pm.PassPath("GET", "/")
+	pm.HandlePath(NewRoute("GET", "/public").SetResponseHeaderPolicy(&HeaderPolicy{Allow: []string{"Content-Type"}}))
+
+	w := serve(pm, "GET", "/")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Equal(t, "1", w.Header().Get("X-Debug"))
+
+	w = serve(pm, "GET", "/public")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Debug"))
+	assert.Empty(t, w.Header().Get("X-Request-Cost"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+}
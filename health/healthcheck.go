@@ -1,20 +1,90 @@
 package health
 
 import (
+	"errors"
+	"math/rand"
 	"net"
 	"net/url"
 	"sync"
 	"time"
 )
 
+// ErrUnavailable is the error of the failed checks of check funcs reporting no error details.
+var ErrUnavailable = errors.New("origin unavailable")
+
+// Status is the result of a health check.
+type Status struct {
+	// Available is whether the origin was successfully connected.
+	Available bool
+	// Time is the time of the check.
+	Time time.Time
+	// Err is the error of the failed check, or nil.
+	Err error
+}
+
+// Option configures a HealthCheck.
+type Option func(*HealthCheck)
+
+// FailureThreshold sets the number of consecutive failed checks marking an available origin as
+// unavailable. The default threshold is 1.
+func FailureThreshold(n int) Option {
+	return func(h *HealthCheck) {
+		h.failureThreshold = max(n, 1)
+	}
+}
+
+// SuccessThreshold sets the number of consecutive successful checks marking an unavailable origin as
+// available. The default threshold is 1.
+func SuccessThreshold(n int) Option {
+	return func(h *HealthCheck) {
+		h.successThreshold = max(n, 1)
+	}
+}
+
+// Jitter randomizes the interval between the checks by up to the passed fraction of the period in
+// both directions, e.g. 0.1 for ±10%, so the checks of many origins don't run in lockstep.
+func Jitter(fraction float64) Option {
+	return func(h *HealthCheck) {
+		h.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// InitialDelay delays the first check, e.g. until a starting origin is expected to be ready. The
+// origin is considered available until it's checked.
+func InitialDelay(d time.Duration) Option {
+	return func(h *HealthCheck) {
+		h.initialDelay = d
+	}
+}
+
+// Period sets the interval between the checks. The default period is 10 seconds.
+func Period(d time.Duration) Option {
+	return func(h *HealthCheck) {
+		if d > 0 {
+			h.period = d
+		}
+	}
+}
+
 // NewHealthCheck is the ProxyHealth constructor
-func NewHealthCheck(origin *url.URL) *HealthCheck {
+func NewHealthCheck(origin *url.URL, opts ...Option) *HealthCheck {
 	h := &HealthCheck{
-		origin:      origin,
-		check:       defaultHealthCheckFunc,
-		period:      defaultHealthCheckPeriod,
-		cancel:      make(chan struct{}),
-		isAvailable: defaultHealthCheckFunc(origin),
+		origin:           origin,
+		check:            defaultHealthCheckFunc,
+		period:           defaultHealthCheckPeriod,
+		cancel:           make(chan struct{}),
+		failureThreshold: 1,
+		successThreshold: 1,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.startAt = time.Now().Add(h.initialDelay)
+	if h.initialDelay > 0 {
+		h.isAvailable = true
+	} else {
+		h.checkErr = h.check(origin)
+		h.isAvailable, h.checkedAt = h.checkErr == nil, time.Now()
 	}
 	h.run()
 
@@ -27,10 +97,23 @@ type HealthCheck struct {
 	origin *url.URL
 
 	mu          sync.Mutex
-	check       func(addr *url.URL) bool
+	check       func(addr *url.URL) error
 	period      time.Duration
 	cancel      chan struct{}
 	isAvailable bool
+	checkedAt   time.Time
+	checkErr    error
+	listeners   []func(up bool)
+	watchers    map[chan Status]struct{}
+
+	failureThreshold int
+	successThreshold int
+	jitter           float64
+	initialDelay     time.Duration
+	startAt          time.Time
+	// failures and successes are the numbers of consecutive failed and successful checks.
+	failures  int
+	successes int
 }
 
 // IsAvailable returns whether the proxy origin was successfully connected at the last check time.
@@ -40,20 +123,108 @@ func (h *HealthCheck) IsAvailable() bool {
 	return h.isAvailable
 }
 
+// LastCheck returns the result of the last check.
+func (h *HealthCheck) LastCheck() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Status{Available: h.isAvailable, Time: h.checkedAt, Err: h.checkErr}
+}
+
+// Settings are the check period and the options of a HealthCheck.
+type Settings struct {
+	Period           time.Duration
+	FailureThreshold int
+	SuccessThreshold int
+	Jitter           float64
+	InitialDelay     time.Duration
+}
+
+// Settings returns the check period and the options of the health check.
+func (h *HealthCheck) Settings() Settings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Settings{
+		Period:           h.period,
+		FailureThreshold: h.failureThreshold,
+		SuccessThreshold: h.successThreshold,
+		Jitter:           h.jitter,
+		InitialDelay:     h.initialDelay,
+	}
+}
+
 // SetCheckFunc sets the passed check func as the algorithm of checking the origin availability and
 // calls for it with interval defined with the passed period variable. The SetCheckFunc provides a
 // concurrency save way of setting and replacing the current health check algorithm, so the Stop function
 // shouldn't be called before the SetCheckFunc call.
 func (h *HealthCheck) SetCheckFunc(check func(addr *url.URL) bool, period time.Duration) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.SetCheckErrorFunc(func(addr *url.URL) error {
+		if !check(addr) {
+			return ErrUnavailable
+		}
+		return nil
+	}, period)
+}
 
+// SetCheckErrorFunc is like SetCheckFunc, but the check func returns the reason of the failed
+// checks, which is reported by LastCheck.
+func (h *HealthCheck) SetCheckErrorFunc(check func(addr *url.URL) error, period time.Duration) {
+	h.mu.Lock()
 	h.stop()
 	h.check = check
 	h.period = period
 	h.cancel = make(chan struct{})
-	h.isAvailable = h.check(h.origin)
-	h.run()
+	cancel := h.cancel
+	delayed := h.checkedAt.IsZero() && time.Now().Before(h.startAt)
+	h.mu.Unlock()
+
+	if !delayed {
+		h.record(cancel, check(h.origin))
+	}
+	h.mu.Lock()
+	if h.cancel == cancel {
+		h.run()
+	}
+	h.mu.Unlock()
+}
+
+// SetOptions changes the options of the health check, see Option. The initial delay is ignored
+// if the origin has been checked already.
+func (h *HealthCheck) SetOptions(opts ...Option) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, opt := range opts {
+		opt(h)
+	}
+}
+
+// OnStatusChange registers a func called with the new availability when the origin goes up or down.
+// The funcs are called synchronously by the checking goroutine, so they should return quickly.
+func (h *HealthCheck) OnStatusChange(fn func(up bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Watch returns a channel receiving the status of the checks changing the origin availability,
+// buffering up to the passed number of transitions. The transitions are dropped while the buffer is
+// full. The returned func stops the watching and closes the channel.
+func (h *HealthCheck) Watch(buffer int) (<-chan Status, func()) {
+	ch := make(chan Status, buffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.watchers == nil {
+		h.watchers = make(map[chan Status]struct{})
+	}
+	h.watchers[ch] = struct{}{}
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.watchers, ch)
+			close(ch)
+		})
+	}
 }
 
 // Stop gracefully stops the instance execution. Should be called when the instance work is no more needed.
@@ -63,46 +234,97 @@ func (h *HealthCheck) Stop() {
 	h.stop()
 }
 
-// run runs the check func in a new goroutine.
-func (h *HealthCheck) run() {
-	checkHealth := func() {
-		h.mu.Lock()
-		defer h.mu.Unlock()
-		isAvailable := h.check(h.origin)
-		h.isAvailable = isAvailable
+// record stores the result of a check of the run identified by its cancel channel, unless the run
+// has been stopped since. The availability changes once the failure or success threshold is reached,
+// notifying the listeners.
+func (h *HealthCheck) record(cancel chan struct{}, err error) {
+	h.mu.Lock()
+	if h.cancel != cancel {
+		h.mu.Unlock()
+		return
+	}
+	h.checkedAt, h.checkErr = time.Now(), err
+	if err != nil {
+		h.failures, h.successes = h.failures+1, 0
+	} else {
+		h.failures, h.successes = 0, h.successes+1
+	}
+	changed := false
+	switch {
+	case h.isAvailable && h.failures >= h.failureThreshold:
+		h.isAvailable, changed = false, true
+	case !h.isAvailable && h.successes >= h.successThreshold:
+		h.isAvailable, changed = true, true
+	}
+	if !changed {
+		h.mu.Unlock()
+		return
+	}
+	status := Status{Available: h.isAvailable, Time: h.checkedAt, Err: err}
+	listeners := h.listeners
+	for ch := range h.watchers {
+		select {
+		case ch <- status:
+		default:
+		}
 	}
+	h.mu.Unlock()
 
+	for _, fn := range listeners {
+		fn(status.Available)
+	}
+}
+
+// run runs the check func in a new goroutine. The caller must hold h.mu.
+func (h *HealthCheck) run() {
+	check, cancel := h.check, h.cancel
+	delay := h.nextDelay()
+	if h.checkedAt.IsZero() {
+		if d := time.Until(h.startAt); d > 0 {
+			delay = d
+		}
+	}
 	go func() {
-		t := time.NewTicker(h.period)
+		t := time.NewTimer(delay)
+		defer t.Stop()
 		for {
 			select {
 			case <-t.C:
-				checkHealth()
-			case <-h.cancel:
-				t.Stop()
+				h.record(cancel, check(h.origin))
+				h.mu.Lock()
+				t.Reset(h.nextDelay())
+				h.mu.Unlock()
+			case <-cancel:
 				return
 			}
 		}
 	}()
 }
 
+// nextDelay returns the period randomized by the jitter. The caller must hold h.mu.
+func (h *HealthCheck) nextDelay() time.Duration {
+	if h.jitter == 0 {
+		return h.period
+	}
+	return h.period + time.Duration((rand.Float64()*2-1)*h.jitter*float64(h.period))
+}
+
 // stop stops the currently rinning check func.
 func (h *HealthCheck) stop() {
 	if h.cancel != nil {
-		h.cancel <- struct{}{}
 		close(h.cancel)
 		h.cancel = nil
 	}
 }
 
 // defaultHealthCheckFunc is the default most simple check function
-var defaultHealthCheckFunc = func(addr *url.URL) bool {
+var defaultHealthCheckFunc = func(addr *url.URL) error {
 	conn, err := net.DialTimeout("tcp", addr.Host, defaultHealthCheckTimeout)
 	if err != nil {
-		return false
+		return err
 	}
 	_ = conn.Close()
-	return true
+	return nil
 }
 
 var (
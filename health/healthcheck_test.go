@@ -1,6 +1,7 @@
 package health
 
 import (
+	"errors"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -99,3 +100,142 @@ func TestHealthCheckContinuity(t *testing.T) {
 		return true
 	}, 10*time.Millisecond)
 }
+
+func TestLastCheck(t *testing.T) {
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+	origin, _ := url.Parse(ts.URL)
+	h := NewHealthCheck(origin)
+	defer h.Stop()
+
+	status := h.LastCheck()
+	assert.True(t, status.Available)
+	assert.NoError(t, status.Err)
+	assert.False(t, status.Time.IsZero())
+
+	refused := errors.New("connection refused")
+	h.SetCheckErrorFunc(func(_ *url.URL) error {
+		return refused
+	}, time.Hour)
+	status = h.LastCheck()
+	assert.False(t, status.Available)
+	assert.Equal(t, refused, status.Err)
+
+	h.SetCheckFunc(func(_ *url.URL) bool {
+		return false
+	}, time.Hour)
+	assert.Equal(t, ErrUnavailable, h.LastCheck().Err)
+}
+
+func TestStatusChange(t *testing.T) {
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+	origin, _ := url.Parse(ts.URL)
+	h := NewHealthCheck(origin)
+	defer h.Stop()
+
+	var changes []bool
+	h.OnStatusChange(func(up bool) {
+		changes = append(changes, up)
+	})
+	transitions, unwatch := h.Watch(10)
+
+	for _, up := range []bool{true, false, false, true} {
+		up := up
+		h.SetCheckFunc(func(_ *url.URL) bool {
+			return up
+		}, time.Hour)
+	}
+	unwatch()
+	unwatch()
+
+	assert.Equal(t, []bool{false, true}, changes)
+	var got []bool
+	for status := range transitions {
+		got = append(got, status.Available)
+	}
+	assert.Equal(t, []bool{false, true}, got)
+}
+
+func TestThresholds(t *testing.T) {
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+	origin, _ := url.Parse(ts.URL)
+	h := NewHealthCheck(origin, FailureThreshold(2), SuccessThreshold(3))
+	defer h.Stop()
+
+	tests := []struct {
+		up   bool
+		want bool
+	}{
+		{false, true},
+		{true, true},
+		{false, true},
+		{false, false},
+		{true, false},
+		{true, false},
+		{false, false},
+		{true, false},
+		{true, false},
+		{true, true},
+	}
+	for i, tt := range tests {
+		up := tt.up
+		h.SetCheckFunc(func(_ *url.URL) bool {
+			return up
+		}, time.Hour)
+		assert.Equalf(t, tt.want, h.IsAvailable(), "check %d", i)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	h := &HealthCheck{period: time.Second}
+	Jitter(0.1)(h)
+	for i := 0; i < 100; i++ {
+		d := h.nextDelay()
+		assert.GreaterOrEqual(t, d, 900*time.Millisecond)
+		assert.LessOrEqual(t, d, 1100*time.Millisecond)
+	}
+	Jitter(2)(h)
+	assert.Equal(t, 1.0, h.jitter)
+}
+
+func TestInitialDelay(t *testing.T) {
+	origin, _ := url.Parse("http://127.0.0.1:1")
+	h := NewHealthCheck(origin, InitialDelay(50*time.Millisecond))
+	defer h.Stop()
+
+	checked := make(chan struct{}, 1)
+	h.SetCheckFunc(func(_ *url.URL) bool {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+		return false
+	}, time.Hour)
+	assert.True(t, h.IsAvailable())
+	assert.True(t, h.LastCheck().Time.IsZero())
+
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("the origin wasn't checked after the initial delay")
+	}
+	assert.Eventually(t, func() bool {
+		return !h.IsAvailable()
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestSettings(t *testing.T) {
+	origin, _ := url.Parse("http://127.0.0.1:1")
+	h := NewHealthCheck(origin, Period(time.Minute), FailureThreshold(3), Jitter(0.1), InitialDelay(time.Hour))
+	defer h.Stop()
+
+	assert.Equal(t, Settings{
+		Period:           time.Minute,
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		Jitter:           0.1,
+		InitialDelay:     time.Hour,
+	}, h.Settings())
+}
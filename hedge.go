@@ -0,0 +1,126 @@
+package reverseproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// hedgeable reports whether the outbound request can be sent twice: its method is idempotent, it has
+// no body and it's no protocol upgrade.
+func hedgeable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return (r.Body == nil || r.Body == http.NoBody) && r.Header.Get("Upgrade") == ""
+}
+
+// attempt is the result of an upstream request sent by hedge.
+type attempt struct {
+	i       int
+	backend *Backend
+	start   time.Time
+	res     *http.Response
+	err     error
+	cancel  context.CancelFunc
+	conn    *connTrace
+}
+
+// hedge sends the outbound request to the selected backend and, if it hasn't responded within the
+// delay, to another backend too. The first response is returned and the other request is canceled.
+// The request isn't hedged if it fails before the delay, and the error is only returned if both
+// requests failed.
+func (pm *ReverseProxyMux) hedge(r *http.Request, x *exchange, delay time.Duration) (*http.Response, error) {
+	results := make(chan attempt, 2)
+	var cancels []context.CancelFunc
+	send := func(b *Backend, req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		req, ct := withConnTrace(req.WithContext(ctx))
+		a := attempt{i: len(cancels), backend: b, start: time.Now(), cancel: cancel, conn: ct}
+		cancels = append(cancels, cancel)
+		go func() {
+			a.res, a.err = pm.sendTo(b, req, x)
+			results <- a
+		}()
+	}
+	send(x.backend, r)
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var failed attempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			b := pm.selectBackendExcept(r, x.backend)
+			if b == nil {
+				continue
+			}
+			TraceFromContext(r.Context()).Add("hedge", b.url.String())
+			b.inflight.Add(1)
+			defer b.inflight.Add(-1)
+			send(b, pm.hedgeRequest(r, x, b))
+			pending++
+		case a := <-results:
+			pending--
+			if a.err != nil {
+				a.cancel()
+				if failed.err == nil {
+					failed = a
+				}
+				continue
+			}
+			x.backend, x.start = a.backend, a.start
+			x.setConnStats(r, a.conn)
+			a.res.Body = &cancelBody{ReadCloser: a.res.Body, cancel: a.cancel}
+			if pending > 0 {
+				for i, cancel := range cancels {
+					if i != a.i {
+						cancel()
+					}
+				}
+				go func() {
+					discardAttempt(<-results)
+				}()
+			}
+			return a.res, nil
+		}
+	}
+	return nil, failed.err
+}
+
+// hedgeRequest returns a copy of the outbound request directed to the backend. The Host header is
+// replaced if it's the host of the primary backend.
+func (pm *ReverseProxyMux) hedgeRequest(r *http.Request, x *exchange, b *Backend) *http.Request {
+	req := r.Clone(r.Context())
+	u := x.target
+	req.URL = &u
+	b.director(req)
+	if req.Host == x.backend.url.Host {
+		req.Host = b.url.Host
+	}
+	return req
+}
+
+// discardAttempt closes the response of a canceled request which lost the race.
+func discardAttempt(a attempt) {
+	if a.res != nil {
+		_ = a.res.Body.Close()
+	}
+}
+
+// cancelBody is a response body canceling the context of its request when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,86 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedging(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+
+	pm, err := New(slow.URL)
+	assert.NoError(t, err)
+	_, err = pm.AddBackend(fast.URL)
+	assert.NoError(t, err)
+	// the slow origin is the primary backend whenever it's selectable
+	pm.Balancer = BalancerFunc(func(_ *http.Request, backends []*Backend) *Backend {
+		return backends[0]
+	})
+	pm.HandlePath(NewRoute("GET|POST", "/hedged").SetHedging(20 * time.Millisecond))
+	pm.HandlePath(NewRoute("GET", "/late").SetHedging(time.Second))
+	pm.PassPath("GET", "/plain")
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantBody string
+	}{
+		{"Test hedged request", "GET", "/hedged", "", "fast"},
+		{"Test request with body", "POST", "/hedged", "data", "slow"},
+		{"Test non-idempotent method", "POST", "/hedged", "", "slow"},
+		{"Test primary responding in time", "GET", "/late", "", "slow"},
+		{"Test route without hedging", "GET", "/plain", "", "slow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			pm.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, body))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestHedgingFailure(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	_, err = pm.AddBackend(origin.URL)
+	assert.NoError(t, err)
+
+	calls := 0
+	pm.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return nil, io.ErrUnexpectedEOF
+	})
+	pm.HandlePath(NewRoute("GET", "/").SetHedging(time.Second))
+
+	// a failing primary isn't hedged
+	assert.Equal(t, http.StatusBadGateway, serve(pm, "GET", "/").Code)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,77 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Director is a function directing the outbound request to the upstream, like the Director of an
+// httputil.ReverseProxy.
+type Director func(r *http.Request)
+
+// Router returns the router of the current routing table, e.g. to look up the routes of a path. The
+// routing table is rebuilt when the routes or router options change, so changes of its settings are
+// lost then; use ConfigureRouter to change them.
+func (pm *ReverseProxyMux) Router() *httprouter.Router {
+	return pm.table.Load().router
+}
+
+// ConfigureRouter registers a hook changing the settings of the routers built for the routing tables,
+// e.g. HandleMethodNotAllowed, and rebuilds the routing table. The hooks run in order after the router
+// options are applied, before the routes are registered. It panics if the mux is frozen.
+func (pm *ReverseProxyMux) ConfigureRouter(hook func(router *httprouter.Router)) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	pm.routerHooks = append(slices.Clone(pm.routerHooks), hook)
+	if err := pm.swapRoutes(pm.routes); err != nil {
+		panic(err)
+	}
+	return pm
+}
+
+// Proxy returns the httputil.ReverseProxy forwarding the requests, e.g. to set its FlushInterval or
+// BufferPool before serving. Its Director, Transport, ModifyResponse and ErrorHandler implement the
+// features of the mux and must not be replaced; use WrapDirector, the Transport, ModifyResponse and
+// ErrorHandler of the mux instead.
+func (pm *ReverseProxyMux) Proxy() *httputil.ReverseProxy {
+	return pm.proxy
+}
+
+// WrapDirector wraps the director of the outbound requests, e.g. to change them after they're directed
+// to the backend. The wrapper receives the current director, which it should call. The wrapper
+// registered last is the outermost one. It's safe to call while the proxy is serving requests, and
+// panics if the mux is frozen.
+func (pm *ReverseProxyMux) WrapDirector(wrap func(next Director) Director) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	pm.directorWraps = append(slices.Clone(pm.directorWraps), wrap)
+	pm.buildDirector()
+	return pm
+}
+
+// buildDirector composes the director of the wrappers. The caller must hold pm.mu.
+func (pm *ReverseProxyMux) buildDirector() {
+	d := Director(pm.direct)
+	for _, wrap := range pm.directorWraps {
+		d = wrap(d)
+	}
+	pm.director.Store(&d)
+}
+
+// directOutbound directs the outbound request with the wrapped director, if any.
+func (pm *ReverseProxyMux) directOutbound(r *http.Request) {
+	if d := pm.director.Load(); d != nil {
+		(*d)(r)
+		return
+	}
+	pm.direct(r)
+}
@@ -0,0 +1,62 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureRouter(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET", "/users")
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(pm, "POST", "/users").Code)
+
+	pm.ConfigureRouter(func(router *httprouter.Router) {
+		router.HandleMethodNotAllowed = false
+	})
+	assert.Equal(t, http.StatusNotFound, serve(pm, "POST", "/users").Code)
+	pm.PassPath("GET", "/posts")
+	assert.Equal(t, http.StatusNotFound, serve(pm, "POST", "/posts").Code, "the hooks should apply to rebuilt tables")
+	assert.False(t, pm.Router().HandleMethodNotAllowed)
+
+	handle, _, _ := pm.Router().Lookup("GET", "/posts")
+	assert.NotNil(t, handle)
+}
+
+func TestWrapDirector(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET", "/users")
+	var calls []string
+	trace := func(name string) func(Director) Director {
+		return func(next Director) Director {
+			return func(r *http.Request) {
+				calls = append(calls, name)
+				next(r)
+				r.URL.Path += "/" + name
+			}
+		}
+	}
+	pm.WrapDirector(trace("inner")).WrapDirector(trace("outer"))
+
+	assert.Equal(t, "/users/inner/outer", serve(pm, "GET", "/users").Body.String())
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+
+	calls = nil
+	c := pm.Clone()
+	assert.Equal(t, "/users/inner/outer", serve(c, "GET", "/users").Body.String())
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+
+	pm.Freeze()
+	assert.Panics(t, func() {
+		pm.WrapDirector(trace("late"))
+	})
+}
+
+func TestProxy(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.Proxy().FlushInterval = -1
+	pm.PassPath("GET", "/users")
+	assert.Equal(t, "/users", serve(pm, "GET", "/users").Body.String())
+}
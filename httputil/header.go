@@ -1,6 +1,11 @@
 package httputil
 
-import "net/http"
+import (
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+)
 
 func MergeRequestHeaders(r *http.Request, headers ...http.Header) {
 	for _, header := range headers {
@@ -31,3 +36,61 @@ func MergeResponseWriterHeaders(w http.ResponseWriter, headers ...http.Header) {
 		}
 	}
 }
+
+// hopHeaders are the hop-by-hop headers, which apply to a single connection and mustn't be forwarded
+// by proxies (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// IsHopByHopHeader returns whether the header is a hop-by-hop header of the headers: a standard one,
+// or one named by their Connection header.
+func IsHopByHopHeader(h http.Header, name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	for _, hop := range hopHeaders {
+		if name == hop {
+			return true
+		}
+	}
+	for _, value := range h["Connection"] {
+		for _, field := range strings.Split(value, ",") {
+			if http.CanonicalHeaderKey(textproto.TrimString(field)) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RemoveHopByHopHeaders removes the hop-by-hop headers, including the ones named by the Connection header.
+func RemoveHopByHopHeaders(h http.Header) {
+	for _, value := range h["Connection"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = textproto.TrimString(field); field != "" {
+				h.Del(field)
+			}
+		}
+	}
+	for _, hop := range hopHeaders {
+		h.Del(hop)
+	}
+}
+
+// CopyHeader replaces the values of the headers of src in dst, except the hop-by-hop headers of src,
+// including the ones named by its Connection header. The names are canonicalized.
+func CopyHeader(dst, src http.Header) {
+	for name, values := range src {
+		if IsHopByHopHeader(src, name) {
+			continue
+		}
+		dst[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+	}
+}
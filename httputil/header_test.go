@@ -186,3 +186,103 @@ func TestMergeResponseWriterHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name: "Test with standard hop-by-hop headers",
+			header: http.Header{
+				"Connection":        []string{"keep-alive"},
+				"Keep-Alive":        []string{"timeout=5"},
+				"Transfer-Encoding": []string{"chunked"},
+				"Content-Type":      []string{"text/plain"},
+			},
+			want: http.Header{
+				"Content-Type": []string{"text/plain"},
+			},
+		},
+		{
+			name: "Test with headers named by Connection",
+			header: http.Header{
+				"Connection":   []string{"x-session, Upgrade", "X-Debug"},
+				"X-Session":    []string{"abc"},
+				"X-Debug":      []string{"1"},
+				"Upgrade":      []string{"websocket"},
+				"Content-Type": []string{"text/plain"},
+			},
+			want: http.Header{
+				"Content-Type": []string{"text/plain"},
+			},
+		},
+		{
+			name: "Test without hop-by-hop headers",
+			header: http.Header{
+				"Content-Type": []string{"text/plain"},
+			},
+			want: http.Header{
+				"Content-Type": []string{"text/plain"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RemoveHopByHopHeaders(tt.header)
+
+			if !reflect.DeepEqual(tt.header, tt.want) {
+				t.Errorf("RemoveHopByHopHeaders() = %v, want %v", tt.header, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  http.Header
+		src  http.Header
+		want http.Header
+	}{
+		{
+			name: "Test with replaced headers",
+			dst: http.Header{
+				"Content-Type": []string{"application/json"},
+				"Etag":         []string{`"v1"`},
+			},
+			src: http.Header{
+				"content-type": []string{"text/plain"},
+			},
+			want: http.Header{
+				"Content-Type": []string{"text/plain"},
+				"Etag":         []string{`"v1"`},
+			},
+		},
+		{
+			name: "Test with hop-by-hop headers",
+			dst:  http.Header{},
+			src: http.Header{
+				"Connection":        []string{"X-Session"},
+				"X-Session":         []string{"abc"},
+				"Transfer-Encoding": []string{"chunked"},
+				"Cache-Control":     []string{"max-age=60"},
+			},
+			want: http.Header{
+				"Cache-Control": []string{"max-age=60"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			CopyHeader(tt.dst, tt.src)
+
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("CopyHeader() = %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
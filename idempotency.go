@@ -0,0 +1,140 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	httputilx "github.com/open-webtech/go-reverse-proxy/httputil"
+)
+
+// IdempotencyKeyHeader is the request header holding the key deduplicating the requests of a route,
+// see SetIdempotency.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Idempotency configures the deduplication of the requests of a route by their Idempotency-Key header.
+type Idempotency struct {
+	// Store holds the pending and completed responses, a memory store of DefaultCacheEntries entries if nil.
+	// A shared store, e.g. of the cachestore package, deduplicates the requests across proxy instances.
+	Store CacheStore
+	// TTL is the time the completed responses are replayed to duplicate requests.
+	TTL time.Duration
+}
+
+// idempotencyGroup deduplicates the requests of a route.
+type idempotencyGroup struct {
+	pm    *ReverseProxyMux
+	cfg   Idempotency
+	store CacheStore
+
+	mu sync.Mutex
+	// pending holds the keys of the requests forwarded by this proxy and not completed yet.
+	pending map[string]bool
+}
+
+// newIdempotencyGroup creates the deduplication of a route.
+func (pm *ReverseProxyMux) newIdempotencyGroup(cfg Idempotency) *idempotencyGroup {
+	g := &idempotencyGroup{pm: pm, cfg: cfg, store: cfg.Store, pending: make(map[string]bool)}
+	if g.store == nil {
+		g.store = NewMemoryCache(DefaultCacheEntries)
+	}
+	return g
+}
+
+// idempotencyKey returns the store key of the request: the idempotency key scoped to the method, the
+// inbound host and path, and the credentials of the request, so clients can't replay each other's responses.
+func idempotencyKey(r *http.Request, x *exchange, key string) string {
+	var b strings.Builder
+	b.WriteString("idempotency ")
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Header.Get("X-Forwarded-Host"))
+	b.WriteString(x.target.Path)
+	for _, v := range r.Header.Values("Authorization") {
+		b.WriteString("\nAuthorization: " + v)
+	}
+	b.WriteString("\n" + IdempotencyKeyHeader + ": " + key)
+	return b.String()
+}
+
+// roundTrip sends the outbound request with send, unless a request with the same idempotency key
+// completed within the TTL, whose response is replayed instead. Duplicates of a pending request are
+// answered with HTTP 409 conflict. Failed requests and server errors aren't stored, so they can be retried.
+func (g *idempotencyGroup) roundTrip(r *http.Request, x *exchange, limit int64, send func(*http.Request, *exchange) (*http.Response, error)) (*http.Response, error) {
+	ctx := r.Context()
+	trace := TraceFromContext(ctx)
+	key := idempotencyKey(r, x, r.Header.Get(IdempotencyKeyHeader))
+	g.mu.Lock()
+	if g.pending[key] {
+		g.mu.Unlock()
+		trace.Add("idempotency", "pending")
+		return conflict(r), nil
+	}
+	g.pending[key] = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, key)
+		g.mu.Unlock()
+	}()
+
+	entry, err := g.store.Get(ctx, key)
+	if err != nil {
+		g.pm.logf("%s: idempotency: %v", describeRequest(r), err)
+	}
+	switch {
+	case entry == nil:
+	case entry.StatusCode == 0:
+		trace.Add("idempotency", "pending")
+		return conflict(r), nil
+	default:
+		trace.Add("idempotency", "replayed")
+		res := entry.response(r, time.Now())
+		res.Header.Set("Idempotent-Replayed", "true")
+		return res, nil
+	}
+
+	// the pending marker deduplicates the requests sent to other proxies sharing the store
+	marker := &CacheEntry{Stored: time.Now()}
+	if err := g.store.Set(ctx, key, marker, g.pendingTTL()); err != nil {
+		g.pm.logf("%s: idempotency: %v", describeRequest(r), err)
+	}
+	res, err := send(r, x)
+	if err != nil || res.StatusCode >= 500 {
+		_ = g.store.Delete(ctx, key)
+		return res, err
+	}
+	b, ok := readBody(res, limit)
+	if !ok {
+		_ = g.store.Delete(ctx, key)
+		return res, nil
+	}
+	trace.Add("idempotency", "stored")
+	entry = &CacheEntry{StatusCode: res.StatusCode, Header: make(http.Header, len(res.Header)), Body: b, Stored: time.Now()}
+	httputilx.CopyHeader(entry.Header, res.Header)
+	if err := g.store.Set(ctx, key, entry, g.cfg.TTL); err != nil {
+		g.pm.logf("%s: idempotency: %v", describeRequest(r), err)
+	}
+	return res, nil
+}
+
+// pendingTTL returns the time the pending marker of a request is kept if the proxy fails to remove it.
+func (g *idempotencyGroup) pendingTTL() time.Duration {
+	if timeout := g.pm.current().UpstreamTimeout; timeout > 0 {
+		return timeout
+	}
+	return g.cfg.TTL
+}
+
+// conflict returns the HTTP 409 conflict response to a duplicate of a pending request.
+func conflict(r *http.Request) *http.Response {
+	entry := &CacheEntry{
+		StatusCode: http.StatusConflict,
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Retry-After": {"1"}},
+		Body:       []byte("request with the same " + IdempotencyKeyHeader + " is in progress\n"),
+	}
+	res := entry.response(r, time.Now())
+	res.Header.Del("Age")
+	return res
+}
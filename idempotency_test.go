@@ -0,0 +1,143 @@
+package reverseproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_, _ = fmt.Fprintf(w, "charge %d", n)
+	}))
+	defer origin.Close()
+
+	type request struct {
+		path, key, auth string
+	}
+	tests := []struct {
+		name       string
+		requests   []request
+		wantHits   int32
+		wantStatus int
+		wantBodies []string
+	}{
+		{"Test duplicate requests", []request{{"/charges", "k1", ""}, {"/charges", "k1", ""}}, 1, http.StatusCreated, []string{"charge 1", "charge 1"}},
+		{"Test different keys", []request{{"/charges", "k1", ""}, {"/charges", "k2", ""}}, 2, http.StatusCreated, []string{"charge 1", "charge 2"}},
+		{"Test different credentials", []request{{"/charges", "k1", "alice"}, {"/charges", "k1", "bob"}}, 2, http.StatusCreated, []string{"charge 1", "charge 2"}},
+		{"Test different paths", []request{{"/charges", "k1", ""}, {"/refunds", "k1", ""}}, 2, http.StatusCreated, []string{"charge 1", "charge 2"}},
+		{"Test requests without key", []request{{"/charges", "", ""}, {"/charges", "", ""}}, 2, http.StatusCreated, []string{"charge 1", "charge 2"}},
+		{"Test server errors not stored", []request{{"/fail", "k1", ""}, {"/fail", "k1", ""}}, 2, http.StatusServiceUnavailable, []string{"charge 1", "charge 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(NewRoute("POST", "/*path").SetIdempotency(Idempotency{TTL: time.Minute}))
+			for i, req := range tt.requests {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("POST", req.path, strings.NewReader("amount=10"))
+				if req.key != "" {
+					r.Header.Set(IdempotencyKeyHeader, req.key)
+				}
+				if req.auth != "" {
+					r.Header.Set("Authorization", req.auth)
+				}
+				pm.ServeHTTP(w, r)
+				assert.Equal(t, tt.wantStatus, w.Code)
+				assert.Equal(t, tt.wantBodies[i], w.Body.String())
+				replayed := i > 0 && tt.wantHits == 1
+				assert.Equal(t, replayed, w.Header().Get("Idempotent-Replayed") == "true")
+			}
+			assert.Equal(t, tt.wantHits, hits.Load())
+		})
+	}
+}
+
+func TestIdempotency_Pending(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer origin.Close()
+
+	store := NewMemoryCache(10)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("POST", "/charges").SetIdempotency(Idempotency{Store: store, TTL: time.Minute}))
+	other, err := New(origin.URL)
+	assert.NoError(t, err)
+	other.HandlePath(NewRoute("POST", "/charges").SetIdempotency(Idempotency{Store: store, TTL: time.Minute}))
+
+	post := func(pm *ReverseProxyMux) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/charges", nil)
+		r.Header.Set(IdempotencyKeyHeader, "k1")
+		pm.ServeHTTP(w, r)
+		return w
+	}
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- post(pm)
+	}()
+	<-arrived
+
+	// a duplicate is rejected by the same proxy and by a proxy sharing the store
+	for _, mux := range []*ReverseProxyMux{pm, other} {
+		w := post(mux)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	}
+	close(release)
+	assert.Equal(t, "done", (<-done).Body.String())
+
+	w := post(other)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "done", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotency_RouteChange(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "charge %d", hits.Add(1))
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("POST", "/charges").SetIdempotency(Idempotency{TTL: time.Minute}))
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/charges", nil)
+		r.Header.Set(IdempotencyKeyHeader, "k1")
+		pm.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, "charge 1", post().Body.String())
+
+	// the stored responses survive the rebuild of the route handlers
+	pm.PassPath("GET", "/other")
+	w := post()
+	assert.Equal(t, "charge 1", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(1), hits.Load())
+}
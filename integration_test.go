@@ -0,0 +1,196 @@
+package reverseproxy
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the integration tests")
+
+// testEnv is a proxy and its origins listening on ephemeral ports.
+type testEnv struct {
+	t       *testing.T
+	Mux     *ReverseProxyMux
+	Proxy   *httptest.Server
+	Origins []*httptest.Server
+	Client  *http.Client
+}
+
+// newTestEnv starts an origin server for each handler and a proxy forwarding to them, the first
+// origin being the remote passed to New and the others added as backends. The servers are closed
+// when the test ends. The routes can be registered on Mux before sending requests.
+func newTestEnv(t *testing.T, origins ...http.Handler) *testEnv {
+	t.Helper()
+	env := &testEnv{t: t}
+	for i, h := range origins {
+		origin := httptest.NewServer(h)
+		t.Cleanup(origin.Close)
+		env.Origins = append(env.Origins, origin)
+		if i == 0 {
+			pm, err := New(origin.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env.Mux = pm
+			continue
+		}
+		if _, err := env.Mux.AddBackend(origin.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.Proxy = httptest.NewServer(env.Mux)
+	t.Cleanup(env.Proxy.Close)
+	env.Client = env.Proxy.Client()
+	return env
+}
+
+// Do sends a request to the proxy and returns the response with its body read.
+func (env *testEnv) Do(method, path string, header http.Header) (*http.Response, string) {
+	env.t.Helper()
+	r, err := http.NewRequest(method, env.Proxy.URL+path, nil)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	res, err := env.Client.Do(r)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+// normalize replaces the ephemeral addresses of the servers in s with stable placeholders.
+func (env *testEnv) normalize(s string) string {
+	s = strings.ReplaceAll(s, env.Proxy.Listener.Addr().String(), "{proxy}")
+	for i, origin := range env.Origins {
+		s = strings.ReplaceAll(s, origin.Listener.Addr().String(), fmt.Sprintf("{origin%d}", i))
+	}
+	return s
+}
+
+// assertGolden compares got with the golden file of the test, or rewrites the file if the -update
+// flag is passed.
+func assertGolden(t *testing.T, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "integration", strings.ReplaceAll(t.Name(), "/", "_")+".golden")
+	if *update {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create the golden file", err)
+	}
+	assert.Equal(t, string(want), got)
+}
+
+// echoOrigin replies with a dump of the request it received, the headers being sorted.
+func echoOrigin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := make([]string, 0, len(r.Header))
+		for k := range r.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		_, _ = fmt.Fprintf(w, "%s %s\nHost: %s\n", r.Method, r.URL.RequestURI(), r.Host)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(w, "%s: %s\n", k, strings.Join(r.Header[k], ", "))
+		}
+	})
+}
+
+func TestIntegration(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(pm *ReverseProxyMux)
+		method string
+		path   string
+		header http.Header
+	}{
+		{
+			name: "forwarding headers",
+			setup: func(pm *ReverseProxyMux) {
+				pm.PassPath("GET", "/api/items")
+			},
+			method: "GET",
+			path:   "/api/items?limit=10",
+			header: http.Header{"X-Request-Id": {"42"}},
+		},
+		{
+			name: "request headers",
+			setup: func(pm *ReverseProxyMux) {
+				pm.RequestHeader = http.Header{"X-Proxy": {"mux"}}
+				pm.HandlePath(NewRoute("POST", "/api/items").SetRequestHeader(http.Header{"X-Route": {"items"}}))
+			},
+			method: "POST",
+			path:   "/api/items",
+		},
+		{
+			name: "rewrite",
+			setup: func(pm *ReverseProxyMux) {
+				pm.RewritePath("GET", "/old/:id", "/new/:id")
+			},
+			method: "GET",
+			path:   "/old/7?full=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, echoOrigin())
+			tt.setup(env.Mux)
+			res, body := env.Do(tt.method, tt.path, tt.header)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assertGolden(t, env.normalize(body))
+		})
+	}
+}
+
+func TestIntegrationStreaming(t *testing.T) {
+	next := make(chan struct{})
+	env := newTestEnv(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "event %d\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-next:
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}))
+	env.Mux.HandlePath(NewRoute("GET", "/events").SetBuffering(false))
+
+	res, err := env.Client.Get(env.Proxy.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	lines := bufio.NewReader(res.Body)
+	for i := 0; i < 3; i++ {
+		// each event is received before the origin is allowed to send the next one
+		line, err := lines.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("event %d\n", i), line)
+		next <- struct{}{}
+	}
+}
@@ -0,0 +1,96 @@
+// Package message implements the access to the request and response shared by the script and plugin
+// filters. The filters act on the message of their phase: the request, or the response once the
+// upstream answered, which is the case when the response passed to the functions isn't nil.
+package message
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// DefaultMaxBodySize is the default limit of the bodies read by the filters.
+const DefaultMaxBodySize = 1 << 20
+
+// ErrResponseOnly is returned when a response method is called in the request phase.
+var ErrResponseOnly = errors.New("only available for responses")
+
+// Header returns the header of the current message.
+func Header(r *http.Request, res *http.Response) http.Header {
+	if res != nil {
+		return res.Header
+	}
+	return r.Header
+}
+
+// Status returns the response status code, or zero in the request phase.
+func Status(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
+
+// SetStatus sets the status code and status line of the response.
+func SetStatus(res *http.Response, status int) error {
+	if res == nil {
+		return ErrResponseOnly
+	}
+	res.StatusCode = status
+	res.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	return nil
+}
+
+// ReadBody reads the body of the current message, which stays available for the upstream or client.
+// A body larger than limit, DefaultMaxBodySize if zero, isn't returned: an *http.MaxBytesError is
+// returned and the body stays unchanged.
+func ReadBody(r *http.Request, res *http.Response, limit int64) ([]byte, error) {
+	body := &r.Body
+	if res != nil {
+		body = &res.Body
+	}
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	b, err := io.ReadAll(io.LimitReader(*body, limit+1))
+	if err != nil {
+		_ = (*body).Close()
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		*body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), *body), *body}
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	_ = (*body).Close()
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// SetBody replaces the body of the current message, updating its length. The Content-Encoding of
+// a response is removed, as the body is written unencoded.
+func SetBody(r *http.Request, res *http.Response, body []byte) {
+	if res != nil {
+		if res.Body != nil {
+			_ = res.Body.Close()
+		}
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		res.ContentLength = int64(len(body))
+		res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		res.Header.Del("Content-Encoding")
+		return
+	}
+	if r.Body != nil {
+		_ = r.Body.Close()
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
@@ -0,0 +1,64 @@
+package message
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		want    string
+		wantErr bool
+	}{
+		{"Test with body within the limit", "body", 4, "body", false},
+		{"Test with body over the limit", "oversized", 4, "", true},
+		{"Test with default limit", "body", 0, "body", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			b, err := ReadBody(r, nil, tt.limit)
+			if tt.wantErr {
+				var tooLarge *http.MaxBytesError
+				assert.ErrorAs(t, err, &tooLarge)
+				assert.Equal(t, tt.limit, tooLarge.Limit)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, string(b))
+			}
+			rest, _ := io.ReadAll(r.Body)
+			assert.Equal(t, tt.body, string(rest), "the body should stay available")
+		})
+	}
+}
+
+func TestSetBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("old"))
+	res := &http.Response{Header: http.Header{"Content-Encoding": {"gzip"}}, Body: io.NopCloser(strings.NewReader("old"))}
+	SetBody(r, res, []byte("new body"))
+	assert.Equal(t, int64(8), res.ContentLength)
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	b, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "new body", string(b))
+
+	SetBody(r, nil, []byte("request"))
+	assert.Equal(t, "7", r.Header.Get("Content-Length"))
+	b, _ = io.ReadAll(r.Body)
+	assert.Equal(t, "request", string(b))
+}
+
+func TestSetStatus(t *testing.T) {
+	assert.ErrorIs(t, SetStatus(nil, http.StatusBadGateway), ErrResponseOnly)
+	res := &http.Response{}
+	assert.NoError(t, SetStatus(res, http.StatusBadGateway))
+	assert.Equal(t, "502 Bad Gateway", res.Status)
+	assert.Equal(t, http.StatusBadGateway, Status(res))
+}
@@ -0,0 +1,148 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// DefaultRetryAfter is the Retry-After delay of the requests rejected by a limiter, if not set.
+const DefaultRetryAfter = time.Second
+
+// LimitKeyFunc returns the key of the requests sharing a concurrency limit.
+type LimitKeyFunc func(r *http.Request) string
+
+// LimitByClientIP returns a limit key function limiting the requests of each client IP address.
+func LimitByClientIP() LimitKeyFunc {
+	return func(r *http.Request) string {
+		if ip, ok := proxyctx.ClientIP(r.Context()); ok {
+			return ip.String()
+		}
+		if ip, ok := remoteIP(r); ok {
+			return ip.String()
+		}
+		return r.RemoteAddr
+	}
+}
+
+// LimitByRoute returns a limit key function limiting the requests of each route.
+func LimitByRoute() LimitKeyFunc {
+	return func(r *http.Request) string {
+		route, _ := proxyctx.Route(r.Context())
+		return route.Method + " " + route.Path
+	}
+}
+
+// LimitByHeader returns a limit key function limiting the requests of each value of the header, e.g.
+// of each API key.
+func LimitByHeader(name string) LimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// ConcurrencyLimit configures a ConcurrencyLimiter.
+type ConcurrencyLimit struct {
+	// Max is the maximum number of in-flight requests per key.
+	Max int
+	// Key partitions the requests, all requests share the limit if nil.
+	Key LimitKeyFunc
+	// MaxWait is the time the requests exceeding the limit are queued for a free slot, zero means the
+	// requests are rejected immediately.
+	MaxWait time.Duration
+	// RetryAfter is the delay of the Retry-After header of the rejected requests, DefaultRetryAfter if zero.
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimiter returns middleware capping the in-flight requests per key, e.g. per client IP or
+// per route. The requests exceeding the limit wait up to MaxWait for a free slot, then they're rejected
+// with HTTP 503 service unavailable and a Retry-After header. Register it with Use or UseGroup.
+func ConcurrencyLimiter(limit ConcurrencyLimit) Middleware {
+	l := &concurrencyLimiter{limit: limit, slots: make(map[string]*limitSlots)}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var key string
+			if l.limit.Key != nil {
+				key = l.limit.Key(r)
+			}
+			release, ok := l.acquire(r.Context(), key)
+			if !ok {
+				TraceFromContext(r.Context()).Add("limit", "concurrency limit of "+strconv.Itoa(l.limit.Max)+" exceeded")
+				reject(w, l.limit.RetryAfter)
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// concurrencyLimiter holds the slots of the in-flight requests of each key.
+type concurrencyLimiter struct {
+	limit ConcurrencyLimit
+
+	mu    sync.Mutex
+	slots map[string]*limitSlots
+}
+
+// limitSlots is a semaphore of the requests of a key, removed when no request uses it.
+type limitSlots struct {
+	ch   chan struct{}
+	refs int
+}
+
+// acquire takes a slot of the key, waiting up to MaxWait. It returns the func releasing the slot,
+// or false if no slot got free in time.
+func (l *concurrencyLimiter) acquire(ctx context.Context, key string) (func(), bool) {
+	l.mu.Lock()
+	s := l.slots[key]
+	if s == nil {
+		s = &limitSlots{ch: make(chan struct{}, max(l.limit.Max, 1))}
+		l.slots[key] = s
+	}
+	s.refs++
+	l.mu.Unlock()
+
+	done := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if s.refs--; s.refs == 0 {
+			delete(l.slots, key)
+		}
+	}
+	release := func() {
+		<-s.ch
+		done()
+	}
+	select {
+	case s.ch <- struct{}{}:
+		return release, true
+	default:
+	}
+	if l.limit.MaxWait > 0 {
+		t := time.NewTimer(l.limit.MaxWait)
+		defer t.Stop()
+		select {
+		case s.ch <- struct{}{}:
+			return release, true
+		case <-t.C:
+		case <-ctx.Done():
+		}
+	}
+	done()
+	return nil, false
+}
+
+// reject answers a request rejected by a limiter with HTTP 503 service unavailable and a Retry-After header.
+func reject(w http.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
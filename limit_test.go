@@ -0,0 +1,91 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHandler is a handler holding the requests to /slow until release is closed, signaling each
+// request on entered.
+type blockingHandler struct {
+	release chan struct{}
+	entered chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{release: make(chan struct{}), entered: make(chan struct{}, 10)}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.entered <- struct{}{}
+	if r.URL.Path == "/slow" {
+		<-h.release
+	}
+	_, _ = io.WriteString(w, "ok")
+}
+
+// serveFrom serves a request to the route from the client address in a new goroutine, returning its recorder.
+func serveFrom(h http.Handler, target, remoteAddr string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	r := httptest.NewRequest("GET", target, nil)
+	r.RemoteAddr = remoteAddr
+	r = r.WithContext(proxyctx.WithRoute(r.Context(), proxyctx.RouteInfo{Method: "GET", Path: r.URL.Path}))
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		done <- w
+	}()
+	return done
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	origin := newBlockingHandler()
+	h := ConcurrencyLimiter(ConcurrencyLimit{Max: 1, Key: LimitByClientIP(), RetryAfter: 1500 * time.Millisecond})(origin)
+
+	first := serveFrom(h, "/slow", "10.0.0.1:1234")
+	<-origin.entered
+
+	w := <-serveFrom(h, "/fast", "10.0.0.1:1235")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = <-serveFrom(h, "/fast", "10.0.0.2:1234")
+	assert.Equal(t, http.StatusOK, w.Code, "other clients should not be limited")
+
+	close(origin.release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	w = <-serveFrom(h, "/fast", "10.0.0.1:1235")
+	assert.Equal(t, http.StatusOK, w.Code, "the slot should be released")
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	origin := newBlockingHandler()
+	h := ConcurrencyLimiter(ConcurrencyLimit{Max: 1, Key: LimitByRoute(), MaxWait: time.Second})(origin)
+
+	first := serveFrom(h, "/slow", "10.0.0.1:1234")
+	<-origin.entered
+
+	w := <-serveFrom(h, "/fast", "10.0.0.1:1235")
+	assert.Equal(t, http.StatusOK, w.Code, "other routes should not be limited")
+
+	queued := serveFrom(h, "/slow", "10.0.0.2:1234")
+	time.Sleep(20 * time.Millisecond)
+	close(origin.release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, (<-queued).Code)
+}
+
+func TestConcurrencyLimiterProxy(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.Use(ConcurrencyLimiter(ConcurrencyLimit{Max: 1}))
+
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+}
@@ -0,0 +1,121 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// RouteMatch is the outcome of the dry run of a request, see Match.
+type RouteMatch struct {
+	// Route is the matched route, of the mux or a nested mux, or nil if no route matched.
+	Route *Route
+	// Params are the parameters captured from the request path by the route.
+	Params proxyctx.Params
+	// Status is the status the request is answered with if no route matched, e.g. 404 not found,
+	// 405 method not allowed or a redirect of the router.
+	Status int
+	// Header holds the headers of the answer if no route matched, e.g. the Location of a redirect or
+	// the Allow header of a 405 method not allowed.
+	Header http.Header
+	// Upstream is the selected backend, nil for stub routes or if all backends are draining.
+	Upstream *Backend
+	// URL is the URL of the outbound request after the rewrites, nil if no upstream is selected.
+	URL *url.URL
+	// Host is the Host header of the outbound request.
+	Host string
+}
+
+// Match reports how the mux would handle a request of the method, path and host without serving it,
+// e.g. for debugging and tests: the matched route, the rewritten outbound URL and Host header, and the
+// selected upstream. The path may have a query. The request modifiers, directors and middleware
+// aren't run. Selecting the upstream counts like a request for stateful balancers, e.g. RoundRobin.
+// An error is returned if the path isn't a valid request URI or the UpstreamSelector fails.
+func (pm *ReverseProxyMux) Match(method, path, host string) (RouteMatch, error) {
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return RouteMatch{}, err
+	}
+	r, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return RouteMatch{}, err
+	}
+	r.Host = host
+	w := &matchWriter{header: make(http.Header)}
+	pm.table.Load().router.ServeHTTP(w, r)
+	if w.err != nil {
+		return RouteMatch{}, w.err
+	}
+	if w.matched {
+		return w.match, nil
+	}
+	return RouteMatch{Status: w.status, Header: w.header}, nil
+}
+
+// matchWriter is the http.ResponseWriter of a dry run, recording the match of the route handler or
+// the answer of the router.
+type matchWriter struct {
+	header  http.Header
+	status  int
+	matched bool
+	match   RouteMatch
+	err     error
+}
+
+// Header returns the header map of the answer.
+func (w *matchWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status of the answer.
+func (w *matchWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write discards the body of the answer.
+func (w *matchWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+// dryRun records the match of the request by the route handler, rewriting a clone of the request
+// like proxy does.
+func (h *routeHandler) dryRun(w *matchWriter, r *http.Request) {
+	route := h.route
+	m := RouteMatch{Route: &route}
+	for _, p := range httprouter.ParamsFromContext(r.Context()) {
+		m.Params = append(m.Params, proxyctx.Param{Key: p.Key, Value: p.Value})
+	}
+	if h.stub == nil {
+		var err error
+		if m.Upstream, _, err = h.pm.selectUpstream(r); err != nil {
+			w.err = err
+			return
+		}
+	}
+	if m.Upstream != nil {
+		r = r.Clone(r.Context())
+		host := r.Host
+		switch route.HostMode {
+		case HostPreserve:
+		case HostCustom:
+			r.Host = route.Host
+		default:
+			r.Host = m.Upstream.url.Host
+		}
+		if h.rewriter != nil {
+			h.rewriter.Rewrite(r)
+		}
+		if h.mount != nil {
+			h.mount.rewrite(r)
+		}
+		applyRewrites(h.rewrites, r, host, nil)
+		m.Upstream.director(r)
+		m.URL, m.Host = r.URL, r.Host
+	}
+	w.matched, w.match = true, m
+}
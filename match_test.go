@@ -0,0 +1,123 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	pm := newTableTestMux(t)
+	origin := pm.Remote()
+	pm.HandlePath(NewRoute("GET", "/users/:id").SetRewritePath("/v1/users/:id"))
+	pm.HandlePath(NewRoute("GET", "/search").
+		AddRewrite(RewriteRule{Target: RewriteTargetQuery, Pattern: "^q=", Replacement: "query="}).
+		SetPreserveHost(true))
+	pm.HandlePath(NewRoute("GET", "/dir/"))
+	pm.HandlePath(NewRoute("GET", "/health").SetStubResponse(http.StatusOK, nil, "ok"))
+	sub := newTableTestMux(t)
+	sub.HandlePath(NewRoute("GET", "/orders"))
+	pm.Mount("/shop", sub)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		host     string
+		route    string
+		params   proxyctx.Params
+		url      string
+		upHost   string
+		status   int
+		header   string
+		upstream bool
+	}{
+		{
+			name:     "Test path rewrite",
+			method:   "GET",
+			path:     "/users/42",
+			host:     "example.com",
+			route:    "/users/:id",
+			params:   proxyctx.Params{{Key: "id", Value: "42"}},
+			url:      origin.String() + "/v1/users/42",
+			upHost:   origin.Host,
+			upstream: true,
+		},
+		{
+			name:     "Test query rewrite with preserved host",
+			method:   "GET",
+			path:     "/search?q=go",
+			host:     "example.com",
+			route:    "/search",
+			url:      origin.String() + "/search?query=go",
+			upHost:   "example.com",
+			upstream: true,
+		},
+		{
+			name:   "Test stub route",
+			method: "GET",
+			path:   "/health",
+			route:  "/health",
+		},
+		{
+			name:     "Test nested mux",
+			method:   "GET",
+			path:     "/shop/orders",
+			route:    "/orders",
+			url:      sub.Remote().String() + "/orders",
+			upHost:   sub.Remote().Host,
+			upstream: true,
+		},
+		{
+			name:   "Test not found",
+			method: "GET",
+			path:   "/missing",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Test method not allowed",
+			method: "POST",
+			path:   "/search",
+			status: http.StatusMethodNotAllowed,
+			header: "Allow",
+		},
+		{
+			name:   "Test trailing slash redirect",
+			method: "GET",
+			path:   "/dir",
+			status: http.StatusMovedPermanently,
+			header: "Location",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := pm.Match(tt.method, tt.path, tt.host)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, m.Status)
+			if tt.header != "" {
+				assert.NotEmpty(t, m.Header.Get(tt.header))
+			}
+			if tt.route == "" {
+				assert.Nil(t, m.Route)
+				return
+			}
+			assert.Equal(t, tt.route, m.Route.Path)
+			if tt.params != nil {
+				assert.Equal(t, tt.params, m.Params)
+			}
+			assert.Equal(t, tt.upstream, m.Upstream != nil)
+			if tt.upstream {
+				assert.Equal(t, tt.url, m.URL.String())
+				assert.Equal(t, tt.upHost, m.Host)
+			}
+		})
+	}
+}
+
+func TestMatch_InvalidPath(t *testing.T) {
+	pm := newTableTestMux(t)
+	_, err := pm.Match("GET", "users", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RequestMetrics describes a request served by a registered route.
+type RequestMetrics struct {
+	Method   string
+	Route    string
+	Group    string
+	Status   int
+	Duration time.Duration
+	// Err is the error of the request, e.g. a ProxyError, or wrapping ErrPartialResponse or ErrSlowClient.
+	Err error
+	// Backend is the backend selected for the request, or nil if none was available.
+	Backend *Backend
+	// Operation is the operation of the request set by SetOperation, e.g. a GraphQL operation.
+	Operation string
+	// Conn holds the transport stats of the upstream request, nil if no connection was used, e.g. for
+	// cached responses.
+	Conn *ConnStats
+}
+
+// MetricsHook is a function called after a registered route served a request.
+type MetricsHook func(RequestMetrics)
+
+// AddMetricsHook registers a hook called after each request served by a registered route.
+// The hooks are called synchronously, so they should return quickly. It's safe to call while the
+// proxy is serving requests, and panics if the mux is frozen.
+func (pm *ReverseProxyMux) AddMetricsHook(hook MetricsHook) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	var hooks []MetricsHook
+	if current := pm.metricsHooks.Load(); current != nil {
+		hooks = slices.Clone(*current)
+	}
+	hooks = append(hooks, hook)
+	pm.metricsHooks.Store(&hooks)
+	return pm
+}
+
+// observe calls the metrics hooks for the request served by the route.
+func (pm *ReverseProxyMux) observe(route Route, r *http.Request, status int, start time.Time, x *exchange) {
+	hooks := pm.metricsHooks.Load()
+	if hooks == nil {
+		return
+	}
+	m := RequestMetrics{
+		Method:    r.Method,
+		Route:     route.Path,
+		Group:     route.Group,
+		Status:    status,
+		Duration:  time.Since(start),
+		Err:       x.err,
+		Backend:   x.backend,
+		Operation: x.operation,
+		Conn:      x.conn,
+	}
+	for _, hook := range *hooks {
+		hook(m)
+	}
+}
+
+// responseRecorder is a http.ResponseWriter recording the status code written to the wrapped writer.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it to the wrapped writer.
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the data to the wrapped writer, recording an implicit HTTP 200 OK status code.
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the buffered data of the wrapped writer, if supported.
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the recorded status code or HTTP 200 OK if nothing has been written.
+func (w *responseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
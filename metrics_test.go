@@ -0,0 +1,39 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddMetricsHook(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPath("GET", "/users")
+
+	// the hooks can be added while serving
+	var first, second atomic.Int32
+	pm.AddMetricsHook(func(m RequestMetrics) { first.Add(1) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			serve(pm, "GET", "/users")
+		}
+	}()
+	pm.AddMetricsHook(func(m RequestMetrics) { second.Add(1) })
+	<-done
+	serve(pm, "GET", "/users")
+	assert.Equal(t, int32(11), first.Load())
+	assert.NotZero(t, second.Load())
+
+	pm.Freeze()
+	assert.PanicsWithValue(t, ErrFrozen, func() {
+		pm.AddMetricsHook(func(m RequestMetrics) {})
+	})
+}
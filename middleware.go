@@ -0,0 +1,119 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Middleware is a function wrapping an HTTP handler, compatible with the common
+// func(http.Handler) http.Handler middleware ecosystems.
+type Middleware func(http.Handler) http.Handler
+
+// Use registers middleware wrapping the handlers of all routes. The middleware registered first is the
+// outermost one. The middleware only sees the requests matched by a route, after the route parameters
+// are stored in the request context, and the CONNECT requests tunneled by the Connect settings.
+func (pm *ReverseProxyMux) Use(middleware ...Middleware) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	pm.middleware = append(pm.middleware, middleware...)
+	if err := pm.swapRoutes(pm.routes); err != nil {
+		panic(err)
+	}
+	return pm
+}
+
+// UseGroup registers middleware wrapping the handlers of the routes of the named group. The group
+// middleware runs inside the middleware registered by Use.
+func (pm *ReverseProxyMux) UseGroup(group string, middleware ...Middleware) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	if pm.groupMws == nil {
+		pm.groupMws = make(map[string][]Middleware)
+	}
+	pm.groupMws[group] = append(pm.groupMws[group], middleware...)
+	if err := pm.swapRoutes(pm.routes); err != nil {
+		panic(err)
+	}
+	return pm
+}
+
+// AppendModifier appends modifiers to the response modifier chain of the mux. The response modifiers
+// run in a fixed order: the ModifyResponse of the mux, the chain of the mux, the ModifyResponse of the
+// route, then the chain of the route, each chain in the order the modifiers were appended. The first
+// modifier returning an error stops the chain, and the error is passed to the ErrorHandler.
+func (pm *ReverseProxyMux) AppendModifier(modifiers ...ResponseModifier) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	pm.modifiers = append(slices.Clone(pm.modifiers), modifiers...)
+	if err := pm.swapRoutes(pm.routes); err != nil {
+		panic(err)
+	}
+	return pm
+}
+
+// applyMiddleware wraps the handler of the route with the mux and group middleware. The caller must hold pm.mu.
+func (pm *ReverseProxyMux) applyMiddleware(route Route, h http.Handler) http.Handler {
+	var chain []Middleware
+	chain = append(chain, pm.middleware...)
+	if route.Group != "" {
+		chain = append(chain, pm.groupMws[route.Group]...)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// MountedAt returns a handler for mounting the proxy under the path prefix of another router, e.g.
+// http.ServeMux, chi or gin. The prefix is stripped from the request path before routing, so the routes
+// are registered without it, and it's passed to the origin in the X-Forwarded-Prefix header.
+// Requests outside the prefix are answered with HTTP 404 not found.
+func (pm *ReverseProxyMux) MountedAt(prefix string) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return pm
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := stripPathPrefix(r.URL.Path, prefix)
+		if !ok {
+			pm.notFound(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = p
+		if r.URL.RawPath != "" {
+			if rp, ok := stripPathPrefix(r.URL.RawPath, prefix); ok {
+				r2.URL.RawPath = rp
+			} else {
+				r2.URL.RawPath = ""
+			}
+		}
+		r2.Header.Set("X-Forwarded-Prefix", prefix)
+		pm.ServeHTTP(w, r2)
+	})
+}
+
+// stripPathPrefix removes the prefix from the path at a segment boundary, keeping the leading slash.
+func stripPathPrefix(path, prefix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	rest := path[len(prefix):]
+	if rest == "" {
+		return "/", true
+	}
+	if rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
@@ -0,0 +1,139 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMiddlewareTestMux(t *testing.T) *ReverseProxyMux {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Forwarded-Prefix")+" "+r.URL.Path+" "+r.Header.Get("X-Chain"))
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	return pm
+}
+
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-Chain", strings.TrimSpace(r.Header.Get("X-Chain")+" "+name))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.HandlePath(NewRoute("GET", "/admin").SetGroup("admin"))
+	pm.Use(tag("a"), tag("b"))
+	pm.UseGroup("admin", tag("auth"))
+	pm.PassPath("GET", "/posts")
+
+	assert.Equal(t, " /users a b", serve(pm, "GET", "/users").Body.String())
+	assert.Equal(t, " /posts a b", serve(pm, "GET", "/posts").Body.String(), "middleware should apply to routes added later")
+	assert.Equal(t, " /admin a b auth", serve(pm, "GET", "/admin").Body.String())
+}
+
+func TestUseRejects(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/admin").SetGroup("admin"))
+	var status int
+	pm.AddMetricsHook(func(m RequestMetrics) {
+		status = m.Status
+	})
+	pm.UseGroup("admin", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, serve(pm, "GET", "/admin").Code)
+	assert.Equal(t, http.StatusUnauthorized, status, "rejected requests should be observed")
+}
+
+func TestMountedAt(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassAnyPath("GET")
+
+	mux := http.NewServeMux()
+	mux.Handle("/gateway/", pm.MountedAt("/gateway/"))
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"Test nested path", "/gateway/api/users", http.StatusOK, "/gateway /api/users "},
+		{"Test prefix root", "/gateway/", http.StatusOK, "/gateway / "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, "GET", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(pm.MountedAt("/gateway"), "GET", "/gatewayx/users").Code)
+}
+
+func chainModifier(name string) ResponseModifier {
+	return func(res *http.Response) error {
+		res.Header.Set("X-Modifiers", strings.TrimSpace(res.Header.Get("X-Modifiers")+" "+name))
+		return nil
+	}
+}
+
+func TestAppendModifier(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.ModifyResponse = chainModifier("mux")
+	pm.HandlePath(NewRoute("GET", "/users").
+		AppendModifier(chainModifier("route-1")).
+		SetModifyResponse(chainModifier("route")).
+		AppendModifier(chainModifier("route-2")))
+	pm.AppendModifier(chainModifier("mux-1"), chainModifier("mux-2"))
+	pm.PassPath("GET", "/posts")
+
+	assert.Equal(t, "mux mux-1 mux-2 route route-1 route-2", serve(pm, "GET", "/users").Header().Get("X-Modifiers"))
+	assert.Equal(t, "mux mux-1 mux-2", serve(pm, "GET", "/posts").Header().Get("X-Modifiers"), "modifiers should apply to routes added earlier")
+}
+
+func TestAppendModifier_Error(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	var gotErr error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		gotErr = err
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	pm.AppendModifier(chainModifier("mux-1"), func(res *http.Response) error {
+		return io.ErrUnexpectedEOF
+	})
+	var called bool
+	pm.HandlePath(NewRoute("GET", "/users").AppendModifier(func(res *http.Response) error {
+		called = true
+		return nil
+	}))
+
+	assert.Equal(t, http.StatusBadGateway, serve(pm, "GET", "/users").Code)
+	assert.ErrorIs(t, gotErr, io.ErrUnexpectedEOF)
+	assert.ErrorIs(t, gotErr, ErrRewriteFailed)
+	assert.False(t, called, "the chain should stop at the first error")
+}
+
+func TestRoute_AppendModifier(t *testing.T) {
+	base := NewRoute("GET", "/users").AppendModifier(chainModifier("a"))
+	r1 := base.AppendModifier(chainModifier("b"))
+	r2 := base.AppendModifier(chainModifier("c"))
+	assert.Len(t, base.Modifiers, 1)
+	assert.Len(t, r1.Modifiers, 2)
+	assert.Len(t, r2.Modifiers, 2)
+}
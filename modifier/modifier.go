@@ -0,0 +1,176 @@
+// Package modifier provides constructors of common response modifiers, e.g. intercepting upstream
+// errors or swapping response bodies conditionally:
+//
+//	route.SetModifyResponse(modifier.OnStatus(modifier.Status5xx,
+//		modifier.ReplaceBody(http.StatusBadGateway, "application/json", []byte(`{"error":"upstream failed"}`))))
+package modifier
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// StatusMatcher reports whether a response status code matches.
+type StatusMatcher func(status int) bool
+
+var (
+	// Status1xx matches the informational status codes.
+	Status1xx = StatusClass(1)
+	// Status2xx matches the successful status codes.
+	Status2xx = StatusClass(2)
+	// Status3xx matches the redirection status codes.
+	Status3xx = StatusClass(3)
+	// Status4xx matches the client error status codes.
+	Status4xx = StatusClass(4)
+	// Status5xx matches the server error status codes.
+	Status5xx = StatusClass(5)
+)
+
+// StatusClass returns a matcher of the status codes of a class, e.g. 5 for 500-599.
+func StatusClass(class int) StatusMatcher {
+	return func(status int) bool {
+		return status/100 == class
+	}
+}
+
+// StatusIn returns a matcher of the passed status codes.
+func StatusIn(codes ...int) StatusMatcher {
+	return func(status int) bool {
+		for _, code := range codes {
+			if status == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// OnStatus returns a modifier running m only for responses with a matching status code.
+func OnStatus(match StatusMatcher, m reverseproxy.ResponseModifier) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		if !match(res.StatusCode) {
+			return nil
+		}
+		return m(res)
+	}
+}
+
+// WhenStatus returns a modifier running m only for responses with the status code.
+func WhenStatus(status int, m reverseproxy.ResponseModifier) reverseproxy.ResponseModifier {
+	return OnStatus(StatusIn(status), m)
+}
+
+// WhenContentType returns a modifier running m only for responses of the media type, ignoring its
+// parameters, e.g. "text/html" matches "text/html; charset=utf-8". A media type ending in /* matches
+// all subtypes, e.g. "text/*".
+func WhenContentType(mediaType string, m reverseproxy.ResponseModifier) reverseproxy.ResponseModifier {
+	return When(func(res *http.Response) bool {
+		return matchMediaType(mediaType, res.Header.Get("Content-Type"))
+	}, m)
+}
+
+// When returns a modifier running m only for the responses matched by the predicate.
+func When(match func(*http.Response) bool, m reverseproxy.ResponseModifier) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		if !match(res) {
+			return nil
+		}
+		return m(res)
+	}
+}
+
+// matchMediaType returns whether the Content-Type header matches the media type.
+func matchMediaType(mediaType, contentType string) bool {
+	got, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	mediaType = strings.ToLower(mediaType)
+	if prefix, ok := strings.CutSuffix(mediaType, "/*"); ok {
+		return strings.HasPrefix(got, prefix+"/")
+	}
+	return got == mediaType
+}
+
+// Chain returns a modifier running the passed modifiers in order, stopping at the first error.
+func Chain(modifiers ...reverseproxy.ResponseModifier) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		for _, m := range modifiers {
+			if err := m(res); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SetStatus returns a modifier replacing the status code of the response.
+func SetStatus(status int) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		setStatus(res, status)
+		return nil
+	}
+}
+
+// SetHeader returns a modifier setting a response header.
+func SetHeader(name, value string) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		res.Header.Set(name, value)
+		return nil
+	}
+}
+
+// DelHeader returns a modifier deleting response headers.
+func DelHeader(names ...string) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		for _, name := range names {
+			res.Header.Del(name)
+		}
+		return nil
+	}
+}
+
+// ReplaceBody returns a modifier replacing the status code, content type and body of the response.
+// The upstream body is discarded and the Content-Length is set to the length of the new body.
+// A zero status keeps the upstream status code, an empty content type the upstream content type.
+func ReplaceBody(status int, contentType string, body []byte) reverseproxy.ResponseModifier {
+	return func(res *http.Response) error {
+		if status != 0 {
+			setStatus(res, status)
+		}
+		if contentType != "" {
+			res.Header.Set("Content-Type", contentType)
+		}
+		SetBody(res, body)
+		return nil
+	}
+}
+
+// SetBody replaces the body of the response, updating the Content-Length and removing the headers
+// describing the replaced body.
+func SetBody(res *http.Response, body []byte) {
+	if res.Body != nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		_ = res.Body.Close()
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.TransferEncoding = nil
+	res.Uncompressed = false
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	for _, name := range []string{"Content-Encoding", "Content-Range", "ETag", "Last-Modified", "Transfer-Encoding"} {
+		res.Header.Del(name)
+	}
+}
+
+// setStatus sets the status code and status line of the response.
+func setStatus(res *http.Response, status int) {
+	res.StatusCode = status
+	res.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+}
@@ -0,0 +1,123 @@
+package modifier
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}, "Content-Length": {"999"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: 999,
+	}
+}
+
+func TestStatusMatchers(t *testing.T) {
+	assert.True(t, Status5xx(503))
+	assert.False(t, Status5xx(404))
+	assert.True(t, Status4xx(404))
+	assert.True(t, StatusIn(404, 410)(410))
+	assert.False(t, StatusIn(404, 410)(200))
+}
+
+func TestOnStatusReplaceBody(t *testing.T) {
+	m := OnStatus(Status5xx, ReplaceBody(http.StatusBadGateway, "application/json", []byte(`{"error":"upstream"}`)))
+
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantBody   string
+		wantType   string
+	}{
+		{"Test matching status", 500, http.StatusBadGateway, `{"error":"upstream"}`, "application/json"},
+		{"Test other status", 200, http.StatusOK, "original", "text/html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := newResponse(tt.status, "original")
+			assert.NoError(t, m(res))
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantType, res.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+
+	res := newResponse(500, "original")
+	assert.NoError(t, m(res))
+	assert.Equal(t, int64(20), res.ContentLength)
+	assert.Equal(t, "20", res.Header.Get("Content-Length"))
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "502 Bad Gateway", res.Status)
+}
+
+func TestWhen(t *testing.T) {
+	tests := []struct {
+		name        string
+		m           reverseproxy.ResponseModifier
+		status      int
+		contentType string
+		want        bool
+	}{
+		{"Test status", WhenStatus(500, SetHeader("X-Hit", "1")), 500, "text/html", true},
+		{"Test other status", WhenStatus(500, SetHeader("X-Hit", "1")), 502, "text/html", false},
+		{"Test content type", WhenContentType("text/html", SetHeader("X-Hit", "1")), 200, "text/html", true},
+		{"Test content type parameters", WhenContentType("text/html", SetHeader("X-Hit", "1")), 200, "Text/HTML; charset=utf-8", true},
+		{"Test other content type", WhenContentType("text/html", SetHeader("X-Hit", "1")), 200, "application/json", false},
+		{"Test wildcard subtype", WhenContentType("text/*", SetHeader("X-Hit", "1")), 200, "text/plain", true},
+		{"Test wildcard other type", WhenContentType("text/*", SetHeader("X-Hit", "1")), 200, "textual/plain", false},
+		{"Test missing content type", WhenContentType("text/html", SetHeader("X-Hit", "1")), 200, "", false},
+		{"Test nested", WhenStatus(404, WhenContentType("application/json", SetHeader("X-Hit", "1"))), 404, "application/json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := newResponse(tt.status, "")
+			res.Header.Set("Content-Type", tt.contentType)
+			assert.NoError(t, tt.m(res))
+			assert.Equal(t, tt.want, res.Header.Get("X-Hit") == "1")
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	fail := errors.New("fail")
+	var calls []string
+	record := func(name string, err error) reverseproxy.ResponseModifier {
+		return func(*http.Response) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	err := Chain(record("a", nil), SetHeader("X-A", "1"), DelHeader("Content-Type"), record("b", fail), record("c", nil))(newResponse(200, ""))
+	assert.ErrorIs(t, err, fail)
+	assert.Equal(t, []string{"a", "b"}, calls)
+}
+
+func TestReplaceBodyThroughProxy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, "stack trace")
+	}))
+	defer origin.Close()
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(reverseproxy.NewRoute("GET", "/api").
+		SetModifyResponse(OnStatus(Status5xx, ReplaceBody(0, "text/plain", []byte("sorry")))))
+
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sorry", w.Body.String())
+	assert.Equal(t, "5", w.Header().Get("Content-Length"))
+}
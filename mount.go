@@ -0,0 +1,113 @@
+package reverseproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MountPrefix registers a route forwarding all requests under the path prefix to the same paths under
+// the upstream path, e.g. MountPrefix("/svc", "/") forwards /svc/users to /users. The prefix is passed to
+// the origin in the X-Forwarded-Prefix header, and the paths of the Location and Set-Cookie headers of the
+// responses are mapped back under the prefix. It panics if the route conflicts with a registered route.
+func (pm *ReverseProxyMux) MountPrefix(prefix, upstream string) *ReverseProxyMux {
+	prefix = "/" + strings.Trim(prefix, "/")
+	route := NewRoute("*", strings.TrimSuffix(prefix, "/")+"/*path")
+	route.Prefix = prefix
+	route.UpstreamPrefix = "/" + strings.Trim(upstream, "/")
+	return pm.HandlePath(route)
+}
+
+// prefixMount maps the paths under the prefix of a route to the paths under the upstream prefix.
+type prefixMount struct {
+	prefix   string
+	upstream string
+}
+
+// newPrefixMount creates the prefix mapping of the route, or nil if the route has no prefix.
+func newPrefixMount(route Route) (*prefixMount, error) {
+	if route.Prefix == "" {
+		return nil, nil
+	}
+	if route.RewritePath != "" {
+		return nil, errors.New("the RewritePath and Prefix of a route are exclusive")
+	}
+	return &prefixMount{
+		prefix:   "/" + strings.Trim(route.Prefix, "/"),
+		upstream: "/" + strings.Trim(route.UpstreamPrefix, "/"),
+	}, nil
+}
+
+// swapPathPrefix replaces the from prefix of the path with the to prefix at a segment boundary.
+func swapPathPrefix(path, from, to string) (string, bool) {
+	rest, ok := path, strings.HasPrefix(path, "/")
+	if from != "/" {
+		rest, ok = stripPathPrefix(path, from)
+	}
+	if !ok {
+		return path, false
+	}
+	if to == "/" {
+		return rest, true
+	}
+	if rest == "/" && !strings.HasSuffix(path, "/") {
+		return to, true
+	}
+	return to + rest, true
+}
+
+// rewrite maps the path of the outbound request to the upstream prefix.
+func (m *prefixMount) rewrite(r *http.Request) {
+	r.URL.Path, _ = swapPathPrefix(r.URL.Path, m.prefix, m.upstream)
+	if r.URL.RawPath != "" {
+		if rp, ok := swapPathPrefix(r.URL.RawPath, m.prefix, m.upstream); ok {
+			r.URL.RawPath = rp
+		} else {
+			r.URL.RawPath = ""
+		}
+	}
+	r.Header.Set("X-Forwarded-Prefix", m.prefix)
+}
+
+// modifyResponse maps the paths of the Location and Set-Cookie headers of the response back under the
+// prefix. Locations pointing to the backend are made host-relative, so the client stays on the proxy.
+func (m *prefixMount) modifyResponse(res *http.Response) {
+	if loc := res.Header.Get("Location"); loc != "" {
+		res.Header.Set("Location", m.location(loc, res.Request.URL.Host))
+	}
+	cookies := res.Header.Values("Set-Cookie")
+	for i, cookie := range cookies {
+		cookies[i] = m.cookie(cookie)
+	}
+}
+
+// location maps the path of a Location header, if it's host-relative or points to the backend host.
+func (m *prefixMount) location(loc, backendHost string) string {
+	u, err := url.Parse(loc)
+	if err != nil || u.Opaque != "" || u.Host != "" && u.Host != backendHost || !strings.HasPrefix(u.Path, "/") {
+		return loc
+	}
+	p, ok := swapPathPrefix(u.Path, m.upstream, m.prefix)
+	if !ok {
+		return loc
+	}
+	u.Scheme, u.Host, u.User = "", "", nil
+	u.Path, u.RawPath = p, ""
+	return u.String()
+}
+
+// cookie maps the Path attribute of a Set-Cookie header.
+func (m *prefixMount) cookie(cookie string) string {
+	attrs := strings.Split(cookie, ";")
+	for i, attr := range attrs[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		if !strings.EqualFold(name, "Path") {
+			continue
+		}
+		if p, ok := swapPathPrefix(value, m.upstream, m.prefix); ok {
+			attrs[i+1] = " Path=" + p
+		}
+	}
+	return strings.Join(attrs, ";")
+}
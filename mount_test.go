@@ -0,0 +1,67 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountPrefix(t *testing.T) {
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/api/account", HttpOnly: true})
+			http.Redirect(w, r, "/api/account", http.StatusFound)
+		case "/api/absolute":
+			http.Redirect(w, r, origin.URL+"/api/account?tab=1", http.StatusFound)
+		case "/api/external":
+			http.Redirect(w, r, "https://example.com/api/account", http.StatusFound)
+		default:
+			_, _ = io.WriteString(w, r.Header.Get("X-Forwarded-Prefix")+" "+r.URL.Path)
+		}
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.MountPrefix("/svc", "/api")
+	pm.MountPrefix("/root/", "/")
+
+	tests := []struct {
+		name         string
+		target       string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+		wantCookie   string
+	}{
+		{"Test mapped path", "/svc/users/1", http.StatusOK, "/svc /api/users/1", "", ""},
+		{"Test mapped prefix", "/svc/", http.StatusOK, "/svc /api/", "", ""},
+		{"Test stripped prefix", "/root/users", http.StatusOK, "/root /users", "", ""},
+		{"Test relative location", "/svc/login", http.StatusFound, "", "/svc/account", "session=1; Path=/svc/account; HttpOnly"},
+		{"Test backend location", "/svc/absolute", http.StatusFound, "", "/svc/account?tab=1", ""},
+		{"Test external location", "/svc/external", http.StatusFound, "", "https://example.com/api/account", ""},
+		{"Test location of stripped prefix", "/root/api/login", http.StatusFound, "", "/root/api/account", "session=1; Path=/root/api/account; HttpOnly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+			assert.Equal(t, tt.wantCookie, w.Header().Get("Set-Cookie"))
+		})
+	}
+}
+
+func TestMountPrefix_RewritePath(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	route := NewRoute("GET", "/svc/*path").SetRewritePath("/*path")
+	route.Prefix = "/svc"
+	assert.Error(t, pm.AddRoute(route))
+}
@@ -0,0 +1,309 @@
+// Package openapi loads OpenAPI 3.0 documents in YAML or JSON, creates the routes of a mux from their
+// paths, and validates the proxied requests against their operations: the path, query, header and cookie
+// parameters and the JSON request bodies.
+//
+// The document model covers the parts of the specification used for validating and routing requests.
+// Local references to the components of the document ("#/components/...") are resolved when loading it.
+// The supported schema keywords are type, nullable, enum, properties, required, additionalProperties,
+// items, the numeric, length and item count bounds, pattern, allOf, anyOf and oneOf.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnresolvedRef is returned when loading a document with a reference which can't be resolved.
+var ErrUnresolvedRef = errors.New("unresolved reference")
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+// Server is a server of the API.
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+// Components holds the reusable objects of the document.
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+}
+
+// PathItem describes the operations of a path.
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Options    *Operation   `yaml:"options"`
+	Head       *Operation   `yaml:"head"`
+	Patch      *Operation   `yaml:"patch"`
+	Trace      *Operation   `yaml:"trace"`
+}
+
+// Operations returns the operations of the path keyed by their HTTP method.
+func (p *PathItem) Operations() map[string]*Operation {
+	ops := make(map[string]*Operation)
+	for method, op := range map[string]*Operation{
+		http.MethodGet:     p.Get,
+		http.MethodPut:     p.Put,
+		http.MethodPost:    p.Post,
+		http.MethodDelete:  p.Delete,
+		http.MethodOptions: p.Options,
+		http.MethodHead:    p.Head,
+		http.MethodPatch:   p.Patch,
+		http.MethodTrace:   p.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// Operation is an API operation on a path.
+type Operation struct {
+	OperationID string       `yaml:"operationId"`
+	Parameters  []*Parameter `yaml:"parameters"`
+	RequestBody *RequestBody `yaml:"requestBody"`
+}
+
+// Parameter is a path, query, header or cookie parameter of an operation.
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+	// Explode defaults to true for the form style of query and cookie parameters.
+	Explode *bool `yaml:"explode"`
+}
+
+// RequestBody is the request body of an operation, keyed by media type.
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+// MediaType describes the request body of a media type.
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Schema is a schema of a parameter or body value.
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Nullable             bool               `yaml:"nullable"`
+	Enum                 []any              `yaml:"enum"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	AdditionalProperties *Additional        `yaml:"additionalProperties"`
+	Items                *Schema            `yaml:"items"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	ExclusiveMinimum     bool               `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum     bool               `yaml:"exclusiveMaximum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	Pattern              string             `yaml:"pattern"`
+	MinItems             *int               `yaml:"minItems"`
+	MaxItems             *int               `yaml:"maxItems"`
+	AllOf                []*Schema          `yaml:"allOf"`
+	AnyOf                []*Schema          `yaml:"anyOf"`
+	OneOf                []*Schema          `yaml:"oneOf"`
+
+	pattern *regexp.Regexp
+}
+
+// Additional is the additionalProperties keyword of a schema, either a boolean or a schema.
+type Additional struct {
+	// Forbidden rejects the properties not listed in the properties of the schema.
+	Forbidden bool
+	// Schema validates the properties not listed in the properties of the schema.
+	Schema *Schema
+}
+
+// UnmarshalYAML decodes a boolean or a schema.
+func (a *Additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err
+		}
+		a.Forbidden = !allowed
+		return nil
+	}
+	return node.Decode(&a.Schema)
+}
+
+// Load parses an OpenAPI 3.0 document in YAML or JSON and resolves its references.
+func Load(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+	if err := doc.resolve(); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return &doc, nil
+}
+
+// LoadFile loads the OpenAPI 3.0 document of the named file, see Load.
+func LoadFile(name string) (*Document, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// resolve replaces the references of the document by the referenced components and compiles the
+// patterns of the schemas.
+func (d *Document) resolve() error {
+	r := &resolver{doc: d, seen: make(map[*Schema]bool)}
+	for _, s := range d.Components.Schemas {
+		r.schema(&s)
+	}
+	for name, p := range d.Components.Parameters {
+		d.Components.Parameters[name] = r.parameter(p)
+	}
+	for name, b := range d.Components.RequestBodies {
+		d.Components.RequestBodies[name] = r.requestBody(b)
+	}
+	for _, item := range d.Paths {
+		if item == nil {
+			continue
+		}
+		for i := range item.Parameters {
+			item.Parameters[i] = r.parameter(item.Parameters[i])
+		}
+		for _, op := range item.Operations() {
+			for i := range op.Parameters {
+				op.Parameters[i] = r.parameter(op.Parameters[i])
+			}
+			if op.RequestBody != nil {
+				op.RequestBody = r.requestBody(op.RequestBody)
+			}
+		}
+	}
+	return r.err
+}
+
+// resolver resolves the references of a document, recording the first error.
+type resolver struct {
+	doc  *Document
+	seen map[*Schema]bool
+	err  error
+}
+
+// fail records the error, if it's the first one.
+func (r *resolver) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// component returns the name of the component referenced in the section, e.g. "schemas".
+func (r *resolver) component(ref, section string) string {
+	name, ok := strings.CutPrefix(ref, "#/components/"+section+"/")
+	if !ok {
+		r.fail(fmt.Errorf("%w: %s", ErrUnresolvedRef, ref))
+	}
+	return name
+}
+
+// parameter resolves a parameter and its schema.
+func (r *resolver) parameter(p *Parameter) *Parameter {
+	if p != nil && p.Ref != "" {
+		target := r.doc.Components.Parameters[r.component(p.Ref, "parameters")]
+		if target == nil || target.Ref != "" {
+			r.fail(fmt.Errorf("%w: %s", ErrUnresolvedRef, p.Ref))
+			return &Parameter{}
+		}
+		p = target
+	}
+	if p != nil {
+		r.schema(&p.Schema)
+	}
+	return p
+}
+
+// requestBody resolves a request body and its schemas.
+func (r *resolver) requestBody(b *RequestBody) *RequestBody {
+	if b.Ref != "" {
+		target := r.doc.Components.RequestBodies[r.component(b.Ref, "requestBodies")]
+		if target == nil || target.Ref != "" {
+			r.fail(fmt.Errorf("%w: %s", ErrUnresolvedRef, b.Ref))
+			return &RequestBody{}
+		}
+		b = target
+	}
+	for _, mt := range b.Content {
+		if mt != nil {
+			r.schema(&mt.Schema)
+		}
+	}
+	return b
+}
+
+// schema replaces the schema in the slot by the referenced one and resolves its subschemas.
+func (r *resolver) schema(slot **Schema) {
+	s := *slot
+	if s == nil {
+		return
+	}
+	for hops := 0; s.Ref != ""; hops++ {
+		target := r.doc.Components.Schemas[r.component(s.Ref, "schemas")]
+		if target == nil || hops > len(r.doc.Components.Schemas) {
+			r.fail(fmt.Errorf("%w: %s", ErrUnresolvedRef, s.Ref))
+			*slot = &Schema{}
+			return
+		}
+		s = target
+	}
+	*slot = s
+	if r.seen[s] {
+		return
+	}
+	r.seen[s] = true
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			r.fail(fmt.Errorf("invalid pattern %q: %w", s.Pattern, err))
+		}
+		s.pattern = re
+	}
+	for name := range s.Properties {
+		prop := s.Properties[name]
+		r.schema(&prop)
+		s.Properties[name] = prop
+	}
+	if s.AdditionalProperties != nil {
+		r.schema(&s.AdditionalProperties.Schema)
+	}
+	r.schema(&s.Items)
+	for _, list := range [][]*Schema{s.AllOf, s.AnyOf, s.OneOf} {
+		for i := range list {
+			r.schema(&list[i])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package openapi
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// RouteOptions configure the routes generated from a document.
+type RouteOptions struct {
+	// Prefix is the path prefix the routes are served under, the BasePath of the document if empty.
+	// Other prefixes are mapped to the base path when forwarding, see reverseproxy.MountPrefix.
+	Prefix string
+	// Group is the group of the routes, e.g. for registering the Validator with UseGroup.
+	Group string
+}
+
+// Routes creates the routes of the paths of the document, with the methods of their operations, in
+// the order of the paths. The path templates are converted to route parameters, e.g. /users/{id} to
+// /users/:id. As the router can't hold literal and templated segments at the same position, e.g.
+// /users/me next to /users/{id}, such literal paths are merged into the templated route, which
+// forwards them unchanged.
+func Routes(doc *Document, opts RouteOptions) []reverseproxy.Route {
+	base := BasePath(doc)
+	prefix := strings.TrimSuffix(opts.Prefix, "/")
+	if opts.Prefix == "" {
+		prefix = base
+	}
+	paths := make([]string, 0, len(doc.Paths))
+	for path, item := range doc.Paths {
+		if item != nil && len(item.Operations()) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var routes []reverseproxy.Route
+	index := make(map[string]int)
+	for i, path := range routerPaths(paths) {
+		methods := make([]string, 0, 8)
+		for method := range doc.Paths[paths[i]].Operations() {
+			methods = append(methods, method)
+		}
+		if j, ok := index[path]; ok {
+			routes[j].Method = append(routes[j].Method, methods...)
+			sort.Strings(routes[j].Method)
+			routes[j].Method = slices.Compact(routes[j].Method)
+			continue
+		}
+		sort.Strings(methods)
+		route := reverseproxy.Route{Method: methods, Path: prefix + path, Group: opts.Group}
+		if prefix != base {
+			route.Prefix = "/" + strings.Trim(prefix, "/")
+			route.UpstreamPrefix = "/" + strings.Trim(base, "/")
+		}
+		index[path] = len(routes)
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// routerPaths converts the path templates to router paths. The segments at a position with a templated
+// segment in a path of the same parent become parameters named like the first template.
+func routerPaths(paths []string) []string {
+	segments := make([][]string, len(paths))
+	depth := 0
+	for i, path := range paths {
+		segments[i] = strings.Split(path, "/")
+		depth = max(depth, len(segments[i]))
+	}
+	for d := 0; d < depth; d++ {
+		params := make(map[string]string)
+		for _, segs := range segments {
+			if d >= len(segs) || !isTemplate(segs[d]) {
+				continue
+			}
+			parent := strings.Join(segs[:d], "/")
+			if _, ok := params[parent]; !ok {
+				params[parent] = ":" + segs[d][1:len(segs[d])-1]
+			}
+		}
+		for _, segs := range segments {
+			if d >= len(segs) {
+				continue
+			}
+			if param, ok := params[strings.Join(segs[:d], "/")]; ok {
+				segs[d] = param
+			}
+		}
+	}
+	routed := make([]string, len(paths))
+	for i, segs := range segments {
+		routed[i] = strings.Join(segs, "/")
+	}
+	return routed
+}
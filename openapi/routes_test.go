@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		opts RouteOptions
+		want []reverseproxy.Route
+	}{
+		{"Test base path", RouteOptions{Group: "api"}, []reverseproxy.Route{
+			{Method: []string{"GET", "POST"}, Path: "/v1/users", Group: "api"},
+			{Method: []string{"GET"}, Path: "/v1/users/:id", Group: "api"},
+		}},
+		{"Test prefix", RouteOptions{Prefix: "/api/"}, []reverseproxy.Route{
+			{Method: []string{"GET", "POST"}, Path: "/api/users", Prefix: "/api", UpstreamPrefix: "/v1"},
+			{Method: []string{"GET"}, Path: "/api/users/:id", Prefix: "/api", UpstreamPrefix: "/v1"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Routes(doc, tt.opts))
+		})
+	}
+}
+
+func TestRouterPaths(t *testing.T) {
+	paths := []string{"/files/{name}/raw", "/users/me/posts", "/users/{id}", "/users/{userId}/posts", "/users/{userId}/posts/{postId}"}
+	assert.Equal(t, []string{"/files/:name/raw", "/users/:id/posts", "/users/:id", "/users/:id/posts", "/users/:id/posts/:postId"}, routerPaths(paths))
+}
+
+func TestRoutes_Mux(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.Path)
+	}))
+	t.Cleanup(origin.Close)
+	doc, err := Load([]byte(testSpec))
+	assert.NoError(t, err)
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	for _, route := range Routes(doc, RouteOptions{Prefix: "/api", Group: "api"}) {
+		assert.NoError(t, pm.AddRoute(route))
+	}
+	v := NewValidator(doc)
+	v.BasePath = "/api"
+	pm.UseGroup("api", v.Middleware)
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"Test literal path", "/api/users/me", http.StatusBadRequest, ""},
+		{"Test templated path", "/api/users/42", http.StatusOK, "GET /v1/users/42"},
+		{"Test invalid parameter", "/api/users/abc", http.StatusBadRequest, ""},
+		{"Test unknown path", "/v1/users", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
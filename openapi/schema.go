@@ -0,0 +1,217 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// FieldError is a validation error of a request field.
+type FieldError struct {
+	// In is the location of the field: path, query, header, cookie or body.
+	In string `json:"in"`
+	// Name is the name of the parameter, or the JSONPath of the body value, e.g. $.items[0].id.
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// validator collects the errors of the values of a request location.
+type validator struct {
+	in     string
+	errors []FieldError
+}
+
+// fail records an error of the named field.
+func (v *validator) fail(name, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{In: v.in, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate validates the decoded JSON value against the schema. Numbers are float64, like decoded by
+// encoding/json.
+func (v *validator) validate(s *Schema, value any, name string) {
+	if s == nil {
+		return
+	}
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			v.fail(name, "must not be null")
+		}
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, name)
+	}
+	if len(s.AnyOf) > 0 && countValid(s.AnyOf, value) == 0 {
+		v.fail(name, "must match a schema of anyOf")
+	}
+	if len(s.OneOf) > 0 && countValid(s.OneOf, value) != 1 {
+		v.fail(name, "must match exactly one schema of oneOf")
+	}
+	if s.Type != "" && !hasType(value, s.Type) {
+		v.fail(name, "must be of type %s", s.Type)
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		v.fail(name, "must be one of %v", s.Enum)
+	}
+	switch value := value.(type) {
+	case string:
+		v.validateString(s, value, name)
+	case float64:
+		v.validateNumber(s, value, name)
+	case []any:
+		v.validateArray(s, value, name)
+	case map[string]any:
+		v.validateObject(s, value, name)
+	}
+}
+
+// validateString validates the length and pattern of a string.
+func (v *validator) validateString(s *Schema, value, name string) {
+	n := utf8.RuneCountInString(value)
+	if s.MinLength != nil && n < *s.MinLength {
+		v.fail(name, "must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		v.fail(name, "must be at most %d characters long", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		v.fail(name, "must match the pattern %s", s.Pattern)
+	}
+}
+
+// validateNumber validates the bounds of a number.
+func (v *validator) validateNumber(s *Schema, value float64, name string) {
+	if min := s.Minimum; min != nil && (value < *min || s.ExclusiveMinimum && value == *min) {
+		v.fail(name, "must be greater than %s%v", orEqual(!s.ExclusiveMinimum), *min)
+	}
+	if max := s.Maximum; max != nil && (value > *max || s.ExclusiveMaximum && value == *max) {
+		v.fail(name, "must be less than %s%v", orEqual(!s.ExclusiveMaximum), *max)
+	}
+}
+
+// orEqual returns the "or equal to " phrase of inclusive bounds.
+func orEqual(inclusive bool) string {
+	if inclusive {
+		return "or equal to "
+	}
+	return ""
+}
+
+// validateArray validates the item count and the items of an array.
+func (v *validator) validateArray(s *Schema, value []any, name string) {
+	if s.MinItems != nil && len(value) < *s.MinItems {
+		v.fail(name, "must have at least %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(value) > *s.MaxItems {
+		v.fail(name, "must have at most %d items", *s.MaxItems)
+	}
+	for i, item := range value {
+		v.validate(s.Items, item, name+"["+strconv.Itoa(i)+"]")
+	}
+}
+
+// validateObject validates the required, listed and additional properties of an object.
+func (v *validator) validateObject(s *Schema, value map[string]any, name string) {
+	for _, prop := range s.Required {
+		if _, ok := value[prop]; !ok {
+			v.fail(name+"."+prop, "is required")
+		}
+	}
+	props := make([]string, 0, len(value))
+	for prop := range value {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+	for _, prop := range props {
+		val := value[prop]
+		if ps, ok := s.Properties[prop]; ok {
+			v.validate(ps, val, name+"."+prop)
+			continue
+		}
+		if ap := s.AdditionalProperties; ap != nil {
+			if ap.Forbidden {
+				v.fail(name+"."+prop, "is not allowed")
+			} else {
+				v.validate(ap.Schema, val, name+"."+prop)
+			}
+		}
+	}
+}
+
+// countValid returns the number of schemas the value is valid against.
+func countValid(schemas []*Schema, value any) int {
+	n := 0
+	for _, s := range schemas {
+		sub := &validator{}
+		sub.validate(s, value, "")
+		if len(sub.errors) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// hasType reports whether the decoded JSON value is of the schema type.
+func hasType(value any, typ string) bool {
+	switch value := value.(type) {
+	case string:
+		return typ == "string"
+	case float64:
+		return typ == "number" || typ == "integer" && value == math.Trunc(value)
+	case bool:
+		return typ == "boolean"
+	case []any:
+		return typ == "array"
+	case map[string]any:
+		return typ == "object"
+	}
+	return false
+}
+
+// inEnum reports whether the decoded JSON value is one of the enum values decoded from the document.
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		switch n := e.(type) {
+		case int:
+			e = float64(n)
+		case uint64:
+			e = float64(n)
+		}
+		if reflect.DeepEqual(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseValue converts a parameter value to the type of the schema.
+func parseValue(s *Schema, raw string) (any, error) {
+	if s == nil {
+		return raw, nil
+	}
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return float64(n), nil
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
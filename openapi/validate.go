@@ -0,0 +1,340 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxBodySize is the default limit of the request bodies read for validation.
+const DefaultMaxBodySize = 1 << 20
+
+var (
+	// ErrNoOperation is returned when validating a request whose path has no operation in the document.
+	ErrNoOperation = errors.New("no operation for the path")
+	// ErrMethodNotAllowed is returned when validating a request whose method has no operation on the path.
+	ErrMethodNotAllowed = errors.New("method not allowed")
+)
+
+// ValidationError is the error of a request violating its operation.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error returns the first field error and the number of further errors.
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 0 {
+		return "invalid request"
+	}
+	f := e.Errors[0]
+	msg := fmt.Sprintf("invalid request: %s %s %s", f.In, f.Name, f.Message)
+	if len(e.Errors) > 1 {
+		msg += fmt.Sprintf(" (and %d more errors)", len(e.Errors)-1)
+	}
+	return msg
+}
+
+// Validator validates requests against the operations of a document.
+type Validator struct {
+	doc    *Document
+	routes []pathRoute
+	// BasePath is the path prefix the paths of the document are matched under, e.g. the Prefix of the
+	// RouteOptions of the routes serving the document.
+	BasePath string
+	// MaxBodySize limits the request bodies read for validation, DefaultMaxBodySize if zero.
+	MaxBodySize int64
+	// AllowUnknown passes the requests without an operation in the document on, instead of rejecting
+	// them with HTTP 404 not found or HTTP 405 method not allowed.
+	AllowUnknown bool
+}
+
+// pathRoute is a path of the document matched against the request paths.
+type pathRoute struct {
+	segments []string
+	item     *PathItem
+}
+
+// NewValidator creates a validator of the document. The paths of the document are matched below the
+// BasePath of the document by default, e.g. /v1 of https://api.example.com/v1.
+func NewValidator(doc *Document) *Validator {
+	v := &Validator{doc: doc, BasePath: BasePath(doc)}
+	for path, item := range doc.Paths {
+		if item != nil {
+			v.routes = append(v.routes, pathRoute{segments: strings.Split(path, "/"), item: item})
+		}
+	}
+	// literal segments take precedence over templated ones, e.g. /users/me over /users/{id}
+	sort.Slice(v.routes, func(i, j int) bool {
+		a, b := v.routes[i].segments, v.routes[j].segments
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if ta, tb := isTemplate(a[k]), isTemplate(b[k]); ta != tb {
+				return tb
+			}
+		}
+		return strings.Join(a, "/") < strings.Join(b, "/")
+	})
+	return v
+}
+
+// BasePath returns the path of the first server URL of the document, or "" if it has none.
+func BasePath(doc *Document) string {
+	if len(doc.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(doc.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// isTemplate reports whether the path segment is a template, e.g. {id}.
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// match returns the path item of the request path and its path parameters.
+func (v *Validator) match(path string) (*PathItem, map[string]string) {
+	path, ok := strings.CutPrefix(path, strings.TrimSuffix(v.BasePath, "/"))
+	if !ok {
+		return nil, nil
+	}
+	segments := strings.Split(path, "/")
+	for _, route := range v.routes {
+		if len(route.segments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, s := range route.segments {
+			if isTemplate(s) && segments[i] != "" {
+				params[s[1:len(s)-1]], _ = url.PathUnescape(segments[i])
+				continue
+			}
+			if s != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route.item, params
+		}
+	}
+	return nil, nil
+}
+
+// Validate validates the request against its operation, returning a *ValidationError listing the
+// violations, ErrNoOperation or ErrMethodNotAllowed. The request body is read for validation and
+// replaced, so it can still be forwarded.
+func (v *Validator) Validate(r *http.Request) error {
+	item, pathParams := v.match(r.URL.Path)
+	if item == nil {
+		return fmt.Errorf("%w: %s", ErrNoOperation, r.URL.Path)
+	}
+	op := item.Operations()[r.Method]
+	if op == nil {
+		return fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, r.Method, r.URL.Path)
+	}
+	var errs []FieldError
+	for _, p := range parameters(item, op) {
+		errs = append(errs, validateParameter(p, r, pathParams)...)
+	}
+	if op.RequestBody != nil {
+		bodyErrs, err := v.validateBody(op.RequestBody, r)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, bodyErrs...)
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// parameters returns the parameters of the operation, which override the ones of the path item.
+func parameters(item *PathItem, op *Operation) []*Parameter {
+	params := make([]*Parameter, 0, len(item.Parameters)+len(op.Parameters))
+	overridden := make(map[string]bool)
+	for _, p := range op.Parameters {
+		if p != nil {
+			overridden[p.In+" "+p.Name] = true
+			params = append(params, p)
+		}
+	}
+	for _, p := range item.Parameters {
+		if p != nil && !overridden[p.In+" "+p.Name] {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// validateParameter validates the value of a parameter in the request.
+func validateParameter(p *Parameter, r *http.Request, pathParams map[string]string) []FieldError {
+	v := &validator{in: p.In}
+	var values []string
+	switch p.In {
+	case "path":
+		if val, ok := pathParams[p.Name]; ok {
+			values = []string{val}
+		}
+	case "query":
+		values = r.URL.Query()[p.Name]
+	case "header":
+		if val := r.Header.Get(p.Name); val != "" {
+			values = []string{val}
+		}
+	case "cookie":
+		if c, err := r.Cookie(p.Name); err == nil {
+			values = []string{c.Value}
+		}
+	}
+	if len(values) == 0 {
+		if p.Required || p.In == "path" {
+			v.fail(p.Name, "is required")
+		}
+		return v.errors
+	}
+	if p.Schema != nil && p.Schema.Type == "array" {
+		explode := p.In == "query" || p.In == "cookie"
+		if p.Explode != nil {
+			explode = *p.Explode
+		}
+		if !explode || len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]any, 0, len(values))
+		for i, raw := range values {
+			val, err := parseValue(p.Schema.Items, raw)
+			if err != nil {
+				v.fail(fmt.Sprintf("%s[%d]", p.Name, i), "%v", err)
+				return v.errors
+			}
+			items = append(items, val)
+		}
+		v.validate(p.Schema, items, p.Name)
+		return v.errors
+	}
+	val, err := parseValue(p.Schema, values[0])
+	if err != nil {
+		v.fail(p.Name, "%v", err)
+		return v.errors
+	}
+	v.validate(p.Schema, val, p.Name)
+	return v.errors
+}
+
+// validateBody validates the request body against the schema of its media type. Only JSON bodies are
+// validated against their schema, the other media types are only checked to be accepted.
+func (v *Validator) validateBody(rb *RequestBody, r *http.Request) ([]FieldError, error) {
+	fv := &validator{in: "body"}
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	var data []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		data, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		if int64(len(data)) > limit {
+			fv.fail("$", "must be at most %d bytes long", limit)
+			return fv.errors, nil
+		}
+	}
+	if len(data) == 0 {
+		if rb.Required {
+			fv.fail("$", "is required")
+		}
+		return fv.errors, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	mt, ok := mediaTypeOf(rb.Content, mediaType)
+	if !ok {
+		fv.fail("$", "media type %q is not supported", mediaType)
+		return fv.errors, nil
+	}
+	if mt == nil || mt.Schema == nil || !isJSON(mediaType) {
+		return fv.errors, nil
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		fv.fail("$", "must be valid JSON: %v", err)
+		return fv.errors, nil
+	}
+	fv.validate(mt.Schema, value, "$")
+	return fv.errors, nil
+}
+
+// mediaTypeOf returns the content entry of the media type, falling back to the type/* and */* ranges.
+func mediaTypeOf(content map[string]*MediaType, mediaType string) (*MediaType, bool) {
+	if len(content) == 0 {
+		return nil, true
+	}
+	typ, _, _ := strings.Cut(mediaType, "/")
+	for _, key := range []string{mediaType, typ + "/*", "*/*"} {
+		if mt, ok := content[key]; ok {
+			return mt, true
+		}
+	}
+	return nil, false
+}
+
+// isJSON reports whether the media type is JSON, e.g. application/json or application/problem+json.
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Middleware returns a handler validating the requests before passing them to the next handler. Invalid
+// requests are answered with HTTP 400 bad request and a JSON body listing the violations, e.g.
+// {"error": "invalid request", "errors": [{"in": "query", "name": "limit", "message": "must be an integer"}]}.
+// It can be registered on a mux with Use or UseGroup.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := v.Validate(r)
+		var verr *ValidationError
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.Is(err, ErrNoOperation):
+			if v.AllowUnknown {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeError(w, http.StatusNotFound, err.Error(), nil)
+		case errors.Is(err, ErrMethodNotAllowed):
+			if v.AllowUnknown {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeError(w, http.StatusMethodNotAllowed, err.Error(), nil)
+		case errors.As(err, &verr):
+			writeError(w, http.StatusBadRequest, "invalid request", verr.Errors)
+		default:
+			writeError(w, http.StatusBadRequest, err.Error(), nil)
+		}
+	})
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, msg string, errs []FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error  string       `json:"error"`
+		Errors []FieldError `json:"errors,omitempty"`
+	}{msg, errs})
+}
@@ -0,0 +1,186 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpec = `
+openapi: 3.0.3
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 1, maximum: 100}
+        - name: tags
+          in: query
+          schema: {type: array, items: {type: string, enum: [admin, staff]}}
+    post:
+      operationId: createUser
+      requestBody:
+        $ref: '#/components/requestBodies/User'
+  /users/me:
+    get:
+      operationId: getMe
+      parameters:
+        - name: X-Api-Key
+          in: header
+          required: true
+          schema: {type: string, minLength: 8}
+  /users/{id}:
+    parameters:
+      - $ref: '#/components/parameters/UserID'
+    get:
+      operationId: getUser
+components:
+  parameters:
+    UserID:
+      name: id
+      in: path
+      required: true
+      schema: {type: integer}
+  requestBodies:
+    User:
+      required: true
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/User'
+  schemas:
+    User:
+      type: object
+      required: [name, email]
+      additionalProperties: false
+      properties:
+        name: {type: string, maxLength: 10}
+        email: {type: string, pattern: '^[^@]+@[^@]+$'}
+        manager:
+          $ref: '#/components/schemas/User'
+        roles:
+          type: array
+          maxItems: 2
+          items: {type: string}
+`
+
+func TestLoad(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1", BasePath(doc))
+	user := doc.Paths["/users"].Post.RequestBody.Content["application/json"].Schema
+	assert.Same(t, doc.Components.Schemas["User"], user)
+	assert.Same(t, user, user.Properties["manager"], "recursive references should be resolved")
+	assert.Equal(t, "id", doc.Paths["/users/{id}"].Parameters[0].Name)
+
+	_, err = Load([]byte("openapi: 3.0.0\npaths:\n  /a:\n    get:\n      parameters:\n        - $ref: '#/components/parameters/Missing'\n"))
+	assert.ErrorIs(t, err, ErrUnresolvedRef)
+	_, err = Load([]byte(`{"swagger": "2.0"}`))
+	assert.Error(t, err)
+}
+
+func TestValidator_Middleware(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	assert.NoError(t, err)
+	v := NewValidator(doc)
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		header     map[string]string
+		body       string
+		wantCode   int
+		wantErrors []FieldError
+	}{
+		{"Test valid query", "GET", "/v1/users?limit=10&tags=admin&tags=staff", nil, "", http.StatusNoContent, nil},
+		{"Test query out of bounds", "GET", "/v1/users?limit=0", nil, "", http.StatusBadRequest, []FieldError{
+			{In: "query", Name: "limit", Message: "must be greater than or equal to 1"},
+		}},
+		{"Test query not an integer", "GET", "/v1/users?limit=ten", nil, "", http.StatusBadRequest, []FieldError{
+			{In: "query", Name: "limit", Message: "must be an integer"},
+		}},
+		{"Test query array item", "GET", "/v1/users?tags=admin,guest", nil, "", http.StatusBadRequest, []FieldError{
+			{In: "query", Name: "tags[1]", Message: "must be one of [admin staff]"},
+		}},
+		{"Test literal path precedence", "GET", "/v1/users/me", map[string]string{"X-Api-Key": "secret"}, "", http.StatusBadRequest, []FieldError{
+			{In: "header", Name: "X-Api-Key", Message: "must be at least 8 characters long"},
+		}},
+		{"Test path parameter", "GET", "/v1/users/42", nil, "", http.StatusNoContent, nil},
+		{"Test invalid path parameter", "GET", "/v1/users/abc", nil, "", http.StatusBadRequest, []FieldError{
+			{In: "path", Name: "id", Message: "must be an integer"},
+		}},
+		{"Test valid body", "POST", "/v1/users", map[string]string{"Content-Type": "application/json"},
+			`{"name": "Ann", "email": "ann@example.com", "manager": {"name": "Bob", "email": "bob@example.com"}}`, http.StatusNoContent, nil},
+		{"Test invalid body", "POST", "/v1/users", map[string]string{"Content-Type": "application/json"},
+			`{"name": "Annabelle Smith", "manager": {"name": "Bob", "email": "bob"}, "roles": ["a", "b", 3], "age": 30}`, http.StatusBadRequest, []FieldError{
+				{In: "body", Name: "$.age", Message: "is not allowed"},
+				{In: "body", Name: "$.email", Message: "is required"},
+				{In: "body", Name: "$.manager.email", Message: "must match the pattern ^[^@]+@[^@]+$"},
+				{In: "body", Name: "$.name", Message: "must be at most 10 characters long"},
+				{In: "body", Name: "$.roles", Message: "must have at most 2 items"},
+				{In: "body", Name: "$.roles[2]", Message: "must be of type string"},
+			}},
+		{"Test missing body", "POST", "/v1/users", nil, "", http.StatusBadRequest, []FieldError{
+			{In: "body", Name: "$", Message: "is required"},
+		}},
+		{"Test unsupported media type", "POST", "/v1/users", map[string]string{"Content-Type": "text/plain"}, "Ann", http.StatusBadRequest, []FieldError{
+			{In: "body", Name: "$", Message: `media type "text/plain" is not supported`},
+		}},
+		{"Test unknown path", "GET", "/v1/posts", nil, "", http.StatusNotFound, nil},
+		{"Test path outside base path", "GET", "/users", nil, "", http.StatusNotFound, nil},
+		{"Test method not allowed", "DELETE", "/v1/users", nil, "", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantErrors != nil {
+				var body struct {
+					Error  string       `json:"error"`
+					Errors []FieldError `json:"errors"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, "invalid request", body.Error)
+				assert.ElementsMatch(t, tt.wantErrors, body.Errors)
+			}
+		})
+	}
+
+	v.AllowUnknown = true
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/posts", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestValidator_BodyIsForwarded(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	assert.NoError(t, err)
+	var forwarded string
+	h := NewValidator(doc).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		forwarded = string(b)
+	}))
+	body := `{"name": "Ann", "email": "ann@example.com"}`
+	r := httptest.NewRequest("POST", "/v1/users", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, body, forwarded)
+}
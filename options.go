@@ -0,0 +1,85 @@
+package reverseproxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/health"
+)
+
+// Option configures a mux at construction, see New.
+type Option func(pm *ReverseProxyMux) error
+
+// WithTransport sets the Transport of the mux.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(pm *ReverseProxyMux) error {
+		pm.Transport = transport
+		return nil
+	}
+}
+
+// WithErrorHandler sets the ErrorHandler of the mux.
+func WithErrorHandler(h HttpErrorHandler) Option {
+	return func(pm *ReverseProxyMux) error {
+		pm.ErrorHandler = h
+		return nil
+	}
+}
+
+// WithHealthCheck checks the availability of the backends with the check func, see SetHealthCheckFunc
+// and SetHealthCheckOptions.
+func WithHealthCheck(check func(addr *url.URL) bool, period time.Duration, opts ...health.Option) Option {
+	return func(pm *ReverseProxyMux) error {
+		if len(opts) > 0 {
+			pm.SetHealthCheckOptions(opts...)
+		}
+		pm.SetHealthCheckFunc(check, period)
+		return nil
+	}
+}
+
+// WithLogger sets the ErrorLog of the mux.
+func WithLogger(l *log.Logger) Option {
+	return func(pm *ReverseProxyMux) error {
+		pm.ErrorLog = l
+		return nil
+	}
+}
+
+// WithRouterOptions sets the router options of the mux, see SetRouterOptions.
+func WithRouterOptions(opts RouterOptions) Option {
+	return func(pm *ReverseProxyMux) error {
+		return pm.SetRouterOptions(opts)
+	}
+}
+
+// WithRoutes registers the routes, failing if they conflict, see AddRoute.
+func WithRoutes(routes ...Route) Option {
+	return func(pm *ReverseProxyMux) error {
+		for _, route := range routes {
+			if err := pm.AddRoute(route); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithMiddleware registers middleware wrapping the handlers of all routes, see Use.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(pm *ReverseProxyMux) error {
+		pm.Use(middleware...)
+		return nil
+	}
+}
+
+// WithFreeze freezes the mux once all options are applied, see Freeze, so the mux is fully configured
+// at construction and immutable afterwards.
+func WithFreeze() Option {
+	return func(pm *ReverseProxyMux) error {
+		pm.freezeOnNew = true
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_Options(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("X-Chain"))
+	}))
+	t.Cleanup(origin.Close)
+
+	var roundTrips atomic.Int32
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		roundTrips.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+	pm, err := New(origin.URL,
+		WithTransport(transport),
+		WithLogger(logger),
+		WithRouterOptions(RouterOptions{CaseInsensitive: true}),
+		WithHealthCheck(func(*url.URL) bool { return true }, time.Hour),
+		WithMiddleware(tag("a")),
+		WithRoutes(NewRoute("GET", "/users"), NewRoute("GET", "/posts")),
+		WithFreeze(),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/USERS a", serve(pm, "GET", "/USERS").Body.String())
+	assert.Equal(t, int32(1), roundTrips.Load())
+	assert.Same(t, logger, pm.ErrorLog)
+	assert.True(t, pm.RouterOptions().CaseInsensitive)
+	assert.Len(t, pm.Routes(), 2)
+	assert.NotNil(t, pm.healthCheck)
+	assert.Equal(t, time.Hour, pm.healthPeriod)
+	assert.True(t, pm.IsFrozen())
+	assert.ErrorIs(t, pm.AddRoute(NewRoute("GET", "/other")), ErrFrozen)
+}
+
+func TestNew_OptionErrors(t *testing.T) {
+	_, err := New("http://127.0.0.1:1", WithRoutes(NewRoute("GET", "/users"), NewRoute("GET", "/users")))
+	assert.Error(t, err)
+
+	var handled bool
+	pm, err := New("http://127.0.0.1:1", WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = true
+		w.WriteHeader(http.StatusBadGateway)
+	}), WithRoutes(NewRoute("GET", "/users")))
+	assert.NoError(t, err)
+	assert.False(t, pm.IsFrozen())
+	assert.Equal(t, http.StatusBadGateway, serve(pm, "GET", "/users").Code)
+	assert.True(t, handled)
+}
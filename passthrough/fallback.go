@@ -0,0 +1,71 @@
+package passthrough
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// fallbackListener is the listener of the connections without a route.
+type fallbackListener struct {
+	conns chan net.Conn
+	used  atomic.Bool
+
+	mu     sync.Mutex
+	addr   net.Addr
+	done   chan struct{}
+	closed bool
+}
+
+// deliver passes the connection to Accept, reporting whether it was accepted before the listener closed.
+func (l *fallbackListener) deliver(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// Accept returns the next connection without a route.
+func (l *fallbackListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, ErrRouterClosed
+	}
+}
+
+// Close closes the listener. The connections without a route are closed afterwards.
+func (l *fallbackListener) Close() error {
+	l.close()
+	return nil
+}
+
+// close closes the done channel once.
+func (l *fallbackListener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+}
+
+// Addr returns the address of the listener served by the router.
+func (l *fallbackListener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.addr == nil {
+		return &net.TCPAddr{}
+	}
+	return l.addr
+}
+
+// setAddr sets the address of the listener served by the router.
+func (l *fallbackListener) setAddr(addr net.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.addr = addr
+}
@@ -0,0 +1,227 @@
+// Package passthrough proxies raw TLS connections to upstreams by the server name (SNI) of their TLS
+// ClientHello, without terminating TLS, for services which must do their own TLS, e.g. with client
+// certificate authentication. The connections without a route can be passed to the HTTP mux:
+//
+//	rt := &passthrough.Router{Routes: map[string]string{"db.example.com": "10.0.0.5:443"}}
+//	go http.ServeTLS(rt.Fallback(), pm, "cert.pem", "key.pem")
+//	log.Fatal(rt.Serve(l))
+package passthrough
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// DefaultHandshakeTimeout is the default time to receive the ClientHello of a connection.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// ErrRouterClosed is returned by the Fallback listener once the router stopped serving.
+var ErrRouterClosed = errors.New("passthrough: router closed")
+
+// ContextDialer is the interface of connection dialers with context support, e.g. *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Router routes TLS connections by their server name to upstream addresses.
+type Router struct {
+	// Routes maps the server names, e.g. db.example.com or *.internal.example.com matching one label,
+	// to the host:port addresses of the upstreams.
+	Routes map[string]string
+	// Default is the upstream of the connections without a matching route. If empty, they're passed
+	// to the Fallback listener, or closed if it isn't used.
+	Default string
+	// Dialer connects to the upstreams, a default net.Dialer if nil. The client IP is stored in the
+	// dial context, so a proxyproto.Dialer passes it to the upstreams.
+	Dialer ContextDialer
+	// HandshakeTimeout limits the time to receive the ClientHello, DefaultHandshakeTimeout if zero.
+	HandshakeTimeout time.Duration
+	// ErrorLog logs the failed connections, the standard logger if nil.
+	ErrorLog *log.Logger
+
+	once     sync.Once
+	fallback *fallbackListener
+}
+
+// Serve accepts the connections of the listener and proxies them until the listener fails, e.g. it's
+// closed, returning its error. The Fallback listener is closed then.
+func (rt *Router) Serve(l net.Listener) error {
+	rt.init(l.Addr())
+	defer rt.fallback.close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go rt.serve(conn)
+	}
+}
+
+// Fallback returns the listener of the connections without a route, e.g. to be served by the HTTP mux
+// with TLS termination. Its connections replay the ClientHello read by the router.
+func (rt *Router) Fallback() net.Listener {
+	rt.init(nil)
+	rt.fallback.used.Store(true)
+	return rt.fallback
+}
+
+// init creates the fallback listener.
+func (rt *Router) init(addr net.Addr) {
+	rt.once.Do(func() {
+		rt.fallback = &fallbackListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	})
+	if addr != nil {
+		rt.fallback.setAddr(addr)
+	}
+}
+
+// serve proxies the connection to the upstream of its server name.
+func (rt *Router) serve(conn net.Conn) {
+	timeout := rt.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	serverName, hello, err := readClientHello(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		rt.logf("%s: read ClientHello: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	conn = &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(hello), conn)}
+	upstream, ok := rt.route(serverName)
+	if !ok {
+		if !rt.fallback.used.Load() || !rt.fallback.deliver(conn) {
+			_ = conn.Close()
+		}
+		return
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		ctx = proxyctx.WithClientIP(ctx, tcp.AddrPort().Addr().Unmap())
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	dialer := rt.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{KeepAlive: 30 * time.Second}
+	}
+	up, err := dialer.DialContext(ctx, "tcp", upstream)
+	cancel()
+	if err != nil {
+		rt.logf("%s: %s: dial %s: %v", conn.RemoteAddr(), serverName, upstream, err)
+		return
+	}
+	defer up.Close()
+	pipe(conn, up)
+}
+
+// route returns the upstream of the server name: the route of the name, of its wildcard, or the default.
+func (rt *Router) route(serverName string) (string, bool) {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name != "" {
+		if upstream, ok := rt.Routes[name]; ok {
+			return upstream, true
+		}
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if upstream, ok := rt.Routes["*."+parent]; ok {
+				return upstream, true
+			}
+		}
+	}
+	return rt.Default, rt.Default != ""
+}
+
+// logf logs an error message with the ErrorLog or the standard logger.
+func (rt *Router) logf(format string, args ...any) {
+	if rt.ErrorLog != nil {
+		rt.ErrorLog.Printf("passthrough: "+format, args...)
+		return
+	}
+	log.Printf("passthrough: "+format, args...)
+}
+
+// pipe copies the data between the connections until both directions are done, half-closing the
+// writing side of each connection once its peer finished sending.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(b, a)
+		closeWrite(b)
+		close(done)
+	}()
+	_, _ = io.Copy(a, b)
+	closeWrite(a)
+	<-done
+}
+
+// closeWrite shuts down the writing side of the connection, or closes it.
+func closeWrite(c net.Conn) {
+	if rc, ok := c.(*replayConn); ok {
+		c = rc.Conn
+	}
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
+
+// errHelloRead aborts the handshake once the ClientHello is read.
+var errHelloRead = errors.New("ClientHello read")
+
+// readClientHello reads the ClientHello of the connection, returning its server name and the data read.
+func readClientHello(conn net.Conn) (string, []byte, error) {
+	var buf bytes.Buffer
+	var serverName string
+	var read bool
+	err := tls.Server(readOnlyConn{r: io.TeeReader(conn, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName, read = hello.ServerName, true
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !read {
+		return "", nil, err
+	}
+	return serverName, buf.Bytes(), nil
+}
+
+// readOnlyConn is a connection reading from the reader and discarding the writes, used to parse the
+// ClientHello with crypto/tls without answering it.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(b []byte) (int, error)       { return c.r.Read(b) }
+func (c readOnlyConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (c readOnlyConn) Close() error                     { return nil }
+func (c readOnlyConn) SetDeadline(time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(time.Time) error { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr              { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr             { return nil }
+
+// replayConn is a connection replaying the data read before it was routed.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read reads the replayed data, then from the connection.
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,102 @@
+package passthrough
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_Serve(t *testing.T) {
+	upstream := func(body string) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, body)
+		}))
+	}
+	db, api := upstream("db"), upstream("api")
+	defer db.Close()
+	defer api.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rt := &Router{
+		Routes: map[string]string{
+			"db.example.com":         db.Listener.Addr().String(),
+			"*.internal.example.com": api.Listener.Addr().String(),
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	mux := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "mux")
+	}))
+	mux.Listener = rt.Fallback()
+	mux.StartTLS()
+	defer mux.Close()
+	go func() { _ = rt.Serve(l) }()
+	defer l.Close()
+
+	tests := []struct {
+		name       string
+		serverName string
+		want       string
+	}{
+		{"Test exact name", "db.example.com", "db"},
+		{"Test name case", "DB.Example.com", "db"},
+		{"Test wildcard name", "a.internal.example.com", "api"},
+		{"Test nested wildcard name", "a.b.internal.example.com", "mux"},
+		{"Test fallback", "www.example.com", "mux"},
+		{"Test missing name", "", "mux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, l.Addr().String())
+				},
+				TLSClientConfig: &tls.Config{ServerName: tt.serverName, InsecureSkipVerify: true},
+			}}
+			resp, err := client.Get("https://upstream/")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestRouter_Default(t *testing.T) {
+	logged := make(chan string, 1)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	rt := &Router{Default: "127.0.0.1:1", ErrorLog: log.New(logWriter(logged), "", 0)}
+	upstream, ok := rt.route("unknown.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "127.0.0.1:1", upstream)
+
+	// connections which aren't TLS are closed without reaching the default upstream
+	go func() { _ = rt.Serve(l) }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err)
+	_ = conn.Close()
+	assert.Contains(t, <-logged, "read ClientHello")
+}
+
+// logWriter sends the logged messages to the channel.
+type logWriter chan string
+
+func (w logWriter) Write(b []byte) (int, error) {
+	w <- string(b)
+	return len(b), nil
+}
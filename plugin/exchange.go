@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/open-webtech/go-reverse-proxy/internal/message"
+)
+
+// Exchange is the request and response a filter acts on. Its methods implement the host functions.
+type Exchange struct {
+	Request *http.Request
+	// Response is nil in the request phase.
+	Response *http.Response
+
+	maxBodySize   int64
+	responded     bool
+	respondStatus int
+	respondBody   []byte
+}
+
+// header returns the header of the current message.
+func (x *Exchange) header() http.Header {
+	return message.Header(x.Request, x.Response)
+}
+
+// Method returns the request method.
+func (x *Exchange) Method() string {
+	return x.Request.Method
+}
+
+// Path returns the request path.
+func (x *Exchange) Path() string {
+	return x.Request.URL.Path
+}
+
+// SetPath sets the request path.
+func (x *Exchange) SetPath(path string) {
+	x.Request.URL.Path = path
+	x.Request.URL.RawPath = ""
+}
+
+// Query returns the first value of the named query parameter of the request.
+func (x *Exchange) Query(name string) string {
+	return x.Request.URL.Query().Get(name)
+}
+
+// SetQuery sets the named query parameter of the request.
+func (x *Exchange) SetQuery(name, value string) {
+	q := x.Request.URL.Query()
+	q.Set(name, value)
+	x.Request.URL.RawQuery = q.Encode()
+}
+
+// Header returns the first value of the named header of the current message.
+func (x *Exchange) Header(name string) string {
+	return x.header().Get(name)
+}
+
+// SetHeader sets the named header of the current message.
+func (x *Exchange) SetHeader(name, value string) {
+	x.header().Set(name, value)
+}
+
+// AddHeader adds a value to the named header of the current message.
+func (x *Exchange) AddHeader(name, value string) {
+	x.header().Add(name, value)
+}
+
+// DelHeader deletes the named header of the current message.
+func (x *Exchange) DelHeader(name string) {
+	x.header().Del(name)
+}
+
+// Status returns the response status code, or zero in the request phase.
+func (x *Exchange) Status() int {
+	return message.Status(x.Response)
+}
+
+// SetStatus sets the response status code.
+func (x *Exchange) SetStatus(status int) error {
+	return message.SetStatus(x.Response, status)
+}
+
+// Body reads the body of the current message, which is still passed on afterwards. A body over the
+// MaxBodySize of the plugin fails with an *http.MaxBytesError.
+func (x *Exchange) Body() ([]byte, error) {
+	return message.ReadBody(x.Request, x.Response, x.maxBodySize)
+}
+
+// SetBody replaces the body of the current message.
+func (x *Exchange) SetBody(body []byte) {
+	message.SetBody(x.Request, x.Response, body)
+}
+
+// Respond answers the request with the status and body instead of proxying it. In the response
+// phase, the upstream response is replaced.
+func (x *Exchange) Respond(status int, body []byte) {
+	x.responded = true
+	x.respondStatus = status
+	x.respondBody = body
+}
+
+// Log writes a message of the filter to the standard logger.
+func (x *Exchange) Log(msg string) {
+	log.Printf("plugin: %s %s: %s", x.Request.Method, x.Request.URL.Path, msg)
+}
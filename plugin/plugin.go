@@ -0,0 +1,276 @@
+// Package plugin loads WebAssembly filter modules, so third-party request and response filters can be
+// dropped in at runtime, similar to the WASM filters of Envoy.
+//
+// A filter module exports the functions
+//
+//	on_request() i32   // called before the request is proxied
+//	on_response() i32  // called after the upstream response is received
+//	alloc(size i32) i32 // allocates guest memory for values returned by the host
+//
+// Both phases are optional. A non-zero return value fails the filter. The modules act on the exchange
+// through the host functions imported from the "proxy" module, listed in HostFunctions, which map to
+// the methods of Exchange. Strings and byte slices are passed as (pointer, length) pairs of guest
+// memory; values returned by the host are written to memory obtained from alloc and returned as a
+// packed (pointer << 32 | length) i64.
+//
+// A Runtime compiles the modules and binds the host functions to the Exchange passed to Module.Call.
+// NewWazeroRuntime creates a runtime backed by wazero:
+//
+//	runtime, err := plugin.NewWazeroRuntime(ctx)
+//	p, err := plugin.LoadFile(ctx, runtime, "filters/auth.wasm")
+//	pm.UseGroup("api", p.Middleware)
+//	route.SetModifyResponse(p.ModifyResponse)
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/open-webtech/go-reverse-proxy/internal/message"
+)
+
+const (
+	// HostModule is the name of the module the host functions are imported from.
+	HostModule = "proxy"
+	// ExportOnRequest is the function exported by modules filtering requests.
+	ExportOnRequest = "on_request"
+	// ExportOnResponse is the function exported by modules filtering responses.
+	ExportOnResponse = "on_response"
+	// ExportAlloc is the function exported by modules for allocating memory for the host.
+	ExportAlloc = "alloc"
+)
+
+// HostFunctions are the names of the functions provided in the HostModule, which map to the
+// Exchange methods of the same name.
+var HostFunctions = []string{
+	"method", "path", "set_path", "query", "set_query",
+	"header", "set_header", "add_header", "del_header",
+	"status", "set_status", "body", "set_body", "respond", "log",
+}
+
+var (
+	// ErrNotWasm is returned when loading a file which isn't a WebAssembly module.
+	ErrNotWasm = errors.New("not a WebAssembly module")
+	// ErrResponseOnly is returned when a response method is called in the request phase.
+	ErrResponseOnly = message.ErrResponseOnly
+	// ErrClosed is returned when calling or replacing the module of a closed plugin.
+	ErrClosed = errors.New("plugin closed")
+)
+
+// wasmMagic is the preamble of WebAssembly binary modules.
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// Runtime compiles WebAssembly modules.
+type Runtime interface {
+	Compile(ctx context.Context, name string, wasm []byte) (Module, error)
+}
+
+// Module is a compiled filter module.
+type Module interface {
+	// Exports reports whether the module exports the named function.
+	Exports(fn string) bool
+	// Call calls the named exported function with the host functions bound to the exchange. It must
+	// be safe for concurrent use, e.g. by instantiating the module per call or pooling instances.
+	Call(ctx context.Context, fn string, x *Exchange) error
+	// Close releases the resources of the module.
+	Close(ctx context.Context) error
+}
+
+// DefaultMaxBodySize is the default limit of the bodies read by the filters.
+const DefaultMaxBodySize = message.DefaultMaxBodySize
+
+// Plugin is a loaded filter module attachable to routes. It can be reloaded while serving.
+type Plugin struct {
+	// MaxBodySize limits the bodies read by the filters, DefaultMaxBodySize if zero.
+	MaxBodySize int64
+
+	name    string
+	runtime Runtime
+	file    string
+
+	mu     sync.RWMutex
+	module *loaded
+	closed bool
+}
+
+// loaded is a module with the count of its references: the plugin while it's the current module,
+// and the calls in flight. The module is closed when the last reference is released.
+type loaded struct {
+	Module
+	refs atomic.Int32
+}
+
+// newLoaded returns the module referenced by the plugin.
+func newLoaded(module Module) *loaded {
+	m := &loaded{Module: module}
+	m.refs.Store(1)
+	return m
+}
+
+// release releases a reference to the module, closing it if it was the last one.
+func (m *loaded) release(ctx context.Context) error {
+	if m.refs.Add(-1) == 0 {
+		return m.Close(ctx)
+	}
+	return nil
+}
+
+// Load compiles the WebAssembly module with the runtime.
+func Load(ctx context.Context, runtime Runtime, name string, wasm []byte) (*Plugin, error) {
+	module, err := compile(ctx, runtime, name, wasm)
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{name: name, runtime: runtime, module: newLoaded(module)}, nil
+}
+
+// LoadFile reads and compiles a WebAssembly module file with the runtime.
+func LoadFile(ctx context.Context, runtime Runtime, file string) (*Plugin, error) {
+	wasm, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Load(ctx, runtime, filepath.Base(file), wasm)
+	if err != nil {
+		return nil, err
+	}
+	p.file = file
+	return p, nil
+}
+
+// compile checks the module preamble and compiles the module.
+func compile(ctx context.Context, runtime Runtime, name string, wasm []byte) (Module, error) {
+	if !bytes.HasPrefix(wasm, wasmMagic) {
+		return nil, fmt.Errorf("plugin %s: %w", name, ErrNotWasm)
+	}
+	module, err := runtime.Compile(ctx, name, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+	return module, nil
+}
+
+// Name returns the name of the plugin.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Reload recompiles the file the plugin was loaded from and swaps the module. In-flight requests
+// finish with the previous module. On error, the previous module stays in use.
+func (p *Plugin) Reload(ctx context.Context) error {
+	if p.file == "" {
+		return fmt.Errorf("plugin %s: not loaded from a file", p.name)
+	}
+	wasm, err := os.ReadFile(p.file)
+	if err != nil {
+		return err
+	}
+	return p.Replace(ctx, wasm)
+}
+
+// Replace compiles the WebAssembly module and swaps it for the current one. The previous module is
+// closed once the calls in flight on it finish.
+func (p *Plugin) Replace(ctx context.Context, wasm []byte) error {
+	module, err := compile(ctx, p.runtime, p.name, wasm)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		_ = module.Close(ctx)
+		return fmt.Errorf("plugin %s: %w", p.name, ErrClosed)
+	}
+	old := p.module
+	p.module = newLoaded(module)
+	p.mu.Unlock()
+	return old.release(ctx)
+}
+
+// Close releases the module of the plugin, which is closed once the calls in flight finish. The
+// filters of a closed plugin fail with ErrClosed.
+func (p *Plugin) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	module := p.module
+	p.mu.Unlock()
+	return module.release(ctx)
+}
+
+// acquire returns the current module with a reference held for a call, or nil if the plugin is
+// closed.
+func (p *Plugin) acquire() *loaded {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil
+	}
+	p.module.refs.Add(1)
+	return p.module
+}
+
+// call runs the named phase of the module, if exported.
+func (p *Plugin) call(ctx context.Context, fn string, x *Exchange) error {
+	module := p.acquire()
+	if module == nil {
+		return fmt.Errorf("plugin %s: %w", p.name, ErrClosed)
+	}
+	defer func() { _ = module.release(ctx) }()
+	if !module.Exports(fn) {
+		return nil
+	}
+	if err := module.Call(ctx, fn, x); err != nil {
+		return fmt.Errorf("plugin %s: %s: %w", p.name, fn, err)
+	}
+	return nil
+}
+
+// Middleware returns a handler running the request filter of the module before passing the requests
+// to next. It can be registered per route group with ReverseProxyMux.UseGroup. A request answered by
+// the filter with Respond isn't proxied, and a request whose body is over the MaxBodySize is answered
+// with HTTP 413.
+func (p *Plugin) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		x := &Exchange{Request: r, maxBodySize: p.MaxBodySize}
+		if err := p.call(r.Context(), ExportOnRequest, x); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if x.responded {
+			w.WriteHeader(x.respondStatus)
+			_, _ = w.Write(x.respondBody)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ModifyResponse runs the response filter of the module. It has the signature of a ResponseModifier,
+// so it can be passed to Route.SetModifyResponse.
+func (p *Plugin) ModifyResponse(res *http.Response) error {
+	x := &Exchange{Request: res.Request, Response: res, maxBodySize: p.MaxBodySize}
+	if err := p.call(res.Request.Context(), ExportOnResponse, x); err != nil {
+		return err
+	}
+	if x.responded {
+		_ = message.SetStatus(res, x.respondStatus)
+		message.SetBody(res.Request, res, x.respondBody)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRuntime compiles modules whose payload after the preamble names a Go filter.
+type fakeRuntime map[string]map[string]func(x *Exchange) error
+
+func (rt fakeRuntime) Compile(ctx context.Context, name string, wasm []byte) (Module, error) {
+	filters, ok := rt[string(wasm[len(wasmMagic):])]
+	if !ok {
+		return nil, errors.New("unknown module")
+	}
+	return &fakeModule{filters: filters}, nil
+}
+
+type fakeModule struct {
+	filters map[string]func(x *Exchange) error
+	closed  atomic.Bool
+}
+
+func (m *fakeModule) Exports(fn string) bool {
+	_, ok := m.filters[fn]
+	return ok
+}
+
+func (m *fakeModule) Call(ctx context.Context, fn string, x *Exchange) error {
+	return m.filters[fn](x)
+}
+
+func (m *fakeModule) Close(ctx context.Context) error {
+	m.closed.Store(true)
+	return nil
+}
+
+func module(payload string) []byte {
+	return append(append([]byte{}, wasmMagic...), payload...)
+}
+
+var runtime = fakeRuntime{
+	"guard": {
+		ExportOnRequest: func(x *Exchange) error {
+			if x.Method() == "DELETE" {
+				x.Respond(http.StatusForbidden, []byte("read-only"))
+				return nil
+			}
+			x.DelHeader("Cookie")
+			x.SetPath("/v2" + x.Path())
+			return nil
+		},
+		ExportOnResponse: func(x *Exchange) error {
+			if x.Status() >= 500 {
+				return x.SetStatus(http.StatusBadGateway)
+			}
+			x.SetHeader("X-Filtered", "1")
+			return nil
+		},
+	},
+	"v2": {
+		ExportOnResponse: func(x *Exchange) error {
+			x.SetHeader("X-Version", "2")
+			return nil
+		},
+	},
+	"body": {
+		ExportOnRequest: func(x *Exchange) error {
+			_, err := x.Body()
+			return err
+		},
+		ExportOnResponse: func(x *Exchange) error {
+			_, err := x.Body()
+			return err
+		},
+	},
+	"failing": {
+		ExportOnRequest: func(x *Exchange) error {
+			return errors.New("trap")
+		},
+	},
+}
+
+func TestLoad(t *testing.T) {
+	_, err := Load(context.Background(), runtime, "text", []byte("not wasm"))
+	assert.ErrorIs(t, err, ErrNotWasm)
+
+	_, err = Load(context.Background(), runtime, "unknown", module("unknown"))
+	assert.Error(t, err)
+
+	p, err := Load(context.Background(), runtime, "guard", module("guard"))
+	assert.NoError(t, err)
+	assert.Equal(t, "guard", p.Name())
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		module     string
+		method     string
+		wantStatus int
+		wantPath   string
+	}{
+		{"Test passing request", "guard", "GET", http.StatusOK, "/v2/users"},
+		{"Test rejected request", "guard", "DELETE", http.StatusForbidden, ""},
+		{"Test module without request filter", "v2", "GET", http.StatusOK, "/users"},
+		{"Test failing filter", "failing", "GET", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Load(context.Background(), runtime, tt.module, module(tt.module))
+			assert.NoError(t, err)
+
+			var got *http.Request
+			h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			r := httptest.NewRequest(tt.method, "/users", nil)
+			r.Header.Set("Cookie", "session=1")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantPath == "" {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, tt.wantPath, got.URL.Path)
+		})
+	}
+}
+
+func TestModifyResponse(t *testing.T) {
+	p, err := Load(context.Background(), runtime, "guard", module("guard"))
+	assert.NoError(t, err)
+
+	res := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("stack trace")),
+		Request:    httptest.NewRequest("GET", "/", nil),
+	}
+	assert.NoError(t, p.ModifyResponse(res))
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	p, err := Load(context.Background(), runtime, "body", module("body"))
+	assert.NoError(t, err)
+	p.MaxBodySize = 4
+
+	called := false
+	h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("oversized")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.False(t, called)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("body")))
+	assert.True(t, called)
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("oversized")),
+		Request:    httptest.NewRequest("GET", "/", nil),
+	}
+	var tooLarge *http.MaxBytesError
+	assert.ErrorAs(t, p.ModifyResponse(res), &tooLarge)
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "filter.wasm")
+	assert.NoError(t, os.WriteFile(file, module("guard"), 0o644))
+	p, err := LoadFile(context.Background(), runtime, file)
+	assert.NoError(t, err)
+	old := p.module.Module.(*fakeModule)
+
+	assert.NoError(t, os.WriteFile(file, module("unknown"), 0o644))
+	assert.Error(t, p.Reload(context.Background()))
+	assert.False(t, old.closed.Load())
+
+	assert.NoError(t, os.WriteFile(file, module("v2"), 0o644))
+	assert.NoError(t, p.Reload(context.Background()))
+	assert.True(t, old.closed.Load())
+
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	assert.NoError(t, p.ModifyResponse(res))
+	assert.Equal(t, "2", res.Header.Get("X-Version"))
+}
+
+func TestReplace_InFlight(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	rt := fakeRuntime{
+		"slow": {
+			ExportOnRequest: func(x *Exchange) error {
+				close(entered)
+				<-release
+				return nil
+			},
+		},
+		"v2": runtime["v2"],
+	}
+	p, err := Load(context.Background(), rt, "slow", module("slow"))
+	assert.NoError(t, err)
+	old := p.module.Module.(*fakeModule)
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	// the previous module is closed once the call in flight finishes
+	assert.NoError(t, p.Replace(context.Background(), module("v2")))
+	assert.False(t, old.closed.Load())
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.True(t, old.closed.Load())
+
+	current := p.module.Module.(*fakeModule)
+	assert.NoError(t, p.Close(context.Background()))
+	assert.True(t, current.closed.Load())
+	assert.ErrorIs(t, p.ModifyResponse(&http.Response{Request: httptest.NewRequest("GET", "/", nil)}), ErrClosed)
+	assert.ErrorIs(t, p.Replace(context.Background(), module("v2")), ErrClosed)
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WazeroRuntime is a Runtime backed by wazero, a WebAssembly runtime without cgo. The modules may
+// import WASI, e.g. when built with TinyGo or for wasm32-wasi; reactor modules are initialized by
+// their _initialize export. Each call runs in a fresh instance of the module, so the calls don't share
+// guest memory, and is terminated when the context of the request is done.
+//
+// The host functions have the signatures
+//
+//	method() i64                        path() i64
+//	set_path(ptr, len i32)              query(name_ptr, name_len i32) i64
+//	set_query(name_ptr, name_len, value_ptr, value_len i32)
+//	header(name_ptr, name_len i32) i64  del_header(name_ptr, name_len i32)
+//	set_header(name_ptr, name_len, value_ptr, value_len i32)
+//	add_header(name_ptr, name_len, value_ptr, value_len i32)
+//	status() i32                        set_status(status i32) i32 // non-zero in the request phase
+//	body() i64                          set_body(ptr, len i32)
+//	respond(status, ptr, len i32)       log(ptr, len i32)
+//
+// where the i64 results are packed (pointer << 32 | length) values, zero for empty values.
+type WazeroRuntime struct {
+	runtime wazero.Runtime
+}
+
+// NewWazeroRuntime creates a wazero runtime providing the host functions and WASI.
+func NewWazeroRuntime(ctx context.Context) (*WazeroRuntime, error) {
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	host := r.NewHostModuleBuilder(HostModule)
+	for _, name := range HostFunctions {
+		host.NewFunctionBuilder().WithFunc(hostFunctions[name]).Export(name)
+	}
+	if _, err := host.Instantiate(ctx); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	return &WazeroRuntime{runtime: r}, nil
+}
+
+// Compile compiles the module.
+func (rt *WazeroRuntime) Compile(ctx context.Context, name string, wasm []byte) (Module, error) {
+	compiled, err := rt.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := compiled.ExportedFunctions()[ExportAlloc]; !ok {
+		_ = compiled.Close(ctx)
+		return nil, fmt.Errorf("missing export %s", ExportAlloc)
+	}
+	return &wazeroModule{
+		runtime:  rt.runtime,
+		compiled: compiled,
+		config:   wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"),
+	}, nil
+}
+
+// Close closes the runtime and the modules compiled with it.
+func (rt *WazeroRuntime) Close(ctx context.Context) error {
+	return rt.runtime.Close(ctx)
+}
+
+// wazeroModule is a module compiled by a WazeroRuntime.
+type wazeroModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	config   wazero.ModuleConfig
+}
+
+func (m *wazeroModule) Exports(fn string) bool {
+	_, ok := m.compiled.ExportedFunctions()[fn]
+	return ok
+}
+
+func (m *wazeroModule) Call(ctx context.Context, fn string, x *Exchange) error {
+	ctx = context.WithValue(ctx, exchangeKey{}, x)
+	mod, err := m.runtime.InstantiateModule(ctx, m.compiled, m.config)
+	if err != nil {
+		return err
+	}
+	defer mod.Close(ctx)
+	results, err := mod.ExportedFunction(fn).Call(ctx)
+	if err != nil {
+		return err
+	}
+	if len(results) > 0 && uint32(results[0]) != 0 {
+		return fmt.Errorf("returned %d", int32(results[0]))
+	}
+	return nil
+}
+
+func (m *wazeroModule) Close(ctx context.Context) error {
+	return m.compiled.Close(ctx)
+}
+
+type exchangeKey struct{}
+
+// exchange returns the exchange of the call.
+func exchange(ctx context.Context) *Exchange {
+	return ctx.Value(exchangeKey{}).(*Exchange)
+}
+
+// read returns a copy of the guest memory, trapping if it's out of range.
+func read(m api.Module, ptr, size uint32) []byte {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(errors.New("memory access out of range"))
+	}
+	return bytes.Clone(b)
+}
+
+// readString returns the string in the guest memory.
+func readString(m api.Module, ptr, size uint32) string {
+	return string(read(m, ptr, size))
+}
+
+// write copies the value to guest memory obtained from alloc and returns its packed pointer and length.
+func write(ctx context.Context, m api.Module, b []byte) uint64 {
+	if len(b) == 0 {
+		return 0
+	}
+	results, err := m.ExportedFunction(ExportAlloc).Call(ctx, uint64(len(b)))
+	if err != nil {
+		panic(err)
+	}
+	ptr := uint32(results[0])
+	if !m.Memory().Write(ptr, b) {
+		panic(errors.New("memory access out of range"))
+	}
+	return uint64(ptr)<<32 | uint64(len(b))
+}
+
+// hostFunctions implement the HostFunctions with the methods of the exchange of the call.
+var hostFunctions = map[string]any{
+	"method": func(ctx context.Context, m api.Module) uint64 {
+		return write(ctx, m, []byte(exchange(ctx).Method()))
+	},
+	"path": func(ctx context.Context, m api.Module) uint64 {
+		return write(ctx, m, []byte(exchange(ctx).Path()))
+	},
+	"set_path": func(ctx context.Context, m api.Module, ptr, size uint32) {
+		exchange(ctx).SetPath(readString(m, ptr, size))
+	},
+	"query": func(ctx context.Context, m api.Module, ptr, size uint32) uint64 {
+		return write(ctx, m, []byte(exchange(ctx).Query(readString(m, ptr, size))))
+	},
+	"set_query": func(ctx context.Context, m api.Module, namePtr, nameSize, valuePtr, valueSize uint32) {
+		exchange(ctx).SetQuery(readString(m, namePtr, nameSize), readString(m, valuePtr, valueSize))
+	},
+	"header": func(ctx context.Context, m api.Module, ptr, size uint32) uint64 {
+		return write(ctx, m, []byte(exchange(ctx).Header(readString(m, ptr, size))))
+	},
+	"set_header": func(ctx context.Context, m api.Module, namePtr, nameSize, valuePtr, valueSize uint32) {
+		exchange(ctx).SetHeader(readString(m, namePtr, nameSize), readString(m, valuePtr, valueSize))
+	},
+	"add_header": func(ctx context.Context, m api.Module, namePtr, nameSize, valuePtr, valueSize uint32) {
+		exchange(ctx).AddHeader(readString(m, namePtr, nameSize), readString(m, valuePtr, valueSize))
+	},
+	"del_header": func(ctx context.Context, m api.Module, ptr, size uint32) {
+		exchange(ctx).DelHeader(readString(m, ptr, size))
+	},
+	"status": func(ctx context.Context) uint32 {
+		return uint32(exchange(ctx).Status())
+	},
+	"set_status": func(ctx context.Context, status uint32) uint32 {
+		if exchange(ctx).SetStatus(int(status)) != nil {
+			return 1
+		}
+		return 0
+	},
+	"body": func(ctx context.Context, m api.Module) uint64 {
+		body, err := exchange(ctx).Body()
+		if err != nil {
+			panic(err)
+		}
+		return write(ctx, m, body)
+	},
+	"set_body": func(ctx context.Context, m api.Module, ptr, size uint32) {
+		exchange(ctx).SetBody(read(m, ptr, size))
+	},
+	"respond": func(ctx context.Context, m api.Module, status, ptr, size uint32) {
+		exchange(ctx).Respond(int(status), read(m, ptr, size))
+	},
+	"log": func(ctx context.Context, m api.Module, ptr, size uint32) {
+		exchange(ctx).Log(readString(m, ptr, size))
+	},
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoWasm is the module
+//
+//	(module
+//	  (import "proxy" "header" (func $header (param i32 i32) (result i64)))
+//	  (import "proxy" "set_header" (func $set_header (param i32 i32 i32 i32)))
+//	  (import "proxy" "respond" (func $respond (param i32 i32 i32)))
+//	  (memory (export "memory") 1)
+//	  (global $next (mut i32) (i32.const 1024))
+//	  (func (export "alloc") (param $size i32) (result i32)
+//	    (global.get $next)
+//	    (global.set $next (i32.add (global.get $next) (local.get $size))))
+//	  (func (export "on_request") (result i32) (local $v i64)
+//	    (local.set $v (call $header (i32.const 0) (i32.const 6)))
+//	    (if (i64.eqz (local.get $v))
+//	      (then (call $respond (i32.const 403) (i32.const 16) (i32.const 6)) (return (i32.const 0))))
+//	    (call $set_header (i32.const 8) (i32.const 6)
+//	      (i32.wrap_i64 (i64.shr_u (local.get $v) (i64.const 32))) (i32.wrap_i64 (local.get $v)))
+//	    (i32.const 0))
+//	  (func (export "on_response") (result i32) (i32.const 1))
+//	  (data (i32.const 0) "X-User")
+//	  (data (i32.const 8) "X-Echo")
+//	  (data (i32.const 16) "denied"))
+var echoWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x1d, 0x05, 0x60, 0x02, 0x7f, 0x7f, 0x01,
+	0x7e, 0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x00, 0x60, 0x03, 0x7f, 0x7f, 0x7f, 0x00, 0x60, 0x01,
+	0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f, 0x02, 0x33, 0x03, 0x05, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x00, 0x00, 0x05, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x0a,
+	0x73, 0x65, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x00, 0x01, 0x05, 0x70, 0x72, 0x6f,
+	0x78, 0x79, 0x07, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x64, 0x00, 0x02, 0x03, 0x04, 0x03, 0x03,
+	0x04, 0x04, 0x05, 0x03, 0x01, 0x00, 0x01, 0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b,
+	0x07, 0x2d, 0x04, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c,
+	0x6f, 0x63, 0x00, 0x03, 0x0a, 0x6f, 0x6e, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x00,
+	0x04, 0x0b, 0x6f, 0x6e, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x00, 0x05, 0x0a,
+	0x42, 0x03, 0x0b, 0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b, 0x2f, 0x01,
+	0x01, 0x7e, 0x41, 0x00, 0x41, 0x06, 0x10, 0x00, 0x21, 0x00, 0x20, 0x00, 0x50, 0x04, 0x40, 0x41,
+	0x93, 0x03, 0x41, 0x10, 0x41, 0x06, 0x10, 0x02, 0x41, 0x00, 0x0f, 0x0b, 0x41, 0x08, 0x41, 0x06,
+	0x20, 0x00, 0x42, 0x20, 0x88, 0xa7, 0x20, 0x00, 0xa7, 0x10, 0x01, 0x41, 0x00, 0x0b, 0x04, 0x00,
+	0x41, 0x01, 0x0b, 0x0b, 0x22, 0x03, 0x00, 0x41, 0x00, 0x0b, 0x06, 0x58, 0x2d, 0x55, 0x73, 0x65,
+	0x72, 0x00, 0x41, 0x08, 0x0b, 0x06, 0x58, 0x2d, 0x45, 0x63, 0x68, 0x6f, 0x00, 0x41, 0x10, 0x0b,
+	0x06, 0x64, 0x65, 0x6e, 0x69, 0x65, 0x64,
+}
+
+func TestWazeroRuntime(t *testing.T) {
+	ctx := context.Background()
+	rt, err := NewWazeroRuntime(ctx)
+	assert.NoError(t, err)
+	defer rt.Close(ctx)
+
+	_, err = Load(ctx, rt, "broken", append(append([]byte{}, wasmMagic...), 0x01))
+	assert.Error(t, err)
+
+	p, err := Load(ctx, rt, "echo", echoWasm)
+	assert.NoError(t, err)
+	h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Echo")))
+	}))
+
+	tests := []struct {
+		name       string
+		user       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test passing request", "alice", http.StatusOK, "alice"},
+		{"Test rejected request", "", http.StatusForbidden, "denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.user != "" {
+				r.Header.Set("X-User", tt.user)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	assert.Error(t, p.ModifyResponse(res), "a non-zero result should fail the filter")
+	assert.NoError(t, p.Close(ctx))
+}
@@ -0,0 +1,124 @@
+// Package proxyctx provides typed accessors of the request state shared by the proxy, middleware,
+// modifiers and user handlers through the request context. The proxy stores the request ID, client IP,
+// matched route, route parameters and upstream of each request; middleware can store the AuthInfo of
+// authenticated clients.
+//
+// The outbound request keeps the context of the inbound request, so a ResponseModifier can read the
+// state from the context of http.Response.Request.
+package proxyctx
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+)
+
+type (
+	requestIDKey struct{}
+	clientIPKey  struct{}
+	routeKey     struct{}
+	upstreamKey  struct{}
+	authInfoKey  struct{}
+	paramsKey    struct{}
+)
+
+// RouteInfo describes the route matched by a request.
+type RouteInfo struct {
+	Method string
+	Path   string
+	Group  string
+}
+
+// AuthInfo describes the authenticated client of a request.
+type AuthInfo struct {
+	// Subject identifies the client, e.g. a user ID or API key name.
+	Subject string
+	// Scheme is the authentication scheme, e.g. "Bearer" or "Basic".
+	Scheme string
+	Claims map[string]any
+}
+
+// Param is a route parameter captured from the request path.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params is the ordered list of route parameters of a request.
+type Params []Param
+
+// ByName returns the value of the first parameter with the passed key, or an empty string.
+func (ps Params) ByName(name string) string {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// WithRequestID returns a copy of ctx holding the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithClientIP returns a copy of ctx holding the client IP address.
+func WithClientIP(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the client IP address of ctx.
+func ClientIP(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip, ok
+}
+
+// WithRoute returns a copy of ctx holding the matched route.
+func WithRoute(ctx context.Context, route RouteInfo) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// Route returns the matched route of ctx.
+func Route(ctx context.Context) (RouteInfo, bool) {
+	route, ok := ctx.Value(routeKey{}).(RouteInfo)
+	return route, ok
+}
+
+// WithUpstream returns a copy of ctx holding the URL of the upstream serving the request.
+func WithUpstream(ctx context.Context, upstream *url.URL) context.Context {
+	return context.WithValue(ctx, upstreamKey{}, upstream)
+}
+
+// Upstream returns the URL of the upstream serving the request, or nil.
+func Upstream(ctx context.Context) *url.URL {
+	upstream, _ := ctx.Value(upstreamKey{}).(*url.URL)
+	return upstream
+}
+
+// WithAuth returns a copy of ctx holding the authenticated client.
+func WithAuth(ctx context.Context, info *AuthInfo) context.Context {
+	return context.WithValue(ctx, authInfoKey{}, info)
+}
+
+// Auth returns the authenticated client of ctx, or nil.
+func Auth(ctx context.Context) *AuthInfo {
+	info, _ := ctx.Value(authInfoKey{}).(*AuthInfo)
+	return info
+}
+
+// WithRouteParams returns a copy of ctx holding the route parameters.
+func WithRouteParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// RouteParams returns the route parameters of ctx, or nil.
+func RouteParams(ctx context.Context) Params {
+	params, _ := ctx.Value(paramsKey{}).(Params)
+	return params
+}
@@ -0,0 +1,42 @@
+package proxyctx
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessors(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, RequestID(ctx))
+	_, ok := ClientIP(ctx)
+	assert.False(t, ok)
+	_, ok = Route(ctx)
+	assert.False(t, ok)
+	assert.Nil(t, Upstream(ctx))
+	assert.Nil(t, Auth(ctx))
+	assert.Nil(t, RouteParams(ctx))
+
+	upstream, _ := url.Parse("http://backend:8080")
+	ctx = WithRequestID(ctx, "abc")
+	ctx = WithClientIP(ctx, netip.MustParseAddr("192.0.2.1"))
+	ctx = WithRoute(ctx, RouteInfo{Method: "GET", Path: "/users/:id"})
+	ctx = WithUpstream(ctx, upstream)
+	ctx = WithAuth(ctx, &AuthInfo{Subject: "ann", Scheme: "Bearer"})
+	ctx = WithRouteParams(ctx, Params{{Key: "id", Value: "42"}})
+
+	assert.Equal(t, "abc", RequestID(ctx))
+	ip, ok := ClientIP(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1", ip.String())
+	route, ok := Route(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, RouteInfo{Method: "GET", Path: "/users/:id"}, route)
+	assert.Equal(t, upstream, Upstream(ctx))
+	assert.Equal(t, "ann", Auth(ctx).Subject)
+	assert.Equal(t, "42", RouteParams(ctx).ByName("id"))
+	assert.Empty(t, RouteParams(ctx).ByName("name"))
+}
@@ -0,0 +1,69 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// ContextDialer is the interface of connection dialers with context support, e.g. *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Dialer sends a PROXY protocol header with the client IP of the request to the upstreams, e.g.
+// upstreams behind the proxy which expect it from their load balancer. The client IP is read from the
+// dial context, which is the context of the request triggering the dial. As the header describes the
+// whole connection, the connections mustn't be shared by the requests of different clients, see Transport.
+type Dialer struct {
+	// Version is the protocol version, 1 or 2.
+	Version int
+	// Forward dials the connections, a default net.Dialer if nil.
+	Forward ContextDialer
+}
+
+// DialContext connects to the address and sends the header. Connections dialed without a client IP in
+// the context, e.g. health checks, get a v1 UNKNOWN or v2 LOCAL header.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	forward := d.Forward
+	if forward == nil {
+		forward = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	conn, err := forward.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{Version: d.Version}
+	if ip, ok := proxyctx.ClientIP(ctx); ok {
+		h.Source = netip.AddrPortFrom(ip, 0)
+		if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			dst := tcp.AddrPort()
+			h.Destination = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+			if h.Source.Addr().Is4() != h.Destination.Addr().Is4() {
+				// the address families must match, so IPv4 clients are sent as mapped IPv6 addresses
+				h.Source = netip.AddrPortFrom(netip.AddrFrom16(ip.As16()), 0)
+				h.Destination = netip.AddrPortFrom(netip.AddrFrom16(dst.Addr().As16()), dst.Port())
+			}
+		}
+	}
+	if _, err := conn.Write(h.Format()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Transport returns an HTTP transport with the settings of http.DefaultTransport, which sends a header
+// of the version on its connections. The keep-alives are disabled, so every request gets a connection
+// with the header of its client. The result can be assigned to ReverseProxyMux.Transport.
+func Transport(version int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&Dialer{Version: version}).DialContext
+	t.DisableKeepAlives = true
+	t.ForceAttemptHTTP2 = false
+	return t
+}
@@ -0,0 +1,53 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		startServer(t, &Listener{Listener: l, Required: true})
+
+		pm, err := reverseproxy.New("http://" + l.Addr().String())
+		assert.NoError(t, err)
+		pm.Transport = Transport(version)
+		pm.PassPath("GET", "/")
+
+		// the ports of the clients aren't known, and IPv6 clients of IPv4 upstreams are sent as IPv6
+		clients := map[string]string{
+			"192.0.2.1:1234":     "192.0.2.1:0 127.0.0.1:",
+			"[2001:db8::1]:1234": "[2001:db8::1]:0 127.0.0.1:",
+			"192.0.2.2:1234":     "192.0.2.2:0 127.0.0.1:",
+		}
+		for client, want := range clients {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = client
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), want, "version %d", version)
+		}
+	}
+}
+
+func TestDialer_WithoutClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	startServer(t, &Listener{Listener: l, Required: true})
+
+	client := &http.Client{Transport: Transport(2)}
+	res, err := client.Get("http://" + l.Addr().String())
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	assert.Contains(t, string(b), "127.0.0.1:")
+}
@@ -0,0 +1,207 @@
+// Package proxyproto implements the PROXY protocol v1 and v2 of HAProxy, which passes the address of
+// the client connection through L4 load balancers. The Listener recovers the client addresses of the
+// connections accepted behind a load balancer, so the mux sees the real client IPs:
+//
+//	l, _ := net.Listen("tcp", ":8080")
+//	http.Serve(proxyproto.NewListener(l), pm)
+//
+// The Dialer sends the client address of the requests to upstreams expecting the PROXY protocol.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHeader is returned for connections with a malformed PROXY protocol header.
+var ErrInvalidHeader = errors.New("proxyproto: invalid header")
+
+// signature is the signature starting the v2 headers.
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// v1MaxLength is the maximum length of a v1 header including the CRLF.
+	v1MaxLength = 107
+	v2Version   = 0x20
+	v2CmdLocal  = 0x00
+	v2CmdProxy  = 0x01
+	v2FamInet   = 0x10
+	v2FamInet6  = 0x20
+	v2Stream    = 0x01
+)
+
+// Header is a PROXY protocol header.
+type Header struct {
+	// Version is the protocol version, 1 or 2.
+	Version int
+	// Source and Destination are the addresses of the client connection. They're invalid for
+	// connections of the proxy itself, e.g. health checks, and for unknown protocols.
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+}
+
+// Format returns the header in its wire format. Headers without valid addresses are formatted as
+// v1 UNKNOWN or v2 LOCAL headers.
+func (h *Header) Format() []byte {
+	src, dst := h.Source, h.Destination
+	valid := src.IsValid() && dst.IsValid() && src.Addr().Is4() == dst.Addr().Is4()
+	if h.Version == 2 {
+		var b bytes.Buffer
+		b.Write(signature)
+		if !valid {
+			b.Write([]byte{v2Version | v2CmdLocal, 0, 0, 0})
+			return b.Bytes()
+		}
+		fam, n := byte(v2FamInet), 12
+		if !src.Addr().Is4() {
+			fam, n = v2FamInet6, 36
+		}
+		b.Write([]byte{v2Version | v2CmdProxy, fam | v2Stream})
+		_ = binary.Write(&b, binary.BigEndian, uint16(n))
+		b.Write(src.Addr().AsSlice())
+		b.Write(dst.Addr().AsSlice())
+		_ = binary.Write(&b, binary.BigEndian, src.Port())
+		_ = binary.Write(&b, binary.BigEndian, dst.Port())
+		return b.Bytes()
+	}
+	if !valid {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	proto := "TCP4"
+	if !src.Addr().Is4() {
+		proto = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src.Addr(), dst.Addr(), src.Port(), dst.Port()))
+}
+
+// ReadHeader reads a v1 or v2 header from the reader. It returns nil without consuming any data if the
+// data doesn't start with a header.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 'P':
+		if b, err := r.Peek(6); err != nil || string(b) != "PROXY " {
+			return nil, nil
+		}
+		return readV1(r)
+	case signature[0]:
+		if b, err := r.Peek(len(signature)); err != nil || !bytes.Equal(b, signature) {
+			return nil, nil
+		}
+		return readV2(r)
+	}
+	return nil, nil
+}
+
+// readV1 reads a v1 header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, fmt.Errorf("%w: v1 header without CRLF", ErrInvalidHeader)
+	}
+	fields := strings.Split(s, " ")
+	h := &Header{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, s)
+	}
+	src, err1 := parseAddrPort(fields[2], fields[4])
+	dst, err2 := parseAddrPort(fields[3], fields[5])
+	if err := errors.Join(err1, err2); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	if src.Addr().Is4() != (fields[1] == "TCP4") || dst.Addr().Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: address family mismatch", ErrInvalidHeader)
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+// parseAddrPort parses an address and a decimal port.
+func parseAddrPort(addr, port string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
+// readV2 reads a v2 header. Its TLVs are skipped.
+func readV2(r *bufio.Reader) (*Header, error) {
+	head := make([]byte, len(signature)+4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	verCmd, fam := head[12], head[13]
+	n := int(binary.BigEndian.Uint16(head[14:]))
+	if verCmd&0xf0 != v2Version {
+		return nil, fmt.Errorf("%w: version %d", ErrInvalidHeader, verCmd>>4)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	h := &Header{Version: 2}
+	switch verCmd & 0x0f {
+	case v2CmdLocal:
+		return h, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("%w: command %d", ErrInvalidHeader, verCmd&0x0f)
+	}
+	size := 0
+	switch fam & 0xf0 {
+	case v2FamInet:
+		size = 4
+	case v2FamInet6:
+		size = 16
+	default:
+		// unspecified and unix socket addresses aren't passed on
+		return h, nil
+	}
+	if n < 2*size+4 {
+		return nil, fmt.Errorf("%w: address block too short", ErrInvalidHeader)
+	}
+	src, _ := netip.AddrFromSlice(body[:size])
+	dst, _ := netip.AddrFromSlice(body[size : 2*size])
+	ports := body[2*size:]
+	h.Source = netip.AddrPortFrom(src, binary.BigEndian.Uint16(ports))
+	h.Destination = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(ports[2:]))
+	return h, nil
+}
+
+// tcpAddr returns the TCP address of the address and port, or nil if it's invalid.
+func tcpAddr(ap netip.AddrPort) net.Addr {
+	if !ap.IsValid() {
+		return nil
+	}
+	return net.TCPAddrFromAddrPort(ap)
+}
@@ -0,0 +1,72 @@
+package proxyproto
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeader(t *testing.T) {
+	v4src, v4dst := netip.MustParseAddrPort("192.0.2.1:56324"), netip.MustParseAddrPort("198.51.100.1:443")
+	v6src, v6dst := netip.MustParseAddrPort("[2001:db8::1]:56324"), netip.MustParseAddrPort("[2001:db8::2]:443")
+	tests := []struct {
+		name   string
+		header Header
+		wire   string
+	}{
+		{"Test v1 IPv4", Header{Version: 1, Source: v4src, Destination: v4dst}, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"},
+		{"Test v1 IPv6", Header{Version: 1, Source: v6src, Destination: v6dst}, "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"},
+		{"Test v1 unknown", Header{Version: 1}, "PROXY UNKNOWN\r\n"},
+		{"Test v2 IPv4", Header{Version: 2, Source: v4src, Destination: v4dst}, ""},
+		{"Test v2 IPv6", Header{Version: 2, Source: v6src, Destination: v6dst}, ""},
+		{"Test v2 local", Header{Version: 2}, "\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wire := tt.header.Format()
+			if tt.wire != "" {
+				assert.Equal(t, tt.wire, string(wire))
+			}
+			r := bufio.NewReader(strings.NewReader(string(wire) + "GET / HTTP/1.1\r\n"))
+			h, err := ReadHeader(r)
+			assert.NoError(t, err)
+			assert.Equal(t, &tt.header, h)
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+		})
+	}
+}
+
+func TestReadHeader_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"Test HTTP request", "POST / HTTP/1.1\r\n", false},
+		{"Test v1 without CRLF", "PROXY TCP4 192.0.2.1 198.51.100.1 1 2\n", true},
+		{"Test v1 invalid address", "PROXY TCP4 192.0.2 198.51.100.1 1 2\r\n", true},
+		{"Test v1 family mismatch", "PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n", true},
+		{"Test v1 too long", "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", true},
+		{"Test v2 invalid version", "\r\n\r\n\x00\r\nQUIT\n\x10\x00\x00\x00", true},
+		{"Test v2 short address block", "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x04\x01\x02\x03\x04", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.data))
+			h, err := ReadHeader(r)
+			assert.Nil(t, h)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, tt.data, string(rest))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout is the default time to receive the header of an accepted connection.
+const DefaultHeaderTimeout = 10 * time.Second
+
+// ErrMissingHeader is returned for connections of trusted sources without a header if it's required.
+var ErrMissingHeader = errors.New("proxyproto: missing header")
+
+// Listener accepts connections with a PROXY protocol header, whose RemoteAddr and LocalAddr are the
+// addresses of the client connection. The header is read by the first Read, RemoteAddr or LocalAddr
+// call, so a slow connection doesn't block Accept.
+type Listener struct {
+	net.Listener
+	// TrustedProxies holds the networks of the load balancers whose headers are accepted. The
+	// connections of other sources are used as is. All sources are trusted if empty, so the listener
+	// must only be reachable by the load balancers then.
+	TrustedProxies []netip.Prefix
+	// Required rejects the connections of trusted sources without a header.
+	Required bool
+	// HeaderTimeout limits the time to receive the header, DefaultHeaderTimeout if zero.
+	HeaderTimeout time.Duration
+}
+
+// NewListener wraps the listener, trusting the headers of all sources.
+func NewListener(l net.Listener) *Listener {
+	return &Listener{Listener: l}
+}
+
+// Accept returns the next connection, reading its header lazily.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), required: l.Required, timeout: timeout}, nil
+}
+
+// trusted reports whether the headers of the connection source are accepted.
+func (l *Listener) trusted(addr net.Addr) bool {
+	if len(l.TrustedProxies) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip := tcp.AddrPort().Addr().Unmap()
+	for _, prefix := range l.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection of a Listener.
+type Conn struct {
+	net.Conn
+	r        *bufio.Reader
+	required bool
+	timeout  time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+// Header returns the PROXY protocol header of the connection, nil if it has none.
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(c.readHeader)
+	return c.header, c.err
+}
+
+// readHeader reads the header within the timeout.
+func (c *Conn) readHeader() {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+	c.header, c.err = ReadHeader(c.r)
+	if c.err == nil && c.header == nil && c.required {
+		c.err = ErrMissingHeader
+	}
+}
+
+// Read reads the data following the header. It fails if the header is invalid.
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	if h, _ := c.Header(); h != nil {
+		if addr := tcpAddr(h.Source); addr != nil {
+			return addr
+		}
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local address.
+func (c *Conn) LocalAddr() net.Addr {
+	if h, _ := c.Header(); h != nil {
+		if addr := tcpAddr(h.Destination); addr != nil {
+			return addr
+		}
+	}
+	return c.Conn.LocalAddr()
+}
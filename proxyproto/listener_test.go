@@ -0,0 +1,78 @@
+package proxyproto
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer serves HTTP on the listener, answering the remote and local addresses of the requests.
+func startServer(t *testing.T, l *Listener) {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr+" "+r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
+	})}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+}
+
+// request sends the header and a GET request to the address, returning the response body.
+func request(t *testing.T, addr, header string) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, _ = io.WriteString(conn, header+"GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return string(b), err
+}
+
+func TestListener(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener func(net.Listener) *Listener
+		header   string
+		want     string
+		wantErr  bool
+	}{
+		{"Test v1 header", NewListener, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324 198.51.100.1:443", false},
+		{"Test v2 header", NewListener, string((&Header{Version: 2, Source: netip.MustParseAddrPort("[2001:db8::1]:1"), Destination: netip.MustParseAddrPort("[2001:db8::2]:2")}).Format()), "[2001:db8::1]:1 [2001:db8::2]:2", false},
+		{"Test local header", NewListener, "PROXY UNKNOWN\r\n", "127.0.0.1:", false},
+		{"Test missing header", NewListener, "", "127.0.0.1:", false},
+		{"Test required header", func(l net.Listener) *Listener {
+			return &Listener{Listener: l, Required: true}
+		}, "", "", true},
+		{"Test untrusted source", func(l net.Listener) *Listener {
+			return &Listener{Listener: l, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+		}, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "", true},
+		{"Test trusted source", func(l net.Listener) *Listener {
+			return &Listener{Listener: l, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+		}, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324 198.51.100.1:443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			startServer(t, tt.listener(l))
+
+			body, err := request(t, l.Addr().String(), tt.header)
+			if tt.wantErr {
+				// the connection is closed or answered with 400 bad request
+				assert.NotContains(t, body, "192.0.2.1")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, body, tt.want)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package proxytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// AssertForwarded asserts that the request was forwarded by the proxy for the host, with the
+// X-Forwarded-Host, X-Forwarded-Proto and X-Forwarded-For headers.
+func AssertForwarded(t testing.TB, r *Request, host, proto string) bool {
+	t.Helper()
+	if !assertRequest(t, r) {
+		return false
+	}
+	ok := AssertHeader(t, r.Header, "X-Forwarded-Host", host)
+	ok = AssertHeader(t, r.Header, "X-Forwarded-Proto", proto) && ok
+	if r.Header.Get("X-Forwarded-For") == "" {
+		t.Errorf("missing X-Forwarded-For header")
+		ok = false
+	}
+	return ok
+}
+
+// AssertHeader asserts the value of a header, an empty value asserting that it's missing.
+func AssertHeader(t testing.TB, h http.Header, name, want string) bool {
+	t.Helper()
+	if got := h.Get(name); got != want {
+		t.Errorf("header %s: got %q, want %q", name, got, want)
+		return false
+	}
+	return true
+}
+
+// AssertPath asserts the path of the forwarded request, e.g. rewritten by the route.
+func AssertPath(t testing.TB, r *Request, want string) bool {
+	t.Helper()
+	if !assertRequest(t, r) {
+		return false
+	}
+	if r.URL.Path != want {
+		t.Errorf("path: got %q, want %q", r.URL.Path, want)
+		return false
+	}
+	return true
+}
+
+// AssertRequestURI asserts the path and query of the forwarded request.
+func AssertRequestURI(t testing.TB, r *Request, want string) bool {
+	t.Helper()
+	if !assertRequest(t, r) {
+		return false
+	}
+	if got := r.URL.RequestURI(); got != want {
+		t.Errorf("request URI: got %q, want %q", got, want)
+		return false
+	}
+	return true
+}
+
+// AssertStatus asserts the status code of the response.
+func AssertStatus(t testing.TB, w *httptest.ResponseRecorder, want int) bool {
+	t.Helper()
+	if w.Code != want {
+		t.Errorf("status: got %d, want %d", w.Code, want)
+		return false
+	}
+	return true
+}
+
+// AssertBody asserts the body of the response, e.g. modified by the route.
+func AssertBody(t testing.TB, w *httptest.ResponseRecorder, want string) bool {
+	t.Helper()
+	if got := w.Body.String(); got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+		return false
+	}
+	return true
+}
+
+// assertRequest asserts that the upstream received the request.
+func assertRequest(t testing.TB, r *Request) bool {
+	t.Helper()
+	if r == nil {
+		t.Errorf("no request received by the upstream")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+// Package proxytest provides utilities for testing the routes of a mux: a fake upstream answering
+// scripted responses and recording the forwarded requests, and assertion helpers for the forwarded
+// headers, the rewritten paths and the modified responses.
+//
+//	up := proxytest.NewUpstream(t).On("GET", "/v2/users", proxytest.Response{Body: "[]"})
+//	pm := proxytest.NewMux(t, up)
+//	pm.RewritePath("GET", "/users", "/v2/users")
+//	w := proxytest.Get(pm, "/users")
+//	proxytest.AssertStatus(t, w, http.StatusOK)
+//	proxytest.AssertPath(t, up.LastRequest(), "/v2/users")
+package proxytest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// Response is a scripted response of an Upstream.
+type Response struct {
+	// Status is the status code, 200 if zero.
+	Status int
+	Header http.Header
+	Body   string
+	// Delay delays the response, e.g. to test timeouts.
+	Delay time.Duration
+}
+
+// Request is a request received by an Upstream.
+type Request struct {
+	Method string
+	// URL is the request URI as received, holding the path and query.
+	URL    *url.URL
+	Host   string
+	Header http.Header
+	Body   []byte
+}
+
+// Upstream is a fake upstream server. It answers the responses scripted with On, and the default
+// response to the other requests.
+type Upstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scripts  map[string][]Response
+	fallback Response
+	requests []*Request
+}
+
+// NewUpstream starts an upstream server, which is closed when the test finishes.
+func NewUpstream(t testing.TB) *Upstream {
+	u := &Upstream{scripts: make(map[string][]Response)}
+	u.Server = httptest.NewServer(http.HandlerFunc(u.serve))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// On scripts the responses to the requests of the method and path, an empty method matching all
+// methods. The responses are answered in order, the last one repeatedly.
+func (u *Upstream) On(method, path string, responses ...Response) *Upstream {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.scripts[method+" "+path] = responses
+	return u
+}
+
+// Default sets the response to the requests without a script, an empty 200 response by default.
+func (u *Upstream) Default(res Response) *Upstream {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fallback = res
+	return u
+}
+
+// Requests returns the received requests in order.
+func (u *Upstream) Requests() []*Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]*Request(nil), u.requests...)
+}
+
+// LastRequest returns the last received request, nil if none.
+func (u *Upstream) LastRequest() *Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.requests) == 0 {
+		return nil
+	}
+	return u.requests[len(u.requests)-1]
+}
+
+// Reset forgets the received requests.
+func (u *Upstream) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = nil
+}
+
+// serve records the request and answers its response.
+func (u *Upstream) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := &Request{Method: r.Method, URL: r.URL, Host: r.Host, Header: r.Header.Clone(), Body: body}
+	res := u.next(r)
+	u.mu.Lock()
+	u.requests = append(u.requests, req)
+	u.mu.Unlock()
+
+	if res.Delay > 0 {
+		select {
+		case <-time.After(res.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for name, values := range res.Header {
+		w.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+	if res.Status != 0 {
+		w.WriteHeader(res.Status)
+	}
+	_, _ = io.WriteString(w, res.Body)
+}
+
+// next returns the response to the request, advancing its script.
+func (u *Upstream) next(r *http.Request) Response {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := r.Method + " " + r.URL.Path
+	script, ok := u.scripts[key]
+	if !ok {
+		key = " " + r.URL.Path
+		script = u.scripts[key]
+	}
+	if len(script) == 0 {
+		return u.fallback
+	}
+	if len(script) > 1 {
+		u.scripts[key] = script[1:]
+	}
+	return script[0]
+}
+
+// NewMux creates a mux proxying to the upstream.
+func NewMux(t testing.TB, u *Upstream) *reverseproxy.ReverseProxyMux {
+	t.Helper()
+	pm, err := reverseproxy.New(u.URL)
+	if err != nil {
+		t.Fatalf("proxytest: %v", err)
+	}
+	return pm
+}
+
+// Serve serves the request with the handler, e.g. a mux, and returns the recorded response.
+func Serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// Get serves a GET request of the target with the handler.
+func Get(h http.Handler, target string) *httptest.ResponseRecorder {
+	return Serve(h, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// Post serves a POST request of the target with the body with the handler.
+func Post(h http.Handler, target, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return Serve(h, r)
+}
@@ -0,0 +1,103 @@
+package proxytest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstream(t *testing.T) {
+	up := NewUpstream(t).
+		On("GET", "/items", Response{Status: http.StatusServiceUnavailable}, Response{Body: "items"}).
+		On("", "/any", Response{Header: http.Header{"X-Any": {"1"}}, Body: "any"}).
+		Default(Response{Status: http.StatusNotFound, Body: "default"})
+
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"GET", "/items", http.StatusServiceUnavailable, ""},
+		{"GET", "/items", http.StatusOK, "items"},
+		{"GET", "/items", http.StatusOK, "items"},
+		{"POST", "/items", http.StatusNotFound, "default"},
+		{"DELETE", "/any", http.StatusOK, "any"},
+		{"GET", "/other", http.StatusNotFound, "default"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, up.URL+tt.path, strings.NewReader("payload"))
+		res, err := http.DefaultClient.Do(r)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, tt.wantCode, res.StatusCode, tt.method+" "+tt.path)
+		assert.Equal(t, tt.wantBody, string(body), tt.method+" "+tt.path)
+	}
+	assert.Len(t, up.Requests(), len(tests))
+	assert.Equal(t, "/other", up.LastRequest().URL.Path)
+	assert.Equal(t, "payload", string(up.LastRequest().Body))
+	up.Reset()
+	assert.Nil(t, up.LastRequest())
+}
+
+func TestUpstream_Delay(t *testing.T) {
+	up := NewUpstream(t).Default(Response{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	res, err := http.Get(up.URL)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestMux(t *testing.T) {
+	up := NewUpstream(t).On("GET", "/v2/users", Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: "[]"})
+	pm := NewMux(t, up)
+	pm.RewritePath("GET", "/users", "/v2/users")
+	pm.HandlePath(reverseproxy.NewRoute("POST", "/echo").SetModifyResponse(func(res *http.Response) error {
+		res.Header.Set("X-Modified", "yes")
+		return nil
+	}))
+
+	w := Get(pm, "/users?page=2")
+	assert.True(t, AssertStatus(t, w, http.StatusOK))
+	assert.True(t, AssertBody(t, w, "[]"))
+	assert.True(t, AssertHeader(t, w.Header(), "Content-Type", "application/json"))
+	assert.True(t, AssertPath(t, up.LastRequest(), "/v2/users"))
+	assert.True(t, AssertRequestURI(t, up.LastRequest(), "/v2/users?page=2"))
+	assert.True(t, AssertForwarded(t, up.LastRequest(), "example.com", "http"))
+
+	w = Post(pm, "/echo", "text/plain", "hello")
+	assert.True(t, AssertHeader(t, w.Header(), "X-Modified", "yes"))
+	assert.True(t, AssertHeader(t, up.LastRequest().Header, "Content-Type", "text/plain"))
+	assert.Equal(t, "hello", string(up.LastRequest().Body))
+}
+
+// fakeT records the errors of the assertions.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, format)
+}
+
+func TestAssert_Failures(t *testing.T) {
+	ft := &fakeT{}
+	r := &Request{Header: http.Header{}}
+	w := Get(http.NotFoundHandler(), "/")
+
+	assert.False(t, AssertPath(ft, nil, "/"))
+	assert.False(t, AssertForwarded(ft, r, "example.com", "http"))
+	assert.False(t, AssertStatus(ft, w, http.StatusOK))
+	assert.False(t, AssertBody(ft, w, ""))
+	assert.Len(t, ft.errors, 6)
+}
@@ -0,0 +1,72 @@
+package reverseproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Queue configures the request queue of a route, see Route.SetQueue.
+type Queue struct {
+	// MaxInFlight is the number of requests of the route forwarded to the upstream concurrently.
+	MaxInFlight int
+	// Depth is the number of requests waiting for a free slot, zero means the requests exceeding
+	// MaxInFlight are rejected immediately.
+	Depth int
+	// MaxWait is the time a request waits in the queue.
+	MaxWait time.Duration
+	// RetryAfter is the delay of the Retry-After header of the rejected requests, DefaultRetryAfter if zero.
+	RetryAfter time.Duration
+}
+
+// routeQueue holds the requests of a route exceeding its in-flight limit.
+type routeQueue struct {
+	cfg   Queue
+	slots chan struct{}
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// newRouteQueue creates the queue of a route.
+func newRouteQueue(cfg Queue) *routeQueue {
+	return &routeQueue{cfg: cfg, slots: make(chan struct{}, max(cfg.MaxInFlight, 1))}
+}
+
+// enter takes a slot, waiting in the queue if none is free. It returns false if the queue is full,
+// the wait time elapsed or the context is done.
+func (q *routeQueue) enter(ctx context.Context) bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+	q.mu.Lock()
+	if q.waiting >= q.cfg.Depth {
+		q.mu.Unlock()
+		return false
+	}
+	q.waiting++
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		q.mu.Unlock()
+	}()
+
+	t := time.NewTimer(q.cfg.MaxWait)
+	defer t.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// leave frees the slot of a request.
+func (q *routeQueue) leave() {
+	<-q.slots
+}
@@ -0,0 +1,84 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteQueue(t *testing.T) {
+	q := newRouteQueue(Queue{MaxInFlight: 1, Depth: 1, MaxWait: time.Second})
+	ctx := context.Background()
+	assert.True(t, q.enter(ctx))
+
+	queued := make(chan bool)
+	go func() {
+		queued <- q.enter(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.waiting == 1
+	}, time.Second, time.Millisecond)
+
+	assert.False(t, q.enter(ctx), "the queue should be full")
+	q.leave()
+	assert.True(t, <-queued)
+	q.leave()
+}
+
+func TestRouteQueueTimeout(t *testing.T) {
+	q := newRouteQueue(Queue{MaxInFlight: 1, Depth: 5, MaxWait: 10 * time.Millisecond})
+	assert.True(t, q.enter(context.Background()))
+	assert.False(t, q.enter(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, q.enter(ctx))
+
+	q.leave()
+	assert.True(t, q.enter(context.Background()))
+}
+
+func TestSetQueue(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/users").SetQueue(Queue{MaxInFlight: 1}))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code, "the slot should be freed after each request")
+	}
+}
+
+func TestSetQueue_RouteChange(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-release
+		}
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/users").SetQueue(Queue{MaxInFlight: 1}))
+	done := make(chan int)
+	go func() {
+		done <- serve(pm, "GET", "/users").Code
+	}()
+	assert.Eventually(t, func() bool {
+		return requests.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	// the request in flight on the replaced handler still holds the slot
+	pm.PassPath("GET", "/other")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(pm, "GET", "/users").Code)
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+}
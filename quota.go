@@ -0,0 +1,139 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultQuotaPeriod is the period of a Quota, if not set.
+const DefaultQuotaPeriod = 24 * time.Hour
+
+// QuotaCounter counts the requests of the quota windows, e.g. in memory or in Redis for quotas shared
+// by several proxy instances.
+type QuotaCounter interface {
+	// Increment adds a request to the count of the key, which expires after the ttl if it's new, and
+	// returns the new count.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// Quota configures a quota limiting the requests per key in a fixed period, e.g. 10000 requests per
+// day per API key. Unlike the rate limiters, which smooth out short bursts, a quota caps the usage of
+// a client in the long term.
+type Quota struct {
+	// Limit is the number of requests per key in a period.
+	Limit int64
+	// Period is the length of the quota windows, DefaultQuotaPeriod if zero. The windows are aligned to
+	// the Unix epoch, e.g. a day runs from midnight to midnight UTC.
+	Period time.Duration
+	// Key partitions the requests, e.g. LimitByHeader("X-API-Key"), all requests share the quota if nil.
+	Key LimitKeyFunc
+	// Counter counts the requests, a MemoryQuotaCounter created with the quota if nil.
+	Counter QuotaCounter
+	// Prefix is prepended to the keys of the counter, separating the quotas sharing a counter.
+	Prefix string
+}
+
+// QuotaLimiter returns middleware enforcing the quota, see Route.SetQuota for a quota of a single
+// route. The responses carry the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset
+// headers, the latter holding the seconds until the window ends. The requests exceeding the quota are
+// answered with HTTP 429 too many requests and a Retry-After header until the window ends. If the
+// counter fails, the request is passed. Register it with Use or UseGroup.
+func QuotaLimiter(quota Quota) Middleware {
+	q := newQuotaLimiter(quota)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if q.allow(w, r) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// quotaLimiter enforces a quota.
+type quotaLimiter struct {
+	quota Quota
+}
+
+// newQuotaLimiter creates the limiter of the quota, defaulting its period and counter.
+func newQuotaLimiter(quota Quota) *quotaLimiter {
+	if quota.Period <= 0 {
+		quota.Period = DefaultQuotaPeriod
+	}
+	if quota.Counter == nil {
+		quota.Counter = NewMemoryQuotaCounter()
+	}
+	return &quotaLimiter{quota: quota}
+}
+
+// allow counts the request and sets the quota headers, answering the request if it exceeds the quota.
+func (q *quotaLimiter) allow(w http.ResponseWriter, r *http.Request) bool {
+	now := time.Now()
+	start := now.Truncate(q.quota.Period)
+	reset := start.Add(q.quota.Period).Sub(now)
+	var key string
+	if q.quota.Key != nil {
+		key = q.quota.Key(r)
+	}
+	trace := TraceFromContext(r.Context())
+	count, err := q.quota.Counter.Increment(r.Context(), q.quota.Prefix+key+":"+strconv.FormatInt(start.Unix(), 10), reset)
+	if err != nil {
+		trace.Add("quota", "counter failed: "+err.Error())
+		return true
+	}
+	seconds := strconv.Itoa(int((reset + time.Second - 1) / time.Second))
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.FormatInt(q.quota.Limit, 10))
+	h.Set("X-RateLimit-Remaining", strconv.FormatInt(max(q.quota.Limit-count, 0), 10))
+	h.Set("X-RateLimit-Reset", seconds)
+	if count > q.quota.Limit {
+		trace.Add("quota", "quota of "+strconv.FormatInt(q.quota.Limit, 10)+" exceeded")
+		h.Set("Retry-After", seconds)
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// MemoryQuotaCounter is an in-memory QuotaCounter, counting the requests of a single proxy instance.
+type MemoryQuotaCounter struct {
+	mu        sync.Mutex
+	counts    map[string]*quotaCount
+	nextSweep time.Time
+}
+
+// quotaCount is a count of the memory counter.
+type quotaCount struct {
+	n       int64
+	expires time.Time
+}
+
+// NewMemoryQuotaCounter creates a memory counter.
+func NewMemoryQuotaCounter() *MemoryQuotaCounter {
+	return &MemoryQuotaCounter{counts: make(map[string]*quotaCount)}
+}
+
+// Increment adds a request to the count of the key, which expires after the ttl if it's new, and
+// returns the new count. The expired counts are removed periodically.
+func (c *MemoryQuotaCounter) Increment(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.After(c.nextSweep) {
+		for k, qc := range c.counts {
+			if now.After(qc.expires) {
+				delete(c.counts, k)
+			}
+		}
+		c.nextSweep = now.Add(time.Minute)
+	}
+	qc := c.counts[key]
+	if qc == nil || now.After(qc.expires) {
+		qc = &quotaCount{expires: now.Add(ttl)}
+		c.counts[key] = qc
+	}
+	qc.n++
+	return qc.n, nil
+}
@@ -0,0 +1,101 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingCounter is a QuotaCounter failing all increments.
+type failingCounter struct{}
+
+func (failingCounter) Increment(context.Context, string, time.Duration) (int64, error) {
+	return 0, errors.New("counter down")
+}
+
+func TestRoute_SetQuota(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/users").SetQuota(Quota{Limit: 2, Key: LimitByHeader("X-API-Key")}))
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		pm.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		status    int
+		remaining string
+	}{
+		{"Test first request", "a", http.StatusOK, "1"},
+		{"Test last request", "a", http.StatusOK, "0"},
+		{"Test exceeded quota", "a", http.StatusTooManyRequests, "0"},
+		{"Test other key", "b", http.StatusOK, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.key)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+			assert.Equal(t, tt.remaining, rec.Header().Get("X-RateLimit-Remaining"))
+			reset, err := strconv.Atoi(rec.Header().Get("X-RateLimit-Reset"))
+			assert.NoError(t, err)
+			assert.True(t, reset > 0 && reset <= 86400)
+			if tt.status == http.StatusTooManyRequests {
+				assert.Equal(t, rec.Header().Get("X-RateLimit-Reset"), rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+
+	// the counts survive route changes
+	pm.HandlePath(NewRoute("GET", "/other"))
+	assert.Equal(t, http.StatusTooManyRequests, get("a").Code)
+}
+
+func TestQuotaLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   Quota
+		allowed int
+	}{
+		{"Test shared quota", Quota{Limit: 3, Period: time.Hour}, 3},
+		{"Test failing counter", Quota{Limit: 1, Counter: failingCounter{}}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := QuotaLimiter(tt.quota)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+			allowed := 0
+			for i := 0; i < 5; i++ {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code == http.StatusOK {
+					allowed++
+				}
+			}
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestMemoryQuotaCounter(t *testing.T) {
+	c := NewMemoryQuotaCounter()
+	ctx := context.Background()
+	n, _ := c.Increment(ctx, "a", time.Hour)
+	assert.Equal(t, int64(1), n)
+	n, _ = c.Increment(ctx, "a", time.Hour)
+	assert.Equal(t, int64(2), n)
+	n, _ = c.Increment(ctx, "b", time.Nanosecond)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(time.Millisecond)
+	n, _ = c.Increment(ctx, "b", time.Hour)
+	assert.Equal(t, int64(1), n)
+}
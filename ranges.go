@@ -0,0 +1,186 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteRange is a range of a body.
+type byteRange struct {
+	start, length int64
+}
+
+// contentRange returns the Content-Range header value of the range.
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// localRanges reports whether the route answers Range requests itself, from the full buffered or
+// cached responses.
+func (h *routeHandler) localRanges() bool {
+	return h.cache != nil || h.route.Buffering == BufferingEnabled
+}
+
+// takeRange removes the Range and If-Range headers of a GET request, so the upstream sends the full
+// response, and stores them in the exchange.
+func takeRange(r *http.Request, x *exchange) {
+	if r.Method != http.MethodGet || r.Header.Get("Range") == "" {
+		return
+	}
+	x.rangeHeader, x.ifRange = r.Header.Get("Range"), r.Header.Get("If-Range")
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+}
+
+// applyRange answers the Range header of the exchange from the full response, reading its body within
+// the MaxBufferedResponse size: with 206 partial content holding one range or a multipart/byteranges
+// body, or 416 range not satisfiable. The full response is sent if the If-Range header doesn't match or
+// the ranges can't be served.
+func (pm *ReverseProxyMux) applyRange(res *http.Response, x *exchange) {
+	if res.StatusCode != http.StatusOK || !ifRangeMatches(x.ifRange, res.Header) {
+		return
+	}
+	b, ok := readBody(res, pm.current().MaxBufferedResponse)
+	if !ok {
+		return
+	}
+	size := int64(len(b))
+	ranges, err := parseRange(x.rangeHeader, size)
+	switch {
+	case errors.Is(err, errNoOverlap):
+		res.StatusCode, res.Status = http.StatusRequestedRangeNotSatisfiable, "416 Requested Range Not Satisfiable"
+		res.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		res.Header.Del("Content-Type")
+		setBody(res, nil)
+		return
+	case err != nil || len(ranges) == 0 || sumRanges(ranges) > size:
+		// invalid or excessive ranges are ignored
+		return
+	}
+	TraceFromContext(res.Request.Context()).Add("range", x.rangeHeader)
+	res.StatusCode, res.Status = http.StatusPartialContent, "206 Partial Content"
+	if len(ranges) == 1 {
+		ra := ranges[0]
+		res.Header.Set("Content-Range", ra.contentRange(size))
+		setBody(res, b[ra.start:ra.start+ra.length])
+		return
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	contentType := res.Header.Get("Content-Type")
+	for _, ra := range ranges {
+		part := textproto.MIMEHeader{"Content-Range": {ra.contentRange(size)}}
+		if contentType != "" {
+			part.Set("Content-Type", contentType)
+		}
+		w, _ := mw.CreatePart(part)
+		_, _ = w.Write(b[ra.start : ra.start+ra.length])
+	}
+	_ = mw.Close()
+	res.Header.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	setBody(res, body.Bytes())
+}
+
+// setBody replaces the body of the response.
+func setBody(res *http.Response, b []byte) {
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.TransferEncoding = nil
+	res.Header.Set("Content-Length", strconv.Itoa(len(b)))
+}
+
+// ifRangeMatches reports whether the If-Range header, an entity tag or a date, matches the response.
+// Entity tags are compared strongly.
+func ifRangeMatches(ifRange string, h http.Header) bool {
+	switch {
+	case ifRange == "":
+		return true
+	case strings.HasPrefix(ifRange, `"`):
+		return ifRange == h.Get("ETag")
+	case strings.HasPrefix(ifRange, "W/"):
+		return false
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	return err == nil && lm.Truncate(time.Second).Equal(t)
+}
+
+// errNoOverlap is returned by parseRange if none of the ranges overlap the body.
+var errNoOverlap = errors.New("no range overlaps the body")
+
+// parseRange parses the byte ranges of a Range header, e.g. "bytes=0-99,-100", against the body size.
+// The ranges not overlapping the body are skipped.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+	var ranges []byteRange
+	noOverlap := false
+	for _, ra := range strings.Split(spec, ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		var r byteRange
+		if first == "" {
+			// suffix range of the last bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid range %q", s)
+			}
+			if n = min(n, size); n == 0 {
+				noOverlap = true
+				continue
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid range %q", s)
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, fmt.Errorf("invalid range %q", s)
+				}
+				end = min(end, size-1)
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// sumRanges returns the total length of the ranges.
+func sumRanges(ranges []byteRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.length
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package reverseproxy
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    []byteRange
+		wantErr bool
+	}{
+		{"Test range", "bytes=0-4", []byteRange{{0, 5}}, false},
+		{"Test open range", "bytes=5-", []byteRange{{5, 5}}, false},
+		{"Test suffix range", "bytes=-3", []byteRange{{7, 3}}, false},
+		{"Test long suffix range", "bytes=-30", []byteRange{{0, 10}}, false},
+		{"Test range beyond end", "bytes=8-20", []byteRange{{8, 2}}, false},
+		{"Test multiple ranges", "bytes=0-1, 4-5,20-", []byteRange{{0, 2}, {4, 2}}, false},
+		{"Test no overlap", "bytes=10-", nil, true},
+		{"Test other unit", "items=0-1", nil, true},
+		{"Test reversed range", "bytes=5-1", nil, true},
+		{"Test malformed range", "bytes=a-b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, 10)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRanges(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("Range") != "" {
+			http.Error(w, "range forwarded", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		_, _ = io.WriteString(w, "0123456789")
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/buffered").SetBuffering(true))
+	pm.HandlePath(NewRoute("GET", "/cached").SetCache(Cache{TTL: time.Minute}))
+
+	tests := []struct {
+		name      string
+		target    string
+		header    http.Header
+		wantCode  int
+		wantRange string
+		wantBody  string
+		wantHits  int32
+	}{
+		{"Test full response", "/buffered", nil, http.StatusOK, "", "0123456789", 1},
+		{"Test single range", "/buffered", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "bytes 2-4/10", "234", 1},
+		{"Test suffix range", "/buffered", http.Header{"Range": {"bytes=-2"}}, http.StatusPartialContent, "bytes 8-9/10", "89", 1},
+		{"Test unsatisfiable range", "/buffered", http.Header{"Range": {"bytes=20-"}}, http.StatusRequestedRangeNotSatisfiable, "bytes */10", "", 1},
+		{"Test invalid range", "/buffered", http.Header{"Range": {"lines=1-2"}}, http.StatusOK, "", "0123456789", 1},
+		{"Test matching If-Range", "/buffered", http.Header{"Range": {"bytes=0-0"}, "If-Range": {`"v1"`}}, http.StatusPartialContent, "bytes 0-0/10", "0", 1},
+		{"Test matching If-Range date", "/buffered", http.Header{"Range": {"bytes=0-0"}, "If-Range": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, http.StatusPartialContent, "bytes 0-0/10", "0", 1},
+		{"Test stale If-Range", "/buffered", http.Header{"Range": {"bytes=0-0"}, "If-Range": {`"v0"`}}, http.StatusOK, "", "0123456789", 1},
+		{"Test cached range", "/cached", http.Header{"Range": {"bytes=5-"}}, http.StatusPartialContent, "bytes 5-9/10", "56789", 1},
+		{"Test cached range hit", "/cached", http.Header{"Range": {"bytes=0-1"}}, http.StatusPartialContent, "bytes 0-1/10", "01", 0},
+		{"Test cached full response", "/cached", nil, http.StatusOK, "", "0123456789", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tt.target, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantRange, w.Header().Get("Content-Range"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantHits, hits.Load())
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+			}
+		})
+	}
+}
+
+func TestRanges_Multipart(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "0123456789")
+	}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/buffered").SetBuffering(true))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/buffered", nil)
+	r.Header.Set("Range", "bytes=0-1,-3")
+	pm.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(strings.NewReader(w.Body.String()), params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(p)
+		assert.Equal(t, "text/plain", p.Header.Get("Content-Type"))
+		parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+	}
+	assert.Equal(t, []string{"bytes 0-1/10 01", "bytes 7-9/10 789"}, parts)
+}
@@ -0,0 +1,306 @@
+// Package rawheader provides an HTTP/1.1 transport sending the request headers with a fixed spelling
+// and order, for legacy upstreams which require a header casing, e.g. SOAPAction or X-API-KEY, or
+// expect the headers in a specific order. The net/http server canonicalizes the names of the inbound
+// headers and doesn't keep their order, so the spellings and order are configured:
+//
+//	pm.HandlePath(reverseproxy.NewRoute("POST", "/soap").
+//		SetTransport(&rawheader.Transport{Names: []string{"Host", "SOAPAction", "Content-Type", "Content-Length"}}))
+package rawheader
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxIdleConnsPerHost is the default number of idle connections kept per upstream.
+const DefaultMaxIdleConnsPerHost = 2
+
+// Transport sends HTTP/1.1 requests, writing their headers in the order of Names with their spelling,
+// followed by the other headers sorted by name. The connections are reused for the following requests.
+type Transport struct {
+	// Names holds the header names in the order and spelling they're sent. The Host header is sent
+	// first unless it's listed.
+	Names []string
+	// DialContext dials the connections, a default net.Dialer if nil.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// TLSClientConfig configures the TLS connections of https URLs.
+	TLSClientConfig *tls.Config
+	// MaxIdleConnsPerHost limits the idle connections kept per upstream, DefaultMaxIdleConnsPerHost if
+	// zero, none if negative.
+	MaxIdleConnsPerHost int
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+// conn is a connection to an upstream with its buffered reader.
+type conn struct {
+	net.Conn
+	br  *bufio.Reader
+	key string
+}
+
+// RoundTrip sends the request and returns its response. A request without a body is sent again on a
+// new connection if a reused connection turned out to be closed by the upstream.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+		return nil, fmt.Errorf("rawheader: unsupported scheme %q", r.URL.Scheme)
+	}
+	for {
+		c, reused, err := t.conn(r)
+		if err != nil {
+			return nil, err
+		}
+		res, err := t.send(c, r)
+		if err != nil {
+			_ = c.Close()
+			if reused && (r.Body == nil || r.Body == http.NoBody) && r.Context().Err() == nil {
+				continue
+			}
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// CloseIdleConnections closes the idle connections.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+	for _, conns := range idle {
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	}
+}
+
+// send writes the request to the connection and reads its response.
+func (t *Transport) send(c *conn, r *http.Request) (*http.Response, error) {
+	stop := context.AfterFunc(r.Context(), func() {
+		_ = c.SetDeadline(time.Unix(1, 0))
+	})
+	if err := t.write(c, r); err != nil {
+		stop()
+		return nil, err
+	}
+	res, err := http.ReadResponse(c.br, r)
+	if err != nil {
+		stop()
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	reusable := !res.Close && !r.Close
+	body := &body{ReadCloser: res.Body, done: func(eof bool) {
+		if stop() && eof && reusable {
+			t.put(c)
+			return
+		}
+		_ = c.Close()
+	}}
+	if res.Body == http.NoBody {
+		body.finish(true)
+	} else {
+		res.Body = body
+	}
+	return res, nil
+}
+
+// write writes the request line, the headers and the body.
+func (t *Transport) write(c *conn, r *http.Request) error {
+	w := bufio.NewWriter(c)
+	uri := r.URL.RequestURI()
+	if r.Method == http.MethodConnect {
+		uri = r.URL.Host
+	}
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", r.Method, uri)
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	header.Set("Host", host)
+	hasBody := r.Body != nil && r.Body != http.NoBody
+	chunked := hasBody && r.ContentLength <= 0
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	switch {
+	case chunked:
+		header.Set("Transfer-Encoding", "chunked")
+	case hasBody || r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		header.Set("Content-Length", strconv.FormatInt(max(r.ContentLength, 0), 10))
+	}
+	if r.Close {
+		header.Set("Connection", "close")
+	}
+	names := t.Names
+	if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, "Host") }) {
+		names = append([]string{"Host"}, names...)
+	}
+	for _, name := range names {
+		key := http.CanonicalHeaderKey(name)
+		for _, v := range header[key] {
+			writeHeader(w, name, v)
+		}
+		delete(header, key)
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		for _, v := range header[key] {
+			writeHeader(w, key, v)
+		}
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	if hasBody {
+		var bw io.Writer = w
+		var cw io.WriteCloser
+		if chunked {
+			cw = httputil.NewChunkedWriter(w)
+			bw = cw
+		}
+		_, err := io.Copy(bw, r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return err
+		}
+		if cw != nil {
+			if err := cw.Close(); err != nil {
+				return err
+			}
+			if _, err := w.WriteString("\r\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// writeHeader writes a header line, replacing the line breaks of the value.
+func writeHeader(w *bufio.Writer, name, value string) {
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	_, _ = w.WriteString(name + ": " + strings.TrimSpace(value) + "\r\n")
+}
+
+// conn returns an idle connection to the upstream of the request, or dials a new one.
+func (t *Transport) conn(r *http.Request) (*conn, bool, error) {
+	addr := r.URL.Host
+	if r.URL.Port() == "" {
+		port := "80"
+		if r.URL.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(r.URL.Hostname(), port)
+	}
+	key := r.URL.Scheme + "://" + addr
+
+	t.mu.Lock()
+	if conns := t.idle[key]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		t.idle[key] = conns[:len(conns)-1]
+		t.mu.Unlock()
+		return c, true, nil
+	}
+	t.mu.Unlock()
+
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	nc, err := dial(r.Context(), "tcp", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	if r.URL.Scheme == "https" {
+		cfg := &tls.Config{}
+		if t.TLSClientConfig != nil {
+			cfg = t.TLSClientConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = r.URL.Hostname()
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tc := tls.Client(nc, cfg)
+		if err := tc.HandshakeContext(r.Context()); err != nil {
+			_ = nc.Close()
+			return nil, false, err
+		}
+		nc = tc
+	}
+	return &conn{Conn: nc, br: bufio.NewReader(nc), key: key}, false, nil
+}
+
+// put returns the connection to the idle pool, or closes it if the pool is full.
+func (t *Transport) put(c *conn) {
+	limit := t.MaxIdleConnsPerHost
+	if limit == 0 {
+		limit = DefaultMaxIdleConnsPerHost
+	}
+	_ = c.SetDeadline(time.Time{})
+	t.mu.Lock()
+	if len(t.idle[c.key]) < limit {
+		if t.idle == nil {
+			t.idle = make(map[string][]*conn)
+		}
+		t.idle[c.key] = append(t.idle[c.key], c)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	_ = c.Close()
+}
+
+// body is a response body releasing its connection once it's read or closed.
+type body struct {
+	io.ReadCloser
+	once sync.Once
+	done func(eof bool)
+}
+
+// Read reads the body, releasing the connection at its end.
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.finish(errors.Is(err, io.EOF))
+	}
+	return n, err
+}
+
+// Close closes the body, closing the connection unless the body was read.
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(false)
+	return err
+}
+
+// finish releases the connection once.
+func (b *body) finish(eof bool) {
+	b.once.Do(func() {
+		b.done(eof)
+	})
+}
@@ -0,0 +1,152 @@
+package rawheader
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rawServer answers the requests of a connection with their raw header lines.
+func rawServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				for {
+					var lines []string
+					for {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+						lines = append(lines, strings.TrimSpace(line))
+					}
+					body := strings.Join(lines[1:], "\n")
+					_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTransport_HeaderOrder(t *testing.T) {
+	l := rawServer(t)
+	tests := []struct {
+		name   string
+		names  []string
+		header http.Header
+		want   string
+	}{
+		{
+			"Test listed spelling and order",
+			[]string{"SOAPAction", "X-API-KEY"},
+			http.Header{"X-Api-Key": {"k"}, "Soapaction": {"urn:get"}, "Accept": {"*/*"}},
+			"Host: legacy.test\nSOAPAction: urn:get\nX-API-KEY: k\nAccept: */*",
+		},
+		{
+			"Test listed host",
+			[]string{"Accept", "host"},
+			http.Header{"Accept": {"*/*"}, "X-B": {"2"}, "X-A": {"1"}},
+			"Accept: */*\nhost: legacy.test\nX-A: 1\nX-B: 2",
+		},
+		{
+			"Test unlisted headers",
+			nil,
+			http.Header{"X-B": {"2", "3"}, "X-A": {"1"}},
+			"Host: legacy.test\nX-A: 1\nX-B: 2\nX-B: 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Transport{Names: tt.names}
+			defer tr.CloseIdleConnections()
+			r, _ := http.NewRequest("GET", "http://"+l.Addr().String()+"/", nil)
+			r.Host = "legacy.test"
+			r.Header = tt.header
+			res, err := tr.RoundTrip(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestTransport_RoundTrip(t *testing.T) {
+	var conns atomic.Int32
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+strings.Join(r.TransferEncoding, ",")+" "+string(b))
+	}))
+	origin.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	origin.Start()
+	defer origin.Close()
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr}
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want string
+	}{
+		{"Test GET", func() *http.Request {
+			r, _ := http.NewRequest("GET", origin.URL+"/a?b=1", nil)
+			return r
+		}, "GET /a?b=1  "},
+		{"Test sized body", func() *http.Request {
+			r, _ := http.NewRequest("POST", origin.URL+"/", strings.NewReader("data"))
+			return r
+		}, "POST /  data"},
+		{"Test chunked body", func() *http.Request {
+			r, _ := http.NewRequest("PUT", origin.URL+"/", io.NopCloser(strings.NewReader("stream")))
+			return r
+		}, "PUT / chunked stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Do(tt.req())
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+	assert.Equal(t, int32(1), conns.Load())
+
+	// a connection closed by the upstream is replaced
+	origin.CloseClientConnections()
+	res, err := client.Get(origin.URL + "/again")
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
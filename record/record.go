@@ -0,0 +1,316 @@
+// Package record taps the traffic of a mux, writing sanitized request/response pairs to a Sink for
+// debugging and for later replay in tests. The Recorder is registered as middleware, for all routes
+// with ReverseProxyMux.Use or per route group with ReverseProxyMux.UseGroup:
+//
+//	rec := record.NewRecorder(record.NewWriterSink(f), record.Options{SampleRate: 0.1})
+//	pm.UseGroup("api", rec.Middleware)
+//
+// The entries are written as JSON, one per line by the WriterSink, and read back with Read.
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// DefaultMaxBodySize is the default limit of the recorded body sizes.
+const DefaultMaxBodySize = 64 << 10
+
+// Redacted replaces the values of the redacted headers and query parameters.
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are the headers redacted by default.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Entry is a recorded request/response pair.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Duration is the time until the handler returned.
+	Duration  time.Duration `json:"duration"`
+	RequestID string        `json:"requestId,omitempty"`
+	// Route is the path pattern of the matched route.
+	Route    string   `json:"route,omitempty"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Body is a recorded body. Bodies which aren't valid UTF-8 are encoded as base64 in JSON.
+type Body struct {
+	Data []byte `json:"-"`
+	// Size is the size of the full body, which is larger than the data if it was truncated.
+	Size      int64 `json:"size"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+// bodyJSON is the JSON representation of a Body.
+type bodyJSON struct {
+	Text      *string `json:"text,omitempty"`
+	Base64    []byte  `json:"base64,omitempty"`
+	Size      int64   `json:"size"`
+	Truncated bool    `json:"truncated,omitempty"`
+}
+
+// MarshalJSON encodes the data as text if it's valid UTF-8, else as base64.
+func (b Body) MarshalJSON() ([]byte, error) {
+	j := bodyJSON{Size: b.Size, Truncated: b.Truncated}
+	if utf8.Valid(b.Data) {
+		text := string(b.Data)
+		j.Text = &text
+	} else {
+		j.Base64 = b.Data
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes the body encoded by MarshalJSON.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var j bodyJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	b.Data, b.Size, b.Truncated = j.Base64, j.Size, j.Truncated
+	if j.Text != nil {
+		b.Data = []byte(*j.Text)
+	}
+	return nil
+}
+
+// Options configure a Recorder.
+type Options struct {
+	// SampleRate is the fraction of the requests recorded, between 0 and 1. Zero records all requests.
+	SampleRate float64
+	// MaxBodySize limits the recorded sizes of the request and response bodies, DefaultMaxBodySize if
+	// zero. Larger bodies are truncated, they're still forwarded in full.
+	MaxBodySize int64
+	// RedactHeaders are the headers whose values are replaced by Redacted, DefaultRedactHeaders if nil.
+	RedactHeaders []string
+	// RedactQuery are the query parameters whose values are replaced by Redacted.
+	RedactQuery []string
+	// Filter selects the recorded requests, all if nil.
+	Filter func(r *http.Request) bool
+	// ErrorLog logs the errors of the sink, the standard logger if nil.
+	ErrorLog *log.Logger
+}
+
+// Recorder records the traffic passing its middleware.
+type Recorder struct {
+	sink Sink
+	opts Options
+}
+
+// NewRecorder creates a recorder writing to the sink.
+func NewRecorder(sink Sink, opts Options) *Recorder {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	return &Recorder{sink: sink, opts: opts}
+}
+
+// Middleware returns a handler recording the requests passed to next and their responses.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rec.sampled(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		e := &Entry{
+			Time:      time.Now(),
+			RequestID: proxyctx.RequestID(r.Context()),
+			Request: Request{
+				Method: r.Method,
+				URL:    rec.redactURL(r.URL),
+				Host:   r.Host,
+				Header: rec.redactHeader(r.Header),
+			},
+		}
+		if route, ok := proxyctx.Route(r.Context()); ok {
+			e.Route = route.Path
+		}
+		var reqBody *capture
+		if r.Body != nil && r.Body != http.NoBody {
+			reqBody = &capture{limit: rec.opts.MaxBodySize}
+			r.Body = &teeBody{ReadCloser: r.Body, capture: reqBody}
+		}
+		rw := &responseWriter{ResponseWriter: w, capture: capture{limit: rec.opts.MaxBodySize}}
+		defer func() {
+			e.Duration = time.Since(e.Time)
+			if reqBody != nil {
+				e.Request.Body = reqBody.body()
+			}
+			if rw.status == 0 {
+				rw.status, rw.header = http.StatusOK, w.Header().Clone()
+			}
+			e.Response = Response{Status: rw.status, Header: rec.redactHeader(rw.header), Body: rw.body()}
+			if err := rec.sink.Record(e); err != nil {
+				rec.logf("record: %v", err)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// sampled reports whether the request is recorded.
+func (rec *Recorder) sampled(r *http.Request) bool {
+	if rec.opts.Filter != nil && !rec.opts.Filter(r) {
+		return false
+	}
+	rate := rec.opts.SampleRate
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// redactHeader returns a copy of the header with the redacted header values replaced.
+func (rec *Recorder) redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range rec.opts.RedactHeaders {
+		if values := h.Values(name); len(values) > 0 {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = Redacted
+			}
+			h[http.CanonicalHeaderKey(name)] = redacted
+		}
+	}
+	return h
+}
+
+// redactURL returns the URL with the redacted query parameter values replaced.
+func (rec *Recorder) redactURL(u *url.URL) string {
+	if len(rec.opts.RedactQuery) == 0 || u.RawQuery == "" {
+		return u.String()
+	}
+	q := u.Query()
+	for _, name := range rec.opts.RedactQuery {
+		for i := range q[name] {
+			q[name][i] = Redacted
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+	return redacted.String()
+}
+
+// logf logs an error of the recorder.
+func (rec *Recorder) logf(format string, args ...any) {
+	if rec.opts.ErrorLog != nil {
+		rec.opts.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// capture holds the first bytes of a body within the limit.
+type capture struct {
+	limit int64
+	data  []byte
+	size  int64
+}
+
+// write records the bytes written to the body.
+func (c *capture) write(p []byte) {
+	c.size += int64(len(p))
+	if room := c.limit - int64(len(c.data)); room > 0 {
+		c.data = append(c.data, p[:min(int64(len(p)), room)]...)
+	}
+}
+
+// body returns the recorded body.
+func (c *capture) body() Body {
+	return Body{Data: c.data, Size: c.size, Truncated: c.size > int64(len(c.data))}
+}
+
+// teeBody is a request body recording the bytes read from it.
+type teeBody struct {
+	io.ReadCloser
+	*capture
+}
+
+// Read reads from the body, recording the read bytes.
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.write(p[:n])
+	return n, err
+}
+
+// responseWriter records the status, header and body of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	capture
+	status int
+	header http.Header
+}
+
+// WriteHeader records the status and header of the response.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status, w.header = status, w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the written body bytes.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.capture.write(p[:n])
+	return n, err
+}
+
+// Flush flushes the buffered data of the wrapped writer, if supported.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Read reads the entries written by a WriterSink.
+func Read(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		e := &Entry{}
+		err := dec.Decode(e)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
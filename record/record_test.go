@@ -0,0 +1,95 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRecordTestMux creates a mux recording the requests of the api group to the sink, proxying to an
+// origin echoing the request body.
+func newRecordTestMux(t *testing.T, sink Sink, opts Options) *reverseproxy.ReverseProxyMux {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.Copy(w, r.Body)
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := reverseproxy.New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(reverseproxy.NewRoute("POST", "/users/:id").SetGroup("api"))
+	pm.PassPath("POST", "/other")
+	pm.UseGroup("api", NewRecorder(sink, opts).Middleware)
+	return pm
+}
+
+func post(pm http.Handler, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("X-Request-Id", "req-1")
+	pm.ServeHTTP(w, r)
+	return w
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	pm := newRecordTestMux(t, NewWriterSink(&buf), Options{MaxBodySize: 5, RedactQuery: []string{"key"}})
+
+	w := post(pm, "/users/42?key=k&page=2", "hello world")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+	post(pm, "/other", "not recorded")
+
+	entries, err := Read(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "req-1", e.RequestID)
+	assert.Equal(t, "/users/:id", e.Route)
+	assert.Equal(t, "POST", e.Request.Method)
+	assert.Equal(t, "/users/42?key=REDACTED&page=2", e.Request.URL)
+	assert.Equal(t, Redacted, e.Request.Header.Get("Authorization"))
+	assert.Equal(t, Body{Data: []byte("hello"), Size: 11, Truncated: true}, e.Request.Body)
+	assert.Equal(t, http.StatusCreated, e.Response.Status)
+	assert.Equal(t, "text/plain", e.Response.Header.Get("Content-Type"))
+	assert.Equal(t, Redacted, e.Response.Header.Get("Set-Cookie"))
+	assert.Equal(t, Body{Data: []byte("hello"), Size: 11, Truncated: true}, e.Response.Body)
+}
+
+func TestRecorder_Sampling(t *testing.T) {
+	var n int
+	sink := SinkFunc(func(e *Entry) error {
+		n++
+		return nil
+	})
+	pm := newRecordTestMux(t, sink, Options{SampleRate: 0.5, Filter: func(r *http.Request) bool {
+		return r.URL.Query().Get("skip") == ""
+	}})
+	for i := 0; i < 200; i++ {
+		post(pm, "/users/1", "")
+		post(pm, "/users/1?skip=1", "")
+	}
+	assert.InDelta(t, 100, n, 40)
+}
+
+func TestBody_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	in := &Entry{Request: Request{Body: Body{Data: []byte("text"), Size: 4}}, Response: Response{Body: Body{Data: []byte{0xff, 0x00}, Size: 2}}}
+	assert.NoError(t, sink.Record(in))
+	assert.Contains(t, buf.String(), `"body":{"text":"text","size":4}`)
+	assert.Contains(t, buf.String(), `"body":{"base64":"/wA=","size":2}`)
+
+	entries, err := Read(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, in.Request.Body, entries[0].Request.Body)
+	assert.Equal(t, in.Response.Body, entries[0].Response.Body)
+}
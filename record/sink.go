@@ -0,0 +1,111 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Sink stores the recorded entries. It's called concurrently by the requests.
+type Sink interface {
+	Record(e *Entry) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(e *Entry) error
+
+// Record calls f(e).
+func (f SinkFunc) Record(e *Entry) error {
+	return f(e)
+}
+
+// WriterSink writes the entries to a writer as JSON, one per line.
+type WriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterSink creates a sink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+// Record writes the entry.
+func (s *WriterSink) Record(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+// DirSink writes each entry as a JSON file to a directory per route, e.g. dir/users_id for the route
+// /users/:id. The files are named after the time and sequence of the entries, so they sort in order.
+type DirSink struct {
+	dir string
+	seq atomic.Uint64
+}
+
+// NewDirSink creates a sink writing to the directory, which is created if missing.
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirSink{dir: dir}, nil
+}
+
+// Record writes the entry to a new file.
+func (s *DirSink) Record(e *Entry) error {
+	dir := filepath.Join(s.dir, routeName(e.Route))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%06d.json", e.Time.UTC().Format("20060102T150405.000000000"), s.seq.Add(1))
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
+
+// ReadDir reads the entries written by a DirSink to the directory of a route, in order.
+func ReadDir(dir string) ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// routeName returns a file name of the route pattern, e.g. users_id of /users/:id.
+func routeName(route string) string {
+	var b strings.Builder
+	for _, r := range route {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
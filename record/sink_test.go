@@ -0,0 +1,37 @@
+package record
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewDirSink(dir)
+	assert.NoError(t, err)
+	pm := newRecordTestMux(t, sink, Options{})
+	post(pm, "/users/1", "first")
+	post(pm, "/users/2", "second")
+
+	entries, err := ReadDir(filepath.Join(dir, "users_id"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "first", string(entries[0].Request.Body.Data))
+	assert.Equal(t, "second", string(entries[1].Response.Body.Data))
+	assert.Less(t, time.Duration(0), entries[0].Duration)
+}
+
+func TestRouteName(t *testing.T) {
+	tests := map[string]string{
+		"/users/:id":    "users_id",
+		"/":             "root",
+		"/files/*path":  "files_path",
+		"/v1/some-path": "v1_some-path",
+	}
+	for route, want := range tests {
+		assert.Equal(t, want, routeName(route), route)
+	}
+}
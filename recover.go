@@ -0,0 +1,219 @@
+package reverseproxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+var (
+	// ErrCallbackPanic is wrapped by the errors of user callbacks which panicked, e.g. a ResponseModifier.
+	ErrCallbackPanic = errors.New("callback panicked")
+	// ErrPanic is wrapped by the errors of request handlers which panicked, e.g. a middleware.
+	ErrPanic = errors.New("handler panicked")
+)
+
+// Panic is a panic recovered while serving a request. It wraps ErrPanic for the panics of the request
+// handlers, e.g. a middleware, or ErrCallbackPanic for the panics of the modifiers, and is passed to the
+// ErrorHandler unless the response was already started.
+type Panic struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack holds the program counters of the panicking goroutine from the panic call, see Frames.
+	Stack []uintptr
+	// Started is set if the response was started when the handler panicked. The connection is aborted
+	// then, as the status can't be changed anymore.
+	Started bool
+	kind    error
+	source  string
+}
+
+// newPanic returns the panic of the recovered value, capturing the stack of the panicking goroutine.
+// It must be called by the function deferring the recover.
+func newPanic(kind error, source string, val any) *Panic {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	for i, pc := range pcs {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Name() == "runtime.gopanic" {
+			pcs = pcs[i+1:]
+			break
+		}
+	}
+	return &Panic{Value: val, Stack: pcs, kind: kind, source: source}
+}
+
+// Frames returns the frames of the stack captured from the panic call.
+func (p *Panic) Frames() *runtime.Frames {
+	return runtime.CallersFrames(p.Stack)
+}
+
+// Error returns the message of the panic, without the stack.
+func (p *Panic) Error() string {
+	msg := p.kind.Error() + ": "
+	if p.source != "" {
+		msg += p.source + ": "
+	}
+	return msg + fmt.Sprint(p.Value)
+}
+
+// Unwrap returns ErrPanic or ErrCallbackPanic, and the panic value if it's an error.
+func (p *Panic) Unwrap() []error {
+	if err, ok := p.Value.(error); ok {
+		return []error{p.kind, err}
+	}
+	return []error{p.kind}
+}
+
+// StackTrace formats the stack of the panic like the stack traces of runtime/debug.Stack, one function
+// and file position per frame.
+func (p *Panic) StackTrace() string {
+	var b strings.Builder
+	frames := p.Frames()
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+// PanicHandler is a function reporting the panics recovered while serving the requests, e.g. to an
+// error tracker. It's called before the response is answered, or the connection is aborted.
+type PanicHandler func(r *http.Request, p *Panic)
+
+// ErrorStatus returns the HTTP status code answering a request failed with the error: 504 gateway
+// timeout for upstream timeouts, 413 content too large for request bodies exceeding the limit of an
+// http.MaxBytesReader, 500 internal server error for panics and 502 bad gateway otherwise.
+func ErrorStatus(err error) int {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrUpstreamTimeout):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrCallbackPanic), errors.Is(err, ErrPanic):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// DefaultErrorHandler is the error handler used if the ErrorHandler is nil. It answers the request
+// with the ErrorStatus of the error.
+func DefaultErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	status := ErrorStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// callModifier runs the response modifier, converting a panic into an error wrapping ErrCallbackPanic.
+func callModifier(m ResponseModifier, res *http.Response) (err error) {
+	defer func() {
+		if val := recover(); val != nil {
+			if val == http.ErrAbortHandler {
+				panic(val)
+			}
+			err = newPanic(ErrCallbackPanic, "response modifier", val)
+		}
+	}()
+	return m(res)
+}
+
+// callModifiers runs the response modifiers in order, stopping at the first error.
+func callModifiers(modifiers []ResponseModifier, res *http.Response) error {
+	for _, m := range modifiers {
+		if err := callModifier(m, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callRequestModifier runs the request modifier, converting a panic into an error wrapping ErrCallbackPanic.
+func callRequestModifier(m RequestModifier, r *http.Request) (err error) {
+	defer func() {
+		if val := recover(); val != nil {
+			if val == http.ErrAbortHandler {
+				panic(val)
+			}
+			err = newPanic(ErrCallbackPanic, "request modifier", val)
+		}
+	}()
+	return m(r)
+}
+
+// handleError passes the error to the ErrorHandler. If the ErrorHandler panics, the panic is logged
+// and the request is answered with HTTP 500 internal server error. Without an ErrorHandler, the error
+// is logged and passed to the DefaultErrorHandler.
+func (pm *ReverseProxyMux) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	eh := pm.current().ErrorHandler
+	if eh == nil {
+		pm.logf("%s: %v", describeRequest(r), err)
+		DefaultErrorHandler(w, r, err)
+		return
+	}
+	defer func() {
+		if val := recover(); val != nil {
+			if val == http.ErrAbortHandler {
+				panic(val)
+			}
+			pm.logf("%s: panic in ErrorHandler handling %q: %v", describeRequest(r), err, val)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+	eh(w, r, err)
+}
+
+// handlePanic handles the panics of the handlers recovered by the router outside of the routes, e.g. of
+// the static mounts and the NotFoundHandler.
+func (pm *ReverseProxyMux) handlePanic(w http.ResponseWriter, r *http.Request, val any) {
+	if val == http.ErrAbortHandler {
+		panic(val)
+	}
+	pm.recoverPanic(w, r, newPanic(ErrPanic, "", val))
+}
+
+// recoverPanic reports the panic to the PanicHandler, then passes it to the ErrorHandler. If the
+// response was already started, the panic is logged and the connection aborted instead, so the client
+// sees a truncated response rather than a corrupted one.
+func (pm *ReverseProxyMux) recoverPanic(w http.ResponseWriter, r *http.Request, p *Panic) {
+	TraceFromContext(r.Context()).Add("panic", fmt.Sprint(p.Value))
+	if x := exchangeFrom(r.Context()); x != nil {
+		x.err = p
+	}
+	if ph := pm.current().PanicHandler; ph != nil {
+		ph(r, p)
+	}
+	if p.Started {
+		pm.logf("%s: %v after the response started, aborting", describeRequest(r), p)
+		panic(http.ErrAbortHandler)
+	}
+	pm.handleError(w, r, p)
+}
+
+// logf logs an error message with the ErrorLog or the standard logger.
+func (pm *ReverseProxyMux) logf(format string, args ...any) {
+	if l := pm.current().ErrorLog; l != nil {
+		l.Printf("reverseproxy: "+format, args...)
+		return
+	}
+	log.Printf("reverseproxy: "+format, args...)
+}
+
+// describeRequest describes the request and its route for log messages.
+func describeRequest(r *http.Request) string {
+	desc := r.Method + " " + r.URL.Path
+	if route, ok := proxyctx.Route(r.Context()); ok {
+		desc += " (route " + route.Path
+		if x := exchangeFrom(r.Context()); x != nil && x.operation != "" {
+			desc += ", operation " + x.operation
+		}
+		desc += ")"
+	}
+	return desc
+}
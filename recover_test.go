@@ -0,0 +1,168 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverModifierPanic(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/panic").SetModifyResponse(func(res *http.Response) error {
+		panic("buggy modifier")
+	}))
+
+	w := serve(pm, "GET", "/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w = serve(pm, "GET", "/panic")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.ErrorIs(t, handled, ErrCallbackPanic)
+}
+
+func TestRecoverErrorHandlerPanic(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/fail").SetModifyResponse(func(res *http.Response) error {
+		return ErrRouteNotFound
+	}))
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		panic("buggy error handler")
+	}
+
+	w := serve(pm, "GET", "/fail")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "Internal Server Error\n", w.Body.String())
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Test upstream error", errors.New("connection refused"), http.StatusBadGateway},
+		{"Test upstream timeout", fmt.Errorf("%w: deadline", ErrUpstreamTimeout), http.StatusGatewayTimeout},
+		{"Test callback panic", fmt.Errorf("%w: modifier", ErrCallbackPanic), http.StatusInternalServerError},
+		{"Test handler panic", fmt.Errorf("%w: middleware", ErrPanic), http.StatusInternalServerError},
+		{"Test typed upstream timeout", &ProxyError{Kind: ErrUpstreamTimeout, Err: errors.New("deadline")}, http.StatusGatewayTimeout},
+		{"Test request body too large", &ProxyError{Kind: ErrBodyTooLarge, Err: &http.MaxBytesError{Limit: 10}}, http.StatusRequestEntityTooLarge},
+		{"Test response too large", ErrResponseTooLarge, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ErrorStatus(tt.err))
+		})
+	}
+}
+
+func TestRecoverHandlerPanic(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	var logged bytes.Buffer
+	pm.ErrorLog = log.New(&logged, "", 0)
+	pm.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("buggy middleware")
+		})
+	})
+	pm.PassPath("GET", "/panic")
+
+	w := serve(pm, "GET", "/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "Internal Server Error\n", w.Body.String())
+	assert.Contains(t, logged.String(), "reverseproxy: GET /panic")
+	assert.Contains(t, logged.String(), "buggy middleware")
+}
+
+func TestPanicHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		wantStart bool
+	}{
+		{"Test panic before the response", func(w http.ResponseWriter, r *http.Request) {
+			panic("buggy middleware")
+		}, false},
+		{"Test panic mid-stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "10")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("part"))
+			w.(http.Flusher).Flush()
+			panic("buggy middleware")
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, _ := newStaticTestMux(t)
+			pm.ErrorLog = log.New(io.Discard, "", 0)
+			pm.Use(func(next http.Handler) http.Handler {
+				return tt.handler
+			})
+			pm.PassPath("GET", "/panic")
+			panics := make(chan *Panic, 1)
+			pm.PanicHandler = func(r *http.Request, p *Panic) {
+				panics <- p
+			}
+			var handled error
+			pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+				handled = err
+				DefaultErrorHandler(w, r, err)
+			}
+			srv := httptest.NewServer(pm)
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL + "/panic")
+			assert.NoError(t, err)
+			_, err = io.ReadAll(res.Body)
+			res.Body.Close()
+			recovered := <-panics
+			if assert.NotNil(t, recovered) {
+				assert.Equal(t, "buggy middleware", recovered.Value)
+				assert.Equal(t, tt.wantStart, recovered.Started)
+				frame, _ := recovered.Frames().Next()
+				assert.Contains(t, frame.Function, "TestPanicHandler")
+				assert.Contains(t, recovered.StackTrace(), "recover_test.go")
+			}
+			if tt.wantStart {
+				assert.Error(t, err)
+				assert.Nil(t, handled)
+				return
+			}
+			assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			assert.ErrorIs(t, handled, ErrPanic)
+			assert.Equal(t, recovered, handled)
+		})
+	}
+}
+
+func TestRecoverModifierPanicStack(t *testing.T) {
+	pm, _ := newStaticTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/panic").SetModifyRequest(func(r *http.Request) error {
+		panic(ErrRouteNotFound)
+	}))
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+	}
+
+	serve(pm, "GET", "/panic")
+	var p *Panic
+	if assert.ErrorAs(t, handled, &p) {
+		assert.ErrorIs(t, p, ErrCallbackPanic)
+		assert.ErrorIs(t, p, ErrRouteNotFound)
+		assert.Equal(t, "callback panicked: request modifier: "+ErrRouteNotFound.Error(), p.Error())
+		frame, _ := p.Frames().Next()
+		assert.Contains(t, frame.Function, "TestRecoverModifierPanicStack")
+	}
+}
@@ -0,0 +1,97 @@
+package replay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/record"
+)
+
+// har is the subset of the HAR 1.2 format read by ReadHAR.
+type har struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			// Time is the duration of the request in milliseconds.
+			Time    float64 `json:"time"`
+			Request struct {
+				Method   string      `json:"method"`
+				URL      string      `json:"url"`
+				Headers  []harHeader `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int         `json:"status"`
+				Headers []harHeader `json:"headers"`
+				Content struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ReadHAR reads the entries of a HAR file. The pseudo headers of HTTP/2, e.g. :authority, are skipped.
+func ReadHAR(r io.Reader) ([]*record.Entry, error) {
+	var h har
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, err
+	}
+	entries := make([]*record.Entry, 0, len(h.Log.Entries))
+	for _, he := range h.Log.Entries {
+		e := &record.Entry{
+			Time:     he.StartedDateTime,
+			Duration: time.Duration(he.Time * float64(time.Millisecond)),
+			Request: record.Request{
+				Method: he.Request.Method,
+				URL:    he.Request.URL,
+				Header: harHeaders(he.Request.Headers),
+			},
+			Response: record.Response{
+				Status: he.Response.Status,
+				Header: harHeaders(he.Response.Headers),
+			},
+		}
+		if he.Request.PostData != nil {
+			e.Request.Body = harBody([]byte(he.Request.PostData.Text))
+		}
+		body := []byte(he.Response.Content.Text)
+		if he.Response.Content.Encoding == "base64" {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(he.Response.Content.Text); err != nil {
+				return nil, err
+			}
+		}
+		e.Response.Body = harBody(body)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// harHeaders converts the HAR headers.
+func harHeaders(headers []harHeader) http.Header {
+	h := make(http.Header, len(headers))
+	for _, hh := range headers {
+		if hh.Name == "" || hh.Name[0] == ':' {
+			continue
+		}
+		h.Add(hh.Name, hh.Value)
+	}
+	return h
+}
+
+// harBody converts a HAR body.
+func harBody(b []byte) record.Body {
+	return record.Body{Data: b, Size: int64(len(b))}
+}
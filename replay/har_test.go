@@ -0,0 +1,32 @@
+package replay
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadHAR(t *testing.T) {
+	f, err := os.Open("testdata/session.har")
+	assert.NoError(t, err)
+	defer f.Close()
+	entries, err := ReadHAR(f)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	e := entries[0]
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), e.Time)
+	assert.Equal(t, 12500*time.Microsecond, e.Duration)
+	assert.Equal(t, "https://example.com/users/1?page=2", e.Request.URL)
+	assert.Equal(t, http.Header{"Accept": {"application/json"}}, e.Request.Header)
+	assert.Equal(t, "GET /users/1?page=2", string(e.Response.Body.Data))
+	assert.Equal(t, `{"name":"x"}`, string(entries[1].Request.Body.Data))
+
+	report, err := (&Replayer{Handler: echo, Compare: true}).Run(context.Background(), entries)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Mismatches)
+}
@@ -0,0 +1,263 @@
+// Package replay replays recorded sessions against a mux or an upstream, for load and regression
+// testing. The sessions are read with record.Read or record.ReadDir from the entries written by the
+// record package, or with ReadHAR from HAR files exported by browsers and other tools:
+//
+//	entries, err := record.ReadDir("recordings/users_id")
+//	report, err := (&replay.Replayer{Handler: pm, Speed: 2, Compare: true}).Run(ctx, entries)
+//
+// The request headers and query parameters redacted by the recorder are sent as recorded, unless the
+// Header option replaces them. Truncated request bodies are sent as far as they were recorded.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/record"
+)
+
+// Replayer replays the recorded entries against the Handler, e.g. a mux, or else the upstream at the
+// BaseURL.
+type Replayer struct {
+	// Handler serves the replayed requests in-process.
+	Handler http.Handler
+	// BaseURL is the upstream receiving the replayed requests if Handler is nil. The scheme and host of
+	// the recorded URLs are replaced by it, and its path is prefixed to theirs.
+	BaseURL *url.URL
+	// Client sends the requests to the BaseURL, http.DefaultClient if nil.
+	Client *http.Client
+	// Speed scales the recorded intervals between the requests, e.g. 2 replays twice as fast. Zero sends
+	// the requests as fast as the concurrency allows.
+	Speed float64
+	// Concurrency limits the requests in flight, 1 if zero.
+	Concurrency int
+	// Header is set on all replayed requests, e.g. to replace the redacted credentials.
+	Header http.Header
+	// Compare compares the responses with the recorded ones, reporting the mismatches of the status and
+	// of the bodies which weren't truncated.
+	Compare bool
+}
+
+// Result is the result of a replayed entry.
+type Result struct {
+	Entry    *record.Entry
+	Status   int
+	Duration time.Duration
+	// Err is the error of the request, nil if a response was received.
+	Err error
+	// Mismatch describes how the response differs from the recorded one, empty if it matches or
+	// Compare is disabled.
+	Mismatch string
+}
+
+// Report summarizes a replay.
+type Report struct {
+	// Results holds the results in the order of the entries.
+	Results    []Result
+	Errors     int
+	Mismatches int
+	Duration   time.Duration
+}
+
+// Run replays the entries in the order of their recording times, returning once all responses have
+// been received or the context is done.
+func (rp *Replayer) Run(ctx context.Context, entries []*record.Entry) (*Report, error) {
+	if rp.Handler == nil && rp.BaseURL == nil {
+		return nil, errors.New("replay: no Handler or BaseURL")
+	}
+	entries = append([]*record.Entry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	report := &Report{Results: make([]Result, len(entries))}
+	sem := make(chan struct{}, max(rp.Concurrency, 1))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, e := range entries {
+		if rp.Speed > 0 {
+			offset := time.Duration(float64(e.Time.Sub(entries[0].Time)) / rp.Speed)
+			if err := sleep(ctx, time.Until(start.Add(offset))); err != nil {
+				break
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, e *record.Entry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			report.Results[i] = rp.replay(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+	for i := range report.Results {
+		res := &report.Results[i]
+		if res.Entry == nil {
+			res.Entry, res.Err = entries[i], ctx.Err()
+		}
+		if res.Err != nil {
+			report.Errors++
+		} else if res.Mismatch != "" {
+			report.Mismatches++
+		}
+	}
+	return report, ctx.Err()
+}
+
+// replay sends the request of the entry.
+func (rp *Replayer) replay(ctx context.Context, e *record.Entry) Result {
+	result := Result{Entry: e}
+	r, err := rp.newRequest(ctx, e)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	start := time.Now()
+	var body []byte
+	if rp.Handler != nil {
+		w := newResponseWriter()
+		rp.Handler.ServeHTTP(w, r)
+		result.Status, body = max(w.status, http.StatusOK), w.body.Bytes()
+	} else {
+		client := rp.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		res, err := client.Do(r)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		body, err = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Status = res.StatusCode
+	}
+	result.Duration = time.Since(start)
+	if rp.Compare {
+		result.Mismatch = mismatch(e.Response, result.Status, body)
+	}
+	return result
+}
+
+// newRequest creates the request replaying the entry.
+func (rp *Replayer) newRequest(ctx context.Context, e *record.Entry) (*http.Request, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := e.Request.Host
+	if host == "" {
+		host = u.Host
+	}
+	if rp.Handler != nil {
+		u.Scheme, u.Host = "", ""
+	} else {
+		query := u.RawQuery
+		u = rp.BaseURL.JoinPath(u.Path)
+		u.RawQuery = query
+		host = rp.BaseURL.Host
+	}
+	var body io.Reader
+	if len(e.Request.Body.Data) > 0 {
+		body = bytes.NewReader(e.Request.Body.Data)
+	}
+	r, err := http.NewRequestWithContext(ctx, e.Request.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	r.Host = host
+	if rp.Handler != nil {
+		r.RequestURI = u.RequestURI()
+		r.RemoteAddr = "127.0.0.1:0"
+	}
+	for name, values := range e.Request.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Host", "Content-Length", "Connection", "Transfer-Encoding":
+			continue
+		}
+		r.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	for name, values := range rp.Header {
+		r.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	return r, nil
+}
+
+// mismatch describes how the response differs from the recorded one, empty if it matches.
+func mismatch(recorded record.Response, status int, body []byte) string {
+	if recorded.Status != 0 && recorded.Status != status {
+		return fmt.Sprintf("status %d, recorded %d", status, recorded.Status)
+	}
+	if !recorded.Body.Truncated && !bytes.Equal(recorded.Body.Data, body) {
+		return "body differs"
+	}
+	return ""
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// responseWriter records the status and body of a response served in-process.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: make(http.Header)}
+}
+
+// Header returns the response header.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status of the response.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+}
+
+// Write records the body of the response.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// Flush implements http.Flusher for streaming handlers.
+func (w *responseWriter) Flush() {}
@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-webtech/go-reverse-proxy/record"
+	"github.com/stretchr/testify/assert"
+)
+
+// echo answers the method and request URI, 201 to POST requests.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusCreated)
+	}
+	_, _ = fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+})
+
+func entry(offset time.Duration, method, target string, status int, body string) *record.Entry {
+	return &record.Entry{
+		Time:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Add(offset),
+		Request:  record.Request{Method: method, URL: target, Header: http.Header{"Authorization": {record.Redacted}}},
+		Response: record.Response{Status: status, Body: record.Body{Data: []byte(body), Size: int64(len(body))}},
+	}
+}
+
+func TestReplayer_Run(t *testing.T) {
+	entries := []*record.Entry{
+		entry(100*time.Millisecond, "POST", "/users", http.StatusCreated, "POST /users"),
+		entry(0, "GET", "/users/1?page=2", http.StatusOK, "GET /users/1?page=2"),
+		entry(200*time.Millisecond, "GET", "/users/2", http.StatusOK, "changed"),
+		entry(300*time.Millisecond, "GET", "/users/3", http.StatusNotFound, ""),
+	}
+	upstream := httptest.NewServer(echo)
+	defer upstream.Close()
+	base, _ := url.Parse(upstream.URL + "/v1")
+
+	tests := []struct {
+		name     string
+		replayer *Replayer
+		wantBody string
+	}{
+		{"Test handler", &Replayer{Handler: echo, Compare: true}, "GET /users/1?page=2"},
+		{"Test upstream", &Replayer{BaseURL: base, Concurrency: 4}, "GET /v1/users/1?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := tt.replayer.Run(context.Background(), entries)
+			assert.NoError(t, err)
+			assert.Len(t, report.Results, 4)
+			assert.Equal(t, "/users/1?page=2", report.Results[0].Entry.Request.URL)
+			assert.Equal(t, []int{200, 201, 200, 200}, []int{
+				report.Results[0].Status, report.Results[1].Status, report.Results[2].Status, report.Results[3].Status,
+			})
+			assert.Equal(t, 0, report.Errors)
+			if tt.replayer.Compare {
+				assert.Equal(t, 2, report.Mismatches)
+				assert.Equal(t, "body differs", report.Results[2].Mismatch)
+				assert.Equal(t, "status 200, recorded 404", report.Results[3].Mismatch)
+			} else {
+				assert.Equal(t, 0, report.Mismatches)
+			}
+		})
+	}
+}
+
+func TestReplayer_Header(t *testing.T) {
+	var auth atomic.Value
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+	})
+	rp := &Replayer{Handler: handler, Header: http.Header{"Authorization": {"Bearer replay"}}}
+	_, err := rp.Run(context.Background(), []*record.Entry{entry(0, "GET", "/", 200, "")})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer replay", auth.Load())
+}
+
+func TestReplayer_Speed(t *testing.T) {
+	entries := []*record.Entry{
+		entry(0, "GET", "/a", 200, ""),
+		entry(200*time.Millisecond, "GET", "/b", 200, ""),
+	}
+	report, err := (&Replayer{Handler: echo, Speed: 2}).Run(context.Background(), entries)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, report.Duration, 100*time.Millisecond)
+	assert.Less(t, report.Duration, 200*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err = (&Replayer{Handler: echo, Speed: 1}).Run(ctx, entries)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, report.Errors)
+	assert.ErrorIs(t, report.Results[1].Err, context.DeadlineExceeded)
+}
+
+func TestReplayer_NoTarget(t *testing.T) {
+	_, err := (&Replayer{}).Run(context.Background(), nil)
+	assert.Error(t, err)
+}
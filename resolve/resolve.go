@@ -0,0 +1,255 @@
+// Package resolve provides a dialer resolving the upstream hosts itself instead of relying on the
+// default dialer: with a custom resolver, caching the addresses for a TTL, preferring or restricting
+// the IP family, and balancing the connections across all the A/AAAA records of a host.
+//
+//	d := &resolve.Dialer{TTL: 10 * time.Second, Family: resolve.PreferIPv4}
+//	pm.Transport = d.Transport()
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the default duration the resolved addresses of a host are cached.
+const DefaultTTL = 30 * time.Second
+
+// ErrNoAddress is returned for hosts without an address of the dialed family.
+var ErrNoAddress = errors.New("resolve: no address of the family")
+
+// Family selects the IP addresses dialed.
+type Family int
+
+const (
+	// AnyFamily dials the addresses in the order of the resolver.
+	AnyFamily Family = iota
+	// PreferIPv4 dials the IPv4 addresses before the IPv6 addresses.
+	PreferIPv4
+	// PreferIPv6 dials the IPv6 addresses before the IPv4 addresses.
+	PreferIPv6
+	// IPv4Only dials the IPv4 addresses only.
+	IPv4Only
+	// IPv6Only dials the IPv6 addresses only.
+	IPv6Only
+)
+
+// Resolver is the interface of host resolvers, e.g. *net.Resolver.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// ContextDialer is the interface of connection dialers with context support, e.g. *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Dialer connects to hosts by their resolved IP addresses. The addresses of a host are re-resolved once
+// their TTL elapsed, the stale addresses are used while the resolver fails. Each connection starts with
+// the next address of the host, so the connections are balanced across all its records, falling back
+// to the following addresses when an address can't be dialed.
+type Dialer struct {
+	// Resolver resolves the hosts, net.DefaultResolver if nil. A net.Resolver with PreferGo and a Dial
+	// function queries a custom DNS server.
+	Resolver Resolver
+	// TTL is the duration the addresses are cached, DefaultTTL if zero. The TTLs of the DNS records
+	// aren't exposed by the resolvers.
+	TTL time.Duration
+	// Family selects the dialed addresses, AnyFamily by default.
+	Family Family
+	// Forward dials the resolved addresses, a default net.Dialer if nil.
+	Forward ContextDialer
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host holds the cached addresses of a host.
+type host struct {
+	addrs   []netip.Addr
+	expires time.Time
+	next    int
+}
+
+// DialContext resolves the host of the address and connects to its addresses in turn, returning the
+// first established connection or the error of the last address. Addresses with an IP are dialed as is.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	forward := d.Forward
+	if forward == nil {
+		forward = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	hostname, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(hostname); err == nil {
+		return forward.DialContext(ctx, network, addr)
+	}
+	addrs, err := d.Lookup(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	addrs = filter(addrs, network)
+	if len(addrs) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: ErrNoAddress}
+	}
+	for _, ip := range addrs {
+		conn, dialErr := forward.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = dialErr
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// Lookup returns the addresses of the host in the order they're dialed: starting with the next address
+// of the rotation, with the preferred family first.
+func (d *Dialer) Lookup(ctx context.Context, hostname string) ([]netip.Addr, error) {
+	d.mu.Lock()
+	h, ok := d.hosts[hostname]
+	fresh := ok && time.Now().Before(h.expires)
+	d.mu.Unlock()
+	if !fresh {
+		addrs, err := d.lookup(ctx, hostname)
+		if err != nil && !ok {
+			return nil, err
+		}
+		if err == nil {
+			d.mu.Lock()
+			h = d.store(hostname, addrs)
+			d.mu.Unlock()
+		}
+	}
+
+	d.mu.Lock()
+	next := h.next
+	h.next++
+	addrs := h.addrs
+	d.mu.Unlock()
+	return d.order(addrs, next), nil
+}
+
+// Flush removes the cached addresses, so all hosts are resolved again on their next dial.
+func (d *Dialer) Flush() {
+	d.mu.Lock()
+	clear(d.hosts)
+	d.mu.Unlock()
+}
+
+// Transport returns an HTTP transport with the settings of http.DefaultTransport, which dials the
+// connections with the dialer. The result can be assigned to ReverseProxyMux.Transport, or set per
+// backend with BackendTransport.
+func (d *Dialer) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = d.DialContext
+	return t
+}
+
+// lookup resolves the IP addresses of the host.
+func (d *Dialer) lookup(ctx context.Context, hostname string) ([]netip.Addr, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	network := "ip"
+	switch d.Family {
+	case IPv4Only:
+		network = "ip4"
+	case IPv6Only:
+		network = "ip6"
+	}
+	addrs, err := resolver.LookupNetIP(ctx, network, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true}
+	}
+	for i, ip := range addrs {
+		addrs[i] = ip.Unmap()
+	}
+	return addrs, nil
+}
+
+// store caches the addresses of the host, keeping its rotation counter. The caller must hold d.mu.
+func (d *Dialer) store(hostname string, addrs []netip.Addr) *host {
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if d.hosts == nil {
+		d.hosts = make(map[string]*host)
+	}
+	h, ok := d.hosts[hostname]
+	if !ok {
+		h = &host{}
+		d.hosts[hostname] = h
+	}
+	h.addrs, h.expires = addrs, time.Now().Add(ttl)
+	return h
+}
+
+// order returns the addresses of the preferred family first, each family rotated by next, or all the
+// addresses rotated by next without a preference.
+func (d *Dialer) order(addrs []netip.Addr, next int) []netip.Addr {
+	var want func(netip.Addr) bool
+	switch d.Family {
+	case PreferIPv4, IPv4Only:
+		want = netip.Addr.Is4
+	case PreferIPv6, IPv6Only:
+		want = netip.Addr.Is6
+	default:
+		return rotate(nil, addrs, next)
+	}
+	var preferred, others []netip.Addr
+	for _, ip := range addrs {
+		if want(ip) {
+			preferred = append(preferred, ip)
+		} else {
+			others = append(others, ip)
+		}
+	}
+	ordered := rotate(make([]netip.Addr, 0, len(addrs)), preferred, next)
+	if d.Family == IPv4Only || d.Family == IPv6Only {
+		return ordered
+	}
+	return rotate(ordered, others, next)
+}
+
+// rotate appends the addresses to dst starting with the address at next modulo their number.
+func rotate(dst, addrs []netip.Addr, next int) []netip.Addr {
+	if len(addrs) == 0 {
+		return dst
+	}
+	start := next % len(addrs)
+	dst = append(dst, addrs[start:]...)
+	return append(dst, addrs[:start]...)
+}
+
+// filter returns the addresses of the family of the network, tcp4 or tcp6.
+func filter(addrs []netip.Addr, network string) []netip.Addr {
+	var want func(netip.Addr) bool
+	switch network {
+	case "tcp4", "udp4":
+		want = netip.Addr.Is4
+	case "tcp6", "udp6":
+		want = netip.Addr.Is6
+	default:
+		return addrs
+	}
+	filtered := make([]netip.Addr, 0, len(addrs))
+	for _, ip := range addrs {
+		if want(ip) {
+			filtered = append(filtered, ip)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,139 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	mu      sync.Mutex
+	addrs   map[string][]string
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	var addrs []netip.Addr
+	for _, s := range r.addrs[host] {
+		ip := netip.MustParseAddr(s)
+		if network == "ip" || (network == "ip4") == ip.Is4() {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs, nil
+}
+
+type fakeDialer struct {
+	down   map[string]bool
+	dialed []string
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dialed = append(d.dialed, addr)
+	if d.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	_ = server.Close()
+	return client, nil
+}
+
+func TestDialer_DialContext(t *testing.T) {
+	records := map[string][]string{"origin": {"10.0.0.1", "2001:db8::1", "10.0.0.2"}}
+	tests := []struct {
+		name       string
+		family     Family
+		network    string
+		down       []string
+		dials      int
+		wantDialed []string
+		wantErr    bool
+	}{
+		{"Test rotation", AnyFamily, "tcp", nil, 4, []string{"10.0.0.1:80", "[2001:db8::1]:80", "10.0.0.2:80", "10.0.0.1:80"}, false},
+		{"Test prefer IPv4", PreferIPv4, "tcp", nil, 3, []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80"}, false},
+		{"Test prefer IPv6", PreferIPv6, "tcp", nil, 2, []string{"[2001:db8::1]:80", "[2001:db8::1]:80"}, false},
+		{"Test IPv4 only", IPv4Only, "tcp", nil, 2, []string{"10.0.0.1:80", "10.0.0.2:80"}, false},
+		{"Test tcp6 network", AnyFamily, "tcp6", nil, 1, []string{"[2001:db8::1]:80"}, false},
+		{"Test fallback", AnyFamily, "tcp", []string{"10.0.0.1:80"}, 1, []string{"10.0.0.1:80", "[2001:db8::1]:80"}, false},
+		{"Test all down", IPv4Only, "tcp", []string{"10.0.0.1:80", "10.0.0.2:80"}, 1, []string{"10.0.0.1:80", "10.0.0.2:80"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forward := &fakeDialer{down: make(map[string]bool)}
+			for _, addr := range tt.down {
+				forward.down[addr] = true
+			}
+			d := &Dialer{Resolver: &fakeResolver{addrs: records}, Family: tt.family, Forward: forward}
+			var err error
+			for i := 0; i < tt.dials; i++ {
+				var conn net.Conn
+				conn, err = d.DialContext(context.Background(), tt.network, "origin:80")
+				if conn != nil {
+					_ = conn.Close()
+				}
+			}
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantDialed, forward.dialed)
+		})
+	}
+}
+
+func TestDialer_Refresh(t *testing.T) {
+	resolver := &fakeResolver{addrs: map[string][]string{"origin": {"10.0.0.1"}}}
+	d := &Dialer{Resolver: resolver, TTL: 20 * time.Millisecond}
+	lookup := func() []netip.Addr {
+		addrs, err := d.Lookup(context.Background(), "origin")
+		assert.NoError(t, err)
+		return addrs
+	}
+
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")}, lookup())
+	resolver.addrs["origin"] = []string{"10.0.0.2"}
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")}, lookup())
+	assert.Equal(t, 1, resolver.lookups)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2")}, lookup())
+
+	// the stale addresses are used while the resolver fails
+	resolver.err = errors.New("server misbehaving")
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2")}, lookup())
+	assert.Equal(t, 3, resolver.lookups)
+
+	d.Flush()
+	_, err := d.Lookup(context.Background(), "origin")
+	assert.ErrorIs(t, err, resolver.err)
+}
+
+func TestDialer_Transport(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer origin.Close()
+	_, port, _ := net.SplitHostPort(origin.Listener.Addr().String())
+
+	d := &Dialer{Resolver: &fakeResolver{addrs: map[string][]string{"origin.internal": {"127.0.0.1"}}}}
+	client := &http.Client{Transport: d.Transport()}
+	res, err := client.Get("http://origin.internal:" + port + "/")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "origin.internal:"+port, string(body))
+}
@@ -4,24 +4,31 @@
 package reverseproxy
 
 import (
-	"fmt"
+	"context"
+	"log"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/haoxins/rewrite"
 	"github.com/julienschmidt/httprouter"
 	"github.com/open-webtech/go-reverse-proxy/health"
-	httputilx "github.com/open-webtech/go-reverse-proxy/httputil"
 )
 
 // ResponseModifier is a function that modifies the HTTP response.
 type ResponseModifier func(*http.Response) error
 
+// RequestModifier is a function that modifies the outbound HTTP request before it's forwarded.
+type RequestModifier func(*http.Request) error
+
 // ResponseModifierMap is a map of [method][path]ResponseModifier.
+//
+// Deprecated: the response modifiers are held by the route handlers, the map is no longer used.
 type ResponseModifierMap map[string]map[string]ResponseModifier
 
 // HttpErrorHandler is a function that handles errors occurring in HTTP request handlers.
@@ -29,99 +36,183 @@ type HttpErrorHandler func(http.ResponseWriter, *http.Request, error)
 
 // ReverseProxyMux is a reverse proxy with a request path multiplexer.
 type ReverseProxyMux struct {
-	proxy     *httputil.ReverseProxy
-	remote    *url.URL
-	router    *httprouter.Router
-	modifiers ResponseModifierMap
-	health    *health.HealthCheck
-	load      int32
-
-	Transport               http.RoundTripper
-	RequestHeader           http.Header
-	ModifyResponse          ResponseModifier
-	ErrorHandler            HttpErrorHandler
+	proxy         *httputil.ReverseProxy
+	backends      atomic.Pointer[[]*Backend]
+	roundRobin    Balancer
+	healthMu      sync.Mutex
+	healthCheck   func(addr *url.URL) bool
+	healthPeriod  time.Duration
+	healthOpts    []health.Option
+	table         atomic.Pointer[routeTable]
+	fallback      http.Handler
+	mu            sync.Mutex
+	routes        []Route
+	mounts        []mount
+	groups        map[string]*groupGate
+	groupsMu      sync.Mutex
+	load          int32
+	draining      atomic.Bool
+	maintenance   atomic.Bool
+	metricsHooks  atomic.Pointer[[]MetricsHook]
+	traceNets     atomic.Pointer[[]netip.Prefix]
+	middleware    []Middleware
+	groupMws      map[string][]Middleware
+	modifiers     []ResponseModifier
+	routerHooks   []func(*httprouter.Router)
+	directorWraps []func(Director) Director
+	director      atomic.Pointer[Director]
+	selector      atomic.Pointer[UpstreamSelector]
+	selected      selectedBackends
+	settings      atomic.Pointer[settings]
+	frozen        bool
+	freezeOnNew   bool
+	routerOpts    RouterOptions
+	stats         *statsCollector
+
+	Transport      http.RoundTripper
+	RequestHeader  http.Header
+	ModifyRequest  RequestModifier
+	ModifyResponse ResponseModifier
+	// ErrorHandler handles the errors of the proxied requests, DefaultErrorHandler if nil.
+	ErrorHandler HttpErrorHandler
+	// PanicHandler reports the panics recovered while serving the requests with their stack, see Panic.
+	PanicHandler PanicHandler
+	// ErrorLog logs the errors not passed to an ErrorHandler, the standard logger if nil.
+	ErrorLog *log.Logger
+	// NotFoundHandler and MethodNotAllowedHandler answer the requests matching no route, unless a route
+	// overrides them, see Route.SetNotFoundHandler. NegotiatedError answers them if nil.
 	NotFoundHandler         http.Handler
 	MethodNotAllowedHandler http.Handler
+	MaintenanceHandler      http.Handler
+	// MaxBufferedResponse limits the body size of the buffered responses, zero means unlimited.
+	// Larger responses are passed to the ErrorHandler as ErrResponseTooLarge.
+	MaxBufferedResponse int64
+	// MaxBufferedRequest limits the body size of the buffered requests, see ExpectBuffer, zero means
+	// unlimited. Larger requests are answered with HTTP 413 content too large.
+	MaxBufferedRequest int64
+	// UpstreamTimeout limits the duration of the upstream requests including the response body, zero
+	// means unlimited. Requests timing out before the response headers are answered with HTTP 504.
+	UpstreamTimeout time.Duration
+	// PartialResponse defines how responses failing mid-body are ended.
+	PartialResponse PartialResponsePolicy
+	// Balancer distributes the requests among the backends added with AddBackend, RoundRobin if nil.
+	Balancer Balancer
+	// LoadShedding rejects low-priority requests under load, it's disabled if nil.
+	LoadShedding *LoadShedding
+	// SlowClient aborts the responses of clients stalling to read them, it's disabled if nil.
+	SlowClient *SlowClient
+	// ResponseHeaderPolicy filters the headers of the upstream responses of all routes, before the
+	// policies of the routes.
+	ResponseHeaderPolicy *HeaderPolicy
+	// Via is the pseudonym identifying the proxy in the Via headers of the outbound requests and the
+	// responses, e.g. its host name, the headers are left as is if empty. Requests whose Via header
+	// already has an entry of the pseudonym are answered with HTTP 508 loop detected.
+	Via string
+	// StatusRewrites map the status codes of the upstream responses of all routes, after the rules of
+	// the routes, see Route.AddStatusRewrite.
+	StatusRewrites []StatusRewrite
+	// Connect tunnels the CONNECT requests to the destinations of its ACL, through the middleware of
+	// the mux and the ConnectGroup. CONNECT requests are routed like other requests if nil.
+	Connect *ConnectTunnel
+	// BaseContext holds the values visible to all requests, e.g. a logger, like the BaseContext of an
+	// http.Server. Its cancellation cancels the in-flight requests and their upstream requests, e.g. on
+	// shutdown.
+	BaseContext context.Context
+	// RequestContext derives the context of each request, like the ConnContext of an http.Server, e.g.
+	// to store values for the middleware, modifiers and error handler. It's called before routing, with
+	// the request ID and client IP stored in the context. The returned context must be derived from the
+	// passed one, so client disconnects still cancel the upstream requests.
+	RequestContext func(ctx context.Context, r *http.Request) context.Context
 }
 
-// New creates a new ReverseProxyMux with the specified remote URL.
-func New(remote string) (*ReverseProxyMux, error) {
+// New creates a new ReverseProxyMux with the specified remote URL, applying the options in order.
+func New(remote string, opts ...Option) (*ReverseProxyMux, error) {
 	remoteUrl, err := url.Parse(remote)
 	if err != nil {
 		return nil, err
 	}
-	pm := &ReverseProxyMux{
-		proxy:     httputil.NewSingleHostReverseProxy(remoteUrl),
-		remote:    remoteUrl,
-		router:    httprouter.New(),
-		modifiers: make(ResponseModifierMap),
-		health:    health.NewHealthCheck(remoteUrl),
+	pm := newMux()
+	backends := []*Backend{pm.newBackend(remoteUrl)}
+	pm.backends.Store(&backends)
+	// the empty table can't have conflicting routes
+	table, _ := pm.buildTable(nil, nil)
+	pm.table.Store(table)
+	for _, opt := range opts {
+		if err := opt(pm); err != nil {
+			return nil, err
+		}
+	}
+	if pm.freezeOnNew {
+		pm.Freeze()
 	}
 	return pm, nil
 }
 
+// newMux creates a mux without backends and routes.
+func newMux() *ReverseProxyMux {
+	pm := &ReverseProxyMux{
+		roundRobin: RoundRobin(),
+		routerOpts: RouterOptions{RedirectTrailingSlash: true, RedirectFixedPath: true},
+	}
+	pm.proxy = &httputil.ReverseProxy{
+		Director:       pm.directOutbound,
+		Transport:      roundTripperFunc(pm.roundTrip),
+		ModifyResponse: pm.modifyResponse,
+		ErrorHandler:   pm.upstreamError,
+	}
+	return pm
+}
+
 // ServeHTTP handles the HTTP request.
 func (pm *ReverseProxyMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	atomic.AddInt32(&pm.load, 1)
 	defer atomic.AddInt32(&pm.load, -1)
 
-	pm.proxy.ModifyResponse = func(r *http.Response) error {
-		if pm.ModifyResponse != nil {
-			if err := pm.ModifyResponse(r); err != nil {
-				return err
-			}
-		}
-		if modifier, ok := pm.modifiers[r.Request.Method][r.Request.URL.Path]; ok {
-			if err := modifier(r); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	if pm.Transport != nil {
-		pm.proxy.Transport = pm.Transport
+	r = withRequestState(r)
+	r, release := pm.withContextHooks(r)
+	defer release()
+	if tw, tr := pm.startTrace(w, r); tw != nil {
+		defer tw.finish()
+		w, r = tw, tr
 	}
 
-	pm.router.NotFound = pm.NotFoundHandler
-	pm.router.MethodNotAllowed = pm.MethodNotAllowedHandler
-
-	if pm.ErrorHandler != nil {
-		pm.proxy.ErrorHandler = pm.ErrorHandler
-		pm.router.PanicHandler = func(w http.ResponseWriter, r *http.Request, val any) {
-			pm.ErrorHandler(w, r, fmt.Errorf("%v", val))
-		}
+	if pm.InMaintenance() {
+		TraceFromContext(r.Context()).Add("maintenance", "enabled")
+		pm.serveUnavailable(w, r, pm.current().MaintenanceHandler)
+		return
 	}
 
-	pm.router.ServeHTTP(w, r)
+	table := pm.table.Load()
+	if r.Method == http.MethodConnect && pm.current().Connect != nil {
+		table.connect.ServeHTTP(w, r)
+		return
+	}
+	table.router.ServeHTTP(w, r)
 }
 
-// HandlePath registers a route.
+// HandlePath registers a route. It panics if the route conflicts with a registered route,
+// use AddRoute to get the error instead.
 func (pm *ReverseProxyMux) HandlePath(route Route) *ReverseProxyMux {
+	if err := pm.AddRoute(route); err != nil {
+		panic(err)
+	}
+	return pm
+}
+
+// registerRoute registers the handler of the route for its methods, and in lower case in the fold
+// router of the case-insensitive matching, if not nil. The caller must hold pm.mu.
+func (pm *ReverseProxyMux) registerRoute(router, fold *httprouter.Router, route Route) (http.Handler, error) {
+	h, err := pm.newRouteHandler(route)
+	if err != nil {
+		return nil, err
+	}
 	for _, method := range route.Method {
-		pm.router.HandlerFunc(method, route.Path, func(w http.ResponseWriter, r *http.Request) {
-			r.Header.Set("X-Forwarded-Proto", r.URL.Scheme)
-			r.Header.Set("X-Forwarded-Host", r.Host)
-			r.Host = pm.remote.Host
-			if route.RewritePath != "" {
-				rewriter, err := rewrite.NewRule(route.Path, route.RewritePath)
-				if err != nil {
-					pm.ErrorHandler(w, r, err)
-					return
-				}
-				rewriter.Rewrite(r)
-			}
-			httputilx.MergeRequestHeaders(r, pm.RequestHeader, route.RequestHeader)
-
-			pm.proxy.ServeHTTP(w, r)
-		})
-		if route.ModifyResponse != nil {
-			if pm.modifiers[method] == nil {
-				pm.modifiers[method] = make(map[string]ResponseModifier)
-			}
-			pm.modifiers[method][route.Path] = route.ModifyResponse
+		router.Handler(method, route.Path, h)
+		if fold != nil {
+			fold.Handle(method, lowerASCII(route.Path), foldHandle(route, h))
 		}
 	}
-	return pm
+	return h, nil
 }
 
 // PassPath registers a path with the specified HTTP methods.
@@ -157,14 +248,73 @@ func (pm *ReverseProxyMux) RewritePath(methods, sourcePath, targetPath string) *
 	return pm.HandlePath(route)
 }
 
-// IsAvailable returns whether the proxy origin was successfully connected at the last check time.
+// Remote returns the URL of the first backend of the pool. It's the origin passed to New, unless that
+// backend was removed with RemoveBackend.
+func (pm *ReverseProxyMux) Remote() *url.URL {
+	return pm.Backends()[0].URL()
+}
+
+// Drain stops forwarding new requests to the proxy origin, while the requests being served are completed.
+// The drained routes are answered with HTTP 503 service unavailable until Undrain is called.
+func (pm *ReverseProxyMux) Drain() {
+	pm.draining.Store(true)
+}
+
+// Undrain resumes forwarding requests to the proxy origin.
+func (pm *ReverseProxyMux) Undrain() {
+	pm.draining.Store(false)
+}
+
+// IsDraining returns whether the proxy origin is drained.
+func (pm *ReverseProxyMux) IsDraining() bool {
+	return pm.draining.Load()
+}
+
+// SetMaintenance toggles the maintenance mode, in which all requests are answered by the MaintenanceHandler
+// or with HTTP 503 service unavailable.
+func (pm *ReverseProxyMux) SetMaintenance(enabled bool) {
+	pm.maintenance.Store(enabled)
+}
+
+// InMaintenance returns whether the maintenance mode is enabled.
+func (pm *ReverseProxyMux) InMaintenance() bool {
+	return pm.maintenance.Load()
+}
+
+// serveUnavailable replies to the request with the passed handler or an HTTP 503 service unavailable error.
+func (pm *ReverseProxyMux) serveUnavailable(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	if h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// IsAvailable returns whether a backend of the pool was successfully connected at the last check time.
 func (p *ReverseProxyMux) IsAvailable() bool {
-	return p.health.IsAvailable()
+	return slices.ContainsFunc(p.Backends(), (*Backend).IsAvailable)
 }
 
-// SetHealthCheckFunc sets the passed check func as the algorithm of checking the origin availability
+// SetHealthCheckFunc sets the passed check func as the algorithm of checking the availability of the
+// backends of the pool and of the selected upstreams, including the ones added later.
 func (p *ReverseProxyMux) SetHealthCheckFunc(check func(addr *url.URL) bool, period time.Duration) {
-	p.health.SetCheckFunc(check, period)
+	p.healthMu.Lock()
+	p.healthCheck, p.healthPeriod = check, period
+	p.healthMu.Unlock()
+	for _, b := range append(p.Backends(), p.SelectedBackends()...) {
+		b.health.SetCheckFunc(check, period)
+	}
+}
+
+// SetHealthCheckOptions sets the options of the health checks of the backends of the pool and of the
+// selected upstreams, including the ones added later, e.g. the failure thresholds.
+func (p *ReverseProxyMux) SetHealthCheckOptions(opts ...health.Option) {
+	p.healthMu.Lock()
+	p.healthOpts = append(p.healthOpts, opts...)
+	p.healthMu.Unlock()
+	for _, b := range append(p.Backends(), p.SelectedBackends()...) {
+		b.health.SetOptions(opts...)
+	}
 }
 
 // GetLoad returns the number of requests being served by the proxy at the moment
@@ -0,0 +1,120 @@
+package reverseproxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// RewriteTarget is the part of the outbound request rewritten by a RewriteRule.
+type RewriteTarget int
+
+const (
+	// RewriteTargetPath rewrites the request path.
+	RewriteTargetPath RewriteTarget = iota
+	// RewriteTargetQuery rewrites the raw query string.
+	RewriteTargetQuery
+	// RewriteTargetHost rewrites the Host header sent upstream, matching the inbound host.
+	RewriteTargetHost
+)
+
+// String returns the name of the rewrite target.
+func (t RewriteTarget) String() string {
+	switch t {
+	case RewriteTargetQuery:
+		return "query"
+	case RewriteTargetHost:
+		return "host"
+	default:
+		return "path"
+	}
+}
+
+// RewriteRule rewrites a part of the outbound request matching a regular expression to the replacement,
+// which may reference capture groups as $1 or ${name}. The rules of a route are evaluated in order, and
+// the first matching rule ends the evaluation unless it's marked to continue.
+type RewriteRule struct {
+	Target      RewriteTarget
+	Pattern     string
+	Replacement string
+	// Continue evaluates the next rules after the rule matched.
+	Continue bool
+}
+
+// regexRewriter is a compiled rewrite rule.
+type regexRewriter struct {
+	rule RewriteRule
+	re   *regexp.Regexp
+}
+
+// newRewriteChain compiles the regex rewrite and the rewrite rules of the route in order, or returns
+// nil if the route has none.
+func newRewriteChain(route Route) ([]*regexRewriter, error) {
+	rules := route.Rewrites
+	if route.RewriteRegex != "" {
+		rules = append([]RewriteRule{{
+			Pattern:     route.RewriteRegex,
+			Replacement: route.RewriteReplacement,
+			Continue:    true,
+		}}, rules...)
+	}
+	var chain []*regexRewriter
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite regex: %w", err)
+		}
+		chain = append(chain, &regexRewriter{rule: rule, re: re})
+	}
+	return chain, nil
+}
+
+// rewrite applies the rule to the request, given its inbound host. It reports whether the rule matched.
+func (rw *regexRewriter) rewrite(r *http.Request, host string) bool {
+	switch rw.rule.Target {
+	case RewriteTargetQuery:
+		if !rw.re.MatchString(r.URL.RawQuery) {
+			return false
+		}
+		r.URL.RawQuery = rw.re.ReplaceAllString(r.URL.RawQuery, rw.rule.Replacement)
+	case RewriteTargetHost:
+		if !rw.re.MatchString(host) {
+			return false
+		}
+		r.Host = rw.re.ReplaceAllString(host, rw.rule.Replacement)
+	default:
+		if !rw.re.MatchString(r.URL.Path) {
+			return false
+		}
+		r.URL.Path = rw.re.ReplaceAllString(r.URL.Path, rw.rule.Replacement)
+		r.URL.RawPath = ""
+	}
+	return true
+}
+
+// applyRewrites evaluates the rewrite chain on the request, given its inbound host, tracing the
+// matching rules.
+func applyRewrites(chain []*regexRewriter, r *http.Request, host string, trace *Trace) {
+	for _, rw := range chain {
+		before := rw.value(r)
+		if !rw.rewrite(r, host) {
+			continue
+		}
+		trace.Add("rewrite", rw.rule.Target.String()+" "+before+" -> "+rw.value(r))
+		if !rw.rule.Continue {
+			return
+		}
+	}
+}
+
+// value returns the part of the request rewritten by the rule.
+func (rw *regexRewriter) value(r *http.Request) string {
+	switch rw.rule.Target {
+	case RewriteTargetQuery:
+		return r.URL.RawQuery
+	case RewriteTargetHost:
+		return r.Host
+	default:
+		return r.URL.Path
+	}
+}
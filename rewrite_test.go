@@ -0,0 +1,80 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_SetRewriteRegex(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.HandlePath(NewRoute("GET", "/old/*path").SetRewriteRegex(`^/old/(\d+)$`, "/new/$1"))
+	pm.HandlePath(NewRoute("GET", "/users/:id/*rest").SetRewriteRegex(`^/users/(?P<id>[^/]+)/(?P<rest>.*)$`, "/v2/${rest}/${id}"))
+
+	tests := []struct {
+		name     string
+		target   string
+		wantBody string
+	}{
+		{"Test matching path", "/old/42", " /new/42 "},
+		{"Test non-matching path", "/old/abc", " /old/abc "},
+		{"Test named groups", "/users/7/posts", " /v2/posts/7 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestRoute_SetRewriteRegex_Invalid(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	err := pm.AddRoute(NewRoute("GET", "/old/*path").SetRewriteRegex(`^/old/(\d+$`, "/new/$1"))
+	assert.ErrorContains(t, err, "invalid rewrite regex")
+	assert.Empty(t, pm.Routes())
+}
+
+func TestRoute_AddRewrite(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+" "+r.URL.RequestURI())
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/v1/*path").
+		AddRewrite(RewriteRule{Pattern: `^/v1/`, Replacement: "/v2/", Continue: true}).
+		AddRewrite(RewriteRule{Target: RewriteTargetQuery, Pattern: `(^|&)limit=`, Replacement: "${1}size="}).
+		AddRewrite(RewriteRule{Pattern: `^/v2/`, Replacement: "/v3/"}))
+	pm.HandlePath(NewRoute("GET", "/tenant").
+		AddRewrite(RewriteRule{Target: RewriteTargetHost, Pattern: `^(\w+)\.example\.com$`, Replacement: "$1.internal"}))
+
+	tests := []struct {
+		name     string
+		host     string
+		target   string
+		wantBody string
+	}{
+		{"Test continue and first match", "", "/v1/users?limit=5", "/v2/users?size=5"},
+		{"Test fall through to next rule", "", "/v1/users?page=2", "/v3/users?page=2"},
+		{"Test host rule", "acme.example.com", "/tenant", "acme.internal /tenant"},
+		{"Test host rule not matching", "acme.example.org", "/tenant", strings.TrimPrefix(origin.URL, "http://") + " /tenant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.True(t, strings.HasSuffix(w.Body.String(), tt.wantBody), w.Body.String())
+		})
+	}
+}
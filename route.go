@@ -2,7 +2,21 @@ package reverseproxy
 
 import (
 	"net/http"
+	"slices"
 	"strings"
+	"time"
+)
+
+// HostMode defines the Host header of the requests forwarded by a route.
+type HostMode int
+
+const (
+	// HostUpstream sends the host of the backend, the default.
+	HostUpstream HostMode = iota
+	// HostPreserve sends the Host header of the inbound request, e.g. for upstreams serving virtual hosts.
+	HostPreserve
+	// HostCustom sends the Host of the route.
+	HostCustom
 )
 
 type Route struct {
@@ -10,7 +24,61 @@ type Route struct {
 	Path           string
 	RewritePath    string
 	RequestHeader  http.Header
+	ModifyRequest  RequestModifier
 	ModifyResponse ResponseModifier
+	Group          string
+	Buffering      BufferingMode
+	Decompression  *Decompression
+	HedgeDelay     time.Duration
+	Priority       int
+	Queue          *Queue
+	Quota          *Quota
+	Coalesce       bool
+	Cache          *Cache
+	ETag           ETagMode
+	// Upload observes the forwarding of the request bodies, see SetUploadProgress.
+	Upload *UploadProgress
+	// Expect defines the handling of the Expect: 100-continue header, see SetExpect.
+	Expect ExpectMode
+	// StatusRewrites map the status codes of the upstream responses, see AddStatusRewrite.
+	StatusRewrites []StatusRewrite
+	// Director takes over the outbound requests once they're directed to the backend, see SetDirector.
+	Director Director
+	// NotFound and MethodNotAllowed answer the unmatched requests under the path of the route, see
+	// SetNotFoundHandler and SetMethodNotAllowedHandler.
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+	// Modifiers is the chain of response modifiers run after ModifyResponse, see AppendModifier.
+	Modifiers []ResponseModifier
+	// ModifyTrailer is called with the response once its body was read, see SetModifyTrailer.
+	ModifyTrailer ResponseModifier
+	// Idempotency deduplicates the requests by their Idempotency-Key header, see SetIdempotency.
+	Idempotency *Idempotency
+	// Transport sends the outbound requests, see SetTransport.
+	Transport http.RoundTripper
+	// TLS configures the connections to the upstream, see SetUpstreamTLS.
+	TLS *UpstreamTLS
+	// ResponseHeaders filters the headers of the upstream responses, see SetResponseHeaderPolicy.
+	ResponseHeaders *HeaderPolicy
+	// Signer signs the outbound requests, see SetSigner.
+	Signer RequestSigner
+	// Stub is the response answered without contacting the upstream, see SetStubResponse.
+	Stub *Stub
+	// RewriteRegex is a regular expression rewriting the request path to the RewriteReplacement.
+	RewriteRegex       string
+	RewriteReplacement string
+	// Rewrites is the chain of rewrite rules of the request, applied after the other rewrites.
+	Rewrites []RewriteRule
+	HostMode HostMode
+	Host     string
+	// Prefix is the path prefix mapped to the UpstreamPrefix, see MountPrefix.
+	Prefix         string
+	UpstreamPrefix string
+
+	// queue is the queue of the Queue created by SetQueue, shared by the handlers of the route.
+	queue *routeQueue
+	// tls is the transport of the TLS configuration, set when the route is registered.
+	tls *routeTLS
 }
 
 func NewRoute(methods, path string) Route {
@@ -25,16 +93,265 @@ func (r Route) SetRewritePath(path string) Route {
 	return r
 }
 
+// SetRewriteRegex rewrites the request paths matching the regular expression to the replacement,
+// which may reference capture groups as $1 or ${name}, e.g. SetRewriteRegex(`^/old/(\d+)$`, "/new/$1").
+// It's applied after the RewritePath, before the rewrite rules. Invalid expressions are rejected by
+// AddRoute.
+func (r Route) SetRewriteRegex(pattern, replacement string) Route {
+	r.RewriteRegex = pattern
+	r.RewriteReplacement = replacement
+	return r
+}
+
+// AddRewrite appends a rule to the rewrite chain of the route, see RewriteRule. The rules are applied
+// after the other rewrites, in the order they were added.
+func (r Route) AddRewrite(rule RewriteRule) Route {
+	r.Rewrites = append(slices.Clone(r.Rewrites), rule)
+	return r
+}
+
+// SetPreserveHost sets whether the Host header of the inbound requests is forwarded, instead of the host
+// of the backend.
+func (r Route) SetPreserveHost(enabled bool) Route {
+	r.HostMode, r.Host = HostUpstream, ""
+	if enabled {
+		r.HostMode = HostPreserve
+	}
+	return r
+}
+
+// SetHost sets the Host header of the forwarded requests, instead of the host of the backend.
+func (r Route) SetHost(host string) Route {
+	r.HostMode, r.Host = HostCustom, host
+	return r
+}
+
 func (r Route) SetRequestHeader(header http.Header) Route {
 	r.RequestHeader = header
 	return r
 }
 
+// SetModifyRequest sets the modifier of the requests of the route, run after the request modifier of
+// the mux, once the path is rewritten and the request headers are set.
+func (r Route) SetModifyRequest(modifier RequestModifier) Route {
+	r.ModifyRequest = modifier
+	return r
+}
+
 func (r Route) SetModifyResponse(modifier ResponseModifier) Route {
 	r.ModifyResponse = modifier
 	return r
 }
 
+// AppendModifier appends modifiers to the response modifier chain of the route. They run after the
+// ModifyResponse of the route, in the order they were appended, see ReverseProxyMux.AppendModifier.
+func (r Route) AppendModifier(modifiers ...ResponseModifier) Route {
+	r.Modifiers = append(slices.Clone(r.Modifiers), modifiers...)
+	return r
+}
+
+// AddStatusRewrite appends a rule mapping a status code of the upstream responses, see StatusRewrite.
+// The rules of the route take precedence over the StatusRewrites of the mux, the first matching rule
+// applies. The status is rewritten before the response modifiers run.
+func (r Route) AddStatusRewrite(rule StatusRewrite) Route {
+	r.StatusRewrites = append(slices.Clone(r.StatusRewrites), rule)
+	return r
+}
+
+// SetDirector sets a director taking complete control over the outbound requests of the route. It runs
+// after the built-in rewrites, the request headers, the request modifiers and the direction to the
+// selected backend, so it sees the outbound request as it would be sent, and may change any of it,
+// e.g. the URL or the Host. The director wrappers of the mux run around it, see WrapDirector.
+func (r Route) SetDirector(d Director) Route {
+	r.Director = d
+	return r
+}
+
+// SetNotFoundHandler answers the requests matching no route under the static prefix of the route path,
+// the path up to its first parameter, instead of the NotFoundHandler of the mux. The route with the
+// longest prefix wins.
+func (r Route) SetNotFoundHandler(h http.Handler) Route {
+	r.NotFound = h
+	return r
+}
+
+// SetMethodNotAllowedHandler answers the requests of the path of the route with a method no route of
+// the path has, instead of the MethodNotAllowedHandler of the mux. The Allow header is set before.
+func (r Route) SetMethodNotAllowedHandler(h http.Handler) Route {
+	r.MethodNotAllowed = h
+	return r
+}
+
+// SetUploadProgress observes the request bodies of the route while they're forwarded, see UploadProgress.
+func (r Route) SetUploadProgress(p UploadProgress) Route {
+	r.Upload = &p
+	return r
+}
+
+// SetExpect sets the handling of the Expect: 100-continue header of the requests, see ExpectMode.
+// Clients sending large uploads with the header wait for the 100 Continue before sending the body.
+func (r Route) SetExpect(mode ExpectMode) Route {
+	r.Expect = mode
+	return r
+}
+
+// SetModifyTrailer sets the modifier of the trailers of the upstream responses. The response modifiers
+// run before the body is read, so the modifier is called once it was read, with the trailers in
+// res.Trailer, e.g. the grpc-status of gRPC responses. The changed trailers are forwarded, the trailers
+// added are sent if the response is still chunked. An error aborts the response, whose headers were sent.
+func (r Route) SetModifyTrailer(modifier ResponseModifier) Route {
+	r.ModifyTrailer = modifier
+	return r
+}
+
+func (r Route) SetGroup(group string) Route {
+	r.Group = group
+	return r
+}
+
+// SetBuffering sets whether the upstream responses of the route are buffered in full before the
+// response modifiers run, or streamed to the client with every write flushed immediately.
+func (r Route) SetBuffering(enabled bool) Route {
+	r.Buffering = BufferingDisabled
+	if enabled {
+		r.Buffering = BufferingEnabled
+	}
+	return r
+}
+
+// SetDecompression enables the transparent decompression of the upstream responses of the route
+// within the passed limits, so the response modifiers can process compressed bodies.
+func (r Route) SetDecompression(limits Decompression) Route {
+	r.Decompression = &limits
+	return r
+}
+
+// SetHedging enables hedged requests on the route: if the upstream hasn't responded within the passed
+// delay, the request is sent to another backend too and the first response is used. Only requests
+// with idempotent methods and without a body are hedged.
+func (r Route) SetHedging(delay time.Duration) Route {
+	r.HedgeDelay = delay
+	return r
+}
+
+// SetCoalescing sets whether concurrent identical GET and HEAD requests of the route are collapsed into
+// one upstream request, whose response is passed to all of them, protecting the upstream from
+// thundering herds. Requests are identical if their host, URI, credentials and the headers named by the
+// Vary header of the response match. The shared responses are buffered within the MaxBufferedResponse size.
+func (r Route) SetCoalescing(enabled bool) Route {
+	r.Coalesce = enabled
+	return r
+}
+
+// SetCache enables the response cache of the GET and HEAD requests of the route, see Cache. Stale
+// responses are served while they're revalidated in the background within the StaleWhileRevalidate time,
+// and when the upstream fails within the StaleIfError time.
+func (r Route) SetCache(cache Cache) Route {
+	if cache.Store == nil {
+		// the store outlives the handlers, which are rebuilt on route changes
+		cache.Store = NewMemoryCache(DefaultCacheEntries)
+	}
+	r.Cache = &cache
+	return r
+}
+
+// SetIdempotency deduplicates the requests of the route carrying an Idempotency-Key header, protecting
+// non-idempotent upstream operations, e.g. payments, from retried requests. The response of a request is
+// stored and replayed to the requests with the same key, method, path and credentials within the TTL,
+// marked by an Idempotent-Replayed header. Duplicates arriving while the request is pending are answered
+// with HTTP 409 conflict. The stored responses are buffered within the MaxBufferedResponse size.
+func (r Route) SetIdempotency(idempotency Idempotency) Route {
+	if idempotency.Store == nil {
+		// the store outlives the handlers, which are rebuilt on route changes
+		idempotency.Store = NewMemoryCache(DefaultCacheEntries)
+	}
+	r.Idempotency = &idempotency
+	return r
+}
+
+// SetETag sets the ETag of the route's responses without one, computed from the body once the response
+// modifiers ran, see ETagMode. Conditional GET and HEAD requests matching the ETag or Last-Modified
+// header are answered with 304 not modified by the proxy.
+func (r Route) SetETag(mode ETagMode) Route {
+	r.ETag = mode
+	return r
+}
+
+// SetSigner signs the outbound requests of the route with the signer, e.g. for origins authenticating
+// the proxy by request signatures. The requests are signed last, right before they're sent.
+func (r Route) SetSigner(signer RequestSigner) Route {
+	r.Signer = signer
+	return r
+}
+
+// SetTransport sends the requests of the route with the transport to all backends, instead of the
+// Transport of the mux and the backends, e.g. an HTTP/2 transport for a gRPC route, or a transport of
+// a tunnel package dialer. The transport is shared by the copies of the route.
+func (r Route) SetTransport(transport http.RoundTripper) Route {
+	r.Transport = transport
+	return r
+}
+
+// SetUpstreamTLS sets the TLS configuration of the connections to the upstream, e.g. the client
+// certificate authenticating the proxy, the CA bundle and the SNI server name. The requests of the
+// route are sent with a transport of the configuration to all backends, instead of the Transport of the
+// mux and the backends. It's applied to a clone of the Transport of the route, or of the default
+// transport if the route has none, once per registration of the route, so the connections are pooled
+// across route changes. The registration of a route whose Transport isn't an *http.Transport fails
+// with ErrTLSTransport.
+func (r Route) SetUpstreamTLS(cfg *UpstreamTLS) Route {
+	r.TLS = cfg
+	return r
+}
+
+// SetResponseHeaderPolicy filters the headers of the upstream responses of the route with the policy,
+// after the ResponseHeaderPolicy of the mux and the response modifiers, e.g. to strip the headers
+// disclosing the upstream software:
+//
+//	route.SetResponseHeaderPolicy(&HeaderPolicy{Deny: SensitiveResponseHeaders})
+func (r Route) SetResponseHeaderPolicy(p *HeaderPolicy) Route {
+	r.ResponseHeaders = p
+	return r
+}
+
+// SetStubResponse answers the requests of the route with a static response instead of forwarding them,
+// e.g. to mock endpoints during development or outages of the upstream. The body is a Go template
+// rendered with the StubData of the request, so the response can echo its parameters. The route still
+// runs its middleware, while the request and response modifiers aren't called.
+func (r Route) SetStubResponse(status int, header http.Header, body string) Route {
+	r.Stub = &Stub{Status: status, Header: header, Body: body}
+	return r
+}
+
+// SetPriority sets the priority of the route for the load shedding, see LoadShedding. Routes with a
+// higher priority are shed later, e.g. health and admin endpoints. The default priority is zero.
+func (r Route) SetPriority(priority int) Route {
+	r.Priority = priority
+	return r
+}
+
+// SetQueue limits the requests of the route forwarded to the upstream concurrently, holding the
+// excess requests in a queue of the configured depth for up to the configured wait time. The requests
+// which can't be queued or time out are answered with HTTP 503 service unavailable.
+func (r Route) SetQueue(queue Queue) Route {
+	r.Queue = &queue
+	// the queue outlives the handlers, which are rebuilt on route changes, so the requests in flight
+	// on a replaced handler still hold their slots
+	r.queue = newRouteQueue(queue)
+	return r
+}
+
+// SetQuota limits the requests of the route per key in a fixed period, see Quota and QuotaLimiter.
+// The quota is counted by the route only, unless its Counter and Prefix are shared with another quota.
+func (r Route) SetQuota(quota Quota) Route {
+	if quota.Counter == nil {
+		// the counter outlives the handlers, which are rebuilt on route changes
+		quota.Counter = NewMemoryQuotaCounter()
+	}
+	r.Quota = &quota
+	return r
+}
+
 func methodStringToSlice(methods string) []string {
 	if methods == "*" {
 		return []string{"GET", "HEAD", "OPTIONS", "POST", "PUT", "PATCH", "DELETE"}
@@ -219,3 +219,33 @@ func TestRoute_SetModifyResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestRoute_SetGroup(t *testing.T) {
+	got := NewRoute("GET", "/test").SetGroup("billing")
+	want := Route{
+		Method: []string{"GET"},
+		Path:   "/test",
+		Group:  "billing",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Route.SetGroup() = %v, want %v", got, want)
+	}
+}
+
+func TestRoute_SetBuffering(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    BufferingMode
+	}{
+		{"Test enabled buffering", true, BufferingEnabled},
+		{"Test disabled buffering", false, BufferingDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRoute("GET", "/test").SetBuffering(tt.enabled).Buffering; got != tt.want {
+				t.Errorf("Route.SetBuffering() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
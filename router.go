@@ -0,0 +1,138 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RouterOptions configure how the router canonicalizes the request paths. New enables
+// RedirectTrailingSlash and RedirectFixedPath, like httprouter.
+type RouterOptions struct {
+	// RedirectTrailingSlash redirects the requests to the path with or without the trailing slash, if
+	// only the other path has a route.
+	RedirectTrailingSlash bool
+	// RedirectFixedPath redirects the requests to the cleaned path, e.g. without ".." elements or
+	// double slashes, if it matches a route case-insensitively.
+	RedirectFixedPath bool
+	// CaseInsensitive serves the requests matching a route case-insensitively without redirecting. It
+	// takes precedence over RedirectFixedPath, which is disabled.
+	CaseInsensitive bool
+	// ForwardOPTIONS forwards the OPTIONS requests upstream by the first route of their path, instead
+	// of answering them with the methods registered for the path in the Allow header. Routes with the
+	// OPTIONS method forward them either way.
+	ForwardOPTIONS bool
+}
+
+// SetRouterOptions replaces the router options and rebuilds the routing table. It's safe to call while
+// the proxy is serving requests. An error is returned if routes conflict case-insensitively while
+// enabling CaseInsensitive, or if the mux is frozen.
+func (pm *ReverseProxyMux) SetRouterOptions(opts RouterOptions) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	prev := pm.routerOpts
+	pm.routerOpts = opts
+	if err := pm.swapRoutes(pm.routes); err != nil {
+		pm.routerOpts = prev
+		return err
+	}
+	return nil
+}
+
+// RouterOptions returns the router options of the mux.
+func (pm *ReverseProxyMux) RouterOptions() RouterOptions {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.routerOpts
+}
+
+// forwardOPTIONS registers the handler of the first route of each path for the OPTIONS method, unless
+// a route of the path has it.
+func forwardOPTIONS(router, fold *httprouter.Router, routes []Route, handlers []http.Handler) {
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		if slices.Contains(route.Method, http.MethodOptions) {
+			registered[route.Path] = true
+		}
+	}
+	for i, route := range routes {
+		if registered[route.Path] {
+			continue
+		}
+		registered[route.Path] = true
+		router.Handler(http.MethodOptions, route.Path, handlers[i])
+		if fold != nil {
+			fold.Handle(http.MethodOptions, lowerASCII(route.Path), foldHandle(route, handlers[i]))
+		}
+	}
+}
+
+// allowOptions answers the OPTIONS requests of the paths without an OPTIONS route. The router sets the
+// Allow header to the methods registered for the path before.
+func allowOptions(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// caseInsensitive serves the requests not matched by the router with the routes of the fold router,
+// which are registered in lower case, falling back to the notFound handler.
+func caseInsensitive(fold *httprouter.Router, notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle, _, _ := fold.Lookup(r.Method, lowerASCII(r.URL.Path)); handle != nil {
+			handle(w, r, nil)
+			return
+		}
+		notFound.ServeHTTP(w, r)
+	})
+}
+
+// foldHandle returns the handle of the route registered in the fold router. The parameters are
+// extracted from the request path, so their values keep their case.
+func foldHandle(route Route, h http.Handler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if params := matchParams(route.Path, r.URL.Path); len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// matchParams extracts the parameters of the route path from a request path matching it.
+func matchParams(pattern, path string) httprouter.Params {
+	var params httprouter.Params
+	for pattern != "" && path != "" {
+		switch {
+		case strings.HasPrefix(pattern, "/*"):
+			return append(params, httprouter.Param{Key: pattern[2:], Value: path})
+		case pattern[0] == ':':
+			name, _, _ := strings.Cut(pattern[1:], "/")
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			params = append(params, httprouter.Param{Key: name, Value: path[:end]})
+			pattern, path = pattern[1+len(name):], path[end:]
+		default:
+			pattern, path = pattern[1:], path[1:]
+		}
+	}
+	return params
+}
+
+// lowerASCII lowers the ASCII letters of s, keeping the byte offsets.
+func lowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if 'A' <= b[j] && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package script
+
+import (
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/open-webtech/go-reverse-proxy/internal/message"
+)
+
+// ErrResponseOnly is returned when a response method is called in the request phase.
+var ErrResponseOnly = message.ErrResponseOnly
+
+// Env is the environment of a running script. Its methods return empty strings, so they can be
+// called from templates without producing output.
+type Env struct {
+	Request *http.Request
+	// Response is nil in the request phase.
+	Response *http.Response
+
+	maxBodySize  int64
+	rejected     bool
+	rejectStatus int
+	rejectBody   string
+}
+
+// header returns the header of the current message.
+func (e *Env) header() http.Header {
+	return message.Header(e.Request, e.Response)
+}
+
+// Method returns the request method.
+func (e *Env) Method() string {
+	return e.Request.Method
+}
+
+// Path returns the request path.
+func (e *Env) Path() string {
+	return e.Request.URL.Path
+}
+
+// Host returns the requested host.
+func (e *Env) Host() string {
+	return e.Request.Host
+}
+
+// Status returns the response status code, or zero in the request phase.
+func (e *Env) Status() int {
+	return message.Status(e.Response)
+}
+
+// Header returns the first value of the named header of the current message.
+func (e *Env) Header(name string) string {
+	return e.header().Get(name)
+}
+
+// SetHeader sets the named header of the current message.
+func (e *Env) SetHeader(name, value string) string {
+	e.header().Set(name, value)
+	return ""
+}
+
+// AddHeader adds a value to the named header of the current message.
+func (e *Env) AddHeader(name, value string) string {
+	e.header().Add(name, value)
+	return ""
+}
+
+// DelHeader deletes the named header of the current message.
+func (e *Env) DelHeader(name string) string {
+	e.header().Del(name)
+	return ""
+}
+
+// Query returns the first value of the named query parameter of the request.
+func (e *Env) Query(name string) string {
+	return e.Request.URL.Query().Get(name)
+}
+
+// SetQuery sets the named query parameter of the request.
+func (e *Env) SetQuery(name, value string) string {
+	q := e.Request.URL.Query()
+	q.Set(name, value)
+	e.Request.URL.RawQuery = q.Encode()
+	return ""
+}
+
+// DelQuery deletes the named query parameter of the request.
+func (e *Env) DelQuery(name string) string {
+	q := e.Request.URL.Query()
+	q.Del(name)
+	e.Request.URL.RawQuery = q.Encode()
+	return ""
+}
+
+// SetPath sets the request path.
+func (e *Env) SetPath(path string) string {
+	e.Request.URL.Path = path
+	e.Request.URL.RawPath = ""
+	return ""
+}
+
+// SetStatus sets the response status code.
+func (e *Env) SetStatus(status int) (string, error) {
+	return "", message.SetStatus(e.Response, status)
+}
+
+// Body reads the body of the current message. The body stays available for the upstream or client.
+// A body over the MaxBodySize of the script fails with an *http.MaxBytesError.
+func (e *Env) Body() (string, error) {
+	b, err := message.ReadBody(e.Request, e.Response, e.maxBodySize)
+	return string(b), err
+}
+
+// SetBody replaces the body of the current message.
+func (e *Env) SetBody(body string) string {
+	message.SetBody(e.Request, e.Response, []byte(body))
+	return ""
+}
+
+// Reject answers the request with the status and body instead of proxying it. In the response
+// phase, the upstream response is replaced.
+func (e *Env) Reject(status int, body string) string {
+	e.rejected = true
+	e.rejectStatus = status
+	e.rejectBody = body
+	return ""
+}
+
+// TemplateEngine is an Engine running Go templates, used by Load for .tmpl files. The template output
+// is discarded.
+type TemplateEngine struct{}
+
+// Compile parses the template source.
+func (TemplateEngine) Compile(name, src string) (Program, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return templateProgram{tmpl}, nil
+}
+
+// templateProgram is a compiled template script.
+type templateProgram struct {
+	tmpl *template.Template
+}
+
+// Run executes the template with the environment as data.
+func (p templateProgram) Run(env *Env) error {
+	return p.tmpl.Execute(io.Discard, env)
+}
@@ -0,0 +1,158 @@
+package script
+
+import (
+	"errors"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// LuaEngine is the built-in Engine running Lua 5.1 scripts with gopher-lua. The scripts act by
+// calling the functions of the proxy table, which map to the methods of the Env:
+//
+//	proxy.method() proxy.path() proxy.host() proxy.status()
+//	proxy.header(name) proxy.set_header(name, value) proxy.add_header(name, value) proxy.del_header(name)
+//	proxy.query(name) proxy.set_query(name, value) proxy.del_query(name) proxy.set_path(path)
+//	proxy.set_status(status) proxy.body() proxy.set_body(body) proxy.reject(status, body)
+//
+// Only the base, table, string and math libraries are opened, without the functions loading files.
+// Each run uses a fresh Lua state, so the runs don't share globals, and is interrupted when the
+// context of the request is done.
+type LuaEngine struct{}
+
+// luaLibs are the libraries opened in the Lua states.
+var luaLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// Compile parses and compiles the Lua source.
+func (LuaEngine) Compile(name, src string) (Program, error) {
+	chunk, err := parse.Parse(strings.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+	return luaProgram{proto}, nil
+}
+
+// luaProgram is a compiled Lua script.
+type luaProgram struct {
+	proto *lua.FunctionProto
+}
+
+// Run runs the script in a new Lua state with the proxy table bound to the environment.
+func (p luaProgram) Run(env *Env) error {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range luaLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+	// the errors raised by the functions lose their type in Lua, so the first one is kept for the
+	// caller, e.g. to tell an *http.MaxBytesError
+	var cause error
+	raise := func(L *lua.LState, fn string, err error) {
+		if cause == nil {
+			cause = err
+		}
+		L.RaiseError("%s: %v", fn, err)
+	}
+	L.SetGlobal("proxy", L.SetFuncs(L.NewTable(), luaFunctions(env, raise)))
+	L.SetContext(env.Request.Context())
+
+	L.Push(L.NewFunctionFromProto(p.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		if cause != nil {
+			return errors.Join(err, cause)
+		}
+		return err
+	}
+	return nil
+}
+
+// luaFunctions returns the functions of the proxy table bound to the environment. The functions
+// report Go errors with raise.
+func luaFunctions(env *Env, raise func(L *lua.LState, fn string, err error)) map[string]lua.LGFunction {
+	str := func(f func() string) lua.LGFunction {
+		return func(L *lua.LState) int {
+			L.Push(lua.LString(f()))
+			return 1
+		}
+	}
+	return map[string]lua.LGFunction{
+		"method": str(env.Method),
+		"path":   str(env.Path),
+		"host":   str(env.Host),
+		"status": func(L *lua.LState) int {
+			L.Push(lua.LNumber(env.Status()))
+			return 1
+		},
+		"header": func(L *lua.LState) int {
+			L.Push(lua.LString(env.Header(L.CheckString(1))))
+			return 1
+		},
+		"set_header": func(L *lua.LState) int {
+			env.SetHeader(L.CheckString(1), L.CheckString(2))
+			return 0
+		},
+		"add_header": func(L *lua.LState) int {
+			env.AddHeader(L.CheckString(1), L.CheckString(2))
+			return 0
+		},
+		"del_header": func(L *lua.LState) int {
+			env.DelHeader(L.CheckString(1))
+			return 0
+		},
+		"query": func(L *lua.LState) int {
+			L.Push(lua.LString(env.Query(L.CheckString(1))))
+			return 1
+		},
+		"set_query": func(L *lua.LState) int {
+			env.SetQuery(L.CheckString(1), L.CheckString(2))
+			return 0
+		},
+		"del_query": func(L *lua.LState) int {
+			env.DelQuery(L.CheckString(1))
+			return 0
+		},
+		"set_path": func(L *lua.LState) int {
+			env.SetPath(L.CheckString(1))
+			return 0
+		},
+		"set_status": func(L *lua.LState) int {
+			if _, err := env.SetStatus(L.CheckInt(1)); err != nil {
+				raise(L, "set_status", err)
+			}
+			return 0
+		},
+		"body": func(L *lua.LState) int {
+			body, err := env.Body()
+			if err != nil {
+				raise(L, "body", err)
+			}
+			L.Push(lua.LString(body))
+			return 1
+		},
+		"set_body": func(L *lua.LState) int {
+			env.SetBody(L.CheckString(1))
+			return 0
+		},
+		"reject": func(L *lua.LState) int {
+			env.Reject(L.CheckInt(1), L.OptString(2, ""))
+			return 0
+		},
+	}
+}
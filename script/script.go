@@ -0,0 +1,123 @@
+// Package script attaches small scripts to routes, which inspect and modify the proxied requests and
+// responses, so dynamic behavior can be loaded from configuration files without recompiling the proxy.
+//
+// The default engine embeds a Lua interpreter; the scripts act by calling the functions of the proxy
+// table, see LuaEngine:
+//
+//	if proxy.method() == "DELETE" then proxy.reject(403, "read-only") end
+//	proxy.del_header("Cookie")
+//	proxy.set_header("X-Client", proxy.header("User-Agent"))
+//	if proxy.status() >= 500 then proxy.set_status(502) end
+//
+// The TemplateEngine runs Go templates instead, calling the methods of the Env passed as template
+// data. Other languages can be plugged in by implementing the Engine interface.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/open-webtech/go-reverse-proxy/internal/message"
+)
+
+// Engine compiles the scripts of a scripting language.
+type Engine interface {
+	Compile(name, src string) (Program, error)
+}
+
+// Program is a compiled script.
+type Program interface {
+	Run(env *Env) error
+}
+
+// DefaultEngine is the engine used by Compile and Load.
+var DefaultEngine Engine = LuaEngine{}
+
+// DefaultMaxBodySize is the default limit of the bodies read by the scripts.
+const DefaultMaxBodySize = message.DefaultMaxBodySize
+
+// Script is a compiled script attachable to routes.
+type Script struct {
+	// MaxBodySize limits the bodies read by the script, DefaultMaxBodySize if zero.
+	MaxBodySize int64
+
+	name    string
+	program Program
+}
+
+// Compile compiles the source of the named script with the DefaultEngine.
+func Compile(name, src string) (*Script, error) {
+	return CompileWith(DefaultEngine, name, src)
+}
+
+// CompileWith compiles the source of the named script with the passed engine.
+func CompileWith(engine Engine, name, src string) (*Script, error) {
+	program, err := engine.Compile(name, src)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	return &Script{name: name, program: program}, nil
+}
+
+// Load reads and compiles a script file, with the TemplateEngine for .tmpl files and the
+// DefaultEngine otherwise.
+func Load(file string) (*Script, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	engine := DefaultEngine
+	if filepath.Ext(file) == ".tmpl" {
+		engine = TemplateEngine{}
+	}
+	return CompileWith(engine, filepath.Base(file), string(src))
+}
+
+// Name returns the name of the script.
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Middleware returns a handler running the script on the requests before passing them to next.
+// It can be registered per route group with ReverseProxyMux.UseGroup. A request rejected by the
+// script is answered with the rejection status and body, and a request whose body is over the
+// MaxBodySize with HTTP 413.
+func (s *Script) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := &Env{Request: r, maxBodySize: s.MaxBodySize}
+		if err := s.program.Run(env); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if env.rejected {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(env.rejectStatus)
+			_, _ = io.WriteString(w, env.rejectBody)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ModifyResponse runs the script on the response. It has the signature of a ResponseModifier,
+// so it can be passed to Route.SetModifyResponse.
+func (s *Script) ModifyResponse(res *http.Response) error {
+	env := &Env{Request: res.Request, Response: res, maxBodySize: s.MaxBodySize}
+	if err := s.program.Run(env); err != nil {
+		return fmt.Errorf("script %s: %w", s.name, err)
+	}
+	if env.rejected {
+		_ = message.SetStatus(res, env.rejectStatus)
+		message.SetBody(res.Request, res, []byte(env.rejectBody))
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileError(t *testing.T) {
+	_, err := Compile("broken", "if then")
+	assert.Error(t, err)
+	_, err = CompileWith(TemplateEngine{}, "broken", "{{ if }}")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, err := Compile("guard", `
+		if proxy.method() == "DELETE" then
+			proxy.reject(403, "read-only")
+			return
+		end
+		proxy.del_header("Cookie")
+		proxy.set_header("X-Client", proxy.header("User-Agent"))
+		proxy.set_query("lang", "en")
+		proxy.del_query("debug")
+		proxy.set_path("/v2" .. proxy.path())`)
+	assert.NoError(t, err)
+
+	var got *http.Request
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	r := httptest.NewRequest("GET", "/users?debug=1", nil)
+	r.Header.Set("Cookie", "session=1")
+	r.Header.Set("User-Agent", "curl")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NotNil(t, got)
+	assert.Empty(t, got.Header.Get("Cookie"))
+	assert.Equal(t, "curl", got.Header.Get("X-Client"))
+	assert.Equal(t, "/v2/users", got.URL.Path)
+	assert.Equal(t, "lang=en", got.URL.RawQuery)
+
+	got = nil
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/users", nil))
+	assert.Nil(t, got)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "read-only", w.Body.String())
+}
+
+func TestModifyResponse(t *testing.T) {
+	s, err := Compile("errors", `
+		if proxy.status() >= 500 then
+			proxy.set_status(502)
+			proxy.set_body("upstream failed")
+		end
+		proxy.set_header("X-Body-Length", tostring(#proxy.body()))`)
+	assert.NoError(t, err)
+
+	res := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("stack trace")),
+		Request:    httptest.NewRequest("GET", "/", nil),
+	}
+	assert.NoError(t, s.ModifyResponse(res))
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	assert.Equal(t, "15", res.Header.Get("X-Body-Length"))
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "upstream failed", string(body))
+}
+
+func TestResponseOnly(t *testing.T) {
+	s, err := Compile("status", `proxy.set_status(500)`)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestLuaEngine_Sandbox(t *testing.T) {
+	for _, src := range []string{`os.exit(1)`, `io.open("/etc/passwd")`, `dofile("/etc/passwd")`, `require("os")`} {
+		s, err := Compile("sandbox", src)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		s.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, src)
+	}
+}
+
+func TestLuaEngine_Canceled(t *testing.T) {
+	s, err := Compile("loop", `while true do end`)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	s.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTemplateEngine(t *testing.T) {
+	s, err := CompileWith(TemplateEngine{}, "errors", `
+		{{- if ge .Status 500 }}{{ .SetStatus 502 }}{{ .SetBody "upstream failed" }}{{ end -}}
+		{{ .SetHeader "X-Body-Length" (len .Body | printf "%d") }}`)
+	assert.NoError(t, err)
+
+	res := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("stack trace")),
+		Request:    httptest.NewRequest("GET", "/", nil),
+	}
+	assert.NoError(t, s.ModifyResponse(res))
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	assert.Equal(t, "15", res.Header.Get("X-Body-Length"))
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		src  string
+	}{
+		{"Test with Lua file", "hook.lua", `proxy.set_header("X-A", "1")`},
+		{"Test with template file", "hook.tmpl", `{{ .SetHeader "X-A" "1" }}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tt.file)
+			assert.NoError(t, os.WriteFile(file, []byte(tt.src), 0o644))
+			s, err := Load(file)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.file, s.Name())
+
+			res := &http.Response{Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+			assert.NoError(t, s.ModifyResponse(res))
+			assert.Equal(t, "1", res.Header.Get("X-A"))
+		})
+	}
+}
+
+type funcEngine func(env *Env) error
+
+func (f funcEngine) Compile(name, src string) (Program, error) {
+	if src == "" {
+		return nil, errors.New("empty script")
+	}
+	return f, nil
+}
+
+func (f funcEngine) Run(env *Env) error {
+	return f(env)
+}
+
+func TestCompileWith(t *testing.T) {
+	engine := funcEngine(func(env *Env) error {
+		env.SetHeader("X-Engine", "custom")
+		return nil
+	})
+	_, err := CompileWith(engine, "empty", "")
+	assert.Error(t, err)
+
+	s, err := CompileWith(engine, "custom", "x")
+	assert.NoError(t, err)
+	res := &http.Response{Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	assert.NoError(t, s.ModifyResponse(res))
+	assert.Equal(t, "custom", res.Header.Get("X-Engine"))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	s, err := Compile("length", `proxy.set_header("X-Body-Length", tostring(#proxy.body()))`)
+	assert.NoError(t, err)
+	s.MaxBodySize = 4
+
+	called := false
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("oversized")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.False(t, called)
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("oversized")),
+		Request:    httptest.NewRequest("GET", "/", nil),
+	}
+	var tooLarge *http.MaxBytesError
+	assert.ErrorAs(t, s.ModifyResponse(res), &tooLarge)
+
+	tmpl, err := CompileWith(TemplateEngine{}, "length", `{{ .SetHeader "X-Body-Length" (len .Body | printf "%d") }}`)
+	assert.NoError(t, err)
+	tmpl.MaxBodySize = 4
+	w = httptest.NewRecorder()
+	tmpl.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("oversized")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,189 @@
+// Package secrets resolves the secret references of config-driven setups, e.g. API keys, certificates
+// and tokens, to their values at load time:
+//
+//	env://API_KEY                      the API_KEY environment variable
+//	file:///run/secrets/api-key        the content of the file, without a trailing newline
+//	vault://secret/proxy#api_key       the api_key field of the secret/proxy secret of a Vault KV v2 engine
+//
+// The references are resolved on every call, so reloading a configuration rotates its secrets. Other
+// schemes are resolved by the providers registered with Resolver.Register.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned for references to missing secrets.
+var ErrNotFound = errors.New("secrets: not found")
+
+// Provider resolves the references of a scheme.
+type Provider interface {
+	// Secret returns the value of the secret of the reference.
+	Secret(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+// Secret calls f(ctx, ref).
+func (f ProviderFunc) Secret(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+// Resolver resolves secret references by the provider of their scheme.
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver of the env, file and vault schemes. The Vault server is configured by
+// the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables, see VaultFromEnv.
+func NewResolver() *Resolver {
+	r := &Resolver{providers: make(map[string]Provider)}
+	r.Register("env", ProviderFunc(envSecret))
+	r.Register("file", ProviderFunc(fileSecret))
+	r.Register("vault", VaultFromEnv())
+	return r
+}
+
+// Register sets the provider of the scheme, replacing the provider registered before.
+func (r *Resolver) Register(scheme string, p Provider) *Resolver {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[strings.ToLower(scheme)] = p
+	return r
+}
+
+// provider returns the provider of the reference, if it's one.
+func (r *Resolver) provider(s string) (Provider, bool) {
+	scheme, _, ok := strings.Cut(s, "://")
+	if !ok {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[strings.ToLower(scheme)]
+	return p, ok
+}
+
+// IsReference reports whether the string is a reference of a registered scheme.
+func (r *Resolver) IsReference(s string) bool {
+	_, ok := r.provider(s)
+	return ok
+}
+
+// Resolve returns the value of the secret reference. Strings which aren't references of a registered
+// scheme, e.g. plain values or https URLs, are returned as is.
+func (r *Resolver) Resolve(ctx context.Context, s string) (string, error) {
+	p, ok := r.provider(s)
+	if !ok {
+		return s, nil
+	}
+	ref, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("secrets: invalid reference: %w", err)
+	}
+	v, err := p.Secret(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %s://%s: %w", ref.Scheme, ref.Host+ref.Path, err)
+	}
+	return v, nil
+}
+
+// ResolveAll replaces the references in the strings reachable from the pointer, e.g. a configuration
+// struct: the string fields, the elements of slices and arrays and the values of maps, recursively.
+// Unexported fields are skipped. The first error is returned.
+func (r *Resolver) ResolveAll(ctx context.Context, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("secrets: ResolveAll requires a non-nil pointer")
+	}
+	return r.resolveValue(ctx, rv.Elem())
+}
+
+// resolveValue replaces the references in the value.
+func (r *Resolver) resolveValue(ctx context.Context, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() || !r.IsReference(v.String()) {
+			return nil
+		}
+		s, err := r.Resolve(ctx, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values stored in interfaces aren't addressable, so they're replaced by a resolved copy
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			if err := r.resolveValue(ctx, elem); err != nil {
+				return err
+			}
+			if v.CanSet() {
+				v.Set(elem)
+			}
+			return nil
+		}
+		return r.resolveValue(ctx, v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := r.resolveValue(ctx, v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolveValue(ctx, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := r.resolveValue(ctx, elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// envSecret returns the environment variable named by the host of the reference.
+func envSecret(_ context.Context, ref *url.URL) (string, error) {
+	v, ok := os.LookupEnv(ref.Host + ref.Path)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// fileSecret returns the content of the file of the reference without a trailing newline. Paths are
+// absolute as in file:///run/secrets/key, or relative to the working directory as in file://key.
+func fileSecret(_ context.Context, ref *url.URL) (string, error) {
+	b, err := os.ReadFile(ref.Host + ref.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
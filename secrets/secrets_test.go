@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	t.Setenv("PROXY_API_KEY", "abc123")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(file, []byte("s3cret\n"), 0o600))
+
+	r := NewResolver()
+	r.Register("static", ProviderFunc(func(_ context.Context, ref *url.URL) (string, error) {
+		return "static " + ref.Host, nil
+	}))
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{"Test environment variable", "env://PROXY_API_KEY", "abc123", nil},
+		{"Test missing environment variable", "env://PROXY_MISSING", "", ErrNotFound},
+		{"Test absolute file", "file://" + file, "s3cret", nil},
+		{"Test missing file", "file://" + filepath.Join(dir, "missing"), "", ErrNotFound},
+		{"Test registered provider", "STATIC://key", "static key", nil},
+		{"Test plain value", "plain value", "plain value", nil},
+		{"Test unregistered scheme", "https://example.com", "https://example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), tt.ref)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolver_ResolveAll(t *testing.T) {
+	t.Setenv("PROXY_TOKEN", "token")
+	t.Setenv("PROXY_KEY", "key")
+	type upstream struct {
+		URL     string
+		Headers map[string]string
+	}
+	type config struct {
+		Token     string
+		Upstreams []upstream
+		Primary   *upstream
+		Extra     any
+		private   string
+	}
+	cfg := config{
+		Token: "env://PROXY_TOKEN",
+		Upstreams: []upstream{{
+			URL:     "https://example.com",
+			Headers: map[string]string{"X-Api-Key": "env://PROXY_KEY"},
+		}},
+		Primary: &upstream{URL: "env://PROXY_KEY"},
+		Extra:   upstream{URL: "env://PROXY_TOKEN"},
+		private: "env://PROXY_TOKEN",
+	}
+
+	r := NewResolver()
+	assert.NoError(t, r.ResolveAll(context.Background(), &cfg))
+	assert.Equal(t, "token", cfg.Token)
+	assert.Equal(t, "https://example.com", cfg.Upstreams[0].URL)
+	assert.Equal(t, "key", cfg.Upstreams[0].Headers["X-Api-Key"])
+	assert.Equal(t, "key", cfg.Primary.URL)
+	assert.Equal(t, upstream{URL: "token"}, cfg.Extra)
+	assert.Equal(t, "env://PROXY_TOKEN", cfg.private)
+
+	// reloading resolves the rotated values
+	t.Setenv("PROXY_TOKEN", "rotated")
+	cfg.Token = "env://PROXY_TOKEN"
+	assert.NoError(t, r.ResolveAll(context.Background(), &cfg))
+	assert.Equal(t, "rotated", cfg.Token)
+
+	cfg.Token = "env://PROXY_MISSING"
+	assert.ErrorIs(t, r.ResolveAll(context.Background(), &cfg), ErrNotFound)
+	assert.Error(t, r.ResolveAll(context.Background(), cfg))
+}
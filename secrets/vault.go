@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Vault resolves vault://mount/path#field references to the fields of the secrets of HashiCorp Vault
+// KV version 2 engines, read with its HTTP API.
+type Vault struct {
+	// Address is the URL of the Vault server, e.g. https://vault.example.com:8200.
+	Address string
+	// Token authenticates the requests to the Vault server.
+	Token string
+	// Namespace is the Vault Enterprise namespace of the secrets, if set.
+	Namespace string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// VaultFromEnv returns the Vault provider configured by the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+// environment variables, as the Vault CLI.
+func VaultFromEnv() *Vault {
+	return &Vault{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+// vaultResponse is the response of a KV v2 read.
+type vaultResponse struct {
+	Data struct {
+		Data map[string]any `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// Secret returns the field of the secret named by the fragment of the reference. The version of the
+// secret is selected by a version query parameter, the latest one by default.
+func (v *Vault) Secret(ctx context.Context, ref *url.URL) (string, error) {
+	if v.Address == "" {
+		return "", errors.New("vault address not configured")
+	}
+	if ref.Fragment == "" {
+		return "", errors.New("missing #field of the secret")
+	}
+	path := strings.Trim(ref.Path, "/")
+	u := strings.TrimRight(v.Address, "/") + "/v1/" + ref.Host + "/data/" + path
+	if version := ref.Query().Get("version"); version != "" {
+		u += "?version=" + url.QueryEscape(version)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var vr vaultResponse
+	if err := json.NewDecoder(res.Body).Decode(&vr); err != nil && res.StatusCode == http.StatusOK {
+		return "", err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case res.StatusCode != http.StatusOK && len(vr.Errors) > 0:
+		return "", fmt.Errorf("vault: %s", strings.Join(vr.Errors, "; "))
+	case res.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("vault: %s", res.Status)
+	}
+	field, ok := vr.Data.Data[ref.Fragment]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(field)
+	return string(b), err
+}
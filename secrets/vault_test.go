@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		assert.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+		switch r.URL.Path {
+		case "/v1/secret/data/proxy/upstream":
+			version := r.URL.Query().Get("version")
+			if version == "" {
+				version = "2"
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"api_key":"key-v` + version + `","port":8443}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"Test latest version", "root", "vault://secret/proxy/upstream#api_key", "key-v2", ""},
+		{"Test pinned version", "root", "vault://secret/proxy/upstream?version=1#api_key", "key-v1", ""},
+		{"Test non-string field", "root", "vault://secret/proxy/upstream#port", "8443", ""},
+		{"Test missing field", "root", "vault://secret/proxy/upstream#missing", "", "not found"},
+		{"Test missing secret", "root", "vault://secret/other#api_key", "", "not found"},
+		{"Test missing field name", "root", "vault://secret/proxy/upstream", "", "missing #field"},
+		{"Test denied", "other", "vault://secret/proxy/upstream#api_key", "", "permission denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewResolver().Register("vault", &Vault{Address: srv.URL, Token: tt.token, Namespace: "team"})
+			got, err := r.Resolve(context.Background(), tt.ref)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVaultFromEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	_, err := NewResolver().Resolve(context.Background(), "vault://secret/proxy#key")
+	assert.ErrorContains(t, err, "vault address not configured")
+}
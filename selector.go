@@ -0,0 +1,120 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// SelectedIdleTimeout is the time the backends of the selected upstreams are kept without requests,
+// see SetUpstreamSelector.
+const SelectedIdleTimeout = 5 * time.Minute
+
+// UpstreamSelector returns the upstream of a request, or nil for a backend of the pool.
+type UpstreamSelector func(r *http.Request) (*url.URL, error)
+
+// SetUpstreamSelector sets a func taking control over the upstream of each request, e.g. looked up in
+// a database or routing table, instead of the backend pool and its Balancer. The selected upstreams
+// are kept as backends outside the pool, see SelectedBackends, which share the connection pool of the
+// Transport and are health-checked like the pool, so the first request to an upstream waits for its
+// first check. The requests to an upstream failing its health check are answered with HTTP 503
+// service unavailable. A nil URL selects a backend of the pool, an error is passed to the ErrorHandler
+// as a ProxyError of the kind ErrSelectFailed. The backends are removed after SelectedIdleTimeout
+// without requests. A nil selector restores the pool. It's safe to call while the proxy is serving
+// requests, and panics if the mux is frozen.
+func (pm *ReverseProxyMux) SetUpstreamSelector(selector UpstreamSelector) *ReverseProxyMux {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	if selector == nil {
+		pm.selector.Store(nil)
+	} else {
+		pm.selector.Store(&selector)
+	}
+	return pm
+}
+
+// SelectedBackends returns the backends of the upstreams selected by the UpstreamSelector.
+func (pm *ReverseProxyMux) SelectedBackends() []*Backend {
+	pm.selected.mu.Lock()
+	defer pm.selected.mu.Unlock()
+	backends := make([]*Backend, 0, len(pm.selected.backends))
+	for _, sb := range pm.selected.backends {
+		backends = append(backends, sb.backend)
+	}
+	return backends
+}
+
+// selectedBackends holds the backends of the selected upstreams by URL.
+type selectedBackends struct {
+	mu        sync.Mutex
+	backends  map[string]*selectedBackend
+	nextSweep time.Time
+}
+
+// selectedBackend is a backend of a selected upstream with the time of its last request.
+type selectedBackend struct {
+	backend *Backend
+	used    time.Time
+}
+
+// selectUpstream selects the backend for the request with the UpstreamSelector, reporting whether it's
+// of a selected upstream, or from the pool if no selector is set or it selects no upstream. The backend
+// is nil if all backends of the pool are drained.
+func (pm *ReverseProxyMux) selectUpstream(r *http.Request) (*Backend, bool, error) {
+	selector := pm.selector.Load()
+	if selector == nil {
+		return pm.selectBackend(r), false, nil
+	}
+	u, err := (*selector)(r)
+	if err != nil {
+		return nil, false, &ProxyError{Kind: ErrSelectFailed, Err: err}
+	}
+	if u == nil {
+		return pm.selectBackend(r), false, nil
+	}
+	return pm.selectedBackend(u), true, nil
+}
+
+// selectedBackend returns the backend of the upstream, creating it on first use, and removes the
+// backends idle for SelectedIdleTimeout.
+func (pm *ReverseProxyMux) selectedBackend(u *url.URL) *Backend {
+	key := u.String()
+	now := time.Now()
+	s := &pm.selected
+	s.mu.Lock()
+	if s.backends == nil {
+		s.backends = make(map[string]*selectedBackend)
+	}
+	if now.After(s.nextSweep) {
+		for k, sb := range s.backends {
+			if now.Sub(sb.used) > SelectedIdleTimeout && sb.backend.InFlight() == 0 {
+				sb.backend.health.Stop()
+				delete(s.backends, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+	if sb, ok := s.backends[key]; ok {
+		sb.used = now
+		s.mu.Unlock()
+		return sb.backend
+	}
+	s.mu.Unlock()
+
+	// the first health check runs outside the lock, so it doesn't delay the other upstreams
+	target := *u
+	b := pm.newBackend(&target)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sb, ok := s.backends[key]; ok {
+		b.health.Stop()
+		sb.used = now
+		return sb.backend
+	}
+	s.backends[key] = &selectedBackend{backend: b, used: now}
+	return b
+}
@@ -0,0 +1,92 @@
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetUpstreamSelector(t *testing.T) {
+	newOrigin := func(name string) *url.URL {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+r.URL.Path)
+		}))
+		t.Cleanup(s.Close)
+		u, _ := url.Parse(s.URL)
+		return u
+	}
+	pool, tenant := newOrigin("pool"), newOrigin("tenant")
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	down, _ := url.Parse(closed.URL)
+
+	pm, err := New(pool.String())
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/users"))
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		DefaultErrorHandler(w, r, err)
+	}
+	pm.SetUpstreamSelector(func(r *http.Request) (*url.URL, error) {
+		switch r.Header.Get("X-Tenant") {
+		case "":
+			return nil, nil
+		case "acme":
+			return tenant, nil
+		case "down":
+			return down, nil
+		}
+		return nil, errors.New("unknown tenant")
+	})
+
+	tests := []struct {
+		name     string
+		tenant   string
+		status   int
+		body     string
+		selected int
+	}{
+		{"Test pool", "", http.StatusOK, "pool /users", 0},
+		{"Test selected upstream", "acme", http.StatusOK, "tenant /users", 1},
+		{"Test reused upstream", "acme", http.StatusOK, "tenant /users", 1},
+		{"Test unavailable upstream", "down", http.StatusServiceUnavailable, "", 2},
+		{"Test selection error", "other", http.StatusBadGateway, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("X-Tenant", tt.tenant)
+			rec := httptest.NewRecorder()
+			pm.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+			assert.Len(t, pm.SelectedBackends(), tt.selected)
+			if tt.status == http.StatusBadGateway {
+				assert.ErrorIs(t, handled, ErrSelectFailed)
+			} else {
+				assert.NoError(t, handled)
+			}
+		})
+	}
+
+	m, err := pm.Match("GET", "/users", "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, pool.Host, m.URL.Host)
+	assert.NotNil(t, pm.Clone().selector.Load())
+
+	pm.SetUpstreamSelector(nil)
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	pm.ServeHTTP(rec, req)
+	assert.Equal(t, "pool /users", rec.Body.String())
+}
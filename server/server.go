@@ -0,0 +1,161 @@
+// Package server serves a handler, e.g. a ReverseProxyMux, on multiple listeners: TCP ports, unix
+// sockets and the sockets passed by systemd socket activation, each with its own TLS configuration.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ErrNoListeners is returned by Serve if no listener is added.
+var ErrNoListeners = errors.New("no listeners")
+
+// Server serves a handler on multiple listeners.
+type Server struct {
+	// Handler serves the requests of all listeners.
+	Handler http.Handler
+	// Configure configures the http.Server of each listener before serving, e.g. its timeouts, if set.
+	Configure func(srv *http.Server)
+
+	mu      sync.Mutex
+	servers []*listenerServer
+}
+
+// listenerServer is a listener with the http.Server serving it.
+type listenerServer struct {
+	// key identifies the listener passed to a new process by Upgrade.
+	key string
+	ln  net.Listener
+	srv *http.Server
+}
+
+// New creates a Server of the handler.
+func New(h http.Handler) *Server {
+	return &Server{Handler: h}
+}
+
+// Listen listens on the network address, e.g. "tcp" and ":8080" or "unix" and "/run/proxy.sock",
+// serving TLS with the configuration if it isn't nil. In a process started by Upgrade, the listener of
+// the address passed by the previous process is taken over instead. A stale unix socket file left by a
+// previous process is removed.
+func (s *Server) Listen(network, addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	key := network + ":" + addr
+	ln, err := inheritedListener(key)
+	if err != nil {
+		return nil, err
+	}
+	if ln == nil {
+		if network == "unix" {
+			removeStaleSocket(addr)
+		}
+		if ln, err = net.Listen(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	s.addListener(key, ln, tlsConfig)
+	return ln, nil
+}
+
+// AddListener adds the listener, serving TLS with the configuration if it isn't nil. The listener is
+// closed by Shutdown and Close.
+func (s *Server) AddListener(ln net.Listener, tlsConfig *tls.Config) {
+	s.addListener(ln.Addr().Network()+":"+ln.Addr().String(), ln, tlsConfig)
+}
+
+// addListener adds the listener identified by the key.
+func (s *Server) addListener(key string, ln net.Listener, tlsConfig *tls.Config) {
+	srv := &http.Server{Handler: s.Handler, TLSConfig: tlsConfig}
+	if s.Configure != nil {
+		s.Configure(srv)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = append(s.servers, &listenerServer{key: key, ln: ln, srv: srv})
+}
+
+// Serve serves the listeners until Shutdown or Close is called, or a listener fails. It returns
+// http.ErrServerClosed after Shutdown or Close, and the error of the failed listener otherwise, in
+// which case the other listeners are closed.
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	servers := s.servers
+	s.mu.Unlock()
+	if len(servers) == 0 {
+		return ErrNoListeners
+	}
+	errs := make(chan error, len(servers))
+	for _, ls := range servers {
+		go func(ls *listenerServer) {
+			if ls.srv.TLSConfig != nil {
+				errs <- ls.srv.ServeTLS(ls.ln, "", "")
+				return
+			}
+			errs <- ls.srv.Serve(ls.ln)
+		}(ls)
+	}
+	err := <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = s.Close()
+	}
+	for range servers[1:] {
+		<-errs
+	}
+	return err
+}
+
+// Shutdown gracefully shuts the listeners down, waiting for the in-flight requests until the context
+// is done, see http.Server.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	servers := s.servers
+	s.mu.Unlock()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, ls := range servers {
+		wg.Add(1)
+		go func(i int, ls *listenerServer) {
+			defer wg.Done()
+			errs[i] = ls.srv.Shutdown(ctx)
+			ls.closeListener()
+		}(i, ls)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes the listeners and the connections immediately, see http.Server.Close.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	servers := s.servers
+	s.mu.Unlock()
+	var errs []error
+	for _, ls := range servers {
+		errs = append(errs, ls.srv.Close())
+		ls.closeListener()
+	}
+	return errors.Join(errs...)
+}
+
+// closeListener closes the listener, which is closed by the http.Server already if it was served.
+func (ls *listenerServer) closeListener() {
+	_ = ls.ln.Close()
+}
+
+// removeStaleSocket removes the unix socket file of the path, if there is one which isn't listened on.
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Type() != fs.ModeSocket {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hello(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, "hello "+r.URL.Path)
+}
+
+func TestServer(t *testing.T) {
+	// the test server provides a certificate and a client trusting it
+	ts := httptest.NewTLSServer(http.HandlerFunc(hello))
+	defer ts.Close()
+	sock := filepath.Join(t.TempDir(), "proxy.sock")
+
+	s := New(http.HandlerFunc(hello))
+	plain, err := s.Listen("tcp", "127.0.0.1:0", nil)
+	assert.NoError(t, err)
+	secure, err := s.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	assert.NoError(t, err)
+	_, err = s.Listen("unix", sock, nil)
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+
+	unix := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	tests := []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{"Test TCP listener", http.DefaultClient, "http://" + plain.Addr().String() + "/a"},
+		{"Test TLS listener", ts.Client(), "https://" + secure.Addr().String() + "/a"},
+		{"Test unix socket listener", unix, "http://proxy/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.Get(tt.url)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "hello /a", string(body))
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, http.ErrServerClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Serve didn't return after Shutdown")
+	}
+}
+
+func TestServer_NoListeners(t *testing.T) {
+	assert.ErrorIs(t, New(http.NotFoundHandler()).Serve(), ErrNoListeners)
+}
+
+func TestServer_StaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "proxy.sock")
+	ln, err := net.Listen("unix", sock)
+	assert.NoError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NoError(t, ln.Close())
+	_, err = os.Stat(sock)
+	assert.NoError(t, err)
+
+	s := New(http.NotFoundHandler())
+	ln, err = s.Listen("unix", sock, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	// a socket which is listened on isn't removed
+	live, err := net.Listen("unix", sock)
+	assert.NoError(t, err)
+	defer live.Close()
+	_, err = s.Listen("unix", sock, nil)
+	assert.Error(t, err)
+}
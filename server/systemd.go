@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// ErrNotActivated is returned if the process wasn't passed sockets by systemd.
+var ErrNotActivated = errors.New("no sockets passed by systemd")
+
+// SystemdListeners returns the listeners of the sockets passed by systemd socket activation, keyed by
+// their FileDescriptorName, which defaults to the name of the socket unit. The LISTEN_* environment
+// variables are unset, so child processes don't inherit them. In a process started by Upgrade, the
+// systemd sockets passed by the previous process are returned. ErrNotActivated is returned if the
+// process wasn't socket activated.
+func SystemdListeners() (map[string][]net.Listener, error) {
+	listeners, err := inheritedSystemdListeners()
+	if err != nil || listeners != nil {
+		return listeners, err
+	}
+	return systemdListeners(listenFdsStart)
+}
+
+// systemdListeners returns the listeners of the passed sockets, starting at the descriptor.
+func systemdListeners(start int) (map[string][]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, ErrNotActivated
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, ErrNotActivated
+	}
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+	listeners := make(map[string][]net.Listener, n)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		// FileListener duplicates the descriptor with close-on-exec set
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, lns := range listeners {
+				for _, ln := range lns {
+					_ = ln.Close()
+				}
+			}
+			return nil, fmt.Errorf("systemd socket %d (%s): %w", start+i, name, err)
+		}
+		listeners[name] = append(listeners[name], ln)
+	}
+	return listeners, nil
+}
+
+// ListenSystemd adds the listeners of the sockets passed by systemd socket activation, see
+// SystemdListeners, serving TLS on the sockets whose name has a configuration in tlsConfigs. It
+// returns the number of added listeners.
+func (s *Server) ListenSystemd(tlsConfigs map[string]*tls.Config) (int, error) {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for name, lns := range listeners {
+		for _, ln := range lns {
+			s.AddSystemdListener(name, ln, tlsConfigs[name])
+			n++
+		}
+	}
+	return n, nil
+}
+
+// AddSystemdListener adds the listener of the systemd socket of the name returned by SystemdListeners,
+// like AddListener, so Upgrade passes it to the new process as a systemd socket.
+func (s *Server) AddSystemdListener(name string, ln net.Listener, tlsConfig *tls.Config) {
+	s.addListener(systemdKeyPrefix+name, ln, tlsConfig)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdListeners_NotActivated(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{"Test without environment", "", ""},
+		{"Test for another process", strconv.Itoa(os.Getpid() + 1), "1"},
+		{"Test without sockets", strconv.Itoa(os.Getpid()), "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			_, err := SystemdListeners()
+			assert.ErrorIs(t, err, ErrNotActivated)
+			assert.Empty(t, os.Getenv("LISTEN_FDS"))
+		})
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	assert.NoError(t, err)
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "proxy-https")
+
+	listeners, err := systemdListeners(int(f.Fd()))
+	// the descriptor was closed after it was duplicated by the listener
+	_ = f.Close()
+	assert.NoError(t, err)
+	if assert.Len(t, listeners["proxy-https"], 1) {
+		passed := listeners["proxy-https"][0]
+		defer passed.Close()
+		assert.Equal(t, ln.Addr().String(), passed.Addr().String())
+	}
+	assert.Empty(t, os.Getenv("LISTEN_PID"))
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// envListeners holds the escaped keys of the listeners passed by Upgrade, in the order of their
+	// descriptors starting at 3.
+	envListeners = "GO_REVERSE_PROXY_LISTENERS"
+	// envReady holds the descriptor of the pipe by which Ready notifies the previous process.
+	envReady = "GO_REVERSE_PROXY_READY_FD"
+	// systemdKeyPrefix prefixes the names of the systemd sockets in the listener keys.
+	systemdKeyPrefix = "systemd:"
+)
+
+// ErrNotReady is returned by Upgrade if the new process exited before it called Ready.
+var ErrNotReady = errors.New("new process exited before it was ready")
+
+// Upgrade starts a new process, e.g. of an upgraded binary, passing it the listening sockets of the
+// servers, and waits until the process calls Ready. The new process takes the sockets over by listening
+// on the same addresses with Listen, or adding the same systemd sockets, so no connection is refused
+// during the upgrade. The caller is expected to Shutdown the servers afterwards, draining the in-flight
+// requests while the new process accepts the new connections. The command is the executable of the
+// current process with its arguments if nil. The new process is killed if the context is done before
+// it's ready.
+func Upgrade(ctx context.Context, cmd *exec.Cmd, servers ...*Server) (*os.Process, error) {
+	if cmd == nil {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(exe, os.Args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	}
+	var passed []*listenerServer
+	for _, s := range servers {
+		s.mu.Lock()
+		passed = append(passed, s.servers...)
+		s.mu.Unlock()
+	}
+
+	var keys []string
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, ls := range passed {
+		fl, ok := ls.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %s can't be passed to another process", ls.key)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, url.QueryEscape(ls.key))
+		files = append(files, f)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+	cmd.ExtraFiles = append(slices.Clone(files), readyW)
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env,
+		envListeners+"="+strings.Join(keys, ","),
+		envReady+"="+strconv.Itoa(3+len(files)),
+	)
+	err = cmd.Start()
+	_ = readyW.Close()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	notified := make(chan error, 1)
+	go func() {
+		// the read fails with EOF once the new process exits without notifying
+		_, err := ready.Read(make([]byte, 1))
+		notified <- err
+	}()
+	select {
+	case err := <-notified:
+		if err != nil {
+			_ = cmd.Process.Kill()
+			if errors.Is(err, io.EOF) {
+				err = ErrNotReady
+			}
+			return nil, err
+		}
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return nil, ctx.Err()
+	}
+	for _, ls := range passed {
+		// the socket file is used by the new process
+		if ul, ok := ls.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return cmd.Process, nil
+}
+
+// Ready notifies the process which started the current one by Upgrade that it's serving, so it can
+// shut down. It must be called once all listeners are added. It's a no-op if the process wasn't
+// started by Upgrade.
+func Ready() error {
+	v, ok := os.LookupEnv(envReady)
+	if !ok {
+		return nil
+	}
+	_ = os.Unsetenv(envReady)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", envReady, err)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// inherited holds the listeners passed by the previous process, which are taken over by key.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []keyedListener
+	err       error
+}
+
+// keyedListener is a listener passed by the previous process with its key.
+type keyedListener struct {
+	key string
+	ln  net.Listener
+}
+
+// loadInherited creates the listeners of the descriptors passed by the previous process.
+func loadInherited() {
+	v, ok := os.LookupEnv(envListeners)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(envListeners)
+	if v == "" {
+		return
+	}
+	for i, escaped := range strings.Split(v, ",") {
+		key, err := url.QueryUnescape(escaped)
+		if err != nil {
+			inherited.err = fmt.Errorf("invalid %s: %w", envListeners, err)
+			return
+		}
+		f := os.NewFile(uintptr(3+i), key)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			inherited.err = fmt.Errorf("inherited listener %s: %w", key, err)
+			return
+		}
+		inherited.listeners = append(inherited.listeners, keyedListener{key: key, ln: ln})
+	}
+}
+
+// inheritedListener takes the listener of the key passed by the previous process over, or returns nil.
+func inheritedListener(key string) (net.Listener, error) {
+	inherited.once.Do(loadInherited)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if inherited.err != nil {
+		return nil, inherited.err
+	}
+	i := slices.IndexFunc(inherited.listeners, func(kl keyedListener) bool {
+		return kl.key == key
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	ln := inherited.listeners[i].ln
+	inherited.listeners = slices.Delete(inherited.listeners, i, i+1)
+	return ln, nil
+}
+
+// inheritedSystemdListeners takes the systemd sockets passed by the previous process over, keyed by
+// their name, or returns nil.
+func inheritedSystemdListeners() (map[string][]net.Listener, error) {
+	inherited.once.Do(loadInherited)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if inherited.err != nil {
+		return nil, inherited.err
+	}
+	var listeners map[string][]net.Listener
+	inherited.listeners = slices.DeleteFunc(inherited.listeners, func(kl keyedListener) bool {
+		name, ok := strings.CutPrefix(kl.key, systemdKeyPrefix)
+		if !ok {
+			return false
+		}
+		if listeners == nil {
+			listeners = make(map[string][]net.Listener)
+		}
+		listeners[name] = append(listeners[name], kl.ln)
+		return true
+	})
+	return listeners, nil
+}
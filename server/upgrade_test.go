@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const upgradeHelperEnv = "SERVER_UPGRADE_HELPER"
+
+// TestUpgradeHelper is the new process started by TestUpgrade.
+func TestUpgradeHelper(t *testing.T) {
+	if os.Getenv(upgradeHelperEnv) == "" {
+		t.Skip("started by TestUpgrade")
+	}
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "new")
+	}))
+	if _, err := s.Listen("tcp", "127.0.0.1:0", nil); err != nil {
+		os.Exit(1)
+	}
+	if err := Ready(); err != nil {
+		os.Exit(1)
+	}
+	_ = s.Serve()
+}
+
+func helperCommand(run string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run="+run)
+	cmd.Env = append(os.Environ(), upgradeHelperEnv+"=1")
+	return cmd
+}
+
+func TestUpgrade(t *testing.T) {
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "old")
+	}))
+	ln, err := s.Listen("tcp", "127.0.0.1:0", nil)
+	assert.NoError(t, err)
+	go func() { _ = s.Serve() }()
+	url := "http://" + ln.Addr().String()
+	get := func() string {
+		res, err := http.Get(url)
+		if err != nil {
+			return err.Error()
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+	assert.Equal(t, "old", get())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	proc, err := Upgrade(ctx, helperCommand("^TestUpgradeHelper$"), s)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer proc.Kill()
+	assert.NoError(t, s.Shutdown(ctx))
+	http.DefaultClient.CloseIdleConnections()
+	assert.Equal(t, "new", get())
+}
+
+func TestUpgrade_NotReady(t *testing.T) {
+	s := New(http.NotFoundHandler())
+	_, err := s.Listen("tcp", "127.0.0.1:0", nil)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = Upgrade(ctx, helperCommand("^$"), s)
+	assert.ErrorIs(t, err, ErrNotReady)
+}
+
+func TestReady_NotUpgraded(t *testing.T) {
+	assert.NoError(t, Ready())
+}
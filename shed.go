@@ -0,0 +1,32 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// ShedFunc decides whether a request matched by the route is rejected at the passed load, the number
+// of requests being served by the proxy.
+type ShedFunc func(r *http.Request, route Route, load int32) bool
+
+// LoadShedding configures the rejection of requests while the proxy is overloaded, preserving the
+// capacity for the high-priority routes. The shed requests are answered with HTTP 503 service
+// unavailable and a Retry-After header.
+type LoadShedding struct {
+	// MaxLoad is the load above which the routes with a priority lower than MinPriority are shed.
+	MaxLoad int32
+	// MinPriority is the lowest route priority served above MaxLoad, see Route.SetPriority.
+	MinPriority int
+	// Shed replaces the default decision if set.
+	Shed ShedFunc
+	// RetryAfter is the delay of the Retry-After header, DefaultRetryAfter if zero.
+	RetryAfter time.Duration
+}
+
+// shed reports whether the request is rejected.
+func (ls *LoadShedding) shed(r *http.Request, route Route, load int32) bool {
+	if ls.Shed != nil {
+		return ls.Shed(r, route, load)
+	}
+	return load > ls.MaxLoad && route.Priority < ls.MinPriority
+}
@@ -0,0 +1,53 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadShedding(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.HandlePath(NewRoute("GET", "/health").SetPriority(10))
+	pm.LoadShedding = &LoadShedding{MaxLoad: 5, MinPriority: 10}
+
+	tests := []struct {
+		name     string
+		load     int32
+		target   string
+		wantCode int
+	}{
+		{"Test low priority under threshold", 4, "/users", http.StatusOK},
+		{"Test low priority above threshold", 5, "/users", http.StatusServiceUnavailable},
+		{"Test high priority above threshold", 5, "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the load includes the request itself
+			atomic.StoreInt32(&pm.load, tt.load)
+			defer atomic.StoreInt32(&pm.load, 0)
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusServiceUnavailable {
+				assert.Equal(t, "1", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestLoadSheddingFunc(t *testing.T) {
+	pm := newMiddlewareTestMux(t)
+	pm.PassPaths("GET", "/users", "/reports")
+	pm.LoadShedding = &LoadShedding{
+		Shed: func(r *http.Request, route Route, load int32) bool {
+			return route.Path == "/reports" && r.URL.Query().Get("full") != ""
+		},
+	}
+
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/reports").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(pm, "GET", "/reports?full=1").Code)
+}
@@ -0,0 +1,11 @@
+package reverseproxy
+
+import "net/http"
+
+// RequestSigner signs the outbound requests of a route, e.g. with AWS SigV4 for S3 origins or with an
+// HMAC, see the signing package.
+type RequestSigner interface {
+	// SignRequest signs the request directed to the backend, once it's rewritten, its headers are
+	// merged and the modifiers ran. It's called for every attempt, e.g. of hedged requests.
+	SignRequest(r *http.Request) error
+}
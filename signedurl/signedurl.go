@@ -0,0 +1,143 @@
+// Package signedurl grants time-limited access to protected routes through HMAC-signed URLs. A link is
+// signed with an expiry time by the application issuing it, and validated by the proxy before the
+// request is forwarded to the private upstream content:
+//
+//	s := signedurl.New([]byte("secret"))
+//	link := s.Sign(&url.URL{Path: "/files/report.pdf"}, time.Now().Add(time.Hour))
+//	pm.UseGroup("files", s.Middleware)
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+const (
+	// DefaultExpiresParam is the default query parameter holding the expiry time as Unix seconds.
+	DefaultExpiresParam = "expires"
+	// DefaultSignatureParam is the default query parameter holding the signature.
+	DefaultSignatureParam = "signature"
+)
+
+var (
+	// ErrMissingSignature is returned for URLs without a signature or expiry time.
+	ErrMissingSignature = errors.New("signedurl: missing signature")
+	// ErrInvalidSignature is returned for URLs whose signature doesn't match any key.
+	ErrInvalidSignature = errors.New("signedurl: invalid signature")
+	// ErrExpired is returned for URLs whose expiry time passed.
+	ErrExpired = errors.New("signedurl: expired")
+)
+
+// Signer signs and validates URLs. The signature is an HMAC-SHA256 of the escaped path and the query
+// parameters including the expiry time, so none of them can be changed. The host isn't signed, so links
+// stay valid behind several domains.
+type Signer struct {
+	// Keys holds the HMAC keys. URLs are signed with the first key and validated with all of them, so
+	// keys can be rotated by prepending the new key.
+	Keys [][]byte
+	// ExpiresParam and SignatureParam name the query parameters, DefaultExpiresParam and
+	// DefaultSignatureParam if empty.
+	ExpiresParam   string
+	SignatureParam string
+	// KeepParams forwards the signature parameters to the upstream, they're removed by default.
+	KeepParams bool
+}
+
+// New creates a signer with the keys, see Signer.Keys.
+func New(keys ...[]byte) *Signer {
+	return &Signer{Keys: keys}
+}
+
+// Sign returns a copy of the URL with the expiry time and its signature added to the query.
+func (s *Signer) Sign(u *url.URL, expires time.Time) *url.URL {
+	signed := *u
+	query := u.Query()
+	query.Del(s.signatureParam())
+	query.Set(s.expiresParam(), strconv.FormatInt(expires.Unix(), 10))
+	signed.RawQuery = query.Encode()
+	query.Set(s.signatureParam(), s.sign(s.Keys[0], signed.EscapedPath(), signed.RawQuery))
+	signed.RawQuery = query.Encode()
+	return &signed
+}
+
+// Verify validates the signature and expiry time of the URL at the passed time.
+func (s *Signer) Verify(u *url.URL, now time.Time) error {
+	query := u.Query()
+	signature, expires := query.Get(s.signatureParam()), query.Get(s.expiresParam())
+	if signature == "" || expires == "" {
+		return ErrMissingSignature
+	}
+	query.Del(s.signatureParam())
+	path, rawQuery := u.EscapedPath(), query.Encode()
+	valid := false
+	for _, key := range s.Keys {
+		if hmac.Equal([]byte(signature), []byte(s.sign(key, path, rawQuery))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Middleware returns a handler passing the requests with a valid signed URL to next, without the
+// signature parameters unless KeepParams is set. The other requests are answered with HTTP 403 forbidden.
+func (s *Signer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace := reverseproxy.TraceFromContext(r.Context())
+		if err := s.Verify(r.URL, time.Now()); err != nil {
+			trace.Add("signedurl", err.Error())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		trace.Add("signedurl", "valid")
+		if !s.KeepParams {
+			query := r.URL.Query()
+			query.Del(s.expiresParam())
+			query.Del(s.signatureParam())
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sign returns the signature of the escaped path and the encoded query.
+func (s *Signer) sign(key []byte, path, rawQuery string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path + "?" + rawQuery))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// expiresParam returns the name of the expiry time parameter.
+func (s *Signer) expiresParam() string {
+	if s.ExpiresParam != "" {
+		return s.ExpiresParam
+	}
+	return DefaultExpiresParam
+}
+
+// signatureParam returns the name of the signature parameter.
+func (s *Signer) signatureParam() string {
+	if s.SignatureParam != "" {
+		return s.SignatureParam
+	}
+	return DefaultSignatureParam
+}
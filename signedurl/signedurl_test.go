@@ -0,0 +1,95 @@
+package signedurl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	s := New([]byte("secret"))
+	now := time.Now()
+	link := s.Sign(&url.URL{Path: "/files/report.pdf", RawQuery: "download=1"}, now.Add(time.Hour))
+	assert.Equal(t, "1", link.Query().Get("download"))
+
+	tamper := func(f func(u *url.URL)) *url.URL {
+		u := *link
+		f(&u)
+		return &u
+	}
+	tests := []struct {
+		name string
+		url  *url.URL
+		keys [][]byte
+		now  time.Time
+		want error
+	}{
+		{"Test valid link", link, nil, now, nil},
+		{"Test expired link", link, nil, now.Add(2 * time.Hour), ErrExpired},
+		{"Test changed path", tamper(func(u *url.URL) { u.Path = "/files/secret.pdf" }), nil, now, ErrInvalidSignature},
+		{"Test added parameter", tamper(func(u *url.URL) { u.RawQuery += "&admin=1" }), nil, now, ErrInvalidSignature},
+		{"Test extended expiry", tamper(func(u *url.URL) {
+			q := u.Query()
+			q.Set("expires", "99999999999")
+			u.RawQuery = q.Encode()
+		}), nil, now, ErrInvalidSignature},
+		{"Test unsigned link", &url.URL{Path: "/files/report.pdf"}, nil, now, ErrMissingSignature},
+		{"Test other key", link, [][]byte{[]byte("other")}, now, ErrInvalidSignature},
+		{"Test rotated key", link, [][]byte{[]byte("new"), []byte("secret")}, now, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := s
+			if tt.keys != nil {
+				verifier = New(tt.keys...)
+			}
+			assert.ErrorIs(t, verifier.Verify(tt.url, tt.now), tt.want)
+		})
+	}
+}
+
+func TestSigner_Middleware(t *testing.T) {
+	var forwarded string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.URL.RequestURI()
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name          string
+		signer        *Signer
+		target        string
+		sign          bool
+		wantStatus    int
+		wantForwarded string
+	}{
+		{"Test valid link", New([]byte("secret")), "/files/a.pdf?download=1", true, http.StatusOK, "/files/a.pdf?download=1"},
+		{"Test kept parameters", &Signer{Keys: [][]byte{[]byte("secret")}, KeepParams: true, ExpiresParam: "e", SignatureParam: "s"}, "/files/a.pdf", true, http.StatusOK, "/files/a.pdf?e="},
+		{"Test unsigned link", New([]byte("secret")), "/files/a.pdf", false, http.StatusForbidden, ""},
+		{"Test unprotected route", New([]byte("secret")), "/public", false, http.StatusOK, "/public"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := reverseproxy.New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(reverseproxy.NewRoute("GET", "/files/*path").SetGroup("files"))
+			pm.PassPath("GET", "/public")
+			pm.UseGroup("files", tt.signer.Middleware)
+
+			forwarded = ""
+			target, _ := url.Parse(tt.target)
+			if tt.sign {
+				target = tt.signer.Sign(target, time.Now().Add(time.Minute))
+			}
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, httptest.NewRequest("GET", target.RequestURI(), nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, forwarded, tt.wantForwarded)
+		})
+	}
+}
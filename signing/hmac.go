@@ -0,0 +1,69 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HMAC signs requests with an HMAC-SHA256 of the request target and headers, sent in a Signature
+// header as defined by the HTTP Signatures draft (draft-cavage-http-signatures):
+//
+//	Signature: keyId="proxy",algorithm="hmac-sha256",headers="(request-target) host date",signature="..."
+type HMAC struct {
+	KeyID string
+	Key   []byte
+	// Headers names the signed headers in order, "(request-target)", "host" and "date" if empty. The
+	// pseudo header (request-target) is the lower-case method and the request URI. A missing Date header
+	// is set to the signing time.
+	Headers []string
+	// Now returns the signing time, time.Now if nil.
+	Now func() time.Time
+}
+
+// DefaultSignedHeaders are the headers signed by HMAC signers without Headers.
+var DefaultSignedHeaders = []string{"(request-target)", "host", "date"}
+
+// SignRequest sets the Signature header of the request.
+func (s *HMAC) SignRequest(r *http.Request) error {
+	headers := s.Headers
+	if len(headers) == 0 {
+		headers = DefaultSignedHeaders
+	}
+	if r.Header.Get("Date") == "" {
+		now := time.Now
+		if s.Now != nil {
+			now = s.Now
+		}
+		r.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+	}
+	lines := make([]string, len(headers))
+	for i, name := range headers {
+		name = strings.ToLower(name)
+		switch name {
+		case "(request-target)":
+			lines[i] = name + ": " + strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			lines[i] = name + ": " + host
+		default:
+			values := r.Header.Values(name)
+			if len(values) == 0 {
+				return fmt.Errorf("signing: missing signed header %s", name)
+			}
+			lines[i] = name + ": " + strings.Join(values, ", ")
+		}
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="hmac-sha256",headers="%s",signature="%s"`,
+		s.KeyID, strings.ToLower(strings.Join(headers, " ")), base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return nil
+}
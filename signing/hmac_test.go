@@ -0,0 +1,67 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMAC(t *testing.T) {
+	var signature, date, host string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature, date, host = r.Header.Get("Signature"), r.Header.Get("Date"), r.Host
+	}))
+	defer origin.Close()
+	originURL, _ := url.Parse(origin.URL)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sign := func(lines string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(lines))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name          string
+		signer        *HMAC
+		header        http.Header
+		wantStatus    int
+		wantSignature string
+	}{
+		{"Test default headers", &HMAC{KeyID: "proxy", Key: []byte("secret"), Now: func() time.Time { return now }}, nil, http.StatusOK,
+			`keyId="proxy",algorithm="hmac-sha256",headers="(request-target) host date",signature="` +
+				sign("(request-target): get /v2/items?id=1\nhost: "+originURL.Host+"\ndate: Wed, 01 May 2024 12:00:00 GMT") + `"`},
+		{"Test custom headers", &HMAC{KeyID: "proxy", Key: []byte("secret"), Headers: []string{"(request-target)", "X-Tenant"}}, http.Header{"X-Tenant": {"acme"}}, http.StatusOK,
+			`keyId="proxy",algorithm="hmac-sha256",headers="(request-target) x-tenant",signature="` +
+				sign("(request-target): get /v2/items?id=1\nx-tenant: acme") + `"`},
+		{"Test missing signed header", &HMAC{KeyID: "proxy", Key: []byte("secret"), Headers: []string{"X-Tenant"}}, nil, http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature, date, host = "", "", ""
+			pm, err := reverseproxy.New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(reverseproxy.NewRoute("GET", "/items").SetRewritePath("/v2/items").SetSigner(tt.signer))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/items?id=1", nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantSignature, signature)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, originURL.Host, host)
+				assert.NotEmpty(t, date)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Package signing provides request signers authenticating the proxy to its origins, set on the routes
+// with Route.SetSigner: AWS Signature Version 4 for S3 and API Gateway origins, and HMAC signatures of
+// the request target and headers for generic origins.
+//
+//	pm.HandlePath(reverseproxy.NewRoute("GET", "/assets/*path").
+//		SetSigner(&signing.SigV4{AccessKey: id, SecretKey: secret, Region: "eu-west-1", Service: "s3"}))
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UnsignedPayload is the payload hash of the requests whose body isn't signed.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// DefaultMaxPayload is the size limit of the bodies hashed by a SigV4 signer, if not set.
+const DefaultMaxPayload = 10 << 20
+
+// SigV4 signs requests with AWS Signature Version 4.
+type SigV4 struct {
+	AccessKey string
+	SecretKey string
+	// SessionToken is the token of temporary credentials, sent in the X-Amz-Security-Token header.
+	SessionToken string
+	Region       string
+	// Service is the signing name of the service, e.g. "s3" or "execute-api" for API Gateway.
+	Service string
+	// UnsignedPayload skips hashing the request bodies, which are read into memory otherwise. Only S3
+	// accepts unsigned payloads.
+	UnsignedPayload bool
+	// MaxPayload limits the size of the hashed bodies, DefaultMaxPayload if zero, e.g. the
+	// MaxBufferedRequest of the mux. The signing of larger bodies fails with an *http.MaxBytesError,
+	// answered with HTTP 413 content too large.
+	MaxPayload int64
+	// Now returns the signing time, time.Now if nil.
+	Now func() time.Time
+}
+
+// SignRequest sets the X-Amz-Date and Authorization headers of the request, and the X-Amz-Content-Sha256
+// header for S3. The host, the Content-Type and the X-Amz-* headers are signed.
+func (s *SigV4) SignRequest(r *http.Request) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	t := now().UTC()
+	amzDate, date := t.Format("20060102T150405Z"), t.Format("20060102")
+
+	limit := s.MaxPayload
+	if limit <= 0 {
+		limit = DefaultMaxPayload
+	}
+	payload, err := payloadHash(r, s.UnsignedPayload, limit)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	if s.Service == "s3" {
+		r.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	names, canonicalHeaders := canonicalHeaders(r)
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		canonicalPath(r.URL, s.Service != "s3"),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, part := range []string{s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+// payloadHash returns the hex SHA-256 hash of the request body of up to limit bytes, restoring the body
+// once it's read.
+func payloadHash(r *http.Request, unsigned bool, limit int64) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+	if unsigned {
+		return UnsignedPayload, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	_ = r.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if int64(len(b)) > limit {
+		return "", &http.MaxBytesError{Limit: limit}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	return hashHex(b), nil
+}
+
+// canonicalHeaders returns the sorted names of the signed headers and their canonical form: the host,
+// the Content-Type and the X-Amz-* headers, with their values trimmed.
+func canonicalHeaders(r *http.Request) ([]string, string) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, vs := range r.Header {
+		lower := strings.ToLower(name)
+		if lower != "content-type" && !strings.HasPrefix(lower, "x-amz-") {
+			continue
+		}
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[lower] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return names, b.String()
+}
+
+// canonicalPath returns the URI-encoded path, encoded twice for the services other than S3.
+func canonicalPath(u *url.URL, double bool) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	path = uriEncode(path, false)
+	if double {
+		path = uriEncode(path, false)
+	}
+	return path
+}
+
+// canonicalQuery returns the URI-encoded query parameters sorted by encoded name, then by encoded value.
+// The pairs are sorted before they're joined, so a name sorts before the longer names it prefixes.
+func canonicalQuery(query url.Values) string {
+	params := make([][2]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, [2]string{uriEncode(name, true), uriEncode(v, true)})
+		}
+	}
+	slices.SortFunc(params, func(a, b [2]string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+	joined := make([]string, len(params))
+	for i, p := range params {
+		joined[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// uriEncode percent-encodes the characters other than the unreserved ones, and the slashes if set.
+func uriEncode(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hashHex returns the hex SHA-256 hash of the data.
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
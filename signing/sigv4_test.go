@@ -0,0 +1,111 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The expected signatures are from the AWS Signature Version 4 test suite.
+func TestSigV4(t *testing.T) {
+	signer := &SigV4{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+		Now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantAuth string
+		wantSHA  string
+		unsigned bool
+		service  string
+	}{
+		{"Test get vanilla", "GET", "/", "", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", "", false, ""},
+		{"Test post vanilla", "POST", "/", "", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b", "", false, ""},
+		{"Test s3 payload hash", "PUT", "/bucket/key", "hello", "SignedHeaders=host;x-amz-content-sha256;x-amz-date", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", false, "s3"},
+		{"Test s3 unsigned payload", "PUT", "/bucket/key", "hello", "SignedHeaders=host;x-amz-content-sha256;x-amz-date", UnsignedPayload, true, "s3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *signer
+			s.UnsignedPayload = tt.unsigned
+			if tt.service != "" {
+				s.Service = tt.service
+			}
+			var r *http.Request
+			if tt.body != "" {
+				r = httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			} else {
+				r = httptest.NewRequest(tt.method, tt.target, nil)
+				r.Body = http.NoBody
+			}
+			r.Host = "example.amazonaws.com"
+			assert.NoError(t, s.SignRequest(r))
+			assert.Contains(t, r.Header.Get("Authorization"), tt.wantAuth)
+			assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+			assert.Equal(t, tt.wantSHA, r.Header.Get("X-Amz-Content-Sha256"))
+			if tt.body != "" {
+				b, _ := io.ReadAll(r.Body)
+				assert.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"Test sorted names and values", "b=2&a=x%20y&a=1&c=%2F", "a=1&a=x%20y&b=2&c=%2F"},
+		{"Test name prefixing another", "list-type=2&a-b=2&list=x&a=1", "a=1&a-b=2&list=x&list-type=2"},
+		{"Test encoded names", "a%2Bb=1&a=2", "a=2&a%2Bb=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			assert.Equal(t, tt.want, canonicalQuery(r.URL.Query()))
+		})
+	}
+}
+
+func TestSigV4_MaxPayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPayload int64
+		body       string
+		wantErr    bool
+	}{
+		{"Test body within limit", 5, "hello", false},
+		{"Test body exceeding limit", 4, "hello", true},
+		{"Test default limit", 0, "hello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SigV4{AccessKey: "id", SecretKey: "secret", Region: "us-east-1", Service: "s3", MaxPayload: tt.maxPayload}
+			r := httptest.NewRequest("PUT", "/bucket/key", strings.NewReader(tt.body))
+			err := s.SignRequest(r)
+			if tt.wantErr {
+				var maxBytes *http.MaxBytesError
+				assert.ErrorAs(t, err, &maxBytes)
+				return
+			}
+			assert.NoError(t, err)
+			b, _ := io.ReadAll(r.Body)
+			assert.Equal(t, tt.body, string(b))
+		})
+	}
+}
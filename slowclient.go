@@ -0,0 +1,113 @@
+package reverseproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSlowClient is wrapped by the errors of responses aborted because the client stalled reading them.
+var ErrSlowClient = errors.New("slow client")
+
+// SlowClient configures the detection of clients stalling to read the responses. Without write
+// deadlines, a client which stops reading pins the upstream connection and the buffered response until
+// the connection is closed. A stalled client is detected when a write misses its deadline: the client
+// connection is aborted and the upstream response closed, recording an error wrapping ErrSlowClient in
+// the request metrics.
+type SlowClient struct {
+	// WriteTimeout limits how long a single write of the response body may block, e.g. 10s.
+	WriteTimeout time.Duration
+	// ResponseTimeout limits the total time of writing the response body, zero means unlimited.
+	ResponseTimeout time.Duration
+}
+
+// slowClientWriter sets the write deadlines of the response writes, detecting stalled clients.
+type slowClientWriter struct {
+	http.ResponseWriter
+	rc       *http.ResponseController
+	cfg      *SlowClient
+	x        *exchange
+	trace    *Trace
+	deadline time.Time
+	// unsupported is set if the writer doesn't support write deadlines, e.g. in tests.
+	unsupported bool
+}
+
+// newSlowClientWriter wraps the writer of the exchange.
+func newSlowClientWriter(w http.ResponseWriter, r *http.Request, cfg *SlowClient, x *exchange) *slowClientWriter {
+	sw := &slowClientWriter{
+		ResponseWriter: w,
+		rc:             http.NewResponseController(w),
+		cfg:            cfg,
+		x:              x,
+		trace:          TraceFromContext(r.Context()),
+	}
+	if cfg.ResponseTimeout > 0 {
+		sw.deadline = time.Now().Add(cfg.ResponseTimeout)
+	}
+	return sw
+}
+
+// setDeadline sets the deadline of the next write.
+func (w *slowClientWriter) setDeadline() {
+	if w.unsupported {
+		return
+	}
+	deadline := w.deadline
+	if w.cfg.WriteTimeout > 0 {
+		if d := time.Now().Add(w.cfg.WriteTimeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() {
+		return
+	}
+	if err := w.rc.SetWriteDeadline(deadline); err != nil {
+		w.unsupported = true
+	}
+}
+
+// Write writes the data within the write deadline.
+func (w *slowClientWriter) Write(b []byte) (int, error) {
+	w.setDeadline()
+	n, err := w.ResponseWriter.Write(b)
+	if err != nil {
+		w.fail(err)
+	}
+	return n, err
+}
+
+// Flush flushes the buffered data within the write deadline.
+func (w *slowClientWriter) Flush() {
+	w.setDeadline()
+	if err := w.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		w.fail(err)
+	}
+}
+
+// fail records the error of a write which missed its deadline.
+func (w *slowClientWriter) fail(err error) {
+	if !isTimeout(err) || w.x.slow {
+		return
+	}
+	w.x.slow = true
+	err = fmt.Errorf("%w: %w", ErrSlowClient, err)
+	if w.x.err == nil {
+		w.x.err = err
+	}
+	w.trace.Add("client", "error: "+err.Error())
+}
+
+// reset clears the write deadline once the response is written, so it doesn't apply to the next
+// request of the connection.
+func (w *slowClientWriter) reset() {
+	if !w.unsupported {
+		_ = w.rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *slowClientWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowClient(t *testing.T) {
+	const size = 32 << 20
+	chunk := bytes.Repeat([]byte("x"), 32<<10)
+	upstreamErrs := make(chan error, 1)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		for n := 0; n < size && err == nil; n += len(chunk) {
+			_, err = w.Write(chunk)
+		}
+		upstreamErrs <- err
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassAnyPath("GET")
+	pm.SlowClient = &SlowClient{WriteTimeout: 100 * time.Millisecond}
+	metrics := make(chan RequestMetrics, 1)
+	pm.AddMetricsHook(func(m RequestMetrics) { metrics <- m })
+	srv := httptest.NewServer(pm)
+	defer srv.Close()
+
+	// the client sends the request without reading the response
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /large HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.NoError(t, err)
+
+	select {
+	case m := <-metrics:
+		assert.ErrorIs(t, m.Err, ErrSlowClient)
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow client not detected")
+	}
+	select {
+	case err := <-upstreamErrs:
+		assert.Error(t, err, "the upstream response must be closed")
+	case <-time.After(10 * time.Second):
+		t.Fatal("upstream response not closed")
+	}
+}
+
+func TestSlowClient_KeepAlive(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassAnyPath("GET")
+	pm.SlowClient = &SlowClient{WriteTimeout: 50 * time.Millisecond, ResponseTimeout: time.Second}
+	var errs []error
+	pm.AddMetricsHook(func(m RequestMetrics) { errs = append(errs, m.Err) })
+	srv := httptest.NewServer(pm)
+	defer srv.Close()
+
+	// the deadline of the first response must not expire the second request of the connection
+	client := srv.Client()
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(srv.URL + "/")
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "ok", strings.TrimSpace(string(body)))
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, []error{nil, nil}, errs)
+}
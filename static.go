@@ -0,0 +1,167 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// spaIndexFile is the document served by the SPA mode when the requested file doesn't exist.
+const spaIndexFile = "/index.html"
+
+// staticHandler serves files of a local file system mounted under a path prefix.
+type staticHandler struct {
+	prefix   string
+	root     http.FileSystem
+	spa      bool
+	notFound http.HandlerFunc
+}
+
+// ServeHTTP handles the HTTP request.
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.notFound(w, r)
+		return
+	}
+	trace := TraceFromContext(r.Context())
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, h.prefix))
+	if h.exists(name) {
+		trace.Add("static", name)
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = name
+		http.FileServer(h.root).ServeHTTP(w, r2)
+		return
+	}
+	if h.spa && h.exists(spaIndexFile) {
+		trace.Add("static", spaIndexFile+" (spa fallback)")
+		h.serveIndex(w, r)
+		return
+	}
+	trace.Add("static", "not found")
+	h.notFound(w, r)
+}
+
+// exists returns whether name is a regular file or a directory containing an index file.
+func (h *staticHandler) exists(name string) bool {
+	f, err := h.root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if stat.IsDir() {
+		return h.exists(path.Join(name, spaIndexFile))
+	}
+	return true
+}
+
+// serveIndex writes the SPA index file.
+func (h *staticHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	f, err := h.root.Open(spaIndexFile)
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), f)
+}
+
+// ServeStatic serves the files of the local directory dir under the specified path prefix.
+// Mounting at "/" makes the directory the fallback for all requests not matched by another route.
+func (pm *ReverseProxyMux) ServeStatic(prefix, dir string) *ReverseProxyMux {
+	return pm.serveFiles(prefix, http.Dir(dir), false)
+}
+
+// ServeSPA serves a single page application from the local directory dir under the specified path prefix.
+// Requests for files which don't exist are answered with the index.html of the directory, so the client-side
+// router can handle them. Mounting at "/" makes the application the fallback for all requests not matched
+// by another route, which allows hosting the frontend next to the proxied API.
+func (pm *ReverseProxyMux) ServeSPA(prefix, dir string) *ReverseProxyMux {
+	return pm.serveFiles(prefix, http.Dir(dir), true)
+}
+
+// serveFiles registers a static handler for the file system under the path prefix.
+func (pm *ReverseProxyMux) serveFiles(prefix string, root http.FileSystem, spa bool) *ReverseProxyMux {
+	prefix = "/" + strings.Trim(prefix, "/")
+	h := &staticHandler{
+		prefix:   prefix,
+		root:     root,
+		spa:      spa,
+		notFound: pm.notFound,
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		panic(ErrFrozen)
+	}
+	if prefix == "/" {
+		pm.fallback = h
+		if err := pm.swapRoutes(pm.routes); err != nil {
+			panic(err)
+		}
+		return pm
+	}
+	mounts := append(slices.Clone(pm.mounts), mount(h))
+	table, err := pm.buildTable(pm.routes, mounts)
+	if err != nil {
+		panic(err)
+	}
+	pm.mounts = mounts
+	pm.table.Store(table)
+	return pm
+}
+
+// register registers the static handler for the GET and HEAD methods.
+func (h *staticHandler) register(router *httprouter.Router) {
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		router.Handler(method, path.Join(h.prefix, "/*filepath"), h)
+	}
+}
+
+// notFound replies to the request with the NotFound handler of the route with the longest static
+// prefix of the path, the NotFoundHandler, or a negotiated HTTP 404 not found error.
+func (pm *ReverseProxyMux) notFound(w http.ResponseWriter, r *http.Request) {
+	if _, ok := w.(*matchWriter); ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if h := pm.table.Load().errorPages.notFoundHandler(r.URL.Path); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	if h := pm.current().NotFoundHandler; h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	NegotiatedError(http.StatusNotFound).ServeHTTP(w, r)
+}
+
+// methodNotAllowed replies to the request with the MethodNotAllowed handler of the route of the path,
+// the MethodNotAllowedHandler, or a negotiated HTTP 405 method not allowed error. The router sets the
+// Allow header before.
+func (pm *ReverseProxyMux) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if _, ok := w.(*matchWriter); ok {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h := pm.table.Load().errorPages.methodNotAllowedHandler(r.URL.Path); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	if h := pm.current().MethodNotAllowedHandler; h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	NegotiatedError(http.StatusMethodNotAllowed).ServeHTTP(w, r)
+}
@@ -0,0 +1,89 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStaticTestMux(t *testing.T) (*ReverseProxyMux, string) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "origin "+r.URL.Path)
+	}))
+	t.Cleanup(origin.Close)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0o644))
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	return pm, dir
+}
+
+func serve(pm http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestServeStatic(t *testing.T) {
+	pm, dir := newStaticTestMux(t)
+	pm.ServeStatic("/assets/", dir)
+	pm.PassPath("GET", "/api/version")
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"Test existing file", "GET", "/assets/app.js", http.StatusOK, "app"},
+		{"Test missing file", "GET", "/assets/missing.js", http.StatusNotFound, ""},
+		{"Test path traversal", "GET", "/assets/../../etc/passwd", http.StatusNotFound, ""},
+		{"Test proxied route", "GET", "/api/version", http.StatusOK, "origin /api/version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, tt.method, tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeSPA(t *testing.T) {
+	pm, dir := newStaticTestMux(t)
+	pm.ServeSPA("/", dir)
+	pm.PassAnyPathUnder("GET", "/api")
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"Test existing file", "GET", "/app.js", http.StatusOK, "app"},
+		{"Test client-side route", "GET", "/users/42", http.StatusOK, "index"},
+		{"Test proxied route", "GET", "/api/users", http.StatusOK, "origin /api/users"},
+		{"Test unsupported method", "POST", "/users/42", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, tt.method, tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
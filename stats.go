@@ -0,0 +1,191 @@
+package reverseproxy
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// statsSlots is the number of slots the stats window is divided into, so the window rolls in steps
+	// of a tenth of its length.
+	statsSlots = 10
+	// latencyBuckets is the number of latency histogram buckets, 4 per doubling from 100µs to ~100s.
+	latencyBuckets = 80
+	// latencyMin is the upper bound of the first histogram bucket.
+	latencyMin = 100 * time.Microsecond
+)
+
+// LatencyStats are the request counts and latency percentiles of a route or upstream in the stats
+// window. The percentiles are estimated from a histogram, overestimating them by less than 20%.
+type LatencyStats struct {
+	Requests int64         `json:"requests"`
+	Errors   int64         `json:"errors"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+}
+
+// Stats are the rolling request statistics of the mux, see EnableStats.
+type Stats struct {
+	// Window is the period covered by the stats.
+	Window time.Duration `json:"window"`
+	// Routes holds the stats by route path pattern.
+	Routes map[string]LatencyStats `json:"routes"`
+	// Upstreams holds the stats by backend URL.
+	Upstreams map[string]LatencyStats `json:"upstreams"`
+}
+
+// EnableStats collects rolling request statistics over the window, e.g. a minute, returned by Stats.
+// Requests failing with an error or answered with a 5xx status count as errors. It registers a metrics
+// hook, and must be called before serving.
+func (pm *ReverseProxyMux) EnableStats(window time.Duration) *ReverseProxyMux {
+	c := &statsCollector{window: window, slot: max(window/statsSlots, time.Millisecond)}
+	pm.stats = c
+	return pm.AddMetricsHook(c.observe)
+}
+
+// Stats returns the request statistics of the routes and upstreams in the stats window. It's empty
+// if the stats aren't enabled, see EnableStats.
+func (pm *ReverseProxyMux) Stats() Stats {
+	if pm.stats == nil {
+		return Stats{Routes: map[string]LatencyStats{}, Upstreams: map[string]LatencyStats{}}
+	}
+	return pm.stats.snapshot(time.Now())
+}
+
+// statsCollector aggregates the request metrics in a ring of time slots.
+type statsCollector struct {
+	window, slot time.Duration
+	mu           sync.Mutex
+	slots        [statsSlots]statsSlot
+}
+
+// statsSlot holds the histograms of the requests of a time slot.
+type statsSlot struct {
+	start     time.Time
+	routes    map[string]*histogram
+	upstreams map[string]*histogram
+}
+
+// histogram counts the requests and errors by latency bucket.
+type histogram struct {
+	requests, errors int64
+	buckets          [latencyBuckets]int64
+}
+
+// observe records the metrics of a request.
+func (c *statsCollector) observe(m RequestMetrics) {
+	now := time.Now()
+	failed := m.Err != nil || m.Status >= 500
+	b := latencyBucket(m.Duration)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.current(now)
+	s.routes = addSample(s.routes, m.Route, b, failed)
+	if m.Backend != nil {
+		s.upstreams = addSample(s.upstreams, m.Backend.url.String(), b, failed)
+	}
+}
+
+// current returns the slot of the time, resetting it if it holds an expired slot.
+func (c *statsCollector) current(now time.Time) *statsSlot {
+	start := now.Truncate(c.slot)
+	s := &c.slots[int(start.UnixNano()/int64(c.slot))%statsSlots]
+	if !s.start.Equal(start) {
+		*s = statsSlot{start: start}
+	}
+	return s
+}
+
+// addSample adds a request to the histogram of the key.
+func addSample(hs map[string]*histogram, key string, bucket int, failed bool) map[string]*histogram {
+	if hs == nil {
+		hs = make(map[string]*histogram)
+	}
+	h := hs[key]
+	if h == nil {
+		h = &histogram{}
+		hs[key] = h
+	}
+	h.requests++
+	if failed {
+		h.errors++
+	}
+	h.buckets[bucket]++
+	return hs
+}
+
+// snapshot merges the slots within the window.
+func (c *statsCollector) snapshot(now time.Time) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	routes, upstreams := make(map[string]*histogram), make(map[string]*histogram)
+	oldest := now.Truncate(c.slot).Add(-c.window)
+	for i := range c.slots {
+		s := &c.slots[i]
+		if !s.start.After(oldest) {
+			continue
+		}
+		merge(routes, s.routes)
+		merge(upstreams, s.upstreams)
+	}
+	return Stats{Window: c.window, Routes: summarize(routes), Upstreams: summarize(upstreams)}
+}
+
+// merge adds the histograms of src to dst.
+func merge(dst, src map[string]*histogram) {
+	for key, h := range src {
+		d := dst[key]
+		if d == nil {
+			d = &histogram{}
+			dst[key] = d
+		}
+		d.requests += h.requests
+		d.errors += h.errors
+		for i, n := range h.buckets {
+			d.buckets[i] += n
+		}
+	}
+}
+
+// summarize computes the stats of the histograms.
+func summarize(hs map[string]*histogram) map[string]LatencyStats {
+	stats := make(map[string]LatencyStats, len(hs))
+	for key, h := range hs {
+		stats[key] = LatencyStats{
+			Requests: h.requests,
+			Errors:   h.errors,
+			P50:      h.percentile(0.5),
+			P95:      h.percentile(0.95),
+			P99:      h.percentile(0.99),
+		}
+	}
+	return stats
+}
+
+// percentile returns the upper bound of the bucket holding the percentile.
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := int64(math.Ceil(p * float64(h.requests)))
+	var n int64
+	for i, count := range h.buckets {
+		if n += count; n >= rank && count > 0 {
+			return bucketBound(i)
+		}
+	}
+	return 0
+}
+
+// latencyBucket returns the histogram bucket of the latency.
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	i := int(math.Ceil(4 * math.Log2(float64(d)/float64(latencyMin))))
+	return min(i, latencyBuckets-1)
+}
+
+// bucketBound returns the upper latency bound of the histogram bucket.
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Exp2(float64(i)/4))
+}
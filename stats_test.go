@@ -0,0 +1,97 @@
+package reverseproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, pm.Stats().Routes)
+	pm.PassPaths("GET", "/ok", "/fail")
+	pm.EnableStats(time.Minute)
+	for _, target := range []string{"/ok", "/ok", "/fail"} {
+		pm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	stats := pm.Stats()
+	assert.Equal(t, time.Minute, stats.Window)
+	assert.Equal(t, int64(2), stats.Routes["/ok"].Requests)
+	assert.Equal(t, int64(0), stats.Routes["/ok"].Errors)
+	assert.Equal(t, int64(1), stats.Routes["/fail"].Errors)
+	assert.Positive(t, stats.Routes["/ok"].P99)
+	assert.Equal(t, LatencyStats{Requests: 3, Errors: 1}, withoutPercentiles(stats.Upstreams[origin.URL]))
+}
+
+func withoutPercentiles(s LatencyStats) LatencyStats {
+	s.P50, s.P95, s.P99 = 0, 0, 0
+	return s
+}
+
+func TestStatsCollector(t *testing.T) {
+	c := &statsCollector{window: time.Minute, slot: 6 * time.Second}
+	b := &Backend{url: &url.URL{Scheme: "http", Host: "backend"}}
+	for i := 1; i <= 100; i++ {
+		m := RequestMetrics{Route: "/r", Status: http.StatusOK, Duration: time.Duration(i) * time.Millisecond, Backend: b}
+		if i%10 == 0 {
+			m.Err = errors.New("failed")
+		}
+		c.observe(m)
+	}
+	c.observe(RequestMetrics{Route: "/r", Status: http.StatusBadGateway, Duration: time.Millisecond})
+
+	now := time.Now()
+	s := c.snapshot(now).Routes["/r"]
+	assert.Equal(t, int64(101), s.Requests)
+	assert.Equal(t, int64(11), s.Errors)
+	assertWithin(t, 50*time.Millisecond, s.P50)
+	assertWithin(t, 95*time.Millisecond, s.P95)
+	assertWithin(t, 99*time.Millisecond, s.P99)
+	assert.Equal(t, int64(100), c.snapshot(now).Upstreams["http://backend"].Requests)
+
+	// the requests roll out of the window
+	assert.Empty(t, c.snapshot(now.Add(time.Minute+c.slot)).Routes)
+	c.observe(RequestMetrics{Route: "/r", Duration: time.Millisecond})
+	assert.Equal(t, int64(102), c.snapshot(time.Now()).Routes["/r"].Requests)
+}
+
+// assertWithin asserts that the estimated percentile is within the bucket error of the actual value.
+func assertWithin(t *testing.T, want, got time.Duration) {
+	t.Helper()
+	assert.GreaterOrEqual(t, got, want)
+	assert.Less(t, float64(got), 1.2*float64(want))
+}
+
+func TestLatencyBucket(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		want    int
+	}{
+		{0, 0},
+		{latencyMin, 0},
+		{2 * latencyMin, 4},
+		{time.Second, 54},
+		{time.Hour, latencyBuckets - 1},
+	}
+	for _, tt := range tests {
+		b := latencyBucket(tt.latency)
+		assert.Equal(t, tt.want, b, tt.latency.String())
+		if tt.latency > 0 && b < latencyBuckets-1 {
+			assert.GreaterOrEqual(t, bucketBound(b), tt.latency)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// StatusRewrite maps a status code of the upstream responses to the status code answered to the
+// clients, e.g. 503 to 502, or 404 to 200 with an empty body.
+type StatusRewrite struct {
+	// From is the status code of the upstream response.
+	From int
+	// To is the status code answered instead.
+	To int
+	// DiscardBody replaces the body of the upstream response by an empty one.
+	DiscardBody bool
+}
+
+// rewriteStatus applies the first rule of the route, or else of the mux, matching the status code of
+// the response.
+func rewriteStatus(res *http.Response, route, mux []StatusRewrite, trace *Trace) {
+	for _, rules := range [][]StatusRewrite{route, mux} {
+		for _, rule := range rules {
+			if rule.From != res.StatusCode {
+				continue
+			}
+			trace.Add("status", strconv.Itoa(rule.From)+" -> "+strconv.Itoa(rule.To))
+			res.StatusCode = rule.To
+			res.Status = strconv.Itoa(rule.To) + " " + http.StatusText(rule.To)
+			if rule.DiscardBody {
+				discardBody(res)
+			}
+			return
+		}
+	}
+}
+
+// discardBody replaces the body of the response by an empty one, removing the headers describing the
+// discarded body.
+func discardBody(res *http.Response) {
+	if res.Body != nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		_ = res.Body.Close()
+	}
+	res.Body = http.NoBody
+	res.ContentLength = 0
+	res.TransferEncoding = nil
+	res.Uncompressed = false
+	res.Header.Set("Content-Length", "0")
+	for _, name := range []string{"Content-Type", "Content-Encoding", "Content-Range", "ETag", "Last-Modified"} {
+		res.Header.Del(name)
+	}
+}
@@ -0,0 +1,55 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_AddStatusRewrite(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"upstream"`)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, "upstream body")
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.StatusRewrites = []StatusRewrite{{From: 503, To: 502}, {From: 404, To: 410}}
+	pm.HandlePath(NewRoute("GET", "/status/:code").
+		AddStatusRewrite(StatusRewrite{From: 404, To: 200, DiscardBody: true}).
+		AddStatusRewrite(StatusRewrite{From: 404, To: 204}).
+		SetModifyResponse(func(res *http.Response) error {
+			res.Header.Set("X-Status", strconv.Itoa(res.StatusCode))
+			return nil
+		}))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantType   string
+	}{
+		{"Test route rule", "/status/404", http.StatusOK, "", ""},
+		{"Test mux rule", "/status/503", http.StatusBadGateway, "upstream body", "text/plain"},
+		{"Test no rule", "/status/500", http.StatusInternalServerError, "upstream body", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, strconv.Itoa(tt.wantStatus), w.Header().Get("X-Status"), "modifiers should see the rewritten status")
+		})
+	}
+	assert.Empty(t, serve(pm, "GET", "/status/404").Header().Get("ETag"))
+}
@@ -0,0 +1,66 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+
+	httputilx "github.com/open-webtech/go-reverse-proxy/httputil"
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// Stub is a response answered by a route without contacting the upstream, see Route.SetStubResponse.
+type Stub struct {
+	// Status is the status code, 200 if zero.
+	Status int
+	Header http.Header
+	// Body is a Go template rendered with the StubData of the request, e.g. {{ .Params.ByName "id" }}.
+	Body string
+}
+
+// StubData is the data of the stub body templates.
+type StubData struct {
+	Method    string
+	Path      string
+	Query     url.Values
+	Header    http.Header
+	Params    proxyctx.Params
+	RequestID string
+}
+
+// parseStub parses the body template of the stub of the route.
+func parseStub(route Route) (*template.Template, error) {
+	return template.New(route.Path).Parse(route.Stub.Body)
+}
+
+// serveStub answers the request with the stub response of the route.
+func (h *routeHandler) serveStub(w http.ResponseWriter, r *http.Request) {
+	stub := h.route.Stub
+	TraceFromContext(r.Context()).Add("stub", "response")
+	var body bytes.Buffer
+	err := h.stub.Execute(&body, StubData{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.Query(),
+		Header:    r.Header,
+		Params:    proxyctx.RouteParams(r.Context()),
+		RequestID: proxyctx.RequestID(r.Context()),
+	})
+	if err != nil {
+		h.pm.logf("stub of %s: %v", describeRequest(r), err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	httputilx.CopyHeader(w.Header(), stub.Header)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	status := stub.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body.Bytes())
+	}
+}
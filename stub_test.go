@@ -0,0 +1,68 @@
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_SetStubResponse(t *testing.T) {
+	var upstreamCalls int
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET|HEAD", "/users/:id").SetStubResponse(http.StatusOK,
+		http.Header{"Content-Type": {"application/json"}},
+		`{"id":"{{ .Params.ByName "id" }}","q":"{{ .Query.Get "q" }}","ua":"{{ .Header.Get "User-Agent" }}"}`))
+	pm.HandlePath(NewRoute("POST", "/maintenance").SetStubResponse(http.StatusServiceUnavailable, nil, "down"))
+	pm.HandlePath(NewRoute("GET", "/broken").SetStubResponse(0, nil, `{{ .Missing }}`))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{"Test templated stub", "GET", "/users/42?q=x", http.StatusOK, "application/json", `{"id":"42","q":"x","ua":"test"}`},
+		{"Test HEAD stub", "HEAD", "/users/42", http.StatusOK, "application/json", ""},
+		{"Test static stub", "POST", "/maintenance", http.StatusServiceUnavailable, "", "down"},
+		{"Test template error", "GET", "/broken", http.StatusInternalServerError, "text/plain; charset=utf-8", "Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("User-Agent", "test")
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+	assert.Equal(t, 0, upstreamCalls)
+
+	assert.Panics(t, func() {
+		pm.HandlePath(NewRoute("GET", "/invalid").SetStubResponse(0, nil, "{{ .Bad"))
+	})
+}
+
+func TestRoute_SetStubResponse_Draining(t *testing.T) {
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/stub").SetStubResponse(0, nil, "ok"))
+	assert.NoError(t, pm.Backends()[0].Drain(context.Background()))
+
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("GET", "/stub", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
@@ -0,0 +1,158 @@
+package reverseproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ErrRouteNotFound is returned when no route is registered for the passed path.
+var ErrRouteNotFound = errors.New("route not found")
+
+// routeTable is an immutable routing table. Route changes build a new table, which atomically
+// replaces the current one, so the routes can change while requests are served.
+type routeTable struct {
+	router     *httprouter.Router
+	errorPages *errorPages
+	// connect tunnels the CONNECT requests through the middleware, see ConnectTunnel.
+	connect http.Handler
+}
+
+// buildTable builds a new routing table of the routes and mounts.
+func (pm *ReverseProxyMux) buildTable(routes []Route, mounts []mount) (table *routeTable, err error) {
+	defer func() {
+		// httprouter panics on conflicting routes
+		if val := recover(); val != nil {
+			table, err = nil, fmt.Errorf("invalid route: %v", val)
+		}
+	}()
+	table = &routeTable{
+		router:     pm.newRouter(),
+		errorPages: newErrorPages(routes),
+		connect:    pm.applyMiddleware(Route{Group: ConnectGroup}, http.HandlerFunc(pm.serveConnect)),
+	}
+	var fold *httprouter.Router
+	if pm.routerOpts.CaseInsensitive {
+		fold = httprouter.New()
+		table.router.NotFound = caseInsensitive(fold, table.router.NotFound)
+	}
+	handlers := make([]http.Handler, len(routes))
+	for i, route := range routes {
+		if handlers[i], err = pm.registerRoute(table.router, fold, route); err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Path, err)
+		}
+	}
+	if pm.routerOpts.ForwardOPTIONS {
+		forwardOPTIONS(table.router, fold, routes, handlers)
+	}
+	for _, h := range mounts {
+		h.register(table.router)
+	}
+	return table, nil
+}
+
+// newRouter creates a router with the router options, dispatching the unmatched and panicking requests
+// to the handlers of the mux. The caller must hold pm.mu.
+func (pm *ReverseProxyMux) newRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.RedirectTrailingSlash = pm.routerOpts.RedirectTrailingSlash
+	router.RedirectFixedPath = pm.routerOpts.RedirectFixedPath && !pm.routerOpts.CaseInsensitive
+	router.NotFound = http.HandlerFunc(pm.notFound)
+	if pm.fallback != nil {
+		router.NotFound = pm.fallback
+	}
+	router.MethodNotAllowed = http.HandlerFunc(pm.methodNotAllowed)
+	router.HandleOPTIONS = !pm.routerOpts.ForwardOPTIONS
+	router.GlobalOPTIONS = http.HandlerFunc(allowOptions)
+	router.PanicHandler = pm.handlePanic
+	for _, hook := range pm.routerHooks {
+		hook(router)
+	}
+	return router
+}
+
+// swapRoutes replaces the routes and the routing table. The TLS transports of the routes are kept by
+// the routes, and the idle connections of the ones of removed routes are closed. The caller must hold
+// pm.mu.
+func (pm *ReverseProxyMux) swapRoutes(routes []Route) error {
+	if pm.frozen {
+		return ErrFrozen
+	}
+	routes = slices.Clone(routes)
+	for i, route := range routes {
+		if route.TLS == nil {
+			routes[i].tls = nil
+			continue
+		}
+		t, err := newRouteTLS(route)
+		if err != nil {
+			return fmt.Errorf("invalid route %s: %w", route.Path, err)
+		}
+		routes[i].tls = t
+	}
+	table, err := pm.buildTable(routes, pm.mounts)
+	if err != nil {
+		return err
+	}
+	old := pm.routes
+	pm.routes = routes
+	pm.table.Store(table)
+	closeRemovedTLS(old, routes)
+	return nil
+}
+
+// AddRoute registers a route. It's safe to call while the proxy is serving requests.
+// An error is returned if the route conflicts with a registered route.
+func (pm *ReverseProxyMux) AddRoute(route Route) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.swapRoutes(append(slices.Clone(pm.routes), route))
+}
+
+// RemoveRoute unregisters the routes of the passed path. It's safe to call while the proxy is serving requests.
+// ErrRouteNotFound is returned if no route is registered for the path.
+func (pm *ReverseProxyMux) RemoveRoute(path string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	routes := slices.DeleteFunc(slices.Clone(pm.routes), func(r Route) bool {
+		return r.Path == path
+	})
+	if len(routes) == len(pm.routes) {
+		return fmt.Errorf("%w: %s", ErrRouteNotFound, path)
+	}
+	return pm.swapRoutes(routes)
+}
+
+// ReplaceRoute replaces the routes registered for the path of the passed route with the route.
+// It's safe to call while the proxy is serving requests. ErrRouteNotFound is returned if no
+// route is registered for the path.
+func (pm *ReverseProxyMux) ReplaceRoute(route Route) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	routes := make([]Route, 0, len(pm.routes))
+	replaced := false
+	for _, r := range pm.routes {
+		if r.Path != route.Path {
+			routes = append(routes, r)
+			continue
+		}
+		if !replaced {
+			routes = append(routes, route)
+			replaced = true
+		}
+	}
+	if !replaced {
+		return fmt.Errorf("%w: %s", ErrRouteNotFound, route.Path)
+	}
+	return pm.swapRoutes(routes)
+}
+
+// Routes returns the routes registered on the proxy.
+func (pm *ReverseProxyMux) Routes() []Route {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return slices.Clone(pm.routes)
+}
@@ -0,0 +1,148 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTableTestMux(t *testing.T) *ReverseProxyMux {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	return pm
+}
+
+func TestAddRoute(t *testing.T) {
+	pm := newTableTestMux(t)
+	assert.Equal(t, http.StatusNotFound, serve(pm, "GET", "/users").Code)
+
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/users")))
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code)
+
+	err := pm.AddRoute(NewRoute("GET", "/users"))
+	assert.Error(t, err, "conflicting routes should be rejected")
+	assert.Len(t, pm.Routes(), 1)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/users").Code, "the table should be kept on error")
+
+	assert.Panics(t, func() {
+		pm.PassPath("GET", "/users")
+	})
+}
+
+func TestRemoveRoute(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.PassPath("POST", "/users")
+	pm.PassPath("GET", "/posts")
+
+	assert.NoError(t, pm.RemoveRoute("/users"))
+	assert.Equal(t, http.StatusNotFound, serve(pm, "GET", "/users").Code)
+	assert.Equal(t, http.StatusNotFound, serve(pm, "POST", "/users").Code)
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/posts").Code)
+	assert.Len(t, pm.Routes(), 1)
+
+	assert.ErrorIs(t, pm.RemoveRoute("/users"), ErrRouteNotFound)
+}
+
+func TestReplaceRoute(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET", "/users")
+
+	assert.NoError(t, pm.ReplaceRoute(NewRoute("GET", "/users").SetRewritePath("/api/users")))
+	w := serve(pm, "GET", "/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/api/users", w.Body.String())
+
+	assert.ErrorIs(t, pm.ReplaceRoute(NewRoute("GET", "/posts")), ErrRouteNotFound)
+}
+
+func TestAddRouteKeepsStaticMounts(t *testing.T) {
+	pm, dir := newStaticTestMux(t)
+	pm.ServeStatic("/assets", dir)
+
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/users")))
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/assets/app.js").Code)
+}
+
+func TestSetRouterOptions(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET", "/users")
+	pm.HandlePath(NewRoute("GET", "/users/:name/files/*path").SetModifyResponse(func(res *http.Response) error {
+		params := RouteParams(res.Request)
+		res.Header.Set("X-Params", params.ByName("name")+" "+params.ByName("path"))
+		return nil
+	}))
+	assert.Equal(t, RouterOptions{RedirectTrailingSlash: true, RedirectFixedPath: true}, pm.RouterOptions())
+
+	tests := []struct {
+		name         string
+		opts         RouterOptions
+		target       string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Test trailing slash redirect", pm.RouterOptions(), "/users/", http.StatusMovedPermanently, "/users", ""},
+		{"Test fixed path redirect", pm.RouterOptions(), "/USERS", http.StatusMovedPermanently, "/users", ""},
+		{"Test without trailing slash redirect", RouterOptions{RedirectFixedPath: true}, "/users/", http.StatusNotFound, "", ""},
+		{"Test without fixed path redirect", RouterOptions{RedirectTrailingSlash: true}, "/USERS", http.StatusNotFound, "", ""},
+		{"Test case-insensitive", RouterOptions{CaseInsensitive: true}, "/USERS", http.StatusOK, "", "/USERS"},
+		{"Test case-insensitive parameters", RouterOptions{CaseInsensitive: true, RedirectFixedPath: true}, "/Users/Ann/Files/A/b.txt", http.StatusOK, "", "/Users/Ann/Files/A/b.txt"},
+		{"Test case-insensitive not found", RouterOptions{CaseInsensitive: true}, "/posts", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, pm.SetRouterOptions(tt.opts))
+			w := serve(pm, "GET", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+	assert.Equal(t, "Ann /A/b.txt", serve(pm, "GET", "/USERS/Ann/FILES/A/b.txt").Header().Get("X-Params"))
+
+	pm.PassPath("GET", "/Posts")
+	assert.Error(t, pm.AddRoute(NewRoute("GET", "/posts")), "routes should conflict case-insensitively")
+}
+
+func TestOptions(t *testing.T) {
+	pm := newTableTestMux(t)
+	pm.PassPath("GET|POST", "/users")
+	pm.PassPath("DELETE", "/users")
+	pm.PassPath("*", "/posts")
+
+	tests := []struct {
+		name      string
+		opts      RouterOptions
+		target    string
+		wantCode  int
+		wantAllow string
+		wantBody  string
+	}{
+		{"Test automatic reply", RouterOptions{}, "/users", http.StatusNoContent, "DELETE, GET, OPTIONS, POST", ""},
+		{"Test route with OPTIONS method", RouterOptions{}, "/posts", http.StatusOK, "", "/posts"},
+		{"Test unknown path", RouterOptions{}, "/files", http.StatusNotFound, "", ""},
+		{"Test forwarded", RouterOptions{ForwardOPTIONS: true}, "/users", http.StatusOK, "", "/users"},
+		{"Test forwarded case-insensitive", RouterOptions{ForwardOPTIONS: true, CaseInsensitive: true}, "/Users", http.StatusOK, "", "/Users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, pm.SetRouterOptions(tt.opts))
+			w := serve(pm, "OPTIONS", tt.target)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantAllow, w.Header().Get("Allow"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Package tenancy routes the requests of a multi-tenant gateway to the upstreams of their tenants. The
+// tenant is extracted from the subdomain or a header of the request, and the outbound request is
+// directed to the upstream of the URL template with the tenant substituted:
+//
+//	t, err := tenancy.New("https://{tenant}.internal.svc", tenancy.FromSubdomain("example.com"))
+//	pm.Use(t.Middleware)
+//	pm.WrapDirector(t.WrapDirector)
+//
+// The upstream receives the tenant in the X-Tenant-ID header.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+)
+
+// DefaultHeader is the header passing the tenant to the upstream, if not set.
+const DefaultHeader = "X-Tenant-ID"
+
+// Placeholder is the placeholder of the tenant in the upstream template.
+const Placeholder = "{tenant}"
+
+// ErrTemplate is returned for upstream templates without a placeholder or not forming absolute URLs.
+var ErrTemplate = errors.New("tenancy: invalid upstream template")
+
+// Extractor returns the tenant of a request, or an empty string.
+type Extractor func(r *http.Request) string
+
+// FromSubdomain returns an extractor of the tenant from the subdomain of the domain in the Host of the
+// request, e.g. acme of acme.example.com for the domain example.com. Nested subdomains aren't tenants.
+func FromSubdomain(domain string) Extractor {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(r *http.Request) string {
+		host := strings.ToLower(r.Host)
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		tenant, ok := strings.CutSuffix(strings.TrimSuffix(host, "."), suffix)
+		if !ok || strings.Contains(tenant, ".") {
+			return ""
+		}
+		return tenant
+	}
+}
+
+// FromHeader returns an extractor of the tenant from the header of the request.
+func FromHeader(name string) Extractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// FirstOf returns an extractor of the first tenant found by the extractors.
+func FirstOf(extractors ...Extractor) Extractor {
+	return func(r *http.Request) string {
+		for _, extract := range extractors {
+			if tenant := extract(r); tenant != "" {
+				return tenant
+			}
+		}
+		return ""
+	}
+}
+
+// Router directs the requests to the upstreams of their tenants.
+type Router struct {
+	// Extract extracts the tenant of the requests.
+	Extract Extractor
+	// Header is the header passing the tenant to the upstream, DefaultHeader if empty. The header of
+	// the inbound request is replaced.
+	Header string
+	// Allow restricts the tenants, e.g. to the tenants of a registry. All valid tenants are allowed
+	// if nil.
+	Allow func(tenant string) bool
+
+	template string
+}
+
+// New creates a router directing the requests to the upstream template, an absolute URL with the
+// tenant placeholder in its host or path, e.g. https://{tenant}.internal.svc, with the tenant of the
+// extractor. It returns ErrTemplate if the template is invalid.
+func New(upstream string, extract Extractor) (*Router, error) {
+	if !strings.Contains(upstream, Placeholder) {
+		return nil, ErrTemplate
+	}
+	if u, err := url.Parse(strings.ReplaceAll(upstream, Placeholder, "tenant")); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, ErrTemplate
+	}
+	return &Router{Extract: extract, template: upstream}, nil
+}
+
+// Upstream returns the upstream URL of the tenant.
+func (t *Router) Upstream(tenant string) (*url.URL, error) {
+	if !valid(tenant) {
+		return nil, errors.New("tenancy: invalid tenant " + tenant)
+	}
+	return url.Parse(strings.ReplaceAll(t.template, Placeholder, tenant))
+}
+
+// Middleware returns a handler passing the requests of an allowed tenant to next, with the tenant
+// stored in the request context, see FromContext, and set in the tenant header. The tenants are
+// lower-cased DNS labels; the requests without a valid and allowed tenant are answered with HTTP 404
+// not found.
+func (t *Router) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace := reverseproxy.TraceFromContext(r.Context())
+		tenant := strings.ToLower(t.Extract(r))
+		if !valid(tenant) || (t.Allow != nil && !t.Allow(tenant)) {
+			trace.Add("tenant", "unknown "+tenant)
+			http.NotFound(w, r)
+			return
+		}
+		trace.Add("tenant", tenant)
+		r.Header.Set(t.header(), tenant)
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+// Direct directs the outbound request of a tenant to its upstream, keeping the path of the request
+// under the path of the upstream. The Host is set to the host of the upstream, unless the route
+// preserves the inbound Host or sets a custom one. It's a reverseproxy.Director for Route.SetDirector.
+func (t *Router) Direct(r *http.Request) {
+	tenant := FromContext(r.Context())
+	if tenant == "" {
+		return
+	}
+	u, err := t.Upstream(tenant)
+	if err != nil {
+		return
+	}
+	if r.Host == r.URL.Host {
+		r.Host = u.Host
+	}
+	r.URL.Scheme, r.URL.Host = u.Scheme, u.Host
+	if prefix := strings.TrimSuffix(u.Path, "/"); prefix != "" {
+		r.URL.Path = prefix + r.URL.Path
+		r.URL.RawPath = ""
+	}
+}
+
+// WrapDirector wraps the director of the mux, directing the requests of all routes to the upstreams
+// of their tenants, see ReverseProxyMux.WrapDirector.
+func (t *Router) WrapDirector(next reverseproxy.Director) reverseproxy.Director {
+	return func(r *http.Request) {
+		next(r)
+		t.Direct(r)
+	}
+}
+
+// header returns the name of the tenant header.
+func (t *Router) header() string {
+	if t.Header != "" {
+		return t.Header
+	}
+	return DefaultHeader
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx holding the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant of ctx stored by the Middleware, or an empty string.
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// valid reports whether the tenant is a lower-cased DNS label, so it can't change the upstream
+// beyond its placeholder.
+func valid(tenant string) bool {
+	if tenant == "" || len(tenant) > 63 || tenant[0] == '-' || tenant[len(tenant)-1] == '-' {
+		return false
+	}
+	for _, c := range tenant {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package tenancy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// transportFunc adapts a function to the http.RoundTripper interface.
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     error
+	}{
+		{"Test host template", "https://{tenant}.internal.svc", nil},
+		{"Test path template", "http://backend:8080/tenants/{tenant}", nil},
+		{"Test missing placeholder", "https://internal.svc", ErrTemplate},
+		{"Test relative template", "/{tenant}", ErrTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.template, FromHeader("X-Tenant"))
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestExtractors(t *testing.T) {
+	extract := FirstOf(FromHeader("X-Tenant"), FromSubdomain("example.com."))
+	tests := []struct {
+		name   string
+		host   string
+		header string
+		want   string
+	}{
+		{"Test subdomain", "acme.example.com", "", "acme"},
+		{"Test subdomain with port", "Acme.Example.com:8443", "", "acme"},
+		{"Test header first", "acme.example.com", "other", "other"},
+		{"Test nested subdomain", "a.acme.example.com", "", ""},
+		{"Test apex domain", "example.com", "", ""},
+		{"Test other domain", "acme.example.org", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+			}
+			assert.Equal(t, tt.want, extract(r))
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var outbound *http.Request
+	transport := transportFunc(func(r *http.Request) (*http.Response, error) {
+		outbound = r
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+	})
+
+	tests := []struct {
+		name       string
+		template   string
+		route      reverseproxy.Route
+		host       string
+		header     string
+		wantStatus int
+		wantURL    string
+		wantHost   string
+	}{
+		{"Test subdomain tenant", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users"), "acme.example.com", "", http.StatusOK, "https://acme.internal.svc/users?page=2", "acme.internal.svc"},
+		{"Test path template", "http://backend:8080/tenants/{tenant}/", reverseproxy.NewRoute("GET", "/users"), "acme.example.com", "", http.StatusOK, "http://backend:8080/tenants/acme/users?page=2", "backend:8080"},
+		{"Test preserved host", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users").SetPreserveHost(true), "acme.example.com", "", http.StatusOK, "https://acme.internal.svc/users?page=2", "acme.example.com"},
+		{"Test spoofed header replaced", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users"), "acme.example.com", "other", http.StatusOK, "https://acme.internal.svc/users?page=2", "acme.internal.svc"},
+		{"Test unknown tenant", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users"), "example.com", "", http.StatusNotFound, "", ""},
+		{"Test disallowed tenant", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users"), "blocked.example.com", "", http.StatusNotFound, "", ""},
+		{"Test invalid tenant", "https://{tenant}.internal.svc", reverseproxy.NewRoute("GET", "/users"), "a_b.example.com", "", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outbound = nil
+			tr, err := New(tt.template, FromSubdomain("example.com"))
+			assert.NoError(t, err)
+			tr.Allow = func(tenant string) bool { return tenant != "blocked" }
+			pm, err := reverseproxy.New("http://default.internal.svc", reverseproxy.WithTransport(transport))
+			assert.NoError(t, err)
+			pm.HandlePath(tt.route)
+			pm.Use(tr.Middleware)
+			pm.WrapDirector(tr.WrapDirector)
+
+			req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+			req.Host = tt.host
+			if tt.header != "" {
+				req.Header.Set(DefaultHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			pm.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantURL, outbound.URL.String())
+				assert.Equal(t, tt.wantHost, outbound.Host)
+				assert.Equal(t, "acme", outbound.Header.Get(DefaultHeader))
+			} else {
+				assert.Nil(t, outbound)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package reverseproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TraceHeader is the request header by which allowlisted clients request the decision trace of the proxy.
+// The value "header" returns the trace in the response header of the same name, the value "json" replaces
+// the response with a JSON document holding the trace.
+const TraceHeader = "X-Proxy-Trace"
+
+// Trace is the decision trace of a request, recording the decisions of the proxy pipeline stages.
+type Trace struct {
+	mu     sync.Mutex
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Status int         `json:"status"`
+	Steps  []TraceStep `json:"steps"`
+}
+
+// TraceStep is a decision of a proxy pipeline stage.
+type TraceStep struct {
+	Stage    string `json:"stage"`
+	Decision string `json:"decision"`
+}
+
+// Add records the decision of a stage. It's a no-op on a nil Trace, so the stages don't need
+// to check whether the request is traced.
+func (t *Trace) Add(stage, decision string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Steps = append(t.Steps, TraceStep{Stage: stage, Decision: decision})
+}
+
+// String returns the trace in the format of the trace response header.
+func (t *Trace) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	steps := make([]string, 0, len(t.Steps))
+	for _, step := range t.Steps {
+		steps = append(steps, step.Stage+"="+strconv.Quote(step.Decision))
+	}
+	return strings.Join(steps, ", ")
+}
+
+type traceKey struct{}
+
+// TraceFromContext returns the decision trace of the request context, or nil if the request isn't traced.
+func TraceFromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// EnableTrace allows the clients of the passed networks (CIDR notation) to request the decision trace
+// with the TraceHeader, replacing the networks allowed before. It's safe to call while the proxy is
+// serving requests, and returns ErrFrozen if the mux is frozen.
+func (pm *ReverseProxyMux) EnableTrace(cidrs ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.frozen {
+		return ErrFrozen
+	}
+	pm.traceNets.Store(&prefixes)
+	return nil
+}
+
+// startTrace returns the request with a decision trace attached and the writer returning the trace,
+// if the trace is requested by an allowlisted client.
+func (pm *ReverseProxyMux) startTrace(w http.ResponseWriter, r *http.Request) (*traceWriter, *http.Request) {
+	mode := r.Header.Get(TraceHeader)
+	if mode == "" {
+		return nil, r
+	}
+	r.Header.Del(TraceHeader)
+	if !pm.traceAllowed(r) {
+		return nil, r
+	}
+	t := &Trace{Method: r.Method, Path: r.URL.Path}
+	tw := &traceWriter{ResponseWriter: w, trace: t, json: mode == "json"}
+	return tw, r.WithContext(context.WithValue(r.Context(), traceKey{}, t))
+}
+
+// traceAllowed returns whether the client of the request is allowlisted.
+func (pm *ReverseProxyMux) traceAllowed(r *http.Request) bool {
+	addr, ok := remoteIP(r)
+	if !ok {
+		return false
+	}
+	nets := pm.traceNets.Load()
+	if nets == nil {
+		return false
+	}
+	for _, prefix := range *nets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceWriter is a http.ResponseWriter returning the decision trace in the response header or as JSON body.
+type traceWriter struct {
+	http.ResponseWriter
+	trace       *Trace
+	json        bool
+	wroteHeader bool
+}
+
+// WriteHeader records the status code and writes it with the trace header to the wrapped writer.
+func (w *traceWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.trace.mu.Lock()
+	w.trace.Status = status
+	w.trace.mu.Unlock()
+	if w.json {
+		return
+	}
+	w.Header().Set(TraceHeader, w.trace.String())
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the data to the wrapped writer, or discards it in the JSON mode.
+func (w *traceWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.json {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the buffered data of the wrapped writer, if supported.
+func (w *traceWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.json {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *traceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the JSON trace document in the JSON mode.
+func (w *traceWriter) finish() {
+	if !w.json {
+		return
+	}
+	header := w.ResponseWriter.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	w.trace.mu.Lock()
+	defer w.trace.mu.Unlock()
+	_ = json.NewEncoder(w.ResponseWriter).Encode(w.trace)
+}
@@ -0,0 +1,106 @@
+package reverseproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTraceTestMux(t *testing.T) *ReverseProxyMux {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(TraceHeader), "the trace header shouldn't be forwarded")
+		w.Header().Set("X-Origin", "yes")
+		_, _ = io.WriteString(w, "origin")
+	}))
+	t.Cleanup(origin.Close)
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, pm.EnableTrace("192.0.2.0/24"))
+	pm.RewritePath("GET", "/posts", "/api/posts")
+	return pm
+}
+
+func tracedRequest(mode, remoteAddr string) *http.Request {
+	r := httptest.NewRequest("GET", "/posts", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set(TraceHeader, mode)
+	return r
+}
+
+func TestTraceHeader(t *testing.T) {
+	pm := newTraceTestMux(t)
+
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, tracedRequest("header", "192.0.2.1:1234"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "origin", w.Body.String())
+	assert.Contains(t, w.Header().Get(TraceHeader), `route="GET /posts"`)
+	assert.Contains(t, w.Header().Get(TraceHeader), `rewrite="/posts -> /api/posts"`)
+}
+
+func TestTraceJSON(t *testing.T) {
+	pm := newTraceTestMux(t)
+
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, tracedRequest("json", "192.0.2.1:1234"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("X-Origin"))
+
+	var trace Trace
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trace))
+	assert.Equal(t, "GET", trace.Method)
+	assert.Equal(t, "/posts", trace.Path)
+	assert.Equal(t, http.StatusOK, trace.Status)
+	assert.Equal(t, []TraceStep{
+		{Stage: "route", Decision: "GET /posts"},
+		{Stage: "rewrite", Decision: "/posts -> /api/posts"},
+		{Stage: "upstream", Decision: pm.Remote().String()},
+	}, trace.Steps[:3])
+	assert.Len(t, trace.Steps, 4)
+	assert.Equal(t, "conn", trace.Steps[3].Stage)
+	assert.True(t, strings.HasPrefix(trace.Steps[3].Decision, "new connect="), trace.Steps[3].Decision)
+}
+
+func TestTraceNotAllowed(t *testing.T) {
+	pm := newTraceTestMux(t)
+
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, tracedRequest("json", "198.51.100.1:1234"))
+	assert.Equal(t, "origin", w.Body.String())
+	assert.Empty(t, w.Header().Get(TraceHeader))
+}
+
+func TestEnableTrace(t *testing.T) {
+	pm := newTraceTestMux(t)
+
+	// the networks can be changed while serving
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			pm.ServeHTTP(httptest.NewRecorder(), tracedRequest("header", "198.51.100.1:1234"))
+		}
+	}()
+	assert.NoError(t, pm.EnableTrace("198.51.100.0/24"))
+	<-done
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, tracedRequest("header", "198.51.100.1:1234"))
+	assert.NotEmpty(t, w.Header().Get(TraceHeader))
+
+	assert.Error(t, pm.EnableTrace("not a network"))
+	pm.Freeze()
+	assert.ErrorIs(t, pm.EnableTrace("192.0.2.0/24"), ErrFrozen)
+}
+
+func TestTraceNil(t *testing.T) {
+	var trace *Trace
+	assert.NotPanics(t, func() {
+		trace.Add("stage", "decision")
+	})
+}
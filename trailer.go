@@ -0,0 +1,31 @@
+package reverseproxy
+
+import (
+	"io"
+	"net/http"
+)
+
+// trailerBody is an upstream response body calling the trailer modifier of the route once it's read,
+// when the trailers of the response are known.
+type trailerBody struct {
+	io.ReadCloser
+	res      *http.Response
+	modifier ResponseModifier
+	x        *exchange
+	done     bool
+}
+
+// Read reads from the upstream body, calling the modifier at its end. A modifier error fails the read.
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF && !b.done {
+		b.done = true
+		if b.res.Trailer == nil {
+			b.res.Trailer = make(http.Header)
+		}
+		if merr := callModifier(b.modifier, b.res); merr != nil {
+			return n, newProxyError(ErrRewriteFailed, b.x, merr)
+		}
+	}
+	return n, err
+}
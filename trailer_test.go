@@ -0,0 +1,94 @@
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrailers(t *testing.T) {
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "checksum "+r.Trailer.Get("X-Checksum"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name        string
+		route       Route
+		wantBody    string
+		wantTrailer http.Header
+		wantHits    int32
+	}{
+		{"Test streamed response", NewRoute("POST", "/"), "checksum abc", http.Header{"Grpc-Status": {"0"}}, 2},
+		{"Test buffered response", NewRoute("POST", "/").SetBuffering(true), "checksum abc", http.Header{"Grpc-Status": {"0"}}, 2},
+		{"Test cached response", NewRoute("GET", "/").SetCache(Cache{TTL: time.Minute}), "checksum abc", http.Header{"Grpc-Status": {"0"}}, 2},
+		{"Test modified trailers", NewRoute("POST", "/").SetModifyTrailer(func(res *http.Response) error {
+			res.Trailer.Set("Grpc-Status", "13")
+			res.Trailer.Set("Grpc-Message", "rewritten")
+			return nil
+		}), "checksum abc", http.Header{"Grpc-Status": {"13"}, "Grpc-Message": {"rewritten"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(tt.route)
+			front := httptest.NewServer(pm)
+			defer front.Close()
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest(tt.route.Method[0], front.URL+"/", io.NopCloser(strings.NewReader("data")))
+				r.Trailer = http.Header{"X-Checksum": {"abc"}}
+				res, err := http.DefaultClient.Do(r)
+				if !assert.NoError(t, err) {
+					return
+				}
+				body, _ := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				assert.Equal(t, tt.wantBody, string(body))
+				assert.Equal(t, tt.wantTrailer, res.Trailer)
+			}
+			assert.Equal(t, tt.wantHits, hits.Load())
+		})
+	}
+}
+
+func TestRoute_SetModifyTrailer_Error(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = io.WriteString(w, "data")
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer origin.Close()
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.ErrorLog = log.New(io.Discard, "", 0)
+	pm.HandlePath(NewRoute("GET", "/").SetModifyTrailer(func(res *http.Response) error {
+		return errors.New("invalid status")
+	}))
+	front := httptest.NewServer(pm)
+	defer front.Close()
+
+	res, err := http.Get(front.URL + "/")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	_, err = io.ReadAll(res.Body)
+	assert.Error(t, err)
+	assert.Empty(t, res.Trailer.Get("Grpc-Status"))
+}
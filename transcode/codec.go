@@ -0,0 +1,291 @@
+package transcode
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Codec decodes bodies of a media type into generic values, and encodes them back. The values are the
+// ones of encoding/json with json.Number numbers: map[string]any, []any, string, json.Number, bool and nil.
+type Codec interface {
+	Decode(r io.Reader) (any, error)
+	Encode(w io.Writer, v any) error
+}
+
+// Registry holds the codecs by media type.
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// DefaultRegistry is the registry of the Transcoders without a Registry. It holds the JSON, XML and
+// form codecs.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates a registry of the JSON codec for application/json, the XML codec for
+// application/xml and text/xml, and the form codec for application/x-www-form-urlencoded.
+func NewRegistry() *Registry {
+	return (&Registry{}).
+		Register("application/json", JSON{}).
+		Register("application/xml", XML{}).
+		Register("text/xml", XML{}).
+		Register("application/x-www-form-urlencoded", Form{})
+}
+
+// Register registers the codec of the media type, replacing a registered one.
+func (reg *Registry) Register(mediaType string, c Codec) *Registry {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.codecs == nil {
+		reg.codecs = make(map[string]Codec)
+	}
+	reg.codecs[strings.ToLower(mediaType)] = c
+	return reg
+}
+
+// Register registers the codec of the media type in the DefaultRegistry.
+func Register(mediaType string, c Codec) {
+	DefaultRegistry.Register(mediaType, c)
+}
+
+// Lookup returns the codec of the media type, or of its structured syntax suffix, e.g. the JSON codec
+// for application/problem+json.
+func (reg *Registry) Lookup(mediaType string) (Codec, bool) {
+	mediaType = strings.ToLower(mediaType)
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if c, ok := reg.codecs[mediaType]; ok {
+		return c, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		c, ok := reg.codecs["application/"+mediaType[i+1:]]
+		return c, ok
+	}
+	return nil, false
+}
+
+// JSON is the codec of JSON documents.
+type JSON struct{}
+
+// Decode decodes a JSON document, with json.Number numbers.
+func (JSON) Decode(r io.Reader) (any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Encode encodes the value as a JSON document.
+func (JSON) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XML is the codec of XML documents. The child elements of an element are decoded into an object keyed
+// by their names, repeated names into arrays, and the elements without children into their text. The
+// attributes are ignored. Objects are encoded into child elements, arrays into repeated elements.
+type XML struct {
+	// Root names the root element of the encoded documents, "root" if empty. The root element of the
+	// decoded documents is the decoded value.
+	Root string
+}
+
+// Decode decodes the root element of an XML document.
+func (XML) Decode(r io.Reader) (any, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return decodeElement(dec, start)
+		}
+	}
+}
+
+// decodeElement decodes the content of the started element.
+func decodeElement(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	var text strings.Builder
+	var children map[string]any
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			v, err := decodeElement(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]any)
+			}
+			name := tok.Name.Local
+			switch prev := children[name].(type) {
+			case nil:
+				children[name] = v
+			case repeated:
+				children[name] = append(prev, v)
+			default:
+				children[name] = repeated{prev, v}
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if children == nil {
+				return strings.TrimSpace(text.String()), nil
+			}
+			for name, v := range children {
+				if r, ok := v.(repeated); ok {
+					children[name] = []any(r)
+				}
+			}
+			return children, nil
+		}
+	}
+}
+
+// repeated holds the values of repeated elements while they're decoded.
+type repeated []any
+
+// Encode encodes the value into the root element of an XML document.
+func (c XML) Encode(w io.Writer, v any) error {
+	root := c.Root
+	if root == "" {
+		root = "root"
+	}
+	enc := xml.NewEncoder(w)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if err := encodeElement(enc, root, v); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// encodeElement encodes the value into elements of the name, one per item of arrays.
+func encodeElement(enc *xml.Encoder, name string, v any) error {
+	if items, ok := v.([]any); ok {
+		for _, item := range items {
+			if err := encodeElement(enc, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			if err := encodeElement(enc, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(scalar(v))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// Form is the codec of URL-encoded forms. The fields are decoded into an object of strings, or arrays
+// of strings for repeated fields. Nested objects are encoded with dotted field names, e.g. user.name,
+// arrays into repeated fields.
+type Form struct{}
+
+// Decode decodes a URL-encoded form.
+func (Form) Decode(r io.Reader) (any, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]any, len(values))
+	for name, vs := range values {
+		if len(vs) == 1 {
+			obj[name] = vs[0]
+			continue
+		}
+		items := make([]any, len(vs))
+		for i, v := range vs {
+			items[i] = v
+		}
+		obj[name] = items
+	}
+	return obj, nil
+}
+
+// Encode encodes an object as a URL-encoded form.
+func (Form) Encode(w io.Writer, v any) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return errors.New("transcode: form body must be an object")
+	}
+	values := make(url.Values)
+	flatten(values, "", obj)
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+// flatten adds the fields of the value to the form values, with names prefixed by the prefix.
+func flatten(values url.Values, name string, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if name != "" {
+				key = name + "." + key
+			}
+			flatten(values, key, item)
+		}
+	case []any:
+		for _, item := range v {
+			flatten(values, name, item)
+		}
+	case nil:
+		values.Add(name, "")
+	default:
+		values.Add(name, scalar(v))
+	}
+}
+
+// scalar returns the text of a scalar value.
+func scalar(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sortedKeys returns the keys of the object in order.
+func sortedKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
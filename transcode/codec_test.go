@@ -0,0 +1,68 @@
+package transcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		input string
+		want  any
+		out   string
+	}{
+		{"Test JSON", JSON{}, `{"id":7,"tags":["a","b"]}`, map[string]any{"id": json.Number("7"), "tags": []any{"a", "b"}}, "{\"id\":7,\"tags\":[\"a\",\"b\"]}\n"},
+		{"Test XML", XML{Root: "order"}, `<?xml version="1.0"?><order id="1"><id>7</id><tag>a</tag><tag>b</tag><customer><name>Ann</name></customer></order>`,
+			map[string]any{"id": "7", "tag": []any{"a", "b"}, "customer": map[string]any{"name": "Ann"}},
+			xmlHeader + `<order><customer><name>Ann</name></customer><id>7</id><tag>a</tag><tag>b</tag></order>`},
+		{"Test form", Form{}, "id=7&tag=a&tag=b", map[string]any{"id": "7", "tag": []any{"a", "b"}}, "id=7&tag=a&tag=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.codec.Decode(strings.NewReader(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+
+			var out bytes.Buffer
+			assert.NoError(t, tt.codec.Encode(&out, v))
+			assert.Equal(t, tt.out, out.String())
+		})
+	}
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+func TestForm_EncodeNested(t *testing.T) {
+	var out bytes.Buffer
+	err := Form{}.Encode(&out, map[string]any{"user": map[string]any{"name": "Ann", "age": json.Number("30")}, "admin": false, "note": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, "admin=false&note=&user.age=30&user.name=Ann", out.String())
+	assert.Error(t, Form{}.Encode(&out, []any{"a"}))
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	reg := NewRegistry()
+	tests := []struct {
+		name      string
+		mediaType string
+		want      Codec
+	}{
+		{"Test registered type", "application/json", JSON{}},
+		{"Test case", "Text/XML", XML{}},
+		{"Test suffix", "application/problem+json", JSON{}},
+		{"Test unknown type", "application/yaml", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := reg.Lookup(tt.mediaType)
+			assert.Equal(t, tt.want != nil, ok)
+			assert.Equal(t, tt.want, c)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package transcode converts the bodies of proxied requests and responses between media types, e.g. to
+// accept JSON from the clients and send XML or form-encoded bodies to legacy upstreams, converting their
+// responses back. The bodies are decoded into generic values by the Codec of their media type, which
+// can be registered for other formats:
+//
+//	tc := &transcode.Transcoder{Client: "application/json", Upstream: "application/xml"}
+//	pm.HandlePath(reverseproxy.NewRoute("POST", "/orders").SetGroup("legacy").SetModifyResponse(tc.TranscodeResponse))
+//	pm.UseGroup("legacy", tc.Middleware)
+package transcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Transcoder converts the request bodies of the Client media type into the Upstream media type, and the
+// response bodies back. Bodies of other media types and compressed bodies are left untouched.
+type Transcoder struct {
+	Client   string
+	Upstream string
+	// Registry holds the codecs, DefaultRegistry if nil.
+	Registry *Registry
+	// MaxBody limits the size of the transcoded bodies, zero means unlimited. Larger request bodies are
+	// answered with HTTP 413 content too large, larger responses fail.
+	MaxBody int64
+}
+
+// TranscodeRequest converts the body of the request into the Upstream media type, and asks the upstream
+// for responses of the Upstream media type by the Accept header.
+func (t *Transcoder) TranscodeRequest(r *http.Request) error {
+	if accepts(r.Header.Get("Accept"), t.Client) {
+		r.Header.Set("Accept", t.Upstream)
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	b, ok, err := t.transcode(r.Header, r.Body, t.Client, t.Upstream)
+	if !ok || err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// TranscodeResponse converts the body of the response into the Client media type. It has the signature
+// of a ResponseModifier, so it can be passed to Route.SetModifyResponse.
+func (t *Transcoder) TranscodeResponse(res *http.Response) error {
+	if res.Body == nil || res.Body == http.NoBody {
+		return nil
+	}
+	b, ok, err := t.transcode(res.Header, res.Body, t.Upstream, t.Client)
+	if !ok || err != nil {
+		return err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.TransferEncoding = nil
+	res.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// Middleware returns a handler converting the request bodies before passing them to next. It can be
+// registered per route group with ReverseProxyMux.UseGroup. Requests whose body can't be converted are
+// answered with HTTP 400 bad request.
+func (t *Transcoder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.MaxBody > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, t.MaxBody)
+		}
+		if err := t.TranscodeRequest(r); err != nil {
+			status := http.StatusBadRequest
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// transcode reads the body of the from media type and encodes it in the to media type. It returns false
+// if the body isn't of the from media type, or is compressed, leaving it untouched.
+func (t *Transcoder) transcode(header http.Header, body io.ReadCloser, from, to string) ([]byte, bool, error) {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != from {
+		return nil, false, nil
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil, false, nil
+	}
+	reg := t.Registry
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	dec, ok := reg.Lookup(from)
+	if !ok {
+		return nil, false, fmt.Errorf("transcode: no codec of %s", from)
+	}
+	enc, ok := reg.Lookup(to)
+	if !ok {
+		return nil, false, fmt.Errorf("transcode: no codec of %s", to)
+	}
+
+	var r io.Reader = body
+	if t.MaxBody > 0 {
+		r = io.LimitReader(body, t.MaxBody+1)
+	}
+	b, err := io.ReadAll(r)
+	_ = body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	if t.MaxBody > 0 && int64(len(b)) > t.MaxBody {
+		return nil, false, &http.MaxBytesError{Limit: t.MaxBody}
+	}
+	v, err := dec.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, false, fmt.Errorf("transcode: decode %s: %w", from, err)
+	}
+	var out bytes.Buffer
+	if err := enc.Encode(&out, v); err != nil {
+		return nil, false, fmt.Errorf("transcode: encode %s: %w", to, err)
+	}
+	header.Set("Content-Type", to)
+	header.Del("Content-Length")
+	return out.Bytes(), true, nil
+}
+
+// accepts returns whether the Accept header accepts the media type, or is missing.
+func accepts(accept, mediaType string) bool {
+	if accept == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && (mt == mediaType || mt == "*/*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package transcode
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscoder(t *testing.T) {
+	var received, receivedType, receivedAccept string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received, receivedType, receivedAccept = string(b), r.Header.Get("Content-Type"), r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		_, _ = io.WriteString(w, `<result><status>accepted</status><id>42</id></result>`)
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name         string
+		transcoder   *Transcoder
+		contentType  string
+		body         string
+		wantStatus   int
+		wantReceived string
+		wantType     string
+		wantBody     string
+	}{
+		{"Test JSON to XML", &Transcoder{Client: "application/json", Upstream: "application/xml"}, "application/json", `{"item":"book","qty":2}`, http.StatusOK,
+			xmlHeader + "<root><item>book</item><qty>2</qty></root>", "application/xml", "{\"id\":\"42\",\"status\":\"accepted\"}\n"},
+		{"Test JSON to form", &Transcoder{Client: "application/json", Upstream: "application/x-www-form-urlencoded"}, "application/json", `{"item":"book","qty":2}`, http.StatusOK,
+			"item=book&qty=2", "application/x-www-form-urlencoded", `<result><status>accepted</status><id>42</id></result>`},
+		{"Test other media type", &Transcoder{Client: "application/json", Upstream: "application/xml"}, "text/plain", "book", http.StatusOK,
+			"book", "text/plain", "{\"id\":\"42\",\"status\":\"accepted\"}\n"},
+		{"Test invalid body", &Transcoder{Client: "application/json", Upstream: "application/xml"}, "application/json", `{"item":`, http.StatusBadRequest, "", "", ""},
+		{"Test body too large", &Transcoder{Client: "application/json", Upstream: "application/xml", MaxBody: 8}, "application/json", `{"item":"book"}`, http.StatusRequestEntityTooLarge, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, receivedType, receivedAccept = "", "", ""
+			pm, err := reverseproxy.New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(reverseproxy.NewRoute("POST", "/orders").SetGroup("legacy").SetModifyResponse(tt.transcoder.TranscodeResponse))
+			pm.UseGroup("legacy", tt.transcoder.Middleware)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/orders", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set("Accept", "application/json")
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantReceived, received)
+			assert.Equal(t, tt.wantType, receivedType)
+			assert.Equal(t, tt.transcoder.Upstream, receivedAccept)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath is returned when a JSONPath expression can't be parsed.
+var ErrInvalidPath = errors.New("invalid JSONPath")
+
+// segment is a parsed JSONPath segment, either an object key or an array index.
+type segment struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// Path is a compiled JSONPath expression of the supported subset: the root $ followed by
+// .key, ['key'] and [index] segments, e.g. $.users[0].name.
+type Path []segment
+
+// ParsePath compiles a JSONPath expression.
+func ParsePath(expr string) (Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("%w: %q must start with $", ErrInvalidPath, expr)
+	}
+	var path Path
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%w: %q has an empty key", ErrInvalidPath, expr)
+			}
+			path = append(path, segment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: %q has an unclosed bracket", ErrInvalidPath, expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, segment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("%w: %q has an invalid index %q", ErrInvalidPath, expr, inner)
+			}
+			path = append(path, segment{index: idx, isIdx: true})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidPath, rest[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// Get returns the value of the decoded JSON document at the path.
+func (p Path) Get(doc any) (any, bool) {
+	cur := doc
+	for _, seg := range p {
+		switch v := cur.(type) {
+		case map[string]any:
+			if seg.isIdx {
+				return nil, false
+			}
+			next, ok := v[seg.key]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			if !seg.isIdx || seg.index >= len(v) {
+				return nil, false
+			}
+			cur = v[seg.index]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Set sets the value of the decoded JSON document at the path, creating missing objects on the way,
+// and returns the updated document.
+func (p Path) Set(doc any, value any) (any, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+	seg := p[0]
+	switch v := doc.(type) {
+	case map[string]any:
+		if seg.isIdx {
+			return nil, fmt.Errorf("%w: index %d on an object", ErrInvalidPath, seg.index)
+		}
+		next, err := p[1:].Set(v[seg.key], value)
+		if err != nil {
+			return nil, err
+		}
+		v[seg.key] = next
+		return v, nil
+	case []any:
+		if !seg.isIdx || seg.index >= len(v) {
+			return nil, fmt.Errorf("%w: segment out of array bounds", ErrInvalidPath)
+		}
+		next, err := p[1:].Set(v[seg.index], value)
+		if err != nil {
+			return nil, err
+		}
+		v[seg.index] = next
+		return v, nil
+	case nil:
+		if seg.isIdx {
+			return nil, fmt.Errorf("%w: index %d on a missing array", ErrInvalidPath, seg.index)
+		}
+		return p.Set(map[string]any{}, value)
+	default:
+		return nil, fmt.Errorf("%w: segment on a scalar value", ErrInvalidPath)
+	}
+}
+
+// Delete removes the value at the path from the decoded JSON document. Array elements are removed
+// by shifting the following elements, so the updated document is returned.
+func (p Path) Delete(doc any) any {
+	if len(p) == 0 {
+		return nil
+	}
+	parent, ok := p[:len(p)-1].Get(doc)
+	if !ok {
+		return doc
+	}
+	last := p[len(p)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		if !last.isIdx {
+			delete(v, last.key)
+		}
+	case []any:
+		if last.isIdx && last.index < len(v) {
+			updated := append(v[:last.index:last.index], v[last.index+1:]...)
+			if len(p) == 1 {
+				return updated
+			}
+			doc, _ = p[:len(p)-1].Set(doc, updated)
+		}
+	}
+	return doc
+}
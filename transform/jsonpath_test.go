@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, s string) any {
+	var doc any
+	assert.NoError(t, json.Unmarshal([]byte(s), &doc))
+	return doc
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    Path
+		wantErr bool
+	}{
+		{"Test root", "$", nil, false},
+		{"Test dot keys", "$.a.b", Path{{key: "a"}, {key: "b"}}, false},
+		{"Test bracket key and index", "$['a b'][2]", Path{{key: "a b"}, {index: 2, isIdx: true}}, false},
+		{"Test missing root", "a.b", nil, true},
+		{"Test empty key", "$..a", nil, true},
+		{"Test unclosed bracket", "$[1", nil, true},
+		{"Test negative index", "$[-1]", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePath(tt.expr)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPath)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPathGetSetDelete(t *testing.T) {
+	doc := decode(t, `{"users": [{"name": "ann"}, {"name": "bob"}]}`)
+
+	v, ok := mustPath(t, "$.users[1].name").Get(doc)
+	assert.True(t, ok)
+	assert.Equal(t, "bob", v)
+	_, ok = mustPath(t, "$.users[5].name").Get(doc)
+	assert.False(t, ok)
+
+	doc, err := mustPath(t, "$.meta.count").Set(doc, 2.0)
+	assert.NoError(t, err)
+	doc = mustPath(t, "$.users[0]").Delete(doc)
+
+	b, _ := json.Marshal(doc)
+	assert.JSONEq(t, `{"users": [{"name": "bob"}], "meta": {"count": 2}}`, string(b))
+
+	_, err = mustPath(t, "$.users[0].name.first").Set(doc, "x")
+	assert.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func mustPath(t *testing.T, expr string) Path {
+	p, err := ParsePath(expr)
+	assert.NoError(t, err)
+	return p
+}
@@ -0,0 +1,406 @@
+// Package transform provides declarative transformations of the headers, query parameters and JSON body
+// fields of proxied requests and responses, so common mappings don't require writing a ResponseModifier.
+//
+// A rule value is either a JSONPath expression starting with $ (e.g. $.user.id), which selects a value of
+// the JSON body, or a Go template rendered with the Data of the message (e.g. {{ .Header.Get "X-User" }}).
+// JSONPath values keep their JSON type when set into a JSON body, template values are set as strings.
+// The templates can use the jsonpath function to select values of the body: {{ jsonpath .Body "$.id" }}.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultMaxBodySize is the default limit of the JSON bodies read by the rules.
+const DefaultMaxBodySize = 1 << 20
+
+// Rules is a declarative set of transformations. The headers, query parameters and JSON body fields
+// are transformed in this order, the removals of each are applied before the values are set. All values
+// are evaluated against the original JSON body, so a field can be moved by setting and removing it.
+type Rules struct {
+	SetHeaders    map[string]string `json:"setHeaders,omitempty" yaml:"setHeaders,omitempty"`
+	RemoveHeaders []string          `json:"removeHeaders,omitempty" yaml:"removeHeaders,omitempty"`
+	// SetQuery and RemoveQuery only apply to requests.
+	SetQuery    map[string]string `json:"setQuery,omitempty" yaml:"setQuery,omitempty"`
+	RemoveQuery []string          `json:"removeQuery,omitempty" yaml:"removeQuery,omitempty"`
+	// SetJSON and RemoveJSON are keyed by JSONPath expressions and only apply to JSON bodies.
+	SetJSON    map[string]string `json:"setJSON,omitempty" yaml:"setJSON,omitempty"`
+	RemoveJSON []string          `json:"removeJSON,omitempty" yaml:"removeJSON,omitempty"`
+}
+
+// Data is the template data of a request or response.
+type Data struct {
+	Method string
+	Path   string
+	Host   string
+	Header http.Header
+	Query  url.Values
+	// Status is the response status code, zero for requests.
+	Status int
+	// Body is the decoded JSON body, nil if the body isn't JSON.
+	Body any
+}
+
+// value is a compiled rule value.
+type value struct {
+	path Path
+	tmpl *template.Template
+}
+
+// eval returns the value for the data.
+func (v value) eval(data *Data) (any, error) {
+	if v.path != nil {
+		res, _ := v.path.Get(data.Body)
+		return res, nil
+	}
+	var buf strings.Builder
+	if err := v.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
+
+// evalString returns the value for the data as string.
+func (v value) evalString(data *Data) (string, error) {
+	res, err := v.eval(data)
+	if err != nil {
+		return "", err
+	}
+	switch res := res.(type) {
+	case string:
+		return res, nil
+	case nil:
+		return "", nil
+	default:
+		b, err := json.Marshal(res)
+		return string(b), err
+	}
+}
+
+// field is a compiled rule keyed by name or JSONPath.
+type field struct {
+	name  string
+	path  Path
+	value value
+}
+
+// Transformer applies compiled Rules to requests and responses.
+type Transformer struct {
+	// MaxBodySize limits the JSON bodies read by the rules, DefaultMaxBodySize if zero. The
+	// transformation of larger bodies fails with an *http.MaxBytesError.
+	MaxBodySize int64
+	// ErrorLog logs the errors of the Middleware, the standard logger if nil.
+	ErrorLog *log.Logger
+
+	setHeaders    []field
+	removeHeaders []string
+	setQuery      []field
+	removeQuery   []string
+	setJSON       []field
+	removeJSON    []Path
+}
+
+var funcs = template.FuncMap{
+	"jsonpath": func(doc any, expr string) (any, error) {
+		path, err := ParsePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		res, _ := path.Get(doc)
+		return res, nil
+	},
+}
+
+// compileValue compiles a rule value.
+func compileValue(name, expr string) (value, error) {
+	if strings.HasPrefix(expr, "$") {
+		path, err := ParsePath(expr)
+		return value{path: path}, err
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(expr)
+	return value{tmpl: tmpl}, err
+}
+
+// compileFields compiles the rules of a map in a stable order.
+func compileFields(rules map[string]string, jsonPaths bool) ([]field, error) {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]field, 0, len(rules))
+	for _, name := range names {
+		f := field{name: name}
+		if jsonPaths {
+			path, err := ParsePath(name)
+			if err != nil {
+				return nil, err
+			}
+			f.path = path
+		}
+		v, err := compileValue(name, rules[name])
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+		f.value = v
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// New compiles the rules into a Transformer. An error is returned for invalid templates or JSONPath expressions.
+func New(rules Rules) (*Transformer, error) {
+	t := &Transformer{
+		removeHeaders: rules.RemoveHeaders,
+		removeQuery:   rules.RemoveQuery,
+	}
+	var err error
+	if t.setHeaders, err = compileFields(rules.SetHeaders, false); err != nil {
+		return nil, err
+	}
+	if t.setQuery, err = compileFields(rules.SetQuery, false); err != nil {
+		return nil, err
+	}
+	if t.setJSON, err = compileFields(rules.SetJSON, true); err != nil {
+		return nil, err
+	}
+	for _, expr := range rules.RemoveJSON {
+		path, err := ParsePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		t.removeJSON = append(t.removeJSON, path)
+	}
+	return t, nil
+}
+
+// MustNew is like New but panics if the rules can't be compiled.
+func MustNew(rules Rules) *Transformer {
+	t, err := New(rules)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// TransformRequest applies the rules to the request.
+func (t *Transformer) TransformRequest(r *http.Request) error {
+	data := &Data{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Host:   r.Host,
+		Header: r.Header,
+		Query:  r.URL.Query(),
+	}
+	body, jsonBody, err := t.readBody(r.Header, &r.Body, data)
+	if err != nil {
+		return err
+	}
+
+	if err := t.applyHeaders(r.Header, data); err != nil {
+		return err
+	}
+	if len(t.setQuery) > 0 || len(t.removeQuery) > 0 {
+		query := r.URL.Query()
+		for _, name := range t.removeQuery {
+			query.Del(name)
+		}
+		for _, f := range t.setQuery {
+			v, err := f.value.evalString(data)
+			if err != nil {
+				return err
+			}
+			query.Set(f.name, v)
+		}
+		r.URL.RawQuery = query.Encode()
+	}
+	if !jsonBody {
+		return nil
+	}
+	b, err := t.applyJSON(body, data)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// TransformResponse applies the rules to the response. It has the signature of a ResponseModifier,
+// so it can be passed to Route.SetModifyResponse.
+func (t *Transformer) TransformResponse(res *http.Response) error {
+	data := &Data{
+		Header: res.Header,
+		Status: res.StatusCode,
+	}
+	if res.Request != nil {
+		data.Method = res.Request.Method
+		data.Path = res.Request.URL.Path
+		data.Host = res.Request.Host
+		data.Query = res.Request.URL.Query()
+	}
+	body, jsonBody, err := t.readBody(res.Header, &res.Body, data)
+	if err != nil {
+		return err
+	}
+
+	if err := t.applyHeaders(res.Header, data); err != nil {
+		return err
+	}
+	if !jsonBody {
+		return nil
+	}
+	b, err := t.applyJSON(body, data)
+	if err != nil {
+		return err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return nil
+}
+
+// Middleware returns a handler applying the rules to the requests before passing them to next.
+// It can be registered per route group with ReverseProxyMux.UseGroup. The requests failing the
+// transformation are answered with HTTP 400 bad request, or HTTP 413 content too large for bodies
+// over MaxBodySize, and the error is logged.
+func (t *Transformer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := t.TransformRequest(r); err != nil {
+			t.logf("transform: %s %s: %v", r.Method, r.URL.Path, err)
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logf logs an error of the transformer.
+func (t *Transformer) logf(format string, args ...any) {
+	if t.ErrorLog != nil {
+		t.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// needsBody returns whether the rules need the decoded JSON body.
+func (t *Transformer) needsBody() bool {
+	if len(t.setJSON) > 0 || len(t.removeJSON) > 0 {
+		return true
+	}
+	for _, fields := range [][]field{t.setHeaders, t.setQuery} {
+		for _, f := range fields {
+			if f.value.path != nil || strings.Contains(f.value.tmpl.Root.String(), ".Body") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readBody reads and decodes an uncompressed JSON body, if the rules need it. The body is replaced
+// with a reader of the read bytes. The numbers are decoded as json.Number, so large integers are
+// kept exactly.
+func (t *Transformer) readBody(header http.Header, body *io.ReadCloser, data *Data) ([]byte, bool, error) {
+	if *body == nil || *body == http.NoBody || !t.needsBody() || !isJSON(header) {
+		return nil, false, nil
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil, false, nil
+	}
+	limit := t.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	b, err := io.ReadAll(io.LimitReader(*body, limit+1))
+	_ = (*body).Close()
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(b)) > limit {
+		return nil, false, &http.MaxBytesError{Limit: limit}
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	if len(b) == 0 {
+		return b, false, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&data.Body); err != nil || dec.Decode(new(any)) != io.EOF {
+		// not a valid JSON document, leave the body untouched
+		data.Body = nil
+		return b, false, nil
+	}
+	return b, true, nil
+}
+
+// applyHeaders applies the header rules.
+func (t *Transformer) applyHeaders(header http.Header, data *Data) error {
+	for _, name := range t.removeHeaders {
+		header.Del(name)
+	}
+	for _, f := range t.setHeaders {
+		v, err := f.value.evalString(data)
+		if err != nil {
+			return err
+		}
+		header.Set(f.name, v)
+	}
+	return nil
+}
+
+// applyJSON applies the JSON body rules and returns the encoded body.
+func (t *Transformer) applyJSON(body []byte, data *Data) ([]byte, error) {
+	if len(t.setJSON) == 0 && len(t.removeJSON) == 0 {
+		return body, nil
+	}
+	// the values are evaluated against the original body, so moved fields can be removed
+	values := make([]any, len(t.setJSON))
+	for i, f := range t.setJSON {
+		v, err := f.value.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	doc := data.Body
+	for _, path := range t.removeJSON {
+		doc = path.Delete(doc)
+	}
+	for i, f := range t.setJSON {
+		var err error
+		if doc, err = f.path.Set(doc, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	data.Body = doc
+	return json.Marshal(doc)
+}
+
+// isJSON returns whether the Content-Type of the header is JSON.
+func isJSON(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvalidRules(t *testing.T) {
+	_, err := New(Rules{SetHeaders: map[string]string{"X-A": "{{ .Header.Get "}})
+	assert.Error(t, err)
+	_, err = New(Rules{SetJSON: map[string]string{"a.b": "x"}})
+	assert.ErrorIs(t, err, ErrInvalidPath)
+	_, err = New(Rules{RemoveJSON: []string{"$["}})
+	assert.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func TestTransformRequest(t *testing.T) {
+	tr := MustNew(Rules{
+		SetHeaders:    map[string]string{"X-User-Id": "$.user.id", "X-Method": "{{ .Method }} {{ .Path }}"},
+		RemoveHeaders: []string{"Cookie"},
+		SetQuery:      map[string]string{"lang": `{{ .Header.Get "Accept-Language" }}`},
+		RemoveQuery:   []string{"debug"},
+		SetJSON:       map[string]string{"$.source": "proxy", "$.userId": "$.user.id"},
+		RemoveJSON:    []string{"$.user"},
+	})
+
+	r := httptest.NewRequest("POST", "/users?debug=1&page=2", strings.NewReader(`{"user": {"id": 42}}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Cookie", "session=abc")
+	r.Header.Set("Accept-Language", "de")
+
+	assert.NoError(t, tr.TransformRequest(r))
+	assert.Equal(t, "42", r.Header.Get("X-User-Id"))
+	assert.Equal(t, "POST /users", r.Header.Get("X-Method"))
+	assert.Empty(t, r.Header.Get("Cookie"))
+	assert.Equal(t, "lang=de&page=2", r.URL.RawQuery)
+
+	body, _ := io.ReadAll(r.Body)
+	assert.JSONEq(t, `{"source": "proxy", "userId": 42}`, string(body))
+	assert.Equal(t, int64(len(body)), r.ContentLength)
+}
+
+func TestTransformRequest_LargeNumbers(t *testing.T) {
+	tr := MustNew(Rules{
+		SetHeaders: map[string]string{"X-Order-Id": "$.id"},
+		SetJSON:    map[string]string{"$.source": "proxy"},
+	})
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 9007199254740993, "price": 0.1}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	assert.NoError(t, tr.TransformRequest(r))
+	assert.Equal(t, "9007199254740993", r.Header.Get("X-Order-Id"))
+	body, _ := io.ReadAll(r.Body)
+	assert.JSONEq(t, `{"id": 9007199254740993, "price": 0.1, "source": "proxy"}`, string(body))
+	assert.Contains(t, string(body), "9007199254740993")
+}
+
+func TestTransformResponse(t *testing.T) {
+	tr := MustNew(Rules{
+		SetHeaders:    map[string]string{"X-Status": "{{ .Status }}"},
+		RemoveHeaders: []string{"Server"},
+		SetJSON:       map[string]string{"$.total": `{{ len (jsonpath .Body "$.items") }}`},
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantBody    string
+	}{
+		{"Test JSON body", "application/json", `{"items": [1, 2, 3]}`, `{"items": [1, 2, 3], "total": "3"}`},
+		{"Test non-JSON body", "text/plain", `plain`, `plain`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {tt.contentType}, "Server": {"nginx"}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+				Request:    httptest.NewRequest("GET", "/items", nil),
+			}
+			assert.NoError(t, tr.TransformResponse(res))
+			assert.Equal(t, "200", res.Header.Get("X-Status"))
+			assert.Empty(t, res.Header.Get("Server"))
+			body, _ := io.ReadAll(res.Body)
+			if tt.contentType == "application/json" {
+				assert.JSONEq(t, tt.wantBody, string(body))
+				assert.Equal(t, int64(len(body)), res.ContentLength)
+			} else {
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tr := MustNew(Rules{SetHeaders: map[string]string{"X-Gateway": "yes"}})
+	var got string
+	h := tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Gateway")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "yes", got)
+}
+
+func TestMiddleware_Errors(t *testing.T) {
+	tr := MustNew(Rules{SetHeaders: map[string]string{"X-Id": `{{ jsonpath .Body "$[" }}`}})
+	tr.MaxBodySize = 16
+	var logs bytes.Buffer
+	tr.ErrorLog = log.New(&logs, "", 0)
+	h := tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantLog    string
+	}{
+		{"Test failing rule", `{"id": 1}`, http.StatusBadRequest, "invalid JSONPath"},
+		{"Test body too large", `{"id": "0123456789"}`, http.StatusRequestEntityTooLarge, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, http.StatusText(tt.wantStatus)+"\n", w.Body.String(), "the error detail shouldn't be sent")
+			assert.Contains(t, logs.String(), tt.wantLog)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/open-webtech/go-reverse-proxy/proxyctx"
+)
+
+// ProxySelector selects the egress proxy of the outbound requests of the mux by their route. It's
+// passed as the Proxy function of an http.Transport, which connects through http://, https:// and
+// socks5:// proxies and pools the connections per proxy:
+//
+//	sel := &tunnel.ProxySelector{Routes: map[string]*url.URL{"/partners/*path": partnerProxy}}
+//	pm.Transport = sel.Transport()
+type ProxySelector struct {
+	// Routes maps route patterns, e.g. /users/:id, to the proxies of their requests. A nil URL connects
+	// the requests of the route directly.
+	Routes map[string]*url.URL
+	// Default is the proxy of the requests of the other routes, nil means direct connections.
+	Default *url.URL
+}
+
+// Proxy returns the proxy of the outbound request, or nil for a direct connection.
+func (s *ProxySelector) Proxy(r *http.Request) (*url.URL, error) {
+	if route, ok := proxyctx.Route(r.Context()); ok {
+		if u, ok := s.Routes[route.Path]; ok {
+			return u, nil
+		}
+	}
+	return s.Default, nil
+}
+
+// Transport returns an HTTP transport with the settings of http.DefaultTransport, which connects
+// through the proxies of the selector. The result can be assigned to ReverseProxyMux.Transport.
+func (s *ProxySelector) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = s.Proxy
+	return t
+}
@@ -0,0 +1,58 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	reverseproxy "github.com/open-webtech/go-reverse-proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxySelector(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer origin.Close()
+	_, port, _ := net.SplitHostPort(origin.Listener.Addr().String())
+	socksAddr, socksDests := startSOCKS5Server(t, nil)
+	connectAddr, connectDests := startConnectServer(t, nil)
+
+	sel := &ProxySelector{
+		Routes: map[string]*url.URL{
+			"/socks/*path": {Scheme: "socks5", Host: socksAddr},
+			"/direct":      nil,
+		},
+		Default: &url.URL{Scheme: "http", Host: connectAddr},
+	}
+	pm, err := reverseproxy.New("http://localhost:" + port)
+	assert.NoError(t, err)
+	pm.Transport = sel.Transport()
+	pm.PassPaths("GET", "/socks/*path", "/direct", "/other")
+
+	tests := []struct {
+		path  string
+		dests chan string
+	}{
+		{"/socks/a", socksDests},
+		{"/direct", nil},
+		{"/other", connectDests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			pm.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.path, w.Body.String())
+			for _, dests := range []chan string{socksDests, connectDests} {
+				if dests == tt.dests {
+					assert.Equal(t, "localhost:"+port, <-dests)
+				}
+				assert.Empty(t, dests)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version        = 0x05
+	socks5AuthNone       = 0x00
+	socks5AuthPassword   = 0x02
+	socks5AuthNoMethods  = 0xff
+	socks5CmdConnect     = 0x01
+	socks5AddrIPv4       = 0x01
+	socks5AddrDomain     = 0x03
+	socks5AddrIPv6       = 0x04
+	socks5PasswordStatus = 0x01
+)
+
+// ErrSOCKS5 is returned when the SOCKS5 proxy rejects the connection or answers with a malformed reply.
+var ErrSOCKS5 = errors.New("socks5")
+
+// Auth holds the username/password authentication (RFC 1929) credentials of a SOCKS5 proxy.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// SOCKS5Dialer dials connections through a SOCKS5 proxy (RFC 1928). The destination host name is
+// resolved by the proxy, so the names of the private network don't need to be resolvable locally.
+type SOCKS5Dialer struct {
+	// Addr is the host:port address of the SOCKS5 proxy.
+	Addr string
+	// Auth holds optional credentials; nil means no authentication.
+	Auth *Auth
+	// Forward dials the connection to the proxy; nil means a default net.Dialer.
+	Forward ContextDialer
+}
+
+// SOCKS5 returns a dialer connecting through the SOCKS5 proxy at addr, authenticating with
+// the optional credentials.
+func SOCKS5(addr string, auth *Auth) *SOCKS5Dialer {
+	return &SOCKS5Dialer{Addr: addr, Auth: auth}
+}
+
+// Dial connects to the address on the named network through the proxy.
+func (d *SOCKS5Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address on the named network through the proxy using the provided context.
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("%w: unsupported network %q", ErrSOCKS5, network)
+	}
+	forward := d.Forward
+	if forward == nil {
+		forward = defaultDialer
+	}
+	conn, err := forward.DialContext(ctx, "tcp", d.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := handshake(ctx, conn, func() error { return d.connect(conn, addr) }); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connect performs the SOCKS5 handshake and requests a connection to addr.
+func (d *SOCKS5Dialer) connect(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("%w: invalid port %q", ErrSOCKS5, portStr)
+	}
+
+	method := byte(socks5AuthNone)
+	if d.Auth != nil {
+		method = socks5AuthPassword
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version || buf[1] == socks5AuthNoMethods || buf[1] != method {
+		return fmt.Errorf("%w: no acceptable authentication method", ErrSOCKS5)
+	}
+	if method == socks5AuthPassword {
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socks5AddrIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socks5AddrIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("%w: host name too long", ErrSOCKS5)
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("%w: unexpected protocol version %d", ErrSOCKS5, reply[0])
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("%w: connect to %s failed with code %d", ErrSOCKS5, addr, reply[1])
+	}
+	var skip int
+	switch reply[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("%w: unknown address type %d", ErrSOCKS5, reply[3])
+	}
+	// skip the bound address and port
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// authenticate performs the username/password sub-negotiation.
+func (d *SOCKS5Dialer) authenticate(conn net.Conn) error {
+	if len(d.Auth.Username) > 255 || len(d.Auth.Password) > 255 {
+		return fmt.Errorf("%w: credentials too long", ErrSOCKS5)
+	}
+	req := []byte{socks5PasswordStatus, byte(len(d.Auth.Username))}
+	req = append(req, d.Auth.Username...)
+	req = append(req, byte(len(d.Auth.Password)))
+	req = append(req, d.Auth.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		return fmt.Errorf("%w: authentication failed", ErrSOCKS5)
+	}
+	return nil
+}
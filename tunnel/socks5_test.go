@@ -0,0 +1,218 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startSOCKS5Server starts a minimal SOCKS5 proxy and returns its address and the requested destinations.
+func startSOCKS5Server(t *testing.T, auth *Auth) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	dests := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, auth, dests)
+		}
+	}()
+	return l.Addr().String(), dests
+}
+
+func serveSOCKS5(conn net.Conn, auth *Auth, dests chan string) {
+	defer conn.Close()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if auth == nil {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNone})
+	} else {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthPassword})
+		b := make([]byte, 2)
+		_, _ = io.ReadFull(conn, b)
+		user := make([]byte, b[1])
+		_, _ = io.ReadFull(conn, user)
+		_, _ = io.ReadFull(conn, b[:1])
+		pass := make([]byte, b[0])
+		_, _ = io.ReadFull(conn, pass)
+		if string(user) != auth.Username || string(pass) != auth.Password {
+			_, _ = conn.Write([]byte{socks5PasswordStatus, 1})
+			return
+		}
+		_, _ = conn.Write([]byte{socks5PasswordStatus, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4:
+		ip := make([]byte, net.IPv4len)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case socks5AddrDomain:
+		l := make([]byte, 1)
+		_, _ = io.ReadFull(conn, l)
+		name := make([]byte, l[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(conn, port)
+	dest := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	dests <- dest
+
+	if host == "localhost" {
+		dest = net.JoinHostPort("127.0.0.1", strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	}
+	upstream, err := net.Dial("tcp", dest)
+	if err != nil {
+		_, _ = conn.Write([]byte{socks5Version, 5, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{socks5Version, 0, 0, socks5AddrIPv4, 127, 0, 0, 1, 0, 0})
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+	_, port, _ := net.SplitHostPort(origin.Listener.Addr().String())
+
+	tests := []struct {
+		name       string
+		serverAuth *Auth
+		clientAuth *Auth
+		wantErr    bool
+	}{
+		{
+			name: "Test without authentication",
+		},
+		{
+			name:       "Test with valid credentials",
+			serverAuth: &Auth{Username: "user", Password: "secret"},
+			clientAuth: &Auth{Username: "user", Password: "secret"},
+		},
+		{
+			name:       "Test with invalid credentials",
+			serverAuth: &Auth{Username: "user", Password: "secret"},
+			clientAuth: &Auth{Username: "user", Password: "wrong"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, dests := startSOCKS5Server(t, tt.serverAuth)
+			client := &http.Client{Transport: NewTransport(SOCKS5(addr, tt.clientAuth))}
+
+			res, err := client.Get("http://localhost:" + port + "/")
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrSOCKS5)
+				return
+			}
+			assert.NoError(t, err)
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "ok", string(body))
+			assert.Equal(t, "localhost:"+port, <-dests, "the host name should be resolved by the proxy")
+		})
+	}
+}
+
+func TestSOCKS5Dialer_Context(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// never answer the handshake
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "Test with deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "Test with cancellation",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			_, err := SOCKS5(l.Addr().String(), nil).DialContext(ctx, "tcp", "private.internal:8080")
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSOCKS5Dialer_ClearsDeadline(t *testing.T) {
+	addr, _ := startSOCKS5Server(t, nil)
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.WriteString(conn, "late")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conn, err := SOCKS5(addr, nil).DialContext(ctx, "tcp", origin.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	b := make([]byte, 4)
+	_, err = io.ReadFull(conn, b)
+	assert.NoError(t, err, "the deadline of the context shouldn't apply after the handshake")
+	assert.Equal(t, "late", string(b))
+}
@@ -0,0 +1,99 @@
+// Package tunnel provides dialers reaching the proxy origin through an SSH tunnel, a SOCKS5 proxy or an
+// HTTP CONNECT proxy, so origins in private networks can be proxied without a VPN, and a ProxySelector
+// choosing the egress proxy per route.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Dialer is the interface of connection dialers without context support,
+// e.g. an established *ssh.Client of golang.org/x/crypto/ssh.
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// ContextDialer is the interface of connection dialers with context support, e.g. *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// SSH returns a ContextDialer opening the connections through the passed SSH client.
+// The client is typically an *ssh.Client connected to a bastion host of the private network.
+func SSH(client Dialer) ContextDialer {
+	return &sshDialer{client: client}
+}
+
+// sshDialer adds context support to a Dialer.
+type sshDialer struct {
+	client Dialer
+}
+
+// DialContext connects to the address on the named network using the SSH client.
+func (d *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := d.client.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.conn, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.conn != nil {
+				_ = res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// NewTransport returns an HTTP transport with the settings of http.DefaultTransport,
+// which dials all connections using the passed dialer. The result can be assigned to
+// ReverseProxyMux.Transport.
+func NewTransport(dialer ContextDialer) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// defaultDialer is used to connect to the SOCKS5 proxy when no forward dialer is set.
+var defaultDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// handshake runs the handshake of a proxy protocol on the connection, interrupting it when the context
+// is done: the connection gets the deadline of the context, and an expired one when the context is
+// canceled. The deadline is cleared afterwards, so it doesn't apply to the tunneled connection.
+func handshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := fn()
+	if !stop() {
+		return ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		// the connection may time out just before the context
+		return context.DeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type dialFunc func(network, addr string) (net.Conn, error)
+
+func (f dialFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(network, addr)
+}
+
+func TestSSHTransport(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+
+	var dialed string
+	client := dialFunc(func(network, addr string) (net.Conn, error) {
+		dialed = addr
+		return net.Dial(network, origin.Listener.Addr().String())
+	})
+	c := &http.Client{Transport: NewTransport(SSH(client))}
+
+	res, err := c.Get("http://private.internal:8080/")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, "private.internal:8080", dialed)
+}
+
+func TestSSHDialContextCancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	client := dialFunc(func(network, addr string) (net.Conn, error) {
+		<-block
+		return nil, errors.New("closed")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := SSH(client).DialContext(ctx, "tcp", "private.internal:8080")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
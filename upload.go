@@ -0,0 +1,122 @@
+package reverseproxy
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// UploadProgress observes the request bodies of a route while they're forwarded to the upstream, e.g.
+// for progress APIs or upload auditing, without buffering them. It's set with Route.SetUploadProgress.
+type UploadProgress struct {
+	// OnProgress is called after each read of the body by the transport, with the bytes forwarded so far
+	// and the Content-Length of the request, -1 if unknown.
+	OnProgress func(r *http.Request, forwarded, total int64)
+	// OnPart is called for each part of multipart/form-data and other multipart bodies, once its headers
+	// were forwarded. It's called from a separate goroutine parsing the forwarded bytes.
+	OnPart func(r *http.Request, part UploadPart)
+	// OnComplete is called once the body was forwarded or its forwarding failed, after the parts were
+	// reported, with the forwarded bytes and the error, io.ErrUnexpectedEOF if the transport stopped
+	// reading the body before its end, e.g. as the upstream answered early.
+	OnComplete func(r *http.Request, forwarded int64, err error)
+}
+
+// UploadPart describes a part of a multipart request body.
+type UploadPart struct {
+	// Index is the index of the part in the body, starting at zero.
+	Index int
+	// FormName and FileName are the parameters of the Content-Disposition header of the part.
+	FormName string
+	FileName string
+	Header   textproto.MIMEHeader
+}
+
+// progressBody is a request body reporting its forwarding to the UploadProgress.
+type progressBody struct {
+	io.ReadCloser
+	r         *http.Request
+	p         *UploadProgress
+	forwarded int64
+	parts     *io.PipeWriter
+	parsed    chan struct{}
+	once      sync.Once
+}
+
+// newProgressBody wraps the body of the request, parsing multipart bodies if the parts are observed.
+func newProgressBody(r *http.Request, p *UploadProgress) *progressBody {
+	b := &progressBody{ReadCloser: r.Body, r: r, p: p}
+	if p.OnPart == nil {
+		return b
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return b
+	}
+	pr, pw := io.Pipe()
+	b.parts, b.parsed = pw, make(chan struct{})
+	go func() {
+		defer close(b.parsed)
+		// the rest of the body is discarded once it can't be parsed, so forwarding never blocks
+		defer func() { _, _ = io.Copy(io.Discard, pr) }()
+		mr := multipart.NewReader(pr, params["boundary"])
+		for i := 0; ; i++ {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			p.OnPart(r, UploadPart{Index: i, FormName: part.FormName(), FileName: part.FileName(), Header: part.Header})
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// Read reads the body, reporting the progress and passing the data to the multipart parser.
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.forwarded += int64(n)
+		if b.parts != nil {
+			_, _ = b.parts.Write(p[:n])
+		}
+		if b.p.OnProgress != nil {
+			b.p.OnProgress(b.r, b.forwarded, b.r.ContentLength)
+		}
+	}
+	if err == io.EOF {
+		b.complete(nil)
+	} else if err != nil {
+		b.complete(err)
+	}
+	return n, err
+}
+
+// Close closes the body, completing the upload with io.ErrUnexpectedEOF if it wasn't read to its end.
+func (b *progressBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.complete(io.ErrUnexpectedEOF)
+	return err
+}
+
+// complete ends the multipart parsing and calls OnComplete once.
+func (b *progressBody) complete(err error) {
+	b.once.Do(func() {
+		if b.parts != nil {
+			if err != nil {
+				_ = b.parts.CloseWithError(err)
+			} else {
+				_ = b.parts.Close()
+			}
+			<-b.parsed
+		}
+		if b.p.OnComplete != nil {
+			b.p.OnComplete(b.r, b.forwarded, err)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_SetUploadProgress(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer origin.Close()
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("title", "report")
+	fw, _ := mw.CreateFormFile("file", "report.csv")
+	_, _ = fw.Write(bytes.Repeat([]byte("a,b\n"), 10000))
+	_ = mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantParts   []string
+	}{
+		{"Test multipart body", mw.FormDataContentType(), form.Bytes(), []string{"0 title ", "1 file report.csv"}},
+		{"Test plain body", "text/csv", bytes.Repeat([]byte("a,b\n"), 10000), nil},
+		{"Test invalid multipart body", "multipart/form-data; boundary=missing", []byte("no parts"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var parts []string
+			var progress []int64
+			var completed int64
+			var completeErr error = io.EOF
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.HandlePath(NewRoute("POST", "/upload").SetUploadProgress(UploadProgress{
+				OnProgress: func(r *http.Request, forwarded, total int64) {
+					progress = append(progress, forwarded)
+					assert.Equal(t, int64(len(tt.body)), total)
+				},
+				OnPart: func(r *http.Request, part UploadPart) {
+					mu.Lock()
+					defer mu.Unlock()
+					parts = append(parts, strconv.Itoa(part.Index)+" "+part.FormName+" "+part.FileName)
+				},
+				OnComplete: func(r *http.Request, forwarded int64, err error) {
+					completed, completeErr = forwarded, err
+				},
+			}))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/upload", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, len(tt.body), w.Body.Len())
+
+			assert.NoError(t, completeErr)
+			assert.Equal(t, int64(len(tt.body)), completed)
+			assert.NotEmpty(t, progress)
+			assert.IsIncreasing(t, progress)
+			assert.Equal(t, int64(len(tt.body)), progress[len(progress)-1])
+			mu.Lock()
+			assert.Equal(t, tt.wantParts, parts)
+			mu.Unlock()
+		})
+	}
+}
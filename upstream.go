@@ -0,0 +1,108 @@
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ErrorTrailer is the trailer signaling a partial response with the PartialTrailer policy.
+const ErrorTrailer = "X-Proxy-Error"
+
+var (
+	// ErrUpstreamTimeout is wrapped by the errors of upstream requests which timed out.
+	ErrUpstreamTimeout = errors.New("upstream timeout")
+	// ErrPartialResponse is wrapped by the errors of upstream responses which failed mid-body.
+	ErrPartialResponse = errors.New("partial upstream response")
+)
+
+// PartialResponsePolicy defines how a response is ended when reading the upstream body fails after
+// the response headers were sent to the client.
+type PartialResponsePolicy int
+
+const (
+	// PartialAbort aborts the client connection, so the client can't mistake the response for a
+	// complete one. It's the behavior of httputil.ReverseProxy.
+	PartialAbort PartialResponsePolicy = iota
+	// PartialTruncate logs the error and ends the response with the data received so far. Responses
+	// with a Content-Length are still detected as truncated by the client.
+	PartialTruncate
+	// PartialTrailer ends the response with the data received so far and signals the error in the
+	// ErrorTrailer trailer. The upstream Content-Length is dropped, so the response is chunked.
+	PartialTrailer
+)
+
+// isTimeout reports whether the error is caused by a deadline or network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// upstreamError handles the errors of upstream requests failing before the response headers and of the
+// response modifiers, passing them to the ErrorHandler as a ProxyError of their kind.
+func (pm *ReverseProxyMux) upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	x := exchangeFrom(r.Context())
+	err = newProxyError(upstreamErrorKind(err), x, err)
+	if x != nil {
+		x.err = err
+	}
+	pm.observeLatency(x)
+	TraceFromContext(r.Context()).Add("upstream", "error: "+err.Error())
+	pm.handleError(w, r, err)
+}
+
+// guardPartialResponse wraps the body of the upstream response, so body read errors are handled by
+// the PartialResponsePolicy and recorded in the exchange.
+func (pm *ReverseProxyMux) guardPartialResponse(res *http.Response, x *exchange) {
+	if res.Body == nil || res.Body == http.NoBody {
+		return
+	}
+	if pm.current().PartialResponse == PartialTrailer {
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		if res.Trailer == nil {
+			res.Trailer = make(http.Header)
+		}
+		res.Trailer[ErrorTrailer] = nil
+	}
+	res.Body = &partialBody{ReadCloser: res.Body, pm: pm, res: res, x: x}
+}
+
+// partialBody is an upstream response body handling read errors by the PartialResponsePolicy.
+type partialBody struct {
+	io.ReadCloser
+	pm   *ReverseProxyMux
+	res  *http.Response
+	x    *exchange
+	read int64
+}
+
+// Read reads from the upstream body, recording the first read error.
+func (b *partialBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if isTimeout(err) {
+		err = fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+	}
+	err = fmt.Errorf("%w after %d bytes: %w", ErrPartialResponse, b.read, err)
+	if b.x.err == nil {
+		b.x.err = err
+	}
+	r := b.res.Request
+	TraceFromContext(r.Context()).Add("upstream", "error: "+err.Error())
+	switch b.pm.current().PartialResponse {
+	case PartialTruncate:
+		b.pm.logf("%s: truncated response: %v", describeRequest(r), err)
+		return n, io.EOF
+	case PartialTrailer:
+		b.res.Trailer.Set(ErrorTrailer, err.Error())
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPartialTestMux(t *testing.T) (*ReverseProxyMux, chan RequestMetrics) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/stall":
+			w.Header().Set("Content-Length", "20")
+			_, _ = io.WriteString(w, "0123456789")
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+		case "/broken":
+			w.Header().Set("Content-Length", "20")
+			_, _ = io.WriteString(w, "0123456789")
+		}
+	}))
+	t.Cleanup(origin.Close)
+
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.PassPaths("GET", "/slow", "/stall", "/broken")
+	metrics := make(chan RequestMetrics, 4)
+	pm.AddMetricsHook(func(m RequestMetrics) {
+		metrics <- m
+	})
+	return pm, metrics
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	pm, metrics := newPartialTestMux(t)
+	pm.UpstreamTimeout = 50 * time.Millisecond
+
+	w := serve(pm, "GET", "/slow")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.ErrorIs(t, (<-metrics).Err, ErrUpstreamTimeout)
+
+	var handled error
+	pm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusTeapot)
+	}
+	w = serve(pm, "GET", "/slow")
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.ErrorIs(t, handled, ErrUpstreamTimeout)
+}
+
+func TestPartialResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      PartialResponsePolicy
+		path        string
+		wantReadErr bool
+		wantTrailer bool
+		wantTimeout bool
+	}{
+		{"Test aborted response", PartialAbort, "/broken", true, false, false},
+		{"Test truncated response", PartialTruncate, "/broken", true, false, false},
+		{"Test trailer-signaled response", PartialTrailer, "/broken", false, true, false},
+		{"Test trailer-signaled timeout", PartialTrailer, "/stall", false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, metrics := newPartialTestMux(t)
+			pm.PartialResponse = tt.policy
+			pm.UpstreamTimeout = 50 * time.Millisecond
+			front := httptest.NewServer(pm)
+			defer front.Close()
+
+			res, err := http.Get(front.URL + tt.path)
+			if err == nil {
+				var body []byte
+				body, err = io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				assert.Equal(t, "0123456789", string(body))
+				assert.Equal(t, tt.wantTrailer, res.Trailer.Get(ErrorTrailer) != "")
+			}
+			assert.Equal(t, tt.wantReadErr, err != nil)
+
+			m := <-metrics
+			assert.ErrorIs(t, m.Err, ErrPartialResponse)
+			assert.Equal(t, tt.wantTimeout, errors.Is(m.Err, ErrUpstreamTimeout))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package reverseproxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// UpstreamTLS configures the TLS connections to the upstreams, e.g. to authenticate the proxy to
+// zero-trust backends with a client certificate, or to pin their keys. It's set per backend with
+// BackendTLS, or per route with Route.SetUpstreamTLS.
+type UpstreamTLS struct {
+	// Certificates are the client certificates presented to the upstream.
+	Certificates []tls.Certificate
+	// RootCAs verifies the certificates of the upstream, the system pool if nil.
+	RootCAs *x509.CertPool
+	// ServerName overrides the SNI server name, which is verified against the upstream certificate,
+	// e.g. for upstreams addressed by IP. The host of the upstream URL is used if empty.
+	ServerName string
+	// InsecureSkipVerify disables the verification of the upstream certificates. The Pins are still
+	// verified, e.g. to pin the self-signed certificate of an upstream.
+	InsecureSkipVerify bool
+	// MinVersion is the minimum TLS version, TLS 1.2 if zero.
+	MinVersion uint16
+	// Pins are the SPKI pins of the upstream, see SPKIPin. If set, a certificate of the verified chain,
+	// or the leaf certificate without verification, must have the public key of a pin.
+	Pins []string
+}
+
+var (
+	// ErrPinMismatch is returned for upstreams without a certificate matching the pins.
+	ErrPinMismatch = errors.New("upstream certificate doesn't match the SPKI pins")
+	// ErrTLSTransport is returned when registering a route with an UpstreamTLS and a Transport which
+	// isn't an *http.Transport, whose TLS configuration can't be set.
+	ErrTLSTransport = errors.New("upstream TLS requires an *http.Transport")
+)
+
+// SPKIPin returns the pin of the public key of the certificate: the base64 SHA-256 hash of its DER
+// SubjectPublicKeyInfo, as printed by:
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// LoadUpstreamTLS loads the client certificate and key, and the CA bundle verifying the upstream, from
+// PEM files. Empty file names are skipped.
+func LoadUpstreamTLS(certFile, keyFile, caFile string) (*UpstreamTLS, error) {
+	cfg := &UpstreamTLS{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in CA bundle " + caFile)
+		}
+	}
+	return cfg, nil
+}
+
+// Config returns the TLS client configuration.
+func (t *UpstreamTLS) Config() *tls.Config {
+	cfg := &tls.Config{
+		Certificates:       t.Certificates,
+		RootCAs:            t.RootCAs,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         t.MinVersion,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if len(t.Pins) > 0 {
+		pins := slices.Clone(t.Pins)
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+	return cfg
+}
+
+// verifyPins checks that a certificate of the verified chains, or the leaf certificate if the chain
+// wasn't verified, matches a pin. The other presented certificates aren't trusted without verification,
+// since any server can send a copy of a public pinned certificate along with its own.
+func verifyPins(cs tls.ConnectionState, pins []string) error {
+	chains := cs.VerifiedChains
+	if len(chains) == 0 && len(cs.PeerCertificates) > 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if slices.Contains(pins, SPKIPin(cert)) {
+				return nil
+			}
+		}
+	}
+	return ErrPinMismatch
+}
+
+// Transport returns an HTTP transport with the settings of http.DefaultTransport and the TLS client
+// configuration.
+func (t *UpstreamTLS) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = t.Config()
+	return transport
+}
+
+// routeTLS is the transport of a route with an UpstreamTLS. It's kept by the registered route, so the
+// handlers rebuilt on route changes share its pooled connections.
+type routeTLS struct {
+	cfg       *UpstreamTLS
+	base      *http.Transport
+	transport *http.Transport
+}
+
+// newRouteTLS returns the TLS transport of the route, built from a clone of the Transport of the route,
+// or the one the route already holds if the TLS configuration and the Transport didn't change.
+func newRouteTLS(route Route) (*routeTLS, error) {
+	base, ok := route.Transport.(*http.Transport)
+	if route.Transport != nil && !ok {
+		return nil, ErrTLSTransport
+	}
+	if t := route.tls; t != nil && t.cfg == route.TLS && t.base == base {
+		return t, nil
+	}
+	t := &routeTLS{cfg: route.TLS, base: base}
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t.transport = base.Clone()
+	t.transport.TLSClientConfig = route.TLS.Config()
+	return t, nil
+}
+
+// closeRemovedTLS closes the idle connections of the TLS transports of the old routes which aren't used
+// by the new routes.
+func closeRemovedTLS(old, routes []Route) {
+	used := make(map[*routeTLS]bool, len(routes))
+	for _, r := range routes {
+		used[r.tls] = true
+	}
+	for _, r := range old {
+		if r.tls != nil && !used[r.tls] {
+			r.tls.transport.CloseIdleConnections()
+		}
+	}
+}
+
+// BackendTLS sets the TLS configuration of the connections to the backend, overriding the Transport of
+// the mux with a transport of the configuration. It's combined with a previous BackendDial or
+// BackendTransport option setting an *http.Transport.
+func BackendTLS(cfg *UpstreamTLS) BackendOption {
+	return func(b *Backend) {
+		t := backendTransport(b)
+		t.TLSClientConfig = cfg.Config()
+		b.transport = t
+	}
+}
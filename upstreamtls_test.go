@@ -0,0 +1,273 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPKI is a CA issuing the certificates of the mTLS tests.
+type testPKI struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testPKI{cert: cert, key: key, pool: pool}
+}
+
+// issue issues a certificate of the common name, valid for the DNS name and the loopback address.
+func (p *testPKI) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.cert, &key.PublicKey, p.key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newMTLSOrigin starts an origin requiring client certificates of the CA, answering their common name.
+func newMTLSOrigin(t *testing.T, pki *testPKI) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName + " " + r.TLS.ServerName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.issue(t, "upstream.internal", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRoute_SetUpstreamTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	origin := newMTLSOrigin(t, pki)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+	leafPin := SPKIPin(origin.Certificate())
+	clientCert, _ := x509.ParseCertificate(client.Certificate[0])
+
+	tests := []struct {
+		name       string
+		tls        *UpstreamTLS
+		wantStatus int
+		wantBody   string
+	}{
+		{"Test client certificate", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool}, http.StatusOK, "proxy "},
+		{"Test SNI override", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, ServerName: "upstream.internal"}, http.StatusOK, "proxy upstream.internal"},
+		{"Test mismatching server name", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, ServerName: "other.internal"}, http.StatusBadGateway, ""},
+		{"Test missing client certificate", &UpstreamTLS{RootCAs: pki.pool}, http.StatusBadGateway, ""},
+		{"Test unknown CA", &UpstreamTLS{Certificates: []tls.Certificate{client}}, http.StatusBadGateway, ""},
+		{"Test leaf pin", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, Pins: []string{"other", leafPin}}, http.StatusOK, "proxy "},
+		{"Test CA pin", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, Pins: []string{SPKIPin(pki.cert)}}, http.StatusOK, "proxy "},
+		{"Test pin without verification", &UpstreamTLS{Certificates: []tls.Certificate{client}, InsecureSkipVerify: true, Pins: []string{leafPin}}, http.StatusOK, "proxy "},
+		{"Test mismatching pin", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, Pins: []string{SPKIPin(clientCert)}}, http.StatusBadGateway, ""},
+		{"Test TLS 1.3 minimum", &UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool, MinVersion: tls.VersionTLS13}, http.StatusOK, "proxy "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.ErrorLog = log.New(io.Discard, "", 0)
+			pm.HandlePath(NewRoute("GET", "/secure").SetUpstreamTLS(tt.tls))
+
+			w := serve(pm, "GET", "/secure")
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRoute_SetUpstreamTLS_Transport(t *testing.T) {
+	pki := newTestPKI(t)
+	origin := newMTLSOrigin(t, pki)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+
+	var dialed atomic.Int32
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	pm.HandlePath(NewRoute("GET", "/secure").
+		SetTransport(transport).
+		SetUpstreamTLS(&UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool}))
+
+	w := serve(pm, "GET", "/secure")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "proxy ", w.Body.String())
+	assert.Equal(t, int32(1), dialed.Load())
+	assert.Empty(t, transport.TLSClientConfig.Certificates)
+}
+
+// closeTrackingConn records whether the connection was closed.
+type closeTrackingConn struct {
+	net.Conn
+	closed *atomic.Bool
+}
+
+func (c closeTrackingConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+func TestRoute_SetUpstreamTLS_RouteChanges(t *testing.T) {
+	pki := newTestPKI(t)
+	origin := newMTLSOrigin(t, pki)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+
+	var dialed atomic.Int32
+	var closed atomic.Bool
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		return closeTrackingConn{conn, &closed}, err
+	}
+	pm, err := New(origin.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/secure").
+		SetTransport(transport).
+		SetUpstreamTLS(&UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool})))
+
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/secure").Code)
+	assert.NoError(t, pm.AddRoute(NewRoute("GET", "/other")))
+	assert.Equal(t, http.StatusOK, serve(pm, "GET", "/secure").Code)
+	assert.Equal(t, int32(1), dialed.Load(), "the connection should be reused after the route change")
+
+	assert.NoError(t, pm.RemoveRoute("/secure"))
+	assert.True(t, closed.Load(), "the idle connection of the removed route should be closed")
+}
+
+func TestRoute_SetUpstreamTLS_OtherTransport(t *testing.T) {
+	pm, err := New("https://127.0.0.1:1")
+	assert.NoError(t, err)
+	route := NewRoute("GET", "/secure").
+		SetTransport(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("unreachable")
+		})).
+		SetUpstreamTLS(&UpstreamTLS{ServerName: "origin"})
+	assert.ErrorIs(t, pm.AddRoute(route), ErrTLSTransport)
+}
+
+func TestBackendTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	origin := newMTLSOrigin(t, pki)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+
+	pm, err := New("http://127.0.0.1:1")
+	assert.NoError(t, err)
+	b, err := pm.AddBackend(origin.URL, BackendTLS(&UpstreamTLS{Certificates: []tls.Certificate{client}, RootCAs: pki.pool}))
+	assert.NoError(t, err)
+	assert.NoError(t, pm.RemoveBackend(context.Background(), pm.Backends()[0]))
+	assert.Equal(t, []*Backend{b}, pm.Backends())
+	pm.PassPath("GET", "/secure")
+
+	w := serve(pm, "GET", "/secure")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "proxy ", w.Body.String())
+}
+
+func TestLoadUpstreamTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	client := pki.issue(t, "proxy", x509.ExtKeyUsageClientAuth)
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+		return file
+	}
+	key, _ := x509.MarshalECPrivateKey(client.PrivateKey.(*ecdsa.PrivateKey))
+	certFile := write("client.crt", "CERTIFICATE", client.Certificate[0])
+	keyFile := write("client.key", "EC PRIVATE KEY", key)
+	caFile := write("ca.crt", "CERTIFICATE", pki.cert.Raw)
+
+	cfg, err := LoadUpstreamTLS(certFile, keyFile, caFile)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Certificates, 1)
+	assert.True(t, cfg.RootCAs.Equal(pki.pool))
+
+	cfg, err = LoadUpstreamTLS("", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &UpstreamTLS{}, cfg)
+
+	_, err = LoadUpstreamTLS("", "", keyFile)
+	assert.ErrorContains(t, err, "no certificates in CA bundle")
+	_, err = LoadUpstreamTLS(certFile, "", "")
+	assert.Error(t, err)
+}
+
+func TestVerifyPins(t *testing.T) {
+	pki := newTestPKI(t)
+	leaf, _ := x509.ParseCertificate(pki.issue(t, "upstream.internal", x509.ExtKeyUsageServerAuth).Certificate[0])
+	other, _ := x509.ParseCertificate(pki.issue(t, "other.internal", x509.ExtKeyUsageServerAuth).Certificate[0])
+
+	tests := []struct {
+		name string
+		cs   tls.ConnectionState
+		pins []string
+		want error
+	}{
+		{"Test verified leaf", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, VerifiedChains: [][]*x509.Certificate{{leaf, pki.cert}}}, []string{SPKIPin(leaf)}, nil},
+		{"Test verified CA", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, VerifiedChains: [][]*x509.Certificate{{leaf, pki.cert}}}, []string{SPKIPin(pki.cert)}, nil},
+		{"Test unverified leaf", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}, []string{SPKIPin(leaf)}, nil},
+		{"Test unverified copy of pinned certificate", tls.ConnectionState{PeerCertificates: []*x509.Certificate{other, leaf}}, []string{SPKIPin(leaf)}, ErrPinMismatch},
+		{"Test unverified CA", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, pki.cert}}, []string{SPKIPin(pki.cert)}, ErrPinMismatch},
+		{"Test no certificates", tls.ConnectionState{}, []string{SPKIPin(leaf)}, ErrPinMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, verifyPins(tt.cs, tt.pins), tt.want)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// viaProtocol returns the received-protocol of a Via entry of the HTTP version, e.g. 1.1 or 2.
+func viaProtocol(major, minor int) string {
+	if major >= 2 {
+		return strconv.Itoa(major)
+	}
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// addVia appends the entry of the proxy pseudonym to the Via header.
+func addVia(h http.Header, major, minor int, pseudonym string) {
+	entry := viaProtocol(major, minor) + " " + pseudonym
+	if via := h.Values("Via"); len(via) > 0 {
+		h.Set("Via", strings.Join(via, ", ")+", "+entry)
+		return
+	}
+	h.Set("Via", entry)
+}
+
+// viaLoop returns whether the Via header has an entry received by the proxy pseudonym, meaning the
+// request was forwarded to the proxy by itself.
+func viaLoop(h http.Header, pseudonym string) bool {
+	for _, via := range h.Values("Via") {
+		for _, entry := range strings.Split(via, ",") {
+			if fields := strings.Fields(entry); len(fields) >= 2 && strings.EqualFold(fields[1], pseudonym) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package reverseproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViaLoop(t *testing.T) {
+	tests := []struct {
+		name string
+		via  []string
+		want bool
+	}{
+		{"Test without Via", nil, false},
+		{"Test other proxies", []string{"1.1 cdn, 2 lb (internal)"}, false},
+		{"Test own entry", []string{"1.1 cdn, 1.1 edge-proxy"}, true},
+		{"Test own entry with comment", []string{"1.0 fred", "1.1 EDGE-PROXY (go-reverse-proxy)"}, true},
+		{"Test pseudonym as comment", []string{"1.1 cdn (edge-proxy)"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, viaLoop(http.Header{"Via": tt.via}, "edge-proxy"))
+		})
+	}
+}
+
+func TestVia(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Via", "1.1 varnish")
+		_, _ = w.Write([]byte(r.Header.Get("Via")))
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name         string
+		via          string
+		requestVia   string
+		wantStatus   int
+		wantUpstream string
+		wantVia      string
+	}{
+		{"Test disabled", "", "1.1 cdn", http.StatusOK, "1.1 cdn", "1.1 varnish"},
+		{"Test request without Via", "edge", "", http.StatusOK, "1.1 edge", "1.1 varnish, 1.1 edge"},
+		{"Test appended entry", "edge", "1.0 cdn", http.StatusOK, "1.0 cdn, 1.1 edge", "1.1 varnish, 1.1 edge"},
+		{"Test loop", "edge", "1.1 edge", http.StatusLoopDetected, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := New(origin.URL)
+			assert.NoError(t, err)
+			pm.Via = tt.via
+			pm.PassPath("GET", "/")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.requestVia != "" {
+				r.Header.Set("Via", tt.requestVia)
+			}
+			pm.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantUpstream, w.Body.String())
+				assert.Equal(t, tt.wantVia, w.Header().Get("Via"))
+			}
+		})
+	}
+}